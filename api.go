@@ -0,0 +1,194 @@
+package melanzana
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// scrapeSnapshot holds the most recent cycle's scrape for the API.
+type scrapeSnapshot struct {
+	mu           sync.Mutex
+	appointments []Appointment
+	at           time.Time
+}
+
+// latestScrape is the process-wide snapshot, updated after every cycle
+// whose scrape succeeded.
+var latestScrape = &scrapeSnapshot{}
+
+func (s *scrapeSnapshot) update(appointments []Appointment, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.appointments, s.at = appointments, at
+}
+
+func (s *scrapeSnapshot) get() ([]Appointment, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.appointments, s.at
+}
+
+// apiServer serves read-only views of the watcher's state:
+//
+//	GET /api/appointments             slots available at the last check, and how far ahead they can be booked
+//	GET /api/appointments.ics         the same slots as an iCalendar feed
+//	GET /api/appointments/new?since=  slots that appeared or reopened since a time
+//	GET /api/history?since=           availability changes, optionally since a time
+//
+// since is an RFC 3339 time. History comes from the configured state store,
+// so it includes changes recorded by earlier runs. With a subscriber API
+// token, the subscriber endpoints are served too.
+type apiServer struct {
+	latest      *scrapeSnapshot
+	horizon     *maxDateTracker // nil for none
+	store       func() (Store, error)
+	subscribers *subscriberAPI // nil unless subscriberApiToken is set
+}
+
+func newAPIServer(config AppConfig) *apiServer {
+	a := &apiServer{latest: latestScrape, horizon: observedMaxDates, store: func() (Store, error) { return newStore(config) }}
+	if config.SubscriberAPIToken != "" {
+		a.subscribers = &subscriberAPI{config: config, store: a.store}
+	}
+	return a
+}
+
+// appointmentsResponse is the body of /api/appointments and /api/appointments/new.
+type appointmentsResponse struct {
+	UpdatedAt       *time.Time        `json:"updatedAt,omitempty"`       // When the slots were checked; absent before the first check
+	BookableThrough map[string]string `json:"bookableThrough,omitempty"` // Each calendar's max_date at the last check, by name; "" for a single unnamed calendar. Only in /api/appointments
+	Appointments    []Appointment     `json:"appointments"`
+}
+
+// historyResponse is the body of /api/history.
+type historyResponse struct {
+	Events []AvailabilityEvent `json:"events"`
+}
+
+func (a *apiServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/appointments", a.appointments)
+	mux.HandleFunc("GET /api/appointments.ics", a.calendar)
+	mux.HandleFunc("GET /api/appointments/new", a.newAppointments)
+	mux.HandleFunc("GET /api/history", a.history)
+	if a.subscribers != nil {
+		a.subscribers.register(mux)
+	}
+	return mux
+}
+
+func (a *apiServer) appointments(w http.ResponseWriter, r *http.Request) {
+	appointments, at := a.latest.get()
+	resp := appointmentsResponse{Appointments: appointments}
+	if !at.IsZero() {
+		resp.UpdatedAt = &at
+	}
+	if a.horizon != nil {
+		for calendar, maxDate := range a.horizon.get() {
+			if maxDate == "" {
+				continue
+			}
+			if resp.BookableThrough == nil {
+				resp.BookableThrough = map[string]string{}
+			}
+			resp.BookableThrough[calendar] = maxDate
+		}
+	}
+	if resp.Appointments == nil {
+		resp.Appointments = []Appointment{}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (a *apiServer) calendar(w http.ResponseWriter, r *http.Request) {
+	appointments, _ := a.latest.get()
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	if err := writeICS(w, appointments, clock.Now()); err != nil {
+		slog.Warn("Error writing calendar feed", "err", err)
+	}
+}
+
+func (a *apiServer) newAppointments(w http.ResponseWriter, r *http.Request) {
+	since, ok := parseSince(w, r)
+	if !ok {
+		return
+	}
+	if since.IsZero() {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "since is required"})
+		return
+	}
+	events, ok := a.events(w, since)
+	if !ok {
+		return
+	}
+	_, at := a.latest.get()
+	resp := appointmentsResponse{Appointments: []Appointment{}}
+	if !at.IsZero() {
+		resp.UpdatedAt = &at
+	}
+	for _, e := range events {
+		if e.Kind == eventAppeared || e.Kind == eventReappeared {
+			resp.Appointments = append(resp.Appointments, Appointment{
+				Date: e.Date, Time: e.Time, Calendar: e.Calendar, Spaces: e.Spaces, IsAvailable: true, ObservedAt: e.At,
+			})
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (a *apiServer) history(w http.ResponseWriter, r *http.Request) {
+	since, ok := parseSince(w, r)
+	if !ok {
+		return
+	}
+	events, ok := a.events(w, since)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, historyResponse{Events: events})
+}
+
+// events returns the recorded changes after since, writing an error
+// response if the store can't be read.
+func (a *apiServer) events(w http.ResponseWriter, since time.Time) ([]AvailabilityEvent, bool) {
+	store, err := a.store()
+	if err == nil {
+		var history []AvailabilityEvent
+		if history, err = store.History(); err == nil {
+			events := []AvailabilityEvent{}
+			for _, e := range history {
+				if e.At.After(since) {
+					events = append(events, e)
+				}
+			}
+			return events, true
+		}
+	}
+	slog.Error("Error reading availability history for the API", "err", err)
+	writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "availability history is unavailable"})
+	return nil, false
+}
+
+// parseSince reads the optional since parameter, writing an error response
+// if it is malformed.
+func parseSince(w http.ResponseWriter, r *http.Request) (time.Time, bool) {
+	value := r.URL.Query().Get("since")
+	if value == "" {
+		return time.Time{}, true
+	}
+	since, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "since must be an RFC 3339 time like 2025-07-01T08:00:00Z"})
+		return time.Time{}, false
+	}
+	return since, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,130 @@
+package melanzana
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pashbylogan/melanzana/pkg/store"
+)
+
+func TestAPIServer(t *testing.T) {
+	dir := t.TempDir()
+	store := &store.JSONFile{Path: filepath.Join(dir, "seen.json"), HistoryPath: filepath.Join(dir, "history.jsonl")}
+	at := time.Date(2024, 5, 15, 9, 0, 0, 0, time.UTC)
+	err := store.AppendHistory([]AvailabilityEvent{
+		{At: at, Kind: eventAppeared, Date: "2024-05-20", Time: "10:00 am – 10:30 am", Spaces: 2},
+		{At: at.Add(time.Hour), Kind: eventDisappeared, Date: "2024-05-20", Time: "10:00 am – 10:30 am"},
+		{At: at.Add(2 * time.Hour), Kind: eventAppeared, Date: "2024-05-21", Time: "9:00 am – 9:30 am", Spaces: 1},
+		{At: at.Add(3 * time.Hour), Kind: eventReappeared, Date: "2024-05-20", Time: "10:00 am – 10:30 am", Spaces: 1},
+	})
+	if err != nil {
+		t.Fatalf("AppendHistory() error = %v", err)
+	}
+
+	api := &apiServer{latest: &scrapeSnapshot{}, horizon: &maxDateTracker{}, store: func() (Store, error) { return store, nil }}
+	s := &healthServer{status: &healthStatus{}, now: time.Now, api: api.handler()}
+	server := httptest.NewServer(s.handler())
+	defer server.Close()
+
+	get := func(path string, body any) int {
+		t.Helper()
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s error = %v", path, err)
+		}
+		defer resp.Body.Close()
+		if body != nil && resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(body); err != nil {
+				t.Fatalf("GET %s body: %v", path, err)
+			}
+		}
+		return resp.StatusCode
+	}
+
+	var current appointmentsResponse
+	if code := get("/api/appointments", &current); code != http.StatusOK || current.UpdatedAt != nil || current.BookableThrough != nil || current.Appointments == nil || len(current.Appointments) != 0 {
+		t.Errorf("/api/appointments before the first check = %d %+v, want 200 with no slots", code, current)
+	}
+	api.latest.update([]Appointment{{Date: "2024-05-21", Time: "9:00 am – 9:30 am", Spaces: 1, IsAvailable: true}}, at.Add(4*time.Hour))
+	api.horizon.set(map[string]string{"": "2024-07-31"})
+	if get("/api/appointments", &current); current.UpdatedAt == nil || !current.UpdatedAt.Equal(at.Add(4*time.Hour)) || len(current.Appointments) != 1 || current.BookableThrough[""] != "2024-07-31" {
+		t.Errorf("/api/appointments = %+v, want the last scrape", current)
+	}
+	if resp, err := http.Get(server.URL + "/api/appointments.ics"); err != nil {
+		t.Errorf("GET /api/appointments.ics error = %v", err)
+	} else {
+		resp.Body.Close()
+		if ct := resp.Header.Get("Content-Type"); resp.StatusCode != http.StatusOK || !strings.HasPrefix(ct, "text/calendar") {
+			t.Errorf("/api/appointments.ics = %d %q, want 200 text/calendar", resp.StatusCode, ct)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		path  string
+		code  int
+		dates []string // Dates of the returned appointments or events, in order
+	}{
+		{"NewSince", "/api/appointments/new?since=2024-05-15T09:30:00Z", http.StatusOK, []string{"2024-05-21", "2024-05-20"}},
+		{"NewSinceOffset", "/api/appointments/new?since=2024-05-15T05:30:00-04:00", http.StatusOK, []string{"2024-05-21", "2024-05-20"}},
+		{"NewWithoutSince", "/api/appointments/new", http.StatusBadRequest, nil},
+		{"NewBadSince", "/api/appointments/new?since=yesterday", http.StatusBadRequest, nil},
+		{"History", "/api/history", http.StatusOK, []string{"2024-05-20", "2024-05-20", "2024-05-21", "2024-05-20"}},
+		{"HistorySince", "/api/history?since=2024-05-15T10:00:00Z", http.StatusOK, []string{"2024-05-21", "2024-05-20"}},
+		{"HistoryAfterAll", "/api/history?since=2024-06-01T00:00:00Z", http.StatusOK, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body struct {
+				Appointments []Appointment       `json:"appointments"`
+				Events       []AvailabilityEvent `json:"events"`
+			}
+			code := get(tt.path, &body)
+			if code != tt.code {
+				t.Fatalf("GET %s status = %d, want %d", tt.path, code, tt.code)
+			}
+			if tt.dates == nil {
+				return
+			}
+			var dates []string
+			for _, a := range body.Appointments {
+				dates = append(dates, a.Date)
+			}
+			for _, e := range body.Events {
+				dates = append(dates, e.Date)
+			}
+			if len(dates) != len(tt.dates) {
+				t.Fatalf("GET %s dates = %v, want %v", tt.path, dates, tt.dates)
+			}
+			for i := range dates {
+				if dates[i] != tt.dates[i] {
+					t.Errorf("GET %s dates = %v, want %v", tt.path, dates, tt.dates)
+					break
+				}
+			}
+		})
+	}
+
+	resp, err := http.Post(server.URL+"/api/history", "application/json", nil)
+	if err != nil {
+		t.Fatalf("POST /api/history error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST /api/history status = %d, want %d", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestHealthServerWithoutAPI(t *testing.T) {
+	s := &healthServer{status: &healthStatus{}, now: time.Now}
+	rec := httptest.NewRecorder()
+	s.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/appointments", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("/api/appointments without serveApi = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
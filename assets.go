@@ -0,0 +1,54 @@
+package melanzana
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// embeddedAssets holds the default templates so deployment stays a single binary.
+//
+//go:embed templates
+var embeddedAssets embed.FS
+
+// readAsset returns the named asset (e.g. "templates/email.html.tmpl"). A file
+// at the same relative path under overrideDir takes precedence over the
+// embedded copy, so individual assets can be customized without rebuilding.
+func readAsset(overrideDir, name string) ([]byte, error) {
+	if overrideDir != "" {
+		data, err := os.ReadFile(filepath.Join(overrideDir, filepath.FromSlash(name)))
+		if err == nil {
+			return data, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read asset override %s: %w", name, err)
+		}
+	}
+
+	data, err := embeddedAssets.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedded asset %s: %w", name, err)
+	}
+	return data, nil
+}
+
+// exportAssets writes every embedded asset under dir, as a starting point for overrides.
+func exportAssets(dir string) error {
+	return fs.WalkDir(embeddedAssets, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, filepath.FromSlash(path))
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		data, err := embeddedAssets.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, 0644)
+	})
+}
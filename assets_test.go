@@ -0,0 +1,39 @@
+package melanzana
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadAssetOverride(t *testing.T) {
+	embedded, err := readAsset("", "templates/footer.txt.tmpl")
+	if err != nil || len(embedded) == 0 {
+		t.Fatalf("readAsset() embedded = %q, %v", embedded, err)
+	}
+
+	dir := t.TempDir()
+
+	// Without an override file the embedded asset is used.
+	data, err := readAsset(dir, "templates/footer.txt.tmpl")
+	if err != nil || string(data) != string(embedded) {
+		t.Errorf("readAsset() without override = %q, %v; want embedded copy", data, err)
+	}
+
+	if err := exportAssets(dir); err != nil {
+		t.Fatalf("exportAssets() error = %v", err)
+	}
+	override := filepath.Join(dir, "templates", "footer.txt.tmpl")
+	if err := os.WriteFile(override, []byte("custom"), 0644); err != nil {
+		t.Fatalf("Failed to write override: %v", err)
+	}
+
+	data, err = readAsset(dir, "templates/footer.txt.tmpl")
+	if err != nil || string(data) != "custom" {
+		t.Errorf("readAsset() with override = %q, %v; want custom", data, err)
+	}
+
+	if _, err := readAsset(dir, "templates/missing.tmpl"); err == nil {
+		t.Errorf("readAsset() for missing asset error = nil, want error")
+	}
+}
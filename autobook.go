@@ -0,0 +1,333 @@
+package melanzana
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pashbylogan/melanzana/pkg/notify"
+)
+
+// AutoBookConfig describes the booking request sent for a new slot when
+// features.autoBook is on.
+type AutoBookConfig struct {
+	Name      string            `json:"name"`      // Who to book for
+	Email     string            `json:"email"`     // Booked with, and told the outcome
+	Phone     string            `json:"phone"`     // Booked with if set, and texted the outcome through the sms settings
+	Telegram  string            `json:"telegram"`  // Telegram chat ID also messaged the outcome, and offered Book buttons when telegramBot runs
+	Weekdays  []string          `json:"weekdays"`  // Only book slots on these days, e.g. ["Sat", "Sun"]; empty means every day
+	MinSpaces int               `json:"minSpaces"` // Only book slots with at least this many spaces
+	Calendars []string          `json:"calendars"` // Only book slots of these calendars; empty means every calendar
+	From      string            `json:"from"`      // First slot date to book, as YYYY-MM-DD; empty means from today
+	To        string            `json:"to"`        // Last slot date to book; empty means no limit
+	URL       string            `json:"url"`       // Booking request endpoint, with the slotBookingUrl placeholders, e.g. the shop's "https://melanzana.com/cart/add.js"
+	Form      map[string]string `json:"form"`      // Form fields POSTed to url, with the slotBookingUrl placeholders, {end}, {name}, {email} and {phone}
+	StateFile string            `json:"stateFile"` // Where booking attempts are kept, so no slot is tried twice and nothing is booked after a success
+}
+
+func defaultAutoBookConfig() AutoBookConfig {
+	return AutoBookConfig{
+		Form:      map[string]string{"id": "{variantId}", "quantity": "1"},
+		StateFile: "autobook_state.json",
+	}
+}
+
+// booker is the person booked for, as a recipient of the outcome whose
+// preferences pick the slots to book.
+func (c AutoBookConfig) booker() Recipient {
+	return Recipient{Name: c.Name, Email: c.Email, Phone: c.Phone, Telegram: c.Telegram,
+		Weekdays: c.Weekdays, MinSpaces: c.MinSpaces, Calendars: c.Calendars, From: c.From, To: c.To}
+}
+
+// check describes the first problem that would stop a booking.
+func (c AutoBookConfig) check() error {
+	if u, err := url.Parse(c.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("autoBooking.url must be an http or https URL, got %q", c.URL)
+	}
+	if c.Name == "" || c.Email == "" {
+		return fmt.Errorf("autoBooking needs a name and email to book with")
+	}
+	if _, errs := compileRecipients([]Recipient{c.booker()}); len(errs) > 0 {
+		return fmt.Errorf("autoBooking: %w", errs[0])
+	}
+	return nil
+}
+
+// bookingAttempt is one booking request and how it went.
+type bookingAttempt struct {
+	Slot   Appointment `json:"slot"`
+	At     time.Time   `json:"at"`
+	Booked bool        `json:"booked"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// autoBookState is every booking attempt made, kept between runs.
+type autoBookState struct {
+	Attempts []bookingAttempt `json:"attempts"`
+}
+
+// loadAutoBookState reads the booking attempts from path, returning empty
+// state if the file doesn't exist.
+func loadAutoBookState(path string) (*autoBookState, error) {
+	state := &autoBookState{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("failed to read booking attempts %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse booking attempts %s: %w", path, err)
+	}
+	return state, nil
+}
+
+// saveAutoBookState writes the booking attempts to path.
+func saveAutoBookState(state *autoBookState, path string) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal booking attempts: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write booking attempts %s: %w", path, err)
+	}
+	return nil
+}
+
+// autoBookMu serializes reading and writing the booking attempts, which
+// both the autoBook sink and the Telegram bot do.
+var autoBookMu sync.Mutex
+
+// booked returns the successful attempt, if there is one.
+func (s *autoBookState) booked() (bookingAttempt, bool) {
+	for _, a := range s.Attempts {
+		if a.Booked {
+			return a, true
+		}
+	}
+	return bookingAttempt{}, false
+}
+
+// tried reports whether a booking of appt has been attempted.
+func (s *autoBookState) tried(appt Appointment) bool {
+	for _, a := range s.Attempts {
+		if appointmentKey(a.Slot) == appointmentKey(appt) {
+			return true
+		}
+	}
+	return false
+}
+
+// firstBookable returns the earliest of appointments the booker wants that
+// hasn't been tried.
+func (s *autoBookState) firstBookable(booker Recipient, appointments []Appointment) (Appointment, bool) {
+	var first Appointment
+	var firstStart time.Time
+	found := false
+	for _, appt := range appointments {
+		if !booker.matches(appt) || s.tried(appt) {
+			continue
+		}
+		start, _, err := parseSlotTimes(appt)
+		if err != nil {
+			continue
+		}
+		if !found || start.Before(firstStart) {
+			first, firstStart, found = appt, start, true
+		}
+	}
+	return first, found
+}
+
+// bookingRequest builds the booking request for appt.
+func bookingRequest(config AppConfig, appt Appointment) (*http.Request, error) {
+	c := config.AutoBooking
+	endpoint := strings.NewReplacer(slotPlaceholders(appt, url.QueryEscape)...).Replace(c.URL)
+	fields := strings.NewReplacer(append(slotPlaceholders(appt, func(s string) string { return s }),
+		"{name}", c.Name, "{email}", c.Email, "{phone}", c.Phone)...)
+	form := url.Values{}
+	for name, value := range c.Form {
+		form.Set(name, fields.Replace(value))
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build booking request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", userAgent(config))
+	return req, nil
+}
+
+// bookSlot sends the booking request for appt once, without retrying, as a
+// retry after a lost response could book twice. A 2xx answer is a booking.
+func bookSlot(config AppConfig, appt Appointment) bookingAttempt {
+	attempt := bookingAttempt{Slot: appt, At: clock.Now()}
+	req, err := bookingRequest(config, appt)
+	if err == nil {
+		var resp *http.Response
+		if resp, err = providerHTTPClient.Do(req); err == nil {
+			detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+			resp.Body.Close()
+			if resp.StatusCode < 200 || resp.StatusCode > 299 {
+				err = fmt.Errorf("booking request returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+			}
+		}
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+	} else {
+		attempt.Booked = true
+	}
+	return attempt
+}
+
+// reportBooking tells the booker how a booking attempt went.
+func reportBooking(config AppConfig, a bookingAttempt) {
+	slot := fmt.Sprintf("%s at %s%s", a.Slot.Date, a.Slot.Time, calendarSuffix(a.Slot))
+	subject := "Booked Melanzana slot " + slot
+	body := fmt.Sprintf("The shop accepted the booking request for the %s slot for %s. Finish any remaining steps, such as checkout, at %s", slot, config.AutoBooking.Name, slotBookingLink(a.Slot))
+	if !a.Booked {
+		subject = "Couldn't book Melanzana slot " + slot
+		body = fmt.Sprintf("Booking the %s slot failed: %s\n\nBook it yourself at %s", slot, a.Error, slotBookingLink(a.Slot))
+	}
+	sendMessage(config, config.AutoBooking.booker(), subject, body)
+}
+
+// autoBook tries to book the earliest new slot the booker wants, once a
+// cycle, until one is booked. It runs before the notify sink, as slots are
+// often gone within minutes.
+func autoBook(ev changeEvent) error {
+	config := ev.Config
+	if !config.Features.AutoBook || ev.Outcome == nil {
+		return nil
+	}
+	if err := config.AutoBooking.check(); err != nil {
+		return err
+	}
+	autoBookMu.Lock()
+	defer autoBookMu.Unlock()
+	state, err := loadAutoBookState(config.AutoBooking.StateFile)
+	if err != nil {
+		return err
+	}
+	if _, done := state.booked(); done {
+		return nil
+	}
+	appt, ok := state.firstBookable(config.AutoBooking.booker(), changedSlots(ev.Pending))
+	if !ok {
+		return nil
+	}
+	if config.ReadOnly || config.DryRun {
+		slog.Info("Read-only mode: not booking slot", "date", appt.Date, "time", appt.Time, "calendar", appt.Calendar)
+		return nil
+	}
+
+	attempt := bookSlot(config, appt)
+	state.Attempts = append(state.Attempts, attempt)
+	if attempt.Booked {
+		slog.Info("Booked slot", "date", appt.Date, "time", appt.Time, "calendar", appt.Calendar)
+	} else {
+		slog.Error("Error booking slot", "date", appt.Date, "time", appt.Time, "calendar", appt.Calendar, "err", attempt.Error)
+	}
+	reportBooking(config, attempt)
+	return saveAutoBookState(state, config.AutoBooking.StateFile)
+}
+
+// bookConfirmed books appt, which the booker confirmed, and records the
+// attempt. It returns nil without booking if appt is already booked.
+func bookConfirmed(config AppConfig, appt Appointment) (*bookingAttempt, error) {
+	autoBookMu.Lock()
+	defer autoBookMu.Unlock()
+	state, err := loadAutoBookState(config.AutoBooking.StateFile)
+	if err != nil {
+		return nil, err
+	}
+	if a, ok := state.booked(); ok && appointmentKey(a.Slot) == appointmentKey(appt) {
+		return nil, nil
+	}
+	attempt := bookSlot(config, appt)
+	state.Attempts = append(state.Attempts, attempt)
+	return &attempt, saveAutoBookState(state, config.AutoBooking.StateFile)
+}
+
+// bookButtonsMax is how many slots of a notification get a Book button.
+const bookButtonsMax = 10
+
+// bookingChat is the Telegram chat offered Book buttons: autoBooking's,
+// when the bot is running to answer them and a booking could be sent.
+func bookingChat(config AppConfig) string {
+	if !config.TelegramBot || config.PollIntervalMinutes <= 0 || config.AutoBooking.check() != nil {
+		return ""
+	}
+	return config.AutoBooking.Telegram
+}
+
+// bookButtons returns a Book button for each of the first appointments,
+// remembering them so the bot can tell which slot a press is for.
+// Telegram limits button data to 64 bytes, so a button carries a token
+// for its slot rather than the slot itself.
+func bookButtons(appointments []Appointment) [][]notify.TelegramButton {
+	var rows [][]notify.TelegramButton
+	for i, appt := range appointments {
+		if i == bookButtonsMax {
+			break
+		}
+		label := fmt.Sprintf("Book %s %s", appt.Date, appt.Time)
+		rows = append(rows, []notify.TelegramButton{{Text: label, CallbackData: "book:" + bookOffers.add(appt)}})
+	}
+	return rows
+}
+
+// bookOffers are the slots offered with Book buttons, by token.
+var bookOffers = &slotOffers{slots: make(map[string]slotOffer)}
+
+type slotOffers struct {
+	mu    sync.Mutex
+	slots map[string]slotOffer
+}
+
+type slotOffer struct {
+	slot      Appointment
+	offeredAt time.Time
+}
+
+// slotOfferTTL is how long a Book button keeps working.
+const slotOfferTTL = 24 * time.Hour
+
+// add remembers appt and returns its token, forgetting expired offers.
+func (o *slotOffers) add(appt Appointment) string {
+	sum := sha256.Sum256([]byte(appointmentKey(appt)))
+	token := hex.EncodeToString(sum[:8])
+	now := clock.Now()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for t, offer := range o.slots {
+		if now.Sub(offer.offeredAt) > slotOfferTTL {
+			delete(o.slots, t)
+		}
+	}
+	o.slots[token] = slotOffer{appt, now}
+	return token
+}
+
+// get returns the slot offered with token, if the offer hasn't expired.
+func (o *slotOffers) get(token string) (Appointment, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	offer, ok := o.slots[token]
+	if !ok || clock.Now().Sub(offer.offeredAt) > slotOfferTTL {
+		return Appointment{}, false
+	}
+	return offer.slot, true
+}
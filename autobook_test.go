@@ -0,0 +1,96 @@
+package melanzana
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAutoBook(t *testing.T) {
+	fixClock(t, time.Date(2099, 7, 1, 12, 0, 0, 0, time.UTC))
+	var bookings []url.Values
+	var emails []string
+	status := http.StatusUnprocessableEntity
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path == "/email" {
+			emails = append(emails, string(body))
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		form, _ := url.ParseQuery(string(body))
+		bookings = append(bookings, form)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	defer func(url string) { sendGridURL = url }(sendGridURL)
+	sendGridURL = server.URL + "/email"
+
+	stateFile := filepath.Join(t.TempDir(), "autobook_state.json")
+	config := AppConfig{
+		EmailProvider: "sendgrid",
+		EmailAPIKey:   "key",
+		FromEmail:     "from@example.com",
+		Features:      FeatureFlags{AutoBook: true},
+		AutoBooking: AutoBookConfig{
+			Name:      "Ada",
+			Email:     "ada@example.com",
+			MinSpaces: 2,
+			URL:       server.URL + "/cart/add.js",
+			Form:      map[string]string{"id": "123", "properties[Date]": "{date}", "properties[Time]": "{start}", "properties[Email]": "{email}"},
+			StateFile: stateFile,
+		},
+		Retry: RetryConfig{RetryPolicy: RetryPolicy{MaxAttempts: 1}},
+	}
+	tooSmall := Appointment{Date: "2099-07-02", Time: "10:00 am – 10:30 am", Spaces: 1}
+	later := Appointment{Date: "2099-07-04", Time: "11:00 am – 11:30 am", Spaces: 2}
+	earliest := Appointment{Date: "2099-07-03", Time: "10:00 am – 10:30 am", Spaces: 3}
+	cycle := func(config AppConfig, slots ...Appointment) {
+		t.Helper()
+		var pending []Change
+		for _, s := range slots {
+			pending = append(pending, Change{Kind: SlotAdded, Slot: s})
+		}
+		if err := autoBook(changeEvent{Config: config, Pending: pending, Outcome: &notifyOutcome{}}); err != nil {
+			t.Fatalf("autoBook() error = %v", err)
+		}
+	}
+
+	// The earliest slot the booker wants is tried first; the shop refuses it.
+	cycle(config, tooSmall, later, earliest)
+	if len(bookings) != 1 || bookings[0].Get("properties[Date]") != "2099-07-03" || bookings[0].Get("properties[Time]") != "10:00" || bookings[0].Get("properties[Email]") != "ada@example.com" {
+		t.Fatalf("booking requests = %v, want one for 2099-07-03 at 10:00 with the booker's email", bookings)
+	}
+	if len(emails) != 1 || !strings.Contains(emails[0], "Couldn't book") || !strings.Contains(emails[0], "ada@example.com") {
+		t.Errorf("emails = %q, want the failure reported to the booker", emails)
+	}
+
+	// A refused slot isn't tried again; the next one is booked.
+	status = http.StatusOK
+	cycle(config, later, earliest)
+	if len(bookings) != 2 || bookings[1].Get("properties[Date]") != "2099-07-04" {
+		t.Fatalf("booking requests = %v, want the 2099-07-04 slot tried next", bookings)
+	}
+	if len(emails) != 2 || !strings.Contains(emails[1], "Booked Melanzana slot") {
+		t.Errorf("emails = %q, want the booking reported", emails)
+	}
+
+	// Nothing more is booked after a success, and read-only runs never book.
+	cycle(config, Appointment{Date: "2099-07-05", Time: "10:00 am – 10:30 am", Spaces: 4})
+	config.AutoBooking.StateFile = filepath.Join(t.TempDir(), "autobook_state.json")
+	config.ReadOnly = true
+	cycle(config, earliest)
+	if len(bookings) != 2 {
+		t.Errorf("booking requests = %v, want none after a booking or in read-only mode", bookings)
+	}
+
+	state, err := loadAutoBookState(stateFile)
+	if err != nil || len(state.Attempts) != 2 || state.Attempts[0].Booked || !state.Attempts[1].Booked || !strings.Contains(state.Attempts[0].Error, "422") {
+		t.Errorf("booking attempts = %+v, %v; want a refusal then a booking", state, err)
+	}
+}
@@ -0,0 +1,168 @@
+package melanzana
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxDateTracker holds the furthest bookable date, the API's max_date, each
+// calendar reported in the latest scrape.
+type maxDateTracker struct {
+	mu    sync.Mutex
+	dates map[string]string // By calendar name; "" for a single unnamed calendar
+}
+
+// observedMaxDates is fed by scrapeAppointments.
+var observedMaxDates = &maxDateTracker{}
+
+func (t *maxDateTracker) set(dates map[string]string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.dates = dates
+}
+
+func (t *maxDateTracker) get() map[string]string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.dates
+}
+
+// laterMaxDate returns whichever of a and b, each a max_date, is later,
+// ignoring one that isn't a YYYY-MM-DD date.
+func laterMaxDate(a, b string) string {
+	if _, err := time.Parse("2006-01-02", b); err != nil || b <= a {
+		return a
+	}
+	return b
+}
+
+// BookingWindowState is the furthest bookable date each calendar has
+// offered, kept between runs to tell when the booking window is extended.
+type BookingWindowState struct {
+	MaxDates map[string]string `json:"maxDates"` // By calendar name; "" for a single unnamed calendar
+}
+
+// bookingWindowChange is a calendar's booking window being extended.
+type bookingWindowChange struct {
+	Calendar string
+	From, To string // Previous and new max_date
+}
+
+// loadBookingWindowState reads the state from path, returning empty state if
+// the file doesn't exist.
+func loadBookingWindowState(path string) (*BookingWindowState, error) {
+	state := &BookingWindowState{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("failed to read booking window state %s: %w", path, err)
+	}
+	if len(data) == 0 {
+		return state, nil
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse booking window state %s: %w", path, err)
+	}
+	return state, nil
+}
+
+// saveBookingWindowState writes the state to path.
+func saveBookingWindowState(state *BookingWindowState, path string) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal booking window state: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write booking window state %s: %w", path, err)
+	}
+	return nil
+}
+
+// extend records observed max dates later than the stored ones. It returns
+// the calendars whose window was extended, in name order, and whether the
+// state changed. A calendar's first max date is recorded without being
+// reported, as there is nothing to compare it with.
+func (s *BookingWindowState) extend(observed map[string]string) (changes []bookingWindowChange, changed bool) {
+	if s.MaxDates == nil {
+		s.MaxDates = map[string]string{}
+	}
+	for calendar, date := range observed {
+		previous, known := s.MaxDates[calendar]
+		if laterMaxDate(previous, date) == previous {
+			continue
+		}
+		s.MaxDates[calendar] = date
+		changed = true
+		if known {
+			changes = append(changes, bookingWindowChange{Calendar: calendar, From: previous, To: date})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Calendar < changes[j].Calendar })
+	return changes, changed
+}
+
+// bookingWindowNotification announces the WindowExtended changes, with how
+// many of scraped are in the newly opened dates. The slots themselves are
+// left to the usual notification.
+func bookingWindowNotification(changes []Change, scraped []Appointment) Notification {
+	var lines []string
+	for _, change := range changes {
+		if change.Kind != WindowExtended {
+			continue
+		}
+		c := change.Window
+		opened := 0
+		for _, appt := range scraped {
+			if appt.Calendar == c.Calendar && appt.Date > c.From && appt.Date <= c.To {
+				opened++
+			}
+		}
+		name := "Bookings"
+		if c.Calendar != "" {
+			name = c.Calendar + " bookings"
+		}
+		lines = append(lines, fmt.Sprintf("%s are now open through %s (until now, %s), with %d slots available in the new dates.", name, c.To, c.From, opened))
+	}
+	return Notification{
+		Subject: "New Melanzana booking window opened!",
+		Intro:   strings.Join(lines, "\n"),
+	}
+}
+
+// checkBookingWindow compares the max dates the latest scrape found with
+// the stored ones and publishes a WindowExtended change for each booking
+// window that was extended. With notifyBookingWindow, recipients are
+// alerted, as that is when a flood of fresh slots appears.
+func checkBookingWindow(config AppConfig, scraped []Appointment, opts RenderOptions) {
+	observed := observedMaxDates.get()
+	if len(observed) == 0 || config.BookingWindowFile == "" {
+		return
+	}
+	state, err := loadBookingWindowState(config.BookingWindowFile)
+	if err != nil {
+		slog.Warn("Error loading booking window state, starting fresh", "err", err)
+		state = &BookingWindowState{}
+	}
+	extended, changed := state.extend(observed)
+	if changed {
+		if config.ReadOnly {
+			slog.Info("Read-only mode: not saving booking window state", "file", config.BookingWindowFile)
+		} else if err := saveBookingWindowState(state, config.BookingWindowFile); err != nil {
+			slog.Error("Error saving booking window state", "err", err)
+		}
+	}
+	var changes []Change
+	for _, c := range extended {
+		slog.Info("Booking window extended", "calendar", c.Calendar, "from", c.From, "to", c.To)
+		changes = append(changes, Change{Kind: WindowExtended, Window: &c})
+	}
+	changeBus.publish(changeEvent{At: clock.Now(), Config: config, Scraped: scraped, Opts: opts, Changes: changes})
+}
@@ -0,0 +1,94 @@
+package melanzana
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBookingWindowStateExtend(t *testing.T) {
+	tests := []struct {
+		name        string
+		stored      map[string]string
+		observed    map[string]string
+		wantChanges []bookingWindowChange
+		wantChanged bool
+	}{
+		{"FirstSighting", nil, map[string]string{"": "2099-07-31"}, nil, true},
+		{"Unchanged", map[string]string{"": "2099-07-31"}, map[string]string{"": "2099-07-31"}, nil, false},
+		{"Extended", map[string]string{"": "2099-07-31"}, map[string]string{"": "2099-08-31"}, []bookingWindowChange{{"", "2099-07-31", "2099-08-31"}}, true},
+		{"Shortened", map[string]string{"": "2099-08-31"}, map[string]string{"": "2099-07-31"}, nil, false},
+		{"NotADate", map[string]string{"": "2099-07-31"}, map[string]string{"": "soon"}, nil, false},
+		{"Calendars", map[string]string{"Room B": "2099-07-31", "Room A": "2099-07-31"},
+			map[string]string{"Room B": "2099-08-31", "Room A": "2099-08-15", "Room C": "2099-08-31"},
+			[]bookingWindowChange{{"Room A", "2099-07-31", "2099-08-15"}, {"Room B", "2099-07-31", "2099-08-31"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := &BookingWindowState{MaxDates: tt.stored}
+			changes, changed := state.extend(tt.observed)
+			if !reflect.DeepEqual(changes, tt.wantChanges) || changed != tt.wantChanged {
+				t.Errorf("extend() = %+v, %v; want %+v, %v", changes, changed, tt.wantChanges, tt.wantChanged)
+			}
+		})
+	}
+}
+
+func TestCheckBookingWindow(t *testing.T) {
+	fixClock(t, time.Date(2099, 7, 1, 12, 0, 0, 0, time.UTC))
+	var emails []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		emails = append(emails, string(body))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+	defer func(url string) { sendGridURL = url }(sendGridURL)
+	sendGridURL = server.URL
+	defer observedMaxDates.set(nil)
+
+	config := AppConfig{
+		EmailProvider:       "sendgrid",
+		EmailAPIKey:         "key",
+		FromEmail:           "from@example.com",
+		ToEmails:            []string{"me@example.com"},
+		NotifyBookingWindow: true,
+		BookingWindowFile:   filepath.Join(t.TempDir(), "booking_window.json"),
+	}
+	scraped := []Appointment{
+		{Date: "2099-07-30", Time: "10:00 am – 10:30 am", Spaces: 1},
+		{Date: "2099-08-03", Time: "10:00 am – 10:30 am", Spaces: 2},
+		{Date: "2099-08-04", Time: "10:00 am – 10:30 am", Spaces: 1},
+	}
+
+	for _, step := range []struct {
+		maxDate    string
+		wantEmails int
+	}{
+		{"2099-07-31", 0}, // First sighting
+		{"2099-07-31", 0},
+		{"2099-08-31", 1},
+		{"2099-08-31", 1},
+	} {
+		observedMaxDates.set(map[string]string{"": step.maxDate})
+		checkBookingWindow(config, scraped, RenderOptions{})
+		if len(emails) != step.wantEmails {
+			t.Fatalf("after max_date %s, %d emails sent, want %d", step.maxDate, len(emails), step.wantEmails)
+		}
+	}
+	for _, want := range []string{"New Melanzana booking window opened!", "now open through 2099-08-31 (until now, 2099-07-31), with 2 slots"} {
+		if !strings.Contains(emails[0], want) {
+			t.Errorf("alert missing %q:\n%s", want, emails[0])
+		}
+	}
+
+	state, err := loadBookingWindowState(config.BookingWindowFile)
+	if err != nil || state.MaxDates[""] != "2099-08-31" {
+		t.Errorf("stored state = %+v, %v; want the extended max_date", state, err)
+	}
+}
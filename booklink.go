@@ -0,0 +1,42 @@
+package melanzana
+
+import (
+	"net/url"
+	"strings"
+)
+
+// slotBookingLink returns the link for booking appt: slotBookingURL with
+// its placeholders filled in, or bookingURL when no slot link is configured.
+//
+// Placeholders are {date} (YYYY-MM-DD), {month} (YYYY-MM), {start} (the
+// 24-hour start time, e.g. 14:30), {calendarId} and {variantId}. Each is
+// query-escaped. A slot whose time can't be parsed gets an empty {start}.
+func slotBookingLink(appt Appointment) string {
+	if slotBookingURL == "" {
+		return bookingURL
+	}
+	return strings.NewReplacer(slotPlaceholders(appt, url.QueryEscape)...).Replace(slotBookingURL)
+}
+
+// slotPlaceholders returns the placeholders of slotBookingLink with their
+// values for appt, passed through escape, as old, new pairs for
+// strings.NewReplacer. It also fills {end}, the 24-hour end time.
+func slotPlaceholders(appt Appointment, escape func(string) string) []string {
+	var start, end string
+	if s, e, err := parseSlotTimes(appt); err == nil {
+		start, end = s.Format("15:04"), e.Format("15:04")
+	}
+	var month string
+	if len(appt.Date) >= len("2006-01") {
+		month = appt.Date[:len("2006-01")]
+	}
+	cal, _ := calendarNamed(appt.Calendar)
+	return []string{
+		"{date}", escape(appt.Date),
+		"{month}", escape(month),
+		"{start}", escape(start),
+		"{end}", escape(end),
+		"{calendarId}", escape(cal.CalendarID),
+		"{variantId}", escape(cal.VariantID),
+	}
+}
@@ -0,0 +1,48 @@
+package melanzana
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSlotBookingLink(t *testing.T) {
+	defer func(tz, booking, slot string, cals []Calendar) {
+		sourceTimezone, bookingURL, slotBookingURL, calendars = tz, booking, slot, cals
+	}(sourceTimezone, bookingURL, slotBookingURL, calendars)
+	sourceTimezone = "America/Denver"
+	bookingURL = "https://example.com/book"
+	calendars = []Calendar{{Name: "Fitting", CalendarID: "cal1", VariantID: "v 2"}}
+
+	appt := Appointment{Date: "2024-05-20", Time: "2:30 pm – 3:00 pm", Calendar: "Fitting"}
+	tests := []struct {
+		name     string
+		template string
+		appt     Appointment
+		want     string
+	}{
+		{"Unset", "", appt, "https://example.com/book"},
+		{"AllPlaceholders", "https://example.com/book?date={date}&month={month}&time={start}&cal={calendarId}&variant={variantId}", appt,
+			"https://example.com/book?date=2024-05-20&month=2024-05&time=14%3A30&cal=cal1&variant=v+2"},
+		{"UnparseableTime", "https://example.com/book?date={date}&time={start}", Appointment{Date: "2024-05-20", Time: "all day"},
+			"https://example.com/book?date=2024-05-20&time="},
+		{"UnknownCalendar", "https://example.com/book?cal={calendarId}", Appointment{Date: "2024-05-20", Calendar: "Other"},
+			"https://example.com/book?cal="},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slotBookingURL = tt.template
+			if got := slotBookingLink(tt.appt); got != tt.want {
+				t.Errorf("slotBookingLink() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	slotBookingURL = ""
+	if body := buildEmailBody([]Appointment{appt}, RenderOptions{}); strings.Contains(body, "  Book: ") {
+		t.Errorf("buildEmailBody() without slotBookingUrl links each slot:\n%s", body)
+	}
+	slotBookingURL = "https://example.com/book?date={date}"
+	if body := buildEmailBody([]Appointment{appt}, RenderOptions{}); !strings.Contains(body, "  Book: https://example.com/book?date=2024-05-20\n") {
+		t.Errorf("buildEmailBody() is missing the slot's booking link:\n%s", body)
+	}
+}
@@ -0,0 +1,116 @@
+package melanzana
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// BurstState is persisted between cycles to detect notification bursts.
+type BurstState struct {
+	Events       []time.Time   `json:"events"`                 // cycles in the window that had new appointments
+	Active       bool          `json:"active"`                 // whether a burst is in progress
+	StartedAt    time.Time     `json:"startedAt,omitempty"`    // when the current burst began
+	LastDigestAt time.Time     `json:"lastDigestAt,omitempty"` // when the last rolling digest was sent
+	Pending      []Appointment `json:"pending"`                // appointments not yet included in a digest
+	BurstTotal   int           `json:"burstTotal"`             // appointments seen during the current burst
+}
+
+// loadBurstState reads burst state from path, returning empty state if the file doesn't exist.
+func loadBurstState(path string) (*BurstState, error) {
+	state := &BurstState{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("failed to read burst state %s: %w", path, err)
+	}
+	if len(data) == 0 {
+		return state, nil
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse burst state %s: %w", path, err)
+	}
+	return state, nil
+}
+
+// saveBurstState writes burst state to path.
+func saveBurstState(state *BurstState, path string) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal burst state: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write burst state %s: %w", path, err)
+	}
+	return nil
+}
+
+// plan decides which notifications to send this cycle. A burst starts once
+// more than threshold cycles with new appointments fall within window. While
+// a burst is active, new appointments are held and delivered as a rolling
+// digest at most once per window. When a full window passes without new
+// appointments the burst ends with a final summary.
+func (s *BurstState) plan(now time.Time, newAppointments []Appointment, threshold int, window time.Duration) []Notification {
+	cutoff := now.Add(-window)
+	var recent []time.Time
+	for _, t := range s.Events {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+	if len(newAppointments) > 0 {
+		recent = append(recent, now)
+	}
+	s.Events = recent
+
+	if !s.Active {
+		if len(s.Events) <= threshold {
+			if len(newAppointments) == 0 {
+				return nil
+			}
+			return []Notification{newAppointmentsNotification(newAppointments)}
+		}
+
+		slog.Info("Burst detected, switching to digest mode", "notifications", len(s.Events), "window", window)
+		s.Active = true
+		s.StartedAt = now
+		s.LastDigestAt = time.Time{}
+		s.BurstTotal = 0
+	}
+
+	s.Pending = append(s.Pending, newAppointments...)
+	s.BurstTotal += len(newAppointments)
+
+	if len(s.Events) == 0 {
+		slog.Info("Burst subsided", "duration", now.Sub(s.StartedAt).Round(time.Minute))
+		summary := Notification{
+			Subject: "Melanzana appointment burst summary",
+			Intro: fmt.Sprintf("The burst of new appointments has subsided. %d new slots were found between %s and %s.",
+				s.BurstTotal, s.StartedAt.Format("2006-01-02 15:04"), now.Format("2006-01-02 15:04")),
+			Appointments: s.Pending,
+			Digest:       true,
+		}
+		*s = BurstState{}
+		return []Notification{summary}
+	}
+
+	if len(s.Pending) > 0 && now.Sub(s.LastDigestAt) >= window {
+		digest := Notification{
+			Subject: fmt.Sprintf("Melanzana appointment digest (%d new slots)", len(s.Pending)),
+			Intro: "Many appointments are opening at once, so notifications are being collapsed into a rolling digest. " +
+				"A summary will follow when things quiet down.",
+			Appointments: s.Pending,
+			Digest:       true,
+		}
+		s.Pending = nil
+		s.LastDigestAt = now
+		return []Notification{digest}
+	}
+
+	slog.Info("Burst in progress: holding appointments for the next digest", "count", len(s.Pending))
+	return nil
+}
@@ -0,0 +1,78 @@
+package melanzana
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBurstStatePlan(t *testing.T) {
+	base := time.Date(2024, 5, 15, 9, 0, 0, 0, time.UTC)
+	window := time.Hour
+	slot := func(day int) []Appointment {
+		return []Appointment{{Date: time.Date(2024, 6, day, 0, 0, 0, 0, time.UTC).Format("2006-01-02"), Time: "10:00 am – 10:30 am", Spaces: 1, IsAvailable: true}}
+	}
+
+	state := &BurstState{}
+
+	// Below the threshold, every cycle with new appointments notifies normally.
+	for i := 0; i < 2; i++ {
+		got := state.plan(base.Add(time.Duration(i)*10*time.Minute), slot(i+1), 2, window)
+		if len(got) != 1 || got[0].Intro != "" {
+			t.Fatalf("cycle %d: plan() = %+v, want one normal notification", i, got)
+		}
+	}
+
+	// The third cycle within the window starts a burst and sends the first digest.
+	got := state.plan(base.Add(20*time.Minute), slot(3), 2, window)
+	if !state.Active {
+		t.Fatalf("plan() did not activate burst mode")
+	}
+	if len(got) != 1 || len(got[0].Appointments) != 1 || got[0].Intro == "" {
+		t.Fatalf("burst start: plan() = %+v, want one digest", got)
+	}
+
+	// Further slots inside the digest interval are held.
+	got = state.plan(base.Add(30*time.Minute), slot(4), 2, window)
+	if len(got) != 0 || len(state.Pending) != 1 {
+		t.Fatalf("during burst: plan() = %+v, pending = %d; want nothing sent and 1 pending", got, len(state.Pending))
+	}
+
+	// A quiet cycle within the window keeps holding.
+	got = state.plan(base.Add(45*time.Minute), nil, 2, window)
+	if len(got) != 0 {
+		t.Fatalf("quiet cycle: plan() = %+v, want nothing sent", got)
+	}
+
+	// Once a full window passes without new slots, the summary includes held slots.
+	got = state.plan(base.Add(2*time.Hour), nil, 2, window)
+	if len(got) != 1 || len(got[0].Appointments) != 1 {
+		t.Fatalf("burst end: plan() = %+v, want summary with 1 held appointment", got)
+	}
+	if state.Active || state.BurstTotal != 0 {
+		t.Errorf("burst state not reset after summary: %+v", state)
+	}
+}
+
+func TestLoadAndSaveBurstState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "burst.json")
+
+	state, err := loadBurstState(path)
+	if err != nil || state.Active {
+		t.Fatalf("loadBurstState() on missing file = %+v, %v; want empty state", state, err)
+	}
+
+	state.Active = true
+	state.BurstTotal = 7
+	if err := saveBurstState(state, path); err != nil {
+		t.Fatalf("saveBurstState() error = %v", err)
+	}
+
+	loaded, err := loadBurstState(path)
+	if err != nil {
+		t.Fatalf("loadBurstState() error = %v", err)
+	}
+	if !loaded.Active || loaded.BurstTotal != 7 {
+		t.Errorf("loadBurstState() = %+v, want active burst with total 7", loaded)
+	}
+}
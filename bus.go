@@ -0,0 +1,243 @@
+package melanzana
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// changeEvent is the changes one watch found in a cycle, as published on
+// the event bus, with what sinks need to react to them.
+type changeEvent struct {
+	At      time.Time
+	Watch   string        // Campaign name, prefixing notification subjects; "" otherwise
+	Config  AppConfig     // The watch's configuration
+	Store   Store         // The watch's state store; nil for changes not kept in the history
+	Scraped []Appointment // Every slot the cycle found
+	Seen    []Appointment // Slots the watch had notified before the cycle
+	Opts    RenderOptions
+	Changes []Change
+	// The changes the watch's recipients are to be told about, found by
+	// notificationChanges. Only set with Outcome.
+	Pending []Change
+	// Set by a watch to have the notify sink plan and send its
+	// notifications, which it does every cycle, as a burst digest may fall
+	// due without changes; filled in with what was sent.
+	Outcome *notifyOutcome
+}
+
+// notifyOutcome is what the notify sink sent for a watch.
+type notifyOutcome struct {
+	notifications int           // Notifications planned
+	notified      []Appointment // Slots in them
+	undelivered   []Appointment // Slots no recipient who wanted them was sent
+}
+
+// deliver sends a notification about the changes to the watch's recipients.
+func (ev changeEvent) deliver(n Notification) (sent, failed int, undelivered []Appointment) {
+	if ev.Watch != "" {
+		n.Subject = "[" + ev.Watch + "] " + n.Subject
+	}
+	return deliverNotification(ev.Config, n, ev.Opts)
+}
+
+// changeSink reacts to the changes published on an event bus.
+type changeSink interface {
+	handle(ev changeEvent) error
+}
+
+// changeSinkFunc adapts a function to changeSink.
+type changeSinkFunc func(ev changeEvent) error
+
+func (f changeSinkFunc) handle(ev changeEvent) error { return f(ev) }
+
+// eventBus hands the changes found by the diff engine to every subscribed
+// sink, so a new reaction to availability changes is a new sink rather than
+// another step in runWatch. Sinks run one after another, in the order they
+// subscribed; one failing doesn't stop the rest.
+type eventBus struct {
+	mu    sync.Mutex
+	sinks []subscription
+}
+
+type subscription struct {
+	name string // For logs
+	sink changeSink
+}
+
+// changeBus is the process-wide bus, with the built-in sinks subscribed.
+var changeBus = newChangeBus()
+
+func newChangeBus() *eventBus {
+	b := &eventBus{}
+	b.subscribe("autoBook", changeSinkFunc(autoBook))
+	b.subscribe("notify", changeSinkFunc(notifyChanges))
+	b.subscribe("history", changeSinkFunc(writeHistory))
+	b.subscribe("metrics", changeSinkFunc(countChanges))
+	b.subscribe("gone", changeSinkFunc(notifyGone))
+	b.subscribe("bookingWindow", changeSinkFunc(notifyBookingWindow))
+	b.subscribe("webhook", changeSinkFunc(forwardChanges))
+	return b
+}
+
+// subscribe adds a sink to the bus.
+func (b *eventBus) subscribe(name string, sink changeSink) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sinks = append(b.sinks, subscription{name, sink})
+}
+
+// publish hands ev to every sink, logging those that fail. Events without
+// changes or notifications to plan aren't published.
+func (b *eventBus) publish(ev changeEvent) {
+	if len(ev.Changes) == 0 && ev.Outcome == nil {
+		return
+	}
+	b.mu.Lock()
+	sinks := slices.Clone(b.sinks)
+	b.mu.Unlock()
+	for _, s := range sinks {
+		if err := s.sink.handle(ev); err != nil {
+			slog.Error("Error handling availability changes", "sink", s.name, "err", err)
+		}
+	}
+}
+
+// notifyChanges plans the watch's notifications about the pending changes,
+// sends them, and records what was sent in the outcome.
+func notifyChanges(ev changeEvent) error {
+	if ev.Outcome == nil {
+		return nil
+	}
+	notifications := planNotifications(ev.Config, ev.Pending)
+	for _, n := range notifications {
+		if n.Digest {
+			n.Trends = dayTrends(appointmentDates(n.Appointments), ev.Scraped, ev.Changes)
+		}
+		sent, failed, missed := ev.deliver(n)
+		if sent+failed > 0 {
+			recordSLOSamples(ev.Config, n.Appointments, clock.Now(), sent > 0)
+		}
+		ev.Outcome.notified = append(ev.Outcome.notified, n.Appointments...)
+		ev.Outcome.undelivered = append(ev.Outcome.undelivered, missed...)
+	}
+	ev.Outcome.notifications = len(notifications)
+	return nil
+}
+
+// writeHistory appends the changes to the watch's availability history.
+func writeHistory(ev changeEvent) error {
+	if ev.Store == nil {
+		return nil
+	}
+	events := historyEvents(ev.Changes, ev.At)
+	if len(events) == 0 {
+		return nil
+	}
+	if ev.Config.ReadOnly {
+		slog.Info("Read-only mode: not recording availability changes", "count", len(events))
+		return nil
+	}
+	if err := ev.Store.AppendHistory(events); err != nil {
+		return fmt.Errorf("failed to record availability changes: %w", err)
+	}
+	slog.Debug("Recorded availability changes", "count", len(events))
+	return nil
+}
+
+// countChanges adds the changes to the session statistics.
+func countChanges(ev changeEvent) error {
+	session.recordChanges(ev.Changes)
+	return nil
+}
+
+// notifyGone tells recipients, with notifyWhenGone, about notified slots
+// that were fully booked or withdrawn.
+func notifyGone(ev changeEvent) error {
+	if !ev.Config.NotifyWhenGone {
+		return nil
+	}
+	if gone := goneAppointments(ev.Seen, ev.Changes); len(gone) > 0 {
+		slog.Info("Notified slots are no longer available", "count", len(gone))
+		ev.deliver(goneNotification(gone))
+	}
+	return nil
+}
+
+// notifyBookingWindow alerts recipients, with notifyBookingWindow, that a
+// booking window was extended.
+func notifyBookingWindow(ev changeEvent) error {
+	if !ev.Config.NotifyBookingWindow || !slices.ContainsFunc(ev.Changes, func(c Change) bool { return c.Kind == WindowExtended }) {
+		return nil
+	}
+	ev.deliver(bookingWindowNotification(ev.Changes, ev.Scraped))
+	return nil
+}
+
+// changeWebhookPayload is the JSON body POSTed to changeWebhookUrl.
+type changeWebhookPayload struct {
+	At      time.Time           `json:"at"`
+	Watch   string              `json:"watch,omitempty"`
+	Changes []changeWebhookItem `json:"changes"`
+}
+
+type changeWebhookItem struct {
+	Kind           ChangeKind           `json:"kind"`
+	Date           string               `json:"date,omitempty"`
+	Time           string               `json:"time,omitempty"`
+	Calendar       string               `json:"calendar,omitempty"`
+	Spaces         int                  `json:"spaces"`
+	PreviousSpaces int                  `json:"previousSpaces"`
+	Reopened       bool                 `json:"reopened,omitempty"`
+	Expired        bool                 `json:"expired,omitempty"`
+	Window         *changeWebhookWindow `json:"bookingWindow,omitempty"`
+}
+
+type changeWebhookWindow struct {
+	Calendar string `json:"calendar,omitempty"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+}
+
+func changeWebhookBody(ev changeEvent) []byte {
+	payload := changeWebhookPayload{At: ev.At, Watch: ev.Watch, Changes: []changeWebhookItem{}}
+	for _, c := range ev.Changes {
+		item := changeWebhookItem{
+			Kind:           c.Kind,
+			Date:           c.Slot.Date,
+			Time:           c.Slot.Time,
+			Calendar:       c.Slot.Calendar,
+			Spaces:         c.Slot.Spaces,
+			PreviousSpaces: c.PreviousSpaces,
+			Reopened:       c.Reopened,
+			Expired:        c.Expired,
+		}
+		if c.Window != nil {
+			item.Window = &changeWebhookWindow{Calendar: c.Window.Calendar, From: c.Window.From, To: c.Window.To}
+		}
+		payload.Changes = append(payload.Changes, item)
+	}
+	body, _ := json.MarshalIndent(payload, "", "  ")
+	return body
+}
+
+// forwardChanges POSTs the changes to changeWebhookUrl, if set.
+func forwardChanges(ev changeEvent) error {
+	webhook := ev.Config.ChangeWebhookURL
+	if webhook == "" || len(ev.Changes) == 0 {
+		return nil
+	}
+	body := changeWebhookBody(ev)
+	switch {
+	case ev.Config.DryRun:
+		fmt.Printf("===== Change webhook POST to %s (dry run, not sent) =====\n%s\n", webhook, body)
+		return nil
+	case ev.Config.ReadOnly:
+		slog.Info("Read-only mode: not forwarding availability changes", "webhook", webhook, "count", len(ev.Changes))
+		return nil
+	}
+	return sendWebhookNotification(ev.Config, webhook, body)
+}
@@ -0,0 +1,116 @@
+package melanzana
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pashbylogan/melanzana/pkg/store"
+)
+
+func TestEventBusPublish(t *testing.T) {
+	var calls []string
+	b := &eventBus{}
+	b.subscribe("failing", changeSinkFunc(func(ev changeEvent) error {
+		calls = append(calls, "failing")
+		return errors.New("broken")
+	}))
+	b.subscribe("counting", changeSinkFunc(func(ev changeEvent) error {
+		calls = append(calls, "counting")
+		return nil
+	}))
+
+	b.publish(changeEvent{})
+	if len(calls) != 0 {
+		t.Errorf("publish() without changes called %v, want no sinks", calls)
+	}
+	b.publish(changeEvent{Changes: []Change{{Kind: SlotAdded}}})
+	if want := []string{"failing", "counting"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("publish() called %v, want %v", calls, want)
+	}
+
+	// A watch's event is published without changes, for its notifications.
+	calls = nil
+	b.publish(changeEvent{Outcome: &notifyOutcome{}})
+	if want := []string{"failing", "counting"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("publish() of a watch's event called %v, want %v", calls, want)
+	}
+}
+
+func TestChangeBusSinks(t *testing.T) {
+	at := time.Date(2099, 7, 1, 12, 0, 0, 0, time.UTC)
+	var posted, notified []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/subscriber" {
+			notified, _ = io.ReadAll(r.Body)
+			return
+		}
+		posted, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+	defer func(s *SessionStats) { session = s }(session)
+	session = newSessionStats(at)
+
+	dir := t.TempDir()
+	store := &store.JSONFile{Path: filepath.Join(dir, "seen.json"), HistoryPath: filepath.Join(dir, "history.jsonl")}
+	config := AppConfig{
+		ChangeWebhookURL: server.URL,
+		Subscribers:      []Recipient{{Name: "me", Webhook: server.URL + "/subscriber"}},
+		Retry:            RetryConfig{RetryPolicy: RetryPolicy{MaxAttempts: 1}},
+	}
+	slot := Appointment{Date: "2099-07-02", Time: "10:00 am – 10:30 am", Spaces: 2, IsAvailable: true}
+	ev := changeEvent{
+		At:     at,
+		Watch:  "trip",
+		Config: config,
+		Store:  store,
+		Changes: []Change{
+			{Kind: SlotAdded, Slot: slot},
+			{Kind: WindowExtended, Window: &bookingWindowChange{From: "2099-07-31", To: "2099-08-31"}},
+		},
+		Pending: []Change{{Kind: SlotAdded, Slot: slot}},
+		Outcome: &notifyOutcome{},
+	}
+	newChangeBus().publish(ev)
+
+	var hook webhookPayload
+	if err := json.Unmarshal(notified, &hook); err != nil || hook.Subject != "[trip] New Melanzana Appointments Available!" || len(hook.Appointments) != 1 {
+		t.Errorf("subscriber notified with %q, %v; want the new slot", notified, err)
+	}
+	if ev.Outcome.notifications != 1 || len(ev.Outcome.notified) != 1 || len(ev.Outcome.undelivered) != 0 {
+		t.Errorf("outcome = %+v, want the slot notified", ev.Outcome)
+	}
+
+	history, err := store.History()
+	if err != nil || len(history) != 1 || history[0].Kind != eventAppeared || !history[0].At.Equal(at) {
+		t.Errorf("history after publish() = %+v, %v; want the slot appearing", history, err)
+	}
+	if want := (changeCounts{SlotsAdded: 1, WindowsExtended: 1}); session.Changes != want {
+		t.Errorf("session changes = %+v, want %+v", session.Changes, want)
+	}
+
+	var payload changeWebhookPayload
+	if err := json.Unmarshal(posted, &payload); err != nil {
+		t.Fatalf("webhook body %q: %v", posted, err)
+	}
+	if payload.Watch != "trip" || len(payload.Changes) != 2 || payload.Changes[0].Kind != SlotAdded || payload.Changes[0].Spaces != 2 ||
+		payload.Changes[1].Window == nil || payload.Changes[1].Window.To != "2099-08-31" {
+		t.Errorf("webhook payload = %+v, want both changes", payload)
+	}
+
+	// Read-only mode neither records nor forwards.
+	posted = nil
+	ev.Config.ReadOnly = true
+	ev.Changes = []Change{{Kind: SlotRemoved, Slot: Appointment{Date: slot.Date, Time: slot.Time}, PreviousSpaces: 2}}
+	ev.Pending, ev.Outcome = nil, nil
+	newChangeBus().publish(ev)
+	if history, _ := store.History(); len(history) != 1 || posted != nil {
+		t.Errorf("read-only publish() recorded %d events and posted %q, want neither", len(history)-1, posted)
+	}
+}
@@ -0,0 +1,66 @@
+package melanzana
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Calendar is one Cowlendar calendar, or one variant of a calendar, watched
+// alongside others, e.g. fittings of different lengths or at different
+// locations.
+type Calendar struct {
+	Name       string `json:"name"`       // Shown with each slot in notifications and used in calendars filters
+	CalendarID string `json:"calendarId"` // Cowlendar calendar ID; empty uses the top-level calendarId
+	VariantID  string `json:"variantId"`  // Cowlendar product variant ID; empty omits it from requests
+}
+
+// validateCalendars checks that calendar names are present and unique.
+func validateCalendars(calendars []Calendar) error {
+	names := make(map[string]bool)
+	for _, c := range calendars {
+		if c.Name == "" {
+			return fmt.Errorf("every calendar needs a name")
+		}
+		if names[c.Name] {
+			return fmt.Errorf("duplicate calendar name %q", c.Name)
+		}
+		names[c.Name] = true
+	}
+	return nil
+}
+
+// watchedCalendars returns the calendars to scrape each cycle: those
+// configured, or the top-level calendar, unnamed, if there are none.
+func watchedCalendars(config AppConfig) []Calendar {
+	if len(config.Calendars) == 0 {
+		return []Calendar{{CalendarID: config.CalendarID, VariantID: config.VariantID}}
+	}
+	watched := make([]Calendar, len(config.Calendars))
+	for i, c := range config.Calendars {
+		if c.CalendarID == "" {
+			c.CalendarID = config.CalendarID
+		}
+		watched[i] = c
+	}
+	return watched
+}
+
+// calendarNamed returns the watched calendar a slot was tagged with.
+func calendarNamed(name string) (Calendar, bool) {
+	i := slices.IndexFunc(calendars, func(c Calendar) bool { return c.Name == name })
+	if i < 0 {
+		return Calendar{}, false
+	}
+	return calendars[i], true
+}
+
+// unknownCalendars returns the names in filter that aren't configured calendars.
+func unknownCalendars(config AppConfig, filter []string) []string {
+	var unknown []string
+	for _, name := range filter {
+		if !slices.ContainsFunc(config.Calendars, func(c Calendar) bool { return c.Name == name }) {
+			unknown = append(unknown, name)
+		}
+	}
+	return unknown
+}
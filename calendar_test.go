@@ -0,0 +1,51 @@
+package melanzana
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWatchedCalendars(t *testing.T) {
+	config := AppConfig{CalendarID: "cal", VariantID: "v1"}
+	if got, want := watchedCalendars(config), []Calendar{{CalendarID: "cal", VariantID: "v1"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("watchedCalendars() without calendars = %+v, want the top-level calendar %+v", got, want)
+	}
+
+	config.Calendars = []Calendar{{Name: "30 min", VariantID: "v1"}, {Name: "Denver", CalendarID: "other"}}
+	want := []Calendar{{Name: "30 min", CalendarID: "cal", VariantID: "v1"}, {Name: "Denver", CalendarID: "other"}}
+	if got := watchedCalendars(config); !reflect.DeepEqual(got, want) {
+		t.Errorf("watchedCalendars() = %+v, want %+v", got, want)
+	}
+
+	for name, calendars := range map[string][]Calendar{
+		"Unnamed":   {{CalendarID: "cal"}},
+		"Duplicate": {{Name: "a"}, {Name: "a"}},
+	} {
+		if err := validateCalendars(calendars); err == nil {
+			t.Errorf("validateCalendars(%s) error = nil, want error", name)
+		}
+	}
+}
+
+func TestCalendarsTrackedSeparately(t *testing.T) {
+	seen := []Appointment{{Date: "2024-06-15", Time: "10:00 am – 10:30 am", Calendar: "30 min"}}
+	scraped := []Appointment{
+		{Date: "2024-06-15", Time: "10:00 am – 10:30 am", Calendar: "30 min"},
+		{Date: "2024-06-15", Time: "10:00 am – 10:30 am", Calendar: "60 min"},
+	}
+	if got := filterNewAppointments(scraped, seen); len(got) != 1 || got[0].Calendar != "60 min" {
+		t.Errorf("filterNewAppointments() = %+v, want only the 60 min slot", got)
+	}
+	if appointmentKey(scraped[0]) == appointmentKey(scraped[1]) {
+		t.Errorf("appointmentKey() is the same for slots in different calendars")
+	}
+	if got := appointmentKey(Appointment{Date: "2024-06-15", Time: "10:00 am – 10:30 am"}); got != "2024-06-15|10:00 am – 10:30 am" {
+		t.Errorf("appointmentKey() for an untagged slot = %q, want the original key", got)
+	}
+
+	body := buildEmailBody(scraped[1:], RenderOptions{})
+	if want := "- 2024-06-15 at 10:00 am – 10:30 am, 60 min (0 spaces available)"; !strings.Contains(body, want) {
+		t.Errorf("buildEmailBody() = %q, want a line %q", body, want)
+	}
+}
@@ -0,0 +1,313 @@
+package melanzana
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pashbylogan/melanzana/pkg/filter"
+)
+
+// Campaign statuses. Only active campaigns notify; the others are archived.
+const (
+	campaignActive  = "active"
+	campaignBooked  = "booked"
+	campaignExpired = "expired"
+)
+
+// Campaign is a time-boxed watch with its own filters and recipients, e.g.
+// "July slots for the family, until August 1st".
+type Campaign struct {
+	Name      string   `json:"name"`      // Identifies the campaign in subjects, logs and the campaign state file
+	From      string   `json:"from"`      // First slot date to watch, YYYY-MM-DD; empty means no lower bound
+	To        string   `json:"to"`        // Last slot date to watch, YYYY-MM-DD; empty means no upper bound
+	Weekdays  []string `json:"weekdays"`  // e.g. ["Sat", "Sun"]; empty means every day
+	MinSpaces int      `json:"minSpaces"` // Only slots with at least this many spaces
+	Calendars []string `json:"calendars"` // Names from calendars to watch; empty means every calendar
+	ToEmails  []string `json:"toEmails"`  // Recipients for this campaign; empty uses toEmails and recipientsFile
+	ExpiresAt string   `json:"expiresAt"` // Date the campaign stops, YYYY-MM-DD; defaults to the day after "to"
+}
+
+// namespaceNamePattern restricts campaign and profile names to those usable
+// as a path segment, since each one's state is stored under its name.
+var namespaceNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// validate checks the campaign's name and dates.
+func (c Campaign) validate() error {
+	if !namespaceNamePattern.MatchString(c.Name) {
+		return fmt.Errorf("campaign name %q must be letters, digits, '-' or '_'", c.Name)
+	}
+	for field, value := range map[string]string{"from": c.From, "to": c.To, "expiresAt": c.ExpiresAt} {
+		if value == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			return fmt.Errorf("campaign %q has invalid %s %q, want YYYY-MM-DD", c.Name, field, value)
+		}
+	}
+	if _, err := filter.Compile(c.Weekdays, c.MinSpaces, c.Calendars); err != nil {
+		return fmt.Errorf("campaign %q: %w", c.Name, err)
+	}
+	return nil
+}
+
+// validateCampaigns checks each campaign and that names are unique.
+func validateCampaigns(campaigns []Campaign) error {
+	names := make(map[string]bool)
+	for _, c := range campaigns {
+		if err := c.validate(); err != nil {
+			return err
+		}
+		if names[c.Name] {
+			return fmt.Errorf("duplicate campaign name %q", c.Name)
+		}
+		names[c.Name] = true
+	}
+	return nil
+}
+
+// expiry returns the date (YYYY-MM-DD) on which the campaign stops, or "" if
+// it runs until it is marked booked.
+func (c Campaign) expiry() string {
+	if c.ExpiresAt != "" {
+		return c.ExpiresAt
+	}
+	if c.To == "" {
+		return ""
+	}
+	to, err := time.Parse("2006-01-02", c.To)
+	if err != nil {
+		return ""
+	}
+	return to.AddDate(0, 0, 1).Format("2006-01-02")
+}
+
+// expired reports whether the campaign's expiry date has been reached at now.
+func (c Campaign) expired(now time.Time) bool {
+	expiry := c.expiry()
+	return expiry != "" && now.In(sourceLocation()).Format("2006-01-02") >= expiry
+}
+
+// matches reports whether appt falls within the campaign's filters.
+func (c Campaign) matches(appt Appointment) bool {
+	if c.From != "" && appt.Date < c.From {
+		return false
+	}
+	if c.To != "" && appt.Date > c.To {
+		return false
+	}
+	return Recipient{Weekdays: c.Weekdays, MinSpaces: c.MinSpaces, Calendars: c.Calendars}.matches(appt)
+}
+
+// configFor returns config with the recipients replaced by the campaign's own,
+// if it has any.
+func (c Campaign) configFor(config AppConfig) AppConfig {
+	if len(c.ToEmails) > 0 {
+		config.ToEmails = c.ToEmails
+		config.RecipientsFile = ""
+		config.Subscribers, config.SubscriberAPIToken, config.IMAPServer = nil, "", ""
+	}
+	return config
+}
+
+// namespacedConfig returns config with every per-watch state location moved
+// into the named namespace of kind, e.g. seen_appointments.json becomes
+// campaigns/july/seen_appointments.json. Object store keys get the same prefix.
+func namespacedConfig(config AppConfig, kind, name string) AppConfig {
+	config.DataFile = namespacedPath(config.DataFile, kind, name)
+	config.HistoryFile = namespacedPath(config.HistoryFile, kind, name)
+	config.SnapshotFile = namespacedPath(config.SnapshotFile, kind, name)
+	config.StoreSpoolFile = namespacedPath(config.StoreSpoolFile, kind, name)
+	config.BurstStateFile = namespacedPath(config.BurstStateFile, kind, name)
+	config.NotifyJournalFile = namespacedPath(config.NotifyJournalFile, kind, name)
+	return config
+}
+
+// createNamespaceDirs creates the local directories for config's namespaced
+// state files. Object store keys need no directories.
+func createNamespaceDirs(config AppConfig) error {
+	paths := []string{config.SnapshotFile, config.StoreSpoolFile, config.BurstStateFile, config.NotifyJournalFile}
+	if config.StateStore == "" || config.StateStore == "file" {
+		paths = append(paths, config.DataFile, config.HistoryFile)
+	}
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return fmt.Errorf("failed to create state directory for %s: %w", p, err)
+		}
+	}
+	return nil
+}
+
+func namespacedPath(p, kind, name string) string {
+	if p == "" {
+		return ""
+	}
+	p = filepath.ToSlash(p)
+	return path.Join(path.Dir(p), kind, name, path.Base(p))
+}
+
+// CampaignState tracks each campaign between runs, keyed by name.
+type CampaignState struct {
+	Campaigns map[string]*CampaignStatus `json:"campaigns"`
+}
+
+// CampaignStatus is the persisted state of a single campaign.
+type CampaignStatus struct {
+	Status         string    `json:"status"`
+	Notified       int       `json:"notified"` // Notifications sent to the campaign's recipients
+	LastNotifiedAt time.Time `json:"lastNotifiedAt,omitempty"`
+	ArchivedAt     time.Time `json:"archivedAt,omitempty"` // When the campaign was booked or expired
+}
+
+// loadCampaignState reads campaign state from path, returning empty state if the file doesn't exist.
+func loadCampaignState(path string) (*CampaignState, error) {
+	state := &CampaignState{Campaigns: make(map[string]*CampaignStatus)}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("failed to read campaign state %s: %w", path, err)
+	}
+	if len(data) == 0 {
+		return state, nil
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse campaign state %s: %w", path, err)
+	}
+	if state.Campaigns == nil {
+		state.Campaigns = make(map[string]*CampaignStatus)
+	}
+	return state, nil
+}
+
+// saveCampaignState writes campaign state to path.
+func saveCampaignState(state *CampaignState, path string) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal campaign state: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write campaign state %s: %w", path, err)
+	}
+	return nil
+}
+
+// status returns the state of the named campaign, creating it as active.
+func (s *CampaignState) status(name string) *CampaignStatus {
+	st, ok := s.Campaigns[name]
+	if !ok {
+		st = &CampaignStatus{Status: campaignActive}
+		s.Campaigns[name] = st
+	}
+	return st
+}
+
+// archive ends the named campaign with the given status. Archived campaigns
+// stay in the state file so they don't restart while still configured.
+func (s *CampaignState) archive(name, status string, now time.Time) {
+	st := s.status(name)
+	st.Status = status
+	st.ArchivedAt = now
+}
+
+// active returns the configured campaigns that may still notify at now,
+// archiving any that have expired since the last run.
+func (s *CampaignState) active(campaigns []Campaign, now time.Time) []Campaign {
+	var active []Campaign
+	for _, c := range campaigns {
+		st := s.status(c.Name)
+		if st.Status != campaignActive {
+			continue
+		}
+		if c.expired(now) {
+			s.archive(c.Name, campaignExpired, now)
+			slog.Info("Campaign expired and was archived", "campaign", c.Name, "expiry", c.expiry(), "notifications", st.Notified)
+			continue
+		}
+		active = append(active, c)
+	}
+	return active
+}
+
+// runCampaigns runs a watch for each active campaign over the slots matching
+// its filters. Each campaign keeps its seen state, history, spool and burst
+// state in its own namespace, so campaigns never affect each other.
+func runCampaigns(config AppConfig, scraped []Appointment, missed fetchGaps, opts RenderOptions, now time.Time) []Appointment {
+	state, err := loadCampaignState(config.CampaignStateFile)
+	if err != nil {
+		slog.Warn("Error loading campaign state, starting fresh", "err", err)
+		state = &CampaignState{Campaigns: make(map[string]*CampaignStatus)}
+	}
+
+	var newAppointments []Appointment
+	for _, c := range state.active(config.Campaigns, now) {
+		var relevant []Appointment
+		for _, appt := range scraped {
+			if c.matches(appt) {
+				relevant = append(relevant, appt)
+			}
+		}
+		slog.Info("Campaign slots match", "campaign", c.Name, "matched", len(relevant), "total", len(scraped))
+
+		watchConfig := c.configFor(namespacedConfig(config, "campaigns", c.Name))
+		if err := createNamespaceDirs(watchConfig); err != nil {
+			slog.Error("Error running campaign", "campaign", c.Name, "err", err)
+			continue
+		}
+		found, sent, err := runWatch(watchConfig, c.Name, relevant, missed, opts)
+		if err != nil {
+			slog.Error("Error running campaign", "campaign", c.Name, "err", err)
+			continue
+		}
+		newAppointments = append(newAppointments, found...)
+
+		if sent > 0 {
+			st := state.status(c.Name)
+			st.Notified += sent
+			st.LastNotifiedAt = now
+		}
+	}
+
+	if config.ReadOnly {
+		slog.Info("Read-only mode: not saving campaign state", "file", config.CampaignStateFile)
+	} else if err := saveCampaignState(state, config.CampaignStateFile); err != nil {
+		slog.Error("Error saving campaign state", "err", err)
+	}
+	return newAppointments
+}
+
+// writeCampaignReport prints a table of campaigns in state, sorted by name.
+func writeCampaignReport(w io.Writer, state *CampaignState) {
+	var names []string
+	for name := range state.Campaigns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CAMPAIGN\tSTATUS\tNOTIFIED\tLAST NOTIFIED\tARCHIVED")
+	for _, name := range names {
+		st := state.Campaigns[name]
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n", name, st.Status, st.Notified, formatOptionalTime(st.LastNotifiedAt), formatOptionalTime(st.ArchivedAt))
+	}
+	tw.Flush()
+}
+
+func formatOptionalTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format("2006-01-02 15:04")
+}
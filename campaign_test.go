@@ -0,0 +1,171 @@
+package melanzana
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCampaignFilter(t *testing.T) {
+	c := Campaign{Name: "july", From: "2024-07-01", To: "2024-07-31", Weekdays: []string{"Sat"}, MinSpaces: 2}
+
+	tests := []struct {
+		name string
+		appt Appointment
+		want bool
+	}{
+		{"InRange", Appointment{Date: "2024-07-06", Spaces: 2}, true},
+		{"BeforeRange", Appointment{Date: "2024-06-29", Spaces: 2}, false},
+		{"AfterRange", Appointment{Date: "2024-08-03", Spaces: 2}, false},
+		{"WrongWeekday", Appointment{Date: "2024-07-05", Spaces: 2}, false},
+		{"TooFewSpaces", Appointment{Date: "2024-07-06", Spaces: 1}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.matches(tt.appt); got != tt.want {
+				t.Errorf("matches(%+v) = %v, want %v", tt.appt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCampaignExpiry(t *testing.T) {
+	tests := []struct {
+		name     string
+		campaign Campaign
+		want     string
+	}{
+		{"Explicit", Campaign{To: "2024-07-31", ExpiresAt: "2024-07-15"}, "2024-07-15"},
+		{"DayAfterTo", Campaign{To: "2024-07-31"}, "2024-08-01"},
+		{"OpenEnded", Campaign{From: "2024-07-01"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.campaign.expiry(); got != tt.want {
+				t.Errorf("expiry() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	c := Campaign{To: "2024-07-31"}
+	if c.expired(time.Date(2024, 7, 31, 23, 0, 0, 0, sourceLocation())) {
+		t.Errorf("expired() on the last day = true, want false")
+	}
+	if !c.expired(time.Date(2024, 8, 1, 0, 0, 0, 0, sourceLocation())) {
+		t.Errorf("expired() on the expiry date = false, want true")
+	}
+	// Already August in UTC, but still the last day in the configured zone.
+	if c.expired(time.Date(2024, 8, 1, 3, 0, 0, 0, time.UTC)) {
+		t.Errorf("expired() before midnight in %s = true, want false", sourceTimezone)
+	}
+}
+
+func TestValidateCampaigns(t *testing.T) {
+	tests := []struct {
+		name      string
+		campaigns []Campaign
+		wantErr   bool
+	}{
+		{"Valid", []Campaign{{Name: "july", From: "2024-07-01", Weekdays: []string{"sat"}}}, false},
+		{"NoName", []Campaign{{From: "2024-07-01"}}, true},
+		{"BadDate", []Campaign{{Name: "july", To: "31/07/2024"}}, true},
+		{"BadWeekday", []Campaign{{Name: "july", Weekdays: []string{"xx"}}}, true},
+		{"Duplicate", []Campaign{{Name: "july"}, {Name: "july"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateCampaigns(tt.campaigns); (err != nil) != tt.wantErr {
+				t.Errorf("validateCampaigns() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNamespacedConfig(t *testing.T) {
+	config := namespacedConfig(AppConfig{
+		DataFile:       "seen_appointments.json",
+		HistoryFile:    "state/history.jsonl",
+		StoreSpoolFile: "/var/lib/melanzana/spool.json",
+	}, "campaigns", "july")
+
+	for got, want := range map[string]string{
+		config.DataFile:       "campaigns/july/seen_appointments.json",
+		config.HistoryFile:    "state/campaigns/july/history.jsonl",
+		config.StoreSpoolFile: "/var/lib/melanzana/campaigns/july/spool.json",
+		config.BurstStateFile: "",
+	} {
+		if got != want {
+			t.Errorf("namespaced path = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestRunCampaigns(t *testing.T) {
+	dir := t.TempDir()
+	config := AppConfig{
+		DryRun:            true, // print instead of sending, but still write state
+		FromEmail:         "from@example.com",
+		ToEmails:          []string{"me@example.com"},
+		DataFile:          filepath.Join(dir, "seen.json"),
+		HistoryFile:       filepath.Join(dir, "history.jsonl"),
+		StoreSpoolFile:    filepath.Join(dir, "spool.json"),
+		CampaignStateFile: filepath.Join(dir, "campaigns.json"),
+		Campaigns: []Campaign{
+			{Name: "july", From: "2099-07-01", To: "2099-07-31", ToEmails: []string{"family@example.com"}},
+			{Name: "june", To: "2099-06-30"},
+			{Name: "summer", From: "2099-07-01"},
+		},
+	}
+	scraped := []Appointment{
+		{Date: "2099-07-06", Time: "10:00 am – 10:30 am", Spaces: 1},
+		{Date: "2099-08-03", Time: "10:00 am – 10:30 am", Spaces: 1},
+	}
+	now := time.Date(2099, 7, 1, 12, 0, 0, 0, time.Local)
+
+	if found := runCampaigns(config, scraped, nil, RenderOptions{}, now); len(found) != 3 {
+		t.Fatalf("runCampaigns() found %d new appointments, want 3 (1 for july, 2 for summer)", len(found))
+	}
+
+	for name, want := range map[string]int{"july": 1, "summer": 2} {
+		seen, err := loadSeenAppointments(filepath.Join(dir, "campaigns", name, "seen.json"), nil)
+		if err != nil || len(seen) != want {
+			t.Errorf("%s seen state = %d appointments (err %v), want %d", name, len(seen), err, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "seen.json")); !os.IsNotExist(err) {
+		t.Errorf("shared seen file was written (err %v); campaigns should only use their namespaces", err)
+	}
+
+	state, err := loadCampaignState(config.CampaignStateFile)
+	if err != nil {
+		t.Fatalf("loadCampaignState() error = %v", err)
+	}
+	if st := state.Campaigns["june"]; st == nil || st.Status != campaignExpired || st.ArchivedAt.IsZero() {
+		t.Errorf("june state = %+v, want archived as expired", st)
+	}
+	if st := state.Campaigns["july"]; st == nil || st.Status != campaignActive || st.Notified != 1 {
+		t.Errorf("july state = %+v, want active with 1 notification", st)
+	}
+
+	// Deleting one campaign's state only makes that campaign see its slots as new again.
+	if err := os.RemoveAll(filepath.Join(dir, "campaigns", "summer")); err != nil {
+		t.Fatal(err)
+	}
+	if found := runCampaigns(config, scraped, nil, RenderOptions{}, now); len(found) != 2 {
+		t.Errorf("runCampaigns() after deleting summer state found %d, want summer's 2 only", len(found))
+	}
+
+	// Once booked, a campaign stops notifying even though it is still configured.
+	state, _ = loadCampaignState(config.CampaignStateFile)
+	state.archive("july", campaignBooked, now)
+	if err := saveCampaignState(state, config.CampaignStateFile); err != nil {
+		t.Fatalf("saveCampaignState() error = %v", err)
+	}
+	if err := os.RemoveAll(filepath.Join(dir, "campaigns")); err != nil {
+		t.Fatal(err)
+	}
+	if found := runCampaigns(config, scraped, nil, RenderOptions{}, now); len(found) != 2 {
+		t.Errorf("runCampaigns() after booking july found %d, want summer's 2 only", len(found))
+	}
+}
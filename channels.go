@@ -0,0 +1,229 @@
+package melanzana
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"regexp"
+
+	"github.com/pashbylogan/melanzana/pkg/notify"
+)
+
+// Channels a recipient can be notified through.
+const (
+	channelEmail    = "email"
+	channelSMS      = "sms"
+	channelWebhook  = "webhook"
+	channelTelegram = "telegram"
+)
+
+// phonePattern matches phone numbers in E.164 form.
+var phonePattern = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// channel is one address a recipient is notified at.
+type channel struct {
+	kind    string
+	address string
+}
+
+// String identifies the channel in the notification journal: email
+// addresses as they are, other addresses prefixed with their kind.
+func (c channel) String() string {
+	if c.kind == channelEmail {
+		return c.address
+	}
+	return c.kind + ":" + c.address
+}
+
+// channels returns the addresses r is notified at.
+func (r Recipient) channels() []channel {
+	var chs []channel
+	if r.Email != "" {
+		chs = append(chs, channel{channelEmail, r.Email})
+	}
+	if r.Phone != "" {
+		chs = append(chs, channel{channelSMS, r.Phone})
+	}
+	if r.Webhook != "" {
+		chs = append(chs, channel{channelWebhook, r.Webhook})
+	}
+	if r.Telegram != "" {
+		chs = append(chs, channel{channelTelegram, r.Telegram})
+	}
+	return chs
+}
+
+// validateSubscribers checks that each subscriber can be reached and that
+// their filters are valid.
+func validateSubscribers(subscribers []Recipient) error {
+	for _, s := range subscribers {
+		if len(s.channels()) == 0 {
+			return fmt.Errorf("subscriber %s has no email, phone, telegram or webhook", s.label())
+		}
+		if s.Phone != "" && !phonePattern.MatchString(s.Phone) {
+			return fmt.Errorf("subscriber %s: phone %q must be in international form, e.g. \"+15551234567\"", s.label(), s.Phone)
+		}
+		if s.Telegram != "" && !telegramChatPattern.MatchString(s.Telegram) {
+			return fmt.Errorf("subscriber %s: telegram must be a numeric chat ID, got %q", s.label(), s.Telegram)
+		}
+		if s.Webhook != "" {
+			if u, err := url.Parse(s.Webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("subscriber %s: webhook must be an http or https URL, got %q", s.label(), s.Webhook)
+			}
+		}
+		if err := s.compile(); err != nil {
+			return fmt.Errorf("subscriber %w", err)
+		}
+	}
+	return nil
+}
+
+// sendToRecipient sends a notification to each of r's channels, returning
+// how many took it and the errors from those that didn't.
+func sendToRecipient(config AppConfig, r Recipient, personal Notification, textBody, htmlBody string) (sent int, errs []error) {
+	journal := notifyJournal{config.NotifyJournalFile}
+	for _, ch := range r.channels() {
+		if journal.carried(ch.String(), personal.Appointments) {
+			slog.Info("Notification already sent before the previous run stopped", "recipient", r.label(), "channel", ch.kind)
+			sent++
+			continue
+		}
+		err := sendJournaled(journal, ch.String(), personal.Appointments, func() error {
+			switch ch.kind {
+			case channelSMS:
+				return sendSMSNotification(config, ch.address, shortText(personal, r, channelLimit(config, ch.kind)))
+			case channelWebhook:
+				return sendWebhookNotification(config, ch.address, webhookBody(r, personal))
+			case channelTelegram:
+				var buttons [][]notify.TelegramButton
+				if ch.address == bookingChat(config) {
+					buttons = bookButtons(personal.Appointments)
+				}
+				return sendTelegramButtons(config, ch.address, shortText(personal, r, channelLimit(config, ch.kind)), buttons)
+			default:
+				return sendEmailNotification(config, []string{ch.address}, personal.Subject, textBody, htmlBody)
+			}
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", ch.kind, err))
+			continue
+		}
+		sent++
+		slog.Info("Notification sent", "recipient", r.label(), "channel", ch.kind)
+	}
+	return sent, errs
+}
+
+// printDryRun writes what each of r's channels would be sent to stdout.
+func printDryRun(config AppConfig, r Recipient, personal Notification, textBody, htmlBody string) {
+	for _, ch := range r.channels() {
+		switch ch.kind {
+		case channelSMS:
+			fmt.Printf("===== Text message to %s (dry run, not sent) =====\n%s\n", ch.address, shortText(personal, r, channelLimit(config, ch.kind)))
+		case channelWebhook:
+			fmt.Printf("===== Webhook POST to %s (dry run, not sent) =====\n%s\n", ch.address, webhookBody(r, personal))
+		case channelTelegram:
+			fmt.Printf("===== Telegram message to %s (dry run, not sent) =====\n%s\n", ch.address, shortText(personal, r, channelLimit(config, ch.kind)))
+		default:
+			printDryRunEmail(config, ch.address, personal.Subject, textBody, htmlBody)
+		}
+	}
+}
+
+// webhookPayload is the JSON body POSTed to a subscriber's webhook.
+type webhookPayload struct {
+	Subscriber   string        `json:"subscriber"`
+	Subject      string        `json:"subject"`
+	Appointments []Appointment `json:"appointments"`
+	Removed      []Appointment `json:"removed,omitempty"`
+	BookingURL   string        `json:"bookingUrl"`
+}
+
+func webhookBody(r Recipient, n Notification) []byte {
+	body, _ := json.MarshalIndent(webhookPayload{
+		Subscriber:   r.label(),
+		Subject:      n.Subject,
+		Appointments: n.Appointments,
+		Removed:      n.Removed,
+		BookingURL:   bookingURL,
+	}, "", "  ")
+	return body
+}
+
+// sendSMSNotification texts body to phone through Twilio.
+func sendSMSNotification(config AppConfig, phone, body string) error {
+	if config.SMSAccountSID == "" || config.SMSAuthToken == "" || config.SMSFrom == "" {
+		return fmt.Errorf("%w: %w", errNotify, errors.New("smsAccountSid, smsAuthToken and smsFrom are required to send text messages"))
+	}
+	sms := notify.SMS{AccountSID: config.SMSAccountSID, AuthToken: config.SMSAuthToken, From: config.SMSFrom, URL: twilioMessagesURL, HTTPClient: providerHTTPClient}
+	return sendWithRetry(config, "Sending text message to "+phone, func() error {
+		return sms.Send(phone, body)
+	})
+}
+
+// sendWebhookNotification POSTs body to a subscriber's webhook.
+func sendWebhookNotification(config AppConfig, webhook string, body []byte) error {
+	sender := notify.Webhook{UserAgent: userAgent(config), HTTPClient: providerHTTPClient}
+	return sendWithRetry(config, "Sending webhook to "+webhook, func() error {
+		return sender.Send(webhook, body)
+	})
+}
+
+// alertRecipient is the operator, reached at alertEmail, alertPhone,
+// alertTelegram and alertWebhook, whichever are set.
+func alertRecipient(config AppConfig) Recipient {
+	return Recipient{Name: "operator", Email: config.AlertEmail, Phone: config.AlertPhone, Telegram: config.AlertTelegram, Webhook: config.AlertWebhook}
+}
+
+// alertPayload is the JSON body of an alert POSTed to alertWebhook.
+type alertPayload struct {
+	Alert   bool   `json:"alert"`
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+}
+
+// sendAlert tells the operator about a problem on each of their channels,
+// logging any it couldn't be sent on. Nothing is sent in read-only mode.
+func sendAlert(config AppConfig, subject, body string) {
+	sendMessage(config, alertRecipient(config), subject, body)
+}
+
+// sendMessage sends a plain message to each of r's channels, as sendAlert
+// does.
+func sendMessage(config AppConfig, r Recipient, subject, body string) {
+	if config.ReadOnly {
+		return
+	}
+	for _, ch := range r.channels() {
+		limit := channelLimit(config, ch.kind)
+		text := limit.prepare(subject + "\n\n" + body)
+		if limit.maxLength > 0 && limit.length(text) > limit.maxLength {
+			text = limit.truncate(text)
+		}
+		var err error
+		switch ch.kind {
+		case channelSMS:
+			err = sendSMSNotification(config, ch.address, text)
+		case channelTelegram:
+			err = sendTelegramMessage(config, ch.address, text)
+		case channelWebhook:
+			payload, _ := json.Marshal(alertPayload{Alert: true, Subject: subject, Text: body})
+			err = sendWebhookNotification(config, ch.address, payload)
+		default:
+			err = sendEmailNotification(config, []string{ch.address}, subject, body, "")
+		}
+		if err != nil {
+			slog.Error("Error sending alert", "subject", subject, "channel", ch.kind, "recipient", ch.address, "err", err)
+		}
+	}
+}
+
+// sendWithRetry runs send under the notification retry policy.
+func sendWithRetry(config AppConfig, op string, send func() error) error {
+	if err := config.Retry.policy(retryNotify).do(op, clock.Sleep, send); err != nil {
+		return fmt.Errorf("%w: %w", errNotify, err)
+	}
+	return nil
+}
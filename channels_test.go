@@ -0,0 +1,141 @@
+package melanzana
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestValidateSubscribers(t *testing.T) {
+	tests := []struct {
+		name       string
+		subscriber Recipient
+		want       string
+	}{
+		{"Email", Recipient{Name: "me", Email: "me@example.com"}, ""},
+		{"EveryChannel", Recipient{Email: "me@example.com", Phone: "+15551234567", Telegram: "-1001234", Webhook: "https://example.com/hook"}, ""},
+		{"NoChannel", Recipient{Name: "me", Weekdays: []string{"Sat"}}, "no email, phone, telegram or webhook"},
+		{"LocalPhone", Recipient{Phone: "555-1234"}, "international form"},
+		{"Telegram", Recipient{Telegram: "@grandma"}, "numeric chat ID"},
+		{"Webhook", Recipient{Webhook: "example.com/hook"}, "http or https URL"},
+		{"Weekday", Recipient{Email: "me@example.com", Weekdays: []string{"Caturday"}}, "invalid weekday"},
+		{"Date", Recipient{Email: "me@example.com", From: "2024-13-01"}, "invalid date"},
+		{"Window", Recipient{Email: "me@example.com", From: "2024-07-01", To: "2024-06-01"}, "before it starts"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSubscribers([]Recipient{tt.subscriber})
+			if tt.want == "" && err != nil {
+				t.Errorf("validateSubscribers() error = %v, want nil", err)
+			}
+			if tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+				t.Errorf("validateSubscribers() error = %v, want one mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeliverToSubscribers(t *testing.T) {
+	received := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received[r.URL.Path] = string(body)
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+	defer func(format string) { twilioMessagesURL = format }(twilioMessagesURL)
+	twilioMessagesURL = server.URL + "/twilio/%s"
+
+	config := AppConfig{
+		SMSAccountSID: "AC123",
+		SMSAuthToken:  "token",
+		SMSFrom:       "+15550000000",
+		Retry:         RetryConfig{RetryPolicy: RetryPolicy{MaxAttempts: 1}},
+		Subscribers: []Recipient{
+			{Name: "weekends", Webhook: server.URL + "/hook", Weekdays: []string{"Sat", "Sun"}},
+			{Name: "june", Phone: "+15551234567", To: "2099-06-30"},
+			{Name: "broken", Webhook: server.URL + "/broken"},
+			{Name: "crowd", Webhook: server.URL + "/crowd", MinSpaces: 5},
+		},
+	}
+	saturday := Appointment{Date: "2099-06-27", Time: "10:00 am – 10:30 am", Spaces: 1}
+	wednesday := Appointment{Date: "2099-07-01", Time: "10:00 am – 10:30 am", Spaces: 1}
+	n := Notification{Subject: "New appointments", Appointments: []Appointment{saturday, wednesday}}
+
+	sent, failed, undelivered := deliverNotification(config, n, RenderOptions{})
+	// Only the subscriber whose webhook fails wanted the Wednesday slot.
+	if sent != 2 || failed != 1 || len(undelivered) != 1 || undelivered[0].Date != wednesday.Date {
+		t.Errorf("deliverNotification() = %d sent, %d failed, %+v undelivered; want 2, 1 and the Wednesday slot", sent, failed, undelivered)
+	}
+	if _, ok := received["/crowd"]; ok {
+		t.Errorf("subscriber with no matching slots was notified: %s", received["/crowd"])
+	}
+
+	var hook webhookPayload
+	if err := json.Unmarshal([]byte(received["/hook"]), &hook); err != nil {
+		t.Fatalf("webhook body %q: %v", received["/hook"], err)
+	}
+	if hook.Subscriber != "weekends" || len(hook.Appointments) != 1 || hook.Appointments[0].Date != saturday.Date {
+		t.Errorf("webhook payload = %+v, want only the Saturday slot", hook)
+	}
+
+	form, err := url.ParseQuery(received["/twilio/AC123"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if form.Get("To") != "+15551234567" || !strings.Contains(form.Get("Body"), saturday.Date) || strings.Contains(form.Get("Body"), wednesday.Date) || strings.Contains(form.Get("Body"), "–") {
+		t.Errorf("text message = %v, want only the June slot sent to the subscriber's phone, in the GSM alphabet", form)
+	}
+}
+
+func TestSendAlert(t *testing.T) {
+	received := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received[r.URL.Path] = string(body)
+	}))
+	defer server.Close()
+	defer func(format string) { twilioMessagesURL = format }(twilioMessagesURL)
+	twilioMessagesURL = server.URL + "/twilio/%s"
+
+	config := AppConfig{
+		SMSAccountSID: "AC123",
+		SMSAuthToken:  "token",
+		SMSFrom:       "+15550000000",
+		SMSMaxLength:  40,
+		AlertPhone:    "+15551234567",
+		AlertWebhook:  server.URL + "/alert",
+		Retry:         RetryConfig{RetryPolicy: RetryPolicy{MaxAttempts: 1}},
+	}
+	schemaAlert(config)(errors.New("response is not a JSON object"))
+
+	var alert alertPayload
+	if err := json.Unmarshal([]byte(received["/alert"]), &alert); err != nil {
+		t.Fatalf("webhook body %q: %v", received["/alert"], err)
+	}
+	if !alert.Alert || !strings.Contains(alert.Subject, "response changed") || !strings.Contains(alert.Text, "not a JSON object") {
+		t.Errorf("webhook payload = %+v, want the schema alert", alert)
+	}
+	form, err := url.ParseQuery(received["/twilio/AC123"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if form.Get("To") != "+15551234567" || !strings.HasPrefix(form.Get("Body"), "Melanzana scraper") || len(form.Get("Body")) > 40 {
+		t.Errorf("text message = %v, want the alert cut to smsMaxLength", form)
+	}
+
+	// Read-only runs send nothing.
+	clear(received)
+	config.ReadOnly = true
+	sendAlert(config, "subject", "body")
+	if len(received) != 0 {
+		t.Errorf("read-only sendAlert() sent %v", received)
+	}
+}
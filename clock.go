@@ -0,0 +1,75 @@
+package melanzana
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the scraping pipeline the time and waits for it: which months
+// to fetch, when slots were observed, what counts as today, whether a cycle
+// is due, and how long to back off between retries, requests and cycles.
+// Everything that judges availability by the current time or waits on it
+// goes through clock rather than the time package, so tests and replays can
+// set the time and skip the waits. Times sent to other services, such as
+// request signatures, token expiry and connection deadlines, and the
+// systemd watchdog, stay on the wall clock.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+}
+
+var clock Clock = wallClock{}
+
+// clockNow reads clock at call time, for components that take a
+// func() time.Time and are built before clock may be replaced.
+func clockNow() time.Time { return clock.Now() }
+
+// clockSleep sleeps on clock at call time, for components that take a
+// func(time.Duration).
+func clockSleep(d time.Duration) { clock.Sleep(d) }
+
+// wallClock is the system clock.
+type wallClock struct{}
+
+func (wallClock) Now() time.Time                         { return time.Now() }
+func (wallClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (wallClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// frozenClock stands still at a set time, as replays and tests need. Waits
+// return at once, moving it on by the time waited, so a retry or follow-up
+// re-check sees the time it would have run at.
+type frozenClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFrozenClock(at time.Time) *frozenClock {
+	return &frozenClock{now: at}
+}
+
+func (c *frozenClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// set moves the clock to at.
+func (c *frozenClock) set(at time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = at
+}
+
+func (c *frozenClock) Sleep(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(max(d, 0))
+}
+
+func (c *frozenClock) After(d time.Duration) <-chan time.Time {
+	c.Sleep(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.Now()
+	return ch
+}
@@ -0,0 +1,69 @@
+package melanzana
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fixClock sets clock to a frozenClock at at for the rest of the test.
+func fixClock(t *testing.T, at time.Time) *frozenClock {
+	t.Helper()
+	saved := clock
+	frozen := newFrozenClock(at)
+	clock = frozen
+	t.Cleanup(func() { clock = saved })
+	return frozen
+}
+
+func TestScrapeCalendarUsesClock(t *testing.T) {
+	defer func(client *http.Client, tz string) { apiClient, sourceTimezone = client, tz }(apiClient, sourceTimezone)
+	sourceTimezone = "America/Denver"
+	// Late on New Year's Eve in Denver is already January in UTC.
+	now := time.Date(2026, 1, 1, 5, 0, 0, 0, time.UTC)
+	fixClock(t, now)
+
+	dir := t.TempDir()
+	for name, body := range map[string]string{
+		"2025-12.json": `{"long": [{"slot_start": "2025-12-31 09:00", "slot_end": "2025-12-31 09:30", "is_bookable": true, "qty_left": 1}], "max_date": "2026-01-31"}`,
+		"2026-01.json": `{"long": [{"slot_start": "2026-01-05 09:00", "slot_end": "2026-01-05 09:30", "is_bookable": true, "qty_left": 2}], "max_date": "2026-02-28"}`,
+		"2026-02.json": `{"long": [{"slot_start": "2026-02-02 09:00", "slot_end": "2026-02-02 09:30", "is_bookable": true, "qty_left": 1}]}`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	apiClient = &http.Client{Transport: replayTransport{&replaySnapshot{At: now, Dir: dir}}}
+
+	var tally scrapeTally
+	got := scrapeCalendar(Calendar{CalendarID: "cal"}, 2, &tally)
+	if tally.maxDates[""] != "2026-02-28" {
+		t.Errorf("max_date noted = %q, want the latest, 2026-02-28", tally.maxDates[""])
+	}
+	if len(got) != 2 || got[0].Date != "2025-12-31" || got[1].Date != "2026-01-05" {
+		t.Fatalf("scrapeCalendar() = %+v, want the slots of December and January, the months ahead in the source timezone", got)
+	}
+	for _, appt := range got {
+		if !appt.ObservedAt.Equal(now) {
+			t.Errorf("ObservedAt = %v, want the clock's time %v", appt.ObservedAt, now)
+		}
+	}
+}
+
+func TestFrozenClock(t *testing.T) {
+	at := time.Date(2099, 7, 1, 12, 0, 0, 0, time.UTC)
+	c := newFrozenClock(at)
+	if !c.Now().Equal(at) {
+		t.Errorf("Now() = %v, want %v", c.Now(), at)
+	}
+	c.Sleep(time.Minute)
+	if got := <-c.After(time.Hour); !got.Equal(at.Add(time.Hour+time.Minute)) || !c.Now().Equal(got) {
+		t.Errorf("After() fired at %v, clock at %v; want both moved on by the time waited", got, c.Now())
+	}
+	c.set(at)
+	if !c.Now().Equal(at) {
+		t.Errorf("Now() after set() = %v, want %v", c.Now(), at)
+	}
+}
@@ -0,0 +1,14 @@
+// Command melanzana watches the Melanzana booking calendar and notifies
+// about newly opened appointment slots. See the README for its commands,
+// flags and configuration.
+package main
+
+import (
+	"os"
+
+	"github.com/pashbylogan/melanzana"
+)
+
+func main() {
+	os.Exit(melanzana.Main(os.Args[1:]))
+}
@@ -0,0 +1,429 @@
+package melanzana
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pashbylogan/melanzana/pkg/store"
+)
+
+// command is a "melanzana <name>" subcommand.
+type command struct {
+	name    string
+	usage   string // Arguments shown after the name in help
+	summary string
+	run     func(args []string) int // Returns the exit code
+}
+
+// commands lists the subcommands in the order help shows them. It is set in
+// init because help refers back to it.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"run", "[flags]", "Check for new appointments once and exit", func(args []string) int { return runScraper("run", args, modeOnce) }},
+		{"watch", "[flags]", fmt.Sprintf("Check continuously, every pollIntervalMinutes (default %d)", defaultWatchInterval),
+			func(args []string) int { return runScraper("watch", args, modeWatch) }},
+		{"lambda", "[flags]", "Check once per AWS Lambda invocation, as a custom runtime", func(args []string) int { return runScraper("lambda", args, modeLambda) }},
+		{"function", "[flags]", "Serve HTTP on $PORT, checking once per request (Cloud Functions, Cloud Run)",
+			func(args []string) int { return runScraper("function", args, modeFunction) }},
+		{"list", "[flags]", "List the open slots found by the latest check", runListCommand},
+		{"prune", "[flags]", "Remove seen appointments for days that have passed", runPruneCommand},
+		{"dedupe", "[flags]", "Remove repeated records of a slot from the seen appointments", runDedupeCommand},
+		{"stats", "[flags]", "Report when slots open and how long they stay open", runStatsCommand},
+		{"seen", "<list|remove|clear> [flags]", "Show or edit the appointments already notified about", runSeenCommand},
+		{"replay", "-responses <dir> [flags]", "Run recorded Cowlendar responses through the pipeline, printing notifications", runReplayCommand},
+		{"export", "[flags]", "Write stored observations as JSON Lines", runExportCommand},
+		{"config", "<example|migrate|validate|show>", "Create, upgrade, check or show a configuration", runConfigCommand},
+		{"campaign", "<list|booked> <stateFile>", "Report on or archive campaigns", runCampaignCommand},
+		{"experiment", "report <historyFile>", "Report on a polling experiment", runExperimentCommand},
+		{"version", "", "Print the version", func([]string) int { fmt.Println(version); return 0 }},
+		{"help", "", "Show this help", func([]string) int { writeUsage(os.Stdout); return 0 }},
+	}
+}
+
+// runCommand runs the named subcommand and returns the exit code.
+func runCommand(name string, args []string) int {
+	for _, c := range commands {
+		if c.name == name {
+			return c.run(args)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	writeUsage(os.Stderr)
+	return 2
+}
+
+// writeUsage lists the subcommands.
+func writeUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: melanzana [command] [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Without a command, melanzana checks once, or continuously if pollIntervalMinutes is set.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, c := range commands {
+		fmt.Fprintf(tw, "  %s %s\t%s\n", c.name, c.usage, c.summary)
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run \"melanzana run -h\" for the configuration flags, which run, watch, lambda, function, list, stats, prune and seen accept.")
+}
+
+// commandStore resolves the configuration from a command's flags in fs, as
+// the scraper would, secrets included, and opens its state store. Arguments
+// after the flags are left in fs.Args().
+func commandStore(fs *flag.FlagSet, args []string) (AppConfig, Store, error) {
+	config, _, err := parseConfig(fs, args)
+	if err != nil {
+		return config, nil, err
+	}
+	if err := setupLogging(config); err != nil {
+		return config, nil, err
+	}
+	if err := resolveSecrets(&config); err != nil {
+		return config, nil, fmt.Errorf("failed to resolve secrets: %w", err)
+	}
+	if _, err := loadTimezone(config.Timezone); err != nil {
+		return config, nil, err
+	}
+	sourceTimezone = config.Timezone
+	store, err := newStore(config)
+	if err != nil {
+		return config, nil, fmt.Errorf("failed to configure state store: %w", err)
+	}
+	return config, store, nil
+}
+
+// runListCommand prints the slots that were open at the latest check, as
+// recorded in the availability history.
+func runListCommand(args []string) int {
+	config, store, err := commandStore(flag.NewFlagSet("list", flag.ContinueOnError), args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	history, err := store.History()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read %s: %v\n", config.HistoryFile, err)
+		return 1
+	}
+	writeSlotList(os.Stdout, openSlots(history, clock.Now()), "No open slots recorded", "SINCE", func(a Appointment) time.Time { return a.ObservedAt })
+	return 0
+}
+
+// openSlots returns the slots the history shows as open and not yet past,
+// in date and time order. Each slot's ObservedAt is when it last changed.
+func openSlots(history []AvailabilityEvent, now time.Time) []Appointment {
+	today := now.In(sourceLocation()).Format("2006-01-02")
+	var open []Appointment
+	for _, e := range availabilityState(history) {
+		if e.Kind == eventDisappeared || e.Date < today {
+			continue
+		}
+		open = append(open, Appointment{Date: e.Date, Time: e.Time, Calendar: e.Calendar, Spaces: e.Spaces, IsAvailable: true, ObservedAt: e.At})
+	}
+	sortSlots(open)
+	return open
+}
+
+// sortSlots orders slots by date, then start time.
+func sortSlots(slots []Appointment) {
+	sort.Slice(slots, func(i, j int) bool {
+		if slots[i].Date != slots[j].Date {
+			return slots[i].Date < slots[j].Date
+		}
+		si, _, erri := parseSlotTimes(slots[i])
+		sj, _, errj := parseSlotTimes(slots[j])
+		if erri == nil && errj == nil && !si.Equal(sj) {
+			return si.Before(sj)
+		}
+		return appointmentKey(slots[i]) < appointmentKey(slots[j])
+	})
+}
+
+// writeSlotList prints slots as a table, with each slot's at time in the
+// column headed when, or empty if there are none.
+func writeSlotList(w io.Writer, slots []Appointment, empty, when string, at func(Appointment) time.Time) {
+	if len(slots) == 0 {
+		fmt.Fprintln(w, empty)
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DATE\tTIME\tSPACES\tCALENDAR\t"+when)
+	for _, s := range slots {
+		calendar := s.Calendar
+		if calendar == "" {
+			calendar = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n", s.Date, s.Time, s.Spaces, calendar, formatOptionalTime(at(s).Local()))
+	}
+	tw.Flush()
+}
+
+// runPruneCommand removes seen appointments dated before today, which each
+// cycle otherwise does after saving.
+func runPruneCommand(args []string) int {
+	config, store, err := commandStore(flag.NewFlagSet("prune", flag.ContinueOnError), args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if config.ReadOnly {
+		fmt.Fprintln(os.Stderr, "not pruning in read-only mode")
+		return 1
+	}
+	removed, err := store.Prune(clock.Now().In(sourceLocation()))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to prune: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Removed %d past appointments\n", removed)
+	return 0
+}
+
+// runDedupeCommand implements "melanzana dedupe": it rewrites the seen
+// appointments with one record per slot. Every save does this too; the
+// command tidies state written before that, or merged by hand.
+func runDedupeCommand(args []string) int {
+	config, st, err := commandStore(flag.NewFlagSet("dedupe", flag.ContinueOnError), args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if config.ReadOnly {
+		fmt.Fprintln(os.Stderr, "not deduplicating in read-only mode")
+		return 1
+	}
+	seen, err := st.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load seen appointments: %v\n", err)
+		return 1
+	}
+	deduped := store.Dedupe(seen)
+	if err := st.Save(deduped); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to save seen appointments: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Removed %d duplicate seen appointments\n", len(seen)-len(deduped))
+	return 0
+}
+
+// runConfigCommand implements "melanzana config <subcommand>" and returns the exit code.
+func runConfigCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: melanzana config <example|migrate <file>|validate [flags]|show [flags]>")
+		return 2
+	}
+
+	switch args[0] {
+	case "example":
+		if err := writeConfigExample(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	case "migrate":
+		return runConfigMigrate(args[1:])
+	case "validate":
+		return runConfigValidate(args[1:])
+	case "show":
+		return runConfigShow(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown config subcommand %q\n", args[0])
+		return 2
+	}
+}
+
+// runConfigMigrate prints the upgraded form of a config file to stdout, with
+// warnings about renamed and removed fields on stderr.
+func runConfigMigrate(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: melanzana config migrate <file> > new.json")
+		return 2
+	}
+
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read %s: %v\n", args[0], err)
+		return 1
+	}
+
+	config, warnings, err := migrateConfig(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to migrate %s: %v\n", args[0], err)
+		return 1
+	}
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+	}
+
+	out, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to encode migrated config: %v\n", err)
+		return 1
+	}
+	fmt.Println(string(out))
+	return 0
+}
+
+// runConfigValidate resolves the configuration from the given flags, as the
+// scraper would, and reports every problem found.
+func runConfigValidate(args []string) int {
+	config, _, err := parseConfig(flag.NewFlagSet("config validate", flag.ContinueOnError), args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	problems := configProblems(config)
+	if config.ConfigFile != "" {
+		if err := checkConfigFileKeys(config.ConfigFile); err != nil {
+			problems = append([]string{err.Error()}, problems...)
+		}
+	}
+	for _, p := range problems {
+		fmt.Fprintf(os.Stderr, "error: %s\n", p)
+	}
+	if len(problems) > 0 {
+		return 1
+	}
+	fmt.Println("Configuration is valid")
+	return 0
+}
+
+// runConfigShow prints the effective configuration for the given flags, with
+// secrets redacted and each value annotated with where it came from.
+func runConfigShow(args []string) int {
+	config, fromFile, err := parseConfig(flag.NewFlagSet("config show", flag.ContinueOnError), args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := writeEffectiveConfig(os.Stdout, config, fromFile); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// runExperimentCommand implements "melanzana experiment <subcommand>" and returns the exit code.
+func runExperimentCommand(args []string) int {
+	if len(args) != 2 || args[0] != "report" {
+		fmt.Fprintln(os.Stderr, "usage: melanzana experiment report <historyFile>")
+		return 2
+	}
+
+	history, err := loadPollHistory(args[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(history.Checks) == 0 {
+		fmt.Fprintf(os.Stderr, "no checks recorded in %s\n", args[1])
+		return 1
+	}
+	writePollReport(os.Stdout, history)
+	return 0
+}
+
+// runCampaignCommand implements "melanzana campaign <subcommand>" and returns the exit code.
+func runCampaignCommand(args []string) int {
+	usage := "usage: melanzana campaign <list <stateFile>|booked <stateFile> <name>>"
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	state, err := loadCampaignState(args[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	switch {
+	case args[0] == "list" && len(args) == 2:
+		writeCampaignReport(os.Stdout, state)
+		return 0
+	case args[0] == "booked" && len(args) == 3:
+		state.archive(args[2], campaignBooked, clock.Now())
+		if err := saveCampaignState(state, args[1]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("Campaign %q marked booked; it will no longer notify\n", args[2])
+		return 0
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+}
+
+// runSeenCommand implements "melanzana seen <subcommand>": listing the
+// appointments already notified about, or forgetting some or all of them so
+// they are notified about again while still available.
+func runSeenCommand(args []string) int {
+	usage := "usage: melanzana seen <list [flags]|remove [flags] <date> [start time]|clear [flags]>"
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	fs := flag.NewFlagSet("seen "+args[0], flag.ContinueOnError)
+	config, store, err := commandStore(fs, args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	seen, err := store.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load seen appointments: %v\n", err)
+		return 1
+	}
+
+	var kept []Appointment
+	switch {
+	case args[0] == "list" && fs.NArg() == 0:
+		sortSlots(seen)
+		writeSlotList(os.Stdout, seen, "No seen appointments", "NOTIFIED", func(a Appointment) time.Time { return a.LastNotifiedAt })
+		return 0
+	case args[0] == "remove" && (fs.NArg() == 1 || fs.NArg() == 2):
+		kept = []Appointment{}
+		for _, appt := range seen {
+			if !matchesSlot(appt, fs.Arg(0), fs.Arg(1)) {
+				kept = append(kept, appt)
+			}
+		}
+	case args[0] == "clear" && fs.NArg() == 0:
+		kept = []Appointment{}
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	if config.ReadOnly {
+		fmt.Fprintln(os.Stderr, "not changing seen appointments in read-only mode")
+		return 1
+	}
+	if err := store.Save(kept); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to save seen appointments: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Removed %d of %d seen appointments\n", len(seen)-len(kept), len(seen))
+	return 0
+}
+
+// matchesSlot reports whether appt is on date and, if start is set, starts at
+// start, e.g. "10:00 am", or has exactly that time range.
+func matchesSlot(appt Appointment, date, start string) bool {
+	if appt.Date != date {
+		return false
+	}
+	return start == "" || appt.Time == start || strings.HasPrefix(appt.Time, start+" ")
+}
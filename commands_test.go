@@ -0,0 +1,202 @@
+package melanzana
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pashbylogan/melanzana/pkg/store"
+)
+
+func TestOpenSlots(t *testing.T) {
+	defer func(name string) { sourceTimezone = name }(sourceTimezone)
+	sourceTimezone = "America/Denver"
+
+	at := time.Date(2024, 5, 15, 9, 0, 0, 0, time.UTC)
+	history := []AvailabilityEvent{
+		{At: at, Kind: eventAppeared, Date: "2024-05-20", Time: "10:00 am – 10:30 am", Spaces: 2},
+		{At: at, Kind: eventAppeared, Date: "2024-05-20", Time: "9:00 am – 9:30 am", Spaces: 1},
+		{At: at, Kind: eventAppeared, Date: "2024-05-14", Time: "9:00 am – 9:30 am", Spaces: 1},
+		{At: at, Kind: eventAppeared, Date: "2024-05-16", Time: "9:00 am – 9:30 am", Spaces: 1},
+		{At: at.Add(time.Hour), Kind: eventDisappeared, Date: "2024-05-16", Time: "9:00 am – 9:30 am", PreviousSpaces: 1},
+		{At: at.Add(time.Hour), Kind: eventDecreased, Date: "2024-05-20", Time: "10:00 am – 10:30 am", Spaces: 1, PreviousSpaces: 2},
+	}
+
+	got := openSlots(history, at.Add(2*time.Hour))
+	want := []string{"2024-05-20 9:00 am – 9:30 am", "2024-05-20 10:00 am – 10:30 am"}
+	if len(got) != len(want) {
+		t.Fatalf("openSlots() = %+v, want %v", got, want)
+	}
+	for i, appt := range got {
+		if appt.Date+" "+appt.Time != want[i] {
+			t.Errorf("openSlots()[%d] = %s %s, want %s", i, appt.Date, appt.Time, want[i])
+		}
+	}
+	if got[1].Spaces != 1 || !got[1].ObservedAt.Equal(at.Add(time.Hour)) {
+		t.Errorf("openSlots()[1] = %+v, want the spaces and time of its latest change", got[1])
+	}
+}
+
+func TestPruneCommand(t *testing.T) {
+	defer func(name string) { sourceTimezone = name }(sourceTimezone)
+	dir := t.TempDir()
+	dataFile := filepath.Join(dir, "seen.json")
+	store := &store.JSONFile{Path: dataFile, HistoryPath: filepath.Join(dir, "history.jsonl")}
+	fixClock(t, time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC))
+	today := "2025-03-10"
+	if err := store.Save([]Appointment{{Date: "2025-03-09", Time: "9:00 am – 9:30 am"}, {Date: today, Time: "9:00 am – 9:30 am"}}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	if code := runPruneCommand([]string{"-dataFile", dataFile, "-timezone", "UTC", "-readOnly"}); code != 1 {
+		t.Errorf("prune -readOnly exit code = %d, want 1", code)
+	}
+	discardStdout(t)
+	if code := runPruneCommand([]string{"-dataFile", dataFile, "-timezone", "UTC"}); code != 0 {
+		t.Fatalf("prune exit code = %d, want 0", code)
+	}
+	seen, err := store.Load()
+	if err != nil || len(seen) != 1 || seen[0].Date != today {
+		t.Errorf("seen after prune = %+v, %v; want only today's appointment", seen, err)
+	}
+}
+
+func TestWriteUsage(t *testing.T) {
+	var b strings.Builder
+	writeUsage(&b)
+	for _, c := range commands {
+		if !strings.Contains(b.String(), "  "+c.name+" ") {
+			t.Errorf("usage is missing the %s command:\n%s", c.name, b.String())
+		}
+	}
+}
+
+// discardStdout silences what a command prints for the rest of the test.
+func discardStdout(t *testing.T) {
+	t.Helper()
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = devNull
+	t.Cleanup(func() {
+		os.Stdout = stdout
+		devNull.Close()
+	})
+}
+
+func TestSeenCommand(t *testing.T) {
+	defer func(name string) { sourceTimezone = name }(sourceTimezone)
+	dir := t.TempDir()
+	dataFile := filepath.Join(dir, "seen.json")
+	store := &store.JSONFile{Path: dataFile, HistoryPath: filepath.Join(dir, "history.jsonl")}
+	err := store.Save([]Appointment{
+		{Date: "2024-05-20", Time: "9:00 am – 9:30 am"},
+		{Date: "2024-05-20", Time: "10:00 am – 10:30 am"},
+		{Date: "2024-05-21", Time: "9:00 am – 9:30 am"},
+	})
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	discardStdout(t)
+
+	steps := []struct {
+		args []string
+		code int
+		left int
+	}{
+		{[]string{"list", "-dataFile", dataFile}, 0, 3},
+		{[]string{"remove", "-dataFile", dataFile}, 2, 3},
+		{[]string{"remove", "-dataFile", dataFile, "-readOnly", "2024-05-20"}, 1, 3},
+		{[]string{"remove", "-dataFile", dataFile, "2024-05-20", "10:00 am"}, 0, 2},
+		{[]string{"remove", "-dataFile", dataFile, "2024-05-21"}, 0, 1},
+		{[]string{"clear", "-dataFile", dataFile}, 0, 0},
+		{[]string{"forget", "-dataFile", dataFile}, 2, 0},
+	}
+	for _, step := range steps {
+		if code := runSeenCommand(step.args); code != step.code {
+			t.Errorf("seen %v exit code = %d, want %d", step.args, code, step.code)
+		}
+		if seen, err := store.Load(); err != nil || len(seen) != step.left {
+			t.Errorf("after seen %v: %d seen appointments, %v; want %d", step.args, len(seen), err, step.left)
+		}
+	}
+}
+
+func TestCommandStoreResolvesSecrets(t *testing.T) {
+	defer func(name string) { sourceTimezone = name }(sourceTimezone)
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "state.key")
+	if err := os.WriteFile(keyFile, []byte(testEncryptionKey+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	configFile := filepath.Join(dir, "config.json")
+	dataFile := filepath.Join(dir, "seen.json")
+	config := fmt.Sprintf(`{"configVersion": 2, "dataFile": %q, "stateCodecs": ["aes"], "stateEncryptionKey": "file://%s"}`, dataFile, keyFile)
+	if err := os.WriteFile(configFile, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, store, err := commandStore(flag.NewFlagSet("seen", flag.ContinueOnError), []string{"-configFile", configFile})
+	if err != nil {
+		t.Fatalf("commandStore() with a file:// encryption key error = %v", err)
+	}
+	if err := store.Save([]Appointment{{Date: "2024-05-20", Time: "9:00 am – 9:30 am"}}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if data, _ := os.ReadFile(dataFile); bytes.Contains(data, []byte("2024-05-20")) {
+		t.Errorf("data file = %q, want it encrypted", data)
+	}
+}
+
+func TestMatchesSlot(t *testing.T) {
+	appt := Appointment{Date: "2024-05-20", Time: "10:00 am – 10:30 am"}
+	tests := []struct {
+		date, start string
+		want        bool
+	}{
+		{"2024-05-20", "", true},
+		{"2024-05-21", "", false},
+		{"2024-05-20", "10:00 am", true},
+		{"2024-05-20", "10:00 am – 10:30 am", true},
+		{"2024-05-20", "10", false},
+		{"2024-05-20", "1:00 am", false},
+	}
+	for _, tt := range tests {
+		if got := matchesSlot(appt, tt.date, tt.start); got != tt.want {
+			t.Errorf("matchesSlot(%q, %q) = %v, want %v", tt.date, tt.start, got, tt.want)
+		}
+	}
+}
+
+func TestDedupeCommand(t *testing.T) {
+	defer func(name string) { sourceTimezone = name }(sourceTimezone)
+	dataFile := filepath.Join(t.TempDir(), "seen.json")
+	// A version 1 file, written before saves dropped duplicates.
+	err := os.WriteFile(dataFile, []byte(`[
+		{"date": "2024-05-20", "time": "9:00 am – 9:30 am", "observedAt": "2024-05-15T09:00:00Z"},
+		{"date": "2024-05-20", "time": "9:00 am – 9:30 am", "observedAt": "2024-05-15T10:00:00Z"},
+		{"date": "2024-05-21", "time": "9:00 am – 9:30 am", "observedAt": "2024-05-15T09:00:00Z"}
+	]`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code := runDedupeCommand([]string{"-dataFile", dataFile, "-readOnly"}); code != 1 {
+		t.Errorf("dedupe -readOnly exit code = %d, want 1", code)
+	}
+	discardStdout(t)
+	if code := runDedupeCommand([]string{"-dataFile", dataFile}); code != 0 {
+		t.Fatalf("dedupe exit code = %d, want 0", code)
+	}
+	seen, err := loadSeenAppointments(dataFile, nil)
+	if err != nil || len(seen) != 2 || seen[0].ObservedAt.Hour() != 10 {
+		t.Errorf("seen after dedupe = %+v, %v; want 2 slots, keeping the later record", seen, err)
+	}
+}
@@ -0,0 +1,282 @@
+package melanzana
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/pashbylogan/melanzana/pkg/notify"
+)
+
+// redacted replaces secret values in "melanzana config show" output.
+const redacted = "REDACTED"
+
+// configProblems checks a resolved configuration for mistakes that would
+// only surface once a notification is due, and describes each one.
+func configProblems(config AppConfig) []string {
+	var problems []string
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if config.MonthsLookahead < 1 {
+		add("monthsLookahead must be at least 1, got %d", config.MonthsLookahead)
+	}
+	if config.MinFetchRatio < 0 || config.MinFetchRatio > 1 {
+		add("minFetchRatio must be between 0 and 1, got %g", config.MinFetchRatio)
+	}
+	if config.CalendarID == "" {
+		add("calendarId is required")
+	}
+	if config.HTTPTimeoutSeconds < 1 || config.HTTPConnectTimeoutSeconds < 1 {
+		add("httpTimeoutSeconds and httpConnectTimeoutSeconds must be at least 1")
+	}
+	if config.RequestsPerSecond < 0 || config.RequestBurst < 1 {
+		add("requestsPerSecond must not be negative and requestBurst must be at least 1")
+	}
+	if config.MaxCycleMinutes < 0 {
+		add("maxCycleMinutes must not be negative, got %d", config.MaxCycleMinutes)
+	}
+	if adaptive := config.AdaptivePolling; adaptive.enabled() && adaptive.MinIntervalMinutes > adaptive.MaxIntervalMinutes {
+		add("adaptivePolling.minIntervalMinutes (%d) is greater than maxIntervalMinutes (%d)", adaptive.MinIntervalMinutes, adaptive.MaxIntervalMinutes)
+	}
+	if config.RenotifyCooldownMinutes < 0 {
+		add("renotifyCooldownMinutes must not be negative, got %d", config.RenotifyCooldownMinutes)
+	}
+	if config.SMSMaxLength < 0 || config.TelegramMaxLength < 0 {
+		add("smsMaxLength and telegramMaxLength must not be negative")
+	}
+	if config.Features.HTMLFallback && config.HTMLFallbackURL == "" {
+		add("features.htmlFallback is on but htmlFallbackUrl is empty")
+	}
+	if config.HTMLFallbackURL != "" {
+		if u, err := url.Parse(config.HTMLFallbackURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || !strings.Contains(config.HTMLFallbackURL, "{date}") {
+			add("htmlFallbackUrl must be an http or https URL containing {date}, got %q", config.HTMLFallbackURL)
+		}
+		if err := config.HTMLSelectors.check(); err != nil {
+			add("htmlSelectors: %v", err)
+		}
+		if config.HTMLFallbackDelaySeconds < 0 {
+			add("htmlFallbackDelaySeconds must not be negative, got %d", config.HTMLFallbackDelaySeconds)
+		}
+	}
+	if config.Features.AutoBook {
+		if err := config.AutoBooking.check(); err != nil {
+			add("features.autoBook is on but %v", err)
+		}
+	}
+	if config.HeartbeatURL != "" {
+		if _, err := heartbeatPing(config.HeartbeatURL, nil); err != nil {
+			add("%v", err)
+		}
+	}
+	if _, err := proxyURL(config); err != nil {
+		add("%v", err)
+	}
+	if _, err := newLogHandler(io.Discard, config); err != nil {
+		add("%v", err)
+	}
+	if _, err := loadTimezone(config.Timezone); err != nil {
+		add("timezone: %v", err)
+	}
+	for _, c := range config.Campaigns {
+		if unknown := unknownCalendars(config, c.Calendars); len(unknown) > 0 {
+			add("campaign %q filters on unknown calendars %q", c.Name, unknown)
+		}
+	}
+	for _, p := range config.Profiles {
+		if unknown := unknownCalendars(config, p.Calendars); len(unknown) > 0 {
+			add("profile %q filters on unknown calendars %q", p.Name, unknown)
+		}
+	}
+	if u, err := url.Parse(config.BookingURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		add("bookingUrl must be an http or https URL, got %q", config.BookingURL)
+	}
+	if config.SlotBookingURL != "" {
+		if u, err := url.Parse(config.SlotBookingURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("slotBookingUrl must be an http or https URL, got %q", config.SlotBookingURL)
+		}
+	}
+	if config.ChangeWebhookURL != "" {
+		if u, err := url.Parse(config.ChangeWebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("changeWebhookUrl must be an http or https URL, got %q", config.ChangeWebhookURL)
+		}
+	}
+
+	switch strings.ToLower(config.EmailProvider) {
+	case "", notify.ProviderSMTP:
+		if config.SMTPServer == "" {
+			add("smtpServer is required for the smtp email provider")
+		}
+		if config.SMTPPort < 1 || config.SMTPPort > 65535 {
+			add("smtpPort must be between 1 and 65535, got %d", config.SMTPPort)
+		}
+		if _, err := notify.ResolveTLSMode(config.SMTPTLS, config.SMTPPort); err != nil {
+			add("smtpTLS: %v", err)
+		}
+		switch strings.ToLower(config.SMTPAuth) {
+		case "", notify.AuthAuto, notify.AuthPlain, notify.AuthLogin, notify.AuthCRAMMD5, notify.AuthXOAUTH2:
+		default:
+			add("unknown smtpAuth %q", config.SMTPAuth)
+		}
+	case notify.ProviderSendGrid:
+		if config.EmailAPIKey == "" {
+			add("emailApiKey is required for the sendgrid email provider")
+		}
+	case notify.ProviderMailgun:
+		if config.EmailAPIKey == "" || config.MailgunDomain == "" {
+			add("emailApiKey and mailgunDomain are required for the mailgun email provider")
+		}
+	case notify.ProviderSES:
+		if config.SESRegion == "" {
+			add("sesRegion is required for the ses email provider")
+		}
+	default:
+		add("unknown emailProvider %q", config.EmailProvider)
+	}
+
+	if config.FromEmail == "" {
+		add("fromEmail is required")
+	}
+	if config.RecipientsFile != "" {
+		recipients, err := readRecipients(config.RecipientsFile)
+		if err != nil {
+			add("recipientsFile: %v", err)
+		}
+		recipients, errs := compileRecipients(recipients)
+		for _, err := range errs {
+			add("recipientsFile: %v", err)
+		}
+		for _, r := range recipients {
+			if unknown := unknownCalendars(config, r.Calendars); len(unknown) > 0 {
+				add("recipient %s filters on unknown calendars %q", r.Email, unknown)
+			}
+		}
+	}
+	for _, s := range config.Subscribers {
+		if unknown := unknownCalendars(config, s.Calendars); len(unknown) > 0 {
+			add("subscriber %s filters on unknown calendars %q", s.label(), unknown)
+		}
+		if s.Phone != "" && (config.SMSAccountSID == "" || config.SMSAuthToken == "" || config.SMSFrom == "") {
+			add("subscriber %s has a phone number, but smsAccountSid, smsAuthToken and smsFrom aren't all set", s.label())
+		}
+		if s.Telegram != "" && config.TelegramBotToken == "" {
+			add("subscriber %s has a telegram chat ID, but telegramBotToken isn't set", s.label())
+		}
+	}
+	if config.SubscriberAPIToken != "" && (!config.ServeAPI || config.HealthAddr == "") {
+		add("subscriberApiToken is set, but the API isn't served: set healthAddr and serveApi")
+	}
+	if config.TelegramBot && config.TelegramBotToken == "" {
+		add("telegramBot is set, but telegramBotToken isn't")
+	}
+	if config.IMAPServer != "" && (config.IMAPUsername == "" || config.IMAPPassword == "") {
+		add("imapServer is set, but imapUsername and imapPassword aren't both set")
+	}
+	if len(config.ToEmails) == 0 && config.RecipientsFile == "" && len(config.Subscribers) == 0 && config.SubscriberAPIToken == "" && len(config.Campaigns) == 0 && len(config.Profiles) == 0 {
+		add("no recipients: set toEmails, recipientsFile, subscribers, campaigns or profiles")
+	}
+
+	switch config.StateStore {
+	case "", "file":
+	case "s3", "gcs":
+		if config.StateBucket == "" {
+			add("stateBucket is required for the %s state store", config.StateStore)
+		}
+	case "dynamodb":
+		if config.StateTable == "" {
+			add("stateTable is required for the dynamodb state store")
+		}
+	case "postgres":
+		if config.StateDatabaseURL == "" {
+			add("stateDatabaseUrl is required for the postgres state store")
+		}
+		if len(stateCodecNames(config)) > 0 {
+			add("stateCodecs isn't supported by the postgres state store")
+		}
+	default:
+		add("unknown stateStore %q", config.StateStore)
+	}
+	if _, err := stateCodec(config); err != nil {
+		add("stateCodecs: %v", err)
+	}
+
+	if _, err := newRenderOptions(config); err != nil {
+		add("displayTimezones: %v", err)
+	}
+	if operator := alertRecipient(config); operator.Phone != "" || operator.Telegram != "" || operator.Webhook != "" {
+		if err := validateSubscribers([]Recipient{operator}); err != nil {
+			add("alert channels: %v", err)
+		}
+	}
+	if config.EmailShutdownSummary && config.AlertEmail == "" {
+		add("emailShutdownSummary is set but alertEmail is empty")
+	}
+	return problems
+}
+
+// checkConfigFileKeys reports the first key in a config file that doesn't
+// correspond to any option, which usually means a typo.
+func checkConfigFileKeys(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", filename, err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(stripJSONComments(data)))
+	decoder.DisallowUnknownFields()
+	var config AppConfig
+	if err := decoder.Decode(&config); err != nil {
+		return fmt.Errorf("config file %s: %w", filename, err)
+	}
+	return nil
+}
+
+// redactSecrets returns config with every credential replaced by a
+// placeholder, so the output can be shared when asking for help. Secret
+// references are kept, since they don't reveal the secret.
+func redactSecrets(config AppConfig) AppConfig {
+	for _, secret := range secretFields(&config) {
+		if *secret != "" && !isSecretRef(*secret) {
+			*secret = redacted
+		}
+	}
+	return config
+}
+
+// writeEffectiveConfig writes the resolved configuration, with secrets
+// redacted, as commented JSON. Each option that doesn't have its default
+// value is annotated with whether the config file or a flag set it.
+func writeEffectiveConfig(w io.Writer, config, fromFile AppConfig) error {
+	sources := make(map[string]string)
+	defaults := reflect.ValueOf(defaultConfig())
+	file := reflect.ValueOf(fromFile)
+	final := reflect.ValueOf(config)
+	t := final.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key := t.Name() + "." + t.Field(i).Name
+		switch {
+		case !reflect.DeepEqual(file.Field(i).Interface(), final.Field(i).Interface()):
+			sources[key] = "set by a command-line flag"
+		case !reflect.DeepEqual(defaults.Field(i).Interface(), file.Field(i).Interface()):
+			sources[key] = "set in " + config.ConfigFile
+		}
+	}
+
+	var b strings.Builder
+	if config.ConfigFile != "" {
+		b.WriteString("// Effective configuration: defaults, then " + config.ConfigFile + ", then flags.\n")
+	} else {
+		b.WriteString("// Effective configuration: defaults, then flags. No config file was given.\n")
+	}
+	if err := writeConfigObject(&b, reflect.ValueOf(redactSecrets(config)), "", sources); err != nil {
+		return err
+	}
+	b.WriteString("\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,156 @@
+package melanzana
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseConfigPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"configVersion": 2, "monthsLookahead": 4, "smtpPort": 465}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, fromFile, err := parseConfig(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-configFile", path, "-months", "6"})
+	if err != nil {
+		t.Fatalf("parseConfig() error = %v", err)
+	}
+	if config.MonthsLookahead != 6 || config.SMTPPort != 465 || config.SMTPServer != "smtp.example.com" {
+		t.Errorf("parseConfig() = months %d, port %d, server %q; want flag, file and default values",
+			config.MonthsLookahead, config.SMTPPort, config.SMTPServer)
+	}
+	if fromFile.MonthsLookahead != 4 {
+		t.Errorf("parseConfig() fromFile months = %d, want the file value 4", fromFile.MonthsLookahead)
+	}
+}
+
+func TestParseConfigEmptyListFlags(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"configVersion": 2, "allowedWeekdays": ["Sat"], "blackoutDates": ["2025-07-04"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, _, err := parseConfig(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-configFile", path, "-allowedWeekdays", "", "-blackoutDates", ""})
+	if err != nil {
+		t.Fatalf("parseConfig() with empty list flags error = %v", err)
+	}
+	if len(config.AllowedWeekdays) != 0 || len(config.BlackoutDates) != 0 {
+		t.Errorf("parseConfig() = weekdays %q, blackout dates %q; want both cleared", config.AllowedWeekdays, config.BlackoutDates)
+	}
+}
+
+func TestConfigProblems(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*AppConfig)
+		want   string
+	}{
+		{"Defaults", func(c *AppConfig) {}, ""},
+		{"Months", func(c *AppConfig) { c.MonthsLookahead = 0 }, "monthsLookahead"},
+		{"MinFetchRatio", func(c *AppConfig) { c.MinFetchRatio = 1.5 }, "minFetchRatio"},
+		{"CalendarID", func(c *AppConfig) { c.CalendarID = "" }, "calendarId"},
+		{"HTTPTimeout", func(c *AppConfig) { c.HTTPTimeoutSeconds = 0 }, "httpTimeoutSeconds"},
+		{"RequestBurst", func(c *AppConfig) { c.RequestBurst = 0 }, "requestBurst"},
+		{"RenotifyCooldown", func(c *AppConfig) { c.RenotifyCooldownMinutes = -1 }, "renotifyCooldownMinutes"},
+		{"HTMLFallback", func(c *AppConfig) { c.HTMLFallbackURL = "https://melanzana.com/book-an-appointment" }, "htmlFallbackUrl"},
+		{"HTMLFallbackFeature", func(c *AppConfig) { c.Features.HTMLFallback = true }, "htmlFallbackUrl"},
+		{"AutoBookFeature", func(c *AppConfig) { c.Features.AutoBook = true }, "autoBooking.url"},
+		{"AutoBookBooker", func(c *AppConfig) {
+			c.Features.AutoBook = true
+			c.AutoBooking.URL = "https://melanzana.com/cart/add.js"
+			c.AutoBooking.Name, c.AutoBooking.Email, c.AutoBooking.Weekdays = "Ada", "ada@example.com", []string{"Someday"}
+		}, "autoBooking"},
+		{"HTMLSelectors", func(c *AppConfig) {
+			c.HTMLFallbackURL = "https://melanzana.com/book-an-appointment?date={date}"
+			c.HTMLSelectors.Time = "div["
+		}, "htmlSelectors"},
+		{"Proxy", func(c *AppConfig) { c.SOCKSProxy = "http://proxy:3128" }, "socksProxy"},
+		{"HeartbeatURL", func(c *AppConfig) { c.HeartbeatURL = "hc-ping.com/abc" }, "heartbeatUrl"},
+		{"LogFormat", func(c *AppConfig) { c.LogFormat = "logfmt" }, "logFormat"},
+		{"SourceTimezone", func(c *AppConfig) { c.Timezone = "Mars/Olympus" }, "timezone"},
+		{"UnknownCalendar", func(c *AppConfig) {
+			c.Calendars = []Calendar{{Name: "fitting"}}
+			c.Profiles = []Profile{{Name: "me", Calendars: []string{"fiting"}}}
+		}, "unknown calendars"},
+		{"BookingURL", func(c *AppConfig) { c.BookingURL = "melanzana.com/book" }, "bookingUrl"},
+		{"SlotBookingURL", func(c *AppConfig) { c.SlotBookingURL = "melanzana.com/book?date={date}" }, "slotBookingUrl"},
+		{"TLSMode", func(c *AppConfig) { c.SMTPTLS = "ssl" }, "smtpTLS"},
+		{"Provider", func(c *AppConfig) { c.EmailProvider = "postmark" }, "unknown emailProvider"},
+		{"MailgunDomain", func(c *AppConfig) { c.EmailProvider = "mailgun"; c.EmailAPIKey = "key" }, "mailgunDomain"},
+		{"NoRecipients", func(c *AppConfig) { c.ToEmails = nil }, "no recipients"},
+		{"SubscriberPhone", func(c *AppConfig) { c.Subscribers = []Recipient{{Name: "grandma", Phone: "+15551234567"}} }, "smsAccountSid"},
+		{"Bucket", func(c *AppConfig) { c.StateStore = "gcs" }, "stateBucket"},
+		{"Timezone", func(c *AppConfig) { c.DisplayTimezones = []string{"Mars/Olympus"} }, "displayTimezones"},
+		{"ShutdownSummary", func(c *AppConfig) { c.EmailShutdownSummary = true }, "alertEmail"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			tt.modify(&config)
+			problems := configProblems(config)
+			if tt.want == "" {
+				if len(problems) > 0 {
+					t.Errorf("configProblems() = %v, want none", problems)
+				}
+				return
+			}
+			if len(problems) != 1 || !strings.Contains(problems[0], tt.want) {
+				t.Errorf("configProblems() = %v, want one problem mentioning %q", problems, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckConfigFileKeys(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.json")
+	typo := filepath.Join(dir, "typo.json")
+	os.WriteFile(valid, []byte("{\n  // comments are fine\n  \"monthsLookahead\": 4\n}"), 0644)
+	os.WriteFile(typo, []byte(`{"monthsLookahaed": 4}`), 0644)
+
+	if err := checkConfigFileKeys(valid); err != nil {
+		t.Errorf("checkConfigFileKeys(valid) error = %v", err)
+	}
+	if err := checkConfigFileKeys(typo); err == nil || !strings.Contains(err.Error(), "monthsLookahaed") {
+		t.Errorf("checkConfigFileKeys(typo) error = %v, want one naming the unknown key", err)
+	}
+}
+
+func TestWriteEffectiveConfig(t *testing.T) {
+	fromFile := defaultConfig()
+	fromFile.ConfigFile = "config.json"
+	fromFile.SMTPPassword = "hunter2"
+	fromFile.EmailAPIKey = "sg-key"
+	config := fromFile
+	config.MonthsLookahead = 6
+
+	var out strings.Builder
+	if err := writeEffectiveConfig(&out, config, fromFile); err != nil {
+		t.Fatalf("writeEffectiveConfig() error = %v", err)
+	}
+	text := out.String()
+
+	for _, secret := range []string{"hunter2", "sg-key"} {
+		if strings.Contains(text, secret) {
+			t.Errorf("writeEffectiveConfig() leaked secret %q:\n%s", secret, text)
+		}
+	}
+	for _, want := range []string{
+		"// set by a command-line flag\n  \"monthsLookahead\": 6",
+		"// set in config.json\n  \"smtpPassword\": \"REDACTED\"",
+		"\"smtpServer\": \"smtp.example.com\"",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("writeEffectiveConfig() missing %q:\n%s", want, text)
+		}
+	}
+
+	var parsed AppConfig
+	if err := json.Unmarshal(stripJSONComments([]byte(text)), &parsed); err != nil {
+		t.Errorf("output is not valid JSON once comments are removed: %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+package melanzana
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// configSources are the files declaring AppConfig and the types nested in
+// it. The example config takes its comments from their field comments, so
+// the example can't drift from the code.
+//
+//go:embed config.go features.go experiment.go polling.go retry.go campaign.go profile.go slo.go calendar.go source.go autobook.go
+var configSources embed.FS
+
+// configFieldDocs maps "Type.Field" to the field's comment.
+func configFieldDocs() (map[string]string, error) {
+	docs := make(map[string]string)
+	entries, err := configSources.ReadDir(".")
+	if err != nil {
+		return nil, err
+	}
+
+	fset := token.NewFileSet()
+	for _, entry := range entries {
+		src, err := configSources.ReadFile(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		file, err := parser.ParseFile(fset, entry.Name(), src, parser.ParseComments)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", entry.Name(), err)
+		}
+
+		ast.Inspect(file, func(n ast.Node) bool {
+			spec, ok := n.(*ast.TypeSpec)
+			if !ok {
+				return true
+			}
+			st, ok := spec.Type.(*ast.StructType)
+			if !ok {
+				return false
+			}
+			for _, field := range st.Fields.List {
+				text := field.Comment.Text()
+				if field.Doc != nil {
+					text = field.Doc.Text()
+				}
+				for _, name := range field.Names {
+					docs[spec.Name.Name+"."+name.Name] = strings.Join(strings.Fields(text), " ")
+				}
+			}
+			return false
+		})
+	}
+	return docs, nil
+}
+
+// writeConfigExample writes the default configuration as JSON with a comment
+// above every field.
+func writeConfigExample(w io.Writer) error {
+	docs, err := configFieldDocs()
+	if err != nil {
+		return fmt.Errorf("failed to read config documentation: %w", err)
+	}
+
+	var b strings.Builder
+	b.WriteString("// Example melanzana configuration with every option at its default.\n")
+	b.WriteString("// Generated by \"melanzana config example\"; comments are allowed in config files.\n")
+	if err := writeConfigObject(&b, reflect.ValueOf(defaultConfig()), "", docs); err != nil {
+		return err
+	}
+	b.WriteString("\n")
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// configEntry is one JSON field of a config struct.
+type configEntry struct {
+	name  string
+	doc   string
+	value reflect.Value
+}
+
+// configEntries lists the JSON fields of struct v, flattening embedded structs.
+func configEntries(v reflect.Value, docs map[string]string) []configEntry {
+	var entries []configEntry
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if field.Anonymous {
+			entries = append(entries, configEntries(v.Field(i), docs)...)
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		entries = append(entries, configEntry{name: name, doc: docs[t.Name()+"."+field.Name], value: v.Field(i)})
+	}
+	return entries
+}
+
+func writeConfigObject(b *strings.Builder, v reflect.Value, indent string, docs map[string]string) error {
+	entries := configEntries(v, docs)
+	inner := indent + "  "
+
+	b.WriteString("{\n")
+	for i, e := range entries {
+		if e.doc != "" {
+			b.WriteString(inner + "// " + e.doc + "\n")
+		}
+		b.WriteString(inner + fmt.Sprintf("%q", e.name) + ": ")
+
+		if e.value.Kind() == reflect.Struct && e.value.Type() != reflect.TypeOf(time.Time{}) {
+			if err := writeConfigObject(b, e.value, inner, docs); err != nil {
+				return err
+			}
+		} else {
+			value, err := configValueJSON(e.value)
+			if err != nil {
+				return fmt.Errorf("failed to encode %s: %w", e.name, err)
+			}
+			b.WriteString(value)
+		}
+
+		if i < len(entries)-1 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(indent + "}")
+	return nil
+}
+
+// configValueJSON encodes a leaf value, writing empty collections rather than null.
+func configValueJSON(v reflect.Value) (string, error) {
+	switch {
+	case v.Kind() == reflect.Slice && v.IsNil():
+		return "[]", nil
+	case v.Kind() == reflect.Map && v.IsNil():
+		return "{}", nil
+	}
+	data, err := json.Marshal(v.Interface())
+	return string(data), err
+}
+
+// stripJSONComments removes // and /* */ comments outside of strings so
+// config files may be annotated.
+func stripJSONComments(data []byte) []byte {
+	var out bytes.Buffer
+	inString := false
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case inString:
+			out.WriteByte(c)
+			if c == '\\' && i+1 < len(data) {
+				i++
+				out.WriteByte(data[i])
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+			out.WriteByte(c)
+		case c == '/' && i+1 < len(data) && data[i+1] == '/':
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+			if i < len(data) {
+				out.WriteByte('\n')
+			}
+		case c == '/' && i+1 < len(data) && data[i+1] == '*':
+			end := bytes.Index(data[i+2:], []byte("*/"))
+			if end < 0 {
+				i = len(data)
+			} else {
+				i += end + 3
+			}
+			out.WriteByte(' ')
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.Bytes()
+}
@@ -0,0 +1,77 @@
+package melanzana
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteConfigExample(t *testing.T) {
+	var out strings.Builder
+	if err := writeConfigExample(&out); err != nil {
+		t.Fatalf("writeConfigExample() error = %v", err)
+	}
+
+	var parsed AppConfig
+	if err := json.Unmarshal(stripJSONComments([]byte(out.String())), &parsed); err != nil {
+		t.Fatalf("example is not valid JSON once comments are removed: %v\n%s", err, out.String())
+	}
+	// The example writes empty collections as [] and {} rather than null.
+	want := defaultConfig()
+	want.DisplayTimezones = []string{}
+	want.Retry.Overrides = map[string]RetryPolicy{}
+	want.Campaigns = []Campaign{}
+	want.StateCodecs = []string{}
+	want.StateCodecsByStore = map[string][]string{}
+	want.StateAgeRecipients = []string{}
+	want.Profiles = []Profile{}
+	want.Subscribers = []Recipient{}
+	want.Calendars = []Calendar{}
+	want.AllowedWeekdays = []string{}
+	want.BlackoutDates = []string{}
+	want.AutoBooking.Weekdays = []string{}
+	want.AutoBooking.Calendars = []string{}
+	if !reflect.DeepEqual(parsed, want) {
+		t.Errorf("example parses to %+v, want defaults %+v", parsed, want)
+	}
+
+	// Every option must be documented so the example stays complete.
+	docs, err := configFieldDocs()
+	if err != nil {
+		t.Fatalf("configFieldDocs() error = %v", err)
+	}
+	var check func(v reflect.Value, path string)
+	check = func(v reflect.Value, path string) {
+		for _, e := range configEntries(v, docs) {
+			if e.doc == "" {
+				t.Errorf("config field %s%s has no comment", path, e.name)
+			}
+			if e.value.Kind() == reflect.Struct {
+				check(e.value, path+e.name+".")
+			}
+		}
+	}
+	check(reflect.ValueOf(defaultConfig()), "")
+}
+
+func TestStripJSONComments(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"LineComment", "{\n  // note\n  \"a\": 1\n}", "{\n  \n  \"a\": 1\n}"},
+		{"TrailingLineComment", `{"a": 1} // done`, `{"a": 1} `},
+		{"BlockComment", `{/* x */"a": 1}`, `{ "a": 1}`},
+		{"SlashesInString", `{"url": "https://example.com/*path*/"}`, `{"url": "https://example.com/*path*/"}`},
+		{"EscapedQuote", `{"a": "say \"//hi\""}`, `{"a": "say \"//hi\""}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(stripJSONComments([]byte(tt.in))); got != tt.want {
+				t.Errorf("stripJSONComments(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
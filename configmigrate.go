@@ -0,0 +1,117 @@
+package melanzana
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// configMigration upgrades a raw config document from one version to the next.
+type configMigration func(doc map[string]json.RawMessage) (warnings []string)
+
+// configMigrations[v] upgrades version v to v+1.
+var configMigrations = map[int]configMigration{
+	1: migrateConfigV1,
+}
+
+// legacyKeyRenames maps keys seen in version 1 files to their JSON names. The
+// command-line flag spellings were often copied into config files by mistake,
+// where they were silently ignored.
+var legacyKeyRenames = map[string]string{
+	"months":      "monthsLookahead",
+	"smtpUser":    "smtpUsername",
+	"smtpPass":    "smtpPassword",
+	"burstWindow": "burstWindowMinutes",
+	"probeDelay":  "probeDelaySeconds",
+}
+
+// migrateConfigV1 renames flag-style keys from version 1 files.
+func migrateConfigV1(doc map[string]json.RawMessage) []string {
+	var warnings []string
+	for _, oldKey := range sortedKeys(doc) {
+		newKey, ok := legacyKeyRenames[oldKey]
+		if !ok {
+			continue
+		}
+		if _, exists := doc[newKey]; exists {
+			warnings = append(warnings, fmt.Sprintf("%q is superseded by %q, which is already set; dropping %q", oldKey, newKey, oldKey))
+		} else {
+			doc[newKey] = doc[oldKey]
+			warnings = append(warnings, fmt.Sprintf("renamed %q to %q", oldKey, newKey))
+		}
+		delete(doc, oldKey)
+	}
+	return warnings
+}
+
+// migrateConfig upgrades a config file's contents to currentConfigVersion and
+// returns the resulting configuration along with warnings about renamed and
+// removed fields. Fields not present in the file keep their defaults.
+func migrateConfig(data []byte) (AppConfig, []string, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(stripJSONComments(data), &doc); err != nil {
+		return AppConfig{}, nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	version := 1
+	if raw, ok := doc["configVersion"]; ok {
+		if err := json.Unmarshal(raw, &version); err != nil {
+			return AppConfig{}, nil, fmt.Errorf("invalid configVersion: %w", err)
+		}
+	}
+	if version > currentConfigVersion {
+		return AppConfig{}, nil, fmt.Errorf("configVersion %d is newer than this build supports (%d)", version, currentConfigVersion)
+	}
+
+	var warnings []string
+	for v := version; v < currentConfigVersion; v++ {
+		if migrate, ok := configMigrations[v]; ok {
+			warnings = append(warnings, migrate(doc)...)
+		}
+	}
+
+	known := configJSONKeys()
+	for _, key := range sortedKeys(doc) {
+		if !known[key] {
+			warnings = append(warnings, fmt.Sprintf("removed unknown field %q", key))
+			delete(doc, key)
+		}
+	}
+
+	delete(doc, "configVersion")
+	cleaned, err := json.Marshal(doc)
+	if err != nil {
+		return AppConfig{}, nil, fmt.Errorf("failed to re-encode config: %w", err)
+	}
+
+	config := defaultConfig()
+	if err := json.Unmarshal(cleaned, &config); err != nil {
+		return AppConfig{}, nil, fmt.Errorf("failed to apply migrated config: %w", err)
+	}
+	config.ConfigVersion = currentConfigVersion
+	return config, warnings, nil
+}
+
+// configJSONKeys returns the top-level JSON keys AppConfig understands.
+func configJSONKeys() map[string]bool {
+	keys := make(map[string]bool)
+	t := reflect.TypeOf(AppConfig{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			keys[name] = true
+		}
+	}
+	return keys
+}
+
+func sortedKeys(doc map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(doc))
+	for k := range doc {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
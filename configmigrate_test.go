@@ -0,0 +1,99 @@
+package melanzana
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMigrateConfig(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        string
+		wantErr      bool
+		wantWarnings []string
+		check        func(t *testing.T, c AppConfig)
+	}{
+		{
+			name:         "RenamesLegacyKeys",
+			input:        `{"months": 6, "smtpUser": "alice", "smtpPassword": "secret"}`,
+			wantWarnings: []string{`renamed "months" to "monthsLookahead"`, `renamed "smtpUser" to "smtpUsername"`},
+			check: func(t *testing.T, c AppConfig) {
+				if c.MonthsLookahead != 6 || c.SMTPUsername != "alice" || c.SMTPPassword != "secret" {
+					t.Errorf("migrated config = %+v, want months 6, user alice, password secret", c)
+				}
+			},
+		},
+		{
+			name:         "ExistingKeyWins",
+			input:        `{"months": 6, "monthsLookahead": 4}`,
+			wantWarnings: []string{`dropping "months"`},
+			check: func(t *testing.T, c AppConfig) {
+				if c.MonthsLookahead != 4 {
+					t.Errorf("MonthsLookahead = %d, want 4", c.MonthsLookahead)
+				}
+			},
+		},
+		{
+			name:         "DropsUnknownKeys",
+			input:        `{"// note": "comment", "smtpServer": "mail.example.com"}`,
+			wantWarnings: []string{`removed unknown field "// note"`},
+			check: func(t *testing.T, c AppConfig) {
+				if c.SMTPServer != "mail.example.com" {
+					t.Errorf("SMTPServer = %q, want mail.example.com", c.SMTPServer)
+				}
+			},
+		},
+		{
+			name:  "FillsDefaults",
+			input: `{}`,
+			check: func(t *testing.T, c AppConfig) {
+				if c.DataFile != "seen_appointments.json" || c.SMTPPort != 587 {
+					t.Errorf("migrated config missing defaults: %+v", c)
+				}
+			},
+		},
+		{
+			name:  "CurrentVersionUnchanged",
+			input: `{"configVersion": 2, "months": 6}`,
+			// "months" is only renamed when migrating from version 1.
+			wantWarnings: []string{`removed unknown field "months"`},
+		},
+		{
+			name:    "NewerVersion",
+			input:   `{"configVersion": 99}`,
+			wantErr: true,
+		},
+		{
+			name:    "InvalidJSON",
+			input:   `{`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, warnings, err := migrateConfig([]byte(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("migrateConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if config.ConfigVersion != currentConfigVersion {
+				t.Errorf("ConfigVersion = %d, want %d", config.ConfigVersion, currentConfigVersion)
+			}
+			joined := strings.Join(warnings, "\n")
+			for _, want := range tt.wantWarnings {
+				if !strings.Contains(joined, want) {
+					t.Errorf("warnings missing %q:\n%s", want, joined)
+				}
+			}
+			if len(warnings) != len(tt.wantWarnings) {
+				t.Errorf("got %d warnings, want %d:\n%s", len(warnings), len(tt.wantWarnings), joined)
+			}
+			if tt.check != nil {
+				tt.check(t, config)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package melanzana
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"context"
+)
+
+// SessionStats counts what a daemon session has done, for the summary
+// printed on shutdown.
+type SessionStats struct {
+	Started           time.Time
+	Cycles            int
+	CycleErrors       int
+	SlotsObserved     map[string]bool // Distinct slots seen in any cycle
+	NewSlots          int
+	Changes           changeCounts // Changes found in the booking calendar, summed over watches
+	NotificationsSent int
+	SendErrors        int
+	StoreErrors       int
+	MonthsChecked     int          // Months fetched from the booking calendar
+	FetchErrors       int          // Months that couldn't be fetched
+	LastCycle         CycleSummary // Outcome of the most recent cycle
+}
+
+// session accumulates statistics for the running process.
+var session = newSessionStats(clock.Now())
+
+func newSessionStats(started time.Time) *SessionStats {
+	return &SessionStats{Started: started, SlotsObserved: map[string]bool{}}
+}
+
+// recordCycle counts one scraping cycle and its outcome.
+func (s *SessionStats) recordCycle(scraped, newAppointments []Appointment, err error) {
+	s.Cycles++
+	if err != nil {
+		s.CycleErrors++
+		return
+	}
+	for _, appt := range scraped {
+		s.SlotsObserved[appointmentKey(appt)] = true
+	}
+	s.NewSlots += len(newAppointments)
+}
+
+// recordChanges counts the changes found in the booking calendar.
+func (s *SessionStats) recordChanges(changes []Change) {
+	for _, c := range changes {
+		switch c.Kind {
+		case SlotAdded:
+			s.Changes.SlotsAdded++
+		case SlotRemoved:
+			s.Changes.SlotsRemoved++
+		case SpacesChanged:
+			s.Changes.SpacesChanged++
+		case WindowExtended:
+			s.Changes.WindowsExtended++
+		}
+	}
+}
+
+// summary renders the session statistics as of now.
+func (s *SessionStats) summary(now time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Uptime: %v (since %s)\n", now.Sub(s.Started).Round(time.Second), s.Started.Format(time.RFC3339))
+	fmt.Fprintf(&b, "Cycles run: %d (%d failed)\n", s.Cycles, s.CycleErrors)
+	fmt.Fprintf(&b, "Slots observed: %d distinct, %d new\n", len(s.SlotsObserved), s.NewSlots)
+	fmt.Fprintf(&b, "Calendar changes: %d slots added, %d removed, %d with spaces changed, %d booking windows extended\n",
+		s.Changes.SlotsAdded, s.Changes.SlotsRemoved, s.Changes.SpacesChanged, s.Changes.WindowsExtended)
+	fmt.Fprintf(&b, "Notifications sent: %d (%d failed)\n", s.NotificationsSent, s.SendErrors)
+	fmt.Fprintf(&b, "State store errors: %d", s.StoreErrors)
+	return b.String()
+}
+
+// runDaemon runs a cycle every interval, or as often as adaptive polling
+// decides, until ctx is done. Cancellation mid-cycle takes effect once the
+// cycle finishes, then a session summary is logged and, if configured,
+// emailed to the operator. Under
+// systemd with Type=notify, it reports readiness and each cycle's outcome,
+// and pets the watchdog if WatchdogSec is set.
+func runDaemon(ctx context.Context, config AppConfig, interval time.Duration) {
+	slog.Info("Running until interrupted", "interval", interval)
+	if err := sdNotify("READY=1\nSTATUS=Running the first check"); err != nil {
+		slog.Warn("Error reporting readiness to systemd", "err", err)
+	}
+	if watchdog := watchdogInterval(); watchdog > 0 {
+		maxCycle := time.Duration(config.MaxCycleMinutes) * time.Minute
+		slog.Info("Petting the systemd watchdog", "interval", watchdog, "maxCycle", maxCycle)
+		defer superviseWatchdog(watchdog, maxCycle)()
+	}
+	started := clock.Now()
+	runDaemonCycle(config)
+	next := clock.After(untilNextCycle(config, started, interval))
+	// ctx is checked before each wait, as a select picks at random among
+	// ready cases and a due cycle would otherwise run after cancellation.
+	for ctx.Err() == nil {
+		var followUpDue <-chan time.Time
+		if due, ok := followUps.nextDue(); ok {
+			followUpDue = clock.After(due.Sub(clock.Now()))
+		}
+		select {
+		case <-ctx.Done():
+		case <-followUpDue:
+			followUps.runDue(clock.Now())
+		case <-next:
+			started = clock.Now()
+			runDaemonCycle(config)
+			next = clock.After(untilNextCycle(config, started, interval))
+		}
+	}
+	slog.Info("Shutting down", "cause", context.Cause(ctx))
+	sdNotify("STOPPING=1")
+	sendShutdownSummary(config, session.summary(clock.Now()))
+}
+
+// untilNextCycle returns how long to wait, after a cycle that started at
+// started, before starting the next.
+func untilNextCycle(config AppConfig, started time.Time, interval time.Duration) time.Duration {
+	return max(nextPollInterval(config, started, interval)-clock.Now().Sub(started), 0)
+}
+
+// runDaemonCycle runs one of the daemon's cycles, tracking it for the
+// systemd watchdog and reporting its outcome as the service status.
+func runDaemonCycle(config AppConfig) {
+	runningCycle.begin(clock.Now())
+	runCycle(config)
+	runningCycle.end()
+	if session.Cycles == 0 {
+		return
+	}
+	if err := sdNotify("STATUS=" + cycleStatus(session.LastCycle)); err != nil {
+		slog.Warn("Error reporting status to systemd", "err", err)
+	}
+}
+
+// runCycle runs one scraping cycle, through the poll experiment if enabled,
+// and returns its exit code; exitOK if the experiment skipped the cycle, or
+// it was skipped because Cowlendar asked for no requests until later.
+func runCycle(config AppConfig) int {
+	if until := apiPacer.pausedUntil(); !until.IsZero() {
+		slog.Info("Cowlendar asked for no requests until later, skipping this check", "until", until.Format(time.RFC3339))
+		return exitOK
+	}
+	cycles := session.Cycles
+	if config.PollExperiment.enabled() {
+		runExperimentCycle(config)
+	} else {
+		runScrapingCycle(config)
+	}
+	if session.Cycles == cycles {
+		return exitOK
+	}
+	return session.LastCycle.ExitCode
+}
+
+// sendShutdownSummary logs the session summary and emails it to alertEmail
+// when emailShutdownSummary is set.
+func sendShutdownSummary(config AppConfig, summary string) {
+	slog.Info("Session summary", "summary", summary)
+	if !config.EmailShutdownSummary || config.AlertEmail == "" || config.ReadOnly {
+		return
+	}
+	host, _ := os.Hostname()
+	subject := "Melanzana scraper stopped on " + host
+	if err := sendEmailNotification(config, []string{config.AlertEmail}, subject, summary, ""); err != nil {
+		slog.Error("Error sending session summary", "recipient", config.AlertEmail, "err", err)
+	}
+}
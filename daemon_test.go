@@ -0,0 +1,34 @@
+package melanzana
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessionStatsSummary(t *testing.T) {
+	started := time.Date(2024, 5, 15, 9, 0, 0, 0, time.UTC)
+	stats := newSessionStats(started)
+
+	a := Appointment{Date: "2024-06-01", Time: "10:00 am – 10:30 am", Spaces: 1}
+	b := Appointment{Date: "2024-06-02", Time: "10:00 am – 10:30 am", Spaces: 1}
+	stats.recordCycle([]Appointment{a}, []Appointment{a}, nil)
+	stats.recordCycle([]Appointment{a, b}, []Appointment{b}, nil)
+	stats.recordCycle(nil, nil, errors.New("timeout"))
+	stats.NotificationsSent = 2
+	stats.SendErrors = 1
+
+	summary := stats.summary(started.Add(90 * time.Minute))
+	for _, want := range []string{
+		"Uptime: 1h30m0s",
+		"Cycles run: 3 (1 failed)",
+		"Slots observed: 2 distinct, 2 new",
+		"Notifications sent: 2 (1 failed)",
+		"State store errors: 0",
+	} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("summary() missing %q:\n%s", want, summary)
+		}
+	}
+}
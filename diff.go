@@ -0,0 +1,123 @@
+package melanzana
+
+import (
+	"sort"
+	"time"
+
+	"github.com/pashbylogan/melanzana/pkg/store"
+)
+
+// ChangeKind is the type of a Change.
+type ChangeKind string
+
+// Kinds of change between two snapshots of the booking calendar.
+const (
+	SlotAdded      ChangeKind = "slotAdded"      // Slot became bookable, for the first time or after being fully booked
+	SlotRemoved    ChangeKind = "slotRemoved"    // Slot was fully booked or withdrawn, or its day passed
+	SpacesChanged  ChangeKind = "spacesChanged"  // An open slot gained or lost spaces
+	WindowExtended ChangeKind = "windowExtended" // A calendar's max_date moved later
+)
+
+// Change is one difference between the previous snapshot of the booking
+// calendar and the current one. History, notifications and the session
+// statistics all work from these rather than comparing slots themselves.
+type Change struct {
+	Kind ChangeKind
+	// The slot as it is now; for SlotRemoved, only its date, time and
+	// calendar. Unset for WindowExtended.
+	Slot           Appointment
+	PreviousSpaces int                  // Spaces the slot had before; 0 for SlotAdded
+	Reopened       bool                 // SlotAdded only: the slot was known, but fully booked
+	Expired        bool                 // SlotRemoved only: the slot's day passed while it was open
+	Window         *bookingWindowChange // WindowExtended only
+}
+
+// changeCounts counts changes by kind.
+type changeCounts struct {
+	SlotsAdded      int `json:"slotsAdded"`
+	SlotsRemoved    int `json:"slotsRemoved"`
+	SpacesChanged   int `json:"spacesChanged"`
+	WindowsExtended int `json:"windowsExtended"`
+}
+
+// delta is the change in the slot's open spaces.
+func (c Change) delta() int {
+	return c.Slot.Spaces - c.PreviousSpaces
+}
+
+// snapshotSlot is what a Snapshot knows of a slot.
+type snapshotSlot struct {
+	Spaces int
+	Booked bool // Fully booked or withdrawn since it was last open
+}
+
+// Snapshot is the slots known as of one check. Fully booked slots can be
+// kept, marked booked, so that one opening again can be told from one that
+// is new.
+type Snapshot map[slotKey]snapshotSlot
+
+// newSnapshot returns a snapshot of appointments, all open. Of several
+// records of one slot, the last is kept.
+func newSnapshot(appointments []Appointment) Snapshot {
+	s := make(Snapshot, len(appointments))
+	for _, appt := range appointments {
+		s[slotKey{appt.Date, appt.Time, appt.Calendar}] = snapshotSlot{Spaces: appt.Spaces}
+	}
+	return s
+}
+
+// diffSnapshots compares the previous snapshot with the slots found at now,
+// and returns the changes: added slots and changed spaces in the order of
+// current, followed by removed slots in date order.
+func diffSnapshots(previous Snapshot, current []Appointment, now time.Time) []Change {
+	var changes []Change
+	found := make(map[slotKey]bool, len(current))
+
+	for _, appt := range current {
+		key := slotKey{appt.Date, appt.Time, appt.Calendar}
+		found[key] = true
+
+		prev, ok := previous[key]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Kind: SlotAdded, Slot: appt})
+		case prev.Booked:
+			changes = append(changes, Change{Kind: SlotAdded, Slot: appt, Reopened: true})
+		case appt.Spaces != prev.Spaces:
+			changes = append(changes, Change{Kind: SpacesChanged, Slot: appt, PreviousSpaces: prev.Spaces})
+		}
+	}
+
+	var removed []string
+	removedKeys := map[string]slotKey{}
+	for key, prev := range previous {
+		if !found[key] && !prev.Booked {
+			id := store.SlotID(key.date, key.time, key.calendar)
+			removed = append(removed, id)
+			removedKeys[id] = key
+		}
+	}
+	sort.Strings(removed)
+	today := now.In(sourceLocation()).Format("2006-01-02")
+	for _, id := range removed {
+		key := removedKeys[id]
+		changes = append(changes, Change{
+			Kind:           SlotRemoved,
+			Slot:           Appointment{Date: key.date, Time: key.time, Calendar: key.calendar},
+			PreviousSpaces: previous[key].Spaces,
+			Expired:        key.date < today,
+		})
+	}
+	return changes
+}
+
+// addedSlots returns the slots of the SlotAdded changes.
+func addedSlots(changes []Change) []Appointment {
+	var added []Appointment
+	for _, c := range changes {
+		if c.Kind == SlotAdded {
+			added = append(added, c.Slot)
+		}
+	}
+	return added
+}
@@ -0,0 +1,50 @@
+package melanzana
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	defer func(tz string) { sourceTimezone = tz }(sourceTimezone)
+	sourceTimezone = "America/Denver"
+	now := time.Date(2024, 6, 12, 18, 0, 0, 0, time.UTC)
+	slot := func(date string, spaces int) Appointment {
+		return Appointment{Date: date, Time: "10:00 am – 10:30 am", Spaces: spaces, IsAvailable: spaces > 0}
+	}
+	gone := func(date string) Appointment { return Appointment{Date: date, Time: "10:00 am – 10:30 am"} }
+
+	previous := newSnapshot([]Appointment{slot("2024-06-11", 1), slot("2024-06-13", 2), slot("2024-06-14", 2), slot("2024-06-15", 1), slot("2024-06-16", 3)})
+	booked := previous[slotKey{"2024-06-16", "10:00 am – 10:30 am", ""}]
+	booked.Booked = true
+	previous[slotKey{"2024-06-16", "10:00 am – 10:30 am", ""}] = booked
+
+	current := []Appointment{
+		slot("2024-06-17", 1), // new
+		slot("2024-06-13", 2), // unchanged
+		slot("2024-06-14", 3), // gained a space
+		slot("2024-06-16", 1), // reopened
+	}
+	want := []Change{
+		{Kind: SlotAdded, Slot: current[0]},
+		{Kind: SpacesChanged, Slot: current[2], PreviousSpaces: 2},
+		{Kind: SlotAdded, Slot: current[3], Reopened: true},
+		{Kind: SlotRemoved, Slot: gone("2024-06-11"), PreviousSpaces: 1, Expired: true},
+		{Kind: SlotRemoved, Slot: gone("2024-06-15"), PreviousSpaces: 1},
+	}
+	got := diffSnapshots(previous, current, now)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diffSnapshots() = %+v, want %+v", got, want)
+	}
+
+	if added := addedSlots(got); !reflect.DeepEqual(added, []Appointment{current[0], current[3]}) {
+		t.Errorf("addedSlots() = %+v, want the new and reopened slots", added)
+	}
+
+	var stats SessionStats
+	stats.recordChanges(append(got, Change{Kind: WindowExtended, Window: &bookingWindowChange{From: "2024-07-31", To: "2024-08-31"}}))
+	if want := (changeCounts{SlotsAdded: 2, SlotsRemoved: 2, SpacesChanged: 1, WindowsExtended: 1}); stats.Changes != want {
+		t.Errorf("recordChanges() counted %+v, want %+v", stats.Changes, want)
+	}
+}
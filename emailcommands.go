@@ -0,0 +1,350 @@
+package melanzana
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pashbylogan/melanzana/pkg/filter"
+)
+
+// Commands a recipient can email, usually as a reply to a notification.
+const (
+	commandPause       = "pause"
+	commandResume      = "resume"
+	commandWeekdays    = "weekdays"
+	commandUnsubscribe = "unsubscribe"
+)
+
+// commandPausePattern matches "pause 1w", "pause 3 days" and the like.
+var commandPausePattern = regexp.MustCompile(`^pause\s+(\d+)\s*(h|hours?|d|days?|w|weeks?)$`)
+
+// tokenPattern matches the unsubscribe tokens made by newUnsubscribeToken.
+var tokenPattern = regexp.MustCompile(`\b[0-9a-f]{32}\b`)
+
+// emailCommand is a change a recipient asked for by email.
+type emailCommand struct {
+	kind     string
+	pause    time.Duration // For commandPause
+	weekdays []string      // For commandWeekdays; empty means every day
+	token    string        // For commandUnsubscribe, if the message quoted one
+	tokens   []string      // Every token in the message, usually quoted from the notification replied to
+}
+
+// parseEmailCommand reads a command from text, ignoring case and
+// punctuation around it:
+//
+//	pause 1w, pause 3d, pause 12h   no notifications for that long
+//	resume                          notifications again
+//	only weekends, only weekdays    only slots on those days
+//	only sat sun                    only slots on the named days
+//	any day                         slots on every day
+//	unsubscribe [token]             no notifications at all
+func parseEmailCommand(text string) (emailCommand, bool) {
+	text = strings.ToLower(strings.Join(strings.Fields(strings.Trim(text, " \t.!\"'")), " "))
+	if m := commandPausePattern.FindStringSubmatch(text); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		unit := map[byte]time.Duration{'h': time.Hour, 'd': 24 * time.Hour, 'w': 7 * 24 * time.Hour}[m[2][0]]
+		return emailCommand{kind: commandPause, pause: time.Duration(n) * unit}, n > 0
+	}
+	switch text {
+	case "resume", "unpause":
+		return emailCommand{kind: commandResume}, true
+	case "only weekends":
+		return emailCommand{kind: commandWeekdays, weekdays: []string{"Sat", "Sun"}}, true
+	case "only weekdays":
+		return emailCommand{kind: commandWeekdays, weekdays: []string{"Mon", "Tue", "Wed", "Thu", "Fri"}}, true
+	case "any day", "every day", "all days":
+		return emailCommand{kind: commandWeekdays}, true
+	case "unsubscribe", "stop":
+		return emailCommand{kind: commandUnsubscribe}, true
+	}
+	if token, ok := strings.CutPrefix(text, "unsubscribe "); ok && !strings.Contains(token, " ") {
+		return emailCommand{kind: commandUnsubscribe, token: token}, true
+	}
+	if days, ok := strings.CutPrefix(text, "only "); ok {
+		var weekdays []string
+		for _, day := range strings.FieldsFunc(days, func(r rune) bool { return r == ' ' || r == ',' }) {
+			if day == "and" {
+				continue
+			}
+			if _, ok := filter.ParseWeekday(day); !ok {
+				return emailCommand{}, false
+			}
+			weekdays = append(weekdays, day)
+		}
+		return emailCommand{kind: commandWeekdays, weekdays: weekdays}, len(weekdays) > 0
+	}
+	return emailCommand{}, false
+}
+
+// apply changes r as the command asks, returning false if r should be
+// removed, and a sentence confirming the change.
+func (c emailCommand) apply(r *Recipient, now time.Time) (keep bool, confirmation string) {
+	switch c.kind {
+	case commandPause:
+		until := now.Add(c.pause)
+		r.PausedUntil = &until
+		return true, "Notifications are paused until " + until.In(sourceLocation()).Format("Mon Jan 2 3:04 pm") + "."
+	case commandResume:
+		r.PausedUntil = nil
+		return true, "Notifications are back on."
+	case commandWeekdays:
+		r.Weekdays = c.weekdays
+		if len(c.weekdays) == 0 {
+			return true, "You'll hear about slots on every day."
+		}
+		return true, "You'll only hear about slots on " + strings.Join(c.weekdays, ", ") + "."
+	default:
+		return false, "You're unsubscribed and won't get any more notifications."
+	}
+}
+
+// processEmailCommands reads the unseen messages in the IMAP mailbox, applies
+// the commands they contain to their senders' subscriptions, and marks them
+// seen. Subscriptions in the recipients file and those added through the
+// API can be changed; those in the config file can't.
+func processEmailCommands(config AppConfig) error {
+	client, err := newIMAPClient(config.IMAPServer, config.IMAPUsername, config.IMAPPassword, config.IMAPMailbox)
+	if err != nil {
+		return err
+	}
+	defer client.close()
+
+	uids, err := client.unseen()
+	if err != nil {
+		return err
+	}
+	for _, uid := range uids {
+		raw, err := client.fetch(uid)
+		if err != nil {
+			return err
+		}
+		if from, cmd, ok := readEmailCommand(raw); ok {
+			runEmailCommand(config, from, cmd)
+		} else {
+			slog.Info("Ignoring email without a command", "from", from)
+		}
+		if err := client.markSeen(uid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readEmailCommand returns a message's sender and the command it holds:
+// the first line of the reply above any quoted text, else the subject. The
+// command carries the tokens found anywhere in the message.
+func readEmailCommand(raw []byte) (from string, cmd emailCommand, ok bool) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return "", emailCommand{}, false
+	}
+	if addr, err := mail.ParseAddress(msg.Header.Get("From")); err == nil {
+		from = addr.Address
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+	body := plainTextBody(msg)
+	tokens := tokenPattern.FindAllString(strings.ToLower(subject+"\n"+body), -1)
+
+	if line := firstReplyLine(body); line != "" {
+		if cmd, ok := parseEmailCommand(line); ok {
+			cmd.tokens = tokens
+			return from, cmd, true
+		}
+	}
+	for {
+		trimmed := strings.TrimSpace(subject)
+		lower := strings.ToLower(trimmed)
+		if !strings.HasPrefix(lower, "re:") && !strings.HasPrefix(lower, "fwd:") {
+			break
+		}
+		subject = trimmed[strings.Index(trimmed, ":")+1:]
+	}
+	cmd, ok = parseEmailCommand(subject)
+	cmd.tokens = tokens
+	return from, cmd, ok
+}
+
+// plainTextBody returns the text/plain content of msg, looking inside
+// multipart messages.
+func plainTextBody(msg *mail.Message) string {
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType == "text/plain" {
+		body, _ := io.ReadAll(io.LimitReader(transferDecoded(msg.Header.Get("Content-Transfer-Encoding"), msg.Body), 64<<10))
+		return string(body)
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return ""
+	}
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := parts.NextPart()
+		if err != nil {
+			return ""
+		}
+		if partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type")); partType == "text/plain" {
+			body, _ := io.ReadAll(io.LimitReader(transferDecoded(part.Header.Get("Content-Transfer-Encoding"), part), 64<<10))
+			return string(body)
+		}
+	}
+}
+
+// transferDecoded undoes a body's Content-Transfer-Encoding, which mail
+// clients use for replies with long lines or non-ASCII text.
+func transferDecoded(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r)
+	}
+	return r
+}
+
+// firstReplyLine returns the first non-blank line written above any quoted text.
+func firstReplyLine(body string) string {
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, ">") {
+			return ""
+		}
+		return line
+	}
+	return ""
+}
+
+// runEmailCommand applies cmd to the subscription of the address it came
+// from, or to the recipient holding the unsubscribe token it quoted, and
+// confirms the change to the sender. The From header is easily forged, so
+// a command is only applied to the sender's subscription if the message
+// also holds their unsubscribe token, as a reply quoting the notification
+// does.
+func runEmailCommand(config AppConfig, from string, cmd emailCommand) {
+	if cmd.token != "" {
+		email, err := unsubscribeRecipient(config.RecipientsFile, cmd.token)
+		if err != nil {
+			slog.Warn("Error unsubscribing by email", "from", from, "err", err)
+			return
+		}
+		slog.Info("Unsubscribed by email", "recipient", email)
+		confirmEmailCommand(config, email, "You're unsubscribed and won't get any more notifications.")
+		return
+	}
+
+	match := func(r Recipient) bool {
+		return strings.EqualFold(r.Email, from) && r.UnsubscribeToken != "" && slices.Contains(cmd.tokens, r.UnsubscribeToken)
+	}
+	found, confirmation, err := changeSubscription(config, match, cmd)
+	switch {
+	case err != nil:
+		slog.Error("Error applying emailed command", "from", from, "command", cmd.kind, "err", err)
+	case !found:
+		slog.Warn("Ignoring emailed command without the sender's token, or whose subscription can't be changed by email", "from", from, "command", cmd.kind)
+	default:
+		slog.Info("Applied emailed command", "from", from, "command", cmd.kind)
+		confirmEmailCommand(config, from, confirmation)
+	}
+}
+
+// changeSubscription applies cmd to the first recipients file entry, or
+// failing that the first subscriber added through the API, that match
+// picks. It reports whether there was one and returns the confirmation.
+func changeSubscription(config AppConfig, match func(Recipient) bool, cmd emailCommand) (found bool, confirmation string, err error) {
+	change := func(r *Recipient) bool {
+		keep, text := cmd.apply(r, clock.Now())
+		confirmation = text
+		return keep
+	}
+	found, err = changeRecipientsFile(config.RecipientsFile, match, change)
+	if err == nil && !found {
+		found, err = changeManagedSubscriber(config, match, change)
+	}
+	return found, confirmation, err
+}
+
+// changeRecipientsFile applies change to the entry match picks in the
+// recipients file, removing it if change returns false, and reports whether
+// there was one.
+func changeRecipientsFile(path string, match func(Recipient) bool, change func(*Recipient) bool) (bool, error) {
+	if path == "" {
+		return false, nil
+	}
+	recipients, err := readRecipients(path)
+	if err != nil {
+		return false, err
+	}
+	i := slices.IndexFunc(recipients, match)
+	if i < 0 {
+		return false, nil
+	}
+	if !change(&recipients[i]) {
+		recipients = slices.Delete(recipients, i, i+1)
+	}
+	return true, saveRecipients(recipients, path)
+}
+
+// changeManagedSubscriber is changeRecipientsFile for the subscribers added
+// through the API.
+func changeManagedSubscriber(config AppConfig, match func(Recipient) bool, change func(*Recipient) bool) (bool, error) {
+	if config.SubscriberAPIToken == "" {
+		return false, nil
+	}
+	store, err := newStore(config)
+	if err != nil {
+		return false, err
+	}
+	var found bool
+	err = updateManagedSubscribers(store, func(subscribers []managedSubscriber) ([]managedSubscriber, error) {
+		i := slices.IndexFunc(subscribers, func(s managedSubscriber) bool { return match(s.Recipient) })
+		if found = i >= 0; !found {
+			return subscribers, nil
+		}
+		if !change(&subscribers[i].Recipient) {
+			subscribers = slices.Delete(subscribers, i, i+1)
+		}
+		return subscribers, nil
+	})
+	return found, err
+}
+
+// confirmEmailCommand tells the sender what changed.
+func confirmEmailCommand(config AppConfig, to, confirmation string) {
+	if err := sendEmailNotification(config, []string{to}, "Melanzana notifications updated", confirmation, ""); err != nil {
+		slog.Warn("Error confirming emailed command", "recipient", to, "err", err)
+	}
+}
+
+// pollEmailCommands processes emailed commands if an IMAP server is
+// configured. Failures are logged; they don't fail the cycle.
+func pollEmailCommands(config AppConfig) {
+	if config.IMAPServer == "" {
+		return
+	}
+	if config.ReadOnly || config.DryRun {
+		slog.Info("Not reading emailed commands without writing state", "server", config.IMAPServer)
+		return
+	}
+	if err := processEmailCommands(config); err != nil {
+		slog.Warn("Error reading emailed commands", "server", config.IMAPServer, "err", fmt.Errorf("%w: %w", errNotify, err))
+	}
+}
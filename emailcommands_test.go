@@ -0,0 +1,164 @@
+package melanzana
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseEmailCommand(t *testing.T) {
+	tests := []struct {
+		text string
+		want emailCommand
+		ok   bool
+	}{
+		{"pause 1w", emailCommand{kind: commandPause, pause: 7 * 24 * time.Hour}, true},
+		{"Pause 3 days.", emailCommand{kind: commandPause, pause: 3 * 24 * time.Hour}, true},
+		{"pause 12h", emailCommand{kind: commandPause, pause: 12 * time.Hour}, true},
+		{"pause 0d", emailCommand{kind: commandPause}, false},
+		{"pause forever", emailCommand{}, false},
+		{"Resume!", emailCommand{kind: commandResume}, true},
+		{"only weekends", emailCommand{kind: commandWeekdays, weekdays: []string{"Sat", "Sun"}}, true},
+		{"Only Sat and Sun", emailCommand{kind: commandWeekdays, weekdays: []string{"sat", "sun"}}, true},
+		{"only someday", emailCommand{}, false},
+		{"any day", emailCommand{kind: commandWeekdays}, true},
+		{"UNSUBSCRIBE", emailCommand{kind: commandUnsubscribe}, true},
+		{"unsubscribe abc123", emailCommand{kind: commandUnsubscribe, token: "abc123"}, true},
+		{"thanks, see you there", emailCommand{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseEmailCommand(tt.text)
+		if ok != tt.ok || (ok && (got.kind != tt.want.kind || got.pause != tt.want.pause || got.token != tt.want.token || !slices.Equal(got.weekdays, tt.want.weekdays))) {
+			t.Errorf("parseEmailCommand(%q) = %+v, %v; want %+v, %v", tt.text, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestReadEmailCommand(t *testing.T) {
+	tests := []struct {
+		name   string
+		raw    string
+		want   string
+		tokens []string
+	}{
+		{
+			name: "reply line above the quote",
+			raw:  "From: Grandma <Grandma@Example.com>\r\nSubject: Re: New slots\r\n\r\n\r\npause 1w\r\n\r\n> New slots on Saturday\r\n",
+			want: commandPause,
+		},
+		{
+			name: "subject when the body has none",
+			raw:  "From: grandma@example.com\r\nSubject: RE: Fwd: only weekends\r\n\r\n> quoted\r\n",
+			want: commandWeekdays,
+		},
+		{
+			name: "multipart",
+			raw: "From: grandma@example.com\r\nSubject: Re: New slots\r\nContent-Type: multipart/alternative; boundary=b\r\n\r\n" +
+				"--b\r\nContent-Type: text/plain\r\n\r\nunsubscribe\r\n--b\r\nContent-Type: text/html\r\n\r\n<p>unsubscribe</p>\r\n--b--\r\n",
+			want: commandUnsubscribe,
+		},
+		{
+			name: "no command",
+			raw:  "From: grandma@example.com\r\nSubject: Re: New slots\r\n\r\nThanks!\r\n",
+		},
+		{
+			name: "token quoted with a soft line break",
+			raw: "From: grandma@example.com\r\nSubject: Re: New slots\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n" +
+				"pause 3d\r\n\r\n> To stop these emails, reply with the subject \"unsubscribe 0123456789abcdef=\r\n0123456789abcdef\".\r\n",
+			want:   commandPause,
+			tokens: []string{"0123456789abcdef0123456789abcdef"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, cmd, ok := readEmailCommand([]byte(tt.raw))
+			if !strings.EqualFold(from, "grandma@example.com") {
+				t.Errorf("from = %q, want grandma@example.com", from)
+			}
+			if ok != (tt.want != "") || cmd.kind != tt.want {
+				t.Errorf("command = %q, %v; want %q", cmd.kind, ok, tt.want)
+			}
+			if !slices.Equal(cmd.tokens, tt.tokens) {
+				t.Errorf("tokens = %v, want %v", cmd.tokens, tt.tokens)
+			}
+		})
+	}
+}
+
+func TestProcessEmailCommands(t *testing.T) {
+	now := time.Date(2099, 7, 1, 12, 0, 0, 0, time.UTC)
+	fixClock(t, now)
+	var confirmations []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body strings.Builder
+		r.Write(&body)
+		confirmations = append(confirmations, body.String())
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+	defer func(url string) { sendGridURL = url }(sendGridURL)
+	sendGridURL = server.URL
+
+	dir := t.TempDir()
+	config := AppConfig{
+		EmailProvider:  "sendgrid",
+		EmailAPIKey:    "key",
+		FromEmail:      "from@example.com",
+		RecipientsFile: filepath.Join(dir, "recipients.json"),
+		IMAPServer:     "imap.example.com:993",
+		IMAPUsername:   "from@example.com",
+		IMAPPassword:   "secret",
+		IMAPMailbox:    "INBOX",
+	}
+	grandma, uncle := strings.Repeat("a", 32), strings.Repeat("b", 32)
+	err := saveRecipients([]Recipient{
+		{Email: "grandma@example.com", UnsubscribeToken: grandma},
+		{Email: "uncle@example.com", UnsubscribeToken: uncle},
+	}, config.RecipientsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := serveIMAP(t, map[string]string{
+		"1": "From: Grandma@example.com\r\nSubject: Re: New slots\r\n\r\npause 1w\r\n\r\n> reply with the subject \"unsubscribe " + grandma + "\"\r\n",
+		"2": "From: uncle@example.com\r\nSubject: unsubscribe\r\n\r\n> unsubscribe " + uncle + "\r\n",
+		"3": "From: stranger@example.com\r\nSubject: only weekends\r\n\r\n",
+		// Forged as from grandma, without her token, or quoting uncle's.
+		"4": "From: grandma@example.com\r\nSubject: unsubscribe\r\n\r\n",
+		"5": "From: grandma@example.com\r\nSubject: only weekends\r\n\r\n> unsubscribe " + uncle + "\r\n",
+	})
+
+	if err := processEmailCommands(config); err != nil {
+		t.Fatalf("processEmailCommands() error = %v", err)
+	}
+	var marked []string
+	for uid := range seen {
+		marked = append(marked, uid)
+	}
+	if !slices.Equal(marked, []string{"1", "2", "3", "4", "5"}) {
+		t.Errorf("messages marked seen = %v, want all of them", marked)
+	}
+
+	recipients, err := readRecipients(config.RecipientsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recipients) != 1 || recipients[0].Email != "grandma@example.com" || len(recipients[0].Weekdays) != 0 {
+		t.Fatalf("recipients = %+v, want only grandma, with no forged changes", recipients)
+	}
+	if until := recipients[0].PausedUntil; until == nil || !until.Equal(now.Add(7*24*time.Hour)) {
+		t.Errorf("pausedUntil = %v, want a week from now", until)
+	}
+	if len(confirmations) != 2 {
+		t.Errorf("sent %d confirmations, want 2 (none to the stranger or for the forgeries)", len(confirmations))
+	}
+
+	fixClock(t, now.Add(24*time.Hour))
+	_, _, undelivered := deliverNotification(config, Notification{Appointments: []Appointment{{Date: "2099-07-05", Spaces: 1}}}, RenderOptions{})
+	if len(confirmations) != 2 || len(undelivered) != 0 {
+		t.Errorf("paused recipient was notified (%d messages, undelivered %+v)", len(confirmations)-2, undelivered)
+	}
+}
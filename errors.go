@@ -0,0 +1,57 @@
+package melanzana
+
+import (
+	"errors"
+	"net/http"
+	"net/textproto"
+
+	"github.com/pashbylogan/melanzana/pkg/cowlendar"
+)
+
+// Error kinds, wrapped around the underlying error with
+// fmt.Errorf("%w: %w", kind, err) so callers can tell with errors.Is what
+// failed without matching messages.
+var (
+	// errInvalidConfig marks cycle errors caused by the configuration rather
+	// than by the booking calendar.
+	errInvalidConfig = errors.New("invalid configuration")
+	errFetch         = errors.New("fetching availability failed")
+	errParse         = errors.New("unexpected response")
+	errNotify        = errors.New("sending notification failed")
+	errStore         = errors.New("state store failed")
+)
+
+// errorCategory is what it takes for a failure to go away.
+type errorCategory string
+
+const (
+	categoryTransient errorCategory = "transient" // Waiting: network errors, timeouts, rate limits, server errors
+	categoryConfig    errorCategory = "config"    // Changing the configuration, e.g. an unknown calendar or rejected credentials
+	categoryPermanent errorCategory = "permanent" // Changing the scraper, e.g. for a response it doesn't understand
+)
+
+// categorize returns err's category, or "" for nil. Errors not known to
+// need a change are assumed to be transient.
+func categorize(err error) errorCategory {
+	var status *cowlendar.StatusError
+	var reply *textproto.Error
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, errInvalidConfig):
+		return categoryConfig
+	case errors.Is(err, errParse):
+		return categoryPermanent
+	case errors.As(err, &status):
+		switch {
+		case status.StatusCode == http.StatusNotFound:
+			return categoryConfig
+		case status.StatusCode < 500 && status.StatusCode != http.StatusTooManyRequests:
+			return categoryPermanent
+		}
+	case errors.As(err, &reply) && reply.Code >= 500:
+		// The mail server refused the credentials, sender or a recipient.
+		return categoryConfig
+	}
+	return categoryTransient
+}
@@ -0,0 +1,75 @@
+package melanzana
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pashbylogan/melanzana/pkg/cowlendar"
+)
+
+func TestCategorize(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want errorCategory
+	}{
+		{"Nil", nil, ""},
+		{"Network", fmt.Errorf("%w: %w", errFetch, errors.New("connection refused")), categoryTransient},
+		{"ServerError", fmt.Errorf("%w: %w", errFetch, &cowlendar.StatusError{StatusCode: 503}), categoryTransient},
+		{"RateLimited", fmt.Errorf("%w: %w", errFetch, &cowlendar.StatusError{StatusCode: 429}), categoryTransient},
+		{"UnknownCalendar", fmt.Errorf("%w: %w", errFetch, &cowlendar.StatusError{StatusCode: 404}), categoryConfig},
+		{"Forbidden", fmt.Errorf("%w: %w", errFetch, &cowlendar.StatusError{StatusCode: 403}), categoryPermanent},
+		{"SchemaDrift", fmt.Errorf("%w: %w", errFetch, fmt.Errorf("%w: %w", errParse, cowlendar.ErrMalformed)), categoryPermanent},
+		{"InvalidConfig", fmt.Errorf("%w: %w", errInvalidConfig, errors.New("unknown state store")), categoryConfig},
+		{"AuthRejected", fmt.Errorf("%w: %w", errNotify, &textproto.Error{Code: 535, Msg: "authentication failed"}), categoryConfig},
+		{"MailServerBusy", fmt.Errorf("%w: %w", errNotify, &textproto.Error{Code: 421, Msg: "try again later"}), categoryTransient},
+		{"StoreUnreachable", fmt.Errorf("%w: %w", errStore, errors.New("timeout")), categoryTransient},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := categorize(tt.err); got != tt.want {
+				t.Errorf("categorize(%v) = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorKinds(t *testing.T) {
+	defer func(client *http.Client, tz string) { apiClient, sourceTimezone = client, tz }(apiClient, sourceTimezone)
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "2025-03.json"), []byte(`{"slots": []}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	apiClient = &http.Client{Transport: replayTransport{&replaySnapshot{Dir: dir}}}
+
+	_, err := fetchAvailability(Calendar{CalendarID: "cal"}, 2025, 3)
+	if !errors.Is(err, errParse) || categorize(err) != categoryPermanent {
+		t.Errorf("fetchAvailability() error = %v (%s), want a permanent errParse", err, categorize(err))
+	}
+
+	var alerted error
+	store := newResilientStore(&flakyStore{down: true}, filepath.Join(dir, "spool.json"), RetryPolicy{MaxAttempts: 1}, func(err error) { alerted = err })
+	store.Load()
+	if !errors.Is(alerted, errStore) {
+		t.Errorf("store alert error = %v, want errStore", alerted)
+	}
+
+	// Only settings runWatch can't work with are configuration errors.
+	config := defaultConfig()
+	config.StateStore = "ftp"
+	if _, _, err := runWatch(config, "", nil, nil, RenderOptions{}); !errors.Is(err, errInvalidConfig) {
+		t.Errorf("runWatch() with an unknown state store error = %v, want errInvalidConfig", err)
+	}
+	config = defaultConfig()
+	config.DataFile, config.HistoryFile, config.SnapshotFile = filepath.Join(dir, "seen.json"), filepath.Join(dir, "history.jsonl"), filepath.Join(dir, "snapshot.json")
+	config.StoreSpoolFile, config.NotifyJournalFile, config.SubscribersFile = filepath.Join(dir, "spool.json"), filepath.Join(dir, "journal.jsonl"), filepath.Join(dir, "subscribers.json")
+	config.AllowedWeekdays = []string{"Caturday"}
+	if _, _, err := runWatch(config, "", nil, nil, RenderOptions{}); !errors.Is(err, errInvalidConfig) {
+		t.Errorf("runWatch() with an invalid filter error = %v, want errInvalidConfig", err)
+	}
+}
@@ -0,0 +1,216 @@
+package melanzana
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// Poll experiment arms. Days alternate between them.
+const (
+	armFast = "fast"
+	armSlow = "slow"
+)
+
+// PollExperimentConfig configures an A/B comparison of polling intervals.
+// Cron should run the scraper at the fast interval; on slow days runs are
+// skipped until the slow interval has elapsed since the previous check.
+type PollExperimentConfig struct {
+	FastIntervalMinutes int    `json:"fastIntervalMinutes"` // Polling interval on fast days; schedule cron at this interval
+	SlowIntervalMinutes int    `json:"slowIntervalMinutes"` // Polling interval on slow days
+	HistoryFile         string `json:"historyFile"`         // Where checks and outcomes are recorded
+}
+
+func (c PollExperimentConfig) enabled() bool {
+	return c.FastIntervalMinutes > 0 && c.SlowIntervalMinutes > 0
+}
+
+// arm returns the experiment arm and polling interval for the day containing now.
+func (c PollExperimentConfig) arm(now time.Time) (string, time.Duration) {
+	y, m, d := now.Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / 86400
+	if day%2 == 0 {
+		return armFast, time.Duration(c.FastIntervalMinutes) * time.Minute
+	}
+	return armSlow, time.Duration(c.SlowIntervalMinutes) * time.Minute
+}
+
+// PollHistory is the record of checks made while the experiment runs.
+type PollHistory struct {
+	Checks []PollCheck `json:"checks"`
+}
+
+// PollCheck records one scrape and what it found.
+type PollCheck struct {
+	At              time.Time `json:"at"`
+	Arm             string    `json:"arm"`
+	IntervalMinutes int       `json:"intervalMinutes"`
+	GapSeconds      int       `json:"gapSeconds"` // Time since the previous check; an upper bound on detection latency
+	NewSlots        []string  `json:"newSlots"`
+	FollowedUp      bool      `json:"followedUp"` // Whether a later check has looked for NewSlots again
+	Vanished        int       `json:"vanished"`   // NewSlots that were gone by the next check
+}
+
+// loadPollHistory reads the poll history from path, returning empty history if the file doesn't exist.
+func loadPollHistory(path string) (*PollHistory, error) {
+	history := &PollHistory{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return history, nil
+		}
+		return nil, fmt.Errorf("failed to read poll history %s: %w", path, err)
+	}
+	if len(data) == 0 {
+		return history, nil
+	}
+	if err := json.Unmarshal(data, history); err != nil {
+		return nil, fmt.Errorf("failed to parse poll history %s: %w", path, err)
+	}
+	return history, nil
+}
+
+// savePollHistory writes the poll history to path.
+func savePollHistory(history *PollHistory, path string) error {
+	data, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal poll history: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write poll history %s: %w", path, err)
+	}
+	return nil
+}
+
+// due reports whether a check should run now given the arm's interval. A
+// minute of slack absorbs cron start-time jitter.
+func (h *PollHistory) due(now time.Time, interval time.Duration) bool {
+	if len(h.Checks) == 0 {
+		return true
+	}
+	return now.Sub(h.Checks[len(h.Checks)-1].At)+time.Minute >= interval
+}
+
+// record appends a check. Slots first found by the previous check that are
+// missing from this scrape are counted as vanished on that check.
+func (h *PollHistory) record(now time.Time, arm string, interval time.Duration, scraped, newAppointments []Appointment) {
+	check := PollCheck{At: now, Arm: arm, IntervalMinutes: int(interval / time.Minute), NewSlots: []string{}}
+
+	if len(h.Checks) > 0 {
+		prev := &h.Checks[len(h.Checks)-1]
+		check.GapSeconds = int(now.Sub(prev.At) / time.Second)
+
+		current := make(map[string]bool)
+		for _, appt := range scraped {
+			current[appointmentKey(appt)] = true
+		}
+		for _, key := range prev.NewSlots {
+			if !current[key] {
+				prev.Vanished++
+			}
+		}
+		prev.FollowedUp = true
+	}
+
+	for _, appt := range newAppointments {
+		check.NewSlots = append(check.NewSlots, appointmentKey(appt))
+	}
+	h.Checks = append(h.Checks, check)
+}
+
+// runExperimentCycle runs a scraping cycle if one is due for today's arm and
+// records the outcome.
+func runExperimentCycle(config AppConfig) {
+	exp := config.PollExperiment
+	history, err := loadPollHistory(exp.HistoryFile)
+	if err != nil {
+		slog.Warn("Error loading poll history, starting fresh", "err", err)
+		history = &PollHistory{}
+	}
+
+	now := clock.Now()
+	arm, interval := exp.arm(now)
+	if !history.due(now, interval) {
+		slog.Info("Poll experiment: not due, skipping", "arm", arm, "interval", interval,
+			"sinceLastCheck", now.Sub(history.Checks[len(history.Checks)-1].At).Round(time.Second))
+		return
+	}
+	slog.Info("Poll experiment", "arm", arm, "interval", interval)
+
+	scraped, newAppointments, err := runScrapingCycle(config)
+	if err != nil {
+		// Failed checks aren't recorded; the next check's gap covers the outage.
+		return
+	}
+
+	history.record(now, arm, interval, scraped, newAppointments)
+	if config.ReadOnly {
+		slog.Info("Read-only mode: not saving poll history", "file", exp.HistoryFile)
+	} else if err := savePollHistory(history, exp.HistoryFile); err != nil {
+		slog.Error("Error saving poll history", "err", err)
+	}
+}
+
+// armStats aggregates the outcomes of one experiment arm.
+type armStats struct {
+	interval   int
+	days       map[string]bool
+	checks     int
+	newSlots   int
+	latencySum int // Sum over new slots of the gap since the previous check, in seconds
+	followed   int // New slots re-checked by a later check
+	vanished   int
+}
+
+// writePollReport summarises poll history per arm: how many slots each arm
+// found per day, the bound on how late they were detected, and how many were
+// gone by the next check (slots a slower poll is likely to miss entirely).
+func writePollReport(w io.Writer, history *PollHistory) {
+	stats := map[string]*armStats{}
+	for _, check := range history.Checks {
+		s, ok := stats[check.Arm]
+		if !ok {
+			s = &armStats{days: map[string]bool{}}
+			stats[check.Arm] = s
+		}
+		s.interval = check.IntervalMinutes
+		s.days[check.At.Format("2006-01-02")] = true
+		s.checks++
+		s.newSlots += len(check.NewSlots)
+		s.latencySum += check.GapSeconds * len(check.NewSlots)
+		if check.FollowedUp {
+			s.followed += len(check.NewSlots)
+			s.vanished += check.Vanished
+		}
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ARM\tINTERVAL\tDAYS\tCHECKS\tNEW SLOTS\tSLOTS/DAY\tAVG LATENCY BOUND\tVANISHED BY NEXT CHECK")
+	for _, arm := range []string{armFast, armSlow} {
+		s, ok := stats[arm]
+		if !ok {
+			fmt.Fprintf(tw, "%s\t-\t0\t0\t0\t-\t-\t-\n", arm)
+			continue
+		}
+		latency := "-"
+		if s.newSlots > 0 {
+			latency = (time.Duration(s.latencySum/s.newSlots) * time.Second).String()
+		}
+		vanished := "-"
+		if s.followed > 0 {
+			vanished = fmt.Sprintf("%d/%d", s.vanished, s.followed)
+		}
+		fmt.Fprintf(tw, "%s\t%dm\t%d\t%d\t%d\t%.1f\t%s\t%s\n",
+			arm, s.interval, len(s.days), s.checks, s.newSlots,
+			float64(s.newSlots)/float64(len(s.days)), latency, vanished)
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "If SLOTS/DAY is similar for both arms and few slots vanish between checks,")
+	fmt.Fprintln(w, "the slow interval catches as many bookable slots as the fast one.")
+}
@@ -0,0 +1,83 @@
+package melanzana
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPollExperimentArm(t *testing.T) {
+	exp := PollExperimentConfig{FastIntervalMinutes: 5, SlowIntervalMinutes: 30}
+	day := time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+
+	arm1, _ := exp.arm(day)
+	arm2, interval2 := exp.arm(day.AddDate(0, 0, 1))
+	arm3, _ := exp.arm(day.AddDate(0, 0, 2))
+
+	if arm1 == arm2 || arm1 != arm3 {
+		t.Errorf("arms for consecutive days = %s, %s, %s; want alternating", arm1, arm2, arm3)
+	}
+	if want := map[string]time.Duration{armFast: 5 * time.Minute, armSlow: 30 * time.Minute}[arm2]; interval2 != want {
+		t.Errorf("interval for %s arm = %v, want %v", arm2, interval2, want)
+	}
+}
+
+func TestPollHistoryDue(t *testing.T) {
+	base := time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+	history := &PollHistory{}
+
+	if !history.due(base, 30*time.Minute) {
+		t.Errorf("due() with no checks = false, want true")
+	}
+
+	history.Checks = append(history.Checks, PollCheck{At: base})
+	tests := []struct {
+		elapsed time.Duration
+		want    bool
+	}{
+		{5 * time.Minute, false},
+		{29*time.Minute + 30*time.Second, true}, // within cron jitter slack
+		{30 * time.Minute, true},
+	}
+	for _, tt := range tests {
+		if got := history.due(base.Add(tt.elapsed), 30*time.Minute); got != tt.want {
+			t.Errorf("due() after %v = %v, want %v", tt.elapsed, got, tt.want)
+		}
+	}
+}
+
+func TestPollHistoryRecordAndReport(t *testing.T) {
+	base := time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+	a := Appointment{Date: "2024-06-01", Time: "10:00 am – 10:30 am", Spaces: 1}
+	b := Appointment{Date: "2024-06-02", Time: "10:00 am – 10:30 am", Spaces: 1}
+
+	history := &PollHistory{}
+	history.record(base, armFast, 5*time.Minute, []Appointment{a, b}, []Appointment{a, b})
+	history.record(base.Add(5*time.Minute), armFast, 5*time.Minute, []Appointment{a}, nil)
+
+	first := history.Checks[0]
+	if !first.FollowedUp || first.Vanished != 1 {
+		t.Errorf("first check = %+v, want followed up with 1 vanished", first)
+	}
+	if history.Checks[1].GapSeconds != 300 {
+		t.Errorf("second check GapSeconds = %d, want 300", history.Checks[1].GapSeconds)
+	}
+
+	path := filepath.Join(t.TempDir(), "history.json")
+	if err := savePollHistory(history, path); err != nil {
+		t.Fatalf("savePollHistory() error = %v", err)
+	}
+	loaded, err := loadPollHistory(path)
+	if err != nil {
+		t.Fatalf("loadPollHistory() error = %v", err)
+	}
+
+	var report strings.Builder
+	writePollReport(&report, loaded)
+	for _, want := range []string{"fast  5m", "1/2", "slow  -"} {
+		if !strings.Contains(report.String(), want) {
+			t.Errorf("writePollReport() missing %q:\n%s", want, report.String())
+		}
+	}
+}
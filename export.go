@@ -0,0 +1,224 @@
+package melanzana
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/pashbylogan/melanzana/pkg/store"
+)
+
+// jsonlExporter writes appointment observations as JSON Lines, skipping ones
+// it has already written.
+type jsonlExporter struct {
+	enc     *json.Encoder
+	emitted map[string]bool
+}
+
+func newJSONLExporter(w io.Writer) *jsonlExporter {
+	return &jsonlExporter{enc: json.NewEncoder(w), emitted: map[string]bool{}}
+}
+
+// write emits the appointments not written before and returns how many it wrote.
+// A slot that disappears and is later observed again counts as a new observation.
+func (e *jsonlExporter) write(appointments []Appointment) (int, error) {
+	written := 0
+	for _, appt := range appointments {
+		key := appointmentKey(appt) + "|" + appt.ObservedAt.Format(time.RFC3339Nano)
+		if e.emitted[key] {
+			continue
+		}
+		if err := e.enc.Encode(appt); err != nil {
+			return written, fmt.Errorf("failed to write observation: %w", err)
+		}
+		e.emitted[key] = true
+		written++
+	}
+	return written, nil
+}
+
+// slotLifetime summarizes the recorded history of one slot.
+type slotLifetime struct {
+	Date, Time, Calendar string
+	Status               string    // "open", "booked" or "expired"
+	FirstSeen            time.Time // When the slot first appeared
+	LastSeen             time.Time // The last change recorded while it was open
+	GoneAt               time.Time // When it was found booked or past; zero while open
+	Spaces               int       // Spaces at the last change while open
+	PeakSpaces           int
+	Appearances          int // How often it appeared, counting reopenings
+}
+
+// slotLifetimes replays history into one summary per slot, in the order the
+// slots first appeared.
+func slotLifetimes(history []AvailabilityEvent) []slotLifetime {
+	var lifetimes []slotLifetime
+	index := make(map[string]int)
+	for _, e := range history {
+		key := store.SlotID(e.Date, e.Time, e.Calendar)
+		i, ok := index[key]
+		if !ok {
+			i = len(lifetimes)
+			index[key] = i
+			lifetimes = append(lifetimes, slotLifetime{Date: e.Date, Time: e.Time, Calendar: e.Calendar, FirstSeen: e.At})
+		}
+		l := &lifetimes[i]
+		switch e.Kind {
+		case eventDisappeared:
+			l.Status, l.GoneAt = "booked", e.At
+		case eventExpired:
+			// A booked slot is dropped from the state once its day passes;
+			// it stays booked.
+			if l.Status != "booked" {
+				l.Status, l.GoneAt = "expired", e.At
+			}
+		default:
+			if e.Kind == eventAppeared || e.Kind == eventReappeared {
+				l.Appearances++
+			}
+			l.Status, l.LastSeen, l.GoneAt, l.Spaces = "open", e.At, time.Time{}, e.Spaces
+			l.PeakSpaces = max(l.PeakSpaces, e.Spaces)
+		}
+	}
+	return lifetimes
+}
+
+// writeLifetimesCSV writes lifetimes as CSV with a header row. Times are
+// RFC 3339 in UTC, and empty when unknown.
+func writeLifetimesCSV(w io.Writer, lifetimes []slotLifetime) error {
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"date", "time", "calendar", "status", "first_seen", "last_seen", "gone_at", "spaces", "peak_spaces", "appearances"})
+	for _, l := range lifetimes {
+		cw.Write([]string{l.Date, l.Time, l.Calendar, l.Status, formatTime(l.FirstSeen), formatTime(l.LastSeen), formatTime(l.GoneAt),
+			strconv.Itoa(l.Spaces), strconv.Itoa(l.PeakSpaces), strconv.Itoa(l.Appearances)})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("failed to write CSV: %w", err)
+	}
+	return nil
+}
+
+// runExportCommand implements "melanzana export": it writes the stored
+// observations and, with -follow, keeps polling the store and writing new
+// ones as a running scraper records them. With -format csv or parquet it
+// instead writes one row per slot in the availability history.
+func runExportCommand(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	configFile := fs.String("configFile", "", "Path to JSON configuration file")
+	format := fs.String("format", "jsonl", "Output format: jsonl for observations, csv or parquet for the availability history")
+	follow := fs.Bool("follow", false, "Keep running and write new observations as they are stored")
+	output := fs.String("output", "", "File or named pipe to write to instead of stdout")
+	fs.StringVar(output, "out", "", "Shorthand for -output")
+	poll := fs.Duration("poll", 10*time.Second, "How often to check the store for new observations with -follow")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	switch *format {
+	case "jsonl":
+	case "csv", "parquet":
+		if *follow {
+			fmt.Fprintln(os.Stderr, "-follow only works with -format jsonl")
+			return 2
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unsupported export format %q\n", *format)
+		return 2
+	}
+
+	config := defaultConfig()
+	if *configFile != "" {
+		if err := loadConfigFile(&config, *configFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	if err := setupLogging(config); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := resolveSecrets(&config); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to resolve secrets: %v\n", err)
+		return 1
+	}
+	// Exporting only reads; never let the store replay or alert by email.
+	config.ReadOnly = true
+
+	store, err := newStore(config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to configure state store: %v\n", err)
+		return 1
+	}
+
+	out := io.Writer(os.Stdout)
+	if *output != "" {
+		// JSON Lines are appended, so a follower can resume into the same
+		// file; CSV and Parquet are snapshots, so they replace it.
+		mode := os.O_APPEND
+		if *format != "jsonl" {
+			mode = os.O_TRUNC
+		}
+		f, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|mode, 0644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to open %s: %v\n", *output, err)
+			return 1
+		}
+		defer f.Close()
+		out = f
+	}
+
+	if *format != "jsonl" {
+		history, err := store.History()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read availability history: %v\n", err)
+			return 1
+		}
+		write := writeLifetimesCSV
+		if *format == "parquet" {
+			write = writeLifetimesParquet
+		}
+		if err := write(out, slotLifetimes(history)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+	exporter := newJSONLExporter(out)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	for {
+		seen, err := store.Load()
+		if err != nil {
+			slog.Error("Error loading observations", "err", err)
+		} else if _, err := exporter.write(seen); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		if !*follow {
+			return 0
+		}
+		select {
+		case <-stop:
+			return 0
+		case <-clock.After(*poll):
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package melanzana
+
+import (
+	"bufio"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSONLExporter(t *testing.T) {
+	observed := time.Date(2024, 5, 15, 9, 0, 0, 0, time.UTC)
+	a := Appointment{Date: "2024-06-01", Time: "10:00 am – 10:30 am", Spaces: 1, IsAvailable: true, ObservedAt: observed}
+	b := Appointment{Date: "2024-06-02", Time: "10:00 am – 10:30 am", Spaces: 2, IsAvailable: true, ObservedAt: observed}
+	reappeared := a
+	reappeared.ObservedAt = observed.Add(24 * time.Hour)
+
+	var out strings.Builder
+	exporter := newJSONLExporter(&out)
+
+	for _, tt := range []struct {
+		batch []Appointment
+		want  int
+	}{
+		{[]Appointment{a}, 1},
+		{[]Appointment{a, b}, 1},
+		{[]Appointment{a, b, reappeared}, 1},
+	} {
+		got, err := exporter.write(tt.batch)
+		if err != nil {
+			t.Fatalf("write() error = %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("write() wrote %d, want %d", got, tt.want)
+		}
+	}
+
+	var lines []Appointment
+	scanner := bufio.NewScanner(strings.NewReader(out.String()))
+	for scanner.Scan() {
+		var appt Appointment
+		if err := json.Unmarshal(scanner.Bytes(), &appt); err != nil {
+			t.Fatalf("line %q is not JSON: %v", scanner.Text(), err)
+		}
+		lines = append(lines, appt)
+	}
+	if len(lines) != 3 || lines[2].ObservedAt != reappeared.ObservedAt {
+		t.Errorf("exported %+v, want a, b and the reappeared slot", lines)
+	}
+}
+
+func TestSlotLifetimesCSV(t *testing.T) {
+	at := time.Date(2024, 5, 15, 9, 0, 0, 0, time.UTC)
+	slot := func(kind string, hours, spaces int, date string) AvailabilityEvent {
+		return AvailabilityEvent{At: at.Add(time.Duration(hours) * time.Hour), Kind: kind, Date: date, Time: "10:00 am – 10:30 am", Spaces: spaces}
+	}
+	history := []AvailabilityEvent{
+		slot(eventAppeared, 0, 1, "2024-05-20"),
+		slot(eventAppeared, 0, 2, "2024-05-16"),
+		slot(eventIncreased, 1, 3, "2024-05-20"),
+		slot(eventDisappeared, 2, 0, "2024-05-20"),
+		slot(eventReappeared, 3, 1, "2024-05-20"),
+		slot(eventDisappeared, 4, 0, "2024-05-20"),
+		slot(eventAppeared, 5, 1, "2024-05-14"),
+		slot(eventExpired, 30, 0, "2024-05-14"),
+		slot(eventExpired, 200, 0, "2024-05-20"),
+	}
+
+	var out strings.Builder
+	if err := writeLifetimesCSV(&out, slotLifetimes(history)); err != nil {
+		t.Fatalf("writeLifetimesCSV() error = %v", err)
+	}
+	want := "date,time,calendar,status,first_seen,last_seen,gone_at,spaces,peak_spaces,appearances\n" +
+		"2024-05-20,10:00 am – 10:30 am,,booked,2024-05-15T09:00:00Z,2024-05-15T12:00:00Z,2024-05-15T13:00:00Z,1,3,2\n" +
+		"2024-05-16,10:00 am – 10:30 am,,open,2024-05-15T09:00:00Z,2024-05-15T09:00:00Z,,2,2,1\n" +
+		"2024-05-14,10:00 am – 10:30 am,,expired,2024-05-15T14:00:00Z,2024-05-15T14:00:00Z,2024-05-16T15:00:00Z,1,1,1\n"
+	if out.String() != want {
+		t.Errorf("CSV =\n%s\nwant\n%s", out.String(), want)
+	}
+}
@@ -0,0 +1,64 @@
+package melanzana
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FeatureFlags gates experimental subsystems so they can ship disabled and be
+// turned on per deployment. All features default to off.
+type FeatureFlags struct {
+	AutoBook     bool `json:"autoBook"`     // Book the first new slot matching autoBooking.booker
+	BurstMode    bool `json:"burstMode"`    // Collapse bursts of new slots into digests (see burstThreshold)
+	HTMLFallback bool `json:"htmlFallback"` // Scrape htmlFallbackUrl when the API fails
+}
+
+// flags returns each feature's config name and pointer to its value, in a
+// stable order for logging and lookup.
+func (f *FeatureFlags) flags() []struct {
+	name  string
+	value *bool
+} {
+	return []struct {
+		name  string
+		value *bool
+	}{
+		{"autoBook", &f.AutoBook},
+		{"burstMode", &f.BurstMode},
+		{"htmlFallback", &f.HTMLFallback},
+	}
+}
+
+// enable turns on the features named in a comma-separated list.
+func (f *FeatureFlags) enable(list string) error {
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		found := false
+		for _, flag := range f.flags() {
+			if strings.EqualFold(flag.name, name) {
+				*flag.value = true
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown feature %q", name)
+		}
+	}
+	return nil
+}
+
+// String renders every feature and its state, e.g. "autoBook=off burstMode=on".
+func (f FeatureFlags) String() string {
+	var parts []string
+	for _, flag := range f.flags() {
+		state := "off"
+		if *flag.value {
+			state = "on"
+		}
+		parts = append(parts, flag.name+"="+state)
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,48 @@
+package melanzana
+
+import "testing"
+
+func TestFeatureFlagsEnable(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    string
+		want    FeatureFlags
+		wantErr bool
+	}{
+		{name: "Empty", list: "", want: FeatureFlags{}},
+		{name: "Single", list: "burstMode", want: FeatureFlags{BurstMode: true}},
+		{name: "MultipleWithSpaces", list: "autoBook, htmlfallback", want: FeatureFlags{AutoBook: true, HTMLFallback: true}},
+		{name: "Unknown", list: "burstMode,teleport", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got FeatureFlags
+			err := got.enable(tt.list)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("enable(%q) error = %v, wantErr %v", tt.list, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("enable(%q) = %+v, want %+v", tt.list, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFeatureFlagsString(t *testing.T) {
+	got := FeatureFlags{BurstMode: true}.String()
+	want := "autoBook=off burstMode=on htmlFallback=off"
+	if got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestPlanNotificationsRequiresBurstMode(t *testing.T) {
+	config := AppConfig{BurstThreshold: 1, BurstWindowMinutes: 60, ReadOnly: true}
+	appts := []Appointment{{Date: "2024-05-15", Time: "10:00 am – 10:30 am", Spaces: 1}}
+
+	got := planNotifications(config, []Change{{Kind: SlotAdded, Slot: appts[0]}})
+	if len(got) != 1 || got[0].Intro != "" {
+		t.Errorf("planNotifications() with burstMode off = %+v, want one normal notification", got)
+	}
+}
@@ -1,29 +1,135 @@
-package main
+package melanzana
 
-import "log"
+import (
+	"log/slog"
+	"time"
+)
 
-// filterNewAppointments returns appointments that haven't been seen before.
+// filterNewAppointments returns appointments that haven't been seen before:
+// those added since the snapshot of the seen ones.
 func filterNewAppointments(appointments, seenAppointments []Appointment) []Appointment {
 	if len(seenAppointments) == 0 {
-		log.Printf("No previous appointments found, all %d appointments are new", len(appointments))
+		slog.Info("No previous appointments found, all appointments are new", "count", len(appointments))
 		return appointments
 	}
 
-	// Create a set of seen appointments for O(1) lookup
-	seenSet := make(map[string]bool)
-	for _, seen := range seenAppointments {
-		key := seen.Date + "|" + seen.Time
-		seenSet[key] = true
+	newAppointments := addedSlots(diffSnapshots(newSnapshot(seenAppointments), appointments, clock.Now()))
+
+	slog.Debug("Filtered new appointments", "new", len(newAppointments), "total", len(appointments))
+	return newAppointments
+}
+
+// notificationChanges returns the changes recipients of a watch are to be
+// told about, from the bookable slots, the seen slots they were told about
+// and this check's changes: each bookable slot not yet seen, as SlotAdded,
+// and the changes of seen slots that reopened or gained spaces, past
+// cooldown. New slots are found against the seen slots rather than taken
+// from changes, as a slot that is no longer new to the calendar may still
+// be new to the watch: its notification failed, or the watch's filter
+// changed.
+func notificationChanges(bookable, seen []Appointment, changes []Change, cooldown time.Duration, now time.Time) []Change {
+	var pending []Change
+	for _, appt := range filterNewAppointments(bookable, seen) {
+		pending = append(pending, Change{Kind: SlotAdded, Slot: appt})
+	}
+	if again := renotifications(bookable, seen, changes, cooldown, now); len(again) > 0 {
+		slog.Info("Notified slots reopened or gained spaces", "count", len(again))
+		pending = append(pending, again...)
 	}
+	return pending
+}
 
-	var newAppointments []Appointment
-	for _, appt := range appointments {
-		key := appt.Date + "|" + appt.Time
-		if !seenSet[key] {
-			newAppointments = append(newAppointments, appt)
+// changedSlots returns the slots of changes.
+func changedSlots(changes []Change) []Appointment {
+	var slots []Appointment
+	for _, c := range changes {
+		slots = append(slots, c.Slot)
+	}
+	return slots
+}
+
+// renotifications returns the changes of scraped slots that were notified
+// before and reopened or gained spaces this cycle, leaving out any notified
+// within cooldown.
+func renotifications(scraped, seen []Appointment, changes []Change, cooldown time.Duration, now time.Time) []Change {
+	if cooldown <= 0 || len(seen) == 0 {
+		return nil
+	}
+	improved := make(map[string]Change)
+	for _, c := range changes {
+		if (c.Kind == SlotAdded && c.Reopened) || (c.Kind == SpacesChanged && c.delta() > 0) {
+			improved[appointmentKey(c.Slot)] = c
+		}
+	}
+	if len(improved) == 0 {
+		return nil
+	}
+	notifiedAt := make(map[string]time.Time, len(seen))
+	for _, appt := range seen {
+		key := appointmentKey(appt)
+		if last, ok := notifiedAt[key]; !ok || appt.LastNotifiedAt.After(last) {
+			notifiedAt[key] = appt.LastNotifiedAt
 		}
 	}
 
-	log.Printf("Filtered %d new appointments from %d total", len(newAppointments), len(appointments))
-	return newAppointments
+	var again []Change
+	for _, appt := range scraped {
+		key := appointmentKey(appt)
+		c, changed := improved[key]
+		if last, ok := notifiedAt[key]; ok && changed && now.Sub(last) >= cooldown {
+			c.Slot = appt
+			again = append(again, c)
+		}
+	}
+	return again
+}
+
+// goneAppointments returns the seen records of slots that disappeared this
+// cycle, i.e. notified slots that were fully booked or withdrawn.
+func goneAppointments(seen []Appointment, changes []Change) []Appointment {
+	notified := make(map[string]Appointment, len(seen))
+	for _, appt := range seen {
+		notified[appointmentKey(appt)] = appt
+	}
+	var gone []Appointment
+	for _, c := range changes {
+		if appt, ok := notified[appointmentKey(c.Slot)]; ok && c.Kind == SlotRemoved && !c.Expired {
+			gone = append(gone, appt)
+		}
+	}
+	return gone
+}
+
+// slotKey identifies a slot like appointmentKey does, but without building
+// a string for every lookup.
+type slotKey struct {
+	date, time, calendar string
+}
+
+// slotSet is a set of slots for repeated membership tests.
+type slotSet map[slotKey]struct{}
+
+func newSlotSet(appointments []Appointment) slotSet {
+	set := make(slotSet, len(appointments))
+	for _, appt := range appointments {
+		set[slotKey{appt.Date, appt.Time, appt.Calendar}] = struct{}{}
+	}
+	return set
+}
+
+// has reports whether appt is in s.
+func (s slotSet) has(appt Appointment) bool {
+	_, ok := s[slotKey{appt.Date, appt.Time, appt.Calendar}]
+	return ok
+}
+
+// appendUnseen appends the appointments that aren't in s to dst, so a
+// caller filtering repeatedly can pass the previous result's backing array.
+func (s slotSet) appendUnseen(dst, appointments []Appointment) []Appointment {
+	for _, appt := range appointments {
+		if _, ok := s[slotKey{appt.Date, appt.Time, appt.Calendar}]; !ok {
+			dst = append(dst, appt)
+		}
+	}
+	return dst
 }
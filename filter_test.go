@@ -1,8 +1,14 @@
-package main
+package melanzana
 
 import (
+	"fmt"
+	"io"
+	"log"
+	"os"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestFilterNewAppointments(t *testing.T) {
@@ -91,3 +97,151 @@ func TestFilterNewAppointments(t *testing.T) {
 		})
 	}
 }
+
+func TestRenotifications(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	slot := func(date string, spaces int, notified time.Duration) Appointment {
+		return Appointment{Date: date, Time: "10:00 am – 10:30 am", Spaces: spaces, IsAvailable: true, LastNotifiedAt: now.Add(-notified)}
+	}
+	seen := []Appointment{
+		slot("2024-06-10", 1, 2*time.Hour),
+		slot("2024-06-11", 1, 2*time.Hour),
+		slot("2024-06-12", 1, 10*time.Minute),
+		slot("2024-06-13", 1, 2*time.Hour),
+	}
+	scraped := []Appointment{
+		slot("2024-06-10", 1, 0), // reopened
+		slot("2024-06-11", 3, 0), // gained spaces
+		slot("2024-06-12", 2, 0), // gained spaces, but notified recently
+		slot("2024-06-13", 1, 0), // unchanged
+		slot("2024-06-14", 1, 0), // never notified
+	}
+	changes := []Change{
+		{Kind: SlotAdded, Slot: scraped[0], Reopened: true},
+		{Kind: SpacesChanged, Slot: scraped[1], PreviousSpaces: 1},
+		{Kind: SpacesChanged, Slot: scraped[2], PreviousSpaces: 1},
+		{Kind: SlotAdded, Slot: scraped[4]},
+	}
+
+	var dates []string
+	for _, c := range renotifications(scraped, seen, changes, time.Hour, now) {
+		dates = append(dates, c.Slot.Date)
+	}
+	if want := []string{"2024-06-10", "2024-06-11"}; !reflect.DeepEqual(dates, want) {
+		t.Errorf("renotifications() = %v, want %v", dates, want)
+	}
+
+	if got := renotifications(scraped, seen, changes, 0, now); got != nil {
+		t.Errorf("renotifications() with no cooldown = %v, want none", got)
+	}
+
+	// A slot never notified is pending whether or not this check found it
+	// added; reopened slots keep their change.
+	changes = changes[:3]
+	var pending []string
+	for _, c := range notificationChanges(scraped, seen, changes, time.Hour, now) {
+		pending = append(pending, fmt.Sprintf("%s %s %v", c.Slot.Date, c.Kind, c.Reopened))
+	}
+	want := []string{"2024-06-14 slotAdded false", "2024-06-10 slotAdded true", "2024-06-11 spacesChanged false"}
+	if !reflect.DeepEqual(pending, want) {
+		t.Errorf("notificationChanges() = %v, want %v", pending, want)
+	}
+}
+
+func TestGoneAppointments(t *testing.T) {
+	seen := []Appointment{
+		{Date: "2024-06-10", Time: "10:00 am – 10:30 am", Spaces: 2},
+		{Date: "2024-06-11", Time: "10:00 am – 10:30 am", Spaces: 1, Calendar: "fitting"},
+	}
+	changes := []Change{
+		{Kind: SpacesChanged, Slot: Appointment{Date: "2024-06-10", Time: "10:00 am – 10:30 am", Spaces: 1}, PreviousSpaces: 2},
+		{Kind: SlotRemoved, Slot: Appointment{Date: "2024-06-11", Time: "10:00 am – 10:30 am", Calendar: "fitting"}, PreviousSpaces: 1},
+		{Kind: SlotRemoved, Slot: Appointment{Date: "2024-06-12", Time: "10:00 am – 10:30 am"}, PreviousSpaces: 1}, // never notified
+	}
+
+	gone := goneAppointments(seen, changes)
+	if !reflect.DeepEqual(gone, seen[1:]) {
+		t.Errorf("goneAppointments() = %v, want %v", gone, seen[1:])
+	}
+
+	body := buildNotificationText(goneNotification(gone), RenderOptions{})
+	if !strings.Contains(body, "No longer available:\n- 2024-06-11 at 10:00 am – 10:30 am, fitting") {
+		t.Errorf("goneNotification() body = %q, want the gone slot listed", body)
+	}
+}
+
+func TestPersonalizerMatchesRecipientFilter(t *testing.T) {
+	slots := benchmarkSlots(200)
+	n := Notification{Appointments: slots, Removed: slots[:50]}
+	p := newPersonalizer(n)
+
+	for _, r := range benchmarkRecipients(20) {
+		personal := p.personalize(r, AppConfig{})
+
+		var want []Appointment
+		for _, appt := range slots {
+			if r.matches(appt) {
+				want = append(want, appt)
+			}
+		}
+		if len(personal.Appointments) != len(want) || (len(want) > 0 && !reflect.DeepEqual(personal.Appointments, want)) {
+			t.Errorf("personalize(%+v) = %d appointments, want %d", r, len(personal.Appointments), len(want))
+		}
+	}
+}
+
+// benchmarkSlots returns n distinct half-hour slots spread over the coming
+// weeks, with between 1 and 4 spaces.
+func benchmarkSlots(n int) []Appointment {
+	start := time.Date(2099, 1, 1, 0, 0, 0, 0, time.UTC)
+	slots := make([]Appointment, n)
+	for i := range slots {
+		slots[i] = Appointment{
+			Date:        start.AddDate(0, 0, i/16).Format("2006-01-02"),
+			Time:        fmt.Sprintf("%d:%02d", 8+i%16/2, i%2*30),
+			Spaces:      1 + i%4,
+			IsAvailable: true,
+		}
+	}
+	return slots
+}
+
+// benchmarkRecipients returns n recipients with a mix of preferences.
+func benchmarkRecipients(n int) []Recipient {
+	prefs := [][]string{nil, {"Sat", "Sun"}, {"mon", "wed", "fri"}, {"thursday"}}
+	recipients := make([]Recipient, n)
+	for i := range recipients {
+		recipients[i] = Recipient{
+			Email:     fmt.Sprintf("subscriber%d@example.com", i),
+			Weekdays:  prefs[i%len(prefs)],
+			MinSpaces: i % 3,
+		}
+	}
+	return recipients
+}
+
+func BenchmarkFilterNewAppointments(b *testing.B) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	slots := benchmarkSlots(1000)
+	seen := slots[:900]
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		filterNewAppointments(slots, seen)
+	}
+}
+
+// BenchmarkPersonalize100Subscribers measures one cycle of server mode:
+// 100 subscribers' filters evaluated against 1000 slots.
+func BenchmarkPersonalize100Subscribers(b *testing.B) {
+	n := Notification{Appointments: benchmarkSlots(1000)}
+	recipients := benchmarkRecipients(100)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		p := newPersonalizer(n)
+		for _, r := range recipients {
+			p.personalize(r, AppConfig{})
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package melanzana
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// maxDisplayTimezones caps how many zones are rendered per slot so lines stay readable.
+const maxDisplayTimezones = 3
+
+// RenderOptions controls how appointments are rendered in notification messages.
+type RenderOptions struct {
+	Timezones     []*time.Location // Zones to render slot times in; empty means source time only
+	HTMLTemplate  string           // Path to a custom HTML email template; empty uses the default
+	Subject       string           // Optional emailSubject template
+	AssetsDir     string           // Directory whose files override the embedded assets
+	CollapseSlots bool             // Merge back-to-back slots on the same day into one time range
+}
+
+// newRenderOptions builds RenderOptions from the application configuration.
+func newRenderOptions(config AppConfig) (RenderOptions, error) {
+	opts := RenderOptions{HTMLTemplate: config.EmailTemplate, Subject: config.EmailSubject, AssetsDir: config.AssetsDir,
+		CollapseSlots: config.CollapseSlots}
+
+	if len(config.DisplayTimezones) > maxDisplayTimezones {
+		return opts, fmt.Errorf("at most %d display timezones are supported, got %d",
+			maxDisplayTimezones, len(config.DisplayTimezones))
+	}
+
+	for _, name := range config.DisplayTimezones {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			return opts, fmt.Errorf("invalid display timezone %q: %w", name, err)
+		}
+		opts.Timezones = append(opts.Timezones, loc)
+	}
+
+	return opts, nil
+}
+
+// loadTimezone loads the named IANA zone for the timezone setting, which
+// unlike time.LoadLocation doesn't accept "" as UTC.
+func loadTimezone(name string) (*time.Location, error) {
+	if name == "" {
+		return nil, fmt.Errorf("timezone is required")
+	}
+	return time.LoadLocation(name)
+}
+
+// sourceLocation returns the location of sourceTimezone, falling back to the
+// local zone if it can't be loaded.
+func sourceLocation() *time.Location {
+	loc, err := loadTimezone(sourceTimezone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// parseSlotTimes recovers the start and end of an appointment from its Date
+// and Time fields, interpreted in the source timezone.
+func parseSlotTimes(appt Appointment) (time.Time, time.Time, error) {
+	loc, err := loadTimezone(sourceTimezone)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	start, end, ok := strings.Cut(appt.Time, " – ")
+	if !ok {
+		return time.Time{}, time.Time{}, fmt.Errorf("unrecognized time range %q", appt.Time)
+	}
+
+	startTime, err := time.ParseInLocation("2006-01-02 3:04 pm", appt.Date+" "+start, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	endTime, err := time.ParseInLocation("2006-01-02 3:04 pm", appt.Date+" "+end, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return startTime, endTime, nil
+}
+
+// displayTime renders the appointment's time range in each configured zone,
+// e.g. "10:00 am – 10:30 am MDT / 12:00 pm – 12:30 pm EDT". Without configured
+// zones, or if the time cannot be parsed, the original Time string is returned.
+func displayTime(appt Appointment, opts RenderOptions) string {
+	if len(opts.Timezones) == 0 {
+		return appt.Time
+	}
+
+	start, end, err := parseSlotTimes(appt)
+	if err != nil {
+		return appt.Time
+	}
+
+	parts := make([]string, 0, len(opts.Timezones))
+	for _, loc := range opts.Timezones {
+		parts = append(parts, fmt.Sprintf("%s – %s",
+			start.In(loc).Format("3:04 pm"),
+			end.In(loc).Format("3:04 pm MST")))
+	}
+	return strings.Join(parts, " / ")
+}
+
+// freshnessFooter describes when the notified slots were first observed and
+// how long ago that was at sendTime, so recipients can judge whether a slot is
+// still worth chasing. It returns "" if no observation times are known.
+func freshnessFooter(appointments []Appointment, sendTime time.Time) string {
+	var oldest, newest time.Time
+	for _, appt := range appointments {
+		if appt.ObservedAt.IsZero() {
+			continue
+		}
+		if oldest.IsZero() || appt.ObservedAt.Before(oldest) {
+			oldest = appt.ObservedAt
+		}
+		if newest.IsZero() || appt.ObservedAt.After(newest) {
+			newest = appt.ObservedAt
+		}
+	}
+	if oldest.IsZero() {
+		return ""
+	}
+
+	loc := sourceLocation()
+	const layout = "2006-01-02 15:04:05 MST"
+
+	if oldest.Equal(newest) {
+		return fmt.Sprintf("First observed %s, notified %s later.",
+			oldest.In(loc).Format(layout), formatElapsed(sendTime.Sub(oldest)))
+	}
+	return fmt.Sprintf("First observed between %s and %s, notified %s to %s later.",
+		oldest.In(loc).Format(layout), newest.In(loc).Format(layout),
+		formatElapsed(sendTime.Sub(newest)), formatElapsed(sendTime.Sub(oldest)))
+}
+
+// formatTrend renders a day's spaces with an arrow for the change since the
+// previous cycle, e.g. "7 spaces ▼3".
+func formatTrend(t DayTrend) string {
+	switch {
+	case t.Delta > 0:
+		return fmt.Sprintf("%d spaces ▲%d", t.Spaces, t.Delta)
+	case t.Delta < 0:
+		return fmt.Sprintf("%d spaces ▼%d", t.Spaces, -t.Delta)
+	default:
+		return fmt.Sprintf("%d spaces, unchanged", t.Spaces)
+	}
+}
+
+// formatElapsed renders short durations in seconds and longer ones as a Go duration.
+func formatElapsed(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	if d < 2*time.Minute {
+		return fmt.Sprintf("%d seconds", int(d.Seconds()))
+	}
+	return d.Round(time.Second).String()
+}
+
+// renderFooter renders the configured footer shared by all notifications.
+// Without a configured template the footer.txt.tmpl asset is used, which
+// renders whichever fields are set. Empty lines are dropped so optional
+// fields leave no gaps.
+func renderFooter(footer FooterConfig, assetsDir string) (string, error) {
+	text := footer.Template
+	if text == "" {
+		data, err := readAsset(assetsDir, "templates/footer.txt.tmpl")
+		if err != nil {
+			return "", err
+		}
+		text = string(data)
+	}
+
+	tmpl, err := template.New("footer").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse footer template: %w", err)
+	}
+
+	var out strings.Builder
+	if err := tmpl.Execute(&out, footer); err != nil {
+		return "", fmt.Errorf("failed to render footer template: %w", err)
+	}
+
+	var lines []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// SubjectData is available to the emailSubject template, both as fields
+// ({{.Count}}) and as functions ({{count}}).
+type SubjectData struct {
+	Count          int
+	EarliestDate   string
+	EarliestTime   string
+	LatestDate     string
+	Days           int
+	DefaultSubject string
+}
+
+// newSubjectData summarizes appointments for subject rendering.
+func newSubjectData(n Notification) SubjectData {
+	data := SubjectData{Count: len(n.Appointments), DefaultSubject: n.Subject}
+	days := make(map[string]bool)
+	for _, appt := range n.Appointments {
+		days[appt.Date] = true
+		if data.EarliestDate == "" || appt.Date < data.EarliestDate {
+			data.EarliestDate = appt.Date
+			data.EarliestTime = appt.Time
+		}
+		if appt.Date > data.LatestDate {
+			data.LatestDate = appt.Date
+		}
+	}
+	data.Days = len(days)
+	return data
+}
+
+// renderSubject renders the configured subject template for a notification.
+// An empty template, or a notification without appointments, keeps the
+// notification's default subject.
+func renderSubject(subjectTemplate string, n Notification) (string, error) {
+	if subjectTemplate == "" || len(n.Appointments) == 0 {
+		return n.Subject, nil
+	}
+
+	data := newSubjectData(n)
+	funcs := template.FuncMap{
+		"count":          func() int { return data.Count },
+		"earliestDate":   func() string { return data.EarliestDate },
+		"earliestTime":   func() string { return data.EarliestTime },
+		"latestDate":     func() string { return data.LatestDate },
+		"days":           func() int { return data.Days },
+		"defaultSubject": func() string { return data.DefaultSubject },
+	}
+
+	tmpl, err := template.New("subject").Funcs(funcs).Parse(subjectTemplate)
+	if err != nil {
+		return n.Subject, fmt.Errorf("failed to parse subject template: %w", err)
+	}
+
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return n.Subject, fmt.Errorf("failed to render subject template: %w", err)
+	}
+	// Header values must stay on one line.
+	return strings.Join(strings.Fields(out.String()), " "), nil
+}
@@ -0,0 +1,235 @@
+package melanzana
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pashbylogan/melanzana/pkg/cowlendar"
+)
+
+func TestDisplayTime(t *testing.T) {
+	appt := Appointment{Date: "2024-07-15", Time: "10:00 am – 10:30 am", Spaces: 2, IsAvailable: true}
+
+	opts, err := newRenderOptions(AppConfig{DisplayTimezones: []string{"America/Denver", "America/New_York"}})
+	if err != nil {
+		t.Fatalf("newRenderOptions() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		appt     Appointment
+		opts     RenderOptions
+		expected string
+	}{
+		{
+			name:     "No zones configured",
+			appt:     appt,
+			opts:     RenderOptions{},
+			expected: "10:00 am – 10:30 am",
+		},
+		{
+			name:     "Two zones",
+			appt:     appt,
+			opts:     opts,
+			expected: "10:00 am – 10:30 am MDT / 12:00 pm – 12:30 pm EDT",
+		},
+		{
+			name:     "Unparseable time falls back to original",
+			appt:     Appointment{Date: "2024-07-15", Time: "sometime"},
+			opts:     opts,
+			expected: "sometime",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := displayTime(tt.appt, tt.opts)
+			if result != tt.expected {
+				t.Errorf("displayTime() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSourceTimezone(t *testing.T) {
+	defer func(name string) { sourceTimezone = name }(sourceTimezone)
+	sourceTimezone = "Europe/London"
+
+	start, end, err := parseSlotTimes(Appointment{Date: "2024-07-15", Time: "10:00 am – 10:30 am"})
+	if err != nil {
+		t.Fatalf("parseSlotTimes() error = %v", err)
+	}
+	if want := time.Date(2024, 7, 15, 9, 0, 0, 0, time.UTC); !start.Equal(want) || end.Sub(start) != 30*time.Minute {
+		t.Errorf("parseSlotTimes() = %v – %v, want 30 minutes from %v", start, end, want)
+	}
+
+	// Slots are reported as wall-clock times in the zone, whatever the local zone is.
+	appts := convertCowlendarToAppointments(&cowlendar.Response{Long: []cowlendar.Slot{
+		{SlotStart: "2024-07-15 23:30", SlotEnd: "2024-07-16 00:00", IsBookable: true, QtyLeft: 1},
+	}})
+	if len(appts) != 1 || appts[0].Date != "2024-07-15" || appts[0].Time != "11:30 pm – 12:00 am" {
+		t.Errorf("convertCowlendarToAppointments() = %+v, want one slot at 11:30 pm on 2024-07-15", appts)
+	}
+
+	sourceTimezone = ""
+	if _, _, err := parseSlotTimes(Appointment{Date: "2024-07-15", Time: "10:00 am – 10:30 am"}); err == nil {
+		t.Errorf("parseSlotTimes() with no timezone error = nil, want error")
+	}
+}
+
+func TestNewRenderOptionsErrors(t *testing.T) {
+	if _, err := newRenderOptions(AppConfig{DisplayTimezones: []string{"Not/AZone"}}); err == nil {
+		t.Errorf("newRenderOptions() with invalid zone error = nil, want error")
+	}
+
+	tooMany := []string{"UTC", "UTC", "UTC", "UTC"}
+	if _, err := newRenderOptions(AppConfig{DisplayTimezones: tooMany}); err == nil {
+		t.Errorf("newRenderOptions() with %d zones error = nil, want error", len(tooMany))
+	}
+}
+
+func TestFreshnessFooter(t *testing.T) {
+	observed := time.Date(2024, 7, 15, 16, 0, 5, 0, time.UTC) // 10:00:05 MDT
+
+	tests := []struct {
+		name         string
+		appointments []Appointment
+		sendTime     time.Time
+		expected     string
+	}{
+		{
+			name:         "No observation times",
+			appointments: []Appointment{{Date: "2024-07-20"}},
+			sendTime:     observed,
+			expected:     "",
+		},
+		{
+			name:         "Single observation",
+			appointments: []Appointment{{ObservedAt: observed}, {ObservedAt: observed}},
+			sendTime:     observed.Add(42 * time.Second),
+			expected:     "First observed 2024-07-15 10:00:05 MDT, notified 42 seconds later.",
+		},
+		{
+			name:         "Range of observations",
+			appointments: []Appointment{{ObservedAt: observed}, {ObservedAt: observed.Add(time.Hour)}},
+			sendTime:     observed.Add(time.Hour + 30*time.Second),
+			expected:     "First observed between 2024-07-15 10:00:05 MDT and 2024-07-15 11:00:05 MDT, notified 30 seconds to 1h0m30s later.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := freshnessFooter(tt.appointments, tt.sendTime)
+			if result != tt.expected {
+				t.Errorf("freshnessFooter() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRenderFooter(t *testing.T) {
+	tests := []struct {
+		name     string
+		footer   FooterConfig
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "Nothing configured",
+			footer:   FooterConfig{},
+			expected: "",
+		},
+		{
+			name: "Default layout skips empty fields",
+			footer: FooterConfig{
+				Operator:   "Logan (logan@example.com)",
+				Disclaimer: "Data comes from Melanzana's public booking calendar.",
+			},
+			expected: "This notifier is run by Logan (logan@example.com).\nData comes from Melanzana's public booking calendar.",
+		},
+		{
+			name:     "Custom template",
+			footer:   FooterConfig{Operator: "Logan", Template: "Questions? Ask {{.Operator}}."},
+			expected: "Questions? Ask Logan.",
+		},
+		{
+			name:    "Invalid template",
+			footer:  FooterConfig{Template: "{{.Operator"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := renderFooter(tt.footer, "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("renderFooter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if result != tt.expected {
+				t.Errorf("renderFooter() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRenderSubject(t *testing.T) {
+	n := Notification{
+		Subject: "New Melanzana Appointments Available!",
+		Appointments: []Appointment{
+			{Date: "2024-06-20", Time: "1:00 pm – 1:30 pm"},
+			{Date: "2024-06-14", Time: "10:00 am – 10:30 am"},
+			{Date: "2024-06-14", Time: "11:00 am – 11:30 am"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		n        Notification
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "No template keeps default",
+			n:        n,
+			expected: "New Melanzana Appointments Available!",
+		},
+		{
+			name:     "Function syntax",
+			template: "{{count}} new Melanzana slots, earliest {{earliestDate}}",
+			n:        n,
+			expected: "3 new Melanzana slots, earliest 2024-06-14",
+		},
+		{
+			name:     "Field syntax spanning lines",
+			template: "{{.Days}} days\n{{.EarliestDate}} {{.EarliestTime}} to {{.LatestDate}}",
+			n:        n,
+			expected: "2 days 2024-06-14 10:00 am – 10:30 am to 2024-06-20",
+		},
+		{
+			name:     "Notification without appointments keeps default",
+			template: "{{count}} slots",
+			n:        Notification{Subject: "Summary"},
+			expected: "Summary",
+		},
+		{
+			name:     "Invalid template falls back with error",
+			template: "{{count",
+			n:        n,
+			expected: "New Melanzana Appointments Available!",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := renderSubject(tt.template, tt.n)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("renderSubject() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if result != tt.expected {
+				t.Errorf("renderSubject() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
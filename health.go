@@ -0,0 +1,153 @@
+package melanzana
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// healthStatus tracks cycle outcomes for the health endpoints. Cycles record
+// into it while the server reads it, so it has its own lock.
+type healthStatus struct {
+	mu          sync.Mutex
+	lastSuccess time.Time
+	lastFailure time.Time
+	lastErr     string
+}
+
+// health is the process-wide cycle status.
+var health = &healthStatus{}
+
+// record notes the outcome of a cycle that finished at now.
+func (h *healthStatus) record(err error, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err != nil {
+		h.lastFailure, h.lastErr = now, err.Error()
+		return
+	}
+	h.lastSuccess = now
+}
+
+// failing returns the error of the last cycle, or "" if it succeeded.
+func (h *healthStatus) failing() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.lastFailure.After(h.lastSuccess) {
+		return h.lastErr
+	}
+	return ""
+}
+
+// healthReport is the JSON body of /healthz and /readyz.
+type healthReport struct {
+	Status        string     `json:"status"` // "ok", "stale", "starting" or "invalid config"
+	Started       time.Time  `json:"started"`
+	LastSuccess   *time.Time `json:"lastSuccess,omitempty"`
+	LastFailure   *time.Time `json:"lastFailure,omitempty"`
+	LastError     string     `json:"lastError,omitempty"`
+	ConfigProblem []string   `json:"configProblems,omitempty"`
+}
+
+// healthServer serves /healthz and /readyz, and the read-only API when
+// serveApi is set.
+//
+// /healthz fails once no cycle has succeeded within staleAfter, counting
+// from startup, so a hung or persistently failing scraper gets restarted.
+// /readyz also fails until the first cycle succeeds or while the
+// configuration has problems.
+type healthServer struct {
+	status     *healthStatus
+	started    time.Time
+	staleAfter time.Duration
+	problems   []string
+	now        func() time.Time
+	api        http.Handler // nil unless serveApi is set
+}
+
+// newHealthServer returns the server for a process polling every interval.
+func newHealthServer(config AppConfig, interval time.Duration) *healthServer {
+	longest := interval
+	if config.PollExperiment.enabled() {
+		longest = max(longest, time.Duration(max(config.PollExperiment.FastIntervalMinutes, config.PollExperiment.SlowIntervalMinutes))*time.Minute)
+	}
+	if config.AdaptivePolling.enabled() {
+		longest = max(longest, time.Duration(config.AdaptivePolling.MaxIntervalMinutes)*time.Minute)
+	}
+	s := &healthServer{
+		status:     health,
+		started:    clock.Now(),
+		staleAfter: 3 * longest,
+		problems:   configProblems(config),
+		now:        clockNow,
+	}
+	if config.ServeAPI {
+		s.api = newAPIServer(config).handler()
+	}
+	return s
+}
+
+func (s *healthServer) report(ready bool) (healthReport, bool) {
+	s.status.mu.Lock()
+	defer s.status.mu.Unlock()
+
+	r := healthReport{Status: "ok", Started: s.started, LastError: s.status.lastErr, ConfigProblem: s.problems}
+	if !s.status.lastSuccess.IsZero() {
+		t := s.status.lastSuccess
+		r.LastSuccess = &t
+	}
+	if !s.status.lastFailure.IsZero() {
+		t := s.status.lastFailure
+		r.LastFailure = &t
+	}
+
+	since := s.started
+	if r.LastSuccess != nil {
+		since = *r.LastSuccess
+	}
+	switch {
+	case s.now().Sub(since) > s.staleAfter:
+		r.Status = "stale"
+	case ready && len(s.problems) > 0:
+		r.Status = "invalid config"
+	case ready && r.LastSuccess == nil:
+		r.Status = "starting"
+	}
+	return r, r.Status == "ok"
+}
+
+func (s *healthServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	serve := func(ready bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			report, ok := s.report(ready)
+			w.Header().Set("Content-Type", "application/json")
+			if !ok {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+			json.NewEncoder(w).Encode(report)
+		}
+	}
+	mux.HandleFunc("/healthz", serve(false))
+	mux.HandleFunc("/readyz", serve(true))
+	if s.api != nil {
+		mux.Handle("/api/", s.api)
+	}
+	return mux
+}
+
+// serveHealth listens on addr in the background, until the returned server
+// is closed.
+func serveHealth(addr string, s *healthServer) *http.Server {
+	server := &http.Server{Addr: addr, Handler: s.handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		slog.Info("Serving health endpoints", "addr", addr, "api", s.api != nil)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Health endpoint server stopped", "err", err)
+		}
+	}()
+	return server
+}
@@ -0,0 +1,67 @@
+package melanzana
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthServer(t *testing.T) {
+	started := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	now := started
+	s := &healthServer{status: &healthStatus{}, started: started, staleAfter: 30 * time.Minute, now: func() time.Time { return now }}
+	server := httptest.NewServer(s.handler())
+	defer server.Close()
+
+	check := func(path string) (int, healthReport) {
+		t.Helper()
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s error = %v", path, err)
+		}
+		defer resp.Body.Close()
+		var report healthReport
+		if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+			t.Fatalf("GET %s body: %v", path, err)
+		}
+		return resp.StatusCode, report
+	}
+
+	steps := []struct {
+		name          string
+		advance       time.Duration
+		cycleErr      error
+		cycle         bool
+		problems      []string
+		health, ready int
+		status        string
+	}{
+		{"Starting", 0, nil, false, nil, http.StatusOK, http.StatusServiceUnavailable, "starting"},
+		{"FirstCycle", 5 * time.Minute, nil, true, nil, http.StatusOK, http.StatusOK, "ok"},
+		{"FailingCycle", 10 * time.Minute, errors.New("API returned status 503"), true, nil, http.StatusOK, http.StatusOK, "ok"},
+		{"Stuck", 30 * time.Minute, nil, false, nil, http.StatusServiceUnavailable, http.StatusServiceUnavailable, "stale"},
+		{"Recovered", time.Minute, nil, true, nil, http.StatusOK, http.StatusOK, "ok"},
+		{"InvalidConfig", 0, nil, false, []string{"calendarId is required"}, http.StatusOK, http.StatusServiceUnavailable, "invalid config"},
+	}
+	for _, step := range steps {
+		now = now.Add(step.advance)
+		if step.cycle {
+			s.status.record(step.cycleErr, now)
+		}
+		s.problems = step.problems
+		if code, _ := check("/healthz"); code != step.health {
+			t.Errorf("%s: /healthz status = %d, want %d", step.name, code, step.health)
+		}
+		code, report := check("/readyz")
+		if code != step.ready || report.Status != step.status {
+			t.Errorf("%s: /readyz = %d %q, want %d %q", step.name, code, report.Status, step.ready, step.status)
+		}
+	}
+
+	if _, report := check("/readyz"); report.LastError != "API returned status 503" || report.LastSuccess == nil {
+		t.Errorf("report = %+v, want the last error and success", report)
+	}
+}
@@ -0,0 +1,59 @@
+package melanzana
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// heartbeatClient sends heartbeat pings. They go directly rather than through
+// apiClient, so calendar rate limits and proxies don't delay them.
+var heartbeatClient = &http.Client{Transport: outboundTransport, Timeout: 10 * time.Second}
+
+// heartbeatPing returns the request reporting a cycle's outcome to a
+// Healthchecks.io or Dead Man's Snitch style monitor: a GET of the URL after
+// a successful cycle, or a POST of the error to the URL's /fail endpoint.
+func heartbeatPing(heartbeatURL string, cycleErr error) (*http.Request, error) {
+	u, err := url.Parse(heartbeatURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("heartbeatUrl must be an http or https URL, got %q", heartbeatURL)
+	}
+	if cycleErr == nil {
+		return http.NewRequest(http.MethodGet, u.String(), nil)
+	}
+	req, err := http.NewRequest(http.MethodPost, u.JoinPath("fail").String(), strings.NewReader(cycleErr.Error()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	return req, nil
+}
+
+// sendHeartbeat pings heartbeatUrl, if configured, with the outcome of a
+// cycle. A failed ping is logged; the monitor will notice the gap anyway.
+func sendHeartbeat(config AppConfig, cycleErr error) {
+	if config.HeartbeatURL == "" {
+		return
+	}
+	if config.ReadOnly {
+		slog.Info("Read-only mode: not sending heartbeat")
+		return
+	}
+	req, err := heartbeatPing(config.HeartbeatURL, cycleErr)
+	if err != nil {
+		slog.Error("Error building heartbeat", "err", err)
+		return
+	}
+	resp, err := heartbeatClient.Do(req)
+	if err != nil {
+		slog.Warn("Error sending heartbeat", "err", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		slog.Warn("Heartbeat was rejected", "status", resp.StatusCode)
+	}
+}
@@ -0,0 +1,38 @@
+package melanzana
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSendHeartbeat(t *testing.T) {
+	var pings []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		pings = append(pings, r.Method+" "+r.URL.Path+" "+string(body))
+	}))
+	defer server.Close()
+
+	config := AppConfig{HeartbeatURL: server.URL + "/ping/abc123"}
+	sendHeartbeat(config, nil)
+	sendHeartbeat(config, errors.New("no month could be fetched"))
+	config.ReadOnly = true
+	sendHeartbeat(config, nil)
+
+	want := []string{"GET /ping/abc123 ", "POST /ping/abc123/fail no month could be fetched"}
+	if len(pings) != len(want) {
+		t.Fatalf("pings = %q, want %q", pings, want)
+	}
+	for i := range want {
+		if pings[i] != want[i] {
+			t.Errorf("ping %d = %q, want %q", i, pings[i], want[i])
+		}
+	}
+
+	if _, err := heartbeatPing("hc-ping.com/abc123", nil); err == nil {
+		t.Errorf("heartbeatPing() without a scheme error = nil, want error")
+	}
+}
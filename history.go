@@ -0,0 +1,106 @@
+package melanzana
+
+import (
+	"time"
+
+	"github.com/pashbylogan/melanzana/pkg/store"
+)
+
+// Kinds of availability change recorded in the history.
+const (
+	eventAppeared    = "appeared"    // Slot became bookable
+	eventReappeared  = "reappeared"  // Slot became bookable again after being fully booked
+	eventIncreased   = "increased"   // More spaces opened up, e.g. a cancellation
+	eventDecreased   = "decreased"   // Some spaces were booked
+	eventDisappeared = "disappeared" // Slot was fully booked or withdrawn
+	eventExpired     = "expired"     // Slot's day passed while it was still open
+)
+
+// availabilityState replays events into the last event of every slot that is
+// currently open or was fully booked, keyed by appointmentKey.
+func availabilityState(events []AvailabilityEvent) map[string]AvailabilityEvent {
+	state := make(map[string]AvailabilityEvent)
+	for _, e := range events {
+		key := store.SlotID(e.Date, e.Time, e.Calendar)
+		switch e.Kind {
+		case eventExpired:
+			delete(state, key)
+		default:
+			state[key] = e
+		}
+	}
+	return state
+}
+
+// historySnapshot returns the slots a history state describes, with those
+// last seen disappearing marked booked.
+func historySnapshot(state map[string]AvailabilityEvent) Snapshot {
+	s := make(Snapshot, len(state))
+	for _, e := range state {
+		s[slotKey{e.Date, e.Time, e.Calendar}] = snapshotSlot{Spaces: e.Spaces, Booked: e.Kind == eventDisappeared}
+	}
+	return s
+}
+
+// historyEvents returns the history events recording changes found at now.
+// Booking windows aren't recorded in the history.
+func historyEvents(changes []Change, now time.Time) []AvailabilityEvent {
+	var events []AvailabilityEvent
+	for _, c := range changes {
+		event := AvailabilityEvent{At: now, Date: c.Slot.Date, Time: c.Slot.Time, Calendar: c.Slot.Calendar, Spaces: c.Slot.Spaces, PreviousSpaces: c.PreviousSpaces}
+		switch {
+		case c.Kind == SlotAdded && c.Reopened:
+			event.Kind = eventReappeared
+		case c.Kind == SlotAdded:
+			event.Kind = eventAppeared
+		case c.Kind == SpacesChanged && c.delta() > 0:
+			event.Kind = eventIncreased
+		case c.Kind == SpacesChanged:
+			event.Kind = eventDecreased
+		case c.Kind == SlotRemoved && c.Expired:
+			event.Kind = eventExpired
+		case c.Kind == SlotRemoved:
+			event.Kind = eventDisappeared
+		default:
+			continue
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// diffAvailability compares a scrape against the last known state and returns
+// the changes as history events, in scrape order followed by closed slots in
+// date order.
+func diffAvailability(state map[string]AvailabilityEvent, scraped []Appointment, now time.Time) []AvailabilityEvent {
+	return historyEvents(diffSnapshots(historySnapshot(state), scraped, now), now)
+}
+
+// DayTrend is a day's total open spaces and how that changed since the
+// previous cycle.
+type DayTrend struct {
+	Spaces int // Open spaces across all of the day's slots
+	Delta  int // Change since the previous cycle; negative when the day is draining
+}
+
+// dayTrends totals the scraped spaces for each of the given dates and works
+// out the change since the previous cycle from this cycle's changes.
+func dayTrends(dates []string, scraped []Appointment, changes []Change) map[string]DayTrend {
+	trends := make(map[string]DayTrend, len(dates))
+	for _, date := range dates {
+		trends[date] = DayTrend{}
+	}
+	for _, appt := range scraped {
+		if t, ok := trends[appt.Date]; ok {
+			t.Spaces += appt.Spaces
+			trends[appt.Date] = t
+		}
+	}
+	for _, c := range changes {
+		if t, ok := trends[c.Slot.Date]; ok && !c.Expired {
+			t.Delta += c.delta()
+			trends[c.Slot.Date] = t
+		}
+	}
+	return trends
+}
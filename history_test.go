@@ -0,0 +1,77 @@
+package melanzana
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiffAvailability(t *testing.T) {
+	day1 := time.Date(2024, 5, 15, 9, 0, 0, 0, time.UTC)
+	slot := func(date string, spaces int) Appointment {
+		return Appointment{Date: date, Time: "10:00 am – 10:30 am", Spaces: spaces, IsAvailable: true}
+	}
+
+	var history []AvailabilityEvent
+	cycle := func(now time.Time, scraped ...Appointment) []string {
+		events := diffAvailability(availabilityState(history), scraped, now)
+		history = append(history, events...)
+		var kinds []string
+		for _, e := range events {
+			kinds = append(kinds, e.Date+" "+e.Kind)
+		}
+		return kinds
+	}
+
+	tests := []struct {
+		name    string
+		now     time.Time
+		scraped []Appointment
+		want    []string
+	}{
+		{"FirstScrape", day1, []Appointment{slot("2024-05-15", 2), slot("2024-05-20", 1)}, []string{"2024-05-15 appeared", "2024-05-20 appeared"}},
+		{"NoChange", day1.Add(time.Hour), []Appointment{slot("2024-05-15", 2), slot("2024-05-20", 1)}, nil},
+		{"Booked", day1.Add(2 * time.Hour), []Appointment{slot("2024-05-15", 1), slot("2024-05-20", 1)}, []string{"2024-05-15 decreased"}},
+		{"Cancellation", day1.Add(3 * time.Hour), []Appointment{slot("2024-05-15", 1), slot("2024-05-20", 3)}, []string{"2024-05-20 increased"}},
+		{"FullyBooked", day1.Add(4 * time.Hour), []Appointment{slot("2024-05-15", 1)}, []string{"2024-05-20 disappeared"}},
+		{"DayPassed", day1.AddDate(0, 0, 1), nil, []string{"2024-05-15 expired"}},
+		{"Reappeared", day1.AddDate(0, 0, 1), []Appointment{slot("2024-05-20", 1)}, []string{"2024-05-20 reappeared"}},
+		{"BookedAgain", day1.AddDate(0, 0, 1).Add(time.Hour), nil, []string{"2024-05-20 disappeared"}},
+		{"StaysBooked", day1.AddDate(0, 0, 1).Add(2 * time.Hour), nil, nil},
+	}
+	for _, tt := range tests {
+		if got := cycle(tt.now, tt.scraped...); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: events = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if e := history[2]; e.Spaces != 1 || e.PreviousSpaces != 2 {
+		t.Errorf("decreased event = %+v, want 2 -> 1 spaces", e)
+	}
+}
+
+func TestDayTrends(t *testing.T) {
+	scraped := []Appointment{
+		{Date: "2024-06-14", Time: "10:00 am – 10:30 am", Spaces: 2},
+		{Date: "2024-06-14", Time: "10:30 am – 11:00 am", Spaces: 1},
+		{Date: "2024-06-15", Time: "10:00 am – 10:30 am", Spaces: 4},
+		{Date: "2024-06-16", Time: "10:00 am – 10:30 am", Spaces: 4},
+	}
+	changes := []Change{
+		{Kind: SpacesChanged, Slot: scraped[0], PreviousSpaces: 4},
+		{Kind: SlotRemoved, Slot: Appointment{Date: "2024-06-14", Time: "11:00 am – 11:30 am"}, PreviousSpaces: 2},
+		{Kind: SlotAdded, Slot: scraped[2]},
+		{Kind: SlotRemoved, Slot: Appointment{Date: "2024-06-13", Time: "10:00 am – 10:30 am"}, PreviousSpaces: 1, Expired: true},
+	}
+
+	got := dayTrends([]string{"2024-06-14", "2024-06-15", "2024-06-16", "2024-06-17"}, scraped, changes)
+	want := map[string]DayTrend{
+		"2024-06-14": {Spaces: 3, Delta: -4},
+		"2024-06-15": {Spaces: 4, Delta: 4},
+		"2024-06-16": {Spaces: 4, Delta: 0},
+		"2024-06-17": {Spaces: 0, Delta: 0},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("dayTrends() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,226 @@
+package melanzana
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// apiClient makes Cowlendar API requests. It is shared so that connections
+// are kept alive and reused across months and cycles, and is set from the
+// configuration at startup.
+var apiClient = newAPIClient(defaultConfig())
+
+// apiTransport, if set, stands in for the network under the clients
+// newAPIClient returns, so that tests and replays serve recorded responses
+// through the same User-Agent and rate limiting as live requests.
+var apiTransport http.RoundTripper
+
+// newAPIClient returns a client that gives up on slow connects and slow
+// requests, so a hung server can't block the scraper, identifies itself with
+// the configured User-Agent, and paces every request it makes, retries
+// included, with one rate limiter and as the server's rate limit headers ask.
+func newAPIClient(config AppConfig) *http.Client {
+	timeout := time.Duration(config.HTTPTimeoutSeconds) * time.Second
+	base := apiTransport
+	if base == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.DialContext = (&net.Dialer{
+			Timeout:   time.Duration(config.HTTPConnectTimeoutSeconds) * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext
+		transport.ResponseHeaderTimeout = timeout
+		if proxy, err := proxyURL(config); err == nil && proxy != nil {
+			transport.Proxy = http.ProxyURL(proxy)
+		}
+		base = transport
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: userAgentTransport{
+			next:      rateLimitedTransport{next: base, limiter: newRateLimiter(config.RequestsPerSecond, config.RequestBurst), pacer: apiPacer},
+			userAgent: userAgent(config),
+		},
+	}
+}
+
+// proxyURL returns the proxy configured for API requests, or nil to use the
+// standard HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+// socksProxy may be given as host:port.
+func proxyURL(config AppConfig) (*url.URL, error) {
+	switch {
+	case config.HTTPProxy != "" && config.SOCKSProxy != "":
+		return nil, fmt.Errorf("set only one of httpProxy and socksProxy")
+	case config.HTTPProxy != "":
+		u, err := url.Parse(config.HTTPProxy)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("httpProxy must be an http or https URL, got %q", config.HTTPProxy)
+		}
+		return u, nil
+	case config.SOCKSProxy != "":
+		raw := config.SOCKSProxy
+		if !strings.Contains(raw, "://") {
+			raw = "socks5://" + raw
+		}
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "socks5" && u.Scheme != "socks5h") || u.Host == "" {
+			return nil, fmt.Errorf("socksProxy must be host:port or a socks5 URL, got %q", config.SOCKSProxy)
+		}
+		return u, nil
+	}
+	return nil, nil
+}
+
+// userAgent returns the configured User-Agent, or one naming this version.
+func userAgent(config AppConfig) string {
+	if config.UserAgent != "" {
+		return config.UserAgent
+	}
+	return "melanzana-scraper/" + version
+}
+
+// userAgentTransport sets the User-Agent on requests that don't have one.
+type userAgentTransport struct {
+	next      http.RoundTripper
+	userAgent string
+}
+
+func (t userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", t.userAgent)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// rateLimitedTransport waits for the server's pacer and the limiter before
+// each request, and has the pacer observe each response.
+type rateLimitedTransport struct {
+	next    http.RoundTripper
+	limiter *rateLimiter
+	pacer   *serverPacer
+}
+
+func (t rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.pacer.wait(req.Context()); err != nil {
+		return nil, err
+	}
+	if err := t.limiter.wait(req.Context()); err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err == nil {
+		t.pacer.observe(resp)
+	}
+	return resp, err
+}
+
+// outboundTransport carries requests to services other than Cowlendar:
+// email providers, Telegram, OAuth2, heartbeats and the remote state
+// stores. Each host is paced by its own limiter, at the rate Cowlendar
+// requests are, so one busy service doesn't hold back the others.
+// setupScraper sets the rate from the config.
+var outboundTransport = &hostLimitedTransport{next: http.DefaultTransport}
+
+// hostLimitedTransport paces requests with a rate limiter per host.
+type hostLimitedTransport struct {
+	next http.RoundTripper
+
+	mu       sync.Mutex
+	rps      float64
+	burst    int
+	limiters map[string]*rateLimiter
+}
+
+// configure sets the rate each host is allowed, dropping existing limiters.
+func (t *hostLimitedTransport) configure(rps float64, burst int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rps, t.burst, t.limiters = rps, burst, nil
+}
+
+// limiter returns host's limiter, or nil if requests aren't limited.
+func (t *hostLimitedTransport) limiter(host string) *rateLimiter {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.rps <= 0 {
+		return nil
+	}
+	if t.limiters == nil {
+		t.limiters = make(map[string]*rateLimiter)
+	}
+	l, ok := t.limiters[host]
+	if !ok {
+		l = newRateLimiter(t.rps, t.burst)
+		t.limiters[host] = l
+	}
+	return l
+}
+
+func (t *hostLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter(req.URL.Host).wait(req.Context()); err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(req)
+}
+
+// rateLimiter is a token bucket: it holds up to burst tokens, refilled at
+// rate per second, and each request takes one. A nil limiter never waits.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu     sync.Mutex
+	tokens float64 // Negative while requests are queued for tokens not yet refilled
+	last   time.Time
+}
+
+// newRateLimiter returns a limiter allowing rps requests per second with
+// bursts of up to burst, or nil if rps is not positive.
+func newRateLimiter(rps float64, burst int) *rateLimiter {
+	if rps <= 0 {
+		return nil
+	}
+	burst = max(burst, 1)
+	return &rateLimiter{rate: rps, burst: float64(burst), tokens: float64(burst), now: clockNow}
+}
+
+// reserve takes a token and returns how long to wait before it is available.
+// Callers are served in the order they reserve.
+func (l *rateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if !l.last.IsZero() {
+		l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// wait blocks until a token is available or ctx is done.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	d := l.reserve()
+	if d <= 0 {
+		return nil
+	}
+	select {
+	case <-clock.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,128 @@
+package melanzana
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// icsTimeFormat is an iCalendar UTC date-time.
+const icsTimeFormat = "20060102T150405Z"
+
+// writeICS writes appointments as an iCalendar feed with one VEVENT per
+// slot, so calendar apps can subscribe to current availability. Events carry
+// a UID derived from the slot, so a subscribed calendar updates a slot in
+// place rather than duplicating it, and drops it once it's booked.
+func writeICS(w io.Writer, appointments []Appointment, now time.Time) error {
+	var b strings.Builder
+	line := func(s string) { b.WriteString(foldICSLine(s) + "\r\n") }
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//Melanzana//Appointment Scraper//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:Melanzana availability")
+	for _, appt := range appointments {
+		var when []string
+		if start, end, err := parseSlotTimes(appt); err == nil {
+			when = []string{"DTSTART:" + start.UTC().Format(icsTimeFormat), "DTEND:" + end.UTC().Format(icsTimeFormat)}
+		} else if day, err := time.Parse("2006-01-02", appt.Date); err == nil {
+			when = []string{"DTSTART;VALUE=DATE:" + day.Format("20060102")}
+		} else {
+			slog.Debug("Leaving a slot with an unrecognized date out of the calendar feed", "date", appt.Date, "time", appt.Time)
+			continue
+		}
+		uid := sha1.Sum([]byte(appointmentKey(appt)))
+		line("BEGIN:VEVENT")
+		line("UID:" + hex.EncodeToString(uid[:]) + "@melanzana")
+		line("DTSTAMP:" + now.UTC().Format(icsTimeFormat))
+		for _, l := range when {
+			line(l)
+		}
+		line("SUMMARY:" + escapeICSText(icsSummary(appt)))
+		link := slotBookingLink(appt)
+		line("DESCRIPTION:" + escapeICSText(appt.Time+"\nBook at: "+link))
+		line("URL:" + link)
+		line("TRANSP:TRANSPARENT")
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// icsSummary is an event's title, e.g. "Melanzana: 2 spaces open".
+func icsSummary(appt Appointment) string {
+	name := "Melanzana"
+	if appt.Calendar != "" {
+		name += " " + appt.Calendar
+	}
+	if appt.Spaces == 1 {
+		return name + ": 1 space open"
+	}
+	return fmt.Sprintf("%s: %d spaces open", name, appt.Spaces)
+}
+
+// escapeICSText escapes a TEXT property value (RFC 5545 section 3.3.11).
+func escapeICSText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(s)
+}
+
+// foldICSLine splits a content line longer than 75 octets into continuation
+// lines (RFC 5545 section 3.1), without splitting a UTF-8 sequence.
+func foldICSLine(s string) string {
+	const limit = 75
+	var b strings.Builder
+	width := 0
+	for _, r := range s {
+		n := len(string(r))
+		if width+n > limit {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += n
+	}
+	return b.String()
+}
+
+// writeICSFile replaces icsFile, if configured, with a feed of appointments.
+// The file is renamed into place so a web server never serves a partial feed.
+func writeICSFile(config AppConfig, appointments []Appointment, now time.Time) {
+	if config.ICSFile == "" || config.ReadOnly {
+		return
+	}
+	if err := replaceICSFile(config.ICSFile, appointments, now); err != nil {
+		slog.Error("Error writing calendar feed", "file", config.ICSFile, "err", err)
+	}
+}
+
+func replaceICSFile(path string, appointments []Appointment, now time.Time) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create calendar feed: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := writeICS(tmp, appointments, now); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write calendar feed: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write calendar feed: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to write calendar feed: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
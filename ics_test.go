@@ -0,0 +1,81 @@
+package melanzana
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteICS(t *testing.T) {
+	defer func(name string) { sourceTimezone = name }(sourceTimezone)
+	sourceTimezone = "America/Denver"
+	defer func(url string) { bookingURL = url }(bookingURL)
+	bookingURL = "https://example.com/book?a=1,2"
+
+	now := time.Date(2024, 5, 15, 9, 0, 0, 0, time.UTC)
+	appointments := []Appointment{
+		{Date: "2024-05-20", Time: "10:00 am – 10:30 am", Spaces: 2},
+		{Date: "2024-05-21", Time: "all day", Spaces: 1, Calendar: "Tailoring"},
+		{Date: "someday", Time: "10:00 am – 10:30 am", Spaces: 1},
+	}
+	var b strings.Builder
+	if err := writeICS(&b, appointments, now); err != nil {
+		t.Fatalf("writeICS() error = %v", err)
+	}
+	feed := b.String()
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\nVERSION:2.0\r\n",
+		"DTSTAMP:20240515T090000Z\r\n",
+		"DTSTART:20240520T160000Z\r\nDTEND:20240520T163000Z\r\n",
+		"SUMMARY:Melanzana: 2 spaces open\r\n",
+		"DTSTART;VALUE=DATE:20240521\r\n",
+		"SUMMARY:Melanzana Tailoring: 1 space open\r\n",
+		`DESCRIPTION:all day\nBook at: https://example.com/book?a=1\,2` + "\r\n",
+		"URL:https://example.com/book?a=1,2\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(feed, want) {
+			t.Errorf("feed is missing %q:\n%s", want, feed)
+		}
+	}
+	if n := strings.Count(feed, "BEGIN:VEVENT"); n != 2 {
+		t.Errorf("feed has %d events, want 2, leaving out the unrecognized date", n)
+	}
+
+	var again strings.Builder
+	writeICS(&again, appointments[:1], now.Add(time.Hour))
+	if uid := icsProperty(feed, "UID"); uid == "" || uid != icsProperty(again.String(), "UID") {
+		t.Errorf("UIDs %q and %q differ between feeds, want a stable UID per slot", uid, icsProperty(again.String(), "UID"))
+	}
+}
+
+// icsProperty returns the value of the first property called name.
+func icsProperty(feed, name string) string {
+	for _, line := range strings.Split(feed, "\r\n") {
+		if value, ok := strings.CutPrefix(line, name+":"); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+func TestFoldICSLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"Short", "SUMMARY:Open", "SUMMARY:Open"},
+		{"Exactly75", strings.Repeat("a", 75), strings.Repeat("a", 75)},
+		{"Long", strings.Repeat("a", 80), strings.Repeat("a", 75) + "\r\n " + strings.Repeat("a", 5)},
+		{"Multibyte", strings.Repeat("a", 74) + "–b", strings.Repeat("a", 74) + "\r\n –b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := foldICSLine(tt.line); got != tt.want {
+				t.Errorf("foldICSLine() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package melanzana
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dialIMAP connects to an IMAP server over TLS; a variable so tests can use
+// a plain local connection.
+var dialIMAP = func(addr string, timeout time.Duration) (net.Conn, error) {
+	return tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", addr, nil)
+}
+
+// imapTimeout bounds each exchange with the IMAP server.
+const imapTimeout = 30 * time.Second
+
+// imapLiteral matches the {size} announcing a literal at the end of a line.
+var imapLiteral = regexp.MustCompile(`\{(\d+)\}$`)
+
+// imapClient speaks just enough IMAP4rev1 (RFC 3501) to read and flag new
+// messages in one mailbox.
+type imapClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+	tag  int
+}
+
+// imapResponse is one untagged response line, with the literals it carried.
+type imapResponse struct {
+	line     string
+	literals [][]byte
+}
+
+func newIMAPClient(addr, username, password, mailbox string) (*imapClient, error) {
+	conn, err := dialIMAP(addr, imapTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to IMAP server %s: %w", addr, err)
+	}
+	c := &imapClient{conn: conn, r: bufio.NewReader(conn)}
+	conn.SetDeadline(time.Now().Add(imapTimeout))
+	greeting, err := c.r.ReadString('\n')
+	if err != nil || !strings.HasPrefix(greeting, "* OK") {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected IMAP greeting from %s: %q %v", addr, strings.TrimSpace(greeting), err)
+	}
+	if _, err := c.command("LOGIN %s %s", imapQuote(username), imapQuote(password)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("IMAP login failed: %w", err)
+	}
+	if _, err := c.command("SELECT %s", imapQuote(mailbox)); err != nil {
+		c.close()
+		return nil, fmt.Errorf("failed to open mailbox %s: %w", mailbox, err)
+	}
+	return c, nil
+}
+
+// unseen returns the UIDs of the messages not yet marked seen.
+func (c *imapClient) unseen() ([]string, error) {
+	responses, err := c.command("UID SEARCH UNSEEN")
+	if err != nil {
+		return nil, err
+	}
+	var uids []string
+	for _, resp := range responses {
+		if rest, ok := strings.CutPrefix(resp.line, "* SEARCH"); ok {
+			uids = append(uids, strings.Fields(rest)...)
+		}
+	}
+	return uids, nil
+}
+
+// fetch returns a message's raw content without marking it seen.
+func (c *imapClient) fetch(uid string) ([]byte, error) {
+	responses, err := c.command("UID FETCH %s BODY.PEEK[]", uid)
+	if err != nil {
+		return nil, err
+	}
+	for _, resp := range responses {
+		if strings.Contains(resp.line, "FETCH") && len(resp.literals) > 0 {
+			return resp.literals[0], nil
+		}
+	}
+	return nil, fmt.Errorf("IMAP server returned no content for message %s", uid)
+}
+
+// markSeen flags a message as seen, so it isn't handled again.
+func (c *imapClient) markSeen(uid string) error {
+	_, err := c.command(`UID STORE %s +FLAGS.SILENT (\Seen)`, uid)
+	return err
+}
+
+func (c *imapClient) close() {
+	c.command("LOGOUT")
+	c.conn.Close()
+}
+
+// command sends a tagged command and returns the untagged responses, or an
+// error if the server doesn't answer OK.
+func (c *imapClient) command(format string, args ...any) ([]imapResponse, error) {
+	c.tag++
+	tag := fmt.Sprintf("A%03d", c.tag)
+	c.conn.SetDeadline(time.Now().Add(imapTimeout))
+	if _, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, fmt.Sprintf(format, args...)); err != nil {
+		return nil, fmt.Errorf("failed to send IMAP command: %w", err)
+	}
+
+	var responses []imapResponse
+	for {
+		resp, err := c.readResponse()
+		if err != nil {
+			return nil, err
+		}
+		if status, ok := strings.CutPrefix(resp.line, tag+" "); ok {
+			if !strings.HasPrefix(status, "OK") {
+				return nil, fmt.Errorf("IMAP server refused %s: %s", strings.Fields(format)[0], status)
+			}
+			return responses, nil
+		}
+		responses = append(responses, resp)
+	}
+}
+
+// readResponse reads one response line, following any literals it
+// announces to the end of the line they continue.
+func (c *imapClient) readResponse() (imapResponse, error) {
+	var resp imapResponse
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return resp, fmt.Errorf("failed to read IMAP response: %w", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		resp.line += line
+		m := imapLiteral.FindStringSubmatch(line)
+		if m == nil {
+			return resp, nil
+		}
+		size, err := strconv.Atoi(m[1])
+		if err != nil || size > 16<<20 {
+			return resp, fmt.Errorf("IMAP literal of %s bytes is too large", m[1])
+		}
+		literal := make([]byte, size)
+		if _, err := io.ReadFull(c.r, literal); err != nil {
+			return resp, fmt.Errorf("failed to read IMAP response: %w", err)
+		}
+		resp.literals = append(resp.literals, literal)
+	}
+}
+
+// imapQuote writes s as an IMAP quoted string.
+func imapQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
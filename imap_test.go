@@ -0,0 +1,162 @@
+package melanzana
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeIMAP accepts one imapClient, greets it, and answers each command
+// with answer's untagged responses and tagged status until it logs out.
+func fakeIMAP(t *testing.T, greeting string, answer func(command string) (untagged, status string)) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	saved := dialIMAP
+	t.Cleanup(func() { dialIMAP = saved })
+	dialIMAP = func(string, time.Duration) (net.Conn, error) { return net.Dial("tcp", listener.Addr().String()) }
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprint(conn, greeting+"\r\n")
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			tag, command, _ := strings.Cut(scanner.Text(), " ")
+			untagged, status := answer(command)
+			fmt.Fprintf(conn, "%s%s %s\r\n", untagged, tag, status)
+			if command == "LOGOUT" {
+				return
+			}
+		}
+	}()
+}
+
+// serveIMAP answers an imapClient's commands with messages, recording the
+// UIDs marked seen.
+func serveIMAP(t *testing.T, messages map[string]string) (seen chan string) {
+	t.Helper()
+	seen = make(chan string, len(messages))
+	fakeIMAP(t, "* OK ready", func(command string) (string, string) {
+		fields := strings.Fields(command)
+		switch {
+		case strings.HasPrefix(command, "UID SEARCH"):
+			var uids []string
+			for uid := range messages {
+				uids = append(uids, uid)
+			}
+			slices.Sort(uids)
+			return fmt.Sprintf("* SEARCH %s\r\n", strings.Join(uids, " ")), "OK done"
+		case strings.HasPrefix(command, "UID FETCH"):
+			msg := messages[fields[2]]
+			return fmt.Sprintf("* 1 FETCH (UID %s BODY[] {%d}\r\n%s)\r\n", fields[2], len(msg), msg), "OK done"
+		case strings.HasPrefix(command, "UID STORE"):
+			seen <- fields[2]
+		case command == "LOGOUT":
+			close(seen)
+		}
+		return "", "OK done"
+	})
+	return seen
+}
+
+func TestIMAPClient(t *testing.T) {
+	// The message holds what could pass for the end of a response or
+	// another literal, which must be read as its content.
+	msg := "From: grandma@example.com\r\nSubject: pause 1w\r\n\r\nA {5}\r\nB)\r\n"
+	commands := make(chan string, 10)
+	fakeIMAP(t, "* OK ready", func(command string) (string, string) {
+		commands <- command
+		switch {
+		case strings.HasPrefix(command, "UID SEARCH"):
+			return "* SEARCH 1 3\r\n", "OK done"
+		case command == "UID FETCH 3 BODY.PEEK[]":
+			return fmt.Sprintf("* 3 FETCH (UID 3 BODY[] {%d}\r\n%s)\r\n", len(msg), msg), "OK done"
+		case strings.HasPrefix(command, "UID FETCH"):
+			return "* 1 FETCH (UID 1 FLAGS ())\r\n", "OK done"
+		}
+		return "", "OK done"
+	})
+
+	client, err := newIMAPClient("imap.example.com:993", "me@example.com", `pa"ss\word`, "INBOX")
+	if err != nil {
+		t.Fatalf("newIMAPClient() error = %v", err)
+	}
+	uids, err := client.unseen()
+	if err != nil || !slices.Equal(uids, []string{"1", "3"}) {
+		t.Errorf("unseen() = %v, %v; want [1 3]", uids, err)
+	}
+	if raw, err := client.fetch("3"); err != nil || string(raw) != msg {
+		t.Errorf("fetch(3) = %q, %v; want the message", raw, err)
+	}
+	if _, err := client.fetch("1"); err == nil {
+		t.Errorf("fetch() of a message the server returned no content for error = nil, want error")
+	}
+	if err := client.markSeen("3"); err != nil {
+		t.Errorf("markSeen() error = %v", err)
+	}
+	client.close()
+
+	var sent []string
+	for len(commands) > 0 {
+		sent = append(sent, <-commands)
+	}
+	want := []string{
+		`LOGIN "me@example.com" "pa\"ss\\word"`,
+		`SELECT "INBOX"`,
+		`UID SEARCH UNSEEN`,
+		`UID FETCH 3 BODY.PEEK[]`,
+		`UID FETCH 1 BODY.PEEK[]`,
+		`UID STORE 3 +FLAGS.SILENT (\Seen)`,
+		`LOGOUT`,
+	}
+	if !slices.Equal(sent, want) {
+		t.Errorf("commands sent = %q, want %q", sent, want)
+	}
+}
+
+func TestIMAPClientErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		greeting string
+		refuse   string // Command answered NO
+		fetch    string // Response to UID FETCH
+	}{
+		{name: "Greeting", greeting: "* BYE too busy"},
+		{name: "Login", greeting: "* OK ready", refuse: "LOGIN"},
+		{name: "Mailbox", greeting: "* OK ready", refuse: "SELECT"},
+		{name: "Fetch", greeting: "* OK ready", refuse: "UID"},
+		{name: "HugeLiteral", greeting: "* OK ready", fetch: "* 1 FETCH (UID 1 BODY[] {99999999}\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeIMAP(t, tt.greeting, func(command string) (string, string) {
+				if tt.refuse != "" && strings.HasPrefix(command, tt.refuse) {
+					return "", "NO refused"
+				}
+				if strings.HasPrefix(command, "UID FETCH") {
+					return tt.fetch, "OK done"
+				}
+				return "", "OK done"
+			})
+			client, err := newIMAPClient("imap.example.com:993", "me", "secret", "INBOX")
+			if err == nil {
+				defer client.close()
+				_, err = client.fetch("1")
+			}
+			if err == nil {
+				t.Errorf("error = nil, want the %s to fail", tt.name)
+			}
+		})
+	}
+}
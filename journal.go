@@ -0,0 +1,272 @@
+package melanzana
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"time"
+)
+
+// Journal entry states.
+const (
+	journalPending = "pending" // About to be sent
+	journalSent    = "sent"    // Accepted by the mail provider
+	journalCarried = "carried" // Sent by an earlier run, whose slots are still owed to other recipients
+)
+
+// notifyJournal is a write-ahead log of the messages a cycle sends, so that
+// slots notified just before a crash, and not yet recorded as seen, aren't
+// notified again by the next run. Each message is logged as pending before
+// it is sent and as sent after; the log is cleared once the cycle has
+// recorded its slots as seen. An empty path disables it.
+type notifyJournal struct {
+	path string
+}
+
+// journalEntry is one line of the journal.
+type journalEntry struct {
+	At           time.Time     `json:"at"`
+	State        string        `json:"state"`
+	Recipient    string        `json:"recipient"`
+	Appointments []Appointment `json:"appointments"`
+}
+
+// record appends an entry and syncs it to disk before returning.
+func (j notifyJournal) record(state, recipient string, appointments []Appointment, at time.Time) error {
+	if j.path == "" || len(appointments) == 0 {
+		return nil
+	}
+	line, err := json.Marshal(journalEntry{At: at, State: state, Recipient: recipient, Appointments: appointments})
+	if err != nil {
+		return fmt.Errorf("failed to encode journal entry: %w", err)
+	}
+	f, err := os.OpenFile(j.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open notification journal %s: %w", j.path, err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write notification journal %s: %w", j.path, err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync notification journal %s: %w", j.path, err)
+	}
+	return f.Close()
+}
+
+// entries reads the journal, returning none if it doesn't exist. A line cut
+// short by a crash while it was written is ignored.
+func (j notifyJournal) entries() ([]journalEntry, error) {
+	if j.path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(j.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notification journal %s: %w", j.path, err)
+	}
+	defer f.Close()
+
+	var entries []journalEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		var e journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			slog.Warn("Skipping unreadable notification journal entry", "file", j.path, "err", err)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read notification journal %s: %w", j.path, err)
+	}
+	return entries, nil
+}
+
+// clear removes the journal.
+func (j notifyJournal) clear() error {
+	if j.path == "" {
+		return nil
+	}
+	if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to clear notification journal %s: %w", j.path, err)
+	}
+	return nil
+}
+
+// carried reports whether a run that stopped already sent each of
+// appointments to recipient, so it needn't be sent again.
+func (j notifyJournal) carried(recipient string, appointments []Appointment) bool {
+	entries, err := j.entries()
+	if err != nil {
+		slog.Warn("Error reading notification journal", "err", err)
+		return false
+	}
+	var sent []Appointment
+	for _, e := range entries {
+		if e.State == journalCarried && e.Recipient == recipient {
+			sent = append(sent, e.Appointments...)
+		}
+	}
+	have := newSlotSet(sent)
+	for _, appt := range appointments {
+		if !have.has(appt) {
+			return false
+		}
+	}
+	return len(appointments) > 0
+}
+
+// sendJournaled sends a message about appointments to one recipient,
+// logging it in the journal before and after. A journal that can't be
+// written doesn't stop the message.
+func sendJournaled(journal notifyJournal, to string, appointments []Appointment, send func() error) error {
+	at := clock.Now()
+	if err := journal.record(journalPending, to, appointments, at); err != nil {
+		slog.Warn("Error writing notification journal", "err", err)
+	}
+	if err := send(); err != nil {
+		return err
+	}
+	if err := journal.record(journalSent, to, appointments, at); err != nil {
+		slog.Warn("Error writing notification journal", "err", err)
+	}
+	return nil
+}
+
+// reconcileJournal records the slots of messages a previous run sent to
+// every recipient they were for, but stopped before recording, as seen, and
+// returns the updated seen appointments. intended returns the recipients a
+// slot is for, as journaled. Slots some recipients are still owed stay
+// unseen, to be notified again; the journal keeps who already has them, so
+// that they aren't sent to them twice.
+func reconcileJournal(j notifyJournal, store Store, seen []Appointment, intended func(Appointment) []string) []Appointment {
+	records, carried, err := recoverJournal(j, seen, intended)
+	if err != nil {
+		slog.Warn("Error reading notification journal", "err", err)
+		return seen
+	}
+	if len(records) > 0 {
+		slog.Info("Recording slots notified before the previous run stopped as seen", "count", len(records))
+		if err := store.MarkSeen(records); err != nil {
+			slog.Error("Error saving appointments from the notification journal", "err", err)
+			return seen
+		}
+		if reloaded, err := store.Load(); err != nil {
+			slog.Warn("Error reloading seen appointments", "err", err)
+			seen = append(seen, records...)
+		} else {
+			seen = reloaded
+		}
+	}
+	if err := j.clear(); err != nil {
+		slog.Warn("Error clearing notification journal", "err", err)
+	}
+	if len(carried) > 0 {
+		slog.Info("Slots notified to some recipients before the previous run stopped will be sent to the rest", "recipients", len(carried))
+	}
+	for _, e := range carried {
+		if err := j.record(journalCarried, e.Recipient, e.Appointments, e.At); err != nil {
+			slog.Warn("Error writing notification journal", "err", err)
+		}
+	}
+	return seen
+}
+
+// journalRecipients returns, for each slot, the recipients config would send
+// it to, as they are named in the journal. If the recipients can't be
+// loaded, it returns nil, for which every slot sent to anyone counts as
+// sent to everyone.
+func journalRecipients(config AppConfig) func(Appointment) []string {
+	recipients, err := resolveRecipients(config)
+	if err != nil {
+		slog.Warn("Error loading recipients to reconcile the notification journal", "err", err)
+		return nil
+	}
+	return func(appt Appointment) []string {
+		var names []string
+		for _, r := range recipients {
+			if r.PausedUntil != nil && clock.Now().Before(*r.PausedUntil) || !r.matches(appt) {
+				continue
+			}
+			for _, ch := range r.channels() {
+				names = append(names, ch.String())
+			}
+		}
+		return names
+	}
+}
+
+// recoverJournal finds the messages a previous run sent but didn't get to
+// record as seen. It returns seen records for the slots sent to every
+// recipient intended returns for them, stamped with when they were last
+// sent, and carried entries for the recipients already sent the others.
+// With a nil intended, a slot sent to anyone counts as sent to everyone.
+// Messages left pending may or may not have been sent; their slots are
+// notified again rather than risk never being notified.
+func recoverJournal(j notifyJournal, seen []Appointment, intended func(Appointment) []string) (records []Appointment, carried []journalEntry, err error) {
+	entries, err := j.entries()
+	if err != nil || len(entries) == 0 {
+		return nil, nil, err
+	}
+	sent := make(map[string]bool)
+	sentTo := make(map[slotKey]map[string]time.Time) // When each slot was sent to each recipient
+	var slots []Appointment
+	for _, e := range entries {
+		if e.State != journalSent && e.State != journalCarried {
+			continue
+		}
+		sent[e.Recipient+"|"+e.At.String()] = true
+		for _, appt := range e.Appointments {
+			key := slotKey{appt.Date, appt.Time, appt.Calendar}
+			if sentTo[key] == nil {
+				sentTo[key] = make(map[string]time.Time)
+				slots = append(slots, appt)
+			}
+			if e.At.After(sentTo[key][e.Recipient]) {
+				sentTo[key][e.Recipient] = e.At
+			}
+		}
+	}
+	for _, appt := range slots {
+		to := sentTo[slotKey{appt.Date, appt.Time, appt.Calendar}]
+		owed := false
+		if intended != nil {
+			for _, r := range intended(appt) {
+				if _, ok := to[r]; !ok {
+					owed = true
+				}
+			}
+		}
+		if owed {
+			for r, at := range to {
+				carried = append(carried, journalEntry{At: at, State: journalCarried, Recipient: r, Appointments: []Appointment{appt}})
+			}
+			continue
+		}
+		var last time.Time
+		for _, at := range to {
+			if at.After(last) {
+				last = at
+			}
+		}
+		records = append(records, seenRecords(seen, []Appointment{appt}, nil, last)...)
+	}
+	sort.Slice(carried, func(i, k int) bool {
+		return carried[i].Recipient+appointmentKey(carried[i].Appointments[0]) < carried[k].Recipient+appointmentKey(carried[k].Appointments[0])
+	})
+	for _, e := range entries {
+		if e.State == journalPending && !sent[e.Recipient+"|"+e.At.String()] {
+			slog.Warn("A message was being sent when the previous run stopped; its slots will be notified again",
+				"recipient", e.Recipient, "at", e.At, "slots", len(e.Appointments))
+		}
+	}
+	return records, carried, nil
+}
@@ -0,0 +1,167 @@
+package melanzana
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNotifyJournal(t *testing.T) {
+	j := notifyJournal{filepath.Join(t.TempDir(), "journal.jsonl")}
+	at := time.Date(2099, 7, 1, 12, 0, 0, 0, time.UTC)
+	appts := []Appointment{{Date: "2099-07-06", Time: "10:00 am – 10:30 am"}}
+
+	if entries, err := j.entries(); err != nil || len(entries) != 0 {
+		t.Fatalf("entries() of a missing journal = %+v, %v; want none", entries, err)
+	}
+	for _, state := range []string{journalPending, journalSent} {
+		if err := j.record(state, "me@example.com", appts, at); err != nil {
+			t.Fatalf("record(%s) error = %v", state, err)
+		}
+	}
+	if err := j.record(journalPending, "me@example.com", nil, at); err != nil {
+		t.Fatalf("record() without appointments error = %v", err)
+	}
+	// A line cut short by a crash.
+	f, err := os.OpenFile(j.path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"at": "2099-07-01T12:05:00Z", "state": "pen`)
+	f.Close()
+
+	entries, err := j.entries()
+	if err != nil || len(entries) != 2 || entries[1].State != journalSent || !entries[1].At.Equal(at) {
+		t.Errorf("entries() = %+v, %v; want the pending and sent entries", entries, err)
+	}
+	if err := j.clear(); err != nil {
+		t.Fatalf("clear() error = %v", err)
+	}
+	if _, err := os.Stat(j.path); !os.IsNotExist(err) {
+		t.Errorf("journal still exists after clear(): %v", err)
+	}
+	if err := j.clear(); err != nil {
+		t.Errorf("clear() of a missing journal error = %v", err)
+	}
+}
+
+func TestRunWatchReconcilesJournal(t *testing.T) {
+	now := time.Date(2099, 7, 1, 12, 0, 0, 0, time.UTC)
+	fixClock(t, now)
+	var messages int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		messages++
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+	defer func(url string) { sendGridURL = url }(sendGridURL)
+	sendGridURL = server.URL
+
+	dir := t.TempDir()
+	config := AppConfig{
+		EmailProvider:     "sendgrid",
+		EmailAPIKey:       "key",
+		FromEmail:         "from@example.com",
+		ToEmails:          []string{"me@example.com"},
+		DataFile:          filepath.Join(dir, "seen.json"),
+		HistoryFile:       filepath.Join(dir, "history.jsonl"),
+		StoreSpoolFile:    filepath.Join(dir, "spool.json"),
+		NotifyJournalFile: filepath.Join(dir, "journal.jsonl"),
+	}
+	sent := Appointment{Date: "2099-07-06", Time: "10:00 am – 10:30 am", Spaces: 1}
+	pending := Appointment{Date: "2099-07-07", Time: "10:00 am – 10:30 am", Spaces: 1}
+
+	// The previous run stopped after sending one message and while sending
+	// another, before saving either's slots.
+	journal := notifyJournal{config.NotifyJournalFile}
+	before := now.Add(-5 * time.Minute)
+	journal.record(journalPending, "me@example.com", []Appointment{sent}, before)
+	journal.record(journalSent, "me@example.com", []Appointment{sent}, before)
+	journal.record(journalPending, "me@example.com", []Appointment{pending}, before.Add(time.Second))
+
+	found, _, err := runWatch(config, "", []Appointment{sent, pending}, nil, RenderOptions{})
+	if err != nil {
+		t.Fatalf("runWatch() error = %v", err)
+	}
+	if len(found) != 1 || found[0].Date != pending.Date || messages != 1 {
+		t.Errorf("runWatch() found %+v and sent %d messages; want only the pending slot, in 1 message", found, messages)
+	}
+	seen, err := loadSeenAppointments(config.DataFile, nil)
+	if err != nil || len(seen) != 2 {
+		t.Fatalf("seen after runWatch() = %+v, %v; want both slots", seen, err)
+	}
+	for _, appt := range seen {
+		if appt.Date == sent.Date && !appt.LastNotifiedAt.Equal(before) {
+			t.Errorf("journaled slot lastNotifiedAt = %v, want when it was sent, %v", appt.LastNotifiedAt, before)
+		}
+	}
+	if _, err := os.Stat(config.NotifyJournalFile); !os.IsNotExist(err) {
+		t.Errorf("journal still exists after the slots were saved: %v", err)
+	}
+}
+
+// TestRunWatchReconcilesJournalPerRecipient checks that a slot the previous
+// run sent to one recipient but not another is sent to the other only.
+func TestRunWatchReconcilesJournalPerRecipient(t *testing.T) {
+	now := time.Date(2099, 7, 1, 12, 0, 0, 0, time.UTC)
+	fixClock(t, now)
+	var sentTo []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		for _, addr := range []string{"me@example.com", "you@example.com"} {
+			if strings.Contains(string(body), addr) {
+				sentTo = append(sentTo, addr)
+			}
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+	defer func(url string) { sendGridURL = url }(sendGridURL)
+	sendGridURL = server.URL
+
+	dir := t.TempDir()
+	config := AppConfig{
+		EmailProvider:     "sendgrid",
+		EmailAPIKey:       "key",
+		FromEmail:         "from@example.com",
+		ToEmails:          []string{"me@example.com", "you@example.com"},
+		DataFile:          filepath.Join(dir, "seen.json"),
+		HistoryFile:       filepath.Join(dir, "history.jsonl"),
+		StoreSpoolFile:    filepath.Join(dir, "spool.json"),
+		NotifyJournalFile: filepath.Join(dir, "journal.jsonl"),
+	}
+	slot := Appointment{Date: "2099-07-06", Time: "10:00 am – 10:30 am", Spaces: 1}
+
+	// The previous run sent the slot to me and stopped while sending it to you.
+	journal := notifyJournal{config.NotifyJournalFile}
+	before := now.Add(-5 * time.Minute)
+	journal.record(journalPending, "me@example.com", []Appointment{slot}, before)
+	journal.record(journalSent, "me@example.com", []Appointment{slot}, before)
+	journal.record(journalPending, "you@example.com", []Appointment{slot}, before)
+
+	found, _, err := runWatch(config, "", []Appointment{slot}, nil, RenderOptions{})
+	if err != nil {
+		t.Fatalf("runWatch() error = %v", err)
+	}
+	if len(found) != 1 || !reflect.DeepEqual(sentTo, []string{"you@example.com"}) {
+		t.Errorf("runWatch() found %+v and sent to %v; want the slot sent to you@example.com only", found, sentTo)
+	}
+	if seen, err := loadSeenAppointments(config.DataFile, nil); err != nil || len(seen) != 1 {
+		t.Errorf("seen after runWatch() = %+v, %v; want the slot", seen, err)
+	}
+	if _, err := os.Stat(config.NotifyJournalFile); !os.IsNotExist(err) {
+		t.Errorf("journal still exists after the slot was saved: %v", err)
+	}
+
+	// Once everyone has it, it isn't sent again.
+	sentTo = nil
+	if found, _, err := runWatch(config, "", []Appointment{slot}, nil, RenderOptions{}); err != nil || len(found) != 0 || len(sentTo) != 0 {
+		t.Errorf("second runWatch() = %+v, %v and sent to %v; want nothing new", found, err, sentTo)
+	}
+}
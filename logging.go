@@ -0,0 +1,95 @@
+package melanzana
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// currentCycle is the ID of the scraping cycle in progress, or "" between
+// cycles. Every log record made during a cycle carries it as "cycle".
+var currentCycle atomic.Value
+
+// startCycle assigns a new cycle ID and returns a function that clears it.
+func startCycle() (end func()) {
+	b := make([]byte, 4)
+	rand.Read(b)
+	currentCycle.Store(hex.EncodeToString(b))
+	return func() { currentCycle.Store("") }
+}
+
+// cycleHandler adds the current cycle ID to each record.
+type cycleHandler struct {
+	slog.Handler
+}
+
+func (h cycleHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id, _ := currentCycle.Load().(string); id != "" {
+		r.AddAttrs(slog.String("cycle", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h cycleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return cycleHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h cycleHandler) WithGroup(name string) slog.Handler {
+	return cycleHandler{h.Handler.WithGroup(name)}
+}
+
+// parseLogLevel parses a logLevel setting.
+func parseLogLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown logLevel %q, want debug, info, warn or error", name)
+}
+
+// newLogHandler returns the handler described by logLevel and logFormat,
+// writing to w.
+func newLogHandler(w io.Writer, config AppConfig) (slog.Handler, error) {
+	level, err := parseLogLevel(config.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	switch config.LogFormat {
+	case "", "text":
+		return cycleHandler{slog.NewTextHandler(w, opts)}, nil
+	case "json":
+		return cycleHandler{slog.NewJSONHandler(w, opts)}, nil
+	}
+	return nil, fmt.Errorf("unknown logFormat %q, want text or json", config.LogFormat)
+}
+
+// setupLogging routes all logging, including the standard log package,
+// through the configured handler.
+func setupLogging(config AppConfig) error {
+	handler, err := newLogHandler(log.Writer(), config)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// fatal logs msg at error level and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,49 @@
+package melanzana
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	handler, err := newLogHandler(&buf, AppConfig{LogLevel: "warn", LogFormat: "json"})
+	if err != nil {
+		t.Fatalf("newLogHandler() error = %v", err)
+	}
+	logger := slog.New(handler)
+
+	logger.Info("Found appointment slots", "count", 3)
+	if buf.Len() != 0 {
+		t.Errorf("info record at warn level was logged: %s", buf.String())
+	}
+
+	end := startCycle()
+	logger.Warn("Error fetching availability", "month", "2025-07")
+	end()
+	logger.Warn("Between cycles")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("logged %d lines, want 2: %s", len(lines), buf.String())
+	}
+	var record map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("log line is not JSON: %v", err)
+	}
+	if record["level"] != "WARN" || record["month"] != "2025-07" || record["cycle"] == nil {
+		t.Errorf("record = %v, want a WARN with month and cycle", record)
+	}
+	if strings.Contains(lines[1], `"cycle"`) {
+		t.Errorf("record between cycles = %s, want no cycle", lines[1])
+	}
+
+	for _, config := range []AppConfig{{LogLevel: "verbose"}, {LogFormat: "logfmt"}} {
+		if _, err := newLogHandler(&buf, config); err == nil {
+			t.Errorf("newLogHandler(%+v) error = nil, want error", config)
+		}
+	}
+}
@@ -1,104 +1,572 @@
-package main
+package melanzana
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 )
 
-func runScrapingCycle(config AppConfig) {
-	log.Println("--- Starting scraping cycle ---")
+// version is set at build time with
+// -ldflags "-X github.com/pashbylogan/melanzana.version=...".
+var version = "dev"
+
+// runScrapingCycle scrapes, notifies and records one cycle. It returns the
+// scraped and newly found appointments for callers that track outcomes.
+func runScrapingCycle(config AppConfig) (scraped, newAppointments []Appointment, err error) {
+	defer startCycle()()
+	before, started := *session, clock.Now()
+	defer func() {
+		session.recordCycle(scraped, newAppointments, err)
+		health.record(err, clock.Now())
+		if err == nil {
+			latestScrape.update(scraped, clock.Now())
+			writeICSFile(config, scraped, clock.Now())
+		}
+		sendHeartbeat(config, err)
+		summary := newCycleSummary(before, *session, scraped, newAppointments, err, clock.Now())
+		summary.Started = started
+		session.LastCycle = summary
+		writeCycleSummary(config, summary)
+	}()
+
+	slog.Info("Starting scraping cycle")
+	pollEmailCommands(config)
+
+	// Scrape current appointments
+	months := fetchMonths(config)
+	slog.Info("Scraping appointments", "months", months)
+	scrapedAppointments, err := appointmentSource.Appointments(months)
+	var partial *partialFetchError
+	var missed fetchGaps
+	if errors.As(err, &partial) {
+		if partial.ratio() < config.MinFetchRatio {
+			slog.Error("Too few months fetched, skipping notifications and state for this cycle",
+				"fetched", partial.Fetched, "attempted", partial.Attempted, "minFetchRatio", config.MinFetchRatio, "err", err)
+			return nil, nil, err
+		}
+		slog.Warn("Some months couldn't be fetched, going ahead without them",
+			"fetched", partial.Fetched, "attempted", partial.Attempted, "err", err)
+		missed = partial.Missed
+		err = nil
+	}
+	if err != nil {
+		slog.Error("Error scraping appointments", "category", categorize(err), "err", err)
+		return nil, nil, err
+	}
+
+	slog.Info("Found available appointment slots", "count", len(scrapedAppointments))
+
+	opts, err := newRenderOptions(config)
+	if err != nil {
+		slog.Warn("Error in display options, using defaults", "err", err)
+	}
+
+	checkBookingWindow(config, scrapedAppointments, opts)
+
+	switch {
+	case config.Profile != "":
+		newAppointments = runProfiles(config, scrapedAppointments, missed, opts, clock.Now())
+	case len(config.Campaigns) > 0:
+		newAppointments = runCampaigns(config, scrapedAppointments, missed, opts, clock.Now())
+	default:
+		newAppointments, _, err = runWatch(config, "", scrapedAppointments, missed, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	checkSLO(config, clock.Now())
+
+	slog.Info("Scraping cycle complete")
+	return scrapedAppointments, newAppointments, nil
+}
+
+// runWatch notifies about the scraped appointments not yet in the seen state
+// of config's store and records them. Campaigns and profiles each run their
+// own watch against a namespaced store; label, if set, prefixes notification subjects.
+// It returns the new appointments and how many notifications were delivered.
+// Errors are an errInvalidConfig, or an errStore if the store couldn't be
+// reached.
+func runWatch(config AppConfig, label string, scraped []Appointment, missed fetchGaps, opts RenderOptions) ([]Appointment, int, error) {
+	store, err := newStore(config)
+	if err != nil {
+		slog.Error("Error configuring state store", "err", err)
+		if !errors.Is(err, errStore) {
+			err = fmt.Errorf("%w: %w", errInvalidConfig, err)
+		}
+		return nil, 0, err
+	}
 
 	// Load seen appointments
-	seenAppointments, err := loadSeenAppointments(config.DataFile)
+	seenAppointments, err := store.Load()
 	if err != nil {
-		log.Printf("Error loading seen appointments: %v", err)
+		slog.Error("Error loading seen appointments", "err", err)
 		seenAppointments = []Appointment{}
 	} else {
-		log.Printf("Loaded %d seen appointments", len(seenAppointments))
+		slog.Debug("Loaded seen appointments", "count", len(seenAppointments))
 	}
 
-	// Scrape current appointments
-	log.Printf("Scraping appointments for %d months ahead...", config.MonthsLookahead)
-	scrapedAppointments, err := scrapeAppointments(config.MonthsLookahead)
-	if err != nil {
-		log.Printf("Error scraping appointments: %v", err)
-		return
+	config = withManagedSubscribers(config, store)
+
+	// Record slots notified by a run that stopped before saving them
+	journal := notifyJournal{config.NotifyJournalFile}
+	if !config.ReadOnly {
+		seenAppointments = reconcileJournal(journal, store, seenAppointments, journalRecipients(config))
 	}
 
-	log.Printf("Found %d available appointment slots", len(scrapedAppointments))
+	// Changes since the last check, which saves the snapshot the next one
+	// compares with; publishing them records them in the history.
+	changedAt := clock.Now()
+	changes, err := checkChanges(config, store, scraped, missed, changedAt)
+	if err != nil {
+		slog.Error("Error comparing with the last known availability", "err", err)
+	}
 
-	// Filter for new appointments
-	newAppointments := filterNewAppointments(scrapedAppointments, seenAppointments)
+	// Filter for new appointments among those the user could book
+	filter, err := newWatchFilter(config)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %w", errInvalidConfig, err)
+	}
+	cooldown := time.Duration(config.RenotifyCooldownMinutes) * time.Minute
+	pending := notificationChanges(filter.Apply(scraped), seenAppointments, changes, cooldown, clock.Now())
+	newAppointments := changedSlots(pending)
 
 	if len(newAppointments) > 0 {
-		log.Printf("Found %d NEW appointments:", len(newAppointments))
+		slog.Info("Found new appointments", "count", len(newAppointments))
 
 		logNewAppointments(newAppointments)
+	} else {
+		slog.Info("No new appointments found")
+	}
 
-		emailBody := buildEmailBody(newAppointments)
-		if err := sendEmailNotification(config, emailBody); err != nil {
-			log.Printf("Error sending email: %v", err)
+	// Notifications, history, metrics and the like react to the changes
+	// through the event bus; the notify sink reports what it sent.
+	outcome := &notifyOutcome{}
+	ev := changeEvent{
+		At:      changedAt,
+		Watch:   label,
+		Config:  config,
+		Store:   store,
+		Scraped: scraped,
+		Seen:    seenAppointments,
+		Opts:    opts,
+		Changes: changes,
+		Pending: pending,
+		Outcome: outcome,
+	}
+	changeBus.publish(ev)
+
+	// Slots held back for a burst digest are seen: the burst state keeps them.
+	seen := newAppointments
+	if undelivered := outcome.undelivered; len(undelivered) > 0 {
+		if config.MarkSeenOnFailure {
+			slog.Warn("Marking slots seen although no notification about them was sent", "count", len(undelivered))
 		} else {
-			log.Println("Email notification sent successfully")
+			slog.Warn("Not marking slots seen until a notification about them is sent", "count", len(undelivered))
+			seen = newSlotSet(undelivered).appendUnseen(nil, newAppointments)
 		}
+	}
 
-		// log.Println("Email notifications are disabled. See main.go to enable.")
-
-		// Update seen appointments
-		seenAppointments = append(seenAppointments, newAppointments...)
+	// Save seen appointments, dropping those for days that have passed
+	if config.ReadOnly {
+		slog.Info("Read-only mode: not saving new appointments", "count", len(newAppointments), "file", config.DataFile)
+	} else if err := store.MarkSeen(seenRecords(seenAppointments, seen, scraped, clock.Now())); err != nil {
+		slog.Error("Error saving appointments", "err", err)
 	} else {
-		log.Println("No new appointments found")
+		slog.Debug("Saved new appointments", "count", len(seen), "file", config.DataFile)
+		if err := journal.clear(); err != nil {
+			slog.Warn("Error clearing notification journal", "err", err)
+		}
+		if removed, err := store.Prune(clock.Now().In(sourceLocation())); err != nil {
+			slog.Warn("Error pruning past appointments", "err", err)
+		} else if removed > 0 {
+			slog.Debug("Pruned past appointments", "count", removed)
+		}
 	}
 
-	// Save seen appointments
-	if err := saveSeenAppointments(seenAppointments, config.DataFile); err != nil {
-		log.Printf("Error saving appointments: %v", err)
-	} else {
-		log.Printf("Saved %d appointments to %s", len(seenAppointments), config.DataFile)
+	if config.ProbeDelaySeconds > 0 && len(outcome.notified) > 0 {
+		delay := time.Duration(config.ProbeDelaySeconds) * time.Second
+		followUps.schedule(followUp{
+			due:      clock.Now().Add(delay),
+			delay:    delay,
+			notified: outcome.notified,
+			filter:   filter,
+			deliver:  func(n Notification) { ev.deliver(n) },
+		})
 	}
 
-	log.Println("--- Scraping cycle complete ---")
+	return newAppointments, outcome.notifications, nil
 }
 
-func buildEmailBody(appointments []Appointment) string {
+func buildEmailBody(appointments []Appointment, opts RenderOptions) string {
 	var body strings.Builder
 	body.WriteString("New Melanzana appointments found:\n\n")
 
-	for _, appt := range appointments {
-		fmt.Fprintf(&body, "- %s at %s (%d spaces available)\n",
-			appt.Date, appt.Time, appt.Spaces)
+	for _, slot := range slotViews(appointments, opts) {
+		switch {
+		case slot.SlotCount > 1:
+			fmt.Fprintf(&body, "- %s at %s%s available (%d back-to-back slots, up to %d spaces)\n",
+				slot.Date, slot.DisplayTime, calendarSuffix(slot.Appointment), slot.SlotCount, slot.Spaces)
+		case slot.MaxSpaces > 0:
+			fmt.Fprintf(&body, "- %s at %s%s (%d of %d spaces available)\n",
+				slot.Date, slot.DisplayTime, calendarSuffix(slot.Appointment), slot.Spaces, slot.MaxSpaces)
+		default:
+			fmt.Fprintf(&body, "- %s at %s%s (%d spaces available)\n",
+				slot.Date, slot.DisplayTime, calendarSuffix(slot.Appointment), slot.Spaces)
+		}
+		if slotBookingURL != "" {
+			body.WriteString("  Book: " + slot.BookingURL + "\n")
+		}
 	}
 
-	body.WriteString("\nBook at: https://melanzana.com/book-an-appointment")
+	body.WriteString("\nBook at: " + bookingURL)
 	return body.String()
 }
 
 func logNewAppointments(appointments []Appointment) {
 	for _, appt := range appointments {
-		log.Printf("- %s at %s (%d spaces)", appt.Date, appt.Time, appt.Spaces)
+		slog.Info("New appointment", "date", appt.Date, "time", appt.Time, "spaces", appt.Spaces, "calendar", appt.Calendar)
 	}
 }
 
-func sendEmailNotification(config AppConfig, body string) error {
-	emailConf := EmailConfig{
-		SMTPHost:     config.SMTPServer,
-		SMTPPort:     config.SMTPPort,
-		SMTPUsername: config.SMTPUsername,
-		SMTPPassword: config.SMTPPassword,
-		FromEmail:    config.FromEmail,
-		ToEmails:     config.ToEmails,
+// Notification is a single message to deliver to the configured recipients.
+type Notification struct {
+	Subject      string
+	Intro        string // Optional paragraph placed before the appointment list
+	Appointments []Appointment
+	Removed      []Appointment       // Previously notified appointments that are no longer available
+	Footer       []string            // Optional lines placed after the booking link
+	Digest       bool                // Collects slots from several cycles, e.g. a burst digest
+	Trends       map[string]DayTrend // Per-date spaces and change since the previous cycle, shown in digests
+}
+
+// newAppointmentsNotification is the standard notification for newly found appointments.
+func newAppointmentsNotification(appointments []Appointment) Notification {
+	return Notification{
+		Subject:      "New Melanzana Appointments Available!",
+		Appointments: appointments,
 	}
+}
 
-	return sendEmail(emailConf, "New Melanzana Appointments Available!", body)
+// goneNotification tells recipients that slots they were notified about have
+// been booked or withdrawn.
+func goneNotification(gone []Appointment) Notification {
+	return Notification{
+		Subject: fmt.Sprintf("%d Melanzana slots no longer available", len(gone)),
+		Intro:   "Slots you were told about have been fully booked or withdrawn.",
+		Removed: gone,
+	}
 }
 
-func main() {
-	config, err := loadConfig()
+// planNotifications decides what to send about pending, the changes found
+// by notificationChanges, applying burst detection when it is enabled.
+func planNotifications(config AppConfig, pending []Change) []Notification {
+	newAppointments := changedSlots(pending)
+	if !config.Features.BurstMode || config.BurstThreshold <= 0 {
+		if len(newAppointments) == 0 {
+			return nil
+		}
+		return []Notification{newAppointmentsNotification(newAppointments)}
+	}
+
+	state, err := loadBurstState(config.BurstStateFile)
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		slog.Warn("Error loading burst state, starting fresh", "err", err)
+		state = &BurstState{}
+	}
+
+	window := time.Duration(config.BurstWindowMinutes) * time.Minute
+	notifications := state.plan(clock.Now(), newAppointments, config.BurstThreshold, window)
+
+	if config.ReadOnly {
+		slog.Info("Read-only mode: not saving burst state", "file", config.BurstStateFile)
+	} else if err := saveBurstState(state, config.BurstStateFile); err != nil {
+		slog.Error("Error saving burst state", "err", err)
+	}
+	return notifications
+}
+
+// buildNotificationText renders the plain-text body of a notification.
+func buildNotificationText(n Notification, opts RenderOptions) string {
+	var body string
+	switch {
+	case n.Intro == "":
+		body = buildEmailBody(n.Appointments, opts)
+	case len(n.Appointments) == 0:
+		body = n.Intro + "\n\nBook at: " + bookingURL
+	default:
+		body = n.Intro + "\n\n" + buildEmailBody(n.Appointments, opts)
+	}
+
+	if len(n.Trends) > 0 {
+		body += "\n\nSpaces by day since the last check:\n"
+		for _, date := range appointmentDates(n.Appointments) {
+			if trend, ok := n.Trends[date]; ok {
+				body += fmt.Sprintf("- %s: %s\n", date, formatTrend(trend))
+			}
+		}
+	}
+
+	if len(n.Removed) > 0 {
+		body += "\n\nNo longer available:\n"
+		for _, slot := range slotViews(n.Removed, opts) {
+			body += fmt.Sprintf("- %s at %s%s\n", slot.Date, slot.DisplayTime, calendarSuffix(slot.Appointment))
+		}
+	}
+
+	if len(n.Footer) > 0 {
+		body += "\n\n--\n" + strings.Join(n.Footer, "\n")
+	}
+	return body
+}
+
+// deliverNotification renders and sends a notification, or previews it in
+// read-only mode. It returns how many messages were sent and how many
+// failed, both zero if no recipient wanted the notification, and the
+// appointments that were in a failed message but in no sent or previewed one.
+func deliverNotification(config AppConfig, n Notification, opts RenderOptions) (sent, failed int, undelivered []Appointment) {
+	if freshness := freshnessFooter(n.Appointments, clock.Now()); freshness != "" {
+		n.Footer = append(n.Footer, freshness)
+	}
+	if footer, err := renderFooter(config.Footer, config.AssetsDir); err != nil {
+		slog.Warn("Error rendering footer", "err", err)
+	} else if footer != "" {
+		n.Footer = append(n.Footer, strings.Split(footer, "\n")...)
 	}
 
-	log.Printf("Melanzana Scraper - Checking %d months ahead", config.MonthsLookahead)
-	runScrapingCycle(config)
+	recipients, err := resolveRecipients(config)
+	if err != nil {
+		slog.Error("Error loading recipients", "err", err)
+		return 0, 1, n.Appointments
+	}
+
+	// Each recipient gets an individual message so addresses aren't shared.
+	personalizer := newPersonalizer(n)
+	var reached, missed []Appointment
+	for _, r := range recipients {
+		if r.PausedUntil != nil && clock.Now().Before(*r.PausedUntil) {
+			slog.Debug("Recipient has paused notifications, skipping", "recipient", r.label(), "until", *r.PausedUntil)
+			continue
+		}
+		personal := personalizer.personalize(r, config)
+		if len(n.Appointments)+len(n.Removed) > 0 && len(personal.Appointments)+len(personal.Removed) == 0 {
+			slog.Debug("No appointments match the recipient's preferences, skipping", "recipient", r.Email)
+			continue
+		}
+
+		subject, err := renderSubject(opts.Subject, personal)
+		if err != nil {
+			slog.Warn("Error rendering subject, using default", "err", err)
+		}
+		personal.Subject = subject
+
+		textBody := buildNotificationText(personal, opts)
+		htmlBody, err := buildHTMLEmailBody(personal, opts)
+		if err != nil {
+			slog.Warn("Error rendering HTML email, sending plain text only", "err", err)
+			htmlBody = ""
+		}
+
+		if config.DryRun {
+			printDryRun(config, r, personal, textBody, htmlBody)
+			reached = append(reached, personal.Appointments...)
+			continue
+		}
+		if config.ReadOnly {
+			slog.Info("Read-only mode: not sending notification", "subject", personal.Subject, "recipient", r.label(), "preview", textBody)
+			reached = append(reached, personal.Appointments...)
+			continue
+		}
+		delivered, errs := sendToRecipient(config, r, personal, textBody, htmlBody)
+		for _, err := range errs {
+			session.SendErrors++
+			failed++
+			slog.Error("Error sending notification", "recipient", r.label(), "category", categorize(err), "err", err)
+		}
+		session.NotificationsSent += delivered
+		sent += delivered
+		if delivered > 0 {
+			reached = append(reached, personal.Appointments...)
+		} else {
+			missed = append(missed, personal.Appointments...)
+		}
+	}
+
+	missedSet, reachedSet := newSlotSet(missed), newSlotSet(reached)
+	for _, appt := range n.Appointments {
+		if missedSet.has(appt) && !reachedSet.has(appt) {
+			undelivered = append(undelivered, appt)
+		}
+	}
+	return sent, failed, undelivered
+}
+
+// printDryRunEmail writes the fully rendered message to stdout instead of sending it.
+func printDryRunEmail(config AppConfig, to, subject, textBody, htmlBody string) {
+	msg, err := emailConfigFor(config, []string{to}).Message(subject, textBody, htmlBody)
+	if err != nil {
+		slog.Error("Dry run: error rendering email", "recipient", to, "err", err)
+		return
+	}
+	fmt.Printf("===== Email to %s (dry run, not sent) =====\n%s\n", to, msg)
+}
+
+// Main runs the melanzana command with args, the command-line arguments
+// without the program name, and returns its exit code.
+func Main(args []string) int {
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		return runCommand(args[0], args[1:])
+	}
+	// Without a command, pollIntervalMinutes chooses between a single cycle
+	// and running continuously, as before there were commands.
+	return runScraper("melanzana", args, modeFromConfig)
+}
+
+// runMode is how runScraper decides between a single cycle and running
+// continuously.
+type runMode int
+
+const (
+	modeFromConfig runMode = iota // Continuously if pollIntervalMinutes is set
+	modeOnce                      // A single cycle, whatever pollIntervalMinutes says
+	modeWatch                     // Continuously, every defaultWatchInterval if pollIntervalMinutes isn't set
+	modeLambda                    // A cycle per AWS Lambda invocation
+	modeFunction                  // A cycle per HTTP request, for Cloud Functions and the like
+)
+
+// defaultWatchInterval is how often "melanzana watch" checks without pollIntervalMinutes.
+const defaultWatchInterval = 15
+
+// runScraper configures the scraper from args and runs it, returning the
+// exit code.
+func runScraper(name string, args []string, mode runMode) int {
+	config, err := loadConfig(name, args)
+	if err != nil {
+		fatal("Failed to load configuration", "err", err)
+	}
+	if err := setupLogging(config); err != nil {
+		fatal("Invalid logging configuration", "err", err)
+	}
+
+	if config.ShowVersion {
+		fmt.Println(version)
+		return exitOK
+	}
+
+	if config.ExportAssetsDir != "" {
+		if err := exportAssets(config.ExportAssetsDir); err != nil {
+			fatal("Failed to export assets", "err", err)
+		}
+		slog.Info("Exported embedded assets", "dir", config.ExportAssetsDir)
+		return exitOK
+	}
+
+	if config.UnsubscribeToken != "" {
+		email, err := unsubscribeRecipient(config.RecipientsFile, config.UnsubscribeToken)
+		if err != nil {
+			fatal("Failed to unsubscribe", "err", err)
+		}
+		slog.Info("Unsubscribed", "recipient", email)
+		return exitOK
+	}
+
+	switch {
+	case mode == modeOnce, mode == modeLambda, mode == modeFunction:
+		config.PollIntervalMinutes = 0
+	case mode == modeWatch && config.PollIntervalMinutes <= 0:
+		config.PollIntervalMinutes = defaultWatchInterval
+	}
+
+	if err := startScraper(&config); err != nil {
+		fatal("Failed to start", "err", err)
+	}
+	switch mode {
+	case modeLambda:
+		return runLambda(config)
+	case modeFunction:
+		return runFunction(config)
+	}
+	if config.PollIntervalMinutes > 0 {
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		watch(ctx, config)
+		return exitOK
+	}
+	code := runCycle(config)
+	followUps.drain()
+	return code
+}
+
+// startScraper resolves the secrets in config and sets the process-wide
+// scraping state from it, logging what the run will do. A dry run is made
+// read-only.
+func startScraper(config *AppConfig) error {
+	if err := resolveSecrets(config); err != nil {
+		return fmt.Errorf("failed to resolve secrets: %w", err)
+	}
+
+	slog.Info("Melanzana Scraper starting", "version", version, "months", config.MonthsLookahead)
+	if err := configureScraper(*config); err != nil {
+		return err
+	}
+	slog.Info("Features", "enabled", config.Features.String())
+	if config.BurstThreshold > 0 && !config.Features.BurstMode {
+		slog.Warn("burstThreshold is set but the burstMode feature is disabled; burst detection is off")
+	}
+	if config.DryRun {
+		// A dry run never mutates state; it only differs from read-only in how it previews.
+		config.ReadOnly = true
+		slog.Info("Dry run: rendered notifications will be printed to stdout; nothing will be sent or written")
+	} else if config.ReadOnly {
+		slog.Info("Running in read-only mode: no emails will be sent and no state will be written")
+	}
+	return nil
+}
+
+// watch checks every pollIntervalMinutes, serving the health endpoints and
+// answering the Telegram bot if configured, until ctx is done.
+func watch(ctx context.Context, config AppConfig) {
+	interval := time.Duration(config.PollIntervalMinutes) * time.Minute
+	restoreLatestScrape(config)
+	if config.HealthAddr != "" {
+		server := serveHealth(config.HealthAddr, newHealthServer(config, interval))
+		defer server.Close()
+	}
+	if config.TelegramBot {
+		startTelegramBot(ctx, config)
+	}
+	runDaemon(ctx, config, interval)
+}
+
+// setupScraper sets the process-wide scraping state from config, exiting if
+// it is unusable.
+func setupScraper(config AppConfig) {
+	if err := configureScraper(config); err != nil {
+		fatal("Invalid configuration", "err", err)
+	}
+}
+
+// configureScraper sets the process-wide scraping state from config, or
+// returns an error if it is unusable.
+func configureScraper(config AppConfig) error {
+	if _, err := loadTimezone(config.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone: %w", err)
+	}
+	calendars, bookingURL, slotBookingURL = watchedCalendars(config), config.BookingURL, config.SlotBookingURL
+	if _, err := proxyURL(config); err != nil {
+		return fmt.Errorf("invalid proxy: %w", err)
+	}
+	sourceTimezone = config.Timezone
+	apiClient = newAPIClient(config)
+	outboundTransport.configure(config.RequestsPerSecond, config.RequestBurst)
+	cowlendarSchema.alert = schemaAlert(config)
+	appointmentSource = newSource(config)
+	fetchRetry = config.Retry.policy(retryHTTP)
+	availabilityCache = newAvailabilityCache(config)
+	return nil
 }
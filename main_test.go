@@ -0,0 +1,57 @@
+package melanzana
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRunWatchMarksSeenAfterDelivery(t *testing.T) {
+	fixClock(t, time.Date(2099, 7, 1, 12, 0, 0, 0, time.UTC))
+	status := http.StatusInternalServerError
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	defer func(url string) { sendGridURL = url }(sendGridURL)
+	sendGridURL = server.URL
+
+	dir := t.TempDir()
+	config := AppConfig{
+		EmailProvider:  "sendgrid",
+		EmailAPIKey:    "key",
+		FromEmail:      "from@example.com",
+		ToEmails:       []string{"me@example.com"},
+		DataFile:       filepath.Join(dir, "seen.json"),
+		HistoryFile:    filepath.Join(dir, "history.jsonl"),
+		StoreSpoolFile: filepath.Join(dir, "spool.json"),
+	}
+	first := Appointment{Date: "2099-07-06", Time: "10:00 am – 10:30 am", Spaces: 1}
+	second := Appointment{Date: "2099-07-07", Time: "10:00 am – 10:30 am", Spaces: 1}
+
+	steps := []struct {
+		name              string
+		status            int
+		markSeenOnFailure bool
+		scraped           []Appointment
+		wantNew, wantSeen int
+	}{
+		{"SendFails", http.StatusInternalServerError, false, []Appointment{first}, 1, 0},
+		{"RetriedAndSent", http.StatusAccepted, false, []Appointment{first}, 1, 1},
+		{"MarkSeenOnFailure", http.StatusInternalServerError, true, []Appointment{first, second}, 1, 2},
+	}
+	for _, step := range steps {
+		status, config.MarkSeenOnFailure = step.status, step.markSeenOnFailure
+		found, _, err := runWatch(config, "", step.scraped, nil, RenderOptions{})
+		if err != nil {
+			t.Fatalf("%s: runWatch() error = %v", step.name, err)
+		}
+		seen, err := loadSeenAppointments(config.DataFile, nil)
+		if len(found) != step.wantNew || err != nil || len(seen) != step.wantSeen {
+			t.Errorf("%s: runWatch() found %d, then %d seen (err %v); want %d found and %d seen",
+				step.name, len(found), len(seen), err, step.wantNew, step.wantSeen)
+		}
+	}
+}
@@ -1,37 +1,66 @@
-package main
+package melanzana
 
 import (
-	"fmt"
-	"net/smtp"
+	"net/http"
 	"strings"
-)
+	"time"
 
-// EmailConfig holds SMTP server details and recipient information.
-// This struct is populated from AppConfig in main.go when sending email.
-type EmailConfig struct {
-	SMTPHost     string
-	SMTPPort     int
-	SMTPUsername string
-	SMTPPassword string
-	FromEmail    string
-	ToEmails     []string
-}
+	"github.com/pashbylogan/melanzana/pkg/awssig"
+	"github.com/pashbylogan/melanzana/pkg/notify"
+)
 
-// sendEmail constructs and sends an email.
-func sendEmail(config EmailConfig, subject string, body string) error {
-	auth := smtp.PlainAuth("", config.SMTPUsername, config.SMTPPassword, config.SMTPHost)
+// Endpoints of the notification APIs, empty for the providers' own;
+// variables so tests can use a local server.
+var (
+	sendGridURL       string
+	twilioMessagesURL string // Formatted with the account SID
+	telegramAPIURL    string // Formatted with the bot token and method
+)
 
-	msg := strings.Builder{}
-	msg.WriteString("From: " + config.FromEmail + "\r\n")
-	msg.WriteString("To: " + strings.Join(config.ToEmails, ",") + "\r\n")
-	msg.WriteString("Subject: " + subject + "\r\n")
-	msg.WriteString("\r\n") // Empty line separates headers from body
-	msg.WriteString(body + "\r\n")
+// providerHTTPClient sends notifications and bookings to other services.
+var providerHTTPClient = &http.Client{Transport: outboundTransport, Timeout: 30 * time.Second}
 
-	addr := fmt.Sprintf("%s:%d", config.SMTPHost, config.SMTPPort)
-	err := smtp.SendMail(addr, auth, config.FromEmail, config.ToEmails, []byte(msg.String()))
-	if err != nil {
-		return fmt.Errorf("failed to send email: %w", err)
+// emailConfigFor builds the transport settings for sending to the given recipients.
+func emailConfigFor(config AppConfig, to []string) notify.Email {
+	return notify.Email{
+		SMTPHost:     config.SMTPServer,
+		SMTPPort:     config.SMTPPort,
+		SMTPUsername: config.SMTPUsername,
+		SMTPPassword: config.SMTPPassword,
+		FromEmail:    config.FromEmail,
+		ToEmails:     to,
+		TLSMode:      config.SMTPTLS,
+		SkipVerify:   config.SMTPSkipVerify,
+		AuthMethod:   config.SMTPAuth,
+		OAuth2: notify.OAuth2{
+			Provider:     config.OAuth2Provider,
+			TokenURL:     config.OAuth2TokenURL,
+			ClientID:     config.OAuth2ClientID,
+			ClientSecret: config.OAuth2ClientSecret,
+			RefreshToken: config.OAuth2RefreshToken,
+			TokenFile:    config.OAuth2TokenFile,
+		},
+		Provider:      config.EmailProvider,
+		APIKey:        config.EmailAPIKey,
+		MailgunDomain: config.MailgunDomain,
+		MailgunRegion: config.MailgunRegion,
+		SESRegion:     config.SESRegion,
+		AWS: awssig.Credentials{
+			AccessKeyID:     config.AWSAccessKeyID,
+			SecretAccessKey: config.AWSSecretAccessKey,
+		},
+		SendGridURL: sendGridURL,
+		HTTPClient:  providerHTTPClient,
 	}
-	return nil
+}
+
+func sendEmailNotification(config AppConfig, to []string, subject, textBody, htmlBody string) error {
+	return sendWithRetry(config, "Sending email to "+strings.Join(to, ","), func() error {
+		return emailConfigFor(config, to).Send(subject, textBody, htmlBody)
+	})
+}
+
+// telegramSender sends through the configured Telegram bot.
+func telegramSender(config AppConfig) notify.Telegram {
+	return notify.Telegram{BotToken: config.TelegramBotToken, URL: telegramAPIURL, HTTPClient: providerHTTPClient}
 }
@@ -0,0 +1,179 @@
+package melanzana
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// apiPacer paces Cowlendar requests as the server asks. It lasts as long as
+// the process, so in daemon mode a backoff carries over to later cycles.
+var apiPacer = newServerPacer()
+
+// maxServerPause caps how long the server can hold back requests. A bogus
+// header, such as a reset time in milliseconds or a Retry-After of years,
+// would otherwise stop polling for good.
+const maxServerPause = time.Hour
+
+// serverPacer holds back requests when the server says to: until the time
+// in a 429 or 503 response's Retry-After header, until the quota resets
+// once X-RateLimit-Remaining reaches 0, and otherwise spreading the
+// remaining quota evenly until it resets.
+type serverPacer struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	until   time.Time     // No request before this
+	spacing time.Duration // Gap kept between requests until resetAt
+	resetAt time.Time
+	next    time.Time // Earliest next request while spacing
+}
+
+func newServerPacer() *serverPacer {
+	return &serverPacer{now: clockNow}
+}
+
+// rateLimitedError reports a request that wasn't sent, because the server
+// asked for none until after its deadline.
+type rateLimitedError struct {
+	until time.Time
+}
+
+func (e *rateLimitedError) Error() string {
+	return fmt.Sprintf("rate limited by the server until %s", e.until.Format(time.RFC3339))
+}
+
+// pausedUntil returns when the server will take requests again, or the zero
+// time if it isn't holding them back.
+func (p *serverPacer) pausedUntil() time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.until.After(p.now()) {
+		return p.until
+	}
+	return time.Time{}
+}
+
+// reserve claims the next request's turn and returns how long to wait for it.
+func (p *serverPacer) reserve() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	at := now
+	if p.until.After(at) {
+		at = p.until
+	}
+	if now.Before(p.resetAt) {
+		if p.next.After(at) {
+			at = p.next
+		}
+		p.next = at.Add(p.spacing)
+	}
+	return at.Sub(now)
+}
+
+// wait blocks until the server will take a request. Rather than wait past
+// ctx's deadline, it returns a rateLimitedError at once.
+func (p *serverPacer) wait(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	d := p.reserve()
+	if d <= 0 {
+		return nil
+	}
+	until := p.now().Add(d)
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(until) {
+		return &rateLimitedError{until: until}
+	}
+	select {
+	case <-clock.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// observe paces later requests by resp's rate limit headers.
+func (p *serverPacer) observe(resp *http.Response) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		if after, ok := parseRetryAfter(resp.Header.Get("Retry-After"), now); ok {
+			p.pause(limitPause(now.Add(after), now, "Retry-After"), resp.StatusCode)
+			return
+		}
+	}
+	remaining, err := strconv.Atoi(headerValue(resp.Header, "X-RateLimit-Remaining", "RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	resetAt, ok := parseRateLimitReset(resp.Header, now)
+	if !ok {
+		return
+	}
+	resetAt = limitPause(resetAt, now, "rate limit reset")
+	if remaining <= 0 {
+		p.pause(resetAt, resp.StatusCode)
+		return
+	}
+	p.spacing = resetAt.Sub(now) / time.Duration(remaining)
+	p.resetAt = resetAt
+}
+
+// pause holds back requests until until. Callers hold p.mu.
+func (p *serverPacer) pause(until time.Time, status int) {
+	if !until.After(p.until) {
+		return
+	}
+	p.until = until
+	slog.Warn("Cowlendar asked for fewer requests, pausing", "status", status, "until", until.Format(time.RFC3339))
+}
+
+// limitPause returns at, or maxServerPause from now if at is later.
+func limitPause(at, now time.Time, header string) time.Time {
+	if limit := now.Add(maxServerPause); at.After(limit) {
+		slog.Warn("Cowlendar asked for too long a pause, capping it", "header", header, "requested", at.Format(time.RFC3339), "until", limit.Format(time.RFC3339))
+		return limit
+	}
+	return at
+}
+
+// headerValue returns the first of names set in h.
+func headerValue(h http.Header, names ...string) string {
+	for _, name := range names {
+		if v := h.Get(name); v != "" {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+// parseRateLimitReset returns when the rate limit quota resets. The common
+// X-RateLimit-Reset header is either a Unix time or, like RateLimit-Reset
+// and X-RateLimit-Reset-After, a number of seconds from now; values too
+// large to be a delay are taken as Unix times, in milliseconds if too large
+// even for seconds.
+func parseRateLimitReset(h http.Header, now time.Time) (time.Time, bool) {
+	secs, err := strconv.ParseFloat(headerValue(h, "X-RateLimit-Reset", "RateLimit-Reset", "X-RateLimit-Reset-After"), 64)
+	if err != nil || secs < 0 {
+		return time.Time{}, false
+	}
+	if secs > 1e12 {
+		return time.UnixMilli(int64(secs)), true
+	}
+	if secs > 1e9 {
+		return time.Unix(int64(secs), 0), true
+	}
+	return now.Add(time.Duration(secs * float64(time.Second))), true
+}
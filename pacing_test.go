@@ -0,0 +1,108 @@
+package melanzana
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestServerPacer(t *testing.T) {
+	now := time.Date(2099, 7, 1, 12, 0, 0, 0, time.UTC)
+	response := func(status int, headers ...string) *http.Response {
+		resp := &http.Response{StatusCode: status, Header: http.Header{}}
+		for i := 0; i < len(headers); i += 2 {
+			resp.Header.Set(headers[i], headers[i+1])
+		}
+		return resp
+	}
+
+	tests := []struct {
+		name      string
+		resp      *http.Response
+		wantPause time.Duration // 0 for none
+		wantWaits []time.Duration
+	}{
+		{"NoHeaders", response(200), 0, []time.Duration{0, 0}},
+		{"RetryAfter", response(429, "Retry-After", "120"), 2 * time.Minute, []time.Duration{2 * time.Minute, 2 * time.Minute}},
+		{"UnavailableRetryAfter", response(503, "Retry-After", "30"), 30 * time.Second, []time.Duration{30 * time.Second}},
+		{"RetryAfterOnSuccess", response(200, "Retry-After", "30"), 0, []time.Duration{0}},
+		{"QuotaExhausted", response(200, "X-RateLimit-Remaining", "0", "X-RateLimit-Reset", strconv.FormatInt(now.Add(time.Hour).Unix(), 10)), time.Hour, []time.Duration{time.Hour}},
+		{"QuotaExhaustedDelay", response(429, "RateLimit-Remaining", "0", "RateLimit-Reset", "90"), 90 * time.Second, []time.Duration{90 * time.Second}},
+		{"QuotaSpread", response(200, "X-RateLimit-Remaining", "4", "X-RateLimit-Reset-After", "60"), 0, []time.Duration{0, 15 * time.Second, 30 * time.Second}},
+		{"RetryAfterCapped", response(429, "Retry-After", "999999999999999"), maxServerPause, []time.Duration{maxServerPause}},
+		{"ResetInMillis", response(200, "X-RateLimit-Remaining", "0", "X-RateLimit-Reset", strconv.FormatInt(now.Add(time.Minute).UnixMilli(), 10)), time.Minute, []time.Duration{time.Minute}},
+		{"ResetCapped", response(200, "X-RateLimit-Remaining", "0", "X-RateLimit-Reset", strconv.FormatInt(now.AddDate(1, 0, 0).Unix(), 10)), maxServerPause, []time.Duration{maxServerPause}},
+		{"RemainingWithoutReset", response(200, "X-RateLimit-Remaining", "0"), 0, []time.Duration{0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fixClock(t, now)
+			p := newServerPacer()
+			p.observe(tt.resp)
+			if got, want := p.pausedUntil(), now.Add(tt.wantPause); tt.wantPause > 0 && !got.Equal(want) || tt.wantPause == 0 && !got.IsZero() {
+				t.Errorf("pausedUntil() = %v, want %v after %v", got, tt.wantPause, tt.resp.Header)
+			}
+			for i, want := range tt.wantWaits {
+				if got := p.reserve(); got != want {
+					t.Errorf("reserve() %d = %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+
+	// A shorter Retry-After doesn't cut a pause short.
+	p := newServerPacer()
+	p.now = func() time.Time { return now }
+	p.observe(response(429, "Retry-After", "120"))
+	p.observe(response(429, "Retry-After", "10"))
+	if got := p.pausedUntil(); !got.Equal(now.Add(2 * time.Minute)) {
+		t.Errorf("pausedUntil() after a shorter Retry-After = %v, want the longer pause kept", got)
+	}
+	now = now.Add(3 * time.Minute)
+	if got := p.pausedUntil(); !got.IsZero() {
+		t.Errorf("pausedUntil() once the pause is over = %v, want zero", got)
+	}
+}
+
+func TestAPIClientHonorsRateLimits(t *testing.T) {
+	defer func(p *serverPacer) { apiPacer = p }(apiPacer)
+	apiPacer = newServerPacer()
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	client := newAPIClient(defaultConfig())
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	resp.Body.Close()
+
+	// Waiting two minutes would outlast the client's timeout, so the next
+	// request fails without being sent.
+	_, err = client.Get(server.URL)
+	var limited *rateLimitedError
+	if !errors.As(err, &limited) || requests != 1 {
+		t.Errorf("Get() while paused = %v after %d requests, want a rateLimitedError and no request", err, requests)
+	}
+
+	// Clients share the pause.
+	if _, err := newAPIClient(defaultConfig()).Get(server.URL); !errors.As(err, &limited) {
+		t.Errorf("Get() from a new client = %v, want a rateLimitedError", err)
+	}
+
+	// Without a deadline, the pacer waits out the pause.
+	p := newServerPacer()
+	p.until = time.Now().Add(50 * time.Millisecond)
+	if err := p.wait(context.Background()); err != nil {
+		t.Errorf("wait() error = %v, want nil once the pause is over", err)
+	}
+}
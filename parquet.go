@@ -0,0 +1,319 @@
+package melanzana
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Parquet is written by hand rather than through a library: the export only
+// needs one flat, uncompressed row group of strings, integers and
+// timestamps, which takes a small subset of the format
+// (https://parquet.apache.org/docs/file-format/). Each column is a single
+// PLAIN-encoded data page; optional columns carry their definition levels
+// as bit-packed runs.
+
+const parquetMagic = "PAR1"
+
+// Physical types, converted types and other enum values from parquet.thrift.
+const (
+	parquetInt32     = 1
+	parquetInt64     = 2
+	parquetByteArray = 6
+
+	parquetUTF8            = 0
+	parquetTimestampMillis = 9
+
+	parquetRequired = 0
+	parquetOptional = 1
+
+	parquetPlain = 0
+	parquetRLE   = 3
+)
+
+// parquetColumn collects the values of one column in the order rows are
+// added.
+type parquetColumn struct {
+	name     string
+	physical int32
+	optional bool
+	defined  []bool       // Whether each row has a value; optional columns only
+	values   bytes.Buffer // PLAIN-encoded values of the rows that have one
+}
+
+func (c *parquetColumn) addString(s string) {
+	binary.Write(&c.values, binary.LittleEndian, uint32(len(s)))
+	c.values.WriteString(s)
+}
+
+func (c *parquetColumn) addInt(n int) {
+	binary.Write(&c.values, binary.LittleEndian, int32(n))
+}
+
+// addTime records t in milliseconds, or a null when it is zero.
+func (c *parquetColumn) addTime(t time.Time) {
+	c.defined = append(c.defined, !t.IsZero())
+	if !t.IsZero() {
+		binary.Write(&c.values, binary.LittleEndian, t.UnixMilli())
+	}
+}
+
+// schema describes the column in the file's schema.
+func (c *parquetColumn) schema(s *thriftStruct) {
+	s.i32(1, c.physical)
+	repetition := int32(parquetRequired)
+	if c.optional {
+		repetition = parquetOptional
+	}
+	s.i32(3, repetition)
+	s.str(4, c.name)
+	switch c.physical {
+	case parquetByteArray:
+		s.i32(6, parquetUTF8)
+		s.structField(10, func(l *thriftStruct) { l.structField(1, func(*thriftStruct) {}) })
+	case parquetInt64:
+		s.i32(6, parquetTimestampMillis)
+		s.structField(10, func(l *thriftStruct) {
+			l.structField(8, func(ts *thriftStruct) {
+				ts.boolean(1, true)
+				ts.structField(2, func(u *thriftStruct) { u.structField(1, func(*thriftStruct) {}) })
+			})
+		})
+	}
+}
+
+// page returns the column's data page: the definition levels of an
+// optional column, then its values.
+func (c *parquetColumn) page() []byte {
+	var page bytes.Buffer
+	if c.optional {
+		// One bit-packed run of groups of 8 levels, the last group padded.
+		levels := binary.AppendUvarint(nil, uint64((len(c.defined)+7)/8)<<1|1)
+		for i := 0; i < len(c.defined); i += 8 {
+			var group byte
+			for j := 0; j < 8 && i+j < len(c.defined); j++ {
+				if c.defined[i+j] {
+					group |= 1 << j
+				}
+			}
+			levels = append(levels, group)
+		}
+		binary.Write(&page, binary.LittleEndian, uint32(len(levels)))
+		page.Write(levels)
+	}
+	page.Write(c.values.Bytes())
+	return page.Bytes()
+}
+
+// writeLifetimesParquet writes lifetimes as a Parquet file with the same
+// columns as writeLifetimesCSV. Times are UTC timestamps in milliseconds,
+// and null when unknown.
+func writeLifetimesParquet(w io.Writer, lifetimes []slotLifetime) error {
+	columns := []*parquetColumn{
+		{name: "date", physical: parquetByteArray},
+		{name: "time", physical: parquetByteArray},
+		{name: "calendar", physical: parquetByteArray},
+		{name: "status", physical: parquetByteArray},
+		{name: "first_seen", physical: parquetInt64, optional: true},
+		{name: "last_seen", physical: parquetInt64, optional: true},
+		{name: "gone_at", physical: parquetInt64, optional: true},
+		{name: "spaces", physical: parquetInt32},
+		{name: "peak_spaces", physical: parquetInt32},
+		{name: "appearances", physical: parquetInt32},
+	}
+	for _, l := range lifetimes {
+		columns[0].addString(l.Date)
+		columns[1].addString(l.Time)
+		columns[2].addString(l.Calendar)
+		columns[3].addString(l.Status)
+		columns[4].addTime(l.FirstSeen)
+		columns[5].addTime(l.LastSeen)
+		columns[6].addTime(l.GoneAt)
+		columns[7].addInt(l.Spaces)
+		columns[8].addInt(l.PeakSpaces)
+		columns[9].addInt(l.Appearances)
+	}
+
+	var file bytes.Buffer
+	file.WriteString(parquetMagic)
+	type chunk struct {
+		column *parquetColumn
+		offset int64
+		size   int64
+	}
+	var chunks []chunk
+	// An empty export has the schema but no row group.
+	if len(lifetimes) > 0 {
+		for _, c := range columns {
+			page := c.page()
+			header := thriftEncode(func(h *thriftStruct) {
+				h.i32(1, 0) // DATA_PAGE
+				h.i32(2, int32(len(page)))
+				h.i32(3, int32(len(page)))
+				h.structField(5, func(d *thriftStruct) {
+					d.i32(1, int32(len(lifetimes)))
+					d.i32(2, parquetPlain)
+					d.i32(3, parquetRLE)
+					d.i32(4, parquetRLE)
+				})
+			})
+			chunks = append(chunks, chunk{c, int64(file.Len()), int64(len(header) + len(page))})
+			file.Write(header)
+			file.Write(page)
+		}
+	}
+
+	var rowGroupSize int64
+	for _, ch := range chunks {
+		rowGroupSize += ch.size
+	}
+	footer := thriftEncode(func(m *thriftStruct) {
+		m.i32(1, 1)
+		m.structs(2, len(columns)+1, func(i int, s *thriftStruct) {
+			if i == 0 {
+				s.str(4, "schema")
+				s.i32(5, int32(len(columns)))
+				return
+			}
+			columns[i-1].schema(s)
+		})
+		m.i64(3, int64(len(lifetimes)))
+		m.structs(4, min(len(chunks), 1), func(_ int, g *thriftStruct) {
+			g.structs(1, len(chunks), func(i int, cc *thriftStruct) {
+				ch := chunks[i]
+				cc.i64(2, ch.offset)
+				cc.structField(3, func(md *thriftStruct) {
+					md.i32(1, ch.column.physical)
+					md.i32s(2, []int32{parquetPlain, parquetRLE})
+					md.strs(3, []string{ch.column.name})
+					md.i32(4, 0) // UNCOMPRESSED
+					md.i64(5, int64(len(lifetimes)))
+					md.i64(6, ch.size)
+					md.i64(7, ch.size)
+					md.i64(9, ch.offset)
+				})
+			})
+			g.i64(2, rowGroupSize)
+			g.i64(3, int64(len(lifetimes)))
+		})
+		m.str(6, "melanzana")
+	})
+	file.Write(footer)
+	binary.Write(&file, binary.LittleEndian, uint32(len(footer)))
+	file.WriteString(parquetMagic)
+
+	if _, err := w.Write(file.Bytes()); err != nil {
+		return fmt.Errorf("failed to write Parquet: %w", err)
+	}
+	return nil
+}
+
+// Type IDs of the Thrift compact protocol, which Parquet uses for its
+// metadata.
+const (
+	thriftTypeTrue   = 1
+	thriftTypeFalse  = 2
+	thriftTypeI32    = 5
+	thriftTypeI64    = 6
+	thriftTypeBinary = 8
+	thriftTypeList   = 9
+	thriftTypeStruct = 12
+)
+
+// thriftStruct encodes the fields of one struct in the Thrift compact
+// protocol. Fields must be added in increasing ID order.
+type thriftStruct struct {
+	buf  *bytes.Buffer
+	last int16 // ID of the previous field
+}
+
+// thriftEncode returns the encoding of the struct fill describes.
+func thriftEncode(fill func(*thriftStruct)) []byte {
+	var buf bytes.Buffer
+	fill(&thriftStruct{buf: &buf})
+	buf.WriteByte(0)
+	return buf.Bytes()
+}
+
+func (s *thriftStruct) header(id int16, typ byte) {
+	if delta := id - s.last; delta > 0 && delta <= 15 {
+		s.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		s.buf.WriteByte(typ)
+		s.varint(int64(id))
+	}
+	s.last = id
+}
+
+// varint writes n zigzag-encoded.
+func (s *thriftStruct) varint(n int64) {
+	s.buf.Write(binary.AppendUvarint(nil, uint64(n<<1^n>>63)))
+}
+
+func (s *thriftStruct) listHeader(n int, typ byte) {
+	if n < 15 {
+		s.buf.WriteByte(byte(n)<<4 | typ)
+		return
+	}
+	s.buf.WriteByte(0xf0 | typ)
+	s.buf.Write(binary.AppendUvarint(nil, uint64(n)))
+}
+
+func (s *thriftStruct) boolean(id int16, v bool) {
+	if v {
+		s.header(id, thriftTypeTrue)
+	} else {
+		s.header(id, thriftTypeFalse)
+	}
+}
+
+func (s *thriftStruct) i32(id int16, v int32) {
+	s.header(id, thriftTypeI32)
+	s.varint(int64(v))
+}
+
+func (s *thriftStruct) i64(id int16, v int64) {
+	s.header(id, thriftTypeI64)
+	s.varint(v)
+}
+
+func (s *thriftStruct) str(id int16, v string) {
+	s.header(id, thriftTypeBinary)
+	s.buf.Write(binary.AppendUvarint(nil, uint64(len(v))))
+	s.buf.WriteString(v)
+}
+
+func (s *thriftStruct) i32s(id int16, vs []int32) {
+	s.header(id, thriftTypeList)
+	s.listHeader(len(vs), thriftTypeI32)
+	for _, v := range vs {
+		s.varint(int64(v))
+	}
+}
+
+func (s *thriftStruct) strs(id int16, vs []string) {
+	s.header(id, thriftTypeList)
+	s.listHeader(len(vs), thriftTypeBinary)
+	for _, v := range vs {
+		s.buf.Write(binary.AppendUvarint(nil, uint64(len(v))))
+		s.buf.WriteString(v)
+	}
+}
+
+func (s *thriftStruct) structField(id int16, fill func(*thriftStruct)) {
+	s.header(id, thriftTypeStruct)
+	fill(&thriftStruct{buf: s.buf})
+	s.buf.WriteByte(0)
+}
+
+// structs writes a list of n structs, filling each in turn.
+func (s *thriftStruct) structs(id int16, n int, fill func(int, *thriftStruct)) {
+	s.header(id, thriftTypeList)
+	s.listHeader(n, thriftTypeStruct)
+	for i := 0; i < n; i++ {
+		fill(i, &thriftStruct{buf: s.buf})
+		s.buf.WriteByte(0)
+	}
+}
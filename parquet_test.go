@@ -0,0 +1,191 @@
+package melanzana
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// thriftDecoder reads the Thrift compact protocol into structs keyed by
+// field ID, for checking what writeLifetimesParquet wrote.
+type thriftDecoder struct {
+	t   *testing.T
+	buf []byte
+	pos int
+}
+
+func (d *thriftDecoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.buf[d.pos:])
+	if n <= 0 {
+		d.t.Fatalf("bad varint at %d", d.pos)
+	}
+	d.pos += n
+	return v
+}
+
+func (d *thriftDecoder) zigzag() int64 {
+	v := d.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (d *thriftDecoder) value(typ byte) any {
+	switch typ {
+	case thriftTypeTrue:
+		return true
+	case thriftTypeFalse:
+		return false
+	case thriftTypeI32, thriftTypeI64:
+		return d.zigzag()
+	case thriftTypeBinary:
+		n := int(d.uvarint())
+		d.pos += n
+		return string(d.buf[d.pos-n : d.pos])
+	case thriftTypeList:
+		header := d.buf[d.pos]
+		d.pos++
+		n := int(header >> 4)
+		if n == 15 {
+			n = int(d.uvarint())
+		}
+		list := make([]any, n)
+		for i := range list {
+			list[i] = d.value(header & 0x0f)
+		}
+		return list
+	case thriftTypeStruct:
+		return d.structValue()
+	}
+	d.t.Fatalf("unexpected Thrift type %d at %d", typ, d.pos)
+	return nil
+}
+
+func (d *thriftDecoder) structValue() map[int16]any {
+	fields := map[int16]any{}
+	var id int16
+	for {
+		header := d.buf[d.pos]
+		d.pos++
+		if header == 0 {
+			return fields
+		}
+		if delta := int16(header >> 4); delta != 0 {
+			id += delta
+		} else {
+			id = int16(d.zigzag())
+		}
+		fields[id] = d.value(header & 0x0f)
+	}
+}
+
+// readLifetimesParquet reads back a file written by writeLifetimesParquet.
+func readLifetimesParquet(t *testing.T, file []byte) (names []string, rows []slotLifetime) {
+	t.Helper()
+	if !bytes.HasPrefix(file, []byte(parquetMagic)) || !bytes.HasSuffix(file, []byte(parquetMagic)) {
+		t.Fatalf("file doesn't start and end with %q", parquetMagic)
+	}
+	footerLen := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	d := &thriftDecoder{t: t, buf: file, pos: len(file) - 8 - footerLen}
+	meta := d.structValue()
+
+	for _, s := range meta[2].([]any)[1:] {
+		names = append(names, s.(map[int16]any)[4].(string))
+	}
+	rows = make([]slotLifetime, meta[3].(int64))
+	for _, g := range meta[4].([]any) {
+		for i, c := range g.(map[int16]any)[1].([]any) {
+			md := c.(map[int16]any)[3].(map[int16]any)
+			d := &thriftDecoder{t: t, buf: file, pos: int(md[9].(int64))}
+			header := d.structValue()
+			page := file[d.pos : d.pos+int(header[3].(int64))]
+
+			defined := make([]bool, len(rows))
+			for r := range defined {
+				defined[r] = true
+			}
+			if meta[2].([]any)[i+1].(map[int16]any)[3].(int64) == parquetOptional {
+				n := int(binary.LittleEndian.Uint32(page))
+				levels := &thriftDecoder{t: t, buf: page[4 : 4+n]}
+				if run := levels.uvarint(); run&1 == 0 {
+					t.Fatalf("column %s: expected a bit-packed run, got header %d", names[i], run)
+				}
+				for r := range defined {
+					defined[r] = levels.buf[levels.pos+r/8]&(1<<(r%8)) != 0
+				}
+				page = page[4+n:]
+			}
+			for r := range rows {
+				if !defined[r] {
+					continue
+				}
+				switch md[1].(int64) {
+				case parquetByteArray:
+					n := int(binary.LittleEndian.Uint32(page))
+					v := string(page[4 : 4+n])
+					page = page[4+n:]
+					*[]*string{&rows[r].Date, &rows[r].Time, &rows[r].Calendar, &rows[r].Status}[i] = v
+				case parquetInt64:
+					v := time.UnixMilli(int64(binary.LittleEndian.Uint64(page))).UTC()
+					page = page[8:]
+					*[]*time.Time{&rows[r].FirstSeen, &rows[r].LastSeen, &rows[r].GoneAt}[i-4] = v
+				case parquetInt32:
+					v := int(int32(binary.LittleEndian.Uint32(page)))
+					page = page[4:]
+					*[]*int{&rows[r].Spaces, &rows[r].PeakSpaces, &rows[r].Appearances}[i-7] = v
+				}
+			}
+			if len(page) != 0 {
+				t.Errorf("column %s: %d bytes left over", names[i], len(page))
+			}
+		}
+	}
+	return names, rows
+}
+
+func TestLifetimesParquetRoundTrip(t *testing.T) {
+	at := time.Date(2025, 3, 10, 15, 4, 5, 0, time.UTC)
+	var lifetimes []slotLifetime
+	for i := 0; i < 20; i++ {
+		l := slotLifetime{
+			Date: "2025-03-15", Time: "10:00", Calendar: "Main", Status: "open",
+			FirstSeen: at.Add(time.Duration(i) * time.Minute), LastSeen: at.Add(time.Hour),
+			Spaces: i, PeakSpaces: i + 1, Appearances: 1,
+		}
+		if i%3 == 0 {
+			l.Status, l.GoneAt = "booked", at.Add(2*time.Hour)
+		}
+		if i == 7 {
+			l.Calendar, l.Spaces = "Zweigstelle Süd", -1
+		}
+		lifetimes = append(lifetimes, l)
+	}
+
+	for _, tt := range []struct {
+		name      string
+		lifetimes []slotLifetime
+	}{
+		{"Rows", lifetimes},
+		{"Empty", nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeLifetimesParquet(&buf, tt.lifetimes); err != nil {
+				t.Fatalf("writeLifetimesParquet() error = %v", err)
+			}
+			names, rows := readLifetimesParquet(t, buf.Bytes())
+			wantNames := []string{"date", "time", "calendar", "status", "first_seen", "last_seen", "gone_at", "spaces", "peak_spaces", "appearances"}
+			if !reflect.DeepEqual(names, wantNames) {
+				t.Errorf("columns = %v, want %v", names, wantNames)
+			}
+			if len(rows) != len(tt.lifetimes) {
+				t.Fatalf("read %d rows, want %d", len(rows), len(tt.lifetimes))
+			}
+			for i := range rows {
+				if !reflect.DeepEqual(rows[i], tt.lifetimes[i]) {
+					t.Errorf("row %d = %+v, want %+v", i, rows[i], tt.lifetimes[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package cowlendar
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// AvailabilityService is a read-through cache in front of a Client.
+// Everything in a process that needs current availability, such as a
+// dashboard, a REST API and a notifier, should share one service, so that
+// together they trigger at most one upstream fetch per calendar month per
+// TTL. Concurrent callers wait for a fetch of the same month already in
+// progress rather than starting their own.
+//
+//	availability := cowlendar.NewAvailabilityService(cowlendar.NewClient(http.DefaultClient), time.Minute)
+//	resp, err := availability.FetchAvailability(ctx, cowlendar.Calendar{ID: "685b42f202405a8372cd6b78"}, 2025, 7)
+type AvailabilityService struct {
+	TTL time.Duration // How long a fetched month is served; 0 fetches on every call
+
+	fetch func(ctx context.Context, cal Calendar, year, month int) (*Response, error)
+	now   func() time.Time
+
+	mu      sync.Mutex
+	entries map[monthKey]*cachedMonth
+}
+
+type monthKey struct {
+	cal         Calendar
+	year, month int
+}
+
+// cachedMonth is one month's fetch: in progress until done is closed, then
+// its result.
+type cachedMonth struct {
+	done      chan struct{}
+	resp      *Response
+	err       error
+	fetchedAt time.Time
+}
+
+// NewAvailabilityService returns a service that caches client's responses
+// for ttl.
+func NewAvailabilityService(client *Client, ttl time.Duration) *AvailabilityService {
+	return &AvailabilityService{
+		TTL:     ttl,
+		fetch:   client.FetchAvailability,
+		now:     time.Now,
+		entries: make(map[monthKey]*cachedMonth),
+	}
+}
+
+// FetchAvailability returns the availability of cal for one month, as
+// Client.FetchAvailability does, from the cache if a response younger than
+// the TTL is held. Callers receive their own copy and may modify it. Errors
+// are returned to every caller waiting on the fetch, but not cached.
+func (s *AvailabilityService) FetchAvailability(ctx context.Context, cal Calendar, year, month int) (*Response, error) {
+	if s.TTL <= 0 {
+		return s.fetch(ctx, cal, year, month)
+	}
+	key := monthKey{cal, year, month}
+
+	s.mu.Lock()
+	entry, ok := s.entries[key]
+	if ok {
+		select {
+		case <-entry.done:
+			if entry.err != nil || s.now().Sub(entry.fetchedAt) >= s.TTL {
+				ok = false
+			}
+		default:
+		}
+	}
+	if !ok {
+		entry = &cachedMonth{done: make(chan struct{})}
+		s.entries[key] = entry
+		s.mu.Unlock()
+		entry.resp, entry.err = s.fetch(ctx, cal, year, month)
+		entry.fetchedAt = s.now()
+		close(entry.done)
+		if entry.err != nil {
+			s.mu.Lock()
+			if s.entries[key] == entry {
+				delete(s.entries, key)
+			}
+			s.mu.Unlock()
+		}
+	} else {
+		s.mu.Unlock()
+	}
+
+	select {
+	case <-entry.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if entry.err != nil {
+		return nil, entry.err
+	}
+	return entry.resp.clone(), nil
+}
+
+// Invalidate drops every cached response, so the next call for each month
+// fetches upstream.
+func (s *AvailabilityService) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = make(map[monthKey]*cachedMonth)
+}
+
+// clone returns a copy of r that shares nothing with it.
+func (r *Response) clone() *Response {
+	c := *r
+	c.Short = slices.Clone(r.Short)
+	c.Long = slices.Clone(r.Long)
+	if r.NextUnix != nil {
+		next := *r.NextUnix
+		c.NextUnix = &next
+	}
+	return &c
+}
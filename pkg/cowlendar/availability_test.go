@@ -0,0 +1,97 @@
+package cowlendar
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAvailabilityService(t *testing.T) {
+	now := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	fetches := 0
+	var fetchErr error
+	s := NewAvailabilityService(NewClient(nil), time.Minute)
+	s.now = func() time.Time { return now }
+	s.fetch = func(ctx context.Context, cal Calendar, year, month int) (*Response, error) {
+		fetches++
+		if fetchErr != nil {
+			return nil, fetchErr
+		}
+		return &Response{Long: []Slot{{SlotStart: "2025-05-15 10:00", QtyLeft: fetches}}}, nil
+	}
+	ctx := context.Background()
+	cal := Calendar{ID: "cal-1"}
+
+	first, err := s.FetchAvailability(ctx, cal, 2025, 5)
+	if err != nil {
+		t.Fatalf("FetchAvailability() error = %v", err)
+	}
+	first.Long[0].QtyLeft = 99 // callers get their own copy
+
+	now = now.Add(30 * time.Second)
+	cached, err := s.FetchAvailability(ctx, cal, 2025, 5)
+	if err != nil || fetches != 1 || cached.Long[0].QtyLeft != 1 {
+		t.Errorf("FetchAvailability() within TTL = %+v, %v after %d fetches; want the cached response from 1 fetch", cached, err, fetches)
+	}
+
+	if _, err := s.FetchAvailability(ctx, cal, 2025, 6); err != nil || fetches != 2 {
+		t.Errorf("FetchAvailability() for another month made %d fetches (err %v), want 2", fetches, err)
+	}
+	if _, err := s.FetchAvailability(ctx, Calendar{ID: "cal-1", VariantID: "v-2"}, 2025, 5); err != nil || fetches != 3 {
+		t.Errorf("FetchAvailability() for another variant made %d fetches (err %v), want 3", fetches, err)
+	}
+
+	now = now.Add(time.Minute)
+	if fresh, err := s.FetchAvailability(ctx, cal, 2025, 5); err != nil || fetches != 4 || fresh.Long[0].QtyLeft != 4 {
+		t.Errorf("FetchAvailability() after TTL = %+v, %v after %d fetches; want a fresh fetch", fresh, err, fetches)
+	}
+
+	// Errors aren't cached.
+	s.Invalidate()
+	fetchErr = errors.New("upstream down")
+	if _, err := s.FetchAvailability(ctx, cal, 2025, 5); err == nil {
+		t.Errorf("FetchAvailability() after Invalidate with failing upstream error = nil, want error")
+	}
+	fetchErr = nil
+	if _, err := s.FetchAvailability(ctx, cal, 2025, 5); err != nil || fetches != 6 {
+		t.Errorf("FetchAvailability() after an error made %d fetches (err %v), want a fresh fetch", fetches, err)
+	}
+
+	// Without a TTL, every call fetches.
+	s.TTL = 0
+	s.FetchAvailability(ctx, cal, 2025, 5)
+	if fetches != 7 {
+		t.Errorf("FetchAvailability() without a TTL made %d fetches, want 7", fetches)
+	}
+}
+
+func TestAvailabilityServiceSharesFetches(t *testing.T) {
+	var mu sync.Mutex
+	fetches := 0
+	s := NewAvailabilityService(NewClient(nil), time.Minute)
+	s.fetch = func(ctx context.Context, cal Calendar, year, month int) (*Response, error) {
+		mu.Lock()
+		fetches++
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		return &Response{}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.FetchAvailability(context.Background(), Calendar{ID: "cal-1"}, 2025, 5); err != nil {
+				t.Errorf("FetchAvailability() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if fetches != 1 {
+		t.Errorf("5 concurrent consumers made %d upstream fetches, want 1", fetches)
+	}
+}
@@ -0,0 +1,149 @@
+// Package cowlendar reads appointment availability from the Cowlendar
+// booking calendar API, as used by Melanzana's booking page.
+//
+//	client := cowlendar.NewClient(http.DefaultClient)
+//	resp, err := client.FetchAvailability(ctx, cowlendar.Calendar{ID: "685b42f202405a8372cd6b78"}, 2025, 7)
+//	for _, slot := range resp.Long {
+//		fmt.Println(slot.SlotStart, slot.QtyLeft)
+//	}
+package cowlendar
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// DefaultBaseURL is the Cowlendar external API.
+const DefaultBaseURL = "https://app.cowlendar.com/extapi"
+
+// DefaultTimezone is the zone Melanzana's calendar is booked in.
+const DefaultTimezone = "America/Denver"
+
+// Response is one month of availability.
+type Response struct {
+	Short                  []string `json:"short"`
+	Long                   []Slot   `json:"long"`
+	MaxDate                string   `json:"max_date"`
+	NextAvailability       string   `json:"next_availability"`
+	NoAvailabilityInFuture bool     `json:"no_availability_in_futur"`
+	TargetTimezone         string   `json:"target_timezone"`
+	NextUnix               *int64   `json:"next_unix"`
+	JumpToNextAvs          bool     `json:"jump_to_next_avs"`
+}
+
+// Slot is a detailed time slot from the "long" array. SlotStart and SlotEnd
+// are wall-clock times, "2006-01-02 15:04", in the requested timezone.
+type Slot struct {
+	Slot         string `json:"slot"`
+	SlotStart    string `json:"slot_start"`
+	SlotEnd      string `json:"slot_end"`
+	SlotDuration int    `json:"slot_duration"`
+	IsBookable   bool   `json:"is_bookable"`
+	QtyBooked    int    `json:"qty_booked"`
+	QtyLeft      int    `json:"qty_left"`
+	MaxQty       int    `json:"max_qty"`
+}
+
+// Calendar identifies a Cowlendar calendar, optionally narrowed to one
+// product variant.
+type Calendar struct {
+	ID        string
+	VariantID string // Empty omits it from requests
+}
+
+// ErrMalformed is wrapped by errors for responses that can't be decoded.
+var ErrMalformed = errors.New("malformed Cowlendar response")
+
+// StatusError is returned when the API answers with a status other than 200.
+type StatusError struct {
+	StatusCode int
+	RetryAfter string // The Retry-After header, if any
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("API returned status %d", e.StatusCode)
+}
+
+// Client fetches availability. Its fields may be changed before first use.
+type Client struct {
+	HTTPClient *http.Client
+	BaseURL    string // Defaults to DefaultBaseURL
+	Timezone   string // IANA zone slot times are returned in; defaults to DefaultTimezone
+
+	// OnUnknownFields, if set, is called with response fields this package
+	// doesn't know, such as "long[].waitlist", for each response that has any.
+	OnUnknownFields func(fields []string)
+
+	once sync.Once
+}
+
+// NewClient returns a client for the public API that makes requests with
+// httpClient.
+func NewClient(httpClient *http.Client) *Client {
+	return &Client{HTTPClient: httpClient}
+}
+
+func (c *Client) init() {
+	c.once.Do(func() {
+		if c.HTTPClient == nil {
+			c.HTTPClient = http.DefaultClient
+		}
+		if c.BaseURL == "" {
+			c.BaseURL = DefaultBaseURL
+		}
+		if c.Timezone == "" {
+			c.Timezone = DefaultTimezone
+		}
+	})
+}
+
+// FetchAvailability returns the availability of cal for one month. It
+// returns a *StatusError for non-200 responses and a *SchemaDriftError if
+// the response no longer has the expected shape. It doesn't retry.
+func (c *Client) FetchAvailability(ctx context.Context, cal Calendar, year, month int) (*Response, error) {
+	c.init()
+	requestURL := fmt.Sprintf("%s/calendar/%s/availability?year=%d&month=%d&timezone=%s&quantity_details[0][type]=default&quantity_details[0][quantity]=1&quantity_details[0][name]=Default&teammate_id=all&duration=30&is_manual=false",
+		c.BaseURL, url.PathEscape(cal.ID), year, month, url.QueryEscape(c.Timezone))
+	if cal.VariantID != "" {
+		requestURL += "&variant_id=" + url.QueryEscape(cal.VariantID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch availability: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{StatusCode: resp.StatusCode, RetryAfter: resp.Header.Get("Retry-After")}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	unknown, err := CheckSchema(body)
+	if err != nil {
+		return nil, err
+	}
+	if len(unknown) > 0 && c.OnUnknownFields != nil {
+		c.OnUnknownFields(unknown)
+	}
+
+	var response Response
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformed, err)
+	}
+	return &response, nil
+}
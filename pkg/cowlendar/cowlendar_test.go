@@ -0,0 +1,63 @@
+package cowlendar
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestFetchAvailability(t *testing.T) {
+	var query map[string]string
+	body := `{"long":[{"slot_start":"2025-07-01 10:00","slot_end":"2025-07-01 10:30","is_bookable":true,"qty_left":2,"max_qty":4,"waitlist":false}]}`
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/calendar/cal-1/availability" {
+			t.Errorf("request path = %q, want the calendar's availability", r.URL.Path)
+		}
+		q := r.URL.Query()
+		query = map[string]string{"year": q.Get("year"), "month": q.Get("month"), "timezone": q.Get("timezone"), "variant_id": q.Get("variant_id")}
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	var unknown []string
+	client := &Client{BaseURL: server.URL, OnUnknownFields: func(fields []string) { unknown = fields }}
+	resp, err := client.FetchAvailability(context.Background(), Calendar{ID: "cal-1", VariantID: "v-2"}, 2025, 7)
+	if err != nil {
+		t.Fatalf("FetchAvailability() error = %v", err)
+	}
+	want := map[string]string{"year": "2025", "month": "7", "timezone": DefaultTimezone, "variant_id": "v-2"}
+	if !reflect.DeepEqual(query, want) {
+		t.Errorf("query = %v, want %v", query, want)
+	}
+	if len(resp.Long) != 1 || resp.Long[0].QtyLeft != 2 || resp.Long[0].MaxQty != 4 {
+		t.Errorf("FetchAvailability() = %+v, want the one slot", resp)
+	}
+	if !reflect.DeepEqual(unknown, []string{"long[].waitlist"}) {
+		t.Errorf("OnUnknownFields got %v, want long[].waitlist", unknown)
+	}
+
+	status = http.StatusServiceUnavailable
+	_, err = client.FetchAvailability(context.Background(), Calendar{ID: "cal-1"}, 2025, 7)
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable || statusErr.RetryAfter != "30" {
+		t.Errorf("FetchAvailability() error = %v, want a 503 StatusError with Retry-After", err)
+	}
+
+	status, body = http.StatusOK, `{"slots":[]}`
+	_, err = client.FetchAvailability(context.Background(), Calendar{ID: "cal-1"}, 2025, 7)
+	var drift *SchemaDriftError
+	if !errors.As(err, &drift) {
+		t.Errorf("FetchAvailability() error = %v, want a SchemaDriftError", err)
+	}
+
+	body = `{"long":[],"next_unix":1.5}`
+	if _, err := client.FetchAvailability(context.Background(), Calendar{ID: "cal-1"}, 2025, 7); !errors.Is(err, ErrMalformed) {
+		t.Errorf("FetchAvailability() error = %v, want ErrMalformed", err)
+	}
+}
@@ -0,0 +1,124 @@
+package cowlendar
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// schemaField is a response field the scraper reads and the JSON type it
+// must have. Null is accepted for optional fields.
+type schemaField struct {
+	kind     string
+	required bool
+}
+
+// responseFields and slotFields describe the parts of an availability
+// response that Response and Slot decode.
+var (
+	responseFields = map[string]schemaField{
+		"long":                     {"array", true},
+		"short":                    {"array", false},
+		"max_date":                 {"string", false},
+		"next_availability":        {"string", false},
+		"no_availability_in_futur": {"boolean", false},
+		"target_timezone":          {"string", false},
+		"next_unix":                {"number", false},
+		"jump_to_next_avs":         {"boolean", false},
+	}
+	slotFields = map[string]schemaField{
+		"slot":          {"string", false},
+		"slot_start":    {"string", true},
+		"slot_end":      {"string", true},
+		"slot_duration": {"number", false},
+		"is_bookable":   {"boolean", true},
+		"qty_booked":    {"number", false},
+		"qty_left":      {"number", true},
+		"max_qty":       {"number", false},
+	}
+)
+
+// SchemaDriftError means a Cowlendar response no longer has the shape this
+// package expects, so its slots can't be trusted.
+type SchemaDriftError struct {
+	Problems []string // What differs, e.g. "long[].slot_start is missing"
+}
+
+func (e *SchemaDriftError) Error() string {
+	return "Cowlendar response changed shape: " + strings.Join(e.Problems, "; ")
+}
+
+// CheckSchema compares an availability response body with the fields
+// Response and Slot decode. It returns a *SchemaDriftError if any are
+// missing or of the wrong type, and separately the fields it doesn't know,
+// which are harmless until Cowlendar starts relying on them.
+func CheckSchema(body []byte) (unknown []string, err error) {
+	var response map[string]any
+	if err := json.Unmarshal(body, &response); err != nil || response == nil {
+		return nil, &SchemaDriftError{Problems: []string{"response is not a JSON object"}}
+	}
+
+	var problems []string
+	seen := make(map[string]bool)
+	note := func(list *[]string, s string) {
+		if !seen[s] {
+			seen[s] = true
+			*list = append(*list, s)
+		}
+	}
+	checkFields := func(prefix string, obj map[string]any, fields map[string]schemaField) {
+		for name, field := range fields {
+			v, ok := obj[name]
+			switch {
+			case !ok && field.required:
+				note(&problems, fmt.Sprintf("%s%s is missing", prefix, name))
+			case !ok || (v == nil && !field.required):
+			case jsonKind(v) != field.kind:
+				note(&problems, fmt.Sprintf("%s%s is %s, want %s", prefix, name, jsonKind(v), field.kind))
+			}
+		}
+		for name := range obj {
+			if _, ok := fields[name]; !ok {
+				note(&unknown, prefix+name)
+			}
+		}
+	}
+
+	checkFields("", response, responseFields)
+	if slots, ok := response["long"].([]any); ok {
+		for _, slot := range slots {
+			obj, ok := slot.(map[string]any)
+			if !ok {
+				note(&problems, fmt.Sprintf("long[] entry is %s, want object", jsonKind(slot)))
+				continue
+			}
+			checkFields("long[].", obj, slotFields)
+		}
+	}
+
+	sort.Strings(problems)
+	sort.Strings(unknown)
+	if len(problems) > 0 {
+		return unknown, &SchemaDriftError{Problems: problems}
+	}
+	return unknown, nil
+}
+
+// jsonKind names the JSON type of a value decoded into an any.
+func jsonKind(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	default:
+		return "object"
+	}
+}
@@ -0,0 +1,43 @@
+package cowlendar
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckSchema(t *testing.T) {
+	const slot = `{"slot":"10:00","slot_start":"2024-05-14 10:00","slot_end":"2024-05-14 10:30","slot_duration":30,"is_bookable":true,"qty_booked":0,"qty_left":1,"max_qty":1}`
+	tests := []struct {
+		name        string
+		body        string
+		wantDrift   string
+		wantUnknown []string
+	}{
+		{"Valid", `{"short":[],"long":[` + slot + `],"next_availability":"2024-05-14","next_unix":null}`, "", nil},
+		{"NoSlots", `{"long":[]}`, "", nil},
+		{"NewFields", `{"long":[],"waitlist":true,"max_date":"2024-06-01"}`, "", []string{"waitlist"}},
+		{"NotJSON", `<html>maintenance</html>`, "not a JSON object", nil},
+		{"MissingLong", `{"short":[],"slots":[]}`, "long is missing", []string{"slots"}},
+		{"LongIsObject", `{"long":{}}`, "long is object, want array", nil},
+		{"SlotFieldRenamed", `{"long":[{"start":"2024-05-14 10:00","slot_end":"2024-05-14 10:30","is_bookable":true,"qty_left":1}]}`, "long[].slot_start is missing", []string{"long[].start"}},
+		{"SlotFieldType", `{"long":[{"slot_start":"2024-05-14 10:00","slot_end":"2024-05-14 10:30","is_bookable":"yes","qty_left":1}]}`, "long[].is_bookable is string, want boolean", nil},
+		{"OptionalFieldType", `{"long":[],"next_availability":20240514}`, "next_availability is number, want string", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unknown, err := CheckSchema([]byte(tt.body))
+			var drift *SchemaDriftError
+			switch {
+			case tt.wantDrift == "" && err != nil:
+				t.Errorf("CheckSchema() error = %v, want nil", err)
+			case tt.wantDrift != "" && (!errors.As(err, &drift) || !strings.Contains(err.Error(), tt.wantDrift)):
+				t.Errorf("CheckSchema() error = %v, want drift mentioning %q", err, tt.wantDrift)
+			}
+			if !reflect.DeepEqual(unknown, tt.wantUnknown) {
+				t.Errorf("CheckSchema() unknown = %v, want %v", unknown, tt.wantUnknown)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+// Package filter decides which appointment slots a watcher notifies about:
+// Watch holds a watch's top-level filters, and Slots the narrower
+// preferences of a recipient, campaign or profile.
+//
+//	watch, err := filter.NewWatch(filter.WatchOptions{Weekdays: []string{"Sat", "Sun"}, EarliestTime: "10:00"})
+//	if err != nil {
+//		return err
+//	}
+//	wanted := watch.Apply(appointments)
+package filter
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pashbylogan/melanzana/pkg/store"
+)
+
+// Slots is a set of preferences compiled for evaluation per slot, by New
+// or Compile.
+type Slots struct {
+	minSpaces int
+	anyDay    bool
+	weekdays  uint8    // bit n set for time.Weekday(n)
+	calendars []string // calendar names to accept; empty accepts all
+	from, to  string   // first and last dates to accept as YYYY-MM-DD; empty is unbounded
+}
+
+// Compile is New for preferences that must be valid: it rejects unknown
+// weekdays and negative minimums rather than ignoring them. Calendar names
+// aren't checked, as only the caller knows which calendars exist.
+func Compile(weekdays []string, minSpaces int, calendars []string) (Slots, error) {
+	if minSpaces < 0 {
+		return Slots{}, fmt.Errorf("minSpaces must not be negative, got %d", minSpaces)
+	}
+	for _, day := range weekdays {
+		if _, ok := ParseWeekday(day); !ok {
+			return Slots{}, fmt.Errorf("invalid weekday %q; use a day name such as \"Sat\" or \"saturday\"", day)
+		}
+	}
+	return New(weekdays, minSpaces, calendars), nil
+}
+
+// New compiles preferences for slots on weekdays, with at least minSpaces
+// spaces, in calendars. Empty weekdays or calendars accept any; weekdays it
+// doesn't recognise are ignored.
+func New(weekdays []string, minSpaces int, calendars []string) Slots {
+	f := Slots{minSpaces: minSpaces, anyDay: len(weekdays) == 0, calendars: calendars}
+	for _, day := range weekdays {
+		if weekday, ok := ParseWeekday(day); ok {
+			f.weekdays |= 1 << weekday
+		}
+	}
+	return f
+}
+
+// Within limits f to slots dated from through to, as YYYY-MM-DD; either
+// may be empty to leave that end open.
+func (f Slots) Within(from, to string) (Slots, error) {
+	for _, date := range []string{from, to} {
+		if _, err := time.Parse("2006-01-02", date); date != "" && err != nil {
+			return Slots{}, fmt.Errorf("invalid date %q; use YYYY-MM-DD", date)
+		}
+	}
+	if from != "" && to != "" && to < from {
+		return Slots{}, fmt.Errorf("date window ends (%s) before it starts (%s)", to, from)
+	}
+	f.from, f.to = from, to
+	return f, nil
+}
+
+// Match reports whether appt passes the filter. Slots with unparseable
+// dates pass any weekday preference.
+func (f Slots) Match(appt store.Appointment) bool {
+	return f.match(appt, slotWeekday(appt.Date))
+}
+
+// match is Match for a slot whose weekday is already known, or -1.
+func (f Slots) match(appt store.Appointment, weekday int8) bool {
+	if appt.Spaces < f.minSpaces {
+		return false
+	}
+	if (f.from != "" && appt.Date < f.from) || (f.to != "" && appt.Date > f.to) {
+		return false
+	}
+	if len(f.calendars) > 0 && !slices.Contains(f.calendars, appt.Calendar) {
+		return false
+	}
+	return f.anyDay || weekday < 0 || f.weekdays&(1<<weekday) != 0
+}
+
+// SelectFrom returns the slots in idx that pass the filter, collected in
+// *buf so its storage is reused from call to call. If every slot passes,
+// idx's own slice is returned instead of a copy, so the result must not be
+// modified.
+func (f Slots) SelectFrom(idx Index, buf *[]store.Appointment) []store.Appointment {
+	if f.anyDay && len(f.calendars) == 0 && f.from == "" && f.to == "" && f.minSpaces <= idx.minSpaces {
+		return idx.appointments
+	}
+	*buf = (*buf)[:0]
+	for i, appt := range idx.appointments {
+		if f.match(appt, idx.weekdays[i]) {
+			*buf = append(*buf, appt)
+		}
+	}
+	return *buf
+}
+
+// Index holds appointments with their weekdays decoded up front, so that
+// evaluating many filters against them is a couple of comparisons per slot
+// rather than a date parse.
+type Index struct {
+	appointments []store.Appointment
+	weekdays     []int8 // time.Weekday of each appointment, or -1 if its date doesn't parse
+	minSpaces    int    // fewest spaces of any appointment
+}
+
+// NewIndex indexes appointments for SelectFrom.
+func NewIndex(appointments []store.Appointment) Index {
+	idx := Index{appointments: appointments, weekdays: make([]int8, len(appointments))}
+	for i, appt := range appointments {
+		// Slots arrive grouped by day, so most dates were parsed just before.
+		if i > 0 && appt.Date == appointments[i-1].Date {
+			idx.weekdays[i] = idx.weekdays[i-1]
+		} else {
+			idx.weekdays[i] = slotWeekday(appt.Date)
+		}
+		if i == 0 || appt.Spaces < idx.minSpaces {
+			idx.minSpaces = appt.Spaces
+		}
+	}
+	return idx
+}
+
+func slotWeekday(date string) int8 {
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return -1
+	}
+	return int8(t.Weekday())
+}
+
+// ParseWeekday accepts full or abbreviated (at least three letters) weekday
+// names in any case, e.g. "Sat", "saturday".
+func ParseWeekday(name string) (time.Weekday, bool) {
+	name = strings.TrimSpace(name)
+	if len(name) < 3 {
+		return 0, false
+	}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if full := day.String(); len(name) <= len(full) && strings.EqualFold(full[:len(name)], name) {
+			return day, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,57 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/pashbylogan/melanzana/pkg/store"
+)
+
+func TestSlots(t *testing.T) {
+	saturday := store.Appointment{Date: "2024-06-15", Time: "10:00 am – 10:30 am", Spaces: 2, Calendar: "Main"}
+	sunday := store.Appointment{Date: "2024-06-16", Time: "10:00 am – 10:30 am", Spaces: 1}
+	undated := store.Appointment{Date: "soon", Time: "10:00 am – 10:30 am", Spaces: 2}
+
+	weekend, err := Compile([]string{"Sat"}, 2, nil)
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	dated, err := New(nil, 0, []string{"Main"}).Within("2024-06-15", "2024-06-15")
+	if err != nil {
+		t.Fatalf("Within() error = %v", err)
+	}
+	tests := []struct {
+		name   string
+		filter Slots
+		want   []bool // saturday, sunday, undated
+	}{
+		{"Any", New(nil, 0, nil), []bool{true, true, true}},
+		{"WeekdayAndSpaces", weekend, []bool{true, false, true}},
+		{"CalendarAndDates", dated, []bool{true, false, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, appt := range []store.Appointment{saturday, sunday, undated} {
+				if got := tt.filter.Match(appt); got != tt.want[i] {
+					t.Errorf("Match(%s) = %v, want %v", appt.Date, got, tt.want[i])
+				}
+			}
+			var buf []store.Appointment
+			var want int
+			for _, w := range tt.want {
+				if w {
+					want++
+				}
+			}
+			if got := tt.filter.SelectFrom(NewIndex([]store.Appointment{saturday, sunday, undated}), &buf); len(got) != want {
+				t.Errorf("SelectFrom() = %+v, want %d slots", got, want)
+			}
+		})
+	}
+
+	if _, err := Compile([]string{"Someday"}, 0, nil); err == nil {
+		t.Errorf("Compile() with an unknown weekday error = nil, want error")
+	}
+	if _, err := New(nil, 0, nil).Within("2024-06-20", "2024-06-10"); err == nil {
+		t.Errorf("Within() ending before it starts error = nil, want error")
+	}
+}
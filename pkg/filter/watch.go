@@ -0,0 +1,164 @@
+package filter
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/pashbylogan/melanzana/pkg/store"
+)
+
+// WatchOptions are a watch's top-level filters. Empty fields don't filter.
+type WatchOptions struct {
+	Weekdays      []string // Day names such as "Sat" or "saturday"
+	MinSpaces     int
+	EarliestTime  string   // 24-hour "HH:MM" a slot may start at the earliest
+	LatestTime    string   // 24-hour "HH:MM" a slot must end by
+	NotBefore     string   // First slot date to accept, as YYYY-MM-DD
+	NotAfter      string   // Last slot date to accept, as YYYY-MM-DD
+	BlackoutDates []string // Dates, "2025-07-04", or inclusive ranges, "2025-07-10..2025-07-12", to skip
+}
+
+// Watch is the top-level filtering stage: slots that fail it are never
+// notified, whichever watch, campaign or profile they reach. Recipient,
+// campaign and profile preferences can only narrow it further.
+type Watch struct {
+	slots    Slots
+	earliest int // Minutes after midnight a slot may start; -1 for no limit
+	latest   int // Minutes after midnight a slot must end by; -1 for no limit
+
+	notBefore, notAfter string // Inclusive date window as YYYY-MM-DD; empty for no limit
+	blackouts           []dateRange
+}
+
+// dateRange is an inclusive range of YYYY-MM-DD dates.
+type dateRange struct {
+	first, last string
+}
+
+// parseBlackout parses a blackout date, "2025-07-04", or an inclusive range,
+// "2025-07-10..2025-07-12".
+func parseBlackout(value string) (dateRange, error) {
+	first, last, isRange := strings.Cut(value, "..")
+	if !isRange {
+		last = first
+	}
+	first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+	for _, d := range []string{first, last} {
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			return dateRange{}, fmt.Errorf("blackoutDates entry %q must be a date like \"2025-07-04\" or a range like \"2025-07-10..2025-07-12\"", value)
+		}
+	}
+	if first > last {
+		return dateRange{}, fmt.Errorf("blackoutDates range %q ends before it starts", value)
+	}
+	return dateRange{first, last}, nil
+}
+
+// NewWatch compiles the top-level filters in o. Errors name the fields by
+// their configuration keys, e.g. "earliestTime".
+func NewWatch(o WatchOptions) (Watch, error) {
+	slots, err := Compile(o.Weekdays, o.MinSpaces, nil)
+	if err != nil {
+		return Watch{}, err
+	}
+	f := Watch{slots: slots, earliest: -1, latest: -1}
+	if f.earliest, err = parseTimeOfDay("earliestTime", o.EarliestTime); err != nil {
+		return Watch{}, err
+	}
+	if f.latest, err = parseTimeOfDay("latestTime", o.LatestTime); err != nil {
+		return Watch{}, err
+	}
+	if f.earliest >= 0 && f.latest >= 0 && f.earliest >= f.latest {
+		return Watch{}, fmt.Errorf("earliestTime %s must be before latestTime %s", o.EarliestTime, o.LatestTime)
+	}
+	for _, d := range []struct{ field, value string }{{"notBefore", o.NotBefore}, {"notAfter", o.NotAfter}} {
+		if _, err := time.Parse("2006-01-02", d.value); d.value != "" && err != nil {
+			return Watch{}, fmt.Errorf("%s must be a date like \"2025-07-01\", got %q", d.field, d.value)
+		}
+	}
+	if o.NotBefore != "" && o.NotAfter != "" && o.NotBefore > o.NotAfter {
+		return Watch{}, fmt.Errorf("notBefore %s is after notAfter %s", o.NotBefore, o.NotAfter)
+	}
+	f.notBefore, f.notAfter = o.NotBefore, o.NotAfter
+	for _, value := range o.BlackoutDates {
+		r, err := parseBlackout(value)
+		if err != nil {
+			return Watch{}, err
+		}
+		f.blackouts = append(f.blackouts, r)
+	}
+	return f, nil
+}
+
+// parseTimeOfDay parses a 24-hour "HH:MM" time into minutes after midnight,
+// or -1 if value is empty.
+func parseTimeOfDay(field, value string) (int, error) {
+	if value == "" {
+		return -1, nil
+	}
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a 24-hour time like \"15:00\", got %q", field, value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Apply returns the appointments that pass the filter.
+func (f Watch) Apply(appointments []store.Appointment) []store.Appointment {
+	var buf []store.Appointment
+	kept := f.slots.SelectFrom(NewIndex(appointments), &buf)
+	if f.earliest >= 0 || f.latest >= 0 || f.notBefore != "" || f.notAfter != "" || len(f.blackouts) > 0 {
+		inWindow := make([]store.Appointment, 0, len(kept))
+		for _, appt := range kept {
+			if f.withinDates(appt) && f.withinHours(appt) {
+				inWindow = append(inWindow, appt)
+			}
+		}
+		kept = inWindow
+	}
+	if len(kept) < len(appointments) {
+		slog.Info("Slots pass the configured filters", "kept", len(kept), "total", len(appointments))
+	}
+	return kept
+}
+
+// withinDates reports whether appt falls between notBefore and notAfter and
+// outside every blackout. Dates are YYYY-MM-DD, so they order as strings.
+func (f Watch) withinDates(appt store.Appointment) bool {
+	if (f.notBefore != "" && appt.Date < f.notBefore) || (f.notAfter != "" && appt.Date > f.notAfter) {
+		return false
+	}
+	for _, r := range f.blackouts {
+		if appt.Date >= r.first && appt.Date <= r.last {
+			return false
+		}
+	}
+	return true
+}
+
+// withinHours reports whether appt starts no earlier than earliest and ends
+// by latest. Slots whose times can't be parsed pass.
+func (f Watch) withinHours(appt store.Appointment) bool {
+	startText, endText, ok := strings.Cut(appt.Time, " – ")
+	if !ok {
+		return true
+	}
+	start, err := time.Parse("2006-01-02 3:04 pm", appt.Date+" "+startText)
+	if err != nil {
+		return true
+	}
+	end, err := time.Parse("2006-01-02 3:04 pm", appt.Date+" "+endText)
+	if err != nil {
+		return true
+	}
+	if f.earliest >= 0 && start.Hour()*60+start.Minute() < f.earliest {
+		return false
+	}
+	endMinute := end.Hour()*60 + end.Minute()
+	if !end.After(start) {
+		endMinute += 24 * 60 // ends at or after midnight
+	}
+	return f.latest < 0 || endMinute <= f.latest
+}
@@ -0,0 +1,140 @@
+package filter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pashbylogan/melanzana/pkg/store"
+)
+
+func TestWatchMinSpaces(t *testing.T) {
+	scraped := []store.Appointment{
+		{Date: "2024-06-15", Time: "10:00 am – 10:30 am", Spaces: 4, MaxSpaces: 4},
+		{Date: "2024-06-15", Time: "10:30 am – 11:00 am", Spaces: 2, MaxSpaces: 4},
+	}
+
+	f, err := NewWatch(WatchOptions{MinSpaces: 4})
+	if err != nil {
+		t.Fatalf("NewWatch() error = %v", err)
+	}
+	if got := f.Apply(scraped); len(got) != 1 || got[0].Spaces != 4 {
+		t.Errorf("Apply() = %+v, want only the slot with 4 spaces", got)
+	}
+
+	f, _ = NewWatch(WatchOptions{})
+	if got := f.Apply(scraped); len(got) != 2 {
+		t.Errorf("Apply() without filters kept %d slots, want 2", len(got))
+	}
+
+	if _, err := NewWatch(WatchOptions{MinSpaces: -1}); err == nil {
+		t.Errorf("NewWatch() with negative minSpaces error = nil, want error")
+	}
+}
+
+func TestWatchWeekdaysAndHours(t *testing.T) {
+	scraped := []store.Appointment{
+		{Date: "2024-06-14", Time: "11:00 am – 11:30 am", Spaces: 1}, // Friday
+		{Date: "2024-06-15", Time: "9:30 am – 10:00 am", Spaces: 1},
+		{Date: "2024-06-15", Time: "10:00 am – 10:30 am", Spaces: 1},
+		{Date: "2024-06-15", Time: "2:30 pm – 3:00 pm", Spaces: 1},
+		{Date: "2024-06-15", Time: "2:45 pm – 3:15 pm", Spaces: 1},
+		{Date: "2024-06-16", Time: "11:30 pm – 12:00 am", Spaces: 1},
+	}
+
+	tests := []struct {
+		name string
+		opts WatchOptions
+		want []string
+	}{
+		{"Weekdays", WatchOptions{Weekdays: []string{"Sat"}}, []string{
+			"2024-06-15 9:30 am", "2024-06-15 10:00 am", "2024-06-15 2:30 pm", "2024-06-15 2:45 pm",
+		}},
+		{"Hours", WatchOptions{EarliestTime: "10:00", LatestTime: "15:00"}, []string{
+			"2024-06-14 11:00 am", "2024-06-15 10:00 am", "2024-06-15 2:30 pm",
+		}},
+		{"EarliestOnly", WatchOptions{EarliestTime: "14:30"}, []string{
+			"2024-06-15 2:30 pm", "2024-06-15 2:45 pm", "2024-06-16 11:30 pm",
+		}},
+		{"Both", WatchOptions{Weekdays: []string{"saturday", "Sun"}, EarliestTime: "10:00", LatestTime: "15:00"}, []string{
+			"2024-06-15 10:00 am", "2024-06-15 2:30 pm",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewWatch(tt.opts)
+			if err != nil {
+				t.Fatalf("NewWatch() error = %v", err)
+			}
+			var got []string
+			for _, appt := range f.Apply(scraped) {
+				start, _, _ := strings.Cut(appt.Time, " – ")
+				got = append(got, appt.Date+" "+start)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Apply() kept %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	for _, opts := range []WatchOptions{
+		{Weekdays: []string{"Someday"}},
+		{EarliestTime: "10am"},
+		{LatestTime: "25:00"},
+		{EarliestTime: "15:00", LatestTime: "10:00"},
+	} {
+		if _, err := NewWatch(opts); err == nil {
+			t.Errorf("NewWatch(%+v) error = nil, want error", opts)
+		}
+	}
+}
+
+func TestWatchDateRange(t *testing.T) {
+	scraped := []store.Appointment{
+		{Date: "2025-06-30", Time: "10:00 am – 10:30 am", Spaces: 1},
+		{Date: "2025-07-01", Time: "10:00 am – 10:30 am", Spaces: 1},
+		{Date: "2025-07-20", Time: "10:00 am – 10:30 am", Spaces: 1},
+		{Date: "2025-07-21", Time: "10:00 am – 10:30 am", Spaces: 1},
+	}
+
+	tests := []struct {
+		name string
+		opts WatchOptions
+		want []string
+	}{
+		{"Window", WatchOptions{NotBefore: "2025-07-01", NotAfter: "2025-07-20"}, []string{"2025-07-01", "2025-07-20"}},
+		{"NotBeforeOnly", WatchOptions{NotBefore: "2025-07-20"}, []string{"2025-07-20", "2025-07-21"}},
+		{"NotAfterOnly", WatchOptions{NotAfter: "2025-06-30"}, []string{"2025-06-30"}},
+		{"SingleDay", WatchOptions{NotBefore: "2025-07-01", NotAfter: "2025-07-01"}, []string{"2025-07-01"}},
+		{"Blackouts", WatchOptions{BlackoutDates: []string{"2025-06-30", "2025-07-15..2025-07-20"}}, []string{"2025-07-01", "2025-07-21"}},
+		{"BlackoutInWindow", WatchOptions{NotAfter: "2025-07-20", BlackoutDates: []string{"2025-07-01 .. 2025-07-01"}}, []string{"2025-06-30", "2025-07-20"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewWatch(tt.opts)
+			if err != nil {
+				t.Fatalf("NewWatch() error = %v", err)
+			}
+			var got []string
+			for _, appt := range f.Apply(scraped) {
+				got = append(got, appt.Date)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Apply() kept %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	for _, opts := range []WatchOptions{
+		{NotBefore: "July 1"},
+		{NotAfter: "2025-02-30"},
+		{NotBefore: "2025-07-20", NotAfter: "2025-07-01"},
+		{BlackoutDates: []string{"July 4"}},
+		{BlackoutDates: []string{"2025-07-10..July 12"}},
+		{BlackoutDates: []string{"2025-07-12..2025-07-10"}},
+	} {
+		if _, err := NewWatch(opts); err == nil {
+			t.Errorf("NewWatch(%+v) error = nil, want error", opts)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// Package notify delivers messages over the channels a Melanzana watcher
+// notifies on: email over SMTP or through SendGrid, Mailgun or Amazon SES,
+// text messages through Twilio, Telegram messages through a bot, and JSON
+// webhooks. Each sender is configured by its fields and sends once; retries
+// are left to the caller.
+//
+//	email := notify.Email{Provider: notify.ProviderSendGrid, APIKey: key, FromEmail: "watch@example.com", ToEmails: []string{"me@example.com"}}
+//	err := email.Send("New slots", "2 new slots on Saturday", "")
+package notify
+
+import (
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+
+	"github.com/pashbylogan/melanzana/pkg/awssig"
+)
+
+// Email holds the transport settings and recipients of an email.
+type Email struct {
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	FromEmail    string
+	ToEmails     []string
+	TLSMode      string // auto, implicit, starttls or none
+	SkipVerify   bool   // skip TLS certificate verification
+	AuthMethod   string // auto, plain, login, cram-md5 or xoauth2
+	OAuth2       OAuth2
+
+	Provider      string // smtp (default), sendgrid, mailgun or ses
+	APIKey        string // SendGrid or Mailgun API key
+	MailgunDomain string
+	MailgunRegion string // us (default) or eu
+	SESRegion     string
+	AWS           awssig.Credentials
+
+	// Endpoints of the email APIs; empty uses the provider's own.
+	SendGridURL string
+	MailgunURL  string // Base URL, before the domain
+	SESURL      string
+
+	HTTPClient *http.Client // For the email APIs and OAuth2; nil uses http.DefaultClient
+}
+
+// Send constructs and sends an email. If htmlBody is non-empty the message
+// is sent as multipart/alternative with both text and HTML parts. Messages
+// go over SMTP unless an HTTP email provider is configured.
+func (e Email) Send(subject string, textBody string, htmlBody string) error {
+	if e.Provider != "" && !strings.EqualFold(e.Provider, ProviderSMTP) {
+		if err := sendViaProvider(e, subject, textBody, htmlBody); err != nil {
+			return fmt.Errorf("failed to send email: %w", err)
+		}
+		return nil
+	}
+
+	msg, err := e.Message(subject, textBody, htmlBody)
+	if err != nil {
+		return err
+	}
+
+	if err := deliverSMTP(e, msg); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+// Message assembles the raw RFC 5322 message bytes.
+func (e Email) Message(subject string, textBody string, htmlBody string) ([]byte, error) {
+	msg := strings.Builder{}
+	msg.WriteString("From: " + e.FromEmail + "\r\n")
+	msg.WriteString("To: " + strings.Join(e.ToEmails, ",") + "\r\n")
+	// Subjects may hold dashes, accents or a campaign name the recipient
+	// chose, and a header carries ASCII only.
+	msg.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+
+	if htmlBody == "" {
+		msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+		msg.WriteString("\r\n") // Empty line separates headers from body
+		msg.WriteString(textBody + "\r\n")
+		return []byte(msg.String()), nil
+	}
+
+	var parts strings.Builder
+	mw := multipart.NewWriter(&parts)
+	msg.WriteString("Content-Type: multipart/alternative; boundary=" + mw.Boundary() + "\r\n")
+	msg.WriteString("\r\n")
+
+	for _, part := range []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain; charset=UTF-8", textBody},
+		{"text/html; charset=UTF-8", htmlBody},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create message part: %w", err)
+		}
+		if _, err := w.Write([]byte(part.body + "\r\n")); err != nil {
+			return nil, fmt.Errorf("failed to write message part: %w", err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish message: %w", err)
+	}
+
+	msg.WriteString(parts.String())
+	return []byte(msg.String()), nil
+}
+
+// httpClient returns client, or http.DefaultClient if it is nil.
+func httpClient(client *http.Client) *http.Client {
+	if client == nil {
+		return http.DefaultClient
+	}
+	return client
+}
@@ -0,0 +1,47 @@
+package notify
+
+import (
+	"bytes"
+	"mime"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestEmailMessage(t *testing.T) {
+	email := Email{FromEmail: "from@example.com", ToEmails: []string{"to@example.com"}}
+
+	plain, err := email.Message("Subject", "text body", "")
+	if err != nil {
+		t.Fatalf("Message() error = %v", err)
+	}
+	if !strings.Contains(string(plain), "Content-Type: text/plain") {
+		t.Errorf("plain message missing text/plain content type:\n%s", plain)
+	}
+
+	multi, err := email.Message("Subject", "text body", "<p>html body</p>")
+	if err != nil {
+		t.Fatalf("Message() error = %v", err)
+	}
+	for _, substring := range []string{"multipart/alternative", "text body", "<p>html body</p>"} {
+		if !strings.Contains(string(multi), substring) {
+			t.Errorf("multipart message missing %q:\n%s", substring, multi)
+		}
+	}
+
+	subject := "Café slots – 15 May"
+	encoded, err := email.Message(subject, "text body", "")
+	if err != nil {
+		t.Fatalf("Message() error = %v", err)
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatalf("mail.ReadMessage() error = %v", err)
+	}
+	if raw := msg.Header.Get("Subject"); !strings.HasPrefix(raw, "=?utf-8?q?") {
+		t.Errorf("Subject header = %q, want it Q-encoded", raw)
+	}
+	if got, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject")); err != nil || got != subject {
+		t.Errorf("decoded Subject = %q, %v; want %q", got, err, subject)
+	}
+}
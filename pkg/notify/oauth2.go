@@ -0,0 +1,186 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Token endpoints for the providers accepted in OAuth2.Provider.
+var oauth2ProviderTokenURLs = map[string]string{
+	"google":    "https://oauth2.googleapis.com/token",
+	"microsoft": "https://login.microsoftonline.com/common/oauth2/v2.0/token",
+}
+
+// oauth2ExpiryMargin refreshes tokens slightly before they actually expire.
+const oauth2ExpiryMargin = 2 * time.Minute
+
+// OAuth2 holds the credentials used to obtain XOAUTH2 access tokens.
+type OAuth2 struct {
+	Provider     string // google or microsoft; sets TokenURL when it is empty
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	RefreshToken string
+	TokenFile    string // Optional cache for access tokens and rotated refresh tokens
+}
+
+// enabled reports whether enough OAuth2 settings are present to attempt XOAUTH2.
+func (c OAuth2) enabled() bool {
+	return c.RefreshToken != "" && c.ClientID != ""
+}
+
+// tokenURL returns the configured token endpoint, falling back to the provider default.
+func (c OAuth2) tokenURL() (string, error) {
+	if c.TokenURL != "" {
+		return c.TokenURL, nil
+	}
+	if u, ok := oauth2ProviderTokenURLs[strings.ToLower(c.Provider)]; ok {
+		return u, nil
+	}
+	return "", fmt.Errorf("no OAuth2 token URL configured and unknown provider %q", c.Provider)
+}
+
+// oauth2Token is an access token plus the refresh token that produced it.
+type oauth2Token struct {
+	AccessToken  string    `json:"accessToken"`
+	Expiry       time.Time `json:"expiry"`
+	RefreshToken string    `json:"refreshToken,omitempty"`
+}
+
+func (t *oauth2Token) valid(now time.Time) bool {
+	return t != nil && t.AccessToken != "" && now.Add(oauth2ExpiryMargin).Before(t.Expiry)
+}
+
+// loadCachedToken reads a cached token, returning nil if there is none.
+func loadCachedToken(path string) *oauth2Token {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Warn("Error reading OAuth2 token cache", "file", path, "err", err)
+		}
+		return nil
+	}
+	var token oauth2Token
+	if err := json.Unmarshal(data, &token); err != nil {
+		slog.Warn("Error parsing OAuth2 token cache", "file", path, "err", err)
+		return nil
+	}
+	return &token
+}
+
+// saveCachedToken writes the token cache with owner-only permissions.
+func saveCachedToken(path string, token *oauth2Token) error {
+	data, err := json.MarshalIndent(token, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal OAuth2 token: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write OAuth2 token cache %s: %w", path, err)
+	}
+	return nil
+}
+
+// accessToken returns a valid access token, using the cache when possible and
+// otherwise exchanging the refresh token at the provider's token endpoint
+// through client. Providers that rotate refresh tokens (Microsoft) return a
+// new one, which is kept in the cache and preferred over the configured
+// token on later runs.
+func (c OAuth2) accessToken(client *http.Client) (string, error) {
+	now := time.Now()
+	cached := loadCachedToken(c.TokenFile)
+	if cached.valid(now) {
+		return cached.AccessToken, nil
+	}
+
+	refreshToken := c.RefreshToken
+	if cached != nil && cached.RefreshToken != "" {
+		refreshToken = cached.RefreshToken
+	}
+
+	tokenURL, err := c.tokenURL()
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+		"client_id":     {c.ClientID},
+	}
+	if c.ClientSecret != "" {
+		form.Set("client_secret", c.ClientSecret)
+	}
+
+	resp, err := httpClient(client).PostForm(tokenURL, form)
+	if err != nil {
+		return "", fmt.Errorf("failed to refresh OAuth2 token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int    `json:"expires_in"`
+		RefreshToken     string `json:"refresh_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to parse OAuth2 token response (status %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || body.AccessToken == "" {
+		return "", fmt.Errorf("OAuth2 token refresh failed (status %d): %s %s", resp.StatusCode, body.Error, body.ErrorDescription)
+	}
+
+	token := &oauth2Token{
+		AccessToken:  body.AccessToken,
+		Expiry:       now.Add(time.Duration(body.ExpiresIn) * time.Second),
+		RefreshToken: refreshToken,
+	}
+	if body.RefreshToken != "" && body.RefreshToken != refreshToken {
+		slog.Info("OAuth2 provider issued a new refresh token")
+		token.RefreshToken = body.RefreshToken
+	}
+
+	if c.TokenFile != "" {
+		if err := saveCachedToken(c.TokenFile, token); err != nil {
+			slog.Warn("Error caching OAuth2 token", "err", err)
+		}
+	}
+	return token.AccessToken, nil
+}
+
+// xoauth2Auth implements the SASL XOAUTH2 mechanism used by Gmail and Office365.
+type xoauth2Auth struct {
+	username, token, host string
+}
+
+func (a *xoauth2Auth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	resp := "user=" + a.username + "\x01auth=Bearer " + a.token + "\x01\x01"
+	return "XOAUTH2", []byte(resp), nil
+}
+
+func (a *xoauth2Auth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		// The server sends a JSON error as a challenge; an empty response
+		// completes the exchange so the server returns its final error code.
+		return []byte{}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,82 @@
+package notify
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"path/filepath"
+	"testing"
+)
+
+func TestOAuth2AccessToken(t *testing.T) {
+	var requests int
+	var lastRefreshToken string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("ParseForm() error = %v", err)
+		}
+		lastRefreshToken = r.PostForm.Get("refresh_token")
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"access-%d","expires_in":3600,"refresh_token":"rotated"}`, requests)
+	}))
+	defer server.Close()
+
+	config := OAuth2{
+		TokenURL:     server.URL,
+		ClientID:     "client",
+		RefreshToken: "original",
+		TokenFile:    filepath.Join(t.TempDir(), "token.json"),
+	}
+
+	token, err := config.accessToken(nil)
+	if err != nil {
+		t.Fatalf("accessToken() error = %v", err)
+	}
+	if token != "access-1" || lastRefreshToken != "original" {
+		t.Errorf("accessToken() = %q using %q, want access-1 using original", token, lastRefreshToken)
+	}
+
+	// A second call is served from the cache without hitting the endpoint.
+	token, err = config.accessToken(nil)
+	if err != nil || token != "access-1" || requests != 1 {
+		t.Errorf("cached accessToken() = %q, %v after %d requests; want access-1 after 1", token, err, requests)
+	}
+
+	// Once the cached token expires, the rotated refresh token is used.
+	cached := loadCachedToken(config.TokenFile)
+	cached.Expiry = cached.Expiry.Add(-2 * oauth2ExpiryMargin * 100)
+	if err := saveCachedToken(config.TokenFile, cached); err != nil {
+		t.Fatalf("saveCachedToken() error = %v", err)
+	}
+	token, err = config.accessToken(nil)
+	if err != nil || token != "access-2" || lastRefreshToken != "rotated" {
+		t.Errorf("refreshed accessToken() = %q, %v using %q; want access-2 using rotated", token, err, lastRefreshToken)
+	}
+}
+
+func TestOAuth2TokenURL(t *testing.T) {
+	if u, err := (OAuth2{Provider: "Google"}).tokenURL(); err != nil || u != oauth2ProviderTokenURLs["google"] {
+		t.Errorf("tokenURL() for google = %q, %v", u, err)
+	}
+	if _, err := (OAuth2{Provider: "yahoo"}).tokenURL(); err == nil {
+		t.Errorf("tokenURL() for unknown provider error = nil, want error")
+	}
+}
+
+func TestXOAUTH2AuthStart(t *testing.T) {
+	auth := &xoauth2Auth{username: "me@gmail.com", token: "tok", host: "smtp.gmail.com"}
+
+	mech, resp, err := auth.Start(&smtp.ServerInfo{Name: "smtp.gmail.com", TLS: true})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if mech != "XOAUTH2" || string(resp) != "user=me@gmail.com\x01auth=Bearer tok\x01\x01" {
+		t.Errorf("Start() = %q, %q", mech, resp)
+	}
+
+	if _, _, err := auth.Start(&smtp.ServerInfo{Name: "smtp.gmail.com"}); err == nil {
+		t.Errorf("Start() over plaintext error = nil, want error")
+	}
+}
@@ -0,0 +1,182 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pashbylogan/melanzana/pkg/awssig"
+)
+
+// Email providers accepted in Email.Provider.
+const (
+	ProviderSMTP     = "smtp"
+	ProviderSendGrid = "sendgrid"
+	ProviderMailgun  = "mailgun"
+	ProviderSES      = "ses"
+)
+
+// The email APIs' own endpoints.
+const (
+	sendGridURL       = "https://api.sendgrid.com/v3/mail/send"
+	mailgunBaseURL    = "https://api.mailgun.net/v3"
+	mailgunEUBaseURL  = "https://api.eu.mailgun.net/v3"
+	sesEndpointFormat = "https://email.%s.amazonaws.com/v2/email/outbound-emails" // region
+)
+
+// sendViaProvider delivers an email through the configured HTTP email API.
+func sendViaProvider(config Email, subject, textBody, htmlBody string) error {
+	switch strings.ToLower(config.Provider) {
+	case ProviderSendGrid:
+		return sendViaSendGrid(config, subject, textBody, htmlBody)
+	case ProviderMailgun:
+		return sendViaMailgun(config, subject, textBody, htmlBody)
+	case ProviderSES:
+		return sendViaSES(config, subject, textBody, htmlBody)
+	default:
+		return fmt.Errorf("unknown email provider %q", config.Provider)
+	}
+}
+
+// sendViaSendGrid uses the SendGrid v3 mail send API.
+func sendViaSendGrid(config Email, subject, textBody, htmlBody string) error {
+	type address struct {
+		Email string `json:"email"`
+	}
+	type content struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}
+
+	var to []address
+	for _, addr := range config.ToEmails {
+		to = append(to, address{Email: addr})
+	}
+	contents := []content{{Type: "text/plain", Value: textBody}}
+	if htmlBody != "" {
+		contents = append(contents, content{Type: "text/html", Value: htmlBody})
+	}
+
+	payload := map[string]any{
+		"personalizations": []map[string]any{{"to": to}},
+		"from":             address{Email: config.FromEmail},
+		"subject":          subject,
+		"content":          contents,
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode SendGrid request: %w", err)
+	}
+
+	endpoint := config.SendGridURL
+	if endpoint == "" {
+		endpoint = sendGridURL
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build SendGrid request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+config.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	return doRequest(config.HTTPClient, "SendGrid", req)
+}
+
+// sendViaMailgun uses the Mailgun messages API.
+func sendViaMailgun(config Email, subject, textBody, htmlBody string) error {
+	if config.MailgunDomain == "" {
+		return fmt.Errorf("mailgunDomain is required for the mailgun provider")
+	}
+
+	base := config.MailgunURL
+	switch {
+	case base != "":
+	case strings.EqualFold(config.MailgunRegion, "eu"):
+		base = mailgunEUBaseURL
+	default:
+		base = mailgunBaseURL
+	}
+
+	form := url.Values{
+		"from":    {config.FromEmail},
+		"to":      config.ToEmails,
+		"subject": {subject},
+		"text":    {textBody},
+	}
+	if htmlBody != "" {
+		form.Set("html", htmlBody)
+	}
+
+	endpoint := base + "/" + url.PathEscape(config.MailgunDomain) + "/messages"
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to build Mailgun request: %w", err)
+	}
+	req.SetBasicAuth("api", config.APIKey)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return doRequest(config.HTTPClient, "Mailgun", req)
+}
+
+// sendViaSES uses the Amazon SES v2 SendEmail API with a raw MIME message.
+func sendViaSES(config Email, subject, textBody, htmlBody string) error {
+	if config.SESRegion == "" {
+		return fmt.Errorf("sesRegion is required for the ses provider")
+	}
+	creds := config.AWS.WithEnvFallback()
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return fmt.Errorf("AWS credentials are required for the ses provider")
+	}
+
+	msg, err := config.Message(subject, textBody, htmlBody)
+	if err != nil {
+		return err
+	}
+
+	payload := map[string]any{
+		"FromEmailAddress": config.FromEmail,
+		"Destination":      map[string]any{"ToAddresses": config.ToEmails},
+		"Content": map[string]any{
+			"Raw": map[string]string{"Data": base64.StdEncoding.EncodeToString(msg)},
+		},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode SES request: %w", err)
+	}
+
+	endpoint := config.SESURL
+	if endpoint == "" {
+		endpoint = fmt.Sprintf(sesEndpointFormat, config.SESRegion)
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build SES request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	awssig.Sign(req, body, creds, config.SESRegion, "ses", time.Now())
+
+	return doRequest(config.HTTPClient, "SES", req)
+}
+
+// doRequest sends req with client and converts non-2xx responses into
+// errors.
+func doRequest(client *http.Client, provider string, req *http.Request) error {
+	resp, err := httpClient(client).Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", provider, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s returned status %d: %s", provider, resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
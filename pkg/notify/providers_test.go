@@ -0,0 +1,74 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSendViaSendGrid(t *testing.T) {
+	var got map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer key" {
+			t.Errorf("Authorization = %q, want Bearer key", r.Header.Get("Authorization"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	email := Email{SendGridURL: server.URL, Provider: "sendgrid", APIKey: "key", FromEmail: "from@example.com", ToEmails: []string{"a@example.com", "b@example.com"}}
+	if err := email.Send("Subject", "text", "<p>html</p>"); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	if got["subject"] != "Subject" {
+		t.Errorf("subject = %v, want Subject", got["subject"])
+	}
+	if contents, _ := got["content"].([]any); len(contents) != 2 {
+		t.Errorf("content = %v, want text and html parts", got["content"])
+	}
+}
+
+func TestSendViaMailgun(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/mg.example.com/messages" {
+			t.Errorf("path = %q, want /mg.example.com/messages", r.URL.Path)
+		}
+		if user, pass, _ := r.BasicAuth(); user != "api" || pass != "key" {
+			t.Errorf("BasicAuth() = %q, %q; want api, key", user, pass)
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("ParseForm() error = %v", err)
+		}
+		if len(r.PostForm["to"]) != 2 || r.PostForm.Get("html") != "" {
+			t.Errorf("form = %v, want two recipients and no html", r.PostForm)
+		}
+	}))
+	defer server.Close()
+
+	email := Email{MailgunURL: server.URL, Provider: "mailgun", APIKey: "key", MailgunDomain: "mg.example.com", FromEmail: "from@example.com", ToEmails: []string{"a@example.com", "b@example.com"}}
+	if err := email.Send("Subject", "text", ""); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+}
+
+func TestSendViaProviderErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad key", http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	if err := (Email{SendGridURL: server.URL, Provider: "sendgrid"}).Send("s", "t", ""); err == nil {
+		t.Errorf("Send() with rejected key error = nil, want error")
+	}
+	if err := (Email{Provider: "pigeon"}).Send("s", "t", ""); err == nil {
+		t.Errorf("Send() with unknown provider error = nil, want error")
+	}
+	if err := (Email{Provider: "ses"}).Send("s", "t", ""); err == nil {
+		t.Errorf("Send() with ses and no region error = nil, want error")
+	}
+}
@@ -0,0 +1,41 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// twilioMessagesURL is Twilio's Messages API, formatted with the account SID.
+const twilioMessagesURL = "https://api.twilio.com/2010-04-01/Accounts/%s/Messages.json"
+
+// SMS sends text messages through Twilio.
+type SMS struct {
+	AccountSID string
+	AuthToken  string
+	From       string // Number or messaging service the messages come from, e.g. "+15551234567"
+
+	URL        string       // Messages API formatted with the account SID; empty uses Twilio's
+	HTTPClient *http.Client // nil uses http.DefaultClient
+}
+
+// Send texts body to phone, an E.164 number such as "+15551234567".
+func (s SMS) Send(phone, body string) error {
+	if s.AccountSID == "" || s.AuthToken == "" || s.From == "" {
+		return errors.New("an account SID, auth token and sender are required to send text messages")
+	}
+	format := s.URL
+	if format == "" {
+		format = twilioMessagesURL
+	}
+	form := url.Values{"To": {phone}, "From": {s.From}, "Body": {body}}
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf(format, url.PathEscape(s.AccountSID)), strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to build Twilio request: %w", err)
+	}
+	req.SetBasicAuth(s.AccountSID, s.AuthToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return doRequest(s.HTTPClient, "Twilio", req)
+}
@@ -0,0 +1,252 @@
+package notify
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTP TLS modes accepted in Email.TLSMode.
+const (
+	TLSModeAuto     = "auto"     // implicit TLS on port 465, otherwise STARTTLS when offered
+	TLSModeImplicit = "implicit" // TLS from the first byte (SMTPS)
+	TLSModeStartTLS = "starttls" // require STARTTLS
+	TLSModeNone     = "none"     // plaintext; only sensible for a localhost relay
+)
+
+// SMTP authentication mechanisms accepted in Email.AuthMethod.
+const (
+	AuthAuto    = "auto" // first mechanism advertised by the server, falling back in order
+	AuthPlain   = "plain"
+	AuthLogin   = "login"
+	AuthCRAMMD5 = "cram-md5"
+	AuthXOAUTH2 = "xoauth2"
+)
+
+const smtpDialTimeout = 30 * time.Second
+
+// ResolveTLSMode returns the effective TLS mode for a configured mode and
+// port, or an error if mode is unknown.
+func ResolveTLSMode(mode string, port int) (string, error) {
+	switch strings.ToLower(mode) {
+	case "", TLSModeAuto:
+		if port == 465 {
+			return TLSModeImplicit, nil
+		}
+		return TLSModeAuto, nil
+	case TLSModeImplicit, TLSModeStartTLS, TLSModeNone:
+		return strings.ToLower(mode), nil
+	default:
+		return "", fmt.Errorf("unknown SMTP TLS mode %q", mode)
+	}
+}
+
+// dialSMTP connects to the SMTP server and negotiates TLS according to config.
+func dialSMTP(config Email) (*smtp.Client, error) {
+	mode, err := ResolveTLSMode(config.TLSMode, config.SMTPPort)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := net.JoinHostPort(config.SMTPHost, strconv.Itoa(config.SMTPPort))
+	tlsConfig := &tls.Config{
+		ServerName:         config.SMTPHost,
+		InsecureSkipVerify: config.SkipVerify,
+	}
+	dialer := &net.Dialer{Timeout: smtpDialTimeout}
+
+	if mode == TLSModeImplicit {
+		conn, err := tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to %s with TLS: %w", addr, err)
+		}
+		client, err := smtp.NewClient(conn, config.SMTPHost)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to start SMTP session with %s: %w", addr, err)
+		}
+		return client, nil
+	}
+
+	conn, err := dialer.Dial("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	client, err := smtp.NewClient(conn, config.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to start SMTP session with %s: %w", addr, err)
+	}
+
+	if mode == TLSModeNone {
+		return client, nil
+	}
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("STARTTLS with %s failed: %w", addr, err)
+		}
+	} else if mode == TLSModeStartTLS {
+		client.Close()
+		return nil, fmt.Errorf("server %s does not support STARTTLS", addr)
+	}
+
+	return client, nil
+}
+
+// authCandidates returns the mechanisms to try, in order, given the configured
+// method and the server's advertised AUTH parameters. XOAUTH2 is preferred in
+// auto mode when OAuth2 credentials are configured.
+func authCandidates(method string, advertised string, oauth bool) ([]string, error) {
+	switch strings.ToLower(method) {
+	case "", AuthAuto:
+	case AuthPlain, AuthLogin, AuthCRAMMD5, AuthXOAUTH2:
+		return []string{strings.ToLower(method)}, nil
+	default:
+		return nil, fmt.Errorf("unknown SMTP auth method %q", method)
+	}
+
+	offered := make(map[string]bool)
+	for _, mech := range strings.Fields(strings.ToLower(advertised)) {
+		offered[mech] = true
+	}
+
+	var candidates []string
+	if oauth && offered[AuthXOAUTH2] {
+		candidates = append(candidates, AuthXOAUTH2)
+	}
+	for _, mech := range []string{AuthPlain, AuthLogin, AuthCRAMMD5} {
+		if offered[mech] {
+			candidates = append(candidates, mech)
+		}
+	}
+	if len(candidates) == 0 {
+		// Server did not advertise anything we know; PLAIN is the historical default.
+		candidates = []string{AuthPlain}
+	}
+	return candidates, nil
+}
+
+// newSMTPAuth constructs the smtp.Auth implementation for a mechanism.
+func newSMTPAuth(mech string, config Email) (smtp.Auth, error) {
+	switch mech {
+	case AuthLogin:
+		return &loginAuth{username: config.SMTPUsername, password: config.SMTPPassword, host: config.SMTPHost}, nil
+	case AuthCRAMMD5:
+		return smtp.CRAMMD5Auth(config.SMTPUsername, config.SMTPPassword), nil
+	case AuthXOAUTH2:
+		token, err := config.OAuth2.accessToken(config.HTTPClient)
+		if err != nil {
+			return nil, err
+		}
+		return &xoauth2Auth{username: config.SMTPUsername, token: token, host: config.SMTPHost}, nil
+	default:
+		return smtp.PlainAuth("", config.SMTPUsername, config.SMTPPassword, config.SMTPHost), nil
+	}
+}
+
+// authenticateSMTP authenticates the client, trying each candidate mechanism
+// until one succeeds. Authentication is skipped when no username is configured.
+func authenticateSMTP(client *smtp.Client, config Email) error {
+	if config.SMTPUsername == "" {
+		return nil
+	}
+
+	ok, advertised := client.Extension("AUTH")
+	if !ok {
+		return errors.New("server does not support authentication")
+	}
+
+	candidates, err := authCandidates(config.AuthMethod, advertised, config.OAuth2.enabled())
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, mech := range candidates {
+		auth, err := newSMTPAuth(mech, config)
+		if err == nil {
+			err = client.Auth(auth)
+		}
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", mech, err))
+	}
+	return fmt.Errorf("SMTP authentication failed: %w", errors.Join(errs...))
+}
+
+// deliverSMTP sends a prepared message to all recipients over a single session.
+func deliverSMTP(config Email, msg []byte) error {
+	client, err := dialSMTP(config)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if err := authenticateSMTP(client, config); err != nil {
+		return err
+	}
+
+	if err := client.Mail(config.FromEmail); err != nil {
+		return fmt.Errorf("MAIL FROM rejected: %w", err)
+	}
+	for _, to := range config.ToEmails {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("RCPT TO %s rejected: %w", to, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("DATA rejected: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to finish message: %w", err)
+	}
+
+	return client.Quit()
+}
+
+// loginAuth implements the non-standard but widely deployed AUTH LOGIN mechanism.
+type loginAuth struct {
+	username, password, host string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	// Mirror smtp.PlainAuth: never send credentials unencrypted except to localhost.
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected LOGIN challenge %q", fromServer)
+	}
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
@@ -0,0 +1,112 @@
+package notify
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResolveTLSMode(t *testing.T) {
+	tests := []struct {
+		mode     string
+		port     int
+		expected string
+		wantErr  bool
+	}{
+		{mode: "", port: 587, expected: TLSModeAuto},
+		{mode: "auto", port: 465, expected: TLSModeImplicit},
+		{mode: "STARTTLS", port: 587, expected: TLSModeStartTLS},
+		{mode: "none", port: 25, expected: TLSModeNone},
+		{mode: "ssl", port: 465, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		result, err := ResolveTLSMode(tt.mode, tt.port)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ResolveTLSMode(%q, %d) error = %v, wantErr %v", tt.mode, tt.port, err, tt.wantErr)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("ResolveTLSMode(%q, %d) = %q, want %q", tt.mode, tt.port, result, tt.expected)
+		}
+	}
+}
+
+func TestAuthCandidates(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		advertised string
+		oauth      bool
+		expected   []string
+		wantErr    bool
+	}{
+		{
+			name:       "Auto uses advertised mechanisms in fallback order",
+			method:     "auto",
+			advertised: "CRAM-MD5 LOGIN PLAIN",
+			expected:   []string{AuthPlain, AuthLogin, AuthCRAMMD5},
+		},
+		{
+			name:       "Auto skips unadvertised mechanisms",
+			method:     "",
+			advertised: "LOGIN XOAUTH2",
+			expected:   []string{AuthLogin},
+		},
+		{
+			name:       "Auto defaults to PLAIN when nothing known is advertised",
+			method:     "auto",
+			advertised: "XOAUTH2",
+			expected:   []string{AuthPlain},
+		},
+		{
+			name:       "Auto prefers XOAUTH2 when OAuth2 is configured",
+			method:     "auto",
+			advertised: "LOGIN PLAIN XOAUTH2",
+			oauth:      true,
+			expected:   []string{AuthXOAUTH2, AuthPlain, AuthLogin},
+		},
+		{
+			name:       "Auto ignores XOAUTH2 without OAuth2 credentials",
+			method:     "auto",
+			advertised: "LOGIN XOAUTH2",
+			expected:   []string{AuthLogin},
+		},
+		{
+			name:       "Explicit method is used as-is",
+			method:     "CRAM-MD5",
+			advertised: "PLAIN",
+			expected:   []string{AuthCRAMMD5},
+		},
+		{
+			name:    "Unknown method",
+			method:  "digest-md5",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := authCandidates(tt.method, tt.advertised, tt.oauth)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("authCandidates() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("authCandidates() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLoginAuthNext(t *testing.T) {
+	auth := &loginAuth{username: "user", password: "secret", host: "smtp.example.com"}
+
+	if resp, err := auth.Next([]byte("Username:"), true); err != nil || string(resp) != "user" {
+		t.Errorf("Next(Username:) = %q, %v; want %q", resp, err, "user")
+	}
+	if resp, err := auth.Next([]byte("Password:"), true); err != nil || string(resp) != "secret" {
+		t.Errorf("Next(Password:) = %q, %v; want %q", resp, err, "secret")
+	}
+	if _, err := auth.Next([]byte("Something:"), true); err == nil {
+		t.Errorf("Next(Something:) error = nil, want error")
+	}
+}
@@ -0,0 +1,76 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// telegramAPIURL is the Telegram Bot API, formatted with the bot token and
+// method.
+const telegramAPIURL = "https://api.telegram.org/bot%s/%s"
+
+// Telegram sends messages through a Telegram bot.
+type Telegram struct {
+	BotToken string
+
+	URL        string       // Bot API formatted with the token and method; empty uses Telegram's
+	HTTPClient *http.Client // nil uses http.DefaultClient
+}
+
+// TelegramButton is an inline keyboard button that sends its data back to
+// the bot when pressed.
+type TelegramButton struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data"`
+}
+
+// Send sends text to a chat, with rows of buttons below it if there are
+// any.
+func (t Telegram) Send(chatID, text string, buttons [][]TelegramButton) error {
+	message := map[string]any{"chat_id": chatID, "text": text, "disable_web_page_preview": true}
+	if len(buttons) > 0 {
+		message["reply_markup"] = map[string]any{"inline_keyboard": buttons}
+	}
+	body, _ := json.Marshal(message)
+	return t.Call("sendMessage", body)
+}
+
+// Call POSTs body, a JSON object of the method's parameters, to a Bot API
+// method. The bot token is left out of the errors it returns.
+func (t Telegram) Call(method string, body []byte) error {
+	if t.BotToken == "" {
+		return errors.New("a bot token is required to send Telegram messages")
+	}
+	req, err := http.NewRequest(http.MethodPost, t.MethodURL(method), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build Telegram request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	err = doRequest(t.HTTPClient, "Telegram", req)
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return fmt.Errorf("Telegram request failed: %w", t.Redact(urlErr))
+	}
+	return err
+}
+
+// MethodURL returns the URL of a Bot API method, which holds the bot token.
+func (t Telegram) MethodURL(method string) string {
+	format := t.URL
+	if format == "" {
+		format = telegramAPIURL
+	}
+	return fmt.Sprintf(format, url.PathEscape(t.BotToken), method)
+}
+
+// Redact returns err with the bot token in its URL replaced. Transport
+// errors quote the request URL, which holds the token, and would otherwise
+// carry it into logs.
+func (t Telegram) Redact(err *url.Error) *url.Error {
+	return &url.Error{Op: err.Op, URL: strings.ReplaceAll(err.URL, url.PathEscape(t.BotToken), "<token>"), Err: err.Err}
+}
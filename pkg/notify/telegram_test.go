@@ -0,0 +1,50 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestTelegramSend(t *testing.T) {
+	var path string
+	var message struct {
+		ChatID      string `json:"chat_id"`
+		Text        string `json:"text"`
+		ReplyMarkup struct {
+			InlineKeyboard [][]TelegramButton `json:"inline_keyboard"`
+		} `json:"reply_markup"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+			t.Errorf("Decode() error = %v", err)
+		}
+	}))
+	defer server.Close()
+
+	bot := Telegram{BotToken: "123:secret", URL: server.URL + "/bot%s/%s"}
+	buttons := [][]TelegramButton{{{Text: "Book", CallbackData: "book:1"}}}
+	if err := bot.Send("42", "New slots", buttons); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if path != "/bot123:secret/sendMessage" || message.ChatID != "42" || message.Text != "New slots" || len(message.ReplyMarkup.InlineKeyboard) != 1 {
+		t.Errorf("Send() posted %+v to %s, want the message and its button sent to sendMessage", message, path)
+	}
+
+	if err := (Telegram{}).Send("42", "New slots", nil); err == nil {
+		t.Errorf("Send() without a bot token error = nil, want error")
+	}
+
+	// Transport errors quote the URL, which mustn't carry the token into logs.
+	bot.URL = "http://127.0.0.1:1/bot%s/%s"
+	err := bot.Send("42", "New slots", nil)
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) || strings.Contains(err.Error(), "secret") {
+		t.Errorf("Send() to an unreachable server error = %v, want a URL error without the token", err)
+	}
+}
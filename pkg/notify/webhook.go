@@ -0,0 +1,26 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+)
+
+// Webhook POSTs JSON notifications to subscribers' URLs.
+type Webhook struct {
+	UserAgent  string       // Sent with each request; empty uses Go's
+	HTTPClient *http.Client // nil uses http.DefaultClient
+}
+
+// Send POSTs body, a JSON document, to url.
+func (w Webhook) Send(url string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.UserAgent != "" {
+		req.Header.Set("User-Agent", w.UserAgent)
+	}
+	return doRequest(w.HTTPClient, "Webhook", req)
+}
@@ -0,0 +1,318 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pashbylogan/melanzana/pkg/awssig"
+)
+
+// updateAttempts bounds how often a read-modify-write is retried after
+// losing a race with another writer.
+const updateAttempts = 5
+
+// errStateConflict means the object changed since it was last read.
+var errStateConflict = errors.New("state object was modified concurrently")
+
+// Bucket keeps the seen-appointments JSON and the availability history as
+// objects in an S3 or GCS bucket, for deployments without a persistent
+// disk. Writes are conditional on the object being unchanged since it was
+// read (S3 ETags, GCS generation numbers), so concurrent runs can't silently
+// overwrite each other. GCS is accessed through its S3-compatible XML API
+// with HMAC keys.
+type Bucket struct {
+	Provider   string // s3 or gcs
+	BaseURL    string // Bucket URL without a trailing slash
+	Key        string
+	HistoryKey string
+	// SubscribersKey holds the subscribers added through the API; empty
+	// disables them.
+	SubscribersKey string
+	SnapshotKey    string // The availability snapshot; empty disables it
+	Region         string // Signing region; "auto" for GCS
+	Creds          awssig.Credentials
+	Codec          Codec        // Optional compression or encryption of both objects
+	HTTPClient     *http.Client // nil uses http.DefaultClient
+
+	seen        objectVersion
+	history     objectVersion
+	subscribers objectVersion
+	snapshot    objectVersion
+}
+
+// objectVersion tracks what was last read or written for conditional writes.
+type objectVersion struct {
+	loaded  bool
+	exists  bool
+	version string // ETag (S3) or generation (GCS)
+}
+
+func (s *Bucket) Load() ([]Appointment, error) {
+	data, err := s.get(s.Key, &s.seen)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		slog.Info("State object does not exist, starting with no seen appointments", "key", s.Key)
+	}
+
+	return decodeSeenState(data, s.Key)
+}
+
+// Save writes appointments. If the object was read earlier, the write only
+// succeeds if nobody else has written it since.
+func (s *Bucket) Save(appointments []Appointment) error {
+	body, err := encodeSeenState(appointments)
+	if err != nil {
+		return err
+	}
+	return s.put(s.Key, body, &s.seen)
+}
+
+func (s *Bucket) MarkSeen(appointments []Appointment) error {
+	return s.update(func(seen []Appointment) []Appointment {
+		return MergeSeen(seen, appointments)
+	})
+}
+
+func (s *Bucket) Prune(before time.Time) (int, error) {
+	var removed int
+	err := s.update(func(seen []Appointment) []Appointment {
+		kept := PruneBefore(seen, before)
+		removed = len(seen) - len(kept)
+		return kept
+	})
+	return removed, err
+}
+
+func (s *Bucket) History() ([]Event, error) {
+	data, err := s.get(s.HistoryKey, &s.history)
+	if err != nil {
+		return nil, err
+	}
+	return decodeHistory(bytes.NewReader(data), s.HistoryKey)
+}
+
+func (s *Bucket) AppendHistory(events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	for attempt := 1; attempt <= updateAttempts; attempt++ {
+		data, err := s.get(s.HistoryKey, &s.history)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		buf.Write(data)
+		if err := encodeHistory(&buf, events); err != nil {
+			return err
+		}
+		err = s.put(s.HistoryKey, buf.Bytes(), &s.history)
+		if !errors.Is(err, errStateConflict) {
+			return err
+		}
+		slog.Debug("State object changed while updating, retrying", "key", s.HistoryKey, "attempt", attempt)
+	}
+	return fmt.Errorf("failed to update %s after %d attempts: %w", s.HistoryKey, updateAttempts, errStateConflict)
+}
+
+func (s *Bucket) Subscribers() ([]json.RawMessage, error) {
+	if s.SubscribersKey == "" {
+		return nil, nil
+	}
+	data, err := s.get(s.SubscribersKey, &s.subscribers)
+	if err != nil {
+		return nil, err
+	}
+	return decodeSubscribers(data, s.SubscribersKey)
+}
+
+func (s *Bucket) UpdateSubscribers(change func([]json.RawMessage) ([]json.RawMessage, error)) error {
+	if s.SubscribersKey == "" {
+		return fmt.Errorf("subscribersFile is not set")
+	}
+	for attempt := 1; attempt <= updateAttempts; attempt++ {
+		subscribers, err := s.Subscribers()
+		if err != nil {
+			return err
+		}
+		if subscribers, err = change(subscribers); err != nil {
+			return err
+		}
+		body, err := encodeSubscribers(subscribers)
+		if err != nil {
+			return err
+		}
+		err = s.put(s.SubscribersKey, body, &s.subscribers)
+		if !errors.Is(err, errStateConflict) {
+			return err
+		}
+		slog.Debug("State object changed while updating, retrying", "key", s.SubscribersKey, "attempt", attempt)
+	}
+	return fmt.Errorf("failed to update %s after %d attempts: %w", s.SubscribersKey, updateAttempts, errStateConflict)
+}
+
+func (s *Bucket) Snapshot() (*Snapshot, error) {
+	if s.SnapshotKey == "" {
+		return nil, nil
+	}
+	data, err := s.get(s.SnapshotKey, &s.snapshot)
+	if err != nil {
+		return nil, err
+	}
+	return decodeSnapshot(data, s.SnapshotKey), nil
+}
+
+func (s *Bucket) UpdateSnapshot(change func(*Snapshot) (*Snapshot, error)) error {
+	if s.SnapshotKey == "" {
+		return fmt.Errorf("snapshotFile is not set")
+	}
+	for attempt := 1; attempt <= updateAttempts; attempt++ {
+		snapshot, err := s.Snapshot()
+		if err != nil {
+			return err
+		}
+		if snapshot, err = change(snapshot); err != nil {
+			return err
+		}
+		body, err := encodeSnapshot(snapshot)
+		if err != nil {
+			return err
+		}
+		err = s.put(s.SnapshotKey, body, &s.snapshot)
+		if !errors.Is(err, errStateConflict) {
+			return err
+		}
+		slog.Debug("State object changed while updating, retrying", "key", s.SnapshotKey, "attempt", attempt)
+	}
+	return fmt.Errorf("failed to update %s after %d attempts: %w", s.SnapshotKey, updateAttempts, errStateConflict)
+}
+
+// update applies change to a freshly read copy of the seen object and writes
+// it back, starting over if another writer got there first.
+func (s *Bucket) update(change func([]Appointment) []Appointment) error {
+	for attempt := 1; attempt <= updateAttempts; attempt++ {
+		seen, err := s.Load()
+		if err != nil {
+			return err
+		}
+		err = s.Save(change(seen))
+		if !errors.Is(err, errStateConflict) {
+			return err
+		}
+		slog.Debug("State object changed while updating, retrying", "key", s.Key, "attempt", attempt)
+	}
+	return fmt.Errorf("failed to update %s after %d attempts: %w", s.Key, updateAttempts, errStateConflict)
+}
+
+// get reads an object and records its version in v. It returns nil data if
+// the object doesn't exist.
+func (s *Bucket) get(key string, v *objectVersion) ([]byte, error) {
+	resp, err := s.do(http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	v.loaded = true
+	if resp.StatusCode == http.StatusNotFound {
+		v.exists, v.version = false, ""
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, s.statusError("read", key, resp)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state object %s: %w", key, err)
+	}
+	v.exists, v.version = true, s.versionOf(resp)
+	if s.Codec != nil {
+		if data, err = s.Codec.Decode(data); err != nil {
+			return nil, fmt.Errorf("failed to decode state object %s: %w", key, err)
+		}
+	}
+	return data, nil
+}
+
+// put writes an object. If it was read earlier, the write only succeeds if
+// nobody else has written it since; otherwise errStateConflict is returned.
+func (s *Bucket) put(key string, body []byte, v *objectVersion) error {
+	headers := map[string]string{"Content-Type": "application/json"}
+	if s.Codec != nil {
+		encoded, err := s.Codec.Encode(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode state object %s: %w", key, err)
+		}
+		body = encoded
+		headers["Content-Type"] = "application/octet-stream"
+	}
+	if v.loaded {
+		switch {
+		case s.Provider == "gcs" && v.exists:
+			headers["x-goog-if-generation-match"] = v.version
+		case s.Provider == "gcs":
+			headers["x-goog-if-generation-match"] = "0"
+		case v.exists:
+			headers["If-Match"] = v.version
+		default:
+			headers["If-None-Match"] = "*"
+		}
+	}
+
+	resp, err := s.do(http.MethodPut, key, body, headers)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		*v = objectVersion{loaded: true, exists: true, version: s.versionOf(resp)}
+		return nil
+	case http.StatusPreconditionFailed, http.StatusConflict:
+		v.loaded = false
+		return errStateConflict
+	default:
+		return s.statusError("write", key, resp)
+	}
+}
+
+func (s *Bucket) do(method, key string, body []byte, headers map[string]string) (*http.Response, error) {
+	req, err := http.NewRequest(method, s.BaseURL+(&url.URL{Path: "/" + key}).EscapedPath(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build state request: %w", err)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	awssig.Sign(req, body, s.Creds, s.Region, "s3", time.Now())
+
+	resp, err := httpClient(s.HTTPClient).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s state request failed: %w", s.Provider, err)
+	}
+	return resp, nil
+}
+
+func (s *Bucket) versionOf(resp *http.Response) string {
+	if s.Provider == "gcs" {
+		return resp.Header.Get("x-goog-generation")
+	}
+	return resp.Header.Get("ETag")
+}
+
+func (s *Bucket) statusError(action, key string, resp *http.Response) error {
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("failed to %s state object %s: %s returned status %d: %s",
+		action, key, s.Provider, resp.StatusCode, strings.TrimSpace(string(detail)))
+}
@@ -0,0 +1,150 @@
+package store
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pashbylogan/melanzana/pkg/awssig"
+)
+
+// fakeBucket is a minimal S3/GCS object server honouring conditional writes.
+type fakeBucket struct {
+	mu         sync.Mutex
+	gcs        bool
+	body       []byte
+	generation int
+	beforePut  func() // called before each PUT is evaluated, to simulate other writers
+}
+
+func (b *fakeBucket) version() string {
+	if b.gcs {
+		return fmt.Sprint(b.generation)
+	}
+	return fmt.Sprintf(`"etag-%d"`, b.generation)
+}
+
+func (b *fakeBucket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+		http.Error(w, "unsigned request", http.StatusForbidden)
+		return
+	}
+	if r.Method == http.MethodPut && b.beforePut != nil {
+		hook := b.beforePut
+		b.beforePut = nil
+		hook()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	exists := b.generation > 0
+
+	switch r.Method {
+	case http.MethodGet:
+		if !exists {
+			http.NotFound(w, r)
+			return
+		}
+	case http.MethodPut:
+		var ok bool
+		if b.gcs {
+			want := r.Header.Get("x-goog-if-generation-match")
+			ok = want == "" || want == fmt.Sprint(b.generation)
+		} else if match := r.Header.Get("If-Match"); match != "" {
+			ok = exists && match == b.version()
+		} else {
+			ok = r.Header.Get("If-None-Match") != "*" || !exists
+		}
+		if !ok {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		b.body, _ = io.ReadAll(r.Body)
+		b.generation++
+	}
+
+	if b.gcs {
+		w.Header().Set("x-goog-generation", b.version())
+	} else {
+		w.Header().Set("ETag", b.version())
+	}
+	if r.Method == http.MethodGet {
+		w.Write(b.body)
+	}
+}
+
+func TestBucket(t *testing.T) {
+	a := Appointment{Date: "2024-05-15", Time: "10:00 am – 10:30 am", Spaces: 1}
+	b := Appointment{Date: "2024-05-16", Time: "10:00 am – 10:30 am", Spaces: 1}
+	c := Appointment{Date: "2024-05-17", Time: "10:00 am – 10:30 am", Spaces: 1}
+
+	for _, provider := range []string{"s3", "gcs"} {
+		t.Run(provider, func(t *testing.T) {
+			bucket := &fakeBucket{gcs: provider == "gcs"}
+			server := httptest.NewServer(bucket)
+			defer server.Close()
+
+			newStore := func() *Bucket {
+				return &Bucket{Provider: provider, BaseURL: server.URL + "/bucket", Key: "seen.json", Region: "auto",
+					Creds: awssig.Credentials{AccessKeyID: "id", SecretAccessKey: "secret"}}
+			}
+			store, other := newStore(), newStore()
+
+			if err := store.MarkSeen([]Appointment{a}); err != nil {
+				t.Fatalf("MarkSeen() on missing object error = %v", err)
+			}
+
+			// Another writer updates the object between our read and write;
+			// MarkSeen must re-read rather than overwrite it.
+			bucket.beforePut = func() {
+				if err := other.MarkSeen([]Appointment{b}); err != nil {
+					t.Errorf("concurrent MarkSeen() error = %v", err)
+				}
+			}
+			if err := store.MarkSeen([]Appointment{c}); err != nil {
+				t.Fatalf("MarkSeen() with concurrent writer error = %v", err)
+			}
+
+			loaded, err := newStore().Load()
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if want := []Appointment{a, b, c}; !reflect.DeepEqual(loaded, want) {
+				t.Errorf("Load() = %v, want %v", loaded, want)
+			}
+		})
+	}
+}
+
+func TestBucketHistory(t *testing.T) {
+	server := httptest.NewServer(&fakeBucket{})
+	defer server.Close()
+
+	store := &Bucket{Provider: "s3", BaseURL: server.URL + "/bucket", HistoryKey: "history.jsonl", Region: "auto",
+		Creds: awssig.Credentials{AccessKeyID: "id", SecretAccessKey: "secret"}}
+
+	at := time.Date(2024, 5, 15, 9, 0, 0, 0, time.UTC)
+	events := []Event{
+		{At: at, Kind: "appeared", Date: "2024-05-20", Time: "10:00 am – 10:30 am", Spaces: 2},
+		{At: at.Add(time.Hour), Kind: "disappeared", Date: "2024-05-20", Time: "10:00 am – 10:30 am", PreviousSpaces: 2},
+	}
+	for _, e := range events {
+		if err := store.AppendHistory([]Event{e}); err != nil {
+			t.Fatalf("AppendHistory() error = %v", err)
+		}
+	}
+
+	got, err := store.History()
+	if err != nil {
+		t.Fatalf("History() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, events) {
+		t.Errorf("History() = %+v, want %+v", got, events)
+	}
+}
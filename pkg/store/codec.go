@@ -0,0 +1,293 @@
+package store
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec transforms state on its way to and from a storage backend.
+// Compression codecs pass through data that Encode didn't produce, so they
+// can be added to an existing store; its data is converted the next time it
+// is written. Encryption codecs refuse it, as otherwise anyone able to
+// write the store could substitute plaintext state, unless migrating from
+// plaintext was asked for.
+type Codec interface {
+	Name() string
+	Encode(data []byte) ([]byte, error)
+	Decode(data []byte) ([]byte, error)
+}
+
+// Codec names accepted by NewCodec.
+const (
+	codecGzip = "gzip"
+	codecZstd = "zstd"
+	codecAES  = "aes"
+	codecAge  = "age"
+)
+
+// CodecKeys holds what the encryption codecs need.
+type CodecKeys struct {
+	EncryptionKey    string   // For aes: base64-encoded 32-byte key
+	AgeIdentity      string   // For age: the X25519 identity that decrypts, and is encrypted to
+	AgeRecipients    []string // For age: further recipients to encrypt to
+	MigratePlaintext bool     // Read unencrypted state, written before encryption was enabled
+}
+
+// NewCodec builds the chain of codecs named in names, "gzip", "zstd", "aes"
+// or "age", applied in order when writing and in reverse when reading. It
+// returns nil if names is empty.
+func NewCodec(names []string, keys CodecKeys) (Codec, error) {
+	var chain codecChain
+	for _, name := range names {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case codecGzip:
+			chain = append(chain, gzipCodec{})
+		case codecZstd:
+			chain = append(chain, zstdCodec{})
+		case codecAES:
+			c, err := newAESCodec(keys.EncryptionKey, keys.MigratePlaintext)
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, c)
+		case codecAge:
+			c, err := newAgeCodec(keys.AgeIdentity, keys.AgeRecipients, keys.MigratePlaintext)
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, c)
+		default:
+			return nil, fmt.Errorf("unknown state codec %q (available: %s, %s, %s, %s)", name, codecGzip, codecZstd, codecAES, codecAge)
+		}
+	}
+	if len(chain) == 0 {
+		return nil, nil
+	}
+	return chain, nil
+}
+
+type codecChain []Codec
+
+func (c codecChain) Name() string {
+	names := make([]string, len(c))
+	for i, codec := range c {
+		names[i] = codec.Name()
+	}
+	return strings.Join(names, "+")
+}
+
+func (c codecChain) Encode(data []byte) ([]byte, error) {
+	for _, codec := range c {
+		var err error
+		if data, err = codec.Encode(data); err != nil {
+			return nil, fmt.Errorf("%s: %w", codec.Name(), err)
+		}
+	}
+	return data, nil
+}
+
+func (c codecChain) Decode(data []byte) ([]byte, error) {
+	for i := len(c) - 1; i >= 0; i-- {
+		var err error
+		if data, err = c[i].Decode(data); err != nil {
+			return nil, fmt.Errorf("%s: %w", c[i].Name(), err)
+		}
+	}
+	return data, nil
+}
+
+// gzipMagic starts every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string { return codecGzip }
+
+func (gzipCodec) Encode(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCodec) Decode(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, gzipMagic) {
+		return data, nil
+	}
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// zstdMagic starts every zstd frame.
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// The zstd encoder and decoder are safe for concurrent EncodeAll and
+// DecodeAll calls, so one of each is shared.
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+type zstdCodec struct{}
+
+func (zstdCodec) Name() string { return codecZstd }
+
+func (zstdCodec) Encode(data []byte) ([]byte, error) {
+	return zstdEncoder.EncodeAll(data, nil), nil
+}
+
+func (zstdCodec) Decode(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, zstdMagic) {
+		return data, nil
+	}
+	return zstdDecoder.DecodeAll(data, nil)
+}
+
+// errPlaintextState is returned by an encryption codec for state it didn't
+// encrypt.
+var errPlaintextState = errors.New("state isn't encrypted; set stateMigratePlaintext to read state written before encryption was enabled")
+
+// aesMagic starts every payload written by aesCodec, followed by the nonce
+// and the AES-256-GCM sealed data.
+var aesMagic = []byte("melanzana-aes1:")
+
+type aesCodec struct {
+	aead             cipher.AEAD
+	migratePlaintext bool
+}
+
+// newAESCodec builds an AES-256-GCM codec from a base64-encoded 32-byte key.
+func newAESCodec(encodedKey string, migratePlaintext bool) (*aesCodec, error) {
+	if encodedKey == "" {
+		return nil, fmt.Errorf("stateEncryptionKey is required for the %s codec", codecAES)
+	}
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("stateEncryptionKey must be 32 bytes, base64-encoded (e.g. from \"openssl rand -base64 32\")")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &aesCodec{aead: aead, migratePlaintext: migratePlaintext}, nil
+}
+
+func (c *aesCodec) Name() string { return codecAES }
+
+func (c *aesCodec) Encode(data []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := append([]byte(nil), aesMagic...)
+	out = append(out, nonce...)
+	return c.aead.Seal(out, nonce, data, aesMagic), nil
+}
+
+func (c *aesCodec) Decode(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, aesMagic) {
+		return plaintextState(data, c.migratePlaintext)
+	}
+	sealed := data[len(aesMagic):]
+	if len(sealed) < c.aead.NonceSize() {
+		return nil, fmt.Errorf("encrypted data is truncated")
+	}
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	plain, err := c.aead.Open(nil, nonce, ciphertext, aesMagic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt (wrong stateEncryptionKey?): %w", err)
+	}
+	return plain, nil
+}
+
+// plaintextState returns data that an encryption codec didn't encrypt if
+// migrating from plaintext, and otherwise errPlaintextState. Empty data,
+// as a new history file has, holds nothing to substitute.
+func plaintextState(data []byte, migratePlaintext bool) ([]byte, error) {
+	if len(data) == 0 || migratePlaintext {
+		return data, nil
+	}
+	return nil, errPlaintextState
+}
+
+// ageMagic starts every payload in age's binary format.
+var ageMagic = []byte("age-encryption.org/v1\n")
+
+type ageCodec struct {
+	identity         age.Identity
+	recipients       []age.Recipient
+	migratePlaintext bool
+}
+
+// newAgeCodec builds an age codec that encrypts to identity's recipient and
+// any others, such as a key kept offline, and decrypts with identity.
+func newAgeCodec(identity string, recipients []string, migratePlaintext bool) (*ageCodec, error) {
+	if identity == "" {
+		return nil, fmt.Errorf("stateAgeIdentity is required for the %s codec", codecAge)
+	}
+	id, err := age.ParseX25519Identity(strings.TrimSpace(identity))
+	if err != nil {
+		return nil, fmt.Errorf("stateAgeIdentity must be an age X25519 identity (e.g. from age-keygen): %w", err)
+	}
+	c := &ageCodec{identity: id, recipients: []age.Recipient{id.Recipient()}, migratePlaintext: migratePlaintext}
+	for _, r := range recipients {
+		recipient, err := age.ParseX25519Recipient(strings.TrimSpace(r))
+		if err != nil {
+			return nil, fmt.Errorf("stateAgeRecipients: %w", err)
+		}
+		c.recipients = append(c.recipients, recipient)
+	}
+	return c, nil
+}
+
+func (c *ageCodec) Name() string { return codecAge }
+
+func (c *ageCodec) Encode(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, c.recipients...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *ageCodec) Decode(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, ageMagic) {
+		return plaintextState(data, c.migratePlaintext)
+	}
+	r, err := age.Decrypt(bytes.NewReader(data), c.identity)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt (wrong stateAgeIdentity?): %w", err)
+	}
+	return io.ReadAll(r)
+}
@@ -0,0 +1,178 @@
+package store
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+)
+
+var testEncryptionKey = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32))
+
+// testKeys are the encryption keys used by the codec tests.
+func testKeys(t *testing.T) CodecKeys {
+	t.Helper()
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return CodecKeys{EncryptionKey: testEncryptionKey, AgeIdentity: identity.String()}
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	plain := []byte(`[{"date":"2024-05-14","time":"10:00 am – 10:30 am","spaces":1}]`)
+
+	tests := []struct {
+		name      string
+		codecs    []string
+		encrypted bool
+	}{
+		{"Gzip", []string{"gzip"}, false},
+		{"Zstd", []string{"zstd"}, false},
+		{"AES", []string{"aes"}, true},
+		{"Age", []string{"age"}, true},
+		{"GzipThenAES", []string{"gzip", "aes"}, true},
+		{"ZstdThenAge", []string{"zstd", "age"}, true},
+	}
+	keys := testKeys(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codec, err := NewCodec(tt.codecs, keys)
+			if err != nil {
+				t.Fatalf("NewCodec() error = %v", err)
+			}
+			encoded, err := codec.Encode(plain)
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			if tt.encrypted && bytes.Contains(encoded, []byte("2024-05-14")) {
+				t.Errorf("Encode() output contains the plaintext")
+			}
+			decoded, err := codec.Decode(encoded)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !bytes.Equal(decoded, plain) {
+				t.Errorf("Decode() = %q, want %q", decoded, plain)
+			}
+
+			// State written before a compression codec was enabled is still
+			// readable, but unencrypted state is only read while migrating.
+			decoded, err = codec.Decode(plain)
+			if tt.encrypted {
+				if !errors.Is(err, errPlaintextState) {
+					t.Errorf("Decode(plaintext) = %q, %v; want errPlaintextState", decoded, err)
+				}
+				migrating := keys
+				migrating.MigratePlaintext = true
+				codec, _ = NewCodec(tt.codecs, migrating)
+				decoded, err = codec.Decode(plain)
+			}
+			if err != nil || !bytes.Equal(decoded, plain) {
+				t.Errorf("Decode(plaintext) = %q, %v; want it passed through", decoded, err)
+			}
+		})
+	}
+}
+
+func TestNewCodecErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		codecs []string
+		key    string
+	}{
+		{"Unknown", []string{"brotli"}, ""},
+		{"MissingKey", []string{"aes"}, ""},
+		{"ShortKey", []string{"aes"}, base64.StdEncoding.EncodeToString([]byte("too short"))},
+		{"NotBase64", []string{"aes"}, "not base64!"},
+		{"MissingIdentity", []string{"age"}, ""},
+		{"NotAnIdentity", []string{"age"}, "age1notanidentity"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewCodec(tt.codecs, CodecKeys{EncryptionKey: tt.key, AgeIdentity: tt.key}); err == nil {
+				t.Errorf("NewCodec(%v) error = nil, want error", tt.codecs)
+			}
+		})
+	}
+
+	if codec, err := NewCodec(nil, CodecKeys{}); codec != nil || err != nil {
+		t.Errorf("NewCodec(nil) = %v, %v; want nil, nil", codec, err)
+	}
+}
+
+func TestEncryptionCodecWrongKey(t *testing.T) {
+	keys, other := testKeys(t), testKeys(t)
+	other.EncryptionKey = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{8}, 32))
+	for _, name := range []string{"aes", "age"} {
+		codec, _ := NewCodec([]string{name}, keys)
+		encoded, err := codec.Encode([]byte("secret"))
+		if err != nil {
+			t.Fatalf("%s: Encode() error = %v", name, err)
+		}
+		wrong, _ := NewCodec([]string{name}, other)
+		if _, err := wrong.Decode(encoded); err == nil {
+			t.Errorf("%s: Decode() with the wrong key error = nil, want error", name)
+		}
+	}
+
+	// State is also encrypted to the further age recipients.
+	backup, _ := age.GenerateX25519Identity()
+	keys.AgeRecipients = []string{backup.Recipient().String()}
+	codec, _ := NewCodec([]string{"age"}, keys)
+	encoded, _ := codec.Encode([]byte("secret"))
+	restored, err := NewCodec([]string{"age"}, CodecKeys{AgeIdentity: backup.String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain, err := restored.Decode(encoded); err != nil || string(plain) != "secret" {
+		t.Errorf("Decode() with a further recipient's identity = %q, %v; want the state", plain, err)
+	}
+}
+
+func TestJSONFileWithCodec(t *testing.T) {
+	dir := t.TempDir()
+	codec, err := NewCodec([]string{"zstd", "age"}, testKeys(t))
+	if err != nil {
+		t.Fatalf("NewCodec() error = %v", err)
+	}
+	store := &JSONFile{Path: filepath.Join(dir, "seen.json"), HistoryPath: filepath.Join(dir, "history.jsonl"), Codec: codec}
+
+	seen := []Appointment{{Date: "2024-05-14", Time: "10:00 am – 10:30 am", Spaces: 1, IsAvailable: true}}
+	if err := store.MarkSeen(seen); err != nil {
+		t.Fatalf("MarkSeen() error = %v", err)
+	}
+	events := []Event{
+		{At: time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC), Kind: "appeared", Date: "2024-05-14", Time: "10:00 am – 10:30 am", Spaces: 1},
+	}
+	for i := 0; i < 2; i++ {
+		if err := store.AppendHistory(events); err != nil {
+			t.Fatalf("AppendHistory() error = %v", err)
+		}
+	}
+
+	for _, path := range []string{store.Path, store.HistoryPath} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(data, []byte("2024-05-14")) {
+			t.Errorf("%s contains plaintext state", filepath.Base(path))
+		}
+	}
+
+	loaded, err := store.Load()
+	if err != nil || !reflect.DeepEqual(loaded, seen) {
+		t.Errorf("Load() = %v, %v; want %v", loaded, err, seen)
+	}
+	history, err := store.History()
+	if err != nil || len(history) != 2 {
+		t.Errorf("History() = %d events, %v; want 2", len(history), err)
+	}
+}
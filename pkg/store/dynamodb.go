@@ -0,0 +1,493 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pashbylogan/melanzana/pkg/awssig"
+)
+
+// dynamoDBBatchSize is the most requests one BatchWriteItem call takes.
+const dynamoDBBatchSize = 25
+
+// dynamoDBHistoryTime formats event times for history sort keys; unlike
+// RFC 3339 with nanoseconds, it has a fixed width, so keys sort by time.
+const dynamoDBHistoryTime = "2006-01-02T15:04:05.000000000Z"
+
+// DynamoDB keeps the state as items in one DynamoDB table, for
+// serverless deployments. The table's partition key is the string "pk" and
+// its sort key the string "sk":
+//
+//   - Each seen slot is an item in partition "seen#<SeenKey>", keyed by
+//     the slot, so a slot can't be recorded twice. MarkSeen's writes are
+//     conditional on there being no more recently notified record of the
+//     slot, so concurrent runs can't replace a newer record with an older
+//     one. Each item's "expiresAt" attribute is the end of the slot's day,
+//     so with TTL enabled on it, DynamoDB removes past slots by itself.
+//   - Each availability change is an item in partition
+//     "history#<HistoryKey>", sorted by time.
+//   - The subscribers added through the API are one item,
+//     "subscribers#<SubscribersKey>", written only if its version hasn't
+//     changed since it was read.
+//
+// Writes that need no condition are batched, 25 items a request, which
+// keeps on-demand (pay-per-request) tables cheap.
+type DynamoDB struct {
+	Endpoint       string // Without a trailing slash
+	Table          string
+	Region         string
+	Creds          awssig.Credentials
+	SeenKey        string
+	HistoryKey     string
+	SubscribersKey string         // Empty disables subscribers
+	SnapshotKey    string         // Empty disables the availability snapshot
+	Codec          Codec          // Optional compression or encryption of each record
+	Location       *time.Location // Zone slot dates are in, for expiresAt; nil is UTC
+	HTTPClient     *http.Client   // nil uses http.DefaultClient
+}
+
+// dynamoValue is a DynamoDB attribute value of the types the store uses.
+type dynamoValue struct {
+	S string `json:"S,omitempty"`
+	N string `json:"N,omitempty"`
+	B []byte `json:"B,omitempty"`
+}
+
+type dynamoItem map[string]dynamoValue
+
+// dynamoDBError is an error response from DynamoDB.
+type dynamoDBError struct {
+	Type    string // e.g. "ConditionalCheckFailedException"
+	Message string
+	Status  int
+}
+
+func (e *dynamoDBError) Error() string {
+	return fmt.Sprintf("DynamoDB returned status %d: %s: %s", e.Status, e.Type, e.Message)
+}
+
+// isConditionFailed reports whether err is a failed conditional write.
+func isConditionFailed(err error) bool {
+	var dynamoErr *dynamoDBError
+	return errors.As(err, &dynamoErr) && dynamoErr.Type == "ConditionalCheckFailedException"
+}
+
+func (s *DynamoDB) Load() ([]Appointment, error) {
+	items, err := s.query("seen#" + s.SeenKey)
+	if err != nil {
+		return nil, err
+	}
+	appointments := make([]Appointment, 0, len(items))
+	for _, item := range items {
+		var appt Appointment
+		if err := s.decode(item, "record", &appt); err != nil {
+			return nil, err
+		}
+		appointments = append(appointments, appt)
+	}
+	return appointments, nil
+}
+
+// Save replaces the seen slots with appointments: it writes each of them
+// and deletes any other.
+func (s *DynamoDB) Save(appointments []Appointment) error {
+	existing, err := s.query("seen#" + s.SeenKey)
+	if err != nil {
+		return err
+	}
+	appointments = Dedupe(appointments)
+	keep := make(map[string]bool, len(appointments))
+	var requests []any
+	for _, appt := range appointments {
+		item, err := s.seenItem(appt)
+		if err != nil {
+			return err
+		}
+		keep[item["sk"].S] = true
+		requests = append(requests, map[string]any{"PutRequest": map[string]any{"Item": item}})
+	}
+	for _, item := range existing {
+		if !keep[item["sk"].S] {
+			requests = append(requests, deleteRequest(item))
+		}
+	}
+	return s.batchWrite(requests)
+}
+
+// MarkSeen writes each appointment unless the slot has a more recently
+// notified record, as a concurrent run may have written.
+func (s *DynamoDB) MarkSeen(appointments []Appointment) error {
+	for _, appt := range Dedupe(appointments) {
+		item, err := s.seenItem(appt)
+		if err != nil {
+			return err
+		}
+		err = s.call("PutItem", map[string]any{
+			"TableName":                 s.Table,
+			"Item":                      item,
+			"ConditionExpression":       "attribute_not_exists(pk) OR notifiedAt <= :notifiedAt",
+			"ExpressionAttributeValues": dynamoItem{":notifiedAt": item["notifiedAt"]},
+		}, nil)
+		if isConditionFailed(err) {
+			slog.Debug("Slot already has a more recent seen record, keeping it", "slot", SlotID(appt.Date, appt.Time, appt.Calendar))
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *DynamoDB) Prune(before time.Time) (int, error) {
+	seen, err := s.Load()
+	if err != nil {
+		return 0, err
+	}
+	kept := make(map[slotKey]bool)
+	for _, appt := range PruneBefore(seen, before) {
+		kept[keyOf(appt)] = true
+	}
+	var requests []any
+	for _, appt := range seen {
+		if !kept[keyOf(appt)] {
+			requests = append(requests, deleteRequest(dynamoItem{"pk": {S: "seen#" + s.SeenKey}, "sk": {S: SlotID(appt.Date, appt.Time, appt.Calendar)}}))
+		}
+	}
+	return len(requests), s.batchWrite(requests)
+}
+
+func (s *DynamoDB) History() ([]Event, error) {
+	items, err := s.query("history#" + s.HistoryKey)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]Event, 0, len(items))
+	for _, item := range items {
+		var e Event
+		if err := s.decode(item, "event", &e); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+func (s *DynamoDB) AppendHistory(events []Event) error {
+	requests := make([]any, 0, len(events))
+	for _, e := range events {
+		item := dynamoItem{
+			"pk": {S: "history#" + s.HistoryKey},
+			"sk": {S: e.At.UTC().Format(dynamoDBHistoryTime) + "#" + e.Kind + "#" + SlotID(e.Date, e.Time, e.Calendar)},
+		}
+		if err := s.encode(item, "event", e); err != nil {
+			return err
+		}
+		requests = append(requests, map[string]any{"PutRequest": map[string]any{"Item": item}})
+	}
+	return s.batchWrite(requests)
+}
+
+func (s *DynamoDB) Subscribers() ([]json.RawMessage, error) {
+	subscribers, _, err := s.subscribers()
+	return subscribers, err
+}
+
+// subscribers returns the stored subscribers and the version of their item,
+// 0 if there is none.
+func (s *DynamoDB) subscribers() ([]json.RawMessage, int, error) {
+	if s.SubscribersKey == "" {
+		return nil, 0, nil
+	}
+	var out struct {
+		Item dynamoItem `json:"Item"`
+	}
+	err := s.call("GetItem", map[string]any{
+		"TableName":      s.Table,
+		"Key":            s.subscribersKey(),
+		"ConsistentRead": true,
+	}, &out)
+	if err != nil || out.Item == nil {
+		return nil, 0, err
+	}
+	var subscribers []json.RawMessage
+	if err := s.decode(out.Item, "subscribers", &subscribers); err != nil {
+		return nil, 0, err
+	}
+	version, _ := strconv.Atoi(out.Item["version"].N)
+	return subscribers, version, nil
+}
+
+func (s *DynamoDB) UpdateSubscribers(change func([]json.RawMessage) ([]json.RawMessage, error)) error {
+	if s.SubscribersKey == "" {
+		return fmt.Errorf("subscribersFile is not set")
+	}
+	for attempt := 1; attempt <= updateAttempts; attempt++ {
+		subscribers, version, err := s.subscribers()
+		if err != nil {
+			return err
+		}
+		if subscribers, err = change(subscribers); err != nil {
+			return err
+		}
+		if subscribers == nil {
+			subscribers = []json.RawMessage{}
+		}
+		item := s.subscribersKey()
+		item["version"] = dynamoValue{N: strconv.Itoa(version + 1)}
+		if err := s.encode(item, "subscribers", subscribers); err != nil {
+			return err
+		}
+		err = s.call("PutItem", map[string]any{
+			"TableName":                 s.Table,
+			"Item":                      item,
+			"ConditionExpression":       "attribute_not_exists(pk) OR version = :version",
+			"ExpressionAttributeValues": dynamoItem{":version": {N: strconv.Itoa(version)}},
+		}, nil)
+		if !isConditionFailed(err) {
+			return err
+		}
+		slog.Debug("Subscribers changed while updating, retrying", "key", s.SubscribersKey, "attempt", attempt)
+	}
+	return fmt.Errorf("failed to update %s after %d attempts: %w", s.SubscribersKey, updateAttempts, errStateConflict)
+}
+
+func (s *DynamoDB) subscribersKey() dynamoItem {
+	return dynamoItem{"pk": {S: "subscribers#" + s.SubscribersKey}, "sk": {S: "subscribers"}}
+}
+
+func (s *DynamoDB) Snapshot() (*Snapshot, error) {
+	snapshot, _, err := s.snapshot()
+	return snapshot, err
+}
+
+// snapshot returns the stored availability snapshot and the version of its
+// item, 0 if there is none.
+func (s *DynamoDB) snapshot() (*Snapshot, int, error) {
+	if s.SnapshotKey == "" {
+		return nil, 0, nil
+	}
+	var out struct {
+		Item dynamoItem `json:"Item"`
+	}
+	err := s.call("GetItem", map[string]any{
+		"TableName":      s.Table,
+		"Key":            s.snapshotKey(),
+		"ConsistentRead": true,
+	}, &out)
+	if err != nil || out.Item == nil {
+		return nil, 0, err
+	}
+	version, _ := strconv.Atoi(out.Item["version"].N)
+	var snapshot Snapshot
+	if err := s.decode(out.Item, "snapshot", &snapshot); err != nil {
+		slog.Warn("Error parsing availability snapshot, replaying the history instead", "snapshot", s.SnapshotKey, "err", err)
+		return nil, version, nil
+	}
+	return &snapshot, version, nil
+}
+
+func (s *DynamoDB) UpdateSnapshot(change func(*Snapshot) (*Snapshot, error)) error {
+	if s.SnapshotKey == "" {
+		return fmt.Errorf("snapshotFile is not set")
+	}
+	for attempt := 1; attempt <= updateAttempts; attempt++ {
+		snapshot, version, err := s.snapshot()
+		if err != nil {
+			return err
+		}
+		if snapshot, err = change(snapshot); err != nil {
+			return err
+		}
+		item := s.snapshotKey()
+		item["version"] = dynamoValue{N: strconv.Itoa(version + 1)}
+		if err := s.encode(item, "snapshot", snapshot); err != nil {
+			return err
+		}
+		err = s.call("PutItem", map[string]any{
+			"TableName":                 s.Table,
+			"Item":                      item,
+			"ConditionExpression":       "attribute_not_exists(pk) OR version = :version",
+			"ExpressionAttributeValues": dynamoItem{":version": {N: strconv.Itoa(version)}},
+		}, nil)
+		if !isConditionFailed(err) {
+			return err
+		}
+		slog.Debug("Availability snapshot changed while updating, retrying", "key", s.SnapshotKey, "attempt", attempt)
+	}
+	return fmt.Errorf("failed to update %s after %d attempts: %w", s.SnapshotKey, updateAttempts, errStateConflict)
+}
+
+func (s *DynamoDB) snapshotKey() dynamoItem {
+	return dynamoItem{"pk": {S: "snapshot#" + s.SnapshotKey}, "sk": {S: "snapshot"}}
+}
+
+// seenItem is the item recording a seen slot.
+func (s *DynamoDB) seenItem(appt Appointment) (dynamoItem, error) {
+	item := dynamoItem{
+		"pk":         {S: "seen#" + s.SeenKey},
+		"sk":         {S: SlotID(appt.Date, appt.Time, appt.Calendar)},
+		"notifiedAt": {N: strconv.FormatInt(appt.LastNotifiedAt.UnixMilli(), 10)},
+	}
+	loc := s.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	if day, err := time.ParseInLocation("2006-01-02", appt.Date, loc); err == nil {
+		item["expiresAt"] = dynamoValue{N: strconv.FormatInt(day.AddDate(0, 0, 1).Unix(), 10)}
+	}
+	return item, s.encode(item, "record", appt)
+}
+
+func deleteRequest(item dynamoItem) any {
+	return map[string]any{"DeleteRequest": map[string]any{"Key": dynamoItem{"pk": item["pk"], "sk": item["sk"]}}}
+}
+
+// encode stores v as JSON in item's attribute name: a string, or binary if
+// a codec encodes it.
+func (s *DynamoDB) encode(item dynamoItem, name string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", name, err)
+	}
+	if s.Codec == nil {
+		item[name] = dynamoValue{S: string(data)}
+		return nil
+	}
+	if data, err = s.Codec.Encode(data); err != nil {
+		return fmt.Errorf("failed to encode %s: %w", name, err)
+	}
+	item[name] = dynamoValue{B: data}
+	return nil
+}
+
+func (s *DynamoDB) decode(item dynamoItem, name string, v any) error {
+	value := item[name]
+	data := []byte(value.S)
+	if value.B != nil {
+		if s.Codec == nil {
+			return fmt.Errorf("%s %s is encoded, but stateCodecs is empty", name, item["sk"].S)
+		}
+		data = value.B
+	}
+	if s.Codec != nil {
+		var err error
+		if data, err = s.Codec.Decode(data); err != nil {
+			return fmt.Errorf("failed to decode %s %s: %w", name, item["sk"].S, err)
+		}
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s %s: %w", name, item["sk"].S, err)
+	}
+	return nil
+}
+
+// query returns every item in partition pk, in sort key order.
+func (s *DynamoDB) query(pk string) ([]dynamoItem, error) {
+	var items []dynamoItem
+	var start dynamoItem
+	for {
+		in := map[string]any{
+			"TableName":                 s.Table,
+			"KeyConditionExpression":    "pk = :pk",
+			"ExpressionAttributeValues": dynamoItem{":pk": {S: pk}},
+			"ConsistentRead":            true,
+		}
+		if start != nil {
+			in["ExclusiveStartKey"] = start
+		}
+		var out struct {
+			Items            []dynamoItem `json:"Items"`
+			LastEvaluatedKey dynamoItem   `json:"LastEvaluatedKey"`
+		}
+		if err := s.call("Query", in, &out); err != nil {
+			return nil, err
+		}
+		items = append(items, out.Items...)
+		if out.LastEvaluatedKey == nil {
+			sort.Slice(items, func(i, j int) bool { return items[i]["sk"].S < items[j]["sk"].S })
+			return items, nil
+		}
+		start = out.LastEvaluatedKey
+	}
+}
+
+// batchWrite sends put and delete requests in batches, resending any that
+// DynamoDB leaves unprocessed when the table is busy.
+func (s *DynamoDB) batchWrite(requests []any) error {
+	for len(requests) > 0 {
+		batch := requests[:min(dynamoDBBatchSize, len(requests))]
+		requests = requests[len(batch):]
+		for attempt := 1; len(batch) > 0; attempt++ {
+			if attempt > updateAttempts {
+				return fmt.Errorf("DynamoDB left %d writes unprocessed after %d attempts", len(batch), updateAttempts)
+			}
+			if attempt > 1 {
+				sleep(time.Duration(50<<attempt) * time.Millisecond)
+			}
+			var out struct {
+				UnprocessedItems map[string][]json.RawMessage `json:"UnprocessedItems"`
+			}
+			if err := s.call("BatchWriteItem", map[string]any{"RequestItems": map[string]any{s.Table: batch}}, &out); err != nil {
+				return err
+			}
+			batch = nil
+			for _, r := range out.UnprocessedItems[s.Table] {
+				batch = append(batch, r)
+			}
+		}
+	}
+	return nil
+}
+
+// call invokes a DynamoDB action with the JSON in, decoding the response
+// into out unless it is nil.
+func (s *DynamoDB) call(action string, in, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("failed to build DynamoDB %s request: %w", action, err)
+	}
+	req, err := http.NewRequest(http.MethodPost, s.Endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build DynamoDB %s request: %w", action, err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", "DynamoDB_20120810."+action)
+	awssig.Sign(req, body, s.Creds, s.Region, "dynamodb", time.Now())
+
+	resp, err := httpClient(s.HTTPClient).Do(req)
+	if err != nil {
+		return fmt.Errorf("DynamoDB %s request failed: %w", action, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read DynamoDB %s response: %w", action, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		json.Unmarshal(data, &failure)
+		// "com.amazonaws.dynamodb.v20120810#ConditionalCheckFailedException"
+		failure.Type = failure.Type[strings.LastIndex(failure.Type, "#")+1:]
+		return &dynamoDBError{Type: failure.Type, Message: failure.Message, Status: resp.StatusCode}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to parse DynamoDB %s response: %w", action, err)
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package store
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pashbylogan/melanzana/pkg/awssig"
+)
+
+// fakeDynamoDB is a minimal DynamoDB serving the actions and conditions
+// DynamoDB uses. Queries return pages of two items, and the first
+// batch write leaves its last request unprocessed, so paging and resending
+// are exercised.
+type fakeDynamoDB struct {
+	mu          sync.Mutex
+	items       map[string]map[string]dynamoItem // pk, then sk
+	batches     int
+	conditional int // Conditional writes refused
+}
+
+func (f *fakeDynamoDB) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+		http.Error(w, "unsigned request", http.StatusForbidden)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var in struct {
+		Key                       dynamoItem
+		Item                      dynamoItem
+		ConditionExpression       string
+		ExpressionAttributeValues dynamoItem
+		ExclusiveStartKey         dynamoItem
+		RequestItems              map[string][]struct {
+			PutRequest    *struct{ Item dynamoItem }
+			DeleteRequest *struct{ Key dynamoItem }
+		}
+	}
+	json.NewDecoder(r.Body).Decode(&in)
+
+	reply := map[string]any{}
+	switch strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "DynamoDB_20120810.") {
+	case "Query":
+		partition := f.items[in.ExpressionAttributeValues[":pk"].S]
+		var keys []string
+		for sk := range partition {
+			if in.ExclusiveStartKey == nil || sk > in.ExclusiveStartKey["sk"].S {
+				keys = append(keys, sk)
+			}
+		}
+		sort.Strings(keys)
+		var items []dynamoItem
+		for _, sk := range keys[:min(2, len(keys))] {
+			items = append(items, partition[sk])
+		}
+		reply["Items"] = items
+		if len(keys) > 2 {
+			reply["LastEvaluatedKey"] = dynamoItem{"pk": items[1]["pk"], "sk": items[1]["sk"]}
+		}
+	case "GetItem":
+		if item, ok := f.items[in.Key["pk"].S][in.Key["sk"].S]; ok {
+			reply["Item"] = item
+		}
+	case "PutItem":
+		existing, exists := f.items[in.Item["pk"].S][in.Item["sk"].S]
+		values := in.ExpressionAttributeValues
+		ok := !exists
+		switch {
+		case strings.Contains(in.ConditionExpression, "notifiedAt <="):
+			have, _ := strconv.Atoi(existing["notifiedAt"].N)
+			want, _ := strconv.Atoi(values[":notifiedAt"].N)
+			ok = ok || have <= want
+		case strings.Contains(in.ConditionExpression, "version ="):
+			ok = ok || existing["version"].N == values[":version"].N
+		default:
+			ok = true
+		}
+		if !ok {
+			f.conditional++
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"__type": "com.amazonaws.dynamodb.v20120810#ConditionalCheckFailedException", "message": "The conditional request failed"})
+			return
+		}
+		f.put(in.Item)
+	case "BatchWriteItem":
+		f.batches++
+		for table, requests := range in.RequestItems {
+			if len(requests) > 25 {
+				http.Error(w, "too many requests in a batch", http.StatusBadRequest)
+				return
+			}
+			if f.batches == 1 && len(requests) > 1 {
+				reply["UnprocessedItems"] = map[string]any{table: requests[len(requests)-1:]}
+				requests = requests[:len(requests)-1]
+			}
+			for _, req := range requests {
+				if req.PutRequest != nil {
+					f.put(req.PutRequest.Item)
+				} else {
+					delete(f.items[req.DeleteRequest.Key["pk"].S], req.DeleteRequest.Key["sk"].S)
+				}
+			}
+		}
+	default:
+		http.Error(w, "unknown action", http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(reply)
+}
+
+func (f *fakeDynamoDB) put(item dynamoItem) {
+	if f.items[item["pk"].S] == nil {
+		f.items[item["pk"].S] = map[string]dynamoItem{}
+	}
+	f.items[item["pk"].S][item["sk"].S] = item
+}
+
+func TestDynamoDB(t *testing.T) {
+	fake := &fakeDynamoDB{items: map[string]map[string]dynamoItem{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	store := &DynamoDB{
+		Endpoint:       server.URL,
+		Table:          "melanzana",
+		Region:         "us-east-1",
+		Creds:          awssig.Credentials{AccessKeyID: "id", SecretAccessKey: "secret"},
+		SeenKey:        "seen.json",
+		HistoryKey:     "history.jsonl",
+		SubscribersKey: "subscribers.json",
+		SnapshotKey:    "snapshot.json",
+	}
+
+	notified := time.Date(2099, 7, 1, 12, 0, 0, 0, time.UTC)
+	slot := func(date string, at time.Time) Appointment {
+		return Appointment{Date: date, Time: "10:00 am – 10:30 am", Spaces: 1, LastNotifiedAt: at}
+	}
+	var many []Appointment
+	for day := 1; day <= 30; day++ {
+		many = append(many, slot(time.Date(2099, 8, day, 0, 0, 0, 0, time.UTC).Format("2006-01-02"), notified))
+	}
+	if err := store.Save(append(many, many[0])); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := store.Save(many[:3]); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if seen, err := store.Load(); err != nil || len(seen) != 3 {
+		t.Fatalf("Load() after Save() = %d slots, %v; want 3", len(seen), err)
+	}
+	if expires := fake.items["seen#seen.json"][SlotID(many[0].Date, many[0].Time, many[0].Calendar)]["expiresAt"].N; expires == "" {
+		t.Error("seen item has no expiresAt")
+	}
+
+	// A run notified about 2099-08-01 later than this one did.
+	newer := slot("2099-08-01", notified.Add(time.Hour))
+	if err := store.MarkSeen([]Appointment{newer}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.MarkSeen([]Appointment{slot("2099-08-01", notified), slot("2099-06-30", notified)}); err != nil {
+		t.Fatalf("MarkSeen() error = %v", err)
+	}
+	if fake.conditional != 1 {
+		t.Errorf("conditional writes refused = %d, want 1", fake.conditional)
+	}
+	seen, err := store.Load()
+	if err != nil || len(seen) != 4 || seen[0].Date != "2099-06-30" || !seen[1].LastNotifiedAt.Equal(newer.LastNotifiedAt) {
+		t.Fatalf("Load() after MarkSeen() = %+v, %v; want the newer record kept and the new slot added", seen, err)
+	}
+
+	removed, err := store.Prune(time.Date(2099, 8, 1, 12, 0, 0, 0, time.UTC))
+	if err != nil || removed != 1 {
+		t.Errorf("Prune() = %d, %v; want 1", removed, err)
+	}
+
+	events := []Event{
+		{At: notified.Add(time.Minute), Kind: "opened", Date: "2099-08-02", Time: "10:00 am – 10:30 am", Spaces: 1},
+		{At: notified, Kind: "opened", Date: "2099-08-01", Time: "10:00 am – 10:30 am", Spaces: 1},
+	}
+	if err := store.AppendHistory(events); err != nil {
+		t.Fatalf("AppendHistory() error = %v", err)
+	}
+	history, err := store.History()
+	if err != nil || len(history) != 2 || history[0].Date != "2099-08-01" {
+		t.Errorf("History() = %+v, %v; want both events, oldest first", history, err)
+	}
+
+	for _, name := range []string{"grandma", "me"} {
+		err := store.UpdateSubscribers(func(s []json.RawMessage) ([]json.RawMessage, error) {
+			return append(s, json.RawMessage(`{"name":"`+name+`"}`)), nil
+		})
+		if err != nil {
+			t.Fatalf("UpdateSubscribers() error = %v", err)
+		}
+	}
+	subscribers, err := store.Subscribers()
+	var last struct{ Name string }
+	if err != nil || len(subscribers) != 2 || json.Unmarshal(subscribers[1], &last) != nil || last.Name != "me" {
+		t.Errorf("Subscribers() = %+v, %v; want both", subscribers, err)
+	}
+
+	if saved, err := store.Snapshot(); err != nil || saved != nil {
+		t.Errorf("Snapshot() before any was saved = %+v, %v; want none", saved, err)
+	}
+	for _, spaces := range []int{1, 2} {
+		err := store.UpdateSnapshot(func(s *Snapshot) (*Snapshot, error) {
+			if s == nil {
+				s = &Snapshot{At: notified}
+			}
+			return &Snapshot{At: s.At, Open: []Appointment{{Date: "2099-08-01", Spaces: spaces}}}, nil
+		})
+		if err != nil {
+			t.Fatalf("UpdateSnapshot() error = %v", err)
+		}
+	}
+	if saved, err := store.Snapshot(); err != nil || saved == nil || len(saved.Open) != 1 || saved.Open[0].Spaces != 2 || !saved.At.Equal(notified) {
+		t.Errorf("Snapshot() = %+v, %v; want the second update", saved, err)
+	}
+}
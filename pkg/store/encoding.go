@@ -0,0 +1,86 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// encodeHistory writes events as JSON Lines.
+func encodeHistory(w io.Writer, events []Event) error {
+	enc := json.NewEncoder(w)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return fmt.Errorf("failed to encode availability event: %w", err)
+		}
+	}
+	return nil
+}
+
+// decodeHistory reads JSON Lines events; name is used in error messages.
+func decodeHistory(r io.Reader, name string) ([]Event, error) {
+	var events []Event
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("failed to parse %s line %d: %w", name, line, err)
+		}
+		events = append(events, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return events, nil
+}
+
+func encodeSnapshot(s *Snapshot) ([]byte, error) {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal availability snapshot: %w", err)
+	}
+	return data, nil
+}
+
+// decodeSnapshot parses the stored snapshot; empty data is none. A snapshot
+// that doesn't parse is also taken as none, with a warning, so the next
+// check replays the history and replaces it.
+func decodeSnapshot(data []byte, name string) *Snapshot {
+	if len(data) == 0 {
+		return nil
+	}
+	s := &Snapshot{}
+	if err := json.Unmarshal(data, s); err != nil {
+		slog.Warn("Error parsing availability snapshot, replaying the history instead", "snapshot", name, "err", err)
+		return nil
+	}
+	return s
+}
+
+func encodeSubscribers(subscribers []json.RawMessage) ([]byte, error) {
+	if subscribers == nil {
+		subscribers = []json.RawMessage{}
+	}
+	data, err := json.MarshalIndent(subscribers, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal subscribers: %w", err)
+	}
+	return data, nil
+}
+
+// decodeSubscribers parses the stored subscribers; empty data is none.
+func decodeSubscribers(data []byte, name string) ([]json.RawMessage, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var subscribers []json.RawMessage
+	if err := json.Unmarshal(data, &subscribers); err != nil {
+		return nil, fmt.Errorf("failed to parse subscribers in %s: %w", name, err)
+	}
+	return subscribers, nil
+}
@@ -0,0 +1,444 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// JSONFile keeps seen appointments, subscribers and the availability
+// snapshot in JSON files and the availability history in a JSON Lines file. Every operation holds an
+// advisory lock on Path+".lock" so that instances sharing the files don't
+// clobber each other.
+type JSONFile struct {
+	Path            string
+	HistoryPath     string
+	SubscribersPath string
+	SnapshotPath    string
+	LockTimeout     time.Duration // How long to wait for another instance to release the lock
+	Codec           Codec         // Optional compression or encryption of the files
+}
+
+// withLock runs fn while holding the store's lock.
+func (s *JSONFile) withLock(fn func() error) error {
+	release, err := acquireLock(s.Path+".lock", s.LockTimeout)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return fn()
+}
+
+func (s *JSONFile) Load() ([]Appointment, error) {
+	var seen []Appointment
+	err := s.withLock(func() error {
+		var err error
+		seen, err = loadSeenAppointments(s.Path, s.Codec)
+		return err
+	})
+	return seen, err
+}
+
+func (s *JSONFile) Save(appointments []Appointment) error {
+	return s.withLock(func() error {
+		return saveSeenAppointments(appointments, s.Path, s.Codec)
+	})
+}
+
+func (s *JSONFile) MarkSeen(appointments []Appointment) error {
+	return s.withLock(func() error {
+		seen, err := loadSeenAppointments(s.Path, s.Codec)
+		if err != nil {
+			return err
+		}
+		return saveSeenAppointments(MergeSeen(seen, appointments), s.Path, s.Codec)
+	})
+}
+
+func (s *JSONFile) Prune(before time.Time) (int, error) {
+	var removed int
+	err := s.withLock(func() error {
+		seen, err := loadSeenAppointments(s.Path, s.Codec)
+		if err != nil {
+			return err
+		}
+
+		kept := PruneBefore(seen, before)
+		if removed = len(seen) - len(kept); removed > 0 {
+			return saveSeenAppointments(kept, s.Path, s.Codec)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
+
+func (s *JSONFile) History() ([]Event, error) {
+	var events []Event
+	err := s.withLock(func() error {
+		data, err := s.readHistory()
+		if err != nil {
+			return err
+		}
+		events, err = decodeHistory(bytes.NewReader(data), s.HistoryPath)
+		return err
+	})
+	return events, err
+}
+
+// AppendHistory appends to the history file. With a codec the file can't
+// be appended to in place, so it is rewritten.
+func (s *JSONFile) AppendHistory(events []Event) error {
+	return s.withLock(func() error {
+		if s.Codec != nil {
+			data, err := s.readHistory()
+			if err != nil {
+				return err
+			}
+			buf := bytes.NewBuffer(data)
+			if err := encodeHistory(buf, events); err != nil {
+				return err
+			}
+			encoded, err := s.Codec.Encode(buf.Bytes())
+			if err != nil {
+				return fmt.Errorf("failed to encode %s: %w", s.HistoryPath, err)
+			}
+			if err := os.WriteFile(s.HistoryPath, encoded, 0644); err != nil {
+				return fmt.Errorf("failed to write %s: %w", s.HistoryPath, err)
+			}
+			return nil
+		}
+
+		f, err := os.OpenFile(s.HistoryPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", s.HistoryPath, err)
+		}
+		if err := encodeHistory(f, events); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("failed to write %s: %w", s.HistoryPath, err)
+		}
+		return nil
+	})
+}
+
+func (s *JSONFile) Subscribers() ([]json.RawMessage, error) {
+	var subscribers []json.RawMessage
+	err := s.withLock(func() error {
+		var err error
+		subscribers, err = s.readSubscribers()
+		return err
+	})
+	return subscribers, err
+}
+
+func (s *JSONFile) UpdateSubscribers(change func([]json.RawMessage) ([]json.RawMessage, error)) error {
+	if s.SubscribersPath == "" {
+		return fmt.Errorf("subscribersFile is not set")
+	}
+	return s.withLock(func() error {
+		subscribers, err := s.readSubscribers()
+		if err != nil {
+			return err
+		}
+		if subscribers, err = change(subscribers); err != nil {
+			return err
+		}
+		data, err := encodeSubscribers(subscribers)
+		if err == nil && s.Codec != nil {
+			data, err = s.Codec.Encode(data)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", s.SubscribersPath, err)
+		}
+		if err := os.WriteFile(s.SubscribersPath, data, 0600); err != nil {
+			return fmt.Errorf("failed to write %s: %w", s.SubscribersPath, err)
+		}
+		return nil
+	})
+}
+
+func (s *JSONFile) Snapshot() (*Snapshot, error) {
+	var snapshot *Snapshot
+	err := s.withLock(func() error {
+		var err error
+		snapshot, err = s.readSnapshot()
+		return err
+	})
+	return snapshot, err
+}
+
+// UpdateSnapshot renames the new snapshot file into place, so a crash while
+// writing it leaves the last one whole.
+func (s *JSONFile) UpdateSnapshot(change func(*Snapshot) (*Snapshot, error)) error {
+	if s.SnapshotPath == "" {
+		return fmt.Errorf("snapshotFile is not set")
+	}
+	return s.withLock(func() error {
+		snapshot, err := s.readSnapshot()
+		if err != nil {
+			return err
+		}
+		if snapshot, err = change(snapshot); err != nil {
+			return err
+		}
+		data, err := encodeSnapshot(snapshot)
+		if err == nil && s.Codec != nil {
+			data, err = s.Codec.Encode(data)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", s.SnapshotPath, err)
+		}
+		return replaceFile(s.SnapshotPath, data, 0644)
+	})
+}
+
+// readSnapshot returns the decoded snapshot file, or nil if it doesn't
+// exist.
+func (s *JSONFile) readSnapshot() (*Snapshot, error) {
+	if s.SnapshotPath == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(s.SnapshotPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", s.SnapshotPath, err)
+	}
+	if s.Codec != nil && len(data) > 0 {
+		if data, err = s.Codec.Decode(data); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", s.SnapshotPath, err)
+		}
+	}
+	return decodeSnapshot(data, s.SnapshotPath), nil
+}
+
+// replaceFile writes data to path by renaming a temporary file into place,
+// so that neither a reader nor a crash sees it half written.
+func replaceFile(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
+
+// readSubscribers returns the decoded subscribers file, or none if it
+// doesn't exist.
+func (s *JSONFile) readSubscribers() ([]json.RawMessage, error) {
+	if s.SubscribersPath == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(s.SubscribersPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", s.SubscribersPath, err)
+	}
+	if s.Codec != nil && len(data) > 0 {
+		if data, err = s.Codec.Decode(data); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", s.SubscribersPath, err)
+		}
+	}
+	return decodeSubscribers(data, s.SubscribersPath)
+}
+
+// readHistory returns the decoded contents of the history file, or nil if
+// it doesn't exist. The caller must hold the lock.
+func (s *JSONFile) readHistory() ([]byte, error) {
+	data, err := os.ReadFile(s.HistoryPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", s.HistoryPath, err)
+	}
+	if s.Codec != nil {
+		if data, err = s.Codec.Decode(data); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", s.HistoryPath, err)
+		}
+	}
+	return data, nil
+}
+
+// currentStateSchemaVersion is the schemaVersion written to the seen
+// appointments state. Version 1 files are a bare JSON array of appointments;
+// version 2 records lack lastNotifiedAt and the other seen timestamps.
+const currentStateSchemaVersion = 3
+
+// seenState is the on-disk form of the seen appointments.
+type seenState struct {
+	SchemaVersion int           `json:"schemaVersion"`
+	Appointments  []Appointment `json:"appointments"`
+}
+
+// stateMigrations[v] upgrades a raw state document from version v to v+1.
+var stateMigrations = map[int]func(data []byte) ([]byte, error){
+	1: migrateStateV1,
+	2: migrateStateV2,
+}
+
+// migrateStateV1 wraps a bare appointment array in a versioned document.
+func migrateStateV1(data []byte) ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"schemaVersion": 2,
+		"appointments":  json.RawMessage(data),
+	})
+}
+
+// migrateStateV2 sets each record's lastNotifiedAt from its observedAt,
+// which held when the slot was last notified. When it was first notified
+// and last found can't be recovered, so they are left unset.
+func migrateStateV2(data []byte) ([]byte, error) {
+	var state struct {
+		Appointments []map[string]any `json:"appointments"`
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	for _, appt := range state.Appointments {
+		if _, ok := appt["lastNotifiedAt"]; !ok {
+			appt["lastNotifiedAt"] = appt["observedAt"]
+		}
+	}
+	if state.Appointments == nil {
+		state.Appointments = []map[string]any{}
+	}
+	return json.Marshal(map[string]any{
+		"schemaVersion": 3,
+		"appointments":  state.Appointments,
+	})
+}
+
+// stateSchemaVersion detects the schema version of a raw state document.
+func stateSchemaVersion(data []byte) (int, error) {
+	if bytes.HasPrefix(data, []byte("[")) {
+		return 1, nil
+	}
+	var header struct {
+		SchemaVersion int `json:"schemaVersion"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return 0, err
+	}
+	if header.SchemaVersion < 2 {
+		return 0, fmt.Errorf("missing or invalid schemaVersion %d", header.SchemaVersion)
+	}
+	return header.SchemaVersion, nil
+}
+
+// decodeSeenState parses seen appointments from any supported schema
+// version. name is used in messages. A state written by a newer build is
+// rejected rather than risk misreading it.
+func decodeSeenState(data []byte, name string) ([]Appointment, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return []Appointment{}, nil
+	}
+
+	version, err := stateSchemaVersion(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal appointments from %s: %w", name, err)
+	}
+	if version > currentStateSchemaVersion {
+		return nil, fmt.Errorf("%s has schemaVersion %d, but this build only understands up to %d; upgrade melanzana",
+			name, version, currentStateSchemaVersion)
+	}
+	for v := version; v < currentStateSchemaVersion; v++ {
+		if data, err = stateMigrations[v](data); err != nil {
+			return nil, fmt.Errorf("failed to migrate %s from schema version %d: %w", name, v, err)
+		}
+	}
+	if version < currentStateSchemaVersion {
+		slog.Info("Read an older state schema; it will be upgraded when saved", "file", name, "version", version, "currentVersion", currentStateSchemaVersion)
+	}
+
+	var state seenState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal appointments from %s: %w", name, err)
+	}
+	if state.Appointments == nil {
+		state.Appointments = []Appointment{}
+	}
+	return state.Appointments, nil
+}
+
+// encodeSeenState renders seen appointments in the current schema version,
+// with one record per slot.
+func encodeSeenState(appointments []Appointment) ([]byte, error) {
+	appointments = Dedupe(appointments)
+	data, err := json.MarshalIndent(seenState{SchemaVersion: currentStateSchemaVersion, Appointments: appointments}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal appointments to JSON: %w", err)
+	}
+	return data, nil
+}
+
+// loadSeenAppointments reads appointments from the JSON file specified by
+// dataFilePath, decoding it with codec if one is configured.
+func loadSeenAppointments(dataFilePath string, codec Codec) ([]Appointment, error) {
+	data, err := os.ReadFile(dataFilePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			slog.Info("State file does not exist, starting with no seen appointments", "file", dataFilePath)
+			return []Appointment{}, nil // No error if file simply doesn't exist
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", dataFilePath, err)
+	}
+
+	if len(data) == 0 { // Handle empty file case
+		slog.Info("State file is empty, starting with no seen appointments", "file", dataFilePath)
+		return []Appointment{}, nil
+	}
+
+	if codec != nil {
+		if data, err = codec.Decode(data); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", dataFilePath, err)
+		}
+	}
+	return decodeSeenState(data, dataFilePath)
+}
+
+// saveSeenAppointments writes appointments to the JSON file specified by
+// dataFilePath, encoding it with codec if one is configured.
+func saveSeenAppointments(appointments []Appointment, dataFilePath string, codec Codec) error {
+	data, err := encodeSeenState(appointments)
+	if err != nil {
+		return err
+	}
+	if codec != nil {
+		if data, err = codec.Encode(data); err != nil {
+			return fmt.Errorf("failed to encode %s: %w", dataFilePath, err)
+		}
+	}
+
+	err = os.WriteFile(dataFilePath, data, 0644) // 0644 are standard file permissions
+	if err != nil {
+		return fmt.Errorf("failed to write appointments to %s: %w", dataFilePath, err)
+	}
+	return nil
+}
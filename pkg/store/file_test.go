@@ -0,0 +1,289 @@
+package store
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadAndSaveSeenAppointments(t *testing.T) {
+	// Create a temporary directory for test files
+	tempDir, err := os.MkdirTemp("", "storage_test_")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir) // Clean up the temp directory
+
+	testFilePath := filepath.Join(tempDir, "test_seen_appointments.json")
+
+	t.Run("SaveAndLoadSuccessfully", func(t *testing.T) {
+		originalAppointments := []Appointment{
+			{Date: "2024-08-10", Time: "10:00 am – 11:00 am", Spaces: 2, IsAvailable: true},
+			{Date: "2024-09-22", Time: "3:00 pm – 4:00 pm", Spaces: 1, IsAvailable: true},
+		}
+
+		err := saveSeenAppointments(originalAppointments, testFilePath, nil)
+		if err != nil {
+			t.Fatalf("saveSeenAppointments() failed: %v", err)
+		}
+
+		loadedAppointments, err := loadSeenAppointments(testFilePath, nil)
+		if err != nil {
+			t.Fatalf("loadSeenAppointments() failed: %v", err)
+		}
+
+		if !reflect.DeepEqual(originalAppointments, loadedAppointments) {
+			t.Errorf("loadSeenAppointments() got = %v, want %v", loadedAppointments, originalAppointments)
+		}
+	})
+
+	t.Run("LoadNonExistentFile", func(t *testing.T) {
+		nonExistentFilePath := filepath.Join(tempDir, "non_existent.json")
+		loaded, err := loadSeenAppointments(nonExistentFilePath, nil)
+		if err != nil {
+			t.Errorf("loadSeenAppointments() with non-existent file error = %v, want nil", err)
+		}
+		if len(loaded) != 0 {
+			t.Errorf("loadSeenAppointments() with non-existent file got %d appointments, want 0", len(loaded))
+		}
+	})
+
+	t.Run("LoadEmptyFile", func(t *testing.T) {
+		emptyFilePath := filepath.Join(tempDir, "empty.json")
+		f, err := os.Create(emptyFilePath)
+		if err != nil {
+			t.Fatalf("Failed to create empty file: %v", err)
+		}
+		f.Close() // Ensure file is created and empty
+
+		loaded, err := loadSeenAppointments(emptyFilePath, nil)
+		if err != nil {
+			t.Errorf("loadSeenAppointments() with empty file error = %v, want nil", err)
+		}
+		if len(loaded) != 0 {
+			t.Errorf("loadSeenAppointments() with empty file got %d appointments, want 0", len(loaded))
+		}
+	})
+
+	t.Run("LoadMalformedJSON", func(t *testing.T) {
+		malformedFilePath := filepath.Join(tempDir, "malformed.json")
+		err := os.WriteFile(malformedFilePath, []byte("[{malformed json}}"), 0644)
+		if err != nil {
+			t.Fatalf("Failed to write malformed JSON file: %v", err)
+		}
+
+		_, err = loadSeenAppointments(malformedFilePath, nil)
+		if err == nil {
+			t.Errorf("loadSeenAppointments() with malformed JSON error = nil, want error")
+		}
+	})
+
+	t.Run("SaveEmptySlice", func(t *testing.T) {
+		emptyAppointments := []Appointment{}
+		emptySliceFilePath := filepath.Join(tempDir, "empty_slice_saved.json")
+
+		err := saveSeenAppointments(emptyAppointments, emptySliceFilePath, nil)
+		if err != nil {
+			t.Fatalf("saveSeenAppointments() with empty slice failed: %v", err)
+		}
+
+		loaded, err := loadSeenAppointments(emptySliceFilePath, nil)
+		if err != nil {
+			t.Fatalf("loadSeenAppointments() after saving empty slice failed: %v", err)
+		}
+		if len(loaded) != 0 {
+			t.Errorf("loadSeenAppointments() after saving empty slice got %d, want 0", len(loaded))
+		}
+
+		// Verify content is a versioned document with an empty appointment array
+		content, readErr := os.ReadFile(emptySliceFilePath)
+		if readErr != nil {
+			t.Fatalf("Failed to read file after saving empty slice: %v", readErr)
+		}
+
+		var checkEmpty struct {
+			SchemaVersion int            `json:"schemaVersion"`
+			Appointments  *[]Appointment `json:"appointments"`
+		}
+		if unmarshalErr := json.Unmarshal(content, &checkEmpty); unmarshalErr != nil || checkEmpty.SchemaVersion != currentStateSchemaVersion ||
+			checkEmpty.Appointments == nil || len(*checkEmpty.Appointments) != 0 {
+			t.Errorf("File content after saving empty slice is not a versioned empty appointment list. Got: %s", string(content))
+		}
+	})
+
+	t.Run("SaveAndLoadLargeDataset", func(t *testing.T) {
+		// Test with a larger dataset to ensure the system handles it well.
+		// Each is a different slot, since a slot's repeats are saved once.
+		var largeAppointments []Appointment
+		for i := 0; i < 100; i++ {
+			largeAppointments = append(largeAppointments, Appointment{
+				Date:        time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC).AddDate(0, 0, i).Format("2006-01-02"),
+				Time:        "10:00 am – 11:00 am",
+				Spaces:      i%5 + 1, // Varies from 1-5
+				IsAvailable: true,
+			})
+		}
+
+		largeFilePath := filepath.Join(tempDir, "large_dataset.json")
+
+		err := saveSeenAppointments(largeAppointments, largeFilePath, nil)
+		if err != nil {
+			t.Fatalf("saveSeenAppointments() with large dataset failed: %v", err)
+		}
+
+		loaded, err := loadSeenAppointments(largeFilePath, nil)
+		if err != nil {
+			t.Fatalf("loadSeenAppointments() with large dataset failed: %v", err)
+		}
+
+		if len(loaded) != len(largeAppointments) {
+			t.Errorf("loadSeenAppointments() large dataset length = %d, want %d", len(loaded), len(largeAppointments))
+		}
+
+		if !reflect.DeepEqual(loaded, largeAppointments) {
+			t.Errorf("Large dataset not preserved through save/load cycle")
+		}
+	})
+}
+
+func TestJSONFile(t *testing.T) {
+	var store Store = &JSONFile{Path: filepath.Join(t.TempDir(), "seen.json")}
+
+	first := []Appointment{{Date: "2024-05-14", Time: "10:00 am – 10:30 am", Spaces: 1, IsAvailable: true}}
+	second := []Appointment{
+		{Date: "2024-05-15", Time: "10:00 am – 10:30 am", Spaces: 2, IsAvailable: true},
+		{Date: "not-a-date", Time: "11:00 am – 11:30 am", Spaces: 1, IsAvailable: true},
+	}
+
+	if err := store.MarkSeen(first); err != nil {
+		t.Fatalf("MarkSeen() error = %v", err)
+	}
+	if err := store.MarkSeen(second); err != nil {
+		t.Fatalf("MarkSeen() error = %v", err)
+	}
+
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if want := append(append([]Appointment{}, first...), second...); !reflect.DeepEqual(loaded, want) {
+		t.Errorf("Load() after MarkSeen = %v, want %v", loaded, want)
+	}
+
+	removed, err := store.Prune(time.Date(2024, 5, 15, 9, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("Prune() removed = %d, want 1", removed)
+	}
+
+	loaded, err = store.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !reflect.DeepEqual(loaded, second) {
+		t.Errorf("Load() after Prune = %v, want %v", loaded, second)
+	}
+
+	// Marking a slot again replaces its earlier record.
+	renotified := Appointment{Date: "2024-05-15", Time: "10:00 am – 10:30 am", Spaces: 3, IsAvailable: true}
+	if err := store.MarkSeen([]Appointment{renotified}); err != nil {
+		t.Fatalf("MarkSeen() error = %v", err)
+	}
+	loaded, err = store.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if want := []Appointment{second[1], renotified}; !reflect.DeepEqual(loaded, want) {
+		t.Errorf("Load() after marking a slot again = %v, want %v", loaded, want)
+	}
+}
+
+func TestDecodeSeenState(t *testing.T) {
+	appt := Appointment{Date: "2024-05-15", Time: "10:00 am – 10:30 am", Spaces: 2, IsAvailable: true}
+	notified := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		data    string
+		want    []Appointment
+		wantErr bool
+	}{
+		{name: "Empty", data: "  ", want: []Appointment{}},
+		{name: "Version1Array", data: `[{"date":"2024-05-15","time":"10:00 am – 10:30 am","spaces":2,"isAvailable":true}]`, want: []Appointment{appt}},
+		{name: "Version2", data: `{"schemaVersion":2,"appointments":[{"date":"2024-05-15","time":"10:00 am – 10:30 am","spaces":2,"isAvailable":true}]}`, want: []Appointment{appt}},
+		{name: "Version2NullList", data: `{"schemaVersion":2,"appointments":null}`, want: []Appointment{}},
+		{name: "Version2NotifiedAt", data: `{"schemaVersion":2,"appointments":[{"date":"2024-05-15","time":"10:00 am – 10:30 am","observedAt":"2024-05-01T09:00:00Z"}]}`,
+			want: []Appointment{{Date: "2024-05-15", Time: "10:00 am – 10:30 am", ObservedAt: notified, LastNotifiedAt: notified}}},
+		{name: "NewerVersion", data: `{"schemaVersion":99,"appointments":[]}`, wantErr: true},
+		{name: "MissingVersion", data: `{"appointments":[]}`, wantErr: true},
+		{name: "Malformed", data: `{`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeSeenState([]byte(tt.data), "test")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeSeenState() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeSeenState() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	at := time.Date(2024, 5, 15, 9, 0, 0, 0, time.UTC)
+	appointments := []Appointment{
+		{Date: "2024-05-20", Time: "9:00 am – 9:30 am", Spaces: 2, LastNotifiedAt: at},
+		{Date: "2024-05-20", Time: "10:00 am – 10:30 am", Spaces: 1, LastNotifiedAt: at},
+		{Date: "2024-05-20", Time: "9:00 am – 9:30 am", Spaces: 1, LastNotifiedAt: at.Add(time.Hour)},
+		{Date: "2024-05-20", Time: "9:00 am – 9:30 am", Spaces: 3, LastNotifiedAt: at.Add(-time.Hour)},
+		{Date: "2024-05-20", Time: "9:00 am – 9:30 am", Spaces: 1, LastNotifiedAt: at, Calendar: "Tailoring"},
+	}
+
+	got := Dedupe(appointments)
+	if len(got) != 3 {
+		t.Fatalf("Dedupe() = %+v, want 3 slots", got)
+	}
+	if got[0].Time != "9:00 am – 9:30 am" || !got[0].LastNotifiedAt.Equal(at.Add(time.Hour)) || got[0].Spaces != 1 {
+		t.Errorf("Dedupe()[0] = %+v, want the most recently notified record, first", got[0])
+	}
+	if got[2].Calendar != "Tailoring" {
+		t.Errorf("Dedupe()[2] = %+v, want the same time in another calendar kept", got[2])
+	}
+	if got := Dedupe(nil); got == nil || len(got) != 0 {
+		t.Errorf("Dedupe(nil) = %#v, want an empty list", got)
+	}
+}
+
+func TestJSONFileHistory(t *testing.T) {
+	dir := t.TempDir()
+	store := &JSONFile{Path: filepath.Join(dir, "seen.json"), HistoryPath: filepath.Join(dir, "history.jsonl")}
+
+	if events, err := store.History(); err != nil || len(events) != 0 {
+		t.Fatalf("History() on missing file = %v, %v; want empty", events, err)
+	}
+
+	at := time.Date(2024, 5, 15, 9, 0, 0, 0, time.UTC)
+	first := []Event{{At: at, Kind: "appeared", Date: "2024-05-20", Time: "10:00 am – 10:30 am", Spaces: 2}}
+	second := []Event{{At: at.Add(time.Hour), Kind: "decreased", Date: "2024-05-20", Time: "10:00 am – 10:30 am", Spaces: 1, PreviousSpaces: 2}}
+	for _, events := range [][]Event{first, second} {
+		if err := store.AppendHistory(events); err != nil {
+			t.Fatalf("AppendHistory() error = %v", err)
+		}
+	}
+
+	got, err := store.History()
+	if err != nil {
+		t.Fatalf("History() error = %v", err)
+	}
+	if want := append(first, second...); !reflect.DeepEqual(got, want) {
+		t.Errorf("History() = %+v, want %+v", got, want)
+	}
+}
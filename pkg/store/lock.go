@@ -0,0 +1,44 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// lockPollInterval is how often a held lock is re-tried while waiting.
+const lockPollInterval = 100 * time.Millisecond
+
+// errLockHeld is returned by tryLock when another process holds the lock.
+var errLockHeld = errors.New("lock held by another process")
+
+// acquireLock takes an exclusive advisory lock on path, creating the file if
+// needed and waiting up to timeout for another holder to release it. The
+// returned function releases the lock.
+func acquireLock(path string, timeout time.Duration) (func(), error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file %s: %w", path, err)
+	}
+
+	deadline := now().Add(timeout)
+	for {
+		err := tryLock(f)
+		if err == nil {
+			return func() {
+				unlock(f)
+				f.Close()
+			}, nil
+		}
+		if !errors.Is(err, errLockHeld) {
+			f.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+		if now().After(deadline) {
+			f.Close()
+			return nil, fmt.Errorf("%s is locked by another melanzana instance (waited %v); check for a stuck process or raise lockTimeoutSeconds", path, timeout)
+		}
+		sleep(lockPollInterval)
+	}
+}
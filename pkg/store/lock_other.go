@@ -0,0 +1,12 @@
+//go:build !unix
+
+package store
+
+import "os"
+
+// Advisory locking isn't implemented on this platform; concurrent instances
+// must be avoided by scheduling.
+
+func tryLock(f *os.File) error { return nil }
+
+func unlock(f *os.File) {}
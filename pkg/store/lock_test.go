@@ -0,0 +1,61 @@
+//go:build unix
+
+package store
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcquireLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seen.json.lock")
+
+	release, err := acquireLock(path, 0)
+	if err != nil {
+		t.Fatalf("acquireLock() error = %v", err)
+	}
+
+	// flock locks belong to the open file description, so a second open in
+	// the same process contends just like another instance would.
+	if _, err := acquireLock(path, 150*time.Millisecond); err == nil || !strings.Contains(err.Error(), "locked by another melanzana instance") {
+		t.Errorf("acquireLock() while held error = %v, want lock held error", err)
+	}
+
+	// Waiting goes by now and sleep, so a frozen clock doesn't hold up the
+	// test.
+	start := time.Date(2099, 7, 1, 12, 0, 0, 0, time.UTC)
+	frozen := start
+	defer func(n func() time.Time, s func(time.Duration)) { now, sleep = n, s }(now, sleep)
+	now = func() time.Time { return frozen }
+	sleep = func(d time.Duration) { frozen = frozen.Add(d) }
+	if _, err := acquireLock(path, time.Hour); err == nil {
+		t.Errorf("acquireLock() while held error = nil, want lock held error")
+	}
+	if waited := frozen.Sub(start); waited < time.Hour || waited > time.Hour+lockPollInterval {
+		t.Errorf("acquireLock() waited %v on the clock, want the timeout", waited)
+	}
+
+	release()
+	release, err = acquireLock(path, 0)
+	if err != nil {
+		t.Fatalf("acquireLock() after release error = %v", err)
+	}
+	release()
+}
+
+func TestJSONFileLockHeld(t *testing.T) {
+	dir := t.TempDir()
+	store := &JSONFile{Path: filepath.Join(dir, "seen.json"), HistoryPath: filepath.Join(dir, "history.jsonl")}
+
+	release, err := acquireLock(store.Path+".lock", 0)
+	if err != nil {
+		t.Fatalf("acquireLock() error = %v", err)
+	}
+	defer release()
+
+	if err := store.MarkSeen([]Appointment{{Date: "2024-05-15", Time: "10:00 am – 10:30 am"}}); err == nil {
+		t.Errorf("MarkSeen() while another instance holds the lock error = nil, want error")
+	}
+}
@@ -0,0 +1,33 @@
+-- Seen slots, one row per slot of each dataFile. record is the slot as
+-- kept by the other state stores; the other columns are copied from it so
+-- they can be queried.
+CREATE TABLE seen_slots (
+    data_file        text        NOT NULL,
+    slot             text        NOT NULL,
+    date             text        NOT NULL,
+    time             text        NOT NULL,
+    calendar         text        NOT NULL DEFAULT '',
+    last_notified_at timestamptz NOT NULL,
+    record           jsonb       NOT NULL,
+    PRIMARY KEY (data_file, slot)
+);
+
+-- Availability changes of each historyFile.
+CREATE TABLE availability_events (
+    id              bigserial   PRIMARY KEY,
+    history_file    text        NOT NULL,
+    at              timestamptz NOT NULL,
+    kind            text        NOT NULL,
+    date            text        NOT NULL,
+    time            text        NOT NULL,
+    calendar        text        NOT NULL DEFAULT '',
+    spaces          integer     NOT NULL,
+    previous_spaces integer     NOT NULL DEFAULT 0
+);
+CREATE INDEX availability_events_at ON availability_events (history_file, at, id);
+
+-- Subscribers added through the API, one list per subscribersFile.
+CREATE TABLE subscribers (
+    subscribers_file text  PRIMARY KEY,
+    subscribers      jsonb NOT NULL
+);
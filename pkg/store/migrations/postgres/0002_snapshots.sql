@@ -0,0 +1,5 @@
+-- The availability snapshot of each snapshotFile, replaced by every check.
+CREATE TABLE availability_snapshots (
+    snapshot_file text  PRIMARY KEY,
+    snapshot      jsonb NOT NULL
+);
@@ -0,0 +1,391 @@
+//go:build postgres
+
+package store
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed migrations/postgres/*.sql
+var postgresMigrations embed.FS
+
+// postgresMigrationLock is the advisory lock held while migrating, so
+// instances starting together don't apply a migration twice.
+const postgresMigrationLock = 0x6d656c616e7a616e // "melanzan"
+
+// postgresTimeout bounds each store operation.
+const postgresTimeout = 30 * time.Second
+
+// postgresPools holds a connection pool per database URL, opened and
+// migrated on first use, as a Store is made for every API request.
+var (
+	postgresPoolsMu sync.Mutex
+	postgresPools   = map[string]*pgxpool.Pool{}
+)
+
+// Postgres keeps the state in a PostgreSQL database, for users who
+// already run one: several watchers can share it, and the availability
+// history can be queried with SQL. Tables are created and upgraded by the
+// migrations in migrations/postgres when the store is first used.
+//
+//   - Each seen slot is a row of seen_slots, keyed by DataFile and slot. A
+//     slot is only overwritten by a record notified at least as recently,
+//     so concurrent runs can't replace a newer record with an older one.
+//   - Each availability change is a row of availability_events.
+//   - The subscribers added through the API are a row of subscribers,
+//     locked while they are changed.
+//   - The availability snapshot is a row of availability_snapshots, locked
+//     while it is replaced.
+type Postgres struct {
+	Pool            *pgxpool.Pool
+	DataFile        string
+	HistoryFile     string
+	SubscribersFile string // Empty disables subscribers
+	SnapshotFile    string // Empty disables the availability snapshot
+}
+
+// ErrUnreachable is wrapped by PostgresPool's errors when the database
+// couldn't be reached or migrated, which may only be for now.
+var ErrUnreachable = errors.New("state database unreachable")
+
+// PostgresPool returns the pool for url, opening it and applying any new
+// migrations if this is its first use.
+func PostgresPool(url string) (*pgxpool.Pool, error) {
+	postgresPoolsMu.Lock()
+	defer postgresPoolsMu.Unlock()
+	if pool, ok := postgresPools[url]; ok {
+		return pool, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database URL: %w", err)
+	}
+	if err := migratePostgres(ctx, pool); err != nil {
+		// The database may only be unreachable for now.
+		pool.Close()
+		return nil, fmt.Errorf("%w: %w", ErrUnreachable, err)
+	}
+	postgresPools[url] = pool
+	return pool, nil
+}
+
+// migratePostgres applies the embedded migrations the database hasn't had,
+// in order, recording each in melanzana_migrations. Each file is named
+// after its version, e.g. 0001_init.sql.
+func migratePostgres(ctx context.Context, pool *pgxpool.Pool) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to the state database: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", int64(postgresMigrationLock)); err != nil {
+		return fmt.Errorf("failed to lock the state database for migration: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `CREATE TABLE IF NOT EXISTS melanzana_migrations (
+		version    integer     PRIMARY KEY,
+		applied_at timestamptz NOT NULL DEFAULT now()
+	)`); err != nil {
+		return fmt.Errorf("failed to create melanzana_migrations: %w", err)
+	}
+	rows, err := tx.Query(ctx, "SELECT version FROM melanzana_migrations")
+	if err != nil {
+		return fmt.Errorf("failed to read melanzana_migrations: %w", err)
+	}
+	applied, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return fmt.Errorf("failed to read melanzana_migrations: %w", err)
+	}
+
+	names, _ := fs.Glob(postgresMigrations, "migrations/postgres/*.sql")
+	sort.Strings(names)
+	for _, name := range names {
+		base := name[strings.LastIndex(name, "/")+1:]
+		prefix, _, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return fmt.Errorf("migration %s isn't named after its version", base)
+		}
+		if slices.Contains(applied, version) {
+			continue
+		}
+		sql, err := postgresMigrations.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, string(sql)); err != nil {
+			return fmt.Errorf("failed to apply migration %s: %w", base, err)
+		}
+		if _, err := tx.Exec(ctx, "INSERT INTO melanzana_migrations (version) VALUES ($1)", version); err != nil {
+			return fmt.Errorf("failed to record migration %s: %w", base, err)
+		}
+		slog.Info("Applied state database migration", "migration", base)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit migrations: %w", err)
+	}
+	return nil
+}
+
+func (s *Postgres) Load() ([]Appointment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+	rows, err := s.Pool.Query(ctx, "SELECT record FROM seen_slots WHERE data_file = $1 ORDER BY date, time, calendar", s.DataFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load seen slots: %w", err)
+	}
+	records, err := pgx.CollectRows(rows, pgx.RowTo[[]byte])
+	if err != nil {
+		return nil, fmt.Errorf("failed to load seen slots: %w", err)
+	}
+	appointments := make([]Appointment, 0, len(records))
+	for _, record := range records {
+		var appt Appointment
+		if err := json.Unmarshal(record, &appt); err != nil {
+			return nil, fmt.Errorf("failed to parse seen slot: %w", err)
+		}
+		appointments = append(appointments, appt)
+	}
+	return appointments, nil
+}
+
+// Save replaces the seen slots with appointments in one transaction.
+func (s *Postgres) Save(appointments []Appointment) error {
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+	tx, err := s.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to save seen slots: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, "DELETE FROM seen_slots WHERE data_file = $1", s.DataFile); err != nil {
+		return fmt.Errorf("failed to save seen slots: %w", err)
+	}
+	if err := s.writeSeen(ctx, tx, Dedupe(appointments), ""); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to save seen slots: %w", err)
+	}
+	return nil
+}
+
+// MarkSeen writes each appointment unless the slot has a more recently
+// notified record, as a concurrent run may have written.
+func (s *Postgres) MarkSeen(appointments []Appointment) error {
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+	return s.writeSeen(ctx, s.Pool, Dedupe(appointments), `
+		ON CONFLICT (data_file, slot) DO UPDATE SET
+			date = excluded.date, time = excluded.time, calendar = excluded.calendar,
+			last_notified_at = excluded.last_notified_at, record = excluded.record
+		WHERE seen_slots.last_notified_at <= excluded.last_notified_at`)
+}
+
+// postgresQuerier is a pool or a transaction.
+type postgresQuerier interface {
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+}
+
+// writeSeen inserts appointments into seen_slots in one round trip, with
+// onConflict deciding what happens to slots already there.
+func (s *Postgres) writeSeen(ctx context.Context, db postgresQuerier, appointments []Appointment, onConflict string) error {
+	if len(appointments) == 0 {
+		return nil
+	}
+	batch := &pgx.Batch{}
+	for _, appt := range appointments {
+		record, err := json.Marshal(appt)
+		if err != nil {
+			return fmt.Errorf("failed to marshal seen slot: %w", err)
+		}
+		batch.Queue(`INSERT INTO seen_slots (data_file, slot, date, time, calendar, last_notified_at, record)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)`+onConflict,
+			s.DataFile, SlotID(appt.Date, appt.Time, appt.Calendar), appt.Date, appt.Time, appt.Calendar, appt.LastNotifiedAt, record)
+	}
+	if err := db.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to write seen slots: %w", err)
+	}
+	return nil
+}
+
+func (s *Postgres) Prune(before time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+	// As PruneBefore does, keep slots whose date isn't a date.
+	tag, err := s.Pool.Exec(ctx, `DELETE FROM seen_slots
+		WHERE data_file = $1 AND date ~ '^\d{4}-\d{2}-\d{2}$' AND date < $2`,
+		s.DataFile, before.Format("2006-01-02"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune seen slots: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+func (s *Postgres) History() ([]Event, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+	rows, err := s.Pool.Query(ctx, `SELECT at, kind, date, time, calendar, spaces, previous_spaces
+		FROM availability_events WHERE history_file = $1 ORDER BY at, id`, s.HistoryFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	events, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Event, error) {
+		var e Event
+		err := row.Scan(&e.At, &e.Kind, &e.Date, &e.Time, &e.Calendar, &e.Spaces, &e.PreviousSpaces)
+		e.At = e.At.UTC()
+		return e, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	return events, nil
+}
+
+func (s *Postgres) AppendHistory(events []Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+	if len(events) == 0 {
+		return nil
+	}
+	batch := &pgx.Batch{}
+	for _, e := range events {
+		batch.Queue(`INSERT INTO availability_events (history_file, at, kind, date, time, calendar, spaces, previous_spaces)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			s.HistoryFile, e.At, e.Kind, e.Date, e.Time, e.Calendar, e.Spaces, e.PreviousSpaces)
+	}
+	if err := s.Pool.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to append history: %w", err)
+	}
+	return nil
+}
+
+func (s *Postgres) Subscribers() ([]json.RawMessage, error) {
+	if s.SubscribersFile == "" {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+	var data []byte
+	err := s.Pool.QueryRow(ctx, "SELECT subscribers FROM subscribers WHERE subscribers_file = $1", s.SubscribersFile).Scan(&data)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read subscribers: %w", err)
+	}
+	return decodeSubscribers(data, s.SubscribersFile)
+}
+
+// UpdateSubscribers locks the subscribers' row while change runs, so
+// concurrent updates are applied one after another.
+func (s *Postgres) UpdateSubscribers(change func([]json.RawMessage) ([]json.RawMessage, error)) error {
+	if s.SubscribersFile == "" {
+		return fmt.Errorf("subscribersFile is not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+	tx, err := s.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to update subscribers: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, `INSERT INTO subscribers (subscribers_file, subscribers) VALUES ($1, '[]')
+		ON CONFLICT (subscribers_file) DO NOTHING`, s.SubscribersFile); err != nil {
+		return fmt.Errorf("failed to update subscribers: %w", err)
+	}
+	var data []byte
+	if err := tx.QueryRow(ctx, "SELECT subscribers FROM subscribers WHERE subscribers_file = $1 FOR UPDATE", s.SubscribersFile).Scan(&data); err != nil {
+		return fmt.Errorf("failed to update subscribers: %w", err)
+	}
+	subscribers, err := decodeSubscribers(data, s.SubscribersFile)
+	if err != nil {
+		return err
+	}
+	if subscribers, err = change(subscribers); err != nil {
+		return err
+	}
+	if data, err = encodeSubscribers(subscribers); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, "UPDATE subscribers SET subscribers = $2 WHERE subscribers_file = $1", s.SubscribersFile, data); err != nil {
+		return fmt.Errorf("failed to update subscribers: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to update subscribers: %w", err)
+	}
+	return nil
+}
+
+func (s *Postgres) Snapshot() (*Snapshot, error) {
+	if s.SnapshotFile == "" {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+	var data []byte
+	err := s.Pool.QueryRow(ctx, "SELECT snapshot FROM availability_snapshots WHERE snapshot_file = $1", s.SnapshotFile).Scan(&data)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read availability snapshot: %w", err)
+	}
+	return decodeSnapshot(data, s.SnapshotFile), nil
+}
+
+// UpdateSnapshot locks the snapshot's row while change runs, so concurrent
+// checks compare with each other's snapshots one after another.
+func (s *Postgres) UpdateSnapshot(change func(*Snapshot) (*Snapshot, error)) error {
+	if s.SnapshotFile == "" {
+		return fmt.Errorf("snapshotFile is not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+	tx, err := s.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to update availability snapshot: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, `INSERT INTO availability_snapshots (snapshot_file, snapshot) VALUES ($1, 'null')
+		ON CONFLICT (snapshot_file) DO NOTHING`, s.SnapshotFile); err != nil {
+		return fmt.Errorf("failed to update availability snapshot: %w", err)
+	}
+	var data []byte
+	if err := tx.QueryRow(ctx, "SELECT snapshot FROM availability_snapshots WHERE snapshot_file = $1 FOR UPDATE", s.SnapshotFile).Scan(&data); err != nil {
+		return fmt.Errorf("failed to update availability snapshot: %w", err)
+	}
+	var snapshot *Snapshot
+	if string(data) != "null" {
+		snapshot = decodeSnapshot(data, s.SnapshotFile)
+	}
+	if snapshot, err = change(snapshot); err != nil {
+		return err
+	}
+	if data, err = encodeSnapshot(snapshot); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, "UPDATE availability_snapshots SET snapshot = $2 WHERE snapshot_file = $1", s.SnapshotFile, data); err != nil {
+		return fmt.Errorf("failed to update availability snapshot: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to update availability snapshot: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+//go:build postgres
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestPostgres runs against the database at MELANZANA_TEST_DATABASE_URL,
+// keeping its rows apart from any others under a unique dataFile.
+func TestPostgres(t *testing.T) {
+	url := os.Getenv("MELANZANA_TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("MELANZANA_TEST_DATABASE_URL isn't set")
+	}
+	prefix := "test-" + time.Now().Format("20060102150405.000000000") + "-"
+	pool, err := PostgresPool(url)
+	if err != nil {
+		t.Fatalf("PostgresPool() error = %v", err)
+	}
+	store := &Postgres{Pool: pool, DataFile: prefix + "seen.json", HistoryFile: prefix + "history.jsonl",
+		SubscribersFile: prefix + "subscribers.json", SnapshotFile: prefix + "snapshot.json"}
+	t.Cleanup(func() {
+		ctx := context.Background()
+		store.Pool.Exec(ctx, "DELETE FROM seen_slots WHERE data_file = $1", store.DataFile)
+		store.Pool.Exec(ctx, "DELETE FROM availability_events WHERE history_file = $1", store.HistoryFile)
+		store.Pool.Exec(ctx, "DELETE FROM subscribers WHERE subscribers_file = $1", store.SubscribersFile)
+		store.Pool.Exec(ctx, "DELETE FROM availability_snapshots WHERE snapshot_file = $1", store.SnapshotFile)
+	})
+
+	// Migrating again finds nothing to apply.
+	if err := migratePostgres(context.Background(), store.Pool); err != nil {
+		t.Fatalf("migratePostgres() again error = %v", err)
+	}
+
+	notified := time.Date(2099, 7, 1, 12, 0, 0, 0, time.UTC)
+	slot := func(date string, at time.Time) Appointment {
+		return Appointment{Date: date, Time: "10:00 am – 10:30 am", Spaces: 1, LastNotifiedAt: at}
+	}
+	var many []Appointment
+	for day := 1; day <= 30; day++ {
+		many = append(many, slot(time.Date(2099, 8, day, 0, 0, 0, 0, time.UTC).Format("2006-01-02"), notified))
+	}
+	if err := store.Save(append(many, many[0])); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := store.Save(many[:3]); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if seen, err := store.Load(); err != nil || len(seen) != 3 {
+		t.Fatalf("Load() after Save() = %d slots, %v; want 3", len(seen), err)
+	}
+
+	// A run notified about 2099-08-01 later than this one did.
+	newer := slot("2099-08-01", notified.Add(time.Hour))
+	if err := store.MarkSeen([]Appointment{newer}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.MarkSeen([]Appointment{slot("2099-08-01", notified), slot("2099-06-30", notified)}); err != nil {
+		t.Fatalf("MarkSeen() error = %v", err)
+	}
+	seen, err := store.Load()
+	if err != nil || len(seen) != 4 || seen[0].Date != "2099-06-30" || !seen[1].LastNotifiedAt.Equal(newer.LastNotifiedAt) {
+		t.Fatalf("Load() after MarkSeen() = %+v, %v; want the newer record kept and the new slot added", seen, err)
+	}
+
+	removed, err := store.Prune(time.Date(2099, 8, 1, 12, 0, 0, 0, time.UTC))
+	if err != nil || removed != 1 {
+		t.Errorf("Prune() = %d, %v; want 1", removed, err)
+	}
+
+	events := []Event{
+		{At: notified.Add(time.Minute), Kind: "opened", Date: "2099-08-02", Time: "10:00 am – 10:30 am", Spaces: 1},
+		{At: notified, Kind: "opened", Date: "2099-08-01", Time: "10:00 am – 10:30 am", Spaces: 1},
+	}
+	if err := store.AppendHistory(events); err != nil {
+		t.Fatalf("AppendHistory() error = %v", err)
+	}
+	history, err := store.History()
+	if err != nil || len(history) != 2 || history[0].Date != "2099-08-01" || !history[0].At.Equal(notified) {
+		t.Errorf("History() = %+v, %v; want both events, oldest first", history, err)
+	}
+
+	for _, name := range []string{"grandma", "me"} {
+		err := store.UpdateSubscribers(func(s []json.RawMessage) ([]json.RawMessage, error) {
+			return append(s, json.RawMessage(`{"name":"`+name+`"}`)), nil
+		})
+		if err != nil {
+			t.Fatalf("UpdateSubscribers() error = %v", err)
+		}
+	}
+	subscribers, err := store.Subscribers()
+	var last struct{ Name string }
+	if err != nil || len(subscribers) != 2 || json.Unmarshal(subscribers[1], &last) != nil || last.Name != "me" {
+		t.Errorf("Subscribers() = %+v, %v; want both", subscribers, err)
+	}
+
+	if saved, err := store.Snapshot(); err != nil || saved != nil {
+		t.Errorf("Snapshot() before any was saved = %+v, %v; want none", saved, err)
+	}
+	for _, spaces := range []int{1, 2} {
+		err := store.UpdateSnapshot(func(*Snapshot) (*Snapshot, error) {
+			return &Snapshot{At: notified, Open: []Appointment{{Date: "2099-08-01", Spaces: spaces}}}, nil
+		})
+		if err != nil {
+			t.Fatalf("UpdateSnapshot() error = %v", err)
+		}
+	}
+	if saved, err := store.Snapshot(); err != nil || saved == nil || len(saved.Open) != 1 || saved.Open[0].Spaces != 2 {
+		t.Errorf("Snapshot() = %+v, %v; want the second update", saved, err)
+	}
+}
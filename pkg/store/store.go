@@ -0,0 +1,172 @@
+// Package store persists what a Melanzana watcher knows between checks: the
+// slots it has notified, the availability history, the subscribers added
+// through its API and the last availability snapshot. JSONFile keeps them
+// in local files; Bucket, DynamoDB and Postgres keep them in S3 or GCS, a
+// DynamoDB table or a PostgreSQL database.
+//
+//	var s store.Store = &store.JSONFile{Path: "seen.json", HistoryPath: "history.jsonl"}
+//	seen, err := s.Load()
+package store
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// Store persists the set of appointments that have already been notified.
+// JSONFile is the default; other backends can be plugged in by implementing
+// this interface.
+type Store interface {
+	// Load returns every seen appointment.
+	Load() ([]Appointment, error)
+	// Save replaces the seen set with appointments.
+	Save(appointments []Appointment) error
+	// MarkSeen adds appointments to the seen set, replacing any earlier
+	// record of the same slot.
+	MarkSeen(appointments []Appointment) error
+	// Prune removes appointments dated before the day of before, in its
+	// location, and returns how many were removed.
+	Prune(before time.Time) (int, error)
+	// History returns every recorded availability change, oldest first.
+	History() ([]Event, error)
+	// AppendHistory records availability changes.
+	AppendHistory(events []Event) error
+	// Subscribers returns the subscribers added through the API, each as
+	// the JSON object it was stored as.
+	Subscribers() ([]json.RawMessage, error)
+	// UpdateSubscribers replaces the subscribers added through the API with
+	// the result of change applied to the stored list. An error from change
+	// is returned and nothing is written.
+	UpdateSubscribers(change func([]json.RawMessage) ([]json.RawMessage, error)) error
+	// Snapshot returns the availability snapshot saved by the last check,
+	// or nil if there is none.
+	Snapshot() (*Snapshot, error)
+	// UpdateSnapshot replaces the availability snapshot with the result of
+	// change applied to the stored one, nil if there is none. Concurrent
+	// updates are applied one after another, each given the last's result,
+	// so change may be called more than once. An error from change is
+	// returned and nothing is written.
+	UpdateSnapshot(change func(*Snapshot) (*Snapshot, error)) error
+}
+
+// Appointment holds information about a single appointment slot.
+type Appointment struct {
+	Date        string    `json:"date"`                // YYYY-MM-DD format
+	Time        string    `json:"time"`                // e.g., "10:30 am – 11:00 am"
+	Spaces      int       `json:"spaces"`              // number of available spaces
+	MaxSpaces   int       `json:"maxSpaces,omitempty"` // spaces the slot holds when empty; 0 if unknown
+	IsAvailable bool      `json:"isAvailable"`         // whether any appointments are available
+	ObservedAt  time.Time `json:"observedAt"`          // when the slot was fetched from the API; for seen slots, when last notified
+	Calendar    string    `json:"calendar,omitempty"`  // name of the calendar the slot is in, when several are watched
+
+	// Set on seen slots only, by the cycle that records them.
+	FirstSeenAt    time.Time `json:"firstSeenAt,omitempty"`    // when the slot was first notified; zero if recorded before this was kept
+	LastSeenAt     time.Time `json:"lastSeenAt,omitempty"`     // the latest cycle that found the slot available
+	LastNotifiedAt time.Time `json:"lastNotifiedAt,omitempty"` // when recipients were last told about the slot
+}
+
+// Event is one change in a slot's availability.
+type Event struct {
+	At             time.Time `json:"at"`
+	Kind           string    `json:"kind"`
+	Date           string    `json:"date"`
+	Time           string    `json:"time"`
+	Calendar       string    `json:"calendar,omitempty"`
+	Spaces         int       `json:"spaces"`
+	PreviousSpaces int       `json:"previousSpaces,omitempty"`
+}
+
+// Snapshot is everything a watch knew of the booking calendar after its
+// last check. It is kept between runs so the next check can be compared
+// with it, and the API can serve it after a restart, without replaying the
+// availability history.
+type Snapshot struct {
+	At     time.Time     `json:"at"`               // When the slots were checked
+	Open   []Appointment `json:"open"`             // Slots open at the check
+	Booked []Appointment `json:"booked,omitempty"` // Slots open before, since fully booked or withdrawn; date, time and calendar only
+}
+
+// SlotID identifies a slot by its date, time and calendar, as the stores
+// key seen records. Slots of an unnamed calendar keep the key they had
+// before calendars could be named, so state recorded earlier still matches.
+func SlotID(date, time, calendar string) string {
+	if calendar == "" {
+		return date + "|" + time
+	}
+	return date + "|" + time + "|" + calendar
+}
+
+// slotKey identifies a slot like SlotID does, but without building a
+// string for every lookup.
+type slotKey struct {
+	date, time, calendar string
+}
+
+func keyOf(appt Appointment) slotKey {
+	return slotKey{appt.Date, appt.Time, appt.Calendar}
+}
+
+// MergeSeen returns seen with appointments added, dropping earlier records
+// of the same slots so that each is kept once, as last notified.
+func MergeSeen(seen, appointments []Appointment) []Appointment {
+	marked := make(map[slotKey]bool, len(appointments))
+	for _, appt := range appointments {
+		marked[keyOf(appt)] = true
+	}
+	kept := make([]Appointment, 0, len(seen)+len(appointments))
+	for _, appt := range seen {
+		if !marked[keyOf(appt)] {
+			kept = append(kept, appt)
+		}
+	}
+	return append(kept, appointments...)
+}
+
+// Dedupe drops repeated records of a slot, as overlapping cycles or merged
+// state files can leave. The most recently notified record is kept, in the
+// place of the slot's first.
+func Dedupe(appointments []Appointment) []Appointment {
+	index := make(map[slotKey]int, len(appointments))
+	deduped := make([]Appointment, 0, len(appointments))
+	for _, appt := range appointments {
+		key := keyOf(appt)
+		i, ok := index[key]
+		switch {
+		case !ok:
+			index[key] = len(deduped)
+			deduped = append(deduped, appt)
+		case !appt.LastNotifiedAt.Before(deduped[i].LastNotifiedAt):
+			deduped[i] = appt
+		}
+	}
+	return deduped
+}
+
+// PruneBefore returns the appointments dated on or after the day of before,
+// in its location. Appointments with unparseable dates are kept.
+func PruneBefore(appointments []Appointment, before time.Time) []Appointment {
+	cutoff := before.Format("2006-01-02")
+	kept := []Appointment{}
+	for _, appt := range appointments {
+		if _, err := time.Parse("2006-01-02", appt.Date); err == nil && appt.Date < cutoff {
+			continue
+		}
+		kept = append(kept, appt)
+	}
+	return kept
+}
+
+// The clock the stores wait on; variables so tests can skip the waits.
+var (
+	now   = time.Now
+	sleep = time.Sleep
+)
+
+// httpClient returns client, or http.DefaultClient if it is nil.
+func httpClient(client *http.Client) *http.Client {
+	if client == nil {
+		return http.DefaultClient
+	}
+	return client
+}
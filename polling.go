@@ -0,0 +1,140 @@
+package melanzana
+
+import (
+	"log/slog"
+	"math"
+	"time"
+)
+
+// AdaptivePollingConfig varies the daemon's polling interval with how often
+// slots have opened at the same time of the week and of the month before.
+type AdaptivePollingConfig struct {
+	MinIntervalMinutes int `json:"minIntervalMinutes"` // Interval at the times slots have opened most often
+	MaxIntervalMinutes int `json:"maxIntervalMinutes"` // Interval at times slots have never opened
+}
+
+func (c AdaptivePollingConfig) enabled() bool {
+	return c.MinIntervalMinutes > 0 && c.MaxIntervalMinutes > 0
+}
+
+// minPollHistory is how much history adaptive polling needs before it
+// trusts the patterns in it.
+const minPollHistory = 7 * 24 * time.Hour
+
+// openingProfile is how often slots have opened in each hour of the week
+// and of the month: the fraction of times that hour came round in the
+// history that a check found at least one slot appearing or reopening.
+// The monthly profile catches a shop releasing the next month's calendar
+// on the same day each month.
+type openingProfile struct {
+	loc     *time.Location
+	weekly  [7 * 24]float64 // By weekday, Sunday first, then hour
+	monthly [31 * 24]float64
+}
+
+// newOpeningProfile builds the profile from history, with times in loc. It
+// returns false if history covers less than minPollHistory.
+func newOpeningProfile(history []AvailabilityEvent, loc *time.Location) (openingProfile, bool) {
+	p := openingProfile{loc: loc}
+	if len(history) == 0 {
+		return p, false
+	}
+	span := history[len(history)-1].At.Sub(history[0].At)
+	if span < minPollHistory {
+		return p, false
+	}
+	// How many times each hour of the week or month can have come round.
+	weeks := math.Ceil(span.Hours() / (7 * 24))
+	months := math.Ceil(span.Hours() / (30.44 * 24))
+
+	// A month's release is many slots appearing at once; count the hours
+	// with openings, not the slots.
+	hours := map[time.Time]bool{}
+	for _, e := range history {
+		if e.Kind != eventAppeared && e.Kind != eventReappeared {
+			continue
+		}
+		at := e.At.In(loc)
+		hour := time.Date(at.Year(), at.Month(), at.Day(), at.Hour(), 0, 0, 0, loc)
+		if hours[hour] {
+			continue
+		}
+		hours[hour] = true
+		p.weekly[weekHour(hour)] += 1 / weeks
+		p.monthly[monthHour(hour)] += 1 / months
+	}
+	return p, true
+}
+
+func weekHour(t time.Time) int  { return int(t.Weekday())*24 + t.Hour() }
+func monthHour(t time.Time) int { return (t.Day()-1)*24 + t.Hour() }
+
+// likelihood returns how likely slots are to open in the hour containing t,
+// from 0 to 1.
+func (p openingProfile) likelihood(t time.Time) float64 {
+	t = t.In(p.loc)
+	return min(max(p.weekly[weekHour(t)], p.monthly[monthHour(t)]), 1)
+}
+
+// interval returns how long to wait after a check at now: minInterval when
+// slots have always opened in this hour, maxInterval when they never have,
+// and in proportion between. The wait is cut short to check at the start
+// of a coming hour in which slots are more likely to open.
+func (p openingProfile) interval(now time.Time, minInterval, maxInterval time.Duration) time.Duration {
+	here := p.likelihood(now)
+	d := maxInterval - time.Duration(float64(maxInterval-minInterval)*here)
+	d = max(d.Round(time.Minute), minInterval)
+	for hour := now.Truncate(time.Hour).Add(time.Hour); hour.Before(now.Add(d)); hour = hour.Add(time.Hour) {
+		if p.likelihood(hour) > here {
+			return max(hour.Sub(now), minInterval)
+		}
+	}
+	return d
+}
+
+// nextPollInterval returns how long the daemon waits after a check started
+// at now: interval, unless adaptive polling is enabled and the history is
+// long enough to show when slots tend to open. Either is cut short if the
+// calendar hinted, with next_unix, that availability starts sooner.
+func nextPollInterval(config AppConfig, now time.Time, interval time.Duration) time.Duration {
+	next := adaptivePollInterval(config, now, interval)
+	if hint := nextUnixHint.Load(); hint > 0 {
+		at := time.Unix(hint, 0).Add(nextUnixMargin)
+		if at.After(now) && at.Before(now.Add(next)) {
+			slog.Info("Checking again when the calendar says availability starts", "at", at.Format(time.RFC3339))
+			next = at.Sub(now)
+		}
+	}
+	return next
+}
+
+// nextUnixMargin is how long after a next_unix hint the check it brings
+// forward runs, so the calendar has caught up.
+const nextUnixMargin = 30 * time.Second
+
+// adaptivePollInterval returns the interval after a check at now chosen by
+// adaptive polling, or interval if it is disabled.
+func adaptivePollInterval(config AppConfig, now time.Time, interval time.Duration) time.Duration {
+	adaptive := config.AdaptivePolling
+	if !adaptive.enabled() {
+		return interval
+	}
+	store, err := newStore(config)
+	if err != nil {
+		slog.Warn("Error opening state store for adaptive polling", "err", err)
+		return interval
+	}
+	history, err := store.History()
+	if err != nil {
+		slog.Warn("Error reading history for adaptive polling", "err", err)
+		return interval
+	}
+	profile, ok := newOpeningProfile(history, sourceLocation())
+	if !ok {
+		slog.Debug("Not enough history for adaptive polling yet", "interval", interval)
+		return interval
+	}
+	next := profile.interval(now, time.Duration(adaptive.MinIntervalMinutes)*time.Minute, time.Duration(adaptive.MaxIntervalMinutes)*time.Minute)
+	slog.Info("Next check", "in", next, "likelihood", math.Round(profile.likelihood(now)*100)/100)
+	return next
+}
@@ -0,0 +1,83 @@
+package melanzana
+
+import (
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestOpeningProfile(t *testing.T) {
+	at := func(day, hour, minute int) time.Time { return time.Date(2099, 6, day, hour, minute, 0, 0, time.UTC) }
+	opened := func(t time.Time, date string) AvailabilityEvent {
+		return AvailabilityEvent{At: t, Kind: eventAppeared, Date: date, Time: "10:00 am – 10:30 am", Spaces: 1}
+	}
+	// Four weeks in which slots open every Monday around 9:00, many at
+	// once, and on two Wednesdays at 16:00.
+	var history []AvailabilityEvent
+	for _, day := range []int{1, 8, 15, 22} {
+		history = append(history, opened(at(day, 9, 10), "2099-07-01"), opened(at(day, 9, 10), "2099-07-02"), opened(at(day, 9, 40), "2099-07-03"))
+	}
+	history = append(history, opened(at(3, 16, 5), "2099-07-04"), opened(at(17, 16, 5), "2099-07-05"))
+	history = append(history, AvailabilityEvent{At: at(29, 0, 0), Kind: eventDisappeared, Date: "2099-07-01", Time: "10:00 am – 10:30 am"})
+	sort.Slice(history, func(i, j int) bool { return history[i].At.Before(history[j].At) })
+
+	if _, ok := newOpeningProfile(history[:3], time.UTC); ok {
+		t.Error("newOpeningProfile() of a day's history ok = true, want false")
+	}
+	profile, ok := newOpeningProfile(history, time.UTC)
+	if !ok {
+		t.Fatal("newOpeningProfile() of four weeks' history ok = false")
+	}
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want time.Duration
+	}{
+		{"MondayOpening", time.Date(2099, 7, 6, 9, 30, 0, 0, time.UTC), 10 * time.Minute},
+		{"Quiet", time.Date(2099, 7, 7, 12, 0, 0, 0, time.UTC), time.Hour},
+		{"BeforeMondayOpening", time.Date(2099, 7, 6, 8, 30, 0, 0, time.UTC), 30 * time.Minute},
+		{"HalfTheWednesdays", time.Date(2099, 7, 8, 16, 0, 0, 0, time.UTC), 35 * time.Minute},
+		{"SameDayOfMonth", time.Date(2099, 7, 1, 9, 0, 0, 0, time.UTC), 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := profile.interval(tt.now, 10*time.Minute, time.Hour); got != tt.want {
+				t.Errorf("interval(%v) = %v, want %v (likelihood %.2f)", tt.now, got, tt.want, profile.likelihood(tt.now))
+			}
+		})
+	}
+}
+
+func TestNextPollInterval(t *testing.T) {
+	dir := t.TempDir()
+	config := defaultConfig()
+	config.DataFile = filepath.Join(dir, "seen.json")
+	config.HistoryFile = filepath.Join(dir, "history.jsonl")
+	now := time.Date(2099, 7, 6, 9, 30, 0, 0, time.UTC)
+
+	if got := nextPollInterval(config, now, 15*time.Minute); got != 15*time.Minute {
+		t.Errorf("nextPollInterval() without adaptive polling = %v, want pollIntervalMinutes", got)
+	}
+	config.AdaptivePolling = AdaptivePollingConfig{MinIntervalMinutes: 5, MaxIntervalMinutes: 60}
+	if got := nextPollInterval(config, now, 15*time.Minute); got != 15*time.Minute {
+		t.Errorf("nextPollInterval() without history = %v, want pollIntervalMinutes", got)
+	}
+
+	defer nextUnixHint.Store(0)
+	for _, tt := range []struct {
+		name string
+		hint time.Time
+		want time.Duration
+	}{
+		{"Sooner", now.Add(10 * time.Minute), 10*time.Minute + nextUnixMargin},
+		{"Later", now.Add(time.Hour), 15 * time.Minute},
+		{"Past", now.Add(-time.Hour), 15 * time.Minute},
+	} {
+		nextUnixHint.Store(tt.hint.Unix())
+		if got := nextPollInterval(config, now, 15*time.Minute); got != tt.want {
+			t.Errorf("%s: nextPollInterval() with next_unix hint = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
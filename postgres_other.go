@@ -0,0 +1,11 @@
+//go:build !postgres
+
+package melanzana
+
+import "fmt"
+
+// newPostgresStore is replaced by the PostgreSQL store in builds tagged
+// postgres, which alone depend on the pgx driver.
+func newPostgresStore(config AppConfig) (Store, error) {
+	return nil, fmt.Errorf("this build doesn't include the postgres state store; build with -tags postgres")
+}
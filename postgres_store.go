@@ -0,0 +1,33 @@
+//go:build postgres
+
+package melanzana
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pashbylogan/melanzana/pkg/store"
+)
+
+func newPostgresStore(config AppConfig) (Store, error) {
+	if config.StateDatabaseURL == "" {
+		return nil, fmt.Errorf("stateDatabaseUrl is required for the postgres state store")
+	}
+	if len(stateCodecNames(config)) > 0 {
+		return nil, fmt.Errorf("stateCodecs isn't supported by the postgres state store")
+	}
+	pool, err := store.PostgresPool(config.StateDatabaseURL)
+	if errors.Is(err, store.ErrUnreachable) {
+		return nil, fmt.Errorf("%w: %w", errStore, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("stateDatabaseUrl: %w", err)
+	}
+	return &store.Postgres{
+		Pool:            pool,
+		DataFile:        config.DataFile,
+		HistoryFile:     config.HistoryFile,
+		SubscribersFile: config.SubscribersFile,
+		SnapshotFile:    config.SnapshotFile,
+	}, nil
+}
@@ -0,0 +1,151 @@
+package melanzana
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pashbylogan/melanzana/pkg/filter"
+	"github.com/pashbylogan/melanzana/pkg/store"
+)
+
+// appointmentKey identifies a slot independent of its availability details.
+func appointmentKey(appt Appointment) string {
+	return store.SlotID(appt.Date, appt.Time, appt.Calendar)
+}
+
+// probeAppointments reads current availability from appointmentSource, as
+// far ahead as the latest of appointments, and splits appointments into
+// those still open and passing filter, with their current spaces, and those
+// that have gone or no longer pass it.
+func probeAppointments(appointments []Appointment, filter filter.Watch) (stillOpen, gone []Appointment, err error) {
+	now := clock.Now().In(sourceLocation())
+	monthsAhead := 1
+	for _, appt := range appointments {
+		date, err := time.Parse("2006-01-02", appt.Date)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid appointment date %q: %w", appt.Date, err)
+		}
+		months := (date.Year()-now.Year())*12 + int(date.Month()) - int(now.Month()) + 1
+		monthsAhead = max(monthsAhead, months)
+	}
+
+	// The re-check is about the latest availability, so it doesn't use the
+	// cache; what it finds is cached for everyone else.
+	if availabilityCache != nil {
+		availabilityCache.Invalidate()
+	}
+	current, err := appointmentSource.Appointments(monthsAhead)
+	if err != nil {
+		// A month that couldn't be read would make its slots look gone.
+		return nil, nil, fmt.Errorf("failed to re-check availability: %w", err)
+	}
+	open := make(map[slotKey]Appointment)
+	for _, appt := range filter.Apply(current) {
+		open[slotKey{appt.Date, appt.Time, appt.Calendar}] = appt
+	}
+
+	for _, appt := range appointments {
+		if cur, ok := open[slotKey{appt.Date, appt.Time, appt.Calendar}]; ok {
+			appt.Spaces, appt.IsAvailable = cur.Spaces, cur.IsAvailable
+			stillOpen = append(stillOpen, appt)
+		} else {
+			gone = append(gone, appt)
+		}
+	}
+	return stillOpen, gone, nil
+}
+
+// probeNotification re-checks the appointments notified delay ago and
+// returns a follow-up notification describing which are still open.
+func probeNotification(notified []Appointment, delay time.Duration, filter filter.Watch) (Notification, error) {
+	slog.Info("Re-checking notified appointments", "count", len(notified), "delay", delay)
+	stillOpen, gone, err := probeAppointments(notified, filter)
+	if err != nil {
+		return Notification{}, err
+	}
+	slog.Info("Re-checked notified appointments", "delay", delay, "stillOpen", len(stillOpen), "gone", len(gone))
+
+	return Notification{
+		Subject: fmt.Sprintf("Update: %d of %d new Melanzana slots still available", len(stillOpen), len(notified)),
+		Intro: fmt.Sprintf("Re-checked %d seconds after the first alert: %d of %d slots are still available.",
+			int(delay.Seconds()), len(stillOpen), len(notified)),
+		Appointments: stillOpen,
+		Removed:      gone,
+	}, nil
+}
+
+// followUp is a re-check of the slots a watch notified, scheduled by the
+// cycle that notified them.
+type followUp struct {
+	due      time.Time
+	delay    time.Duration
+	notified []Appointment
+	filter   filter.Watch         // The watch's filters, which the slots must still pass
+	deliver  func(n Notification) // Sends to the watch's recipients
+}
+
+func (f followUp) run() {
+	n, err := probeNotification(f.notified, f.delay, f.filter)
+	if err != nil {
+		slog.Warn("Error re-checking notified appointments", "err", err)
+		return
+	}
+	f.deliver(n)
+}
+
+// followUps holds the re-checks scheduled but not yet run. Cycles don't
+// wait for them: the daemon runs each when it is due, between cycles, and
+// single runs finish them all before exiting, waiting once for the latest.
+var followUps = &followUpQueue{}
+
+type followUpQueue struct {
+	mu      sync.Mutex
+	pending []followUp // By due time
+}
+
+// schedule adds f to the queue.
+func (q *followUpQueue) schedule(f followUp) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	i := sort.Search(len(q.pending), func(i int) bool { return q.pending[i].due.After(f.due) })
+	q.pending = slices.Insert(q.pending, i, f)
+}
+
+// nextDue returns when the earliest re-check is due, or false if none is
+// scheduled.
+func (q *followUpQueue) nextDue() (time.Time, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pending) == 0 {
+		return time.Time{}, false
+	}
+	return q.pending[0].due, true
+}
+
+// runDue runs, in order, the re-checks due by now.
+func (q *followUpQueue) runDue(now time.Time) {
+	q.mu.Lock()
+	n := sort.Search(len(q.pending), func(i int) bool { return q.pending[i].due.After(now) })
+	due := slices.Clone(q.pending[:n])
+	q.pending = q.pending[n:]
+	q.mu.Unlock()
+	for _, f := range due {
+		f.run()
+	}
+}
+
+// drain waits for and runs every scheduled re-check.
+func (q *followUpQueue) drain() {
+	for {
+		due, ok := q.nextDue()
+		if !ok {
+			return
+		}
+		clock.Sleep(due.Sub(clock.Now()))
+		q.runDue(clock.Now())
+	}
+}
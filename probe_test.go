@@ -0,0 +1,104 @@
+package melanzana
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// monthsSource records how far ahead it was read.
+type monthsSource struct {
+	stubSource
+	monthsAhead *int
+}
+
+func (s monthsSource) Appointments(monthsAhead int) ([]Appointment, error) {
+	*s.monthsAhead = monthsAhead
+	return s.stubSource.Appointments(monthsAhead)
+}
+
+func TestProbeAppointments(t *testing.T) {
+	defer func(s Source, tz string) { appointmentSource, sourceTimezone = s, tz }(appointmentSource, sourceTimezone)
+	sourceTimezone = "America/Denver"
+	fixClock(t, time.Date(2099, 7, 1, 18, 0, 0, 0, time.UTC))
+	slot := func(date string, spaces int) Appointment {
+		return Appointment{Date: date, Time: "10:00 am – 10:30 am", Spaces: spaces, IsAvailable: true}
+	}
+
+	var calls, monthsAhead int
+	appointmentSource = monthsSource{stubSource{appointments: []Appointment{
+		slot("2099-07-02", 3), // Gained a space
+		slot("2099-07-03", 1), // Now below minSpaces
+		slot("2099-09-10", 2),
+	}, calls: &calls}, &monthsAhead}
+	filter, err := newWatchFilter(AppConfig{MinSpaces: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notified := []Appointment{slot("2099-07-02", 2), slot("2099-07-03", 2), slot("2099-07-04", 2), slot("2099-09-10", 2)}
+	stillOpen, gone, err := probeAppointments(notified, filter)
+	if err != nil {
+		t.Fatalf("probeAppointments() error = %v", err)
+	}
+	if want := []Appointment{slot("2099-07-02", 3), slot("2099-09-10", 2)}; !reflect.DeepEqual(stillOpen, want) {
+		t.Errorf("stillOpen = %+v, want %+v", stillOpen, want)
+	}
+	if want := notified[1:3]; !reflect.DeepEqual(gone, want) {
+		t.Errorf("gone = %+v, want the booked slot and the one below minSpaces, %+v", gone, want)
+	}
+	if calls != 1 || monthsAhead != 3 {
+		t.Errorf("source read %d times, %d months ahead; want once, through September", calls, monthsAhead)
+	}
+
+	// A failed read isn't taken as every slot gone.
+	appointmentSource = stubSource{appointments: stillOpen, err: &partialFetchError{Fetched: 2, Attempted: 3, Err: errors.New("September down")}, calls: &calls}
+	if _, _, err := probeAppointments(notified, filter); err == nil {
+		t.Errorf("probeAppointments() with a failed read error = nil, want error")
+	}
+}
+
+func TestFollowUpQueue(t *testing.T) {
+	defer func(s Source) { appointmentSource = s }(appointmentSource)
+	start := time.Date(2099, 7, 1, 18, 0, 0, 0, time.UTC)
+	frozen := fixClock(t, start)
+	var calls int
+	appointmentSource = stubSource{err: errors.New("down"), calls: &calls}
+
+	var delivered []string
+	q := &followUpQueue{}
+	schedule := func(name string, delay time.Duration) {
+		q.schedule(followUp{due: start.Add(delay), delay: delay, notified: []Appointment{{Date: "2099-07-02"}},
+			deliver: func(Notification) { delivered = append(delivered, name) }})
+	}
+	schedule("late", time.Minute)
+	schedule("early", 30*time.Second)
+
+	if due, ok := q.nextDue(); !ok || !due.Equal(start.Add(30*time.Second)) {
+		t.Errorf("nextDue() = %v, %v; want the earliest", due, ok)
+	}
+	q.runDue(start)
+	if calls != 0 {
+		t.Errorf("runDue() before any was due re-checked %d times", calls)
+	}
+
+	// Re-checks that fail aren't delivered, and are dropped.
+	q.runDue(start.Add(45 * time.Second))
+	if calls != 1 || len(delivered) != 0 {
+		t.Errorf("runDue() re-checked %d times and delivered %v; want one re-check, undelivered", calls, delivered)
+	}
+
+	appointmentSource = stubSource{calls: &calls}
+	schedule("next", 2*time.Minute)
+	q.drain()
+	if want := []string{"late", "next"}; !reflect.DeepEqual(delivered, want) {
+		t.Errorf("drain() delivered %v, want %v", delivered, want)
+	}
+	if waited := frozen.Now().Sub(start); waited != 2*time.Minute {
+		t.Errorf("drain() waited %v on the clock, want until the last was due", waited)
+	}
+	if _, ok := q.nextDue(); ok {
+		t.Errorf("nextDue() after drain() found a re-check left")
+	}
+}
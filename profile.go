@@ -0,0 +1,148 @@
+package melanzana
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/pashbylogan/melanzana/pkg/filter"
+)
+
+// profileAll selects every profile for one cycle, sharing a single fetch.
+const profileAll = "all"
+
+// Profile is a named watch for one person in a shared config file, e.g. "me"
+// and "partner", with its own recipients, lookahead and filters.
+type Profile struct {
+	Name            string   `json:"name"`            // Selects the profile with -profile; "all" is reserved
+	MonthsLookahead int      `json:"monthsLookahead"` // Months to watch; 0 uses monthsLookahead
+	Weekdays        []string `json:"weekdays"`        // e.g. ["Sat", "Sun"]; empty means every day
+	MinSpaces       int      `json:"minSpaces"`       // Only slots with at least this many spaces
+	Calendars       []string `json:"calendars"`       // Names from calendars to watch; empty means every calendar
+	ToEmails        []string `json:"toEmails"`        // Recipients for this profile; if neither this nor recipientsFile is set, the top-level recipients are used
+	RecipientsFile  string   `json:"recipientsFile"`  // Recipients list file for this profile
+}
+
+// validate checks the profile's name and filters.
+func (p Profile) validate() error {
+	if !namespaceNamePattern.MatchString(p.Name) || p.Name == profileAll {
+		return fmt.Errorf("profile name %q must be letters, digits, '-' or '_', and not %q", p.Name, profileAll)
+	}
+	if p.MonthsLookahead < 0 {
+		return fmt.Errorf("profile %q has negative monthsLookahead %d", p.Name, p.MonthsLookahead)
+	}
+	if _, err := filter.Compile(p.Weekdays, p.MinSpaces, p.Calendars); err != nil {
+		return fmt.Errorf("profile %q: %w", p.Name, err)
+	}
+	return nil
+}
+
+// validateProfiles checks each profile, that names are unique and that
+// selected names one of them.
+func validateProfiles(profiles []Profile, selected string) error {
+	names := make(map[string]bool)
+	for _, p := range profiles {
+		if err := p.validate(); err != nil {
+			return err
+		}
+		if names[p.Name] {
+			return fmt.Errorf("duplicate profile name %q", p.Name)
+		}
+		names[p.Name] = true
+	}
+	if selected != "" && selected != profileAll && !names[selected] {
+		return fmt.Errorf("no profile named %q in the configuration", selected)
+	}
+	return nil
+}
+
+// selectedProfiles returns the profiles config.Profile selects, or none if
+// the top-level configuration should run.
+func selectedProfiles(config AppConfig) []Profile {
+	if config.Profile == profileAll {
+		return config.Profiles
+	}
+	for _, p := range config.Profiles {
+		if p.Name == config.Profile {
+			return []Profile{p}
+		}
+	}
+	return nil
+}
+
+// lookahead returns how many months the profile watches.
+func (p Profile) lookahead(config AppConfig) int {
+	if p.MonthsLookahead > 0 {
+		return p.MonthsLookahead
+	}
+	return config.MonthsLookahead
+}
+
+// fetchMonths returns how many months to fetch so that every selected
+// profile, or the top-level configuration, sees all the months it watches,
+// extended to reach notAfter if it lies further ahead.
+func fetchMonths(config AppConfig) int {
+	months := monthsThrough(config.NotAfter, clock.Now())
+	profiles := selectedProfiles(config)
+	if len(profiles) == 0 {
+		return max(months, config.MonthsLookahead)
+	}
+	for _, p := range profiles {
+		months = max(months, p.lookahead(config))
+	}
+	return months
+}
+
+// matches reports whether appt falls within the profile's lookahead, counted
+// in calendar months from now as the scraper does, and passes its filters.
+func (p Profile) matches(appt Appointment, config AppConfig, now time.Time) bool {
+	if date, err := time.Parse("2006-01-02", appt.Date); err == nil {
+		now = now.In(sourceLocation())
+		monthsAhead := (date.Year()-now.Year())*12 + int(date.Month()) - int(now.Month())
+		if monthsAhead >= p.lookahead(config) {
+			return false
+		}
+	}
+	return Recipient{Weekdays: p.Weekdays, MinSpaces: p.MinSpaces, Calendars: p.Calendars}.matches(appt)
+}
+
+// configFor returns config as the profile sees it: its state in its own
+// namespace, and its recipients and lookahead in place of the top-level ones.
+func (p Profile) configFor(config AppConfig) AppConfig {
+	config = namespacedConfig(config, "profiles", p.Name)
+	config.MonthsLookahead = p.lookahead(config)
+	if len(p.ToEmails) > 0 || p.RecipientsFile != "" {
+		config.ToEmails = p.ToEmails
+		config.RecipientsFile = p.RecipientsFile
+		config.Subscribers, config.SubscriberAPIToken, config.IMAPServer = nil, "", ""
+	}
+	return config
+}
+
+// runProfiles runs a watch for each selected profile against one scrape,
+// returning the appointments new to any of them.
+func runProfiles(config AppConfig, scraped []Appointment, missed fetchGaps, opts RenderOptions, now time.Time) []Appointment {
+	var newAppointments []Appointment
+	for _, p := range selectedProfiles(config) {
+		var relevant []Appointment
+		for _, appt := range scraped {
+			if p.matches(appt, config, now) {
+				relevant = append(relevant, appt)
+			}
+		}
+		slog.Info("Profile slots match", "profile", p.Name, "matched", len(relevant), "total", len(scraped))
+
+		watchConfig := p.configFor(config)
+		if err := createNamespaceDirs(watchConfig); err != nil {
+			slog.Error("Error running profile", "profile", p.Name, "err", err)
+			continue
+		}
+		found, _, err := runWatch(watchConfig, "", relevant, missed, opts)
+		if err != nil {
+			slog.Error("Error running profile", "profile", p.Name, "err", err)
+			continue
+		}
+		newAppointments = append(newAppointments, found...)
+	}
+	return newAppointments
+}
@@ -0,0 +1,123 @@
+package melanzana
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestValidateProfiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		profiles []Profile
+		selected string
+		wantErr  bool
+	}{
+		{"Valid", []Profile{{Name: "me", Weekdays: []string{"sat"}}, {Name: "partner"}}, "me", false},
+		{"All", []Profile{{Name: "me"}}, "all", false},
+		{"NoneSelected", []Profile{{Name: "me"}}, "", false},
+		{"Unknown", []Profile{{Name: "me"}}, "partner", true},
+		{"ReservedName", []Profile{{Name: "all"}}, "", true},
+		{"BadName", []Profile{{Name: "me/you"}}, "", true},
+		{"BadWeekday", []Profile{{Name: "me", Weekdays: []string{"xx"}}}, "", true},
+		{"Duplicate", []Profile{{Name: "me"}, {Name: "me"}}, "", true},
+		{"NoProfiles", nil, "me", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateProfiles(tt.profiles, tt.selected); (err != nil) != tt.wantErr {
+				t.Errorf("validateProfiles() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFetchMonths(t *testing.T) {
+	config := AppConfig{
+		MonthsLookahead: 3,
+		Profiles:        []Profile{{Name: "me", MonthsLookahead: 1}, {Name: "partner", MonthsLookahead: 6}, {Name: "kids"}},
+	}
+
+	for profile, want := range map[string]int{"": 3, "me": 1, "partner": 6, "kids": 3, "all": 6} {
+		config.Profile = profile
+		if got := fetchMonths(config); got != want {
+			t.Errorf("fetchMonths() with profile %q = %d, want %d", profile, got, want)
+		}
+	}
+	config.Profile = ""
+	fixClock(t, time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC))
+	config.NotAfter = "2026-03-01"
+	if got := fetchMonths(config); got != 13 {
+		t.Errorf("fetchMonths() with notAfter in March next year = %d, want 13", got)
+	}
+}
+
+func TestProfileMatches(t *testing.T) {
+	p := Profile{Name: "me", MonthsLookahead: 2, Weekdays: []string{"Sat"}, MinSpaces: 2}
+	now := time.Date(2099, 7, 20, 12, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name string
+		appt Appointment
+		want bool
+	}{
+		{"ThisMonth", Appointment{Date: "2099-07-25", Spaces: 2}, true},
+		{"LastMonthWatched", Appointment{Date: "2099-08-29", Spaces: 2}, true},
+		{"BeyondLookahead", Appointment{Date: "2099-09-05", Spaces: 2}, false},
+		{"WrongWeekday", Appointment{Date: "2099-07-24", Spaces: 2}, false},
+		{"TooFewSpaces", Appointment{Date: "2099-07-25", Spaces: 1}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.matches(tt.appt, AppConfig{MonthsLookahead: 6}, now); got != tt.want {
+				t.Errorf("matches(%+v) = %v, want %v", tt.appt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunProfiles(t *testing.T) {
+	dir := t.TempDir()
+	config := AppConfig{
+		DryRun:          true, // print instead of sending, but still write state
+		FromEmail:       "from@example.com",
+		ToEmails:        []string{"shared@example.com"},
+		MonthsLookahead: 3,
+		DataFile:        filepath.Join(dir, "seen.json"),
+		HistoryFile:     filepath.Join(dir, "history.jsonl"),
+		StoreSpoolFile:  filepath.Join(dir, "spool.json"),
+		Profiles: []Profile{
+			{Name: "me", Weekdays: []string{"Sat"}, ToEmails: []string{"me@example.com"}},
+			{Name: "partner", MonthsLookahead: 1},
+		},
+	}
+	scraped := []Appointment{
+		{Date: "2099-07-25", Time: "10:00 am – 10:30 am", Spaces: 1}, // Saturday
+		{Date: "2099-08-03", Time: "10:00 am – 10:30 am", Spaces: 1}, // Monday, next month
+	}
+	now := time.Date(2099, 7, 20, 12, 0, 0, 0, time.Local)
+
+	config.Profile = "all"
+	if found := runProfiles(config, scraped, nil, RenderOptions{}, now); len(found) != 2 {
+		t.Fatalf("runProfiles(all) found %d new appointments, want 2 (1 for each profile)", len(found))
+	}
+	for name, want := range map[string]int{"me": 1, "partner": 1} {
+		seen, err := loadSeenAppointments(filepath.Join(dir, "profiles", name, "seen.json"), nil)
+		if err != nil || len(seen) != want {
+			t.Errorf("%s seen state = %d appointments (err %v), want %d", name, len(seen), err, want)
+		}
+	}
+
+	// Running one profile on its own uses the same state as running them all.
+	config.Profile = "me"
+	if found := runProfiles(config, scraped, nil, RenderOptions{}, now); len(found) != 0 {
+		t.Errorf("runProfiles(me) after runProfiles(all) found %d, want 0", len(found))
+	}
+
+	if got := (Profile{Name: "me", ToEmails: []string{"me@example.com"}}).configFor(config); got.ToEmails[0] != "me@example.com" || got.RecipientsFile != "" {
+		t.Errorf("configFor() recipients = %v %q, want only me@example.com", got.ToEmails, got.RecipientsFile)
+	}
+	if got := (Profile{Name: "partner"}).configFor(config); got.ToEmails[0] != "shared@example.com" {
+		t.Errorf("configFor() without recipients = %v, want the top-level toEmails", got.ToEmails)
+	}
+}
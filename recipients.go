@@ -0,0 +1,332 @@
+package melanzana
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pashbylogan/melanzana/pkg/filter"
+)
+
+// Recipient is someone notified about slots, by email, text message,
+// Telegram or webhook, with optional personal preferences. Recipients come from
+// toEmails, the recipients file and the configured subscribers.
+type Recipient struct {
+	Name             string     `json:"name,omitempty"`
+	Email            string     `json:"email,omitempty"`
+	Phone            string     `json:"phone,omitempty"`     // texted through the sms settings, e.g. "+15551234567"
+	Webhook          string     `json:"webhook,omitempty"`   // URL notifications are POSTed to as JSON
+	Telegram         string     `json:"telegram,omitempty"`  // Telegram chat ID messaged by the bot, e.g. "123456789"
+	Weekdays         []string   `json:"weekdays,omitempty"`  // e.g. ["Sat", "Sun"]; empty means every day
+	MinSpaces        int        `json:"minSpaces,omitempty"` // only slots with at least this many spaces
+	Calendars        []string   `json:"calendars,omitempty"` // names from the config's calendars; empty means every calendar
+	From             string     `json:"from,omitempty"`      // first slot date wanted, as YYYY-MM-DD; empty means from today
+	To               string     `json:"to,omitempty"`        // last slot date wanted; empty means no limit
+	UnsubscribeToken string     `json:"unsubscribeToken,omitempty"`
+	PausedUntil      *time.Time `json:"pausedUntil,omitempty"` // no notifications before this time, set by emailing "pause"
+
+	compiled *filter.Slots // preferences checked and compiled by compile
+}
+
+// matches reports whether appt passes the recipient's personal filter.
+func (r Recipient) matches(appt Appointment) bool {
+	return r.filter().Match(appt)
+}
+
+func (r Recipient) filter() filter.Slots {
+	if r.compiled != nil {
+		return *r.compiled
+	}
+	f := filter.New(r.Weekdays, r.MinSpaces, r.Calendars)
+	if dated, err := f.Within(r.From, r.To); err == nil {
+		f = dated
+	}
+	return f
+}
+
+// label names the recipient in logs: by name, else by an address.
+func (r Recipient) label() string {
+	for _, s := range []string{r.Name, r.Email, r.Phone, r.Webhook, r.Telegram} {
+		if s != "" {
+			return s
+		}
+	}
+	return "(no address)"
+}
+
+// compile checks the recipient's preferences and keeps them in the form
+// evaluated per slot, so they aren't parsed again on every cycle.
+func (r *Recipient) compile() error {
+	f, err := filter.Compile(r.Weekdays, r.MinSpaces, r.Calendars)
+	if err == nil {
+		f, err = f.Within(r.From, r.To)
+	}
+	if err != nil {
+		return fmt.Errorf("recipient %s: %w", r.label(), err)
+	}
+	r.compiled = &f
+	return nil
+}
+
+// cachedRecipients is a recipients file as last loaded, with the
+// modification time and size that identify that version of it.
+type cachedRecipients struct {
+	modTime    time.Time
+	size       int64
+	recipients []Recipient
+}
+
+var (
+	recipientsCacheMu sync.Mutex
+	recipientsCache   = make(map[string]cachedRecipients)
+)
+
+// loadRecipients returns the recipients in the list file with their
+// preferences compiled. Entries with invalid preferences are skipped and
+// logged, so one bad entry doesn't stop everyone else's notifications. A
+// missing file is an empty list. The file is only read again once it has
+// changed; callers get their own copy of the list.
+func loadRecipients(path string) ([]Recipient, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read recipients file %s: %w", path, err)
+	}
+
+	recipientsCacheMu.Lock()
+	defer recipientsCacheMu.Unlock()
+	if cached, ok := recipientsCache[path]; ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return append([]Recipient(nil), cached.recipients...), nil
+	}
+
+	recipients, err := readRecipients(path)
+	if err != nil {
+		return nil, err
+	}
+	recipients, errs := compileRecipients(recipients)
+	for _, err := range errs {
+		slog.Error("Skipping recipient with invalid preferences", "file", path, "err", err)
+	}
+
+	recipientsCache[path] = cachedRecipients{modTime: info.ModTime(), size: info.Size(), recipients: recipients}
+	return append([]Recipient(nil), recipients...), nil
+}
+
+// compileRecipients compiles each recipient's preferences, returning the
+// recipients whose preferences are valid and an error for each of the rest.
+func compileRecipients(recipients []Recipient) ([]Recipient, []error) {
+	var valid []Recipient
+	var errs []error
+	for _, r := range recipients {
+		if err := r.compile(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		valid = append(valid, r)
+	}
+	return valid, errs
+}
+
+// readRecipients parses the recipients list file without checking
+// preferences. A missing file is an empty list.
+func readRecipients(path string) ([]Recipient, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read recipients file %s: %w", path, err)
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	var recipients []Recipient
+	if err := json.Unmarshal(data, &recipients); err != nil {
+		return nil, fmt.Errorf("failed to parse recipients file %s: %w", path, err)
+	}
+	return recipients, nil
+}
+
+// saveRecipients writes the recipients list file. Anyone who can read it
+// can unsubscribe every recipient, so it is kept private to the owner,
+// including when written before tokens were added.
+func saveRecipients(recipients []Recipient, path string) error {
+	data, err := json.MarshalIndent(recipients, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal recipients: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write recipients file %s: %w", path, err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		return fmt.Errorf("failed to restrict recipients file %s: %w", path, err)
+	}
+	return nil
+}
+
+// newUnsubscribeToken returns a random token that is hard to guess.
+func newUnsubscribeToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate unsubscribe token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ensureUnsubscribeTokens assigns tokens to recipients that don't have one,
+// reporting whether any were added.
+func ensureUnsubscribeTokens(recipients []Recipient) (bool, error) {
+	changed := false
+	for i := range recipients {
+		if recipients[i].UnsubscribeToken != "" {
+			continue
+		}
+		token, err := newUnsubscribeToken()
+		if err != nil {
+			return changed, err
+		}
+		recipients[i].UnsubscribeToken = token
+		changed = true
+	}
+	return changed, nil
+}
+
+// resolveRecipients combines the recipients file, subscribers and toEmails,
+// assigning unsubscribe tokens to file entries and persisting them unless
+// read-only. An email address listed more than once uses the entry listed
+// first, in that order.
+func resolveRecipients(config AppConfig) ([]Recipient, error) {
+	var recipients []Recipient
+	if config.RecipientsFile != "" {
+		fileRecipients, err := loadRecipients(config.RecipientsFile)
+		if err != nil {
+			return nil, err
+		}
+
+		changed, err := ensureUnsubscribeTokens(fileRecipients)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			if config.ReadOnly {
+				slog.Info("Read-only mode: not saving new unsubscribe tokens", "file", config.RecipientsFile)
+			} else if err := saveRecipients(fileRecipients, config.RecipientsFile); err != nil {
+				return nil, err
+			}
+		}
+		recipients = fileRecipients
+	}
+
+	listed := make(map[string]bool)
+	for _, r := range recipients {
+		listed[strings.ToLower(r.Email)] = true
+	}
+	for _, s := range config.Subscribers {
+		if s.Email != "" && listed[strings.ToLower(s.Email)] {
+			continue
+		}
+		if err := s.compile(); err != nil {
+			return nil, err
+		}
+		if s.Email != "" {
+			listed[strings.ToLower(s.Email)] = true
+		}
+		recipients = append(recipients, s)
+	}
+	for _, email := range config.ToEmails {
+		email = strings.TrimSpace(email)
+		if email == "" || listed[strings.ToLower(email)] {
+			continue
+		}
+		listed[strings.ToLower(email)] = true
+		recipients = append(recipients, Recipient{Email: email})
+	}
+	return recipients, nil
+}
+
+// unsubscribeRecipient removes the recipient holding token from the recipients
+// file and returns their address.
+func unsubscribeRecipient(path, token string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("unsubscribing requires a recipientsFile")
+	}
+	// Unsubscribing must work even if another entry has invalid preferences.
+	recipients, err := readRecipients(path)
+	if err != nil {
+		return "", err
+	}
+
+	for i, r := range recipients {
+		if r.UnsubscribeToken != "" && r.UnsubscribeToken == token {
+			recipients = append(recipients[:i], recipients[i+1:]...)
+			if err := saveRecipients(recipients, path); err != nil {
+				return "", err
+			}
+			return r.Email, nil
+		}
+	}
+	return "", fmt.Errorf("no recipient with unsubscribe token %q in %s", token, path)
+}
+
+// unsubscribeLine tells a recipient how to stop notifications, or returns ""
+// if the recipient has no token or nothing would act on it. Replies are
+// only read when imapServer is set.
+func unsubscribeLine(r Recipient, config AppConfig) string {
+	switch {
+	case r.UnsubscribeToken == "":
+		return ""
+	case config.UnsubscribeURL != "":
+		return "Unsubscribe: " + strings.ReplaceAll(config.UnsubscribeURL, "{token}", r.UnsubscribeToken)
+	case config.IMAPServer == "":
+		return ""
+	}
+	return fmt.Sprintf("To stop these emails, reply with the subject \"unsubscribe %s\".", r.UnsubscribeToken)
+}
+
+// personalize returns a copy of n containing only the appointments r wants,
+// with their unsubscribe instructions added to the footer.
+func (n Notification) personalize(r Recipient, config AppConfig) Notification {
+	return newPersonalizer(n).personalize(r, config)
+}
+
+// personalizer tailors one notification to each of many recipients. The
+// notification's slots are indexed once, and the buffers holding each
+// recipient's selection are reused, so a result is only valid until the
+// next call.
+type personalizer struct {
+	n                           Notification
+	appointments, removed       filter.Index
+	appointmentsBuf, removedBuf []Appointment
+	footerBuf                   []string
+}
+
+func newPersonalizer(n Notification) *personalizer {
+	return &personalizer{
+		n:            n,
+		appointments: filter.NewIndex(n.Appointments),
+		removed:      filter.NewIndex(n.Removed),
+	}
+}
+
+func (p *personalizer) personalize(r Recipient, config AppConfig) Notification {
+	slots := r.filter()
+	p.footerBuf = append(p.footerBuf[:0], p.n.Footer...)
+	if line := unsubscribeLine(r, config); line != "" {
+		p.footerBuf = append(p.footerBuf, line)
+	}
+
+	personal := p.n
+	personal.Appointments = slots.SelectFrom(p.appointments, &p.appointmentsBuf)
+	personal.Removed = slots.SelectFrom(p.removed, &p.removedBuf)
+	personal.Footer = p.footerBuf
+	return personal
+}
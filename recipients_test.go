@@ -0,0 +1,151 @@
+package melanzana
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecipientMatches(t *testing.T) {
+	saturday := Appointment{Date: "2024-06-15", Spaces: 2}
+	monday := Appointment{Date: "2024-06-17", Spaces: 4}
+
+	tests := []struct {
+		name      string
+		recipient Recipient
+		appt      Appointment
+		expected  bool
+	}{
+		{name: "No preferences", recipient: Recipient{}, appt: saturday, expected: true},
+		{name: "Weekday allowed", recipient: Recipient{Weekdays: []string{"Sat", "Sun"}}, appt: saturday, expected: true},
+		{name: "Weekday not allowed", recipient: Recipient{Weekdays: []string{"saturday"}}, appt: monday, expected: false},
+		{name: "Too few spaces", recipient: Recipient{MinSpaces: 3}, appt: saturday, expected: false},
+		{name: "Enough spaces", recipient: Recipient{MinSpaces: 3}, appt: monday, expected: true},
+		{name: "Calendar not watched", recipient: Recipient{Calendars: []string{"60 min"}}, appt: saturday, expected: false},
+		{name: "Before date window", recipient: Recipient{From: "2024-06-16"}, appt: saturday, expected: false},
+		{name: "In date window", recipient: Recipient{From: "2024-06-16", To: "2024-06-17"}, appt: monday, expected: true},
+		{name: "After date window", recipient: Recipient{To: "2024-06-14"}, appt: saturday, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.recipient.matches(tt.appt); got != tt.expected {
+				t.Errorf("matches() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestResolveRecipientsAndUnsubscribe(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recipients.json")
+	if err := saveRecipients([]Recipient{{Email: "a@example.com"}, {Email: "b@example.com", MinSpaces: 2}}, path); err != nil {
+		t.Fatalf("saveRecipients() error = %v", err)
+	}
+	if info, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0600 {
+		t.Errorf("recipients file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	config := AppConfig{
+		RecipientsFile: path,
+		ToEmails:       []string{"B@example.com", "c@example.com"},
+	}
+	recipients, err := resolveRecipients(config)
+	if err != nil {
+		t.Fatalf("resolveRecipients() error = %v", err)
+	}
+	if len(recipients) != 3 {
+		t.Fatalf("resolveRecipients() = %+v, want 3 recipients", recipients)
+	}
+	if recipients[0].UnsubscribeToken == "" || recipients[2].UnsubscribeToken != "" {
+		t.Errorf("tokens = %q, %q; want file entry with token and toEmails entry without", recipients[0].UnsubscribeToken, recipients[2].UnsubscribeToken)
+	}
+
+	// Tokens were persisted, so unsubscribing by token removes the entry.
+	email, err := unsubscribeRecipient(path, recipients[0].UnsubscribeToken)
+	if err != nil || email != "a@example.com" {
+		t.Fatalf("unsubscribeRecipient() = %q, %v; want a@example.com", email, err)
+	}
+	remaining, err := loadRecipients(path)
+	if err != nil || len(remaining) != 1 || remaining[0].Email != "b@example.com" {
+		t.Errorf("loadRecipients() after unsubscribe = %+v, %v", remaining, err)
+	}
+
+	if _, err := unsubscribeRecipient(path, "unknown"); err == nil {
+		t.Errorf("unsubscribeRecipient() with unknown token error = nil, want error")
+	}
+}
+
+func TestNotificationPersonalize(t *testing.T) {
+	n := Notification{
+		Subject: "Subject",
+		Appointments: []Appointment{
+			{Date: "2024-06-15", Spaces: 1},
+			{Date: "2024-06-16", Spaces: 3},
+		},
+		Footer: []string{"shared"},
+	}
+	r := Recipient{Email: "a@example.com", MinSpaces: 2, UnsubscribeToken: "tok"}
+
+	personal := n.personalize(r, AppConfig{UnsubscribeURL: "https://example.com/unsub?t={token}"})
+
+	if len(personal.Appointments) != 1 || personal.Appointments[0].Date != "2024-06-16" {
+		t.Errorf("personalize() appointments = %+v, want only 2024-06-16", personal.Appointments)
+	}
+	if len(personal.Footer) != 2 || !strings.Contains(personal.Footer[1], "https://example.com/unsub?t=tok") {
+		t.Errorf("personalize() footer = %q, want unsubscribe link", personal.Footer)
+	}
+	if len(n.Footer) != 1 {
+		t.Errorf("personalize() modified the shared footer: %q", n.Footer)
+	}
+
+	// Reply instructions are given only when replies are read.
+	if line := unsubscribeLine(r, AppConfig{}); line != "" {
+		t.Errorf("unsubscribeLine() without imapServer = %q, want none", line)
+	}
+	if line := unsubscribeLine(r, AppConfig{IMAPServer: "imap.example.com:993"}); !strings.Contains(line, "unsubscribe tok") {
+		t.Errorf("unsubscribeLine() with imapServer = %q, want reply instructions", line)
+	}
+}
+
+func TestLoadRecipientsCompilesPreferences(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recipients.json")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`[{"email": "a@example.com", "weekdays": ["Sat"]}]`)
+	recipients, err := loadRecipients(path)
+	if err != nil {
+		t.Fatalf("loadRecipients() error = %v", err)
+	}
+	if len(recipients) != 1 || recipients[0].compiled == nil {
+		t.Fatalf("loadRecipients() = %+v, want one recipient with compiled preferences", recipients)
+	}
+
+	// An edited file is picked up on the next load, and entries with invalid
+	// preferences are skipped while the others are still notified.
+	write(`[{"email": "a@example.com", "weekdays": ["Stu"], "unsubscribeToken": "tok"}, {"email": "b@example.com", "minSpaces": -1}, {"email": "c@example.com"}]`)
+	recipients, err = loadRecipients(path)
+	if err != nil || len(recipients) != 1 || recipients[0].Email != "c@example.com" {
+		t.Fatalf("loadRecipients() with invalid preferences = %+v, %v; want only c@example.com", recipients, err)
+	}
+
+	// Validating the config names each invalid entry.
+	problems := configProblems(AppConfig{FromEmail: "from@example.com", RecipientsFile: path})
+	for _, want := range []string{"a@example.com", `"Stu"`, "b@example.com", "minSpaces"} {
+		if !strings.Contains(strings.Join(problems, "\n"), want) {
+			t.Errorf("configProblems() = %q, want it to mention %s", problems, want)
+		}
+	}
+
+	// Recipients can still unsubscribe while the file is invalid.
+	if email, err := unsubscribeRecipient(path, "tok"); err != nil || email != "a@example.com" {
+		t.Errorf("unsubscribeRecipient() = %q, %v; want a@example.com", email, err)
+	}
+}
@@ -0,0 +1,184 @@
+package melanzana
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// replaySnapshotFormat names a snapshot directory after the UTC time it was
+// recorded at, e.g. 20250701T080000Z.
+const replaySnapshotFormat = "20060102T150405Z"
+
+// replayEmptyMonth is served for a month a snapshot has no file for.
+const replayEmptyMonth = `{"long": [], "no_availability_in_futur": false}`
+
+// replaySnapshot is one recorded check: the Cowlendar responses served as
+// if it were At.
+type replaySnapshot struct {
+	At  time.Time
+	Dir string
+}
+
+// loadReplaySnapshots lists the snapshot directories in dir, oldest first.
+func loadReplaySnapshots(dir string) ([]replaySnapshot, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read responses: %w", err)
+	}
+	var snapshots []replaySnapshot
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		at, err := time.Parse(replaySnapshotFormat, e.Name())
+		if err != nil {
+			return nil, fmt.Errorf("snapshot directory %q isn't named after its time, like 20250701T080000Z", e.Name())
+		}
+		snapshots = append(snapshots, replaySnapshot{At: at, Dir: filepath.Join(dir, e.Name())})
+	}
+	if len(snapshots) == 0 {
+		return nil, fmt.Errorf("no snapshot directories in %s", dir)
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].At.Before(snapshots[j].At) })
+	return snapshots, nil
+}
+
+// replayTransport answers Cowlendar availability requests from a snapshot:
+// <calendarId>/YYYY-MM.json if present, else YYYY-MM.json, else a month
+// without slots. Responses are the raw API bodies, so they go through the
+// same decoding and schema checks as live ones.
+type replayTransport struct {
+	snapshot *replaySnapshot
+}
+
+func (t replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	calendarID := path.Base(path.Dir(req.URL.Path))
+	year, _ := strconv.Atoi(req.URL.Query().Get("year"))
+	month, _ := strconv.Atoi(req.URL.Query().Get("month"))
+	name := fmt.Sprintf("%04d-%02d.json", year, month)
+
+	body := []byte(replayEmptyMonth)
+	for _, file := range []string{filepath.Join(t.snapshot.Dir, calendarID, name), filepath.Join(t.snapshot.Dir, name)} {
+		data, err := os.ReadFile(file)
+		if err == nil {
+			body = data
+			break
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+// replayConfig adapts config for a replay: notifications are printed rather
+// than sent, state is kept in stateDir, and nothing outside it is written
+// or contacted.
+func replayConfig(config AppConfig, stateDir string) AppConfig {
+	config.DryRun, config.ReadOnly = true, false
+	config.PollIntervalMinutes = 0
+	config.StateStore, config.StateCodecs, config.StateCodecsByStore = "file", nil, nil
+	config.DataFile = filepath.Join(stateDir, "seen.json")
+	config.HistoryFile = filepath.Join(stateDir, "history.jsonl")
+	config.SnapshotFile = filepath.Join(stateDir, "snapshot.json")
+	config.StoreSpoolFile = filepath.Join(stateDir, "spool.jsonl")
+	config.BurstStateFile = filepath.Join(stateDir, "burst_state.json")
+	config.BookingWindowFile = filepath.Join(stateDir, "booking_window.json")
+	config.NotifyJournalFile = filepath.Join(stateDir, "notify_journal.jsonl")
+	config.SubscribersFile = filepath.Join(stateDir, "subscribers.json")
+	config.CampaignStateFile = filepath.Join(stateDir, "campaign_state.json")
+	config.AvailabilityCacheSeconds, config.ProbeDelaySeconds = 0, 0
+	config.RequestsPerSecond = 0 // Nothing is sent, so there is no one to pace requests for
+	config.HTMLFallbackURL = ""
+	config.Features.AutoBook = false
+	config.AutoBooking.StateFile = filepath.Join(stateDir, "autobook_state.json")
+	config.PollExperiment = PollExperimentConfig{}
+	config.HeartbeatURL, config.AlertEmail, config.ICSFile, config.SummaryFile = "", "", "", ""
+	config.AlertPhone, config.AlertTelegram, config.AlertWebhook = "", "", ""
+	return config
+}
+
+// runReplayCommand implements "melanzana replay": it runs the full pipeline
+// once per recorded snapshot, with the clock set to the snapshot's time.
+func runReplayCommand(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	responses := fs.String("responses", "", "Directory of snapshot directories of recorded Cowlendar responses")
+	config, _, err := parseConfig(fs, args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if *responses == "" {
+		fmt.Fprintln(os.Stderr, "usage: melanzana replay -responses <dir> [flags]")
+		return 2
+	}
+	snapshots, err := loadReplaySnapshots(*responses)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := setupLogging(config); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := resolveSecrets(&config); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to resolve secrets: %v\n", err)
+		return 1
+	}
+
+	stateDir, err := os.MkdirTemp("", "melanzana-replay")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer os.RemoveAll(stateDir)
+	if config.RecipientsFile != "" {
+		// Recipients gain unsubscribe tokens when used; keep those in the copy.
+		data, err := os.ReadFile(config.RecipientsFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		config.RecipientsFile = filepath.Join(stateDir, "recipients.json")
+		if err := os.WriteFile(config.RecipientsFile, data, 0600); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	config = replayConfig(config, stateDir)
+
+	current := &replaySnapshot{}
+	defer func(saved http.RoundTripper) { apiTransport = saved }(apiTransport)
+	apiTransport = replayTransport{current}
+	setupScraper(config)
+	frozen := newFrozenClock(time.Time{})
+	defer func(saved Clock) { clock = saved }(clock)
+	clock = frozen
+
+	code := exitOK
+	for _, s := range snapshots {
+		*current = s
+		frozen.set(s.At)
+		slog.Info("Replaying snapshot", "at", s.At, "dir", s.Dir)
+		if c := runCycle(config); c != exitOK && code == exitOK {
+			code = c
+		}
+		followUps.drain()
+	}
+	return code
+}
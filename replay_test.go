@@ -0,0 +1,67 @@
+package melanzana
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pashbylogan/melanzana/pkg/cowlendar"
+)
+
+func TestReplayCommand(t *testing.T) {
+	defer func(client *http.Client, source Source, tz, booking, slot string, cals []Calendar, cache *cowlendar.AvailabilityService, logger *slog.Logger) {
+		apiClient, appointmentSource, availabilityCache = client, source, cache
+		sourceTimezone, bookingURL, slotBookingURL, calendars = tz, booking, slot, cals
+		slog.SetDefault(logger)
+	}(apiClient, appointmentSource, sourceTimezone, bookingURL, slotBookingURL, calendars, availabilityCache, slog.Default())
+
+	dir := t.TempDir()
+	slot := func(start, end string) string {
+		return `{"slot_start": "` + start + `", "slot_end": "` + end + `", "is_bookable": true, "qty_left": 1}`
+	}
+	snapshots := map[string]string{
+		"20250701T080000Z/2025-07.json": `{"long": [` + slot("2025-07-14 10:00", "2025-07-14 10:30") + `]}`,
+		"20250701T090000Z/2025-07.json": `{"long": [` + slot("2025-07-14 10:00", "2025-07-14 10:30") + `]}`,
+		"20250701T100000Z/2025-08.json": `{"long": [` + slot("2025-08-04 09:00", "2025-08-04 09:30") + `]}`,
+	}
+	for name, body := range snapshots {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	code := runReplayCommand([]string{"-responses", dir, "-toEmails", "me@example.com", "-fromEmail", "melanzana@example.com",
+		"-timezone", "America/Denver", "-months", "2", "-logLevel", "error"})
+	os.Stdout = stdout
+	w.Close()
+	out, _ := io.ReadAll(r)
+
+	if code != exitOK {
+		t.Errorf("replay exit code = %d, want %d", code, exitOK)
+	}
+	emails := strings.Split(string(out), "===== Email to ")[1:]
+	if len(emails) != 2 {
+		t.Fatalf("replay printed %d emails, want 2, one per snapshot with a new slot:\n%s", len(emails), out)
+	}
+	if !strings.Contains(emails[0], "2025-07-14") || strings.Contains(emails[1], "2025-07-14") || !strings.Contains(emails[1], "2025-08-04") {
+		t.Errorf("replay emails don't each announce their snapshot's new slot:\n%s", out)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "seen.json")); !os.IsNotExist(err) {
+		t.Errorf("replay wrote state next to the responses")
+	}
+}
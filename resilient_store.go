@@ -0,0 +1,317 @@
+package melanzana
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/pashbylogan/melanzana/pkg/store"
+)
+
+// Spooled store operations.
+const (
+	opSave     = "save"
+	opMarkSeen = "markSeen"
+	opPrune    = "prune"
+	opHistory  = "history"
+)
+
+// spooledMutation is a store change that couldn't be persisted and is waiting
+// to be replayed.
+type spooledMutation struct {
+	Op           string              `json:"op"`
+	Appointments []Appointment       `json:"appointments,omitempty"`
+	Before       time.Time           `json:"before,omitempty"`
+	Events       []AvailabilityEvent `json:"events,omitempty"`
+	QueuedAt     time.Time           `json:"queuedAt"`
+}
+
+// resilientStore wraps a Store so that a temporarily unreachable backend
+// doesn't lose a cycle's knowledge. Operations are retried according to the
+// storage retry policy; mutations that still fail are queued in a local spool file and
+// replayed, in order, before the next mutation. Loads see queued mutations
+// applied in memory. The operator is alerted once per run on failure.
+type resilientStore struct {
+	inner     Store
+	spoolPath string
+	codec     Codec // Optional compression or encryption of the spool, as of the store's files
+	policy    RetryPolicy
+	sleep     func(time.Duration)
+	alert     func(error)
+	alerted   bool
+}
+
+func newResilientStore(inner Store, spoolPath string, policy RetryPolicy, alert func(error)) *resilientStore {
+	return &resilientStore{
+		inner:     inner,
+		spoolPath: spoolPath,
+		policy:    policy,
+		sleep:     clockSleep,
+		alert:     alert,
+	}
+}
+
+// Load returns the stored appointments with any queued mutations applied. If
+// the backend is unreachable it falls back to the queued mutations alone so
+// scraping can continue.
+func (s *resilientStore) Load() ([]Appointment, error) {
+	pending, err := loadSpool(s.spoolPath, s.codec)
+	if err != nil {
+		return nil, err
+	}
+
+	var seen []Appointment
+	err = s.retry("load", func() error {
+		var err error
+		seen, err = s.inner.Load()
+		return err
+	})
+	if err != nil {
+		s.raise(err)
+		seen = []Appointment{}
+	}
+	return applyMutations(seen, pending), nil
+}
+
+func (s *resilientStore) Save(appointments []Appointment) error {
+	return s.mutate(spooledMutation{Op: opSave, Appointments: appointments})
+}
+
+func (s *resilientStore) MarkSeen(appointments []Appointment) error {
+	return s.mutate(spooledMutation{Op: opMarkSeen, Appointments: appointments})
+}
+
+func (s *resilientStore) Prune(before time.Time) (int, error) {
+	var removed int
+	m := spooledMutation{Op: opPrune, Before: before}
+	err := s.flush()
+	if err == nil {
+		err = s.retry(m.Op, func() error {
+			var err error
+			removed, err = s.inner.Prune(before)
+			return err
+		})
+	}
+	if err != nil {
+		return 0, s.enqueue(m, err)
+	}
+	return removed, nil
+}
+
+// History returns the recorded history followed by queued events. If the
+// backend is unreachable it fails: the queued events alone would replay to
+// a calendar in which every open slot had just appeared.
+func (s *resilientStore) History() ([]AvailabilityEvent, error) {
+	pending, err := loadSpool(s.spoolPath, s.codec)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []AvailabilityEvent
+	err = s.retry("history", func() error {
+		var err error
+		events, err = s.inner.History()
+		return err
+	})
+	if err != nil {
+		s.raise(err)
+		return nil, err
+	}
+	for _, m := range pending {
+		if m.Op == opHistory {
+			events = append(events, m.Events...)
+		}
+	}
+	return events, nil
+}
+
+func (s *resilientStore) AppendHistory(events []AvailabilityEvent) error {
+	return s.mutate(spooledMutation{Op: opHistory, Events: events})
+}
+
+// Subscribers and UpdateSubscribers are retried but not spooled: they serve
+// API requests, which can report the failure instead.
+func (s *resilientStore) Subscribers() ([]json.RawMessage, error) {
+	var subscribers []json.RawMessage
+	err := s.retry("subscribers", func() error {
+		var err error
+		subscribers, err = s.inner.Subscribers()
+		return err
+	})
+	return subscribers, err
+}
+
+func (s *resilientStore) UpdateSubscribers(change func([]json.RawMessage) ([]json.RawMessage, error)) error {
+	return s.retry("update subscribers", func() error { return s.inner.UpdateSubscribers(change) })
+}
+
+// Snapshot and UpdateSnapshot are retried but not spooled: a snapshot that
+// couldn't be saved is replaced by the next check's.
+func (s *resilientStore) Snapshot() (*AvailabilitySnapshot, error) {
+	var snapshot *AvailabilitySnapshot
+	err := s.retry("snapshot", func() error {
+		var err error
+		snapshot, err = s.inner.Snapshot()
+		return err
+	})
+	return snapshot, err
+}
+
+func (s *resilientStore) UpdateSnapshot(change func(*AvailabilitySnapshot) (*AvailabilitySnapshot, error)) error {
+	return s.retry("update snapshot", func() error { return s.inner.UpdateSnapshot(change) })
+}
+
+// mutate replays any queued mutations and then applies m, queueing m if
+// either step fails so mutations always reach the backend in order.
+func (s *resilientStore) mutate(m spooledMutation) error {
+	err := s.flush()
+	if err == nil {
+		err = s.retry(m.Op, func() error { return s.apply(m) })
+	}
+	if err != nil {
+		return s.enqueue(m, err)
+	}
+	return nil
+}
+
+func (s *resilientStore) apply(m spooledMutation) error {
+	switch m.Op {
+	case opSave:
+		return s.inner.Save(m.Appointments)
+	case opMarkSeen:
+		return s.inner.MarkSeen(m.Appointments)
+	case opPrune:
+		_, err := s.inner.Prune(m.Before)
+		return err
+	case opHistory:
+		return s.inner.AppendHistory(m.Events)
+	default:
+		return fmt.Errorf("unknown store operation %q", m.Op)
+	}
+}
+
+// flush replays queued mutations. Mutations that fail stay queued.
+func (s *resilientStore) flush() error {
+	pending, err := loadSpool(s.spoolPath, s.codec)
+	if err != nil || len(pending) == 0 {
+		return err
+	}
+
+	for i, m := range pending {
+		if err := s.retry("replay "+m.Op, func() error { return s.apply(m) }); err != nil {
+			if saveErr := saveSpool(pending[i:], s.spoolPath, s.codec); saveErr != nil {
+				return fmt.Errorf("%w (and failed to update spool: %v)", err, saveErr)
+			}
+			return err
+		}
+	}
+
+	if err := os.Remove(s.spoolPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to clear store spool %s: %w", s.spoolPath, err)
+	}
+	slog.Info("Replayed queued store changes", "count", len(pending), "file", s.spoolPath)
+	return nil
+}
+
+// enqueue adds m to the spool after the backend failed with cause.
+func (s *resilientStore) enqueue(m spooledMutation, cause error) error {
+	s.raise(cause)
+
+	pending, err := loadSpool(s.spoolPath, s.codec)
+	if err != nil {
+		return fmt.Errorf("%w (and failed to queue change: %v)", cause, err)
+	}
+	m.QueuedAt = clock.Now()
+	if err := saveSpool(append(pending, m), s.spoolPath, s.codec); err != nil {
+		return fmt.Errorf("%w (and failed to queue change: %v)", cause, err)
+	}
+	slog.Warn("Queued store change for replay when the store recovers", "op", m.Op, "file", s.spoolPath)
+	return nil
+}
+
+func (s *resilientStore) retry(op string, fn func() error) error {
+	if err := s.policy.do("Store "+op, s.sleep, fn); err != nil {
+		return fmt.Errorf("%w: %w", errStore, err)
+	}
+	return nil
+}
+
+func (s *resilientStore) raise(err error) {
+	session.StoreErrors++
+	if s.alerted || s.alert == nil {
+		return
+	}
+	s.alerted = true
+	s.alert(err)
+}
+
+// applyMutations returns seen with the queued mutations applied in order.
+func applyMutations(seen []Appointment, pending []spooledMutation) []Appointment {
+	for _, m := range pending {
+		switch m.Op {
+		case opSave:
+			seen = append([]Appointment{}, m.Appointments...)
+		case opMarkSeen:
+			seen = store.MergeSeen(seen, m.Appointments)
+		case opPrune:
+			seen = store.PruneBefore(seen, m.Before)
+		}
+	}
+	return seen
+}
+
+// loadSpool reads queued mutations from path, decoded with codec if set,
+// returning none if the file doesn't exist.
+func loadSpool(path string, codec Codec) ([]spooledMutation, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read store spool %s: %w", path, err)
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	if codec != nil {
+		if data, err = codec.Decode(data); err != nil {
+			return nil, fmt.Errorf("failed to decode store spool %s: %w", path, err)
+		}
+	}
+	var pending []spooledMutation
+	if err := json.Unmarshal(data, &pending); err != nil {
+		return nil, fmt.Errorf("failed to parse store spool %s: %w", path, err)
+	}
+	return pending, nil
+}
+
+// saveSpool writes queued mutations to path, encoded with codec if set.
+func saveSpool(pending []spooledMutation, path string, codec Codec) error {
+	data, err := json.MarshalIndent(pending, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal store spool: %w", err)
+	}
+	if codec != nil {
+		if data, err = codec.Encode(data); err != nil {
+			return fmt.Errorf("failed to encode store spool: %w", err)
+		}
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write store spool %s: %w", path, err)
+	}
+	return nil
+}
+
+// storeAlert returns the function used to tell the operator that the store is
+// unavailable: a log line, plus an alert on the operator's channels if any
+// are configured.
+func storeAlert(config AppConfig) func(error) {
+	return func(err error) {
+		slog.Error("ALERT: state store unavailable, continuing with queued changes", "file", config.StoreSpoolFile, "err", err)
+		body := fmt.Sprintf("The Melanzana scraper could not reach its state store:\n\n%v\n\n"+
+			"Scraping continues and changes are queued in %s until the store recovers.", err, config.StoreSpoolFile)
+		sendAlert(config, "Melanzana scraper: state store unavailable", body)
+	}
+}
@@ -0,0 +1,162 @@
+package melanzana
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"encoding/json"
+	"github.com/pashbylogan/melanzana/pkg/store"
+)
+
+// flakyStore is an in-memory Store that fails while down is set.
+type flakyStore struct {
+	seen    []Appointment
+	history []AvailabilityEvent
+	down    bool
+}
+
+var errStoreDown = errors.New("store unreachable")
+
+func (f *flakyStore) Load() ([]Appointment, error) {
+	if f.down {
+		return nil, errStoreDown
+	}
+	return append([]Appointment{}, f.seen...), nil
+}
+
+func (f *flakyStore) Save(appointments []Appointment) error {
+	if f.down {
+		return errStoreDown
+	}
+	f.seen = append([]Appointment{}, appointments...)
+	return nil
+}
+
+func (f *flakyStore) MarkSeen(appointments []Appointment) error {
+	if f.down {
+		return errStoreDown
+	}
+	f.seen = append(f.seen, appointments...)
+	return nil
+}
+
+func (f *flakyStore) Prune(before time.Time) (int, error) {
+	if f.down {
+		return 0, errStoreDown
+	}
+	kept := store.PruneBefore(f.seen, before)
+	removed := len(f.seen) - len(kept)
+	f.seen = kept
+	return removed, nil
+}
+
+func (f *flakyStore) History() ([]AvailabilityEvent, error) {
+	if f.down {
+		return nil, errStoreDown
+	}
+	return append([]AvailabilityEvent{}, f.history...), nil
+}
+
+func (f *flakyStore) AppendHistory(events []AvailabilityEvent) error {
+	if f.down {
+		return errStoreDown
+	}
+	f.history = append(f.history, events...)
+	return nil
+}
+
+func (f *flakyStore) Subscribers() ([]json.RawMessage, error) {
+	return nil, nil
+}
+
+func (f *flakyStore) UpdateSubscribers(change func([]json.RawMessage) ([]json.RawMessage, error)) error {
+	return errStoreDown
+}
+
+func (f *flakyStore) Snapshot() (*AvailabilitySnapshot, error) {
+	return nil, nil
+}
+
+func (f *flakyStore) UpdateSnapshot(change func(*AvailabilitySnapshot) (*AvailabilitySnapshot, error)) error {
+	return errStoreDown
+}
+
+func TestResilientStore(t *testing.T) {
+	a := Appointment{Date: "2024-05-14", Time: "10:00 am – 10:30 am", Spaces: 1}
+	b := Appointment{Date: "2024-05-16", Time: "10:00 am – 10:30 am", Spaces: 1}
+
+	inner := &flakyStore{seen: []Appointment{a}, down: true}
+	var alerts int
+	var sleeps []time.Duration
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelayMillis: 1000}
+	store := newResilientStore(inner, filepath.Join(t.TempDir(), "spool.json"), policy, func(error) { alerts++ })
+	store.sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+
+	// While the backend is down, changes are queued and visible to Load.
+	if err := store.MarkSeen([]Appointment{b}); err != nil {
+		t.Fatalf("MarkSeen() while down error = %v, want nil", err)
+	}
+	if want := []time.Duration{time.Second, 2 * time.Second}; !reflect.DeepEqual(sleeps, want) {
+		t.Errorf("retry backoff = %v, want %v", sleeps, want)
+	}
+	if _, err := store.Prune(time.Date(2024, 5, 15, 0, 0, 0, 0, sourceLocation())); err != nil {
+		t.Fatalf("Prune() while down error = %v, want nil", err)
+	}
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load() while down error = %v, want nil", err)
+	}
+	if !reflect.DeepEqual(loaded, []Appointment{b}) {
+		t.Errorf("Load() while down = %v, want only the queued appointment", loaded)
+	}
+	if alerts != 1 {
+		t.Errorf("alerts = %d, want 1 per run", alerts)
+	}
+	if err := store.AppendHistory([]AvailabilityEvent{{Kind: eventAppeared, Date: b.Date, Time: b.Time}}); err != nil {
+		t.Fatalf("AppendHistory() while down error = %v, want nil", err)
+	}
+	if history, err := store.History(); !errors.Is(err, errStore) {
+		t.Errorf("History() while down = %v, %v; want an errStore rather than only the queued events", history, err)
+	}
+	if changes, err := checkChanges(AppConfig{}, store, []Appointment{a, b}, nil, time.Now()); err == nil || len(changes) != 0 {
+		t.Errorf("checkChanges() while down = %v, %v; want an error and no changes", changes, err)
+	}
+
+	// Once the backend recovers, queued changes are replayed in order.
+	inner.down = false
+	if err := store.MarkSeen(nil); err != nil {
+		t.Fatalf("MarkSeen() after recovery error = %v", err)
+	}
+	if !reflect.DeepEqual(inner.seen, []Appointment{b}) {
+		t.Errorf("backend after replay = %v, want %v", inner.seen, []Appointment{b})
+	}
+	pending, err := loadSpool(store.spoolPath, nil)
+	if err != nil || len(pending) != 0 {
+		t.Errorf("spool after replay = %v, %v; want empty", pending, err)
+	}
+}
+
+func TestResilientStoreEncryptsSpool(t *testing.T) {
+	codec, err := store.NewCodec([]string{"aes"}, store.CodecKeys{EncryptionKey: testEncryptionKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := Appointment{Date: "2024-05-14", Time: "10:00 am – 10:30 am", Spaces: 1}
+	store := newResilientStore(&flakyStore{down: true}, filepath.Join(t.TempDir(), "spool.json"), RetryPolicy{MaxAttempts: 1}, nil)
+	store.codec = codec
+
+	if err := store.MarkSeen([]Appointment{a}); err != nil {
+		t.Fatalf("MarkSeen() while down error = %v, want nil", err)
+	}
+	if data, err := os.ReadFile(store.spoolPath); err != nil || bytes.Contains(data, []byte(a.Date)) {
+		t.Errorf("spool = %q, %v; want it encrypted", data, err)
+	}
+	if loaded, err := store.Load(); err != nil || !reflect.DeepEqual(loaded, []Appointment{a}) {
+		t.Errorf("Load() while down = %v, %v; want the queued appointment", loaded, err)
+	}
+}
@@ -0,0 +1,173 @@
+package melanzana
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Retry policy components that can be overridden individually.
+const (
+	retryHTTP    = "http"    // Cowlendar API requests
+	retryNotify  = "notify"  // Sending notifications
+	retryStorage = "storage" // State store operations
+)
+
+// RetryPolicy describes how an operation is retried: exponential backoff
+// from BaseDelayMillis, capped at MaxDelayMillis, with each delay randomised
+// by up to ±Jitter (a fraction, e.g. 0.2 for ±20%).
+type RetryPolicy struct {
+	MaxAttempts     int     `json:"maxAttempts"`     // Total attempts, including the first
+	BaseDelayMillis int     `json:"baseDelayMillis"` // Delay before the first retry; doubles for each further retry
+	MaxDelayMillis  int     `json:"maxDelayMillis"`  // Upper bound on the delay
+	Jitter          float64 `json:"jitter"`          // Random variation applied to each delay, e.g. 0.2 for ±20%
+}
+
+// RetryConfig is the shared retry policy with per-component overrides. Fields
+// left unset in an override are inherited from the shared policy.
+type RetryConfig struct {
+	RetryPolicy
+	Overrides map[string]RetryPolicy `json:"overrides"` // keyed by http, notify or storage
+}
+
+func defaultRetryConfig() RetryConfig {
+	return RetryConfig{RetryPolicy: RetryPolicy{MaxAttempts: 3, BaseDelayMillis: 1000, MaxDelayMillis: 30000, Jitter: 0.2}}
+}
+
+// policy returns the effective policy for a component.
+func (c RetryConfig) policy(component string) RetryPolicy {
+	p := c.RetryPolicy
+	o, ok := c.Overrides[component]
+	if !ok {
+		return p
+	}
+	if o.MaxAttempts != 0 {
+		p.MaxAttempts = o.MaxAttempts
+	}
+	if o.BaseDelayMillis != 0 {
+		p.BaseDelayMillis = o.BaseDelayMillis
+	}
+	if o.MaxDelayMillis != 0 {
+		p.MaxDelayMillis = o.MaxDelayMillis
+	}
+	if o.Jitter != 0 {
+		p.Jitter = o.Jitter
+	}
+	return p
+}
+
+// validate reports overrides for components that don't exist.
+func (c RetryConfig) validate() error {
+	for component := range c.Overrides {
+		switch component {
+		case retryHTTP, retryNotify, retryStorage:
+		default:
+			return fmt.Errorf("unknown retry override %q (want http, notify or storage)", component)
+		}
+	}
+	return nil
+}
+
+// delay returns the wait before retry number attempt (0 for the first retry).
+// random returns a value in [0, 1).
+func (p RetryPolicy) delay(attempt int, random func() float64) time.Duration {
+	d := time.Duration(p.BaseDelayMillis) * time.Millisecond
+	max := time.Duration(p.MaxDelayMillis) * time.Millisecond
+	for i := 0; i < attempt && (max <= 0 || d < max); i++ {
+		d *= 2
+	}
+	if max > 0 && d > max {
+		d = max
+	}
+	if p.Jitter > 0 {
+		d = time.Duration(float64(d) * (1 + p.Jitter*(2*random()-1)))
+	}
+	return d
+}
+
+// do runs fn until it succeeds, returns a permanent error, or MaxAttempts is
+// reached, sleeping between attempts.
+func (p RetryPolicy) do(op string, sleep func(time.Duration), fn func() error) error {
+	attempts := max(p.MaxAttempts, 1)
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		var perm permanentError
+		if errors.As(err, &perm) {
+			return perm.err
+		}
+		if attempt < attempts-1 {
+			d := p.delay(attempt, rand.Float64)
+			var after retryAfterError
+			if errors.As(err, &after) {
+				d = p.honor(d, after.after)
+			}
+			slog.Warn("Request failed, retrying", "op", op, "delay", d.Round(time.Millisecond), "err", err)
+			sleep(d)
+		}
+	}
+	if attempts == 1 {
+		return err
+	}
+	return fmt.Errorf("%s failed after %d attempts: %w", op, attempts, err)
+}
+
+// honor returns the wait before a retry the server asked to be delayed by
+// after: the longer of backoff and after, but no more than MaxDelayMillis so
+// one response can't stall a cycle.
+func (p RetryPolicy) honor(backoff, after time.Duration) time.Duration {
+	d := max(backoff, after)
+	if limit := time.Duration(p.MaxDelayMillis) * time.Millisecond; limit > 0 && d > limit {
+		d = limit
+	}
+	return d
+}
+
+// retryAfterError carries the delay a server asked for before the next attempt.
+type retryAfterError struct {
+	err   error
+	after time.Duration
+}
+
+func (e retryAfterError) Error() string { return e.err.Error() }
+func (e retryAfterError) Unwrap() error { return e.err }
+
+// retryAfter asks RetryPolicy.do to wait at least after before retrying err.
+func retryAfter(err error, after time.Duration) error {
+	return retryAfterError{err, after}
+}
+
+// parseRetryAfter parses a Retry-After header, given either as seconds or as
+// an HTTP date, into the delay from now.
+func parseRetryAfter(header string, now time.Time) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(strings.TrimSpace(header)); err == nil {
+		return time.Duration(min(max(secs, 0), int(math.MaxInt64/time.Second))) * time.Second, true
+	}
+	at, err := http.ParseTime(header)
+	if err != nil {
+		return 0, false
+	}
+	return max(at.Sub(now), 0), true
+}
+
+// permanentError marks an error that retrying won't fix.
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// permanent stops RetryPolicy.do from retrying err.
+func permanent(err error) error {
+	return permanentError{err}
+}
@@ -0,0 +1,131 @@
+package melanzana
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{BaseDelayMillis: 100, MaxDelayMillis: 500}
+	tests := []struct {
+		attempt int
+		random  float64
+		jitter  float64
+		want    time.Duration
+	}{
+		{0, 0, 0, 100 * time.Millisecond},
+		{1, 0, 0, 200 * time.Millisecond},
+		{2, 0, 0, 400 * time.Millisecond},
+		{3, 0, 0, 500 * time.Millisecond}, // capped
+		{40, 0, 0, 500 * time.Millisecond},
+		{0, 0, 0.5, 50 * time.Millisecond},    // -50%
+		{0, 0.5, 0.5, 100 * time.Millisecond}, // midpoint
+	}
+
+	for _, tt := range tests {
+		p.Jitter = tt.jitter
+		if got := p.delay(tt.attempt, func() float64 { return tt.random }); got != tt.want {
+			t.Errorf("delay(%d) with jitter %v, random %v = %v, want %v", tt.attempt, tt.jitter, tt.random, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 3, BaseDelayMillis: 10}
+	var sleeps int
+	sleep := func(time.Duration) { sleeps++ }
+
+	t.Run("EventualSuccess", func(t *testing.T) {
+		sleeps = 0
+		calls := 0
+		err := p.do("op", sleep, func() error {
+			calls++
+			if calls < 3 {
+				return errors.New("transient")
+			}
+			return nil
+		})
+		if err != nil || calls != 3 || sleeps != 2 {
+			t.Errorf("do() = %v after %d calls and %d sleeps, want success after 3 calls and 2 sleeps", err, calls, sleeps)
+		}
+	})
+
+	t.Run("GivesUp", func(t *testing.T) {
+		transient := errors.New("transient")
+		err := p.do("op", sleep, func() error { return transient })
+		if !errors.Is(err, transient) {
+			t.Errorf("do() error = %v, want wrapped transient error", err)
+		}
+	})
+
+	t.Run("Permanent", func(t *testing.T) {
+		sleeps = 0
+		calls := 0
+		fatal := errors.New("bad request")
+		err := p.do("op", sleep, func() error {
+			calls++
+			return permanent(fatal)
+		})
+		if err != fatal || calls != 1 || sleeps != 0 {
+			t.Errorf("do() = %v after %d calls, want the permanent error after 1 call", err, calls)
+		}
+	})
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{"", 0, false},
+		{"7", 7 * time.Second, true},
+		{"-3", 0, true},
+		{"Wed, 01 May 2024 12:00:30 GMT", 30 * time.Second, true},
+		{"Wed, 01 May 2024 11:00:00 GMT", 0, true}, // already passed
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		if got, ok := parseRetryAfter(tt.header, now); got != tt.want || ok != tt.ok {
+			t.Errorf("parseRetryAfter(%q) = %v, %v; want %v, %v", tt.header, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	p := RetryPolicy{MaxAttempts: 2, BaseDelayMillis: 10, MaxDelayMillis: 5000}
+	for after, want := range map[time.Duration]time.Duration{
+		time.Millisecond: 10 * time.Millisecond, // backoff is longer
+		2 * time.Second:  2 * time.Second,
+		time.Minute:      5 * time.Second, // capped
+	} {
+		var slept time.Duration
+		p.do("op", func(d time.Duration) { slept = d }, func() error {
+			return retryAfter(errors.New("rate limited"), after)
+		})
+		if slept != want {
+			t.Errorf("do() with Retry-After %v slept %v, want %v", after, slept, want)
+		}
+	}
+}
+
+func TestRetryConfigPolicy(t *testing.T) {
+	c := RetryConfig{
+		RetryPolicy: RetryPolicy{MaxAttempts: 3, BaseDelayMillis: 1000, MaxDelayMillis: 30000, Jitter: 0.2},
+		Overrides:   map[string]RetryPolicy{retryStorage: {MaxAttempts: 5}},
+	}
+
+	if got := c.policy(retryHTTP); got != c.RetryPolicy {
+		t.Errorf("policy(http) = %+v, want shared policy", got)
+	}
+	want := c.RetryPolicy
+	want.MaxAttempts = 5
+	if got := c.policy(retryStorage); got != want {
+		t.Errorf("policy(storage) = %+v, want %+v", got, want)
+	}
+
+	c.Overrides["smtp"] = RetryPolicy{}
+	if err := c.validate(); err == nil {
+		t.Errorf("validate() with unknown component error = nil, want error")
+	}
+}
@@ -0,0 +1,70 @@
+package melanzana
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// schemaMonitor tracks Cowlendar response shape across cycles. It alerts the
+// operator when a cycle sees drift, once until a cycle sees none, and logs
+// each unknown field the first time it appears.
+type schemaMonitor struct {
+	alert func(error)
+
+	mu       sync.Mutex
+	drifting bool
+	known    map[string]bool
+}
+
+// cowlendarSchema is the process-wide monitor; main sets its alert.
+var cowlendarSchema = &schemaMonitor{}
+
+// noteUnknown logs fields not seen before.
+func (m *schemaMonitor) noteUnknown(fields []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, f := range fields {
+		if m.known[f] {
+			continue
+		}
+		if m.known == nil {
+			m.known = make(map[string]bool)
+		}
+		m.known[f] = true
+		slog.Info("Cowlendar response has a new field; it is ignored", "field", f)
+	}
+}
+
+// cycle records the outcome of a cycle: drift is the first schema error it
+// saw, or nil if every response matched.
+func (m *schemaMonitor) cycle(drift error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if drift == nil {
+		if m.drifting {
+			slog.Info("Cowlendar responses match the expected shape again")
+		}
+		m.drifting = false
+		return
+	}
+	if m.drifting {
+		return
+	}
+	m.drifting = true
+	if m.alert != nil {
+		m.alert(drift)
+	}
+}
+
+// schemaAlert returns the function used to tell the operator that Cowlendar
+// responses changed shape: a log line, plus an alert on the operator's
+// channels if any are configured.
+func schemaAlert(config AppConfig) func(error) {
+	return func(err error) {
+		slog.Error("ALERT: Cowlendar response changed shape", "err", err)
+		body := fmt.Sprintf("The Melanzana scraper can't read the booking calendar's responses:\n\n%v\n\n"+
+			"Months with unexpected responses are skipped, so new slots may go unnoticed until the scraper is updated.", err)
+		sendAlert(config, "Melanzana scraper: booking calendar response changed", body)
+	}
+}
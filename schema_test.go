@@ -0,0 +1,24 @@
+package melanzana
+
+import (
+	"testing"
+
+	"github.com/pashbylogan/melanzana/pkg/cowlendar"
+)
+
+func TestSchemaMonitor(t *testing.T) {
+	var alerts int
+	m := &schemaMonitor{alert: func(error) { alerts++ }}
+	drift := &cowlendar.SchemaDriftError{Problems: []string{"long is missing"}}
+
+	m.cycle(drift)
+	m.cycle(drift)
+	if alerts != 1 {
+		t.Errorf("alerts after 2 drifting cycles = %d, want 1", alerts)
+	}
+	m.cycle(nil)
+	m.cycle(drift)
+	if alerts != 2 {
+		t.Errorf("alerts after drift recurred = %d, want 2", alerts)
+	}
+}
@@ -1,82 +1,100 @@
-package main
+package melanzana
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/pashbylogan/melanzana/pkg/cowlendar"
 )
 
-const (
-	cowlendarURL = "https://app.cowlendar.com/extapi/calendar/685b42f202405a8372cd6b78/availability"
-	requestDelay = 100 * time.Millisecond
+// The Cowlendar calendars to watch and the page where their slots are
+// booked, set from the configuration at startup.
+var (
+	calendars  = watchedCalendars(defaultConfig())
+	bookingURL = defaultConfig().BookingURL
+	// slotBookingURL links to a single slot, with placeholders; see slotBookingLink.
+	slotBookingURL = defaultConfig().SlotBookingURL
+
+	// sourceTimezone is the zone requested from the API; slot times are
+	// wall-clock times in this zone, and dates are compared against today in it.
+	sourceTimezone = defaultConfig().Timezone
 )
 
-// CowlendarResponse represents the API response structure
-type CowlendarResponse struct {
-	Short                  []string       `json:"short"`
-	Long                   []DetailedSlot `json:"long"`
-	MaxDate                string         `json:"max_date"`
-	NextAvailability       string         `json:"next_availability"`
-	NoAvailabilityInFuture bool           `json:"no_availability_in_futur"`
-	TargetTimezone         string         `json:"target_timezone"`
-	NextUnix               *int64         `json:"next_unix"`
-	JumpToNextAvs          bool           `json:"jump_to_next_avs"`
-}
-
-// DetailedSlot represents a detailed time slot from the "long" array
-type DetailedSlot struct {
-	Slot         string `json:"slot"`
-	SlotStart    string `json:"slot_start"`
-	SlotEnd      string `json:"slot_end"`
-	SlotDuration int    `json:"slot_duration"`
-	IsBookable   bool   `json:"is_bookable"`
-	QtyBooked    int    `json:"qty_booked"`
-	QtyLeft      int    `json:"qty_left"`
-	MaxQty       int    `json:"max_qty"`
-}
-
-// Appointment holds information about a single appointment slot.
-type Appointment struct {
-	Date        string `json:"date"`        // YYYY-MM-DD format
-	Time        string `json:"time"`        // e.g., "10:30 am – 11:00 am"
-	Spaces      int    `json:"spaces"`      // number of available spaces
-	IsAvailable bool   `json:"isAvailable"` // whether any appointments are available
-}
-
-// fetchAvailability fetches appointment availability for a specific month from Cowlendar API
-func fetchAvailability(year, month int) (*CowlendarResponse, error) {
-	url := fmt.Sprintf("%s?year=%d&month=%d&timezone=America/Denver&quantity_details[0][type]=default&quantity_details[0][quantity]=1&quantity_details[0][name]=Default&teammate_id=all&duration=30&is_manual=false&variant_id=41855678382123",
-		cowlendarURL, year, month)
-
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch availability: %w", err)
-	}
-	defer resp.Body.Close()
+// fetchRetry is the retry policy for Cowlendar API requests, set from the configuration at startup.
+var fetchRetry = defaultRetryConfig().policy(retryHTTP)
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API returned status %d", resp.StatusCode)
-	}
+// fetchAvailability fetches appointment availability for a specific month of
+// a calendar from Cowlendar API, retrying network errors and server errors.
+func fetchAvailability(cal Calendar, year, month int) (*cowlendar.Response, error) {
+	var response *cowlendar.Response
+	err := fetchRetry.do(fmt.Sprintf("Fetching %d-%02d", year, month), clock.Sleep, func() error {
+		var err error
+		response, err = fetchAvailabilityOnce(cal, year, month)
+		return err
+	})
+	return response, err
+}
 
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+// availabilityCache shares Cowlendar responses between everything in the
+// process that reads availability, set from the configuration at startup;
+// nil unless availabilityCacheSeconds is set.
+var availabilityCache *cowlendar.AvailabilityService
+
+// newAvailabilityCache returns the cache config asks for, or nil for none.
+func newAvailabilityCache(config AppConfig) *cowlendar.AvailabilityService {
+	if config.AvailabilityCacheSeconds <= 0 {
+		return nil
 	}
+	return cowlendar.NewAvailabilityService(newCowlendarClient(), time.Duration(config.AvailabilityCacheSeconds)*time.Second)
+}
 
-	var response CowlendarResponse
-	if err := json.Unmarshal(bodyBytes, &response); err != nil {
-		return nil, fmt.Errorf("failed to parse JSON response: %w", err)
+// newCowlendarClient returns a client for the API through apiClient.
+func newCowlendarClient() *cowlendar.Client {
+	return &cowlendar.Client{HTTPClient: apiClient, Timezone: sourceTimezone, OnUnknownFields: cowlendarSchema.noteUnknown}
+}
+
+func fetchAvailabilityOnce(cal Calendar, year, month int) (*cowlendar.Response, error) {
+	fetch := newCowlendarClient().FetchAvailability
+	if availabilityCache != nil {
+		fetch = availabilityCache.FetchAvailability
 	}
+	response, err := fetch(context.Background(), cowlendar.Calendar{ID: cal.CalendarID, VariantID: cal.VariantID}, year, month)
 
-	return &response, nil
+	var status *cowlendar.StatusError
+	var drift *cowlendar.SchemaDriftError
+	var limited *rateLimitedError
+	switch {
+	case errors.As(err, &limited):
+		// Retrying before the server's pause ends would only be refused.
+		return nil, permanent(err)
+	case errors.As(err, &status):
+		if status.StatusCode < 500 && status.StatusCode != http.StatusTooManyRequests {
+			return nil, permanent(err)
+		}
+		if after, ok := parseRetryAfter(status.RetryAfter, clock.Now()); ok {
+			return nil, retryAfter(err, after)
+		}
+		return nil, err
+	case errors.As(err, &drift), errors.Is(err, cowlendar.ErrMalformed):
+		return nil, permanent(fmt.Errorf("%w: %w", errParse, err))
+	}
+	return response, err
 }
 
 // convertCowlendarToAppointments converts Cowlendar response to our Appointment format
-func convertCowlendarToAppointments(response *CowlendarResponse) []Appointment {
+func convertCowlendarToAppointments(response *cowlendar.Response) []Appointment {
 	var appointments []Appointment
+	loc := sourceLocation()
 
 	// Process detailed slots from "long" array
 	for _, slot := range response.Long {
@@ -85,15 +103,15 @@ func convertCowlendarToAppointments(response *CowlendarResponse) []Appointment {
 		}
 
 		// Parse date and time from slot_start and slot_end
-		startTime, err := time.Parse("2006-01-02 15:04", slot.SlotStart)
+		startTime, err := time.ParseInLocation("2006-01-02 15:04", slot.SlotStart, loc)
 		if err != nil {
-			log.Printf("Error parsing start time %s: %v", slot.SlotStart, err)
+			slog.Warn("Error parsing slot start time", "slotStart", slot.SlotStart, "err", err)
 			continue
 		}
 
-		endTime, err := time.Parse("2006-01-02 15:04", slot.SlotEnd)
+		endTime, err := time.ParseInLocation("2006-01-02 15:04", slot.SlotEnd, loc)
 		if err != nil {
-			log.Printf("Error parsing end time %s: %v", slot.SlotEnd, err)
+			slog.Warn("Error parsing slot end time", "slotEnd", slot.SlotEnd, "err", err)
 			continue
 		}
 
@@ -106,6 +124,7 @@ func convertCowlendarToAppointments(response *CowlendarResponse) []Appointment {
 			Date:        startTime.Format("2006-01-02"),
 			Time:        timeSlot,
 			Spaces:      slot.QtyLeft,
+			MaxSpaces:   slot.MaxQty,
 			IsAvailable: slot.QtyLeft > 0,
 		})
 	}
@@ -113,52 +132,288 @@ func convertCowlendarToAppointments(response *CowlendarResponse) []Appointment {
 	return appointments
 }
 
-// scrapeAppointments checks appointment availability using the Cowlendar API
+// scrapeAppointments checks appointment availability in each watched
+// calendar using the Cowlendar API. Months that can't be fetched are
+// skipped and reported with the other months' appointments in a
+// *partialFetchError; it fails outright only if none could be fetched.
 func scrapeAppointments(monthsAhead int) ([]Appointment, error) {
 	var allAppointments []Appointment
-	currentTime := time.Now()
+	var tally scrapeTally
+	for _, cal := range calendars {
+		allAppointments = append(allAppointments, scrapeCalendar(cal, monthsAhead, &tally)...)
+	}
+	if tally.drift != nil || tally.fetched > 0 {
+		cowlendarSchema.cycle(tally.drift)
+	}
+	if tally.fetched > 0 {
+		for _, cal := range calendars {
+			if maxDate := tally.maxDates[cal.Name]; maxDate != "" {
+				slog.Info("Bookable horizon", "calendar", cal.Name, "maxDate", maxDate)
+			}
+		}
+		observedMaxDates.set(tally.maxDates)
+		nextUnixHint.Store(tally.nextUnix)
+	}
+	if tally.fetched == 0 && len(tally.errs) > 0 {
+		return nil, fmt.Errorf("%w: no month could be fetched: %w", errFetch, errors.Join(tally.errs...))
+	}
+	if len(calendars) > 1 {
+		// Keep each day's slots together across calendars.
+		sort.SliceStable(allAppointments, func(i, j int) bool { return allAppointments[i].Date < allAppointments[j].Date })
+	}
+
+	slog.Info("Total available appointments found", "count", len(allAppointments))
+	if len(tally.errs) > 0 {
+		return allAppointments, &partialFetchError{Fetched: tally.fetched, Attempted: tally.fetched + len(tally.errs), Missed: tally.missed, Err: errors.Join(tally.errs...)}
+	}
+	return allAppointments, nil
+}
+
+// scrapeTally accumulates the outcome of a scrape's requests.
+type scrapeTally struct {
+	fetched  int               // Months read successfully
+	drift    error             // First response that changed shape
+	errs     []error           // One per month that couldn't be read
+	missed   fetchGaps         // The months that couldn't be read
+	maxDates map[string]string // Latest max_date by calendar name
+	nextUnix int64             // Earliest future next_unix, 0 if none
+}
+
+// noteMaxDate records a calendar's max_date if it is later than the one
+// already noted.
+func (t *scrapeTally) noteMaxDate(calendar, date string) {
+	if t.maxDates == nil {
+		t.maxDates = map[string]string{}
+	}
+	t.maxDates[calendar] = laterMaxDate(t.maxDates[calendar], date)
+}
+
+// noteNextUnix records a next_unix hint if it is earlier than the one
+// already noted.
+func (t *scrapeTally) noteNextUnix(at int64) {
+	if t.nextUnix == 0 || at < t.nextUnix {
+		t.nextUnix = at
+	}
+}
+
+// nextUnixHint is the earliest future next_unix of the latest scrape, as
+// Unix seconds, or 0 if there was none. The daemon checks again then if
+// that is sooner than it otherwise would.
+var nextUnixHint atomic.Int64
+
+// partialFetchError is returned along with the appointments that were found
+// when some, but not all, months could be fetched. Callers decide whether
+// the rest are enough to act on.
+type partialFetchError struct {
+	Fetched, Attempted int       // Months
+	Missed             fetchGaps // The months that couldn't be fetched
+	Err                error     // The failed months' errors, joined
+}
+
+func (e *partialFetchError) Error() string {
+	return fmt.Sprintf("fetched %d of %d months: %v", e.Fetched, e.Attempted, e.Err)
+}
+
+func (e *partialFetchError) Unwrap() error { return e.Err }
+
+// ratio is the fraction of months that were fetched.
+func (e *partialFetchError) ratio() float64 {
+	return float64(e.Fetched) / float64(e.Attempted)
+}
+
+// calendarMonth is one calendar's month, as YYYY-MM.
+type calendarMonth struct {
+	calendar, month string
+}
+
+// fetchGaps are the calendars' months a scrape couldn't read. What was known
+// of their slots still stands: they are neither removed nor changed.
+type fetchGaps map[calendarMonth]bool
+
+func (g *fetchGaps) add(calendar, month string) {
+	if *g == nil {
+		*g = fetchGaps{}
+	}
+	(*g)[calendarMonth{calendar, month}] = true
+}
+
+// has reports whether the month of date, YYYY-MM-DD, in calendar wasn't read.
+func (g fetchGaps) has(calendar, date string) bool {
+	return len(date) >= 7 && g[calendarMonth{calendar, date[:7]}]
+}
+
+// scrapeCalendar fetches the months ahead from one calendar, tagging its
+// slots with the calendar's name.
+func scrapeCalendar(cal Calendar, monthsAhead int, tally *scrapeTally) []Appointment {
+	var calAppointments []Appointment
+	currentTime := clock.Now().In(sourceLocation())
 	thresholdDate := currentTime.AddDate(0, monthsAhead, 0)
+	horizon := "" // The latest max_date the calendar has reported
 
 	// Check each month ahead
 	for i := 0; i < monthsAhead; i++ {
 		targetDate := currentTime.AddDate(0, i, 0)
 		year := targetDate.Year()
 		month := int(targetDate.Month())
+		yearMonth := fmt.Sprintf("%d-%02d", year, month)
+		label := yearMonth
+		logger := slog.With("month", label)
+		if cal.Name != "" {
+			logger = logger.With("calendar", cal.Name)
+			label = cal.Name + " " + label
+		}
 
-		log.Printf("Checking availability for %d-%02d", year, month)
+		// Months past the bookable horizon can only come back empty.
+		if horizon != "" && fmt.Sprintf("%d-%02d-01", year, month) > horizon {
+			logger.Info("Month is beyond the bookable horizon, stopping search", "maxDate", horizon)
+			break
+		}
+
+		logger.Debug("Checking availability")
 
-		response, err := fetchAvailability(year, month)
+		response, err := fetchAvailability(cal, year, month)
 		if err != nil {
-			log.Printf("Error fetching availability for %d-%02d: %v", year, month, err)
+			logger.Warn("Error fetching availability", "err", err)
+			session.FetchErrors++
+			tally.errs = append(tally.errs, fmt.Errorf("%s: %w", label, err))
+			tally.missed.add(cal.Name, yearMonth)
+			var schemaErr *cowlendar.SchemaDriftError
+			if tally.drift == nil && errors.As(err, &schemaErr) {
+				tally.drift = err
+			}
 			continue
 		}
+		tally.fetched++
+		session.MonthsChecked++
+		tally.noteMaxDate(cal.Name, response.MaxDate)
+		horizon = laterMaxDate(horizon, response.MaxDate)
 
 		// Check if next availability is beyond our search threshold
-		if response.NextAvailability != "" {
-			nextAvailable, err := time.Parse("2006-01-02", response.NextAvailability)
-			if err == nil && nextAvailable.After(thresholdDate) {
-				log.Printf("Next availability %s is beyond threshold %s - stopping search",
-					response.NextAvailability, thresholdDate.Format("2006-01-02"))
-				break
-			}
+		nextAvailable, hinted := nextAvailability(response, currentTime.Location())
+		if hinted && nextAvailable.After(thresholdDate) {
+			logger.Info("Next availability is beyond the lookahead, stopping search",
+				"nextAvailability", nextAvailable.Format("2006-01-02"), "threshold", thresholdDate.Format("2006-01-02"))
+			break
+		}
+		if response.NextUnix != nil && *response.NextUnix > currentTime.Unix() {
+			tally.noteNextUnix(*response.NextUnix)
 		}
 
+		observedAt := clock.Now()
 		appointments := convertCowlendarToAppointments(response)
+		for j := range appointments {
+			appointments[j].ObservedAt = observedAt
+			appointments[j].Calendar = cal.Name
+		}
 		if len(appointments) > 0 {
-			log.Printf("Found %d appointment slots for %d-%02d", len(appointments), year, month)
-			allAppointments = append(allAppointments, appointments...)
+			logger.Info("Found appointment slots", "count", len(appointments))
+			calAppointments = append(calAppointments, appointments...)
 		} else {
-			log.Printf("No appointments available for %d-%02d", year, month)
-			if response.NextAvailability != "" {
-				log.Printf("Next availability: %s", response.NextAvailability)
-			}
+			logger.Info("No appointments available", "nextAvailability", response.NextAvailability)
 		}
 
-		if i < monthsAhead-1 {
-			time.Sleep(requestDelay)
+		// The flag is only trusted when nothing hints at availability later.
+		if response.NoAvailabilityInFuture && !hinted {
+			logger.Info("Calendar reports no availability in later months, stopping search")
+			break
 		}
 	}
+	return calAppointments
+}
 
-	log.Printf("Total available appointments found: %d", len(allAppointments))
-	return allAppointments, nil
+// nextAvailability returns the day response says the calendar next has
+// availability, from next_availability or, failing that, next_unix, and
+// whether it says at all.
+func nextAvailability(response *cowlendar.Response, loc *time.Location) (time.Time, bool) {
+	if response.NextAvailability != "" {
+		if day, err := time.ParseInLocation("2006-01-02", response.NextAvailability, loc); err == nil {
+			return day, true
+		}
+	}
+	if response.NextUnix != nil && *response.NextUnix > 0 {
+		at := time.Unix(*response.NextUnix, 0).In(loc)
+		return time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, loc), true
+	}
+	return time.Time{}, false
+}
+
+// spacesPattern finds the count in text like "3 spaces available".
+var spacesPattern = regexp.MustCompile(`\d+`)
+
+// extractSpaces returns the number of spaces in a booking page's
+// availability text, or 0 if it has none.
+func extractSpaces(text string) int {
+	n, err := strconv.Atoi(spacesPattern.FindString(text))
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// generateDateRange returns days consecutive dates from start as YYYY-MM-DD.
+func generateDateRange(start time.Time, days int) []string {
+	dates := make([]string, 0, max(days, 0))
+	for i := 0; i < days; i++ {
+		dates = append(dates, start.AddDate(0, 0, i).Format("2006-01-02"))
+	}
+	return dates
+}
+
+// parseAppointmentSlots extracts the available slots from a booking page
+// rendered for date, found with selectors. Slots whose time range can't be
+// read, or that have no spaces left, are skipped.
+func parseAppointmentSlots(html, date string, selectors HTMLSelectors) ([]Appointment, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse booking page: %w", err)
+	}
+
+	var appointments []Appointment
+	doc.Find(selectors.Slot).Each(func(_ int, slot *goquery.Selection) {
+		rangeText := strings.TrimSpace(slot.Find(selectors.Time).Text())
+		start, end, ok := parseTimeRange(rangeText)
+		if !ok {
+			slog.Warn("Skipping slot with unrecognized time range", "timeRange", rangeText, "date", date)
+			return
+		}
+
+		spaces := 1
+		if selectors.Spaces != "" {
+			spaces = extractSpaces(slot.Find(selectors.Spaces).Text())
+		}
+		if spaces <= 0 {
+			return
+		}
+		appointments = append(appointments, Appointment{
+			Date:        date,
+			Time:        fmt.Sprintf("%s – %s", start.Format("3:04 pm"), end.Format("3:04 pm")),
+			Spaces:      spaces,
+			IsAvailable: true,
+		})
+	})
+	return appointments, nil
+}
+
+// timeRangeSeparator splits a booking page's time range, such as
+// "10:00 am - 10:30 am", "10:00am–10:30am" or "10:00 to 10:30".
+var timeRangeSeparator = regexp.MustCompile(`\s*(?:-|–|—|\bto\b)\s*`)
+
+// parseTimeRange reads a booking page's time range, in 12- or 24-hour time.
+func parseTimeRange(text string) (start, end time.Time, ok bool) {
+	parts := timeRangeSeparator.Split(text, -1)
+	if len(parts) != 2 {
+		return time.Time{}, time.Time{}, false
+	}
+	parse := func(s string) (time.Time, bool) {
+		s = strings.ToLower(strings.Join(strings.Fields(s), ""))
+		for _, layout := range []string{"3:04pm", "3pm", "15:04"} {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t, true
+			}
+		}
+		return time.Time{}, false
+	}
+	start, okStart := parse(parts[0])
+	end, okEnd := parse(parts[1])
+	return start, end, okStart && okEnd
 }
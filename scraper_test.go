@@ -1,11 +1,23 @@
-package main
+package melanzana
 
 import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/pashbylogan/melanzana/pkg/cowlendar"
 )
 
+var update = flag.Bool("update", false, "rewrite golden files with the current output")
+
 func TestExtractSpaces(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -54,6 +66,35 @@ func TestExtractSpaces(t *testing.T) {
 	}
 }
 
+func TestNextAvailability(t *testing.T) {
+	loc, err := time.LoadLocation("America/Denver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unix := func(v int64) *int64 { return &v }
+	tests := []struct {
+		name       string
+		response   cowlendar.Response
+		want       string
+		wantHinted bool
+	}{
+		{"None", cowlendar.Response{}, "", false},
+		{"NextAvailability", cowlendar.Response{NextAvailability: "2025-06-03", NextUnix: unix(1747238400)}, "2025-06-03", true},
+		// 2025-05-15 03:00 UTC is still the 14th in Denver.
+		{"NextUnix", cowlendar.Response{NextUnix: unix(1747278000)}, "2025-05-14", true},
+		{"NotADate", cowlendar.Response{NextAvailability: "soon", NextUnix: unix(1747238400)}, "2025-05-14", true},
+		{"ZeroNextUnix", cowlendar.Response{NextUnix: unix(0)}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, hinted := nextAvailability(&tt.response, loc)
+			if hinted != tt.wantHinted || (hinted && got.Format("2006-01-02") != tt.want) {
+				t.Errorf("nextAvailability() = %v, %v; want %s, %v", got, hinted, tt.want, tt.wantHinted)
+			}
+		})
+	}
+}
+
 func TestGenerateDateRange(t *testing.T) {
 	// Fixed start date for consistent testing
 	startDate := time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC)
@@ -169,7 +210,7 @@ func TestParseAppointmentSlots(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := parseAppointmentSlots(tt.htmlContent, tt.date)
+			result, err := parseAppointmentSlots(tt.htmlContent, tt.date, defaultConfig().HTMLSelectors)
 
 			if err != nil {
 				t.Errorf("parseAppointmentSlots() error = %v, want nil", err)
@@ -224,6 +265,15 @@ func TestBuildEmailBody(t *testing.T) {
 				"Book at: https://melanzana.com/book-an-appointment",
 			},
 		},
+		{
+			name: "Capacity known",
+			appointments: []Appointment{
+				{Date: "2024-05-15", Time: "10:00 am – 11:00 am", Spaces: 2, MaxSpaces: 4, IsAvailable: true},
+			},
+			expectedSubstrings: []string{
+				"2024-05-15 at 10:00 am – 11:00 am (2 of 4 spaces available)",
+			},
+		},
 		{
 			name:         "Empty appointments",
 			appointments: []Appointment{},
@@ -236,7 +286,7 @@ func TestBuildEmailBody(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := buildEmailBody(tt.appointments)
+			result := buildEmailBody(tt.appointments, RenderOptions{})
 
 			for _, substring := range tt.expectedSubstrings {
 				if !strings.Contains(result, substring) {
@@ -246,3 +296,168 @@ func TestBuildEmailBody(t *testing.T) {
 		})
 	}
 }
+
+// TestScrapeGolden runs the recorded Cowlendar responses in
+// testdata/scrape/<case> through the API client and scraper, and compares
+// the requests made and the appointments found with the case's want.golden.
+// Run with -update to rewrite the golden files after an intended change.
+func TestScrapeGolden(t *testing.T) {
+	defer func(client *http.Client, transport http.RoundTripper, tz string, cals []Calendar) {
+		apiClient, apiTransport, sourceTimezone, calendars = client, transport, tz, cals
+	}(apiClient, apiTransport, sourceTimezone, calendars)
+	sourceTimezone = "America/Denver"
+	now := time.Date(2025, 3, 10, 15, 0, 0, 0, time.UTC)
+	fixClock(t, now)
+	defer nextUnixHint.Store(0)
+
+	tests := []struct {
+		name        string
+		monthsAhead int
+		calendars   []Calendar
+	}{
+		// Slots across several months and two calendars, of which only the
+		// bookable ones with spaces left are found.
+		{"multi_month", 3, []Calendar{{Name: "Fitting", CalendarID: "cal-1"}, {Name: "Tailoring", CalendarID: "cal-2", VariantID: "v-2"}}},
+		// Months without slots, answered explicitly or not recorded at all,
+		// don't end the search while the next availability is in range.
+		{"empty_months", 4, []Calendar{{CalendarID: "cal-1"}}},
+		// no_availability_in_futur with no next availability ends the search
+		// without asking for later months.
+		{"no_availability_in_futur", 4, []Calendar{{CalendarID: "cal-1"}}},
+		// A next_unix hint in range keeps the search going past months
+		// reporting no_availability_in_futur, until it reaches the slots.
+		{"next_unix", 4, []Calendar{{CalendarID: "cal-1"}}},
+		// Months after the max_date aren't asked for.
+		{"max_date", 4, []Calendar{{CalendarID: "cal-1"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join("testdata", "scrape", tt.name)
+			var requests []string
+			apiTransport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				q := req.URL.Query()
+				requests = append(requests, fmt.Sprintf("GET %s %s-%02s variant=%q agent=%q",
+					path.Base(path.Dir(req.URL.Path)), q.Get("year"), q.Get("month"), q.Get("variant_id"), req.Header.Get("User-Agent")))
+				return replayTransport{&replaySnapshot{At: now, Dir: dir}}.RoundTrip(req)
+			})
+			config := defaultConfig()
+			config.RequestsPerSecond = 0
+			apiClient = newAPIClient(config)
+			calendars = tt.calendars
+
+			appointments, err := scrapeAppointments(tt.monthsAhead)
+			if err != nil {
+				t.Fatalf("scrapeAppointments() error = %v", err)
+			}
+			var b strings.Builder
+			for _, r := range requests {
+				fmt.Fprintln(&b, r)
+			}
+			fmt.Fprintln(&b)
+			for _, appt := range appointments {
+				fmt.Fprintf(&b, "%s %s calendar=%q spaces=%d/%d observed=%s\n",
+					appt.Date, appt.Time, appt.Calendar, appt.Spaces, appt.MaxSpaces, appt.ObservedAt.Format(time.RFC3339))
+			}
+			checkGolden(t, filepath.Join(dir, "want.golden"), b.String())
+		})
+	}
+}
+
+// roundTripFunc adapts a function to http.RoundTripper.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+// checkGolden compares got with the golden file at path, or rewrites the
+// file with -update.
+func checkGolden(t *testing.T, path, got string) {
+	t.Helper()
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run with -update to create it)", err)
+	}
+	if got != string(want) {
+		t.Errorf("output differs from %s (run with -update if the change is intended)\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+func TestScrapeSharesAvailabilityCache(t *testing.T) {
+	defer func(client *http.Client, tz string, cals []Calendar, cache *cowlendar.AvailabilityService) {
+		apiClient, sourceTimezone, calendars, availabilityCache = client, tz, cals, cache
+	}(apiClient, sourceTimezone, calendars, availabilityCache)
+	sourceTimezone = "America/Denver"
+	calendars = []Calendar{{CalendarID: "cal-1"}}
+	now := time.Date(2025, 3, 10, 15, 0, 0, 0, time.UTC)
+	fixClock(t, now)
+
+	requests := 0
+	replay := replayTransport{&replaySnapshot{At: now, Dir: filepath.Join("testdata", "scrape", "multi_month")}}
+	apiClient = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requests++
+		return replay.RoundTrip(req)
+	})}
+	availabilityCache = newAvailabilityCache(AppConfig{AvailabilityCacheSeconds: 60})
+
+	first, err := scrapeAppointments(2)
+	if err != nil {
+		t.Fatalf("scrapeAppointments() error = %v", err)
+	}
+	second, err := scrapeAppointments(2)
+	if err != nil || len(second) != len(first) || requests != 2 {
+		t.Errorf("second scrapeAppointments() = %d slots, %v after %d requests; want the same %d slots from the 2 requests of the first", len(second), err, requests, len(first))
+	}
+}
+
+func TestScrapePartialFailure(t *testing.T) {
+	defer func(client *http.Client, tz string, cals []Calendar) {
+		apiClient, sourceTimezone, calendars = client, tz, cals
+	}(apiClient, sourceTimezone, calendars)
+	sourceTimezone = "America/Denver"
+	calendars = []Calendar{{CalendarID: "cal-1"}}
+	now := time.Date(2025, 3, 10, 15, 0, 0, 0, time.UTC)
+	fixClock(t, now)
+
+	failing := map[string]bool{"4": true}
+	replay := replayTransport{&replaySnapshot{At: now, Dir: filepath.Join("testdata", "scrape", "multi_month")}}
+	apiClient = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if failing[req.URL.Query().Get("month")] {
+			// A status that isn't retried, to keep the test fast.
+			return &http.Response{StatusCode: http.StatusNotFound, Body: http.NoBody, Request: req}, nil
+		}
+		return replay.RoundTrip(req)
+	})}
+
+	appointments, err := scrapeAppointments(3)
+	var partial *partialFetchError
+	if !errors.As(err, &partial) || partial.Fetched != 2 || partial.Attempted != 3 {
+		t.Fatalf("scrapeAppointments() error = %v, want a partialFetchError for 2 of 3 months", err)
+	}
+	if want := (fetchGaps{{"", "2025-04"}: true}); !reflect.DeepEqual(partial.Missed, want) {
+		t.Errorf("Missed = %v, want %v", partial.Missed, want)
+	}
+	if r := partial.ratio(); r < 0.66 || r > 0.67 {
+		t.Errorf("ratio() = %v, want 2/3", r)
+	}
+	var status *cowlendar.StatusError
+	if !errors.As(err, &status) || status.StatusCode != http.StatusNotFound {
+		t.Errorf("scrapeAppointments() error = %v, want it to carry the failed month's StatusError", err)
+	}
+	if len(appointments) != 4 {
+		t.Errorf("scrapeAppointments() = %d appointments, want the 4 from March and May", len(appointments))
+	}
+
+	failing = map[string]bool{"3": true, "4": true, "5": true}
+	appointments, err = scrapeAppointments(3)
+	if !errors.Is(err, errFetch) || errors.As(err, &partial) || appointments != nil {
+		t.Errorf("scrapeAppointments() with every month failing = %v, %v; want an errFetch and no appointments", appointments, err)
+	}
+	if n := strings.Count(err.Error(), "status 404"); n != 3 {
+		t.Errorf("error %q reports %d months' failures, want all 3", err, n)
+	}
+}
@@ -0,0 +1,254 @@
+package melanzana
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pashbylogan/melanzana/pkg/awssig"
+)
+
+// Secret reference schemes accepted in place of a secret config value.
+const (
+	secretSchemeFile  = "file://"
+	secretSchemeVault = "vault://"
+	secretSchemeAWSSM = "aws-sm://"
+)
+
+// secretsManagerEndpointFormat is a variable so tests can point it at a local server.
+var secretsManagerEndpointFormat = "https://secretsmanager.%s.amazonaws.com/"
+
+var secretsHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// secretFields returns pointers to every config value holding a credential.
+func secretFields(config *AppConfig) []*string {
+	return []*string{
+		&config.SMTPPassword,
+		&config.OAuth2ClientSecret,
+		&config.OAuth2RefreshToken,
+		&config.EmailAPIKey,
+		&config.SMSAuthToken,
+		&config.SubscriberAPIToken,
+		&config.FunctionSecret,
+		&config.IMAPPassword,
+		&config.TelegramBotToken,
+		&config.AWSSecretAccessKey,
+		&config.GCSSecret,
+		&config.StateDatabaseURL,
+		&config.StateEncryptionKey,
+		&config.StateAgeIdentity,
+	}
+}
+
+// isSecretRef reports whether value refers to a secret stored elsewhere.
+func isSecretRef(value string) bool {
+	for _, scheme := range []string{secretSchemeFile, secretSchemeVault, secretSchemeAWSSM} {
+		if strings.HasPrefix(value, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveSecrets replaces each secret reference in config with the secret it
+// points to, so credentials don't have to be kept in the config file.
+func resolveSecrets(config *AppConfig) error {
+	creds := awssig.Credentials{AccessKeyID: config.AWSAccessKeyID, SecretAccessKey: config.AWSSecretAccessKey}.WithEnvFallback()
+	for _, field := range secretFields(config) {
+		if !isSecretRef(*field) {
+			continue
+		}
+		value, err := resolveSecret(*field, creds)
+		if err != nil {
+			return err
+		}
+		*field = value
+	}
+	return nil
+}
+
+// resolveSecret fetches the secret named by ref:
+//
+//	file:///run/secrets/smtp_pass        the file's contents, without a trailing newline
+//	vault://secret/data/melanzana#smtp   key "smtp" of a Vault KV secret
+//	aws-sm://melanzana/smtp?region=...   an AWS Secrets Manager secret; #key selects a JSON field
+func resolveSecret(ref string, creds awssig.Credentials) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, secretSchemeFile):
+		path := strings.TrimPrefix(ref, secretSchemeFile)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret file %s: %w", path, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case strings.HasPrefix(ref, secretSchemeVault):
+		return resolveVaultSecret(strings.TrimPrefix(ref, secretSchemeVault))
+	case strings.HasPrefix(ref, secretSchemeAWSSM):
+		return resolveAWSSecret(strings.TrimPrefix(ref, secretSchemeAWSSM), creds)
+	default:
+		return ref, nil
+	}
+}
+
+// splitSecretRef splits "name?query#key" into its parts.
+func splitSecretRef(ref string) (name string, query url.Values, key string, err error) {
+	ref, key, _ = strings.Cut(ref, "#")
+	name, rawQuery, _ := strings.Cut(ref, "?")
+	query, err = url.ParseQuery(rawQuery)
+	if err != nil {
+		return "", nil, "", fmt.Errorf("invalid secret reference query %q: %w", rawQuery, err)
+	}
+	if name == "" {
+		return "", nil, "", fmt.Errorf("secret reference has no name")
+	}
+	return name, query, key, nil
+}
+
+// resolveVaultSecret reads a secret from the Vault server at VAULT_ADDR using
+// VAULT_TOKEN. Both KV version 1 and 2 responses are understood. Without a
+// #key the secret must hold exactly one value.
+func resolveVaultSecret(ref string) (string, error) {
+	path, _, key, err := splitSecretRef(ref)
+	if err != nil {
+		return "", err
+	}
+	addr, token := os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		return "", fmt.Errorf("VAULT_ADDR and VAULT_TOKEN must be set to resolve vault://%s", path)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(addr, "/")+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to build Vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+
+	body, err := doSecretRequest("Vault", req)
+	if err != nil {
+		return "", err
+	}
+	var response struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", fmt.Errorf("failed to parse Vault response for %s: %w", path, err)
+	}
+
+	// KV version 2 nests the values, with metadata alongside.
+	data := response.Data
+	if nested, ok := data["data"]; ok {
+		if _, hasMetadata := data["metadata"]; hasMetadata {
+			data = nil
+			if err := json.Unmarshal(nested, &data); err != nil {
+				return "", fmt.Errorf("failed to parse Vault secret %s: %w", path, err)
+			}
+		}
+	}
+	return selectSecretKey(data, key, "vault://"+path)
+}
+
+// resolveAWSSecret reads a secret from AWS Secrets Manager. The region comes
+// from ?region= or AWS_REGION. If #key is given the secret must be a JSON
+// object and that field is returned.
+func resolveAWSSecret(ref string, creds awssig.Credentials) (string, error) {
+	name, query, key, err := splitSecretRef(ref)
+	if err != nil {
+		return "", err
+	}
+	region := query.Get("region")
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		return "", fmt.Errorf("no region for aws-sm://%s: add ?region= or set AWS_REGION", name)
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return "", fmt.Errorf("AWS credentials are required to resolve aws-sm://%s", name)
+	}
+
+	payload, err := json.Marshal(map[string]string{"SecretId": name})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode Secrets Manager request: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf(secretsManagerEndpointFormat, region), bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("failed to build Secrets Manager request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	awssig.Sign(req, payload, creds, region, "secretsmanager", time.Now())
+
+	body, err := doSecretRequest("Secrets Manager", req)
+	if err != nil {
+		return "", err
+	}
+	var response struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", fmt.Errorf("failed to parse Secrets Manager response for %s: %w", name, err)
+	}
+	if key == "" {
+		return response.SecretString, nil
+	}
+
+	var data map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(response.SecretString), &data); err != nil {
+		return "", fmt.Errorf("aws-sm://%s is not a JSON object, so #%s can't be selected", name, key)
+	}
+	return selectSecretKey(data, key, "aws-sm://"+name)
+}
+
+// selectSecretKey returns the string value stored under key, or the only
+// value if key is empty.
+func selectSecretKey(data map[string]json.RawMessage, key, ref string) (string, error) {
+	if key == "" {
+		if len(data) != 1 {
+			keys := make([]string, 0, len(data))
+			for k := range data {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			return "", fmt.Errorf("%s holds %d values (%s); add #key to choose one", ref, len(data), strings.Join(keys, ", "))
+		}
+		for k := range data {
+			key = k
+		}
+	}
+
+	raw, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("%s has no key %q", ref, key)
+	}
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return "", fmt.Errorf("%s key %q is not a string", ref, key)
+	}
+	return value, nil
+}
+
+// doSecretRequest sends req and returns the body, converting non-2xx
+// responses into errors.
+func doSecretRequest(backend string, req *http.Request) ([]byte, error) {
+	resp, err := secretsHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s request failed: %w", backend, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s response: %w", backend, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%s returned status %d: %s", backend, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
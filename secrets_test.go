@@ -0,0 +1,100 @@
+package melanzana
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pashbylogan/melanzana/pkg/awssig"
+)
+
+func TestResolveSecrets(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "smtp_pass")
+	if err := os.WriteFile(secretFile, []byte("hunter2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "vault-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/melanzana": // KV version 2
+			w.Write([]byte(`{"data": {"data": {"apiKey": "sg-key", "other": "x"}, "metadata": {"version": 3}}}`))
+		case "/v1/kv/oauth": // KV version 1
+			w.Write([]byte(`{"data": {"refreshToken": "refresh"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer vault.Close()
+	t.Setenv("VAULT_ADDR", vault.URL)
+	t.Setenv("VAULT_TOKEN", "vault-token")
+
+	secretsManager := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct{ SecretId string }
+		json.NewDecoder(r.Body).Decode(&req)
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" || !strings.Contains(r.Header.Get("Authorization"), "/us-west-2/secretsmanager/") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"SecretString": `{"secret": "gcs-secret"}`, "Name": req.SecretId})
+	}))
+	defer secretsManager.Close()
+	defer func(old string) { secretsManagerEndpointFormat = old }(secretsManagerEndpointFormat)
+	secretsManagerEndpointFormat = secretsManager.URL + "/%s"
+
+	config := AppConfig{
+		SMTPPassword:       "file://" + secretFile,
+		EmailAPIKey:        "vault://secret/data/melanzana#apiKey",
+		OAuth2RefreshToken: "vault://kv/oauth",
+		GCSSecret:          "aws-sm://melanzana/gcs?region=us-west-2#secret",
+		OAuth2ClientSecret: "plain-value",
+		AWSAccessKeyID:     "AKIDEXAMPLE",
+		AWSSecretAccessKey: "aws-secret",
+	}
+	if err := resolveSecrets(&config); err != nil {
+		t.Fatalf("resolveSecrets() error = %v", err)
+	}
+
+	for name, got := range map[string][2]string{
+		"smtpPassword":       {config.SMTPPassword, "hunter2"},
+		"emailApiKey":        {config.EmailAPIKey, "sg-key"},
+		"oauth2RefreshToken": {config.OAuth2RefreshToken, "refresh"},
+		"gcsSecret":          {config.GCSSecret, "gcs-secret"},
+		"oauth2ClientSecret": {config.OAuth2ClientSecret, "plain-value"},
+	} {
+		if got[0] != got[1] {
+			t.Errorf("%s = %q, want %q", name, got[0], got[1])
+		}
+	}
+
+	for _, ref := range []string{
+		"file://" + filepath.Join(dir, "missing"),
+		"vault://secret/data/melanzana",         // two keys, none chosen
+		"vault://secret/data/melanzana#missing", // no such key
+		"vault://kv/missing",
+		"aws-sm://melanzana/gcs", // no region
+	} {
+		t.Run(ref, func(t *testing.T) {
+			t.Setenv("AWS_REGION", "")
+			if _, err := resolveSecret(ref, awssig.Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "aws-secret"}); err == nil {
+				t.Errorf("resolveSecret(%q) error = nil, want error", ref)
+			}
+		})
+	}
+}
+
+func TestRedactSecretsKeepsReferences(t *testing.T) {
+	config := redactSecrets(AppConfig{SMTPPassword: "hunter2", EmailAPIKey: "vault://secret/data/melanzana#apiKey"})
+	if config.SMTPPassword != redacted || config.EmailAPIKey != "vault://secret/data/melanzana#apiKey" {
+		t.Errorf("redactSecrets() = password %q, API key %q; want the password redacted and the reference kept",
+			config.SMTPPassword, config.EmailAPIKey)
+	}
+}
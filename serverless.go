@@ -0,0 +1,153 @@
+package melanzana
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// serverlessCycle runs one cycle for a serverless invocation and returns
+// its summary and exit code.
+type serverlessCycle func() (CycleSummary, int)
+
+// newServerlessCycle returns a serverlessCycle running config's cycles.
+func newServerlessCycle(config AppConfig) serverlessCycle {
+	return func() (CycleSummary, int) {
+		cycles := session.Cycles
+		code := runCycle(config)
+		followUps.drain()
+		if session.Cycles == cycles {
+			// The poll experiment skipped the cycle.
+			return CycleSummary{Status: "skipped", Finished: clock.Now()}, code
+		}
+		return session.LastCycle, code
+	}
+}
+
+// warnEphemeralState warns when state would be kept in files, which a
+// serverless platform doesn't keep between invocations.
+func warnEphemeralState(config AppConfig) {
+	if config.StateStore == "" || config.StateStore == "file" {
+		slog.Warn("State is kept in files, which may be lost between invocations; set stateStore to s3, gcs or dynamodb", "stateStore", config.StateStore)
+	}
+}
+
+// runLambda runs a cycle for each invocation of an AWS Lambda function
+// using a custom runtime, such as one on a schedule. It returns only if
+// the Lambda runtime API fails.
+func runLambda(config AppConfig) int {
+	api := os.Getenv("AWS_LAMBDA_RUNTIME_API")
+	if api == "" {
+		slog.Error("AWS_LAMBDA_RUNTIME_API isn't set; the lambda command runs only inside AWS Lambda")
+		return exitConfigError
+	}
+	warnEphemeralState(config)
+	err := serveLambda(&http.Client{}, "http://"+api+"/2018-06-01/runtime/invocation/", newServerlessCycle(config))
+	slog.Error("Lambda runtime API failed", "err", err)
+	return exitConfigError
+}
+
+// serveLambda answers invocations from the Lambda runtime API at base until
+// it fails. Each invocation's response is the cycle summary. Configuration
+// errors fail the invocation, so they show up in the function's error
+// metrics; other errors are reported in the summary, as the next scheduled
+// invocation retries anyway.
+func serveLambda(client *http.Client, base string, cycle serverlessCycle) error {
+	for {
+		// Waits, without a timeout, until there is an invocation.
+		resp, err := client.Get(base + "next")
+		if err != nil {
+			return fmt.Errorf("failed to get the next invocation: %w", err)
+		}
+		io.Copy(io.Discard, resp.Body) // The scheduled event isn't used
+		resp.Body.Close()
+		id := resp.Header.Get("Lambda-Runtime-Aws-Request-Id")
+		if resp.StatusCode != http.StatusOK || id == "" {
+			return fmt.Errorf("runtime API returned status %d for the next invocation", resp.StatusCode)
+		}
+
+		summary, code := cycle()
+		path, body := id+"/response", any(summary)
+		if code == exitConfigError {
+			path, body = id+"/error", map[string]string{"errorType": "ConfigError", "errorMessage": summary.Error}
+		}
+		data, _ := json.Marshal(body)
+		resp, err = client.Post(base+path, "application/json", bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("failed to report invocation %s: %w", id, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusAccepted {
+			return fmt.Errorf("runtime API returned status %d for the result of invocation %s", resp.StatusCode, id)
+		}
+	}
+}
+
+// runFunction serves HTTP on $PORT, running a cycle for each request, for
+// platforms that invoke a function or container over HTTP, such as Google
+// Cloud Functions and Cloud Run triggered by Cloud Scheduler. It refuses to
+// start without functionSecret unless functionAllowAnyone is set.
+func runFunction(config AppConfig) int {
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+	if config.FunctionSecret == "" {
+		if !config.FunctionAllowAnyone {
+			slog.Error("The function command needs functionSecret, or functionAllowAnyone if the platform authenticates requests itself")
+			return exitConfigError
+		}
+		slog.Warn("No functionSecret set: anyone who can reach the function can trigger checks")
+	}
+	warnEphemeralState(config)
+	server := &http.Server{Addr: ":" + port, Handler: functionHandler(config.FunctionSecret, newServerlessCycle(config)), ReadHeaderTimeout: 10 * time.Second}
+	slog.Info("Running a check per request", "addr", server.Addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("Function server stopped", "err", err)
+	}
+	return exitConfigError
+}
+
+// functionSecretHeader carries functionSecret on requests to the function.
+const functionSecretHeader = "X-Melanzana-Secret"
+
+// functionHandler runs a cycle per POST to /, one at a time, and replies
+// with its summary: 200 if it succeeded, 500 for a configuration error, and
+// 502 if availability or notifications failed. With a secret, requests not
+// sending it in functionSecretHeader are refused.
+func functionHandler(secret string, cycle serverlessCycle) http.Handler {
+	var mu sync.Mutex
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path != "/":
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+			return
+		case r.Method != http.MethodPost:
+			w.Header().Set("Allow", http.MethodPost)
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "checks are run by POST"})
+			return
+		case secret != "" && !tokenMatches(r.Header.Get(functionSecretHeader), secret):
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "a valid " + functionSecretHeader + " header is required"})
+			return
+		}
+		mu.Lock()
+		summary, code := cycle()
+		mu.Unlock()
+		status := http.StatusOK
+		switch code {
+		case exitOK:
+		case exitConfigError:
+			status = http.StatusInternalServerError
+		default:
+			status = http.StatusBadGateway
+		}
+		writeJSON(w, status, summary)
+	})
+}
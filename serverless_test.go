@@ -0,0 +1,115 @@
+package melanzana
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServeLambda(t *testing.T) {
+	var invocations int
+	reports := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/2018-06-01/runtime/invocation/")
+		if path == "next" {
+			invocations++
+			if invocations > 2 {
+				http.Error(w, "shutting down", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Lambda-Runtime-Aws-Request-Id", []string{"", "req-1", "req-2"}[invocations])
+			w.Write([]byte(`{"source": "aws.events"}`))
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		reports[path] = string(body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	results := []struct {
+		summary CycleSummary
+		code    int
+	}{
+		{CycleSummary{Status: "ok", SlotsFound: 3}, exitOK},
+		{CycleSummary{Status: "config error", Error: "unknown calendar"}, exitConfigError},
+	}
+	cycle := func() (CycleSummary, int) {
+		r := results[0]
+		results = results[1:]
+		return r.summary, r.code
+	}
+	err := serveLambda(server.Client(), server.URL+"/2018-06-01/runtime/invocation/", cycle)
+	if err == nil || !strings.Contains(err.Error(), "status 500") {
+		t.Errorf("serveLambda() error = %v, want the failed next invocation", err)
+	}
+
+	var summary CycleSummary
+	if err := json.Unmarshal([]byte(reports["req-1/response"]), &summary); err != nil || summary.SlotsFound != 3 {
+		t.Errorf("req-1 response = %q, want the cycle summary", reports["req-1/response"])
+	}
+	if !strings.Contains(reports["req-2/error"], `"errorMessage":"unknown calendar"`) {
+		t.Errorf("req-2 error = %q, want the configuration error", reports["req-2/error"])
+	}
+}
+
+func TestFunctionHandler(t *testing.T) {
+	tests := []struct {
+		code int
+		want int
+	}{
+		{exitOK, http.StatusOK},
+		{exitConfigError, http.StatusInternalServerError},
+		{exitFetchError, http.StatusBadGateway},
+		{exitNotifyError, http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		handler := functionHandler("", func() (CycleSummary, int) { return CycleSummary{ExitCode: tt.code}, tt.code })
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+		var summary CycleSummary
+		if rec.Code != tt.want || json.Unmarshal(rec.Body.Bytes(), &summary) != nil || summary.ExitCode != tt.code {
+			t.Errorf("exit code %d: response %d %s, want %d with the summary", tt.code, rec.Code, rec.Body, tt.want)
+		}
+	}
+
+	// Only the scheduler's request, with the secret, runs a cycle.
+	cycles := 0
+	handler := functionHandler("s3cret", func() (CycleSummary, int) { cycles++; return CycleSummary{}, exitOK })
+	request := func(method, path, secret string) *http.Request {
+		r := httptest.NewRequest(method, path, nil)
+		if secret != "" {
+			r.Header.Set(functionSecretHeader, secret)
+		}
+		return r
+	}
+	for _, tt := range []struct {
+		name string
+		req  *http.Request
+		want int
+	}{
+		{"OtherPath", request(http.MethodPost, "/favicon.ico", "s3cret"), http.StatusNotFound},
+		{"Get", request(http.MethodGet, "/", "s3cret"), http.StatusMethodNotAllowed},
+		{"NoSecret", request(http.MethodPost, "/", ""), http.StatusUnauthorized},
+		{"WrongSecret", request(http.MethodPost, "/", "guess"), http.StatusUnauthorized},
+		{"Scheduler", request(http.MethodPost, "/", "s3cret"), http.StatusOK},
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, tt.req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+	if cycles != 1 {
+		t.Errorf("ran %d cycles, want only the scheduler's", cycles)
+	}
+}
+
+func TestRunFunctionRequiresSecret(t *testing.T) {
+	if code := runFunction(AppConfig{}); code != exitConfigError {
+		t.Errorf("runFunction() without functionSecret = %d, want %d", code, exitConfigError)
+	}
+}
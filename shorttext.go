@@ -0,0 +1,125 @@
+package melanzana
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// textLimit is how long a message on a length-limited channel may be.
+type textLimit struct {
+	maxLength int  // In characters; 0 is no limit
+	gsm       bool // Text messages: written in the GSM 7-bit alphabet where possible
+}
+
+// channelLimit returns the limit on messages sent through kind.
+func channelLimit(config AppConfig, kind string) textLimit {
+	switch kind {
+	case channelSMS:
+		return textLimit{maxLength: config.SMSMaxLength, gsm: true}
+	case channelTelegram:
+		return textLimit{maxLength: config.TelegramMaxLength}
+	}
+	return textLimit{}
+}
+
+// shortText is a notification shortened for a text or Telegram message:
+// the subject, the slots and the booking link. If it would be longer than
+// limit allows, the earliest slots that fit are listed, followed by how
+// many more there are and, if r has one, that the email has them all.
+func shortText(n Notification, r Recipient, limit textLimit) string {
+	more := "+%d more"
+	if r.Email != "" {
+		more = "+%d more, see email"
+	}
+	total := len(n.Appointments) + len(n.Removed)
+	for listed := total; ; listed-- {
+		text := limit.prepare(shortTextListing(n, listed, more))
+		length := limit.length(text)
+		if limit.maxLength == 0 || length <= limit.maxLength {
+			return text
+		}
+		if listed == 0 {
+			// Even the subject alone is too long.
+			return limit.truncate(text)
+		}
+	}
+}
+
+// shortTextListing writes n listing its first listed slots, new ones
+// before those gone, and the number of others with more.
+func shortTextListing(n Notification, listed int, more string) string {
+	var b strings.Builder
+	b.WriteString(n.Subject)
+	list := func(appointments []Appointment) {
+		for _, appt := range appointments[:min(listed, len(appointments))] {
+			fmt.Fprintf(&b, "\n%s %s%s", appt.Date, appt.Time, calendarSuffix(appt))
+		}
+		listed = max(listed-len(appointments), 0)
+	}
+	omitted := len(n.Appointments) + len(n.Removed) - listed
+	list(n.Appointments)
+	if len(n.Removed) > 0 && listed > 0 {
+		b.WriteString("\nNo longer available:")
+		list(n.Removed)
+	}
+	if omitted > 0 {
+		fmt.Fprintf(&b, "\n"+more, omitted)
+	}
+	if len(n.Appointments) > 0 {
+		b.WriteString("\nBook: " + bookingURL)
+	}
+	return b.String()
+}
+
+// gsmBasic and gsmExtension are the GSM 7-bit default alphabet and its
+// extension table, whose characters take two of a text message's 160.
+const (
+	gsmBasic     = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+	gsmExtension = "\f^{}\\[~]|€"
+)
+
+// gsmReplacer swaps the typographic characters in subjects and slot times
+// for GSM ones. A single character outside the alphabet makes the whole
+// message UCS-2, which fits 70 characters rather than 160 in each part.
+var gsmReplacer = strings.NewReplacer(
+	"–", "-", "—", "-", "‘", "'", "’", "'", "“", "\"", "”", "\"", "…", "...", "\u00a0", " ",
+)
+
+// prepare rewrites text in the GSM alphabet if limit calls for it.
+func (l textLimit) prepare(text string) string {
+	if !l.gsm {
+		return text
+	}
+	return gsmReplacer.Replace(text)
+}
+
+// length returns text's length against l.maxLength. Text messages that
+// still aren't GSM are sent in UTF-16, so they count as if 160 characters
+// were 70.
+func (l textLimit) length(text string) int {
+	if !l.gsm {
+		return len([]rune(text))
+	}
+	n := 0
+	for _, r := range text {
+		switch {
+		case strings.ContainsRune(gsmBasic, r):
+			n++
+		case strings.ContainsRune(gsmExtension, r):
+			n += 2
+		default:
+			return (len(utf16.Encode([]rune(text)))*160 + 69) / 70
+		}
+	}
+	return n
+}
+
+// truncate cuts text down to l.maxLength.
+func (l textLimit) truncate(text string) string {
+	runes := []rune(text)
+	for len(runes) > 0 && l.length(string(runes)+"...") > l.maxLength {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
@@ -0,0 +1,111 @@
+package melanzana
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestShortText(t *testing.T) {
+	slots := func(n int) []Appointment {
+		var appointments []Appointment
+		for day := 1; day <= n; day++ {
+			appointments = append(appointments, Appointment{Date: fmt.Sprintf("2099-07-%02d", day), Time: "10:00 am – 10:30 am", Spaces: 1})
+		}
+		return appointments
+	}
+	sms := textLimit{maxLength: 160, gsm: true}
+	emailed := Recipient{Email: "grandma@example.com"}
+
+	tests := []struct {
+		name  string
+		n     Notification
+		r     Recipient
+		limit textLimit
+		want  string
+	}{
+		{
+			name:  "Fits",
+			n:     Notification{Subject: "New slots", Appointments: slots(1)},
+			limit: sms,
+			want:  "New slots\n2099-07-01 10:00 am - 10:30 am\nBook: " + bookingURL,
+		},
+		{
+			name:  "TelegramKeepsDashes",
+			n:     Notification{Subject: "New slots", Appointments: slots(1)},
+			limit: textLimit{maxLength: 4096},
+			want:  "New slots\n2099-07-01 10:00 am – 10:30 am\nBook: " + bookingURL,
+		},
+		{
+			name:  "EarliestSlotsThenSeeEmail",
+			n:     Notification{Subject: "New slots", Appointments: slots(6)},
+			r:     emailed,
+			limit: sms,
+			want:  "New slots\n2099-07-01 10:00 am - 10:30 am\n2099-07-02 10:00 am - 10:30 am\n+4 more, see email\nBook: " + bookingURL,
+		},
+		{
+			name:  "NoEmailToSee",
+			n:     Notification{Subject: "New slots", Appointments: slots(6)},
+			limit: sms,
+			want:  "New slots\n2099-07-01 10:00 am - 10:30 am\n2099-07-02 10:00 am - 10:30 am\n2099-07-03 10:00 am - 10:30 am\n+3 more\nBook: " + bookingURL,
+		},
+		{
+			name:  "RemovedLeftOutFirst",
+			n:     Notification{Subject: "Slots changed", Appointments: slots(1), Removed: slots(3)[1:]},
+			r:     emailed,
+			limit: textLimit{maxLength: 170, gsm: true},
+			want:  "Slots changed\n2099-07-01 10:00 am - 10:30 am\nNo longer available:\n2099-07-02 10:00 am - 10:30 am\n+1 more, see email\nBook: " + bookingURL,
+		},
+		{
+			name:  "UCS2",
+			n:     Notification{Subject: "Nowe terminy 🍆", Appointments: slots(3)},
+			r:     emailed,
+			limit: textLimit{maxLength: 320, gsm: true},
+			want:  "Nowe terminy 🍆\n2099-07-01 10:00 am - 10:30 am\n+2 more, see email\nBook: " + bookingURL,
+		},
+		{
+			name:  "NoLimit",
+			n:     Notification{Subject: "New slots", Appointments: slots(20)},
+			limit: textLimit{gsm: true},
+		},
+		{
+			name:  "SubjectTooLong",
+			n:     Notification{Subject: strings.Repeat("slots ", 40)},
+			limit: sms,
+			want:  strings.Repeat("slots ", 26) + "s...",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := shortText(tt.n, tt.r, tt.limit)
+			if tt.want != "" && got != tt.want {
+				t.Errorf("shortText() = %q, want %q", got, tt.want)
+			}
+			if length := tt.limit.length(got); tt.limit.maxLength > 0 && length > tt.limit.maxLength {
+				t.Errorf("shortText() is %d characters, over the limit of %d", length, tt.limit.maxLength)
+			}
+			if tt.limit.maxLength == 0 && strings.Contains(got, "more") {
+				t.Errorf("shortText() without a limit = %q, want every slot", got)
+			}
+		})
+	}
+}
+
+func TestTextLimitLength(t *testing.T) {
+	sms := textLimit{gsm: true}
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"Pause 1w", 8},
+		{"Café Ñoño", 9}, // All in the GSM alphabet
+		{"Cost: 5€ [a]", 15},
+		{"Zażółć", 14}, // UTF-16: 6 characters, of the 70 that fit where 160 GSM ones would
+		{"🍆", 5},       // Two UTF-16 units
+	}
+	for _, tt := range tests {
+		if got := sms.length(tt.text); got != tt.want {
+			t.Errorf("length(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
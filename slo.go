@@ -0,0 +1,255 @@
+package melanzana
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SLOConfig declares a notification latency objective, e.g. "95% of new
+// slots notified within 120s of being observed".
+type SLOConfig struct {
+	Target           float64 `json:"target"`           // Fraction of new slots to notify within thresholdSeconds, e.g. 0.95; 0 disables tracking
+	ThresholdSeconds int     `json:"thresholdSeconds"` // Allowed time from a slot being fetched to its notification being sent
+	WindowHours      int     `json:"windowHours"`      // Period the objective is measured over
+	AlertBurnRate    float64 `json:"alertBurnRate"`    // Alert alertEmail when the error budget is used this many times faster than sustainable; 0 never alerts
+	StateFile        string  `json:"stateFile"`        // Where notification latencies are kept between runs
+	MetricsFile      string  `json:"metricsFile"`      // Prometheus text file rewritten after each cycle, e.g. for node_exporter's textfile collector
+}
+
+func defaultSLOConfig() SLOConfig {
+	return SLOConfig{ThresholdSeconds: 120, WindowHours: 24, AlertBurnRate: 2, StateFile: "slo_state.json"}
+}
+
+func (c SLOConfig) enabled() bool {
+	return c.Target > 0
+}
+
+func (c SLOConfig) threshold() time.Duration {
+	return time.Duration(c.ThresholdSeconds) * time.Second
+}
+
+func (c SLOConfig) window() time.Duration {
+	return time.Duration(c.WindowHours) * time.Hour
+}
+
+// validate checks that an enabled objective can be measured.
+func (c SLOConfig) validate() error {
+	if !c.enabled() {
+		return nil
+	}
+	if c.Target >= 1 {
+		return fmt.Errorf("slo.target must be below 1 to leave an error budget, got %g", c.Target)
+	}
+	if c.ThresholdSeconds < 1 || c.WindowHours < 1 {
+		return fmt.Errorf("slo.thresholdSeconds and slo.windowHours must be positive")
+	}
+	if c.AlertBurnRate < 0 {
+		return fmt.Errorf("slo.alertBurnRate must not be negative, got %g", c.AlertBurnRate)
+	}
+	return nil
+}
+
+// SLOState holds the latency of each notified slot within the SLO window.
+type SLOState struct {
+	Samples     []SLOSample `json:"samples"`
+	LastAlertAt time.Time   `json:"lastAlertAt,omitempty"`
+}
+
+// SLOSample is one new slot's path from observation to notification.
+type SLOSample struct {
+	ObservedAt time.Time `json:"observedAt"`
+	NotifiedAt time.Time `json:"notifiedAt,omitempty"` // Zero if every send failed
+}
+
+// good reports whether the slot was notified within threshold.
+func (s SLOSample) good(threshold time.Duration) bool {
+	return !s.NotifiedAt.IsZero() && s.NotifiedAt.Sub(s.ObservedAt) <= threshold
+}
+
+// loadSLOState reads SLO state from path, returning empty state if the file doesn't exist.
+func loadSLOState(path string) (*SLOState, error) {
+	state := &SLOState{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("failed to read SLO state %s: %w", path, err)
+	}
+	if len(data) == 0 {
+		return state, nil
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse SLO state %s: %w", path, err)
+	}
+	return state, nil
+}
+
+// saveSLOState writes SLO state to path.
+func saveSLOState(state *SLOState, path string) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal SLO state: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write SLO state %s: %w", path, err)
+	}
+	return nil
+}
+
+// recordSLOSamples records that appointments were notified at notifiedAt, or
+// that sending them failed if delivered is false.
+func recordSLOSamples(config AppConfig, appointments []Appointment, notifiedAt time.Time, delivered bool) {
+	if !config.SLO.enabled() || config.ReadOnly || config.DryRun {
+		return
+	}
+	state, err := loadSLOState(config.SLO.StateFile)
+	if err != nil {
+		slog.Warn("Error loading SLO state, starting fresh", "err", err)
+		state = &SLOState{}
+	}
+	for _, appt := range appointments {
+		if appt.ObservedAt.IsZero() {
+			continue
+		}
+		sample := SLOSample{ObservedAt: appt.ObservedAt}
+		if delivered {
+			sample.NotifiedAt = notifiedAt
+		}
+		state.Samples = append(state.Samples, sample)
+	}
+	if err := saveSLOState(state, config.SLO.StateFile); err != nil {
+		slog.Error("Error saving SLO state", "err", err)
+	}
+}
+
+// SLOReport summarises the samples within the SLO window.
+type SLOReport struct {
+	Total           int
+	Good            int
+	Compliance      float64 // Fraction of samples within the threshold; 1 with no samples
+	BurnRate        float64 // How many times faster than sustainable the error budget is being used
+	BudgetRemaining float64 // Fraction of the window's error budget left; negative once exceeded
+}
+
+// report drops samples older than the window and summarises the rest.
+func (s *SLOState) report(c SLOConfig, now time.Time) SLOReport {
+	cutoff := now.Add(-c.window())
+	kept := s.Samples[:0]
+	for _, sample := range s.Samples {
+		if !sample.ObservedAt.Before(cutoff) {
+			kept = append(kept, sample)
+		}
+	}
+	s.Samples = kept
+
+	r := SLOReport{Total: len(kept), Compliance: 1, BudgetRemaining: 1}
+	for _, sample := range kept {
+		if sample.good(c.threshold()) {
+			r.Good++
+		}
+	}
+	if r.Total > 0 {
+		r.Compliance = float64(r.Good) / float64(r.Total)
+		r.BurnRate = (1 - r.Compliance) / (1 - c.Target)
+		r.BudgetRemaining = 1 - r.BurnRate
+	}
+	return r
+}
+
+// atRisk reports whether the burn rate has reached the alert threshold.
+func (r SLOReport) atRisk(c SLOConfig) bool {
+	return c.AlertBurnRate > 0 && r.Total > 0 && r.BurnRate >= c.AlertBurnRate
+}
+
+func (r SLOReport) String() string {
+	return fmt.Sprintf("%d of %d new slots (%.1f%%) notified in time, burn rate %.2f, %.0f%% of error budget left",
+		r.Good, r.Total, 100*r.Compliance, r.BurnRate, 100*r.BudgetRemaining)
+}
+
+// checkSLO evaluates the objective after a cycle: it logs the result,
+// rewrites the metrics file and alerts the operator, at most once per
+// window, when the objective is at risk.
+func checkSLO(config AppConfig, now time.Time) {
+	if !config.SLO.enabled() {
+		return
+	}
+	c := config.SLO
+	state, err := loadSLOState(c.StateFile)
+	if err != nil {
+		slog.Error("Error loading SLO state", "err", err)
+		return
+	}
+	report := state.report(c, now)
+	slog.Info("SLO", "target", fmt.Sprintf("%.1f%%", 100*c.Target), "threshold", c.threshold(), "window", c.window(), "report", report.String())
+
+	if c.MetricsFile != "" {
+		if err := writeSLOMetricsFile(c.MetricsFile, c, report); err != nil {
+			slog.Error("Error writing SLO metrics", "err", err)
+		}
+	}
+
+	if report.atRisk(c) && now.Sub(state.LastAlertAt) >= c.window() {
+		slog.Error("ALERT: notification latency SLO at risk", "report", report.String())
+		if !config.DryRun {
+			body := fmt.Sprintf("The Melanzana scraper is missing its notification latency objective of %.1f%% of new slots notified within %v.\n\n"+
+				"Over the last %v, %s.\n\nAt a burn rate of %.2f the error budget for the window lasts %v.",
+				100*c.Target, c.threshold(), c.window(), report, report.BurnRate,
+				(time.Duration(float64(c.window()) / report.BurnRate)).Round(time.Minute))
+			sendAlert(config, "Melanzana scraper: notification latency SLO at risk", body)
+		}
+		state.LastAlertAt = now
+	}
+
+	if config.ReadOnly || config.DryRun {
+		return
+	}
+	if err := saveSLOState(state, c.StateFile); err != nil {
+		slog.Error("Error saving SLO state", "err", err)
+	}
+}
+
+// writeSLOMetrics writes the report in the Prometheus text exposition format.
+func writeSLOMetrics(w io.Writer, c SLOConfig, r SLOReport) error {
+	var b strings.Builder
+	gauge := func(name, help string, value float64) {
+		fmt.Fprintf(&b, "# HELP melanzana_slo_%s %s\n# TYPE melanzana_slo_%s gauge\nmelanzana_slo_%s %g\n", name, help, name, name, value)
+	}
+	gauge("target", "Fraction of new slots that should be notified within the threshold.", c.Target)
+	gauge("threshold_seconds", "Allowed time from a slot being observed to its notification.", float64(c.ThresholdSeconds))
+	gauge("window_seconds", "Period the objective is measured over.", c.window().Seconds())
+	gauge("slots", "New slots notified, or whose notification failed, within the window.", float64(r.Total))
+	gauge("slots_good", "New slots notified within the threshold, within the window.", float64(r.Good))
+	gauge("compliance", "Fraction of new slots notified within the threshold.", r.Compliance)
+	gauge("burn_rate", "Error budget consumption relative to the sustainable rate.", r.BurnRate)
+	gauge("error_budget_remaining", "Fraction of the window's error budget left.", r.BudgetRemaining)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeSLOMetricsFile replaces path with the current metrics. The file is
+// renamed into place so a collector never reads a partial file.
+func writeSLOMetricsFile(path string, c SLOConfig, r SLOReport) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create metrics file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := writeSLOMetrics(tmp, c, r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
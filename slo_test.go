@@ -0,0 +1,106 @@
+package melanzana
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSLOConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*SLOConfig)
+		wantErr bool
+	}{
+		{"Disabled", func(c *SLOConfig) {}, false},
+		{"Enabled", func(c *SLOConfig) { c.Target = 0.95 }, false},
+		{"NoBudget", func(c *SLOConfig) { c.Target = 1 }, true},
+		{"NoThreshold", func(c *SLOConfig) { c.Target = 0.95; c.ThresholdSeconds = 0 }, true},
+		{"NegativeBurnRate", func(c *SLOConfig) { c.Target = 0.95; c.AlertBurnRate = -1 }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := defaultSLOConfig()
+			tt.modify(&c)
+			if err := c.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSLOReport(t *testing.T) {
+	c := SLOConfig{Target: 0.9, ThresholdSeconds: 120, WindowHours: 24}
+	now := time.Date(2024, 6, 2, 12, 0, 0, 0, time.UTC)
+	observed := now.Add(-time.Hour)
+
+	state := &SLOState{}
+	for i := 0; i < 8; i++ {
+		state.Samples = append(state.Samples, SLOSample{ObservedAt: observed, NotifiedAt: observed.Add(30 * time.Second)})
+	}
+	state.Samples = append(state.Samples,
+		SLOSample{ObservedAt: observed, NotifiedAt: observed.Add(5 * time.Minute)}, // too slow
+		SLOSample{ObservedAt: observed},                                            // send failed
+		SLOSample{ObservedAt: now.Add(-48 * time.Hour)},                            // outside the window
+	)
+
+	r := state.report(c, now)
+	if r.Total != 10 || r.Good != 8 {
+		t.Fatalf("report() = %d of %d good, want 8 of 10", r.Good, r.Total)
+	}
+	if len(state.Samples) != 10 {
+		t.Errorf("report() kept %d samples, want the 10 within the window", len(state.Samples))
+	}
+	if math.Abs(r.Compliance-0.8) > 1e-9 || math.Abs(r.BurnRate-2) > 1e-9 || math.Abs(r.BudgetRemaining+1) > 1e-9 {
+		t.Errorf("report() = compliance %g, burn rate %g, budget %g; want 0.8, 2, -1", r.Compliance, r.BurnRate, r.BudgetRemaining)
+	}
+	if !r.atRisk(SLOConfig{AlertBurnRate: 2}) || r.atRisk(SLOConfig{AlertBurnRate: 3}) {
+		t.Errorf("atRisk() wrong for burn rate %g", r.BurnRate)
+	}
+
+	if empty := (&SLOState{}).report(c, now); empty.Compliance != 1 || empty.BurnRate != 0 || empty.atRisk(SLOConfig{AlertBurnRate: 1}) {
+		t.Errorf("report() with no samples = %+v, want full compliance and no risk", empty)
+	}
+}
+
+func TestCheckSLO(t *testing.T) {
+	dir := t.TempDir()
+	config := AppConfig{SLO: defaultSLOConfig()}
+	config.SLO.Target = 0.95
+	config.SLO.StateFile = filepath.Join(dir, "slo.json")
+	config.SLO.MetricsFile = filepath.Join(dir, "melanzana.prom")
+	now := time.Date(2024, 6, 2, 12, 0, 0, 0, time.UTC)
+
+	observed := now.Add(-10 * time.Minute)
+	recordSLOSamples(config, []Appointment{{Date: "2024-06-10", ObservedAt: observed}}, observed.Add(10*time.Second), true)
+	recordSLOSamples(config, []Appointment{{Date: "2024-06-11", ObservedAt: observed}, {Date: "2024-06-12"}}, observed.Add(10*time.Second), false)
+
+	checkSLO(config, now)
+
+	metrics, err := os.ReadFile(config.SLO.MetricsFile)
+	if err != nil {
+		t.Fatalf("metrics file not written: %v", err)
+	}
+	for _, want := range []string{"melanzana_slo_slots 2\n", "melanzana_slo_slots_good 1\n", "melanzana_slo_compliance 0.5\n", "# TYPE melanzana_slo_compliance gauge\n"} {
+		if !strings.Contains(string(metrics), want) {
+			t.Errorf("metrics file missing %q:\n%s", want, metrics)
+		}
+	}
+
+	state, err := loadSLOState(config.SLO.StateFile)
+	if err != nil {
+		t.Fatalf("loadSLOState() error = %v", err)
+	}
+	if !state.LastAlertAt.Equal(now) {
+		t.Errorf("LastAlertAt = %v, want the alert recorded at %v", state.LastAlertAt, now)
+	}
+
+	// A later check within the window doesn't alert again.
+	checkSLO(config, now.Add(time.Hour))
+	if state, _ := loadSLOState(config.SLO.StateFile); !state.LastAlertAt.Equal(now) {
+		t.Errorf("LastAlertAt = %v after a second check, want it unchanged", state.LastAlertAt)
+	}
+}
@@ -0,0 +1,176 @@
+package melanzana
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"time"
+)
+
+// savedSnapshot returns the saved slots as a Snapshot to diff against.
+func savedSnapshot(s *AvailabilitySnapshot) Snapshot {
+	d := newSnapshot(s.Open)
+	for _, appt := range s.Booked {
+		d[slotKey{appt.Date, appt.Time, appt.Calendar}] = snapshotSlot{Booked: true}
+	}
+	return d
+}
+
+// nextAvailabilitySnapshot returns the snapshot after a check at now found
+// scraped, with changes from previous. Booked slots are kept until their
+// day passes, as until then they may reopen.
+func nextAvailabilitySnapshot(previous Snapshot, scraped []Appointment, changes []Change, now time.Time) *AvailabilitySnapshot {
+	today := now.In(sourceLocation()).Format("2006-01-02")
+	open := newSlotSet(scraped)
+	booked := map[slotKey]bool{}
+	for key, prev := range previous {
+		if prev.Booked && key.date >= today {
+			booked[key] = true
+		}
+	}
+	for _, c := range changes {
+		if c.Kind == SlotRemoved && !c.Expired {
+			booked[slotKey{c.Slot.Date, c.Slot.Time, c.Slot.Calendar}] = true
+		}
+	}
+
+	s := &AvailabilitySnapshot{At: now, Open: scraped}
+	for key := range booked {
+		if _, reopened := open[key]; !reopened {
+			s.Booked = append(s.Booked, Appointment{Date: key.date, Time: key.time, Calendar: key.calendar})
+		}
+	}
+	sort.Slice(s.Booked, func(i, j int) bool { return appointmentKey(s.Booked[i]) < appointmentKey(s.Booked[j]) })
+	if s.Open == nil {
+		s.Open = []Appointment{}
+	}
+	return s
+}
+
+// carryForward returns scraped with the slots that were open before in the
+// months the check missed, as they were, so that a month that couldn't be
+// read doesn't look fully booked. They come from saved if there is one,
+// since it has the slots in full, and otherwise from previous.
+func carryForward(scraped []Appointment, missed fetchGaps, saved *AvailabilitySnapshot, previous Snapshot) []Appointment {
+	if len(missed) == 0 {
+		return scraped
+	}
+	var open []Appointment
+	if saved != nil {
+		open = saved.Open
+	} else {
+		for key, slot := range previous {
+			if !slot.Booked {
+				open = append(open, Appointment{Date: key.date, Time: key.time, Calendar: key.calendar, Spaces: slot.Spaces, IsAvailable: true})
+			}
+		}
+		sort.Slice(open, func(i, j int) bool { return appointmentKey(open[i]) < appointmentKey(open[j]) })
+	}
+	current := slices.Clip(scraped)
+	for _, appt := range open {
+		if missed.has(appt.Calendar, appt.Date) {
+			current = append(current, appt)
+		}
+	}
+	return current
+}
+
+// errNoSnapshot is returned by checkChanges' update of the snapshot when
+// there is none, so the history is replayed without holding the store.
+var errNoSnapshot = errors.New("no availability snapshot saved")
+
+// replayHistory returns what the availability history replays to, for
+// watches without a snapshot.
+func replayHistory(store Store) (Snapshot, error) {
+	history, err := store.History()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load availability history: %w", err)
+	}
+	return historySnapshot(availabilityState(history)), nil
+}
+
+// checkChanges returns the changes from what the watch knew before to
+// scraped, found at now, and saves the snapshot the next check compares
+// with. Slots in months that weren't read, in missed, are carried forward
+// unchanged. Until a snapshot is saved, the availability history is replayed
+// instead. Instances sharing the store take turns: each compares with the
+// snapshot the last one saved, so a change is found by one of them only.
+// If the snapshot couldn't be saved, the changes are returned with the
+// error.
+func checkChanges(config AppConfig, store Store, scraped []Appointment, missed fetchGaps, now time.Time) ([]Change, error) {
+	var changes []Change
+	var replayed Snapshot
+	next := func(saved *AvailabilitySnapshot) (*AvailabilitySnapshot, error) {
+		previous := replayed
+		switch {
+		case saved != nil:
+			previous = savedSnapshot(saved)
+		case replayed == nil:
+			return nil, errNoSnapshot
+		}
+		current := carryForward(scraped, missed, saved, previous)
+		changes = diffSnapshots(previous, current, now)
+		return nextAvailabilitySnapshot(previous, current, changes, now), nil
+	}
+	replay := func() error {
+		var err error
+		if replayed, err = replayHistory(store); err == nil && replayed == nil {
+			replayed = Snapshot{}
+		}
+		return err
+	}
+
+	if config.SnapshotFile == "" || config.ReadOnly {
+		var saved *AvailabilitySnapshot
+		if config.SnapshotFile != "" {
+			var err error
+			if saved, err = store.Snapshot(); err != nil {
+				return nil, err
+			}
+			slog.Info("Read-only mode: not saving availability snapshot", "snapshot", config.SnapshotFile)
+		}
+		if saved == nil {
+			if err := replay(); err != nil {
+				return nil, err
+			}
+		}
+		_, err := next(saved)
+		return changes, err
+	}
+
+	err := store.UpdateSnapshot(next)
+	if errors.Is(err, errNoSnapshot) {
+		if err := replay(); err != nil {
+			return nil, err
+		}
+		err = store.UpdateSnapshot(next)
+	}
+	return changes, err
+}
+
+// restoreLatestScrape serves the saved snapshot's open slots from the API
+// until the first check finishes.
+func restoreLatestScrape(config AppConfig) {
+	if config.SnapshotFile == "" {
+		return
+	}
+	store, err := newStore(config)
+	if err != nil {
+		slog.Warn("Error opening the state store to restore availability", "err", err)
+		return
+	}
+	saved, err := store.Snapshot()
+	if err != nil {
+		slog.Warn("Error loading availability snapshot", "err", err)
+		return
+	}
+	if saved == nil {
+		return
+	}
+	if _, at := latestScrape.get(); at.IsZero() {
+		latestScrape.update(saved.Open, saved.At)
+		slog.Info("Restored the last known availability", "count", len(saved.Open), "checked", saved.At.Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,190 @@
+package melanzana
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pashbylogan/melanzana/pkg/store"
+)
+
+func TestAvailabilitySnapshot(t *testing.T) {
+	defer func(tz string) { sourceTimezone = tz }(sourceTimezone)
+	sourceTimezone = "America/Denver"
+	day1 := time.Date(2024, 5, 15, 15, 0, 0, 0, time.UTC)
+	slot := func(date string, spaces int) Appointment {
+		return Appointment{Date: date, Time: "10:00 am – 10:30 am", Spaces: spaces, IsAvailable: true}
+	}
+	dir := t.TempDir()
+	config := AppConfig{SnapshotFile: filepath.Join(dir, "snapshot.json")}
+	newFileStore := func() *store.JSONFile {
+		return &store.JSONFile{Path: filepath.Join(dir, "seen.json"), HistoryPath: filepath.Join(dir, "history.jsonl"), SnapshotPath: config.SnapshotFile}
+	}
+	store := newFileStore()
+
+	// Each cycle diffs against the snapshot saved by the one before, as
+	// after a restart, and the history is never read.
+	cycle := func(now time.Time, scraped ...Appointment) []string {
+		t.Helper()
+		changes, err := checkChanges(config, newFileStore(), scraped, nil, now)
+		if err != nil {
+			t.Fatalf("checkChanges() error = %v", err)
+		}
+		var kinds []string
+		for _, e := range historyEvents(changes, now) {
+			kinds = append(kinds, e.Date+" "+e.Kind)
+		}
+		return kinds
+	}
+
+	// Before the snapshot is saved, the history is replayed.
+	if err := store.AppendHistory([]AvailabilityEvent{{At: day1, Kind: eventAppeared, Date: "2024-05-15", Time: "10:00 am – 10:30 am", Spaces: 2}}); err != nil {
+		t.Fatalf("AppendHistory() error = %v", err)
+	}
+	tests := []struct {
+		name    string
+		now     time.Time
+		scraped []Appointment
+		want    []string
+	}{
+		{"FromHistory", day1, []Appointment{slot("2024-05-15", 2), slot("2024-05-20", 1)}, []string{"2024-05-20 appeared"}},
+		{"NoChange", day1.Add(time.Hour), []Appointment{slot("2024-05-15", 2), slot("2024-05-20", 1)}, nil},
+		{"FullyBooked", day1.Add(2 * time.Hour), []Appointment{slot("2024-05-15", 1)}, []string{"2024-05-15 decreased", "2024-05-20 disappeared"}},
+		{"DayPassed", day1.AddDate(0, 0, 1), nil, []string{"2024-05-15 expired"}},
+		{"Reappeared", day1.AddDate(0, 0, 1).Add(time.Hour), []Appointment{slot("2024-05-20", 3)}, []string{"2024-05-20 reappeared"}},
+	}
+	for _, tt := range tests {
+		if got := cycle(tt.now, tt.scraped...); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: changes = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if history, _ := store.History(); len(history) != 1 {
+		t.Errorf("history has %d events, want only the one appended by the test", len(history))
+	}
+
+	saved, err := store.Snapshot()
+	if err != nil || len(saved.Open) != 1 || saved.Open[0].Spaces != 3 || len(saved.Booked) != 0 || !saved.At.Equal(day1.AddDate(0, 0, 1).Add(time.Hour)) {
+		t.Fatalf("Snapshot() = %+v, %v; want the reopened slot open", saved, err)
+	}
+
+	// Read-only checks compare without saving.
+	config.ReadOnly = true
+	if got := cycle(day1.AddDate(0, 0, 2)); !reflect.DeepEqual(got, []string{"2024-05-20 disappeared"}) {
+		t.Errorf("read-only check: changes = %v, want the slot gone", got)
+	}
+	if again, _ := store.Snapshot(); !again.At.Equal(saved.At) {
+		t.Errorf("read-only check saved a snapshot at %v", again.At)
+	}
+	config.ReadOnly = false
+
+	// A snapshot that doesn't parse is replaced, from the history.
+	if err := os.WriteFile(config.SnapshotFile, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := cycle(day1.AddDate(0, 0, 2)); !reflect.DeepEqual(got, []string{"2024-05-15 expired"}) {
+		t.Errorf("check after a corrupt snapshot: changes = %v, want the history replayed", got)
+	}
+	if again, err := store.Snapshot(); err != nil || again == nil {
+		t.Errorf("Snapshot() after a corrupt one = %+v, %v; want it replaced", again, err)
+	}
+
+	// Booked slots are dropped once their day passes.
+	previous := savedSnapshot(saved)
+	changes := diffSnapshots(previous, nil, day1.AddDate(0, 0, 2))
+	if next := nextAvailabilitySnapshot(previous, nil, changes, day1.AddDate(0, 0, 2)); len(next.Booked) != 1 {
+		t.Errorf("nextAvailabilitySnapshot() booked = %+v, want the slot booked", next.Booked)
+	}
+	changes = diffSnapshots(previous, nil, day1.AddDate(0, 0, 6))
+	if next := nextAvailabilitySnapshot(previous, nil, changes, day1.AddDate(0, 0, 6)); len(next.Booked) != 0 || next.Open == nil {
+		t.Errorf("nextAvailabilitySnapshot() after the day = %+v, want nothing booked", next)
+	}
+}
+
+// TestCheckChangesTakesTurns checks that instances sharing a store each find
+// a change once between them.
+func TestCheckChangesTakesTurns(t *testing.T) {
+	defer func(tz string) { sourceTimezone = tz }(sourceTimezone)
+	sourceTimezone = "America/Denver"
+	now := time.Date(2024, 5, 15, 15, 0, 0, 0, time.UTC)
+	dir := t.TempDir()
+	config := AppConfig{SnapshotFile: filepath.Join(dir, "snapshot.json")}
+	newFileStore := func() *store.JSONFile {
+		return &store.JSONFile{Path: filepath.Join(dir, "seen.json"), HistoryPath: filepath.Join(dir, "history.jsonl"), SnapshotPath: config.SnapshotFile}
+	}
+	slot := Appointment{Date: "2024-05-20", Time: "10:00 am – 10:30 am", Spaces: 1, IsAvailable: true}
+
+	first, second := newFileStore(), newFileStore()
+	if changes, err := checkChanges(config, first, []Appointment{slot}, nil, now); err != nil || len(changes) != 1 {
+		t.Fatalf("first instance: checkChanges() = %+v, %v; want the slot added", changes, err)
+	}
+	if changes, err := checkChanges(config, second, []Appointment{slot}, nil, now.Add(time.Minute)); err != nil || len(changes) != 0 {
+		t.Errorf("second instance: checkChanges() = %+v, %v; want no changes, as the first found them", changes, err)
+	}
+}
+
+// TestCheckChangesMissedMonth checks that a month that couldn't be fetched
+// keeps its slots, rather than having them disappear and reappear.
+func TestCheckChangesMissedMonth(t *testing.T) {
+	defer func(tz string) { sourceTimezone = tz }(sourceTimezone)
+	sourceTimezone = "America/Denver"
+	now := time.Date(2024, 5, 15, 15, 0, 0, 0, time.UTC)
+	dir := t.TempDir()
+	config := AppConfig{SnapshotFile: filepath.Join(dir, "snapshot.json")}
+	store := &store.JSONFile{Path: filepath.Join(dir, "seen.json"), HistoryPath: filepath.Join(dir, "history.jsonl"), SnapshotPath: config.SnapshotFile}
+	june := Appointment{Date: "2024-06-03", Time: "10:00 am – 10:30 am", Spaces: 1, MaxSpaces: 4, IsAvailable: true, Calendar: "Main"}
+	july := Appointment{Date: "2024-07-08", Time: "10:00 am – 10:30 am", Spaces: 2, MaxSpaces: 4, IsAvailable: true, Calendar: "Main"}
+
+	tests := []struct {
+		name    string
+		scraped []Appointment
+		missed  fetchGaps
+		want    int
+	}{
+		{"BothMonths", []Appointment{june, july}, nil, 2},
+		{"JulyFailed", []Appointment{june}, fetchGaps{{"Main", "2024-07"}: true}, 0},
+		{"OtherCalendarFailed", []Appointment{june}, fetchGaps{{"Other", "2024-07"}: true}, 1},
+		{"BothAgain", []Appointment{june, july}, nil, 1},
+		{"JulyFailedAgain", []Appointment{june}, fetchGaps{{"Main", "2024-07"}: true}, 0},
+		{"BothOnceMore", []Appointment{june, july}, nil, 0},
+	}
+	for i, tt := range tests {
+		changes, err := checkChanges(config, store, tt.scraped, tt.missed, now.Add(time.Duration(i)*time.Hour))
+		if err != nil || len(changes) != tt.want {
+			t.Errorf("%s: checkChanges() = %+v, %v; want %d changes", tt.name, changes, err, tt.want)
+		}
+	}
+
+	// The failed month's slots are kept as they were.
+	checkChanges(config, store, []Appointment{june}, fetchGaps{{"Main", "2024-07"}: true}, now.Add(time.Duration(len(tests))*time.Hour))
+	saved, err := store.Snapshot()
+	if err != nil || !reflect.DeepEqual(saved.Open, []Appointment{june, july}) || len(saved.Booked) != 0 {
+		t.Errorf("Snapshot() after a failed month = %+v, %v; want both slots open", saved, err)
+	}
+}
+
+func TestRestoreLatestScrape(t *testing.T) {
+	defer func(s *scrapeSnapshot) { latestScrape = s }(latestScrape)
+	latestScrape = &scrapeSnapshot{}
+	at := time.Date(2024, 5, 15, 15, 0, 0, 0, time.UTC)
+	dir := t.TempDir()
+	config := AppConfig{DataFile: filepath.Join(dir, "seen.json"), HistoryFile: filepath.Join(dir, "history.jsonl"), SnapshotFile: filepath.Join(dir, "snapshot.json")}
+	store := &store.JSONFile{Path: config.DataFile, SnapshotPath: config.SnapshotFile}
+
+	restoreLatestScrape(config)
+	if _, got := latestScrape.get(); !got.IsZero() {
+		t.Errorf("restoreLatestScrape() without a snapshot set the scrape time to %v", got)
+	}
+
+	open := []Appointment{{Date: "2024-05-20", Time: "10:00 am – 10:30 am", Spaces: 1, IsAvailable: true}}
+	if err := store.UpdateSnapshot(func(*AvailabilitySnapshot) (*AvailabilitySnapshot, error) {
+		return &AvailabilitySnapshot{At: at, Open: open}, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	restoreLatestScrape(config)
+	if slots, got := latestScrape.get(); !got.Equal(at) || len(slots) != 1 {
+		t.Errorf("restoreLatestScrape() = %+v at %v, want the saved slots", slots, got)
+	}
+}
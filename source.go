@@ -0,0 +1,197 @@
+package melanzana
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/pashbylogan/melanzana/pkg/cowlendar"
+)
+
+// Source is somewhere current availability can be read from.
+type Source interface {
+	Name() string
+	// Appointments returns the available slots for the next monthsAhead
+	// months. It fails if the source couldn't be read at all.
+	Appointments(monthsAhead int) ([]Appointment, error)
+}
+
+// appointmentSource is where the availability service reads from, set from
+// the configuration at startup.
+var appointmentSource Source = apiSource{}
+
+// newSource returns the Cowlendar API, falling back to the booking page
+// HTML if the htmlFallback feature is on and htmlFallbackUrl is set.
+func newSource(config AppConfig) Source {
+	if !config.Features.HTMLFallback || config.HTMLFallbackURL == "" {
+		if config.HTMLFallbackURL != "" {
+			slog.Warn("htmlFallbackUrl is set, but the htmlFallback feature is off; not falling back to the booking page")
+		}
+		return apiSource{}
+	}
+	return fallbackSource{apiSource{}, htmlSource{
+		urlFormat: config.HTMLFallbackURL,
+		selectors: config.HTMLSelectors,
+		delay:     time.Duration(config.HTMLFallbackDelaySeconds) * time.Second,
+		now:       clockNow,
+		sleep:     clockSleep,
+	}}
+}
+
+// apiSource reads the Cowlendar availability API.
+type apiSource struct{}
+
+func (apiSource) Name() string { return "Cowlendar API" }
+
+func (apiSource) Appointments(monthsAhead int) ([]Appointment, error) {
+	return scrapeAppointments(monthsAhead)
+}
+
+// HTMLSelectors are the CSS selectors that find time slots on the booking
+// page. The defaults match the markup of the HTML scraper this tree's tests
+// were written for; they have not been checked against the live page, which
+// may differ.
+type HTMLSelectors struct {
+	Slot   string `json:"slot"`   // Each time slot
+	Time   string `json:"time"`   // Within a slot, its time range, e.g. "10:00 am - 10:30 am"
+	Spaces string `json:"spaces"` // Within a slot, the spaces left, e.g. "2 spaces available"; empty counts each slot as one space
+}
+
+// check reports selectors that are missing or don't parse.
+func (s HTMLSelectors) check() error {
+	if s.Slot == "" || s.Time == "" {
+		return fmt.Errorf("slot and time are required")
+	}
+	for _, selector := range []string{s.Slot, s.Time, s.Spaces} {
+		if selector == "" {
+			continue
+		}
+		if _, err := cascadia.Compile(selector); err != nil {
+			return fmt.Errorf("invalid selector %q: %w", selector, err)
+		}
+	}
+	return nil
+}
+
+// htmlSource scrapes the booking page, one request per day, waiting delay
+// between them. It only works where the page is rendered with its time
+// slots rather than filled in by script, and is meant as a stopgap while
+// the API is unavailable.
+type htmlSource struct {
+	urlFormat string // Booking page URL with {date} in place of YYYY-MM-DD
+	selectors HTMLSelectors
+	delay     time.Duration
+	now       func() time.Time
+	sleep     func(time.Duration)
+}
+
+func (htmlSource) Name() string { return "booking page" }
+
+func (s htmlSource) Appointments(monthsAhead int) ([]Appointment, error) {
+	start := s.now().In(sourceLocation())
+	end := start.AddDate(0, monthsAhead, 0)
+	days := 0
+	for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+		days++
+	}
+
+	var appointments []Appointment
+	var lastErr error
+	fetched := 0
+	for i, date := range generateDateRange(start, days) {
+		if i > 0 && s.delay > 0 {
+			s.sleep(s.delay)
+		}
+		html, err := fetchBookingPage(strings.ReplaceAll(s.urlFormat, "{date}", date))
+		if err != nil {
+			slog.Warn("Error fetching booking page", "date", date, "err", err)
+			lastErr = err
+			continue
+		}
+		slots, err := parseAppointmentSlots(html, date, s.selectors)
+		if err != nil {
+			slog.Warn("Error reading booking page", "date", date, "err", err)
+			lastErr = err
+			continue
+		}
+		fetched++
+		observedAt := s.now()
+		for i := range slots {
+			slots[i].ObservedAt = observedAt
+		}
+		appointments = append(appointments, slots...)
+	}
+	if fetched == 0 && lastErr != nil {
+		return nil, fmt.Errorf("%w: no day could be fetched: %w", errFetch, lastErr)
+	}
+	slog.Info("Total available appointments found on the booking page", "count", len(appointments))
+	return appointments, nil
+}
+
+// fetchBookingPage returns the HTML at url.
+func fetchBookingPage(url string) (string, error) {
+	resp, err := apiClient.Get(url)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch booking page: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("booking page returned status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read booking page: %w", err)
+	}
+	return string(body), nil
+}
+
+// fallbackSource reads from each source in turn until one succeeds. A
+// partial result counts as success, since it is likely more complete than
+// what a fallback would find, unless some of it was missing because
+// responses were empty or changed shape: then the next source is tried, and
+// the partial result is kept only if none does better.
+type fallbackSource []Source
+
+func (s fallbackSource) Name() string {
+	names := make([]string, len(s))
+	for i, src := range s {
+		names[i] = src.Name()
+	}
+	return strings.Join(names, ", then ")
+}
+
+func (s fallbackSource) Appointments(monthsAhead int) ([]Appointment, error) {
+	var errs []error
+	var kept []Appointment
+	var keptErr error
+	for i, src := range s {
+		appointments, err := src.Appointments(monthsAhead)
+		var partial *partialFetchError
+		if err == nil || (errors.As(err, &partial) && !invalidPayload(err)) {
+			return appointments, err
+		}
+		if partial != nil && keptErr == nil {
+			kept, keptErr = appointments, err
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", src.Name(), err))
+		if i < len(s)-1 {
+			slog.Warn("Source failed, falling back", "source", src.Name(), "fallback", s[i+1].Name(), "err", err)
+		}
+	}
+	if keptErr != nil {
+		return kept, keptErr
+	}
+	return nil, errors.Join(errs...)
+}
+
+// invalidPayload reports whether err is, or includes, a Cowlendar response
+// that was empty or didn't have the expected shape.
+func invalidPayload(err error) bool {
+	var drift *cowlendar.SchemaDriftError
+	return errors.As(err, &drift) || errors.Is(err, cowlendar.ErrMalformed)
+}
@@ -0,0 +1,139 @@
+package melanzana
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pashbylogan/melanzana/pkg/cowlendar"
+)
+
+// stubSource returns fixed results.
+type stubSource struct {
+	name         string
+	appointments []Appointment
+	err          error
+	calls        *int
+}
+
+func (s stubSource) Name() string { return s.name }
+
+func (s stubSource) Appointments(int) ([]Appointment, error) {
+	*s.calls++
+	return s.appointments, s.err
+}
+
+func TestNewSource(t *testing.T) {
+	config := AppConfig{HTMLFallbackURL: "https://example.com/book?date={date}"}
+	if _, ok := newSource(config).(apiSource); !ok {
+		t.Errorf("newSource() with the htmlFallback feature off = %T, want the API only", newSource(config))
+	}
+	config.Features.HTMLFallback = true
+	if src, ok := newSource(config).(fallbackSource); !ok || len(src) != 2 {
+		t.Errorf("newSource() with the htmlFallback feature on = %T, want the API falling back to the booking page", newSource(config))
+	}
+}
+
+func TestFallbackSource(t *testing.T) {
+	var apiCalls, htmlCalls int
+	api := stubSource{name: "api", err: errors.New("no month could be fetched"), calls: &apiCalls}
+	html := stubSource{name: "html", appointments: []Appointment{{Date: "2024-05-15"}}, calls: &htmlCalls}
+
+	got, err := fallbackSource{api, html}.Appointments(3)
+	if err != nil || len(got) != 1 || apiCalls != 1 || htmlCalls != 1 {
+		t.Errorf("Appointments() = %v, %v after %d and %d calls; want the fallback's slots", got, err, apiCalls, htmlCalls)
+	}
+
+	api.err = nil
+	api.appointments = []Appointment{}
+	if got, err := (fallbackSource{api, html}).Appointments(3); err != nil || len(got) != 0 || htmlCalls != 1 {
+		t.Errorf("Appointments() with a working API = %v, %v; want its empty result without falling back", got, err)
+	}
+
+	// Months that came back empty or changed shape are read from the
+	// fallback; the API's partial result is kept if that fails too.
+	api.appointments = []Appointment{{Date: "2024-05-20"}}
+	api.err = &partialFetchError{Fetched: 1, Attempted: 2, Err: fmt.Errorf("2024-06: %w", &cowlendar.SchemaDriftError{Problems: []string{"response is not a JSON object"}})}
+	if got, err := (fallbackSource{api, html}).Appointments(3); err != nil || len(got) != 1 || got[0].Date != "2024-05-15" || htmlCalls != 2 {
+		t.Errorf("Appointments() with an invalid payload = %v, %v; want the fallback's slots", got, err)
+	}
+	html.err = errors.New("page down")
+	if got, err := (fallbackSource{api, html}).Appointments(3); !errors.Is(err, api.err) || len(got) != 1 || got[0].Date != "2024-05-20" {
+		t.Errorf("Appointments() with an invalid payload and no fallback = %v, %v; want the API's partial result", got, err)
+	}
+	api.err = &partialFetchError{Fetched: 1, Attempted: 2, Err: errors.New("2024-06: status 503")}
+	if got, err := (fallbackSource{api, html}).Appointments(3); err == nil || len(got) != 1 || htmlCalls != 3 {
+		t.Errorf("Appointments() with a month unreachable = %v, %v; want the API's partial result without falling back", got, err)
+	}
+
+	api.err, html.err = errors.New("api down"), errors.New("page down")
+	if _, err := (fallbackSource{api, html}).Appointments(3); err == nil || !strings.Contains(err.Error(), "api down") || !strings.Contains(err.Error(), "page down") {
+		t.Errorf("Appointments() with every source failing error = %v, want both errors", err)
+	}
+}
+
+func TestHTMLSource(t *testing.T) {
+	var dates []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		date := r.URL.Query().Get("date")
+		dates = append(dates, date)
+		if date == "2024-05-16" {
+			w.Write([]byte(`<div class="timeslot"><div class="timeslot-range">10:00 am - 10:30 am</div><span class="spots-available">2 spaces available</span></div>`))
+		}
+	}))
+	defer server.Close()
+
+	// Don't pace requests to the test server.
+	defer func(client *http.Client) { apiClient = client }(apiClient)
+	config := defaultConfig()
+	config.RequestsPerSecond = 0
+	apiClient = newAPIClient(config)
+
+	now := time.Date(2024, 5, 15, 12, 0, 0, 0, sourceLocation())
+	var waits []time.Duration
+	s := htmlSource{
+		urlFormat: server.URL + "/book?date={date}",
+		selectors: defaultConfig().HTMLSelectors,
+		delay:     2 * time.Second,
+		now:       func() time.Time { return now },
+		sleep:     func(d time.Duration) { waits = append(waits, d) },
+	}
+	appointments, err := s.Appointments(1)
+	if err != nil {
+		t.Fatalf("Appointments() error = %v", err)
+	}
+	if len(dates) != 31 || dates[0] != "2024-05-15" || dates[30] != "2024-06-14" {
+		t.Errorf("fetched %d days from %v, want the 31 days up to 2024-06-14", len(dates), dates[:1])
+	}
+	if len(waits) != 30 || waits[0] != 2*time.Second {
+		t.Errorf("waited %v between requests, want 2s between each of the 31", waits)
+	}
+	if len(appointments) != 1 || appointments[0].Date != "2024-05-16" || appointments[0].Time != "10:00 am – 10:30 am" || appointments[0].ObservedAt.IsZero() {
+		t.Errorf("Appointments() = %+v, want the one slot on 2024-05-16", appointments)
+	}
+}
+
+func TestParseAppointmentSlotsSelectors(t *testing.T) {
+	html := `<ul>
+		<li class="slot"><time>9:00am–9:30am</time></li>
+		<li class="slot"><time>14:00 to 14:30</time></li>
+		<li class="slot"><time>All day</time></li>
+	</ul>`
+	got, err := parseAppointmentSlots(html, "2024-05-15", HTMLSelectors{Slot: "li.slot", Time: "time"})
+	if err != nil {
+		t.Fatalf("parseAppointmentSlots() error = %v", err)
+	}
+	want := []string{"9:00 am – 9:30 am", "2:00 pm – 2:30 pm"}
+	if len(got) != len(want) {
+		t.Fatalf("parseAppointmentSlots() = %+v, want slots at %v", got, want)
+	}
+	for i, appt := range got {
+		if appt.Time != want[i] || appt.Spaces != 1 {
+			t.Errorf("slot %d = %q with %d spaces, want %q with 1, as the page shows no count", i, appt.Time, appt.Spaces, want[i])
+		}
+	}
+}
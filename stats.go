@@ -0,0 +1,148 @@
+package melanzana
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pashbylogan/melanzana/pkg/store"
+)
+
+// availabilityStats aggregates the availability history. Openings are slots
+// appearing or reopening, counted by when they were found, in the source
+// timezone, since that is what a polling schedule has to catch.
+type availabilityStats struct {
+	From, To  time.Time      // The first and last recorded changes
+	Openings  int            // Slots that appeared or reopened
+	Weekdays  [7]int         // Openings by weekday found, Sunday first
+	Hours     [24]int        // Openings by hour found
+	Months    map[string]int // Openings by month found, as YYYY-MM
+	Open      []time.Duration
+	StillOpen int // Openings not yet booked or past
+}
+
+// collectStats replays history into statistics, with times in loc.
+func collectStats(history []AvailabilityEvent, loc *time.Location) availabilityStats {
+	s := availabilityStats{Months: map[string]int{}}
+	openSince := map[string]time.Time{}
+	for _, e := range history {
+		if s.From.IsZero() {
+			s.From = e.At
+		}
+		s.To = e.At
+		key := store.SlotID(e.Date, e.Time, e.Calendar)
+		switch e.Kind {
+		case eventAppeared, eventReappeared:
+			at := e.At.In(loc)
+			s.Openings++
+			s.Weekdays[at.Weekday()]++
+			s.Hours[at.Hour()]++
+			s.Months[at.Format("2006-01")]++
+			openSince[key] = e.At
+		case eventDisappeared:
+			if since, ok := openSince[key]; ok {
+				s.Open = append(s.Open, e.At.Sub(since))
+				delete(openSince, key)
+			}
+		case eventExpired:
+			delete(openSince, key)
+		}
+	}
+	s.StillOpen = len(openSince)
+	return s
+}
+
+// writeStats prints the statistics as a report.
+func writeStats(w io.Writer, s availabilityStats) {
+	if s.Openings == 0 {
+		fmt.Fprintln(w, "No slots recorded in the availability history")
+		return
+	}
+	fmt.Fprintf(w, "%d slots opened between %s and %s.\n\n", s.Openings, s.From.Format("2006-01-02"), s.To.Format("2006-01-02"))
+
+	fmt.Fprintln(w, "How long slots stayed open before being booked:")
+	if len(s.Open) == 0 {
+		fmt.Fprintln(w, "  No slots have been booked yet")
+	} else {
+		open := append([]time.Duration(nil), s.Open...)
+		sort.Slice(open, func(i, j int) bool { return open[i] < open[j] })
+		var sum time.Duration
+		for _, d := range open {
+			sum += d
+		}
+		fmt.Fprintf(w, "  Average %s, median %s, shortest %s over %d booked slots\n",
+			roundDuration(sum/time.Duration(len(open))), roundDuration(open[len(open)/2]), roundDuration(open[0]), len(open))
+	}
+	fmt.Fprintf(w, "  %d still open, %d passed unbooked\n\n", s.StillOpen, s.Openings-len(s.Open)-s.StillOpen)
+
+	fmt.Fprintln(w, "Slots opened by weekday:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for i := range 7 {
+		day := time.Weekday((i + 1) % 7) // Monday first
+		fmt.Fprintf(tw, "  %s\t%d\t%s\n", day.String()[:3], s.Weekdays[day], bar(s.Weekdays[day], s.Openings))
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w, "\nSlots opened by hour:")
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for hour, n := range s.Hours {
+		if n > 0 {
+			fmt.Fprintf(tw, "  %02d:00\t%d\t%s\n", hour, n, bar(n, s.Openings))
+		}
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w, "\nSlots opened by month:")
+	var months []string
+	for month := range s.Months {
+		months = append(months, month)
+	}
+	sort.Strings(months)
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, month := range months {
+		fmt.Fprintf(tw, "  %s\t%d\n", month, s.Months[month])
+	}
+	tw.Flush()
+
+	if len(s.Open) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Polling less often than the median time open misses about half the slots")
+		fmt.Fprintln(w, "that get booked; poll most often in the hours when slots open.")
+	}
+}
+
+// bar draws n out of total as a bar of up to 30 characters.
+func bar(n, total int) string {
+	return strings.Repeat("#", (n*30+total-1)/total)
+}
+
+// roundDuration rounds d for display: to the minute above an hour, else to
+// the second.
+func roundDuration(d time.Duration) time.Duration {
+	if d >= time.Hour {
+		return d.Round(time.Minute)
+	}
+	return d.Round(time.Second)
+}
+
+// runStatsCommand implements "melanzana stats": a report on the recorded
+// availability history.
+func runStatsCommand(args []string) int {
+	config, store, err := commandStore(flag.NewFlagSet("stats", flag.ContinueOnError), args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	history, err := store.History()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read %s: %v\n", config.HistoryFile, err)
+		return 1
+	}
+	writeStats(os.Stdout, collectStats(history, sourceLocation()))
+	return 0
+}
@@ -0,0 +1,59 @@
+package melanzana
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollectStats(t *testing.T) {
+	loc, err := time.LoadLocation("America/Denver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Monday 2024-05-13, 08:00 in Denver.
+	at := time.Date(2024, 5, 13, 14, 0, 0, 0, time.UTC)
+	event := func(kind string, after time.Duration, date string) AvailabilityEvent {
+		return AvailabilityEvent{At: at.Add(after), Kind: kind, Date: date, Time: "10:00 am – 10:30 am", Spaces: 1}
+	}
+	history := []AvailabilityEvent{
+		event(eventAppeared, 0, "2024-05-20"),
+		event(eventAppeared, 0, "2024-05-21"),
+		event(eventDisappeared, 10*time.Minute, "2024-05-20"),
+		event(eventReappeared, 24*time.Hour, "2024-05-20"),
+		event(eventDisappeared, 24*time.Hour+30*time.Minute, "2024-05-20"),
+		event(eventAppeared, 20*24*time.Hour, "2024-06-10"),
+		event(eventExpired, 21*24*time.Hour, "2024-05-21"),
+	}
+
+	s := collectStats(history, loc)
+	if s.Openings != 4 || s.StillOpen != 1 || len(s.Open) != 2 {
+		t.Fatalf("collectStats() = %d openings, %d still open, %d booked; want 4, 1, 2", s.Openings, s.StillOpen, len(s.Open))
+	}
+	if s.Open[0] != 10*time.Minute || s.Open[1] != 30*time.Minute {
+		t.Errorf("time open = %v, want [10m 30m]", s.Open)
+	}
+	if s.Weekdays[time.Monday] != 2 || s.Weekdays[time.Tuesday] != 1 || s.Weekdays[time.Sunday] != 1 {
+		t.Errorf("weekdays = %v, want 2 on Monday and 1 on Tuesday and Sunday", s.Weekdays)
+	}
+	if s.Hours[8] != 4 {
+		t.Errorf("openings at 08:00 = %d, want 4, counted in the source timezone", s.Hours[8])
+	}
+	if s.Months["2024-05"] != 3 || s.Months["2024-06"] != 1 {
+		t.Errorf("months = %v, want 3 in May and 1 in June", s.Months)
+	}
+
+	var out strings.Builder
+	writeStats(&out, s)
+	for _, want := range []string{"4 slots opened between 2024-05-13 and 2024-06-03", "Average 20m0s, median 30m0s, shortest 10m0s over 2 booked slots", "1 still open, 1 passed unbooked", "  Mon  2  ", "  08:00  4  ", "  2024-06  1"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("report is missing %q:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	writeStats(&out, collectStats(nil, loc))
+	if !strings.Contains(out.String(), "No slots recorded") {
+		t.Errorf("report for an empty history = %q", out.String())
+	}
+}
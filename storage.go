@@ -1,46 +1,195 @@
-package main
+package melanzana
 
 import (
-	"encoding/json"
 	"fmt"
-	"log"
+	"net/http"
 	"os"
+	"time"
+
+	"github.com/pashbylogan/melanzana/pkg/awssig"
+	"github.com/pashbylogan/melanzana/pkg/store"
+)
+
+// The state and its records are defined by pkg/store.
+type (
+	Store                = store.Store
+	Codec                = store.Codec
+	Appointment          = store.Appointment
+	AvailabilityEvent    = store.Event
+	AvailabilitySnapshot = store.Snapshot
+)
+
+// Endpoints of the remote state stores. Variables so tests can point them elsewhere.
+var (
+	s3EndpointFormat       = "https://%s.s3.%s.amazonaws.com" // bucket, region
+	gcsEndpointFormat      = "https://storage.googleapis.com/%s"
+	dynamoDBEndpointFormat = "https://dynamodb.%s.amazonaws.com" // region
 )
 
-// loadSeenAppointments reads appointments from the JSON file specified by dataFilePath.
-func loadSeenAppointments(dataFilePath string) ([]Appointment, error) {
-	data, err := os.ReadFile(dataFilePath)
+var storeHTTPClient = &http.Client{Transport: outboundTransport, Timeout: 30 * time.Second}
+
+// newStore returns the Store described by the configuration, wrapped so
+// that backend outages are retried and queued rather than lost.
+func newStore(config AppConfig) (Store, error) {
+	codec, err := stateCodec(config)
 	if err != nil {
-		if os.IsNotExist(err) {
-			log.Printf("File %s does not exist. Returning empty list.", dataFilePath)
-			return []Appointment{}, nil // No error if file simply doesn't exist
+		return nil, err
+	}
+
+	var backend Store
+	switch config.StateStore {
+	case "", "file":
+		backend = &store.JSONFile{
+			Path:            config.DataFile,
+			HistoryPath:     config.HistoryFile,
+			SubscribersPath: config.SubscribersFile,
+			SnapshotPath:    config.SnapshotFile,
+			LockTimeout:     time.Duration(config.LockTimeoutSeconds) * time.Second,
+			Codec:           codec,
 		}
-		return nil, fmt.Errorf("failed to read %s: %w", dataFilePath, err)
+	case "dynamodb":
+		table, err := newDynamoDBStore(config)
+		if err != nil {
+			return nil, err
+		}
+		table.Codec = codec
+		backend = table
+	case "postgres":
+		if backend, err = newPostgresStore(config); err != nil {
+			return nil, err
+		}
+	default:
+		objects, err := newObjectStore(config)
+		if err != nil {
+			return nil, err
+		}
+		objects.Codec = codec
+		backend = objects
 	}
+	resilient := newResilientStore(backend, config.StoreSpoolFile, config.Retry.policy(retryStorage), storeAlert(config))
+	resilient.codec = codec
+	return resilient, nil
+}
 
-	if len(data) == 0 { // Handle empty file case
-		log.Printf("File %s is empty. Returning empty list.", dataFilePath)
-		return []Appointment{}, nil
+// newObjectStore builds the object store selected by config.StateStore.
+func newObjectStore(config AppConfig) (*store.Bucket, error) {
+	if config.StateBucket == "" {
+		return nil, fmt.Errorf("stateBucket is required for the %s state store", config.StateStore)
 	}
 
-	var appointments []Appointment
-	err = json.Unmarshal(data, &appointments)
-	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal appointments from %s: %w", dataFilePath, err)
+	switch config.StateStore {
+	case "s3":
+		region := config.StateRegion
+		if region == "" {
+			region = os.Getenv("AWS_REGION")
+		}
+		if region == "" {
+			return nil, fmt.Errorf("stateRegion is required for the s3 state store")
+		}
+		creds := awssig.Credentials{AccessKeyID: config.AWSAccessKeyID, SecretAccessKey: config.AWSSecretAccessKey}.WithEnvFallback()
+		return &store.Bucket{
+			Provider:       "s3",
+			BaseURL:        fmt.Sprintf(s3EndpointFormat, config.StateBucket, region),
+			Key:            config.DataFile,
+			HistoryKey:     config.HistoryFile,
+			SubscribersKey: config.SubscribersFile,
+			SnapshotKey:    config.SnapshotFile,
+			Region:         region,
+			Creds:          creds,
+			HTTPClient:     storeHTTPClient,
+		}, nil
+	case "gcs":
+		if config.GCSAccessKeyID == "" || config.GCSSecret == "" {
+			return nil, fmt.Errorf("gcsAccessKeyId and gcsSecret are required for the gcs state store")
+		}
+		return &store.Bucket{
+			Provider:       "gcs",
+			BaseURL:        fmt.Sprintf(gcsEndpointFormat, config.StateBucket),
+			Key:            config.DataFile,
+			HistoryKey:     config.HistoryFile,
+			SubscribersKey: config.SubscribersFile,
+			SnapshotKey:    config.SnapshotFile,
+			Region:         "auto",
+			Creds:          awssig.Credentials{AccessKeyID: config.GCSAccessKeyID, SecretAccessKey: config.GCSSecret},
+			HTTPClient:     storeHTTPClient,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown state store %q", config.StateStore)
 	}
-	return appointments, nil
 }
 
-// saveSeenAppointments writes appointments to the JSON file specified by dataFilePath.
-func saveSeenAppointments(appointments []Appointment, dataFilePath string) error {
-	data, err := json.MarshalIndent(appointments, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal appointments to JSON: %w", err)
+// newDynamoDBStore builds the DynamoDB store for config.StateTable.
+func newDynamoDBStore(config AppConfig) (*store.DynamoDB, error) {
+	if config.StateTable == "" {
+		return nil, fmt.Errorf("stateTable is required for the dynamodb state store")
+	}
+	region := config.StateRegion
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
 	}
+	if region == "" {
+		return nil, fmt.Errorf("stateRegion is required for the dynamodb state store")
+	}
+	return &store.DynamoDB{
+		Endpoint:       fmt.Sprintf(dynamoDBEndpointFormat, region),
+		Table:          config.StateTable,
+		Region:         region,
+		Creds:          awssig.Credentials{AccessKeyID: config.AWSAccessKeyID, SecretAccessKey: config.AWSSecretAccessKey}.WithEnvFallback(),
+		SeenKey:        config.DataFile,
+		HistoryKey:     config.HistoryFile,
+		SubscribersKey: config.SubscribersFile,
+		SnapshotKey:    config.SnapshotFile,
+		Location:       sourceLocation(),
+		HTTPClient:     storeHTTPClient,
+	}, nil
+}
 
-	err = os.WriteFile(dataFilePath, data, 0644) // 0644 are standard file permissions
-	if err != nil {
-		return fmt.Errorf("failed to write appointments to %s: %w", dataFilePath, err)
+// stateCodecNames returns the codecs for the configured state store: its
+// entry in stateCodecsByStore if it has one, otherwise stateCodecs.
+func stateCodecNames(config AppConfig) []string {
+	store := config.StateStore
+	if store == "" {
+		store = "file"
+	}
+	if names, ok := config.StateCodecsByStore[store]; ok {
+		return names
+	}
+	return config.StateCodecs
+}
+
+// stateCodec builds the codec for the configured state store, nil if none.
+func stateCodec(config AppConfig) (Codec, error) {
+	return store.NewCodec(stateCodecNames(config), store.CodecKeys{
+		EncryptionKey:    config.StateEncryptionKey,
+		AgeIdentity:      config.StateAgeIdentity,
+		AgeRecipients:    config.StateAgeRecipients,
+		MigratePlaintext: config.StateMigratePlaintext,
+	})
+}
+
+// seenRecords returns the seen records a cycle at now writes: one for each
+// notified appointment, stamped as notified, and the earlier record of each
+// other slot in scraped, stamped as found again.
+func seenRecords(previous, notified, scraped []Appointment, now time.Time) []Appointment {
+	earlier := make(map[slotKey]Appointment, len(previous))
+	for _, appt := range previous {
+		earlier[slotKey{appt.Date, appt.Time, appt.Calendar}] = appt
+	}
+	records := make([]Appointment, 0, len(notified))
+	for _, appt := range notified {
+		appt.FirstSeenAt, appt.LastSeenAt, appt.LastNotifiedAt = now, now, now
+		if prev, ok := earlier[slotKey{appt.Date, appt.Time, appt.Calendar}]; ok {
+			appt.FirstSeenAt = prev.FirstSeenAt
+		}
+		records = append(records, appt)
+	}
+	renotified := newSlotSet(notified)
+	for _, appt := range scraped {
+		prev, ok := earlier[slotKey{appt.Date, appt.Time, appt.Calendar}]
+		if ok && !renotified.has(appt) {
+			prev.LastSeenAt = now
+			records = append(records, prev)
+		}
 	}
-	return nil
+	return records
 }
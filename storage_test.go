@@ -1,144 +1,64 @@
-package main
+package melanzana
 
 import (
-	"encoding/json"
-	"os"
-	"path/filepath"
+	"bytes"
+	"encoding/base64"
 	"reflect"
 	"testing"
-)
-
-func TestLoadAndSaveSeenAppointments(t *testing.T) {
-	// Create a temporary directory for test files
-	tempDir, err := os.MkdirTemp("", "storage_test_")
-	if err != nil {
-		t.Fatalf("Failed to create temp dir: %v", err)
-	}
-	defer os.RemoveAll(tempDir) // Clean up the temp directory
-
-	testFilePath := filepath.Join(tempDir, "test_seen_appointments.json")
-
-	t.Run("SaveAndLoadSuccessfully", func(t *testing.T) {
-		originalAppointments := []Appointment{
-			{Date: "2024-08-10", Time: "10:00 am – 11:00 am", Spaces: 2, IsAvailable: true},
-			{Date: "2024-09-22", Time: "3:00 pm – 4:00 pm", Spaces: 1, IsAvailable: true},
-		}
-
-		err := saveSeenAppointments(originalAppointments, testFilePath)
-		if err != nil {
-			t.Fatalf("saveSeenAppointments() failed: %v", err)
-		}
-
-		loadedAppointments, err := loadSeenAppointments(testFilePath)
-		if err != nil {
-			t.Fatalf("loadSeenAppointments() failed: %v", err)
-		}
-
-		if !reflect.DeepEqual(originalAppointments, loadedAppointments) {
-			t.Errorf("loadSeenAppointments() got = %v, want %v", loadedAppointments, originalAppointments)
-		}
-	})
-
-	t.Run("LoadNonExistentFile", func(t *testing.T) {
-		nonExistentFilePath := filepath.Join(tempDir, "non_existent.json")
-		loaded, err := loadSeenAppointments(nonExistentFilePath)
-		if err != nil {
-			t.Errorf("loadSeenAppointments() with non-existent file error = %v, want nil", err)
-		}
-		if len(loaded) != 0 {
-			t.Errorf("loadSeenAppointments() with non-existent file got %d appointments, want 0", len(loaded))
-		}
-	})
-
-	t.Run("LoadEmptyFile", func(t *testing.T) {
-		emptyFilePath := filepath.Join(tempDir, "empty.json")
-		f, err := os.Create(emptyFilePath)
-		if err != nil {
-			t.Fatalf("Failed to create empty file: %v", err)
-		}
-		f.Close() // Ensure file is created and empty
-
-		loaded, err := loadSeenAppointments(emptyFilePath)
-		if err != nil {
-			t.Errorf("loadSeenAppointments() with empty file error = %v, want nil", err)
-		}
-		if len(loaded) != 0 {
-			t.Errorf("loadSeenAppointments() with empty file got %d appointments, want 0", len(loaded))
-		}
-	})
-
-	t.Run("LoadMalformedJSON", func(t *testing.T) {
-		malformedFilePath := filepath.Join(tempDir, "malformed.json")
-		err := os.WriteFile(malformedFilePath, []byte("[{malformed json}}"), 0644)
-		if err != nil {
-			t.Fatalf("Failed to write malformed JSON file: %v", err)
-		}
-
-		_, err = loadSeenAppointments(malformedFilePath)
-		if err == nil {
-			t.Errorf("loadSeenAppointments() with malformed JSON error = nil, want error")
-		}
-	})
-
-	t.Run("SaveEmptySlice", func(t *testing.T) {
-		emptyAppointments := []Appointment{}
-		emptySliceFilePath := filepath.Join(tempDir, "empty_slice_saved.json")
-
-		err := saveSeenAppointments(emptyAppointments, emptySliceFilePath)
-		if err != nil {
-			t.Fatalf("saveSeenAppointments() with empty slice failed: %v", err)
-		}
-
-		loaded, err := loadSeenAppointments(emptySliceFilePath)
-		if err != nil {
-			t.Fatalf("loadSeenAppointments() after saving empty slice failed: %v", err)
-		}
-		if len(loaded) != 0 {
-			t.Errorf("loadSeenAppointments() after saving empty slice got %d, want 0", len(loaded))
-		}
-
-		// Verify content is valid empty JSON array
-		content, readErr := os.ReadFile(emptySliceFilePath)
-		if readErr != nil {
-			t.Fatalf("Failed to read file after saving empty slice: %v", readErr)
-		}
+	"time"
 
-		var checkEmpty []Appointment
-		if unmarshalErr := json.Unmarshal(content, &checkEmpty); unmarshalErr != nil || len(checkEmpty) != 0 {
-			t.Errorf("File content after saving empty slice is not a valid empty JSON array. Got: %s", string(content))
-		}
-	})
-
-	t.Run("SaveAndLoadLargeDataset", func(t *testing.T) {
-		// Test with a larger dataset to ensure the system handles it well
-		var largeAppointments []Appointment
-		for i := 0; i < 100; i++ {
-			largeAppointments = append(largeAppointments, Appointment{
-				Date:        "2024-05-15",
-				Time:        "10:00 am – 11:00 am",
-				Spaces:      i%5 + 1, // Varies from 1-5
-				IsAvailable: true,
-			})
-		}
-
-		largeFilePath := filepath.Join(tempDir, "large_dataset.json")
+	"github.com/pashbylogan/melanzana/pkg/store"
+)
 
-		err := saveSeenAppointments(largeAppointments, largeFilePath)
-		if err != nil {
-			t.Fatalf("saveSeenAppointments() with large dataset failed: %v", err)
-		}
+var testEncryptionKey = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32))
 
-		loaded, err := loadSeenAppointments(largeFilePath)
-		if err != nil {
-			t.Fatalf("loadSeenAppointments() with large dataset failed: %v", err)
-		}
+// loadSeenAppointments reads the seen appointments a file store keeps at
+// path.
+func loadSeenAppointments(path string, codec Codec) ([]Appointment, error) {
+	return (&store.JSONFile{Path: path, Codec: codec}).Load()
+}
 
-		if len(loaded) != len(largeAppointments) {
-			t.Errorf("loadSeenAppointments() large dataset length = %d, want %d", len(loaded), len(largeAppointments))
+func TestStateCodecNames(t *testing.T) {
+	byStore := map[string][]string{"file": {"zstd"}, "s3": {}}
+	tests := []struct {
+		store string
+		want  []string
+	}{
+		{"", []string{"zstd"}},
+		{"s3", []string{}},
+		{"gcs", []string{"gzip"}},
+	}
+	for _, tt := range tests {
+		config := AppConfig{StateStore: tt.store, StateCodecs: []string{"gzip"}, StateCodecsByStore: byStore}
+		if got := stateCodecNames(config); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("stateCodecNames(%q) = %v, want %v", tt.store, got, tt.want)
 		}
+	}
+}
 
-		if !reflect.DeepEqual(loaded, largeAppointments) {
-			t.Errorf("Large dataset not preserved through save/load cycle")
+func TestSeenRecords(t *testing.T) {
+	earlier := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	now := earlier.Add(48 * time.Hour)
+	kept := Appointment{Date: "2024-05-20", Time: "9:00 am – 9:30 am", FirstSeenAt: earlier, LastSeenAt: earlier, LastNotifiedAt: earlier}
+	reopened := Appointment{Date: "2024-05-21", Time: "9:00 am – 9:30 am", FirstSeenAt: earlier, LastSeenAt: earlier, LastNotifiedAt: earlier}
+	gone := Appointment{Date: "2024-05-22", Time: "9:00 am – 9:30 am", FirstSeenAt: earlier, LastSeenAt: earlier, LastNotifiedAt: earlier}
+	fresh := Appointment{Date: "2024-05-23", Time: "9:00 am – 9:30 am", Spaces: 2}
+
+	records := seenRecords([]Appointment{kept, reopened, gone},
+		[]Appointment{{Date: reopened.Date, Time: reopened.Time, Spaces: 3}, fresh},
+		[]Appointment{{Date: kept.Date, Time: kept.Time}, {Date: reopened.Date, Time: reopened.Time}, fresh}, now)
+
+	want := map[string]Appointment{
+		reopened.Date: {Date: reopened.Date, Time: reopened.Time, Spaces: 3, FirstSeenAt: earlier, LastSeenAt: now, LastNotifiedAt: now},
+		fresh.Date:    {Date: fresh.Date, Time: fresh.Time, Spaces: 2, FirstSeenAt: now, LastSeenAt: now, LastNotifiedAt: now},
+		kept.Date:     {Date: kept.Date, Time: kept.Time, FirstSeenAt: earlier, LastSeenAt: now, LastNotifiedAt: earlier},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("seenRecords() = %+v, want %d records, leaving out the slot no longer found", records, len(want))
+	}
+	for _, got := range records {
+		if !reflect.DeepEqual(got, want[got.Date]) {
+			t.Errorf("seenRecords() record for %s = %+v, want %+v", got.Date, got, want[got.Date])
 		}
-	})
+	}
 }
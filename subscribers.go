@@ -0,0 +1,315 @@
+package melanzana
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// managedSubscriber is a subscriber added through the API, with the token
+// that lets them change or remove their subscription.
+type managedSubscriber struct {
+	Recipient
+	Token string `json:"token"`
+}
+
+// loadManagedSubscribers returns the subscribers added through the API.
+func loadManagedSubscribers(store Store) ([]managedSubscriber, error) {
+	records, err := store.Subscribers()
+	if err != nil {
+		return nil, err
+	}
+	return decodeManagedSubscribers(records)
+}
+
+// updateManagedSubscribers replaces the subscribers added through the API
+// with the result of change applied to the stored ones, as
+// Store.UpdateSubscribers does.
+func updateManagedSubscribers(store Store, change func([]managedSubscriber) ([]managedSubscriber, error)) error {
+	return store.UpdateSubscribers(func(records []json.RawMessage) ([]json.RawMessage, error) {
+		subscribers, err := decodeManagedSubscribers(records)
+		if err != nil {
+			return nil, err
+		}
+		if subscribers, err = change(subscribers); err != nil {
+			return nil, err
+		}
+		records = make([]json.RawMessage, len(subscribers))
+		for i, s := range subscribers {
+			if records[i], err = json.Marshal(s); err != nil {
+				return nil, fmt.Errorf("failed to marshal subscriber %s: %w", s.Name, err)
+			}
+		}
+		return records, nil
+	})
+}
+
+func decodeManagedSubscribers(records []json.RawMessage) ([]managedSubscriber, error) {
+	var subscribers []managedSubscriber
+	for _, record := range records {
+		var s managedSubscriber
+		if err := json.Unmarshal(record, &s); err != nil {
+			return nil, fmt.Errorf("failed to parse subscriber: %w", err)
+		}
+		subscribers = append(subscribers, s)
+	}
+	return subscribers, nil
+}
+
+// withManagedSubscribers returns config with the subscribers added through
+// the API appended to the configured ones. If they can't be read, only the
+// configured subscribers are notified.
+func withManagedSubscribers(config AppConfig, store Store) AppConfig {
+	if config.SubscriberAPIToken == "" {
+		return config
+	}
+	managed, err := loadManagedSubscribers(store)
+	if err != nil {
+		slog.Warn("Error loading subscribers added through the API", "err", err)
+		return config
+	}
+	config.Subscribers = slices.Clip(config.Subscribers)
+	for _, s := range managed {
+		config.Subscribers = append(config.Subscribers, s.Recipient)
+	}
+	return config
+}
+
+// subscriberAPI lets a group of subscribers manage themselves while the
+// watcher runs:
+//
+//	POST   /api/subscribers         add a subscriber
+//	GET    /api/subscribers/{name}  show a subscriber
+//	PUT    /api/subscribers/{name}  replace a subscriber's channels and filters
+//	DELETE /api/subscribers/{name}  remove a subscriber
+//
+// Requests authenticate with "Authorization: Bearer <token>". Adding takes
+// the shared subscriberApiToken. The others take either that or the token
+// returned when the subscriber was added.
+type subscriberAPI struct {
+	config AppConfig
+	store  func() (Store, error)
+}
+
+// subscriberError is a request the API refuses, with the status to reply with.
+type subscriberError struct {
+	status int
+	msg    string
+}
+
+func (e subscriberError) Error() string { return e.msg }
+
+func (a *subscriberAPI) register(mux *http.ServeMux) {
+	mux.HandleFunc("POST /api/subscribers", a.add)
+	mux.HandleFunc("GET /api/subscribers/{name}", a.show)
+	mux.HandleFunc("PUT /api/subscribers/{name}", a.replace)
+	mux.HandleFunc("DELETE /api/subscribers/{name}", a.remove)
+}
+
+func (a *subscriberAPI) add(w http.ResponseWriter, r *http.Request) {
+	if !tokenMatches(bearerToken(r), a.config.SubscriberAPIToken) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "a valid token is required"})
+		return
+	}
+	var s managedSubscriber
+	if !a.decode(w, r, &s.Recipient) || !a.validate(w, s.Recipient) {
+		return
+	}
+	token, err := newUnsubscribeToken()
+	if err == nil {
+		s.Token = token
+		s.UnsubscribeToken, err = newUnsubscribeToken()
+	}
+	if err != nil {
+		writeSubscriberError(w, err)
+		return
+	}
+	err = a.update(func(subscribers []managedSubscriber) ([]managedSubscriber, error) {
+		if a.nameTaken(subscribers, s.Name) {
+			return nil, subscriberError{http.StatusConflict, fmt.Sprintf("a subscriber named %q already exists", s.Name)}
+		}
+		return append(subscribers, s), nil
+	})
+	if err != nil {
+		writeSubscriberError(w, err)
+		return
+	}
+	slog.Info("Subscriber added through the API", "subscriber", s.Name)
+	writeJSON(w, http.StatusCreated, s)
+}
+
+func (a *subscriberAPI) show(w http.ResponseWriter, r *http.Request) {
+	store, err := a.store()
+	var subscribers []managedSubscriber
+	if err == nil {
+		subscribers, err = loadManagedSubscribers(store)
+	}
+	if err != nil {
+		writeSubscriberError(w, err)
+		return
+	}
+	i, err := a.authorize(r, subscribers)
+	if err != nil {
+		writeSubscriberError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, subscribers[i].Recipient)
+}
+
+func (a *subscriberAPI) replace(w http.ResponseWriter, r *http.Request) {
+	var replacement Recipient
+	if !a.decode(w, r, &replacement) {
+		return
+	}
+	replacement.Name = r.PathValue("name")
+	if !a.validate(w, replacement) {
+		return
+	}
+	// Subscribers added before they were given an unsubscribe token get one.
+	unsubscribeToken, err := newUnsubscribeToken()
+	if err != nil {
+		writeSubscriberError(w, err)
+		return
+	}
+	err = a.update(func(subscribers []managedSubscriber) ([]managedSubscriber, error) {
+		i, err := a.authorize(r, subscribers)
+		if err != nil {
+			return nil, err
+		}
+		replacement.UnsubscribeToken = subscribers[i].UnsubscribeToken
+		if replacement.UnsubscribeToken == "" {
+			replacement.UnsubscribeToken = unsubscribeToken
+		}
+		subscribers[i].Recipient = replacement
+		return subscribers, nil
+	})
+	if err != nil {
+		writeSubscriberError(w, err)
+		return
+	}
+	slog.Info("Subscriber updated through the API", "subscriber", replacement.Name)
+	writeJSON(w, http.StatusOK, replacement)
+}
+
+func (a *subscriberAPI) remove(w http.ResponseWriter, r *http.Request) {
+	err := a.update(func(subscribers []managedSubscriber) ([]managedSubscriber, error) {
+		i, err := a.authorize(r, subscribers)
+		if err != nil {
+			return nil, err
+		}
+		return slices.Delete(subscribers, i, i+1), nil
+	})
+	if err != nil {
+		writeSubscriberError(w, err)
+		return
+	}
+	slog.Info("Subscriber removed through the API", "subscriber", r.PathValue("name"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorize returns the index of the subscriber the request names, if its
+// token is theirs or the shared one.
+func (a *subscriberAPI) authorize(r *http.Request, subscribers []managedSubscriber) (int, error) {
+	token := bearerToken(r)
+	shared := tokenMatches(token, a.config.SubscriberAPIToken)
+	i := slices.IndexFunc(subscribers, func(s managedSubscriber) bool { return s.Name == r.PathValue("name") })
+	switch {
+	case i >= 0 && (shared || tokenMatches(token, subscribers[i].Token)):
+		return i, nil
+	case shared:
+		return 0, subscriberError{http.StatusNotFound, fmt.Sprintf("no subscriber named %q", r.PathValue("name"))}
+	default:
+		// Unknown names are unauthorized too, so names can't be probed.
+		return 0, subscriberError{http.StatusUnauthorized, "a valid token is required"}
+	}
+}
+
+// decode reads a subscriber from the request body, writing an error
+// response if it can't.
+func (a *subscriberAPI) decode(w http.ResponseWriter, r *http.Request, s *Recipient) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(s); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid subscriber: " + err.Error()})
+		return false
+	}
+	s.UnsubscribeToken = ""
+	return true
+}
+
+// validate checks a subscriber as loading the configuration would, and
+// that it has a usable name, writing an error response if it fails.
+func (a *subscriberAPI) validate(w http.ResponseWriter, s Recipient) bool {
+	err := validateSubscribers([]Recipient{s})
+	switch {
+	case err != nil:
+	case !namespaceNamePattern.MatchString(s.Name):
+		err = fmt.Errorf("subscriber name %q must be letters, digits, '-' or '_'", s.Name)
+	case s.Phone != "" && (a.config.SMSAccountSID == "" || a.config.SMSAuthToken == "" || a.config.SMSFrom == ""):
+		err = errors.New("text messages aren't set up; use another channel")
+	case s.Telegram != "" && a.config.TelegramBotToken == "":
+		err = errors.New("Telegram isn't set up; use another channel")
+	default:
+		if unknown := unknownCalendars(a.config, s.Calendars); len(unknown) > 0 {
+			err = fmt.Errorf("unknown calendars %q", unknown)
+		}
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// nameTaken reports whether a configured or managed subscriber has name.
+func (a *subscriberAPI) nameTaken(subscribers []managedSubscriber, name string) bool {
+	for _, s := range a.config.Subscribers {
+		if s.Name == name {
+			return true
+		}
+	}
+	return slices.ContainsFunc(subscribers, func(s managedSubscriber) bool { return s.Name == name })
+}
+
+func (a *subscriberAPI) update(change func([]managedSubscriber) ([]managedSubscriber, error)) error {
+	store, err := a.store()
+	if err != nil {
+		return err
+	}
+	return updateManagedSubscribers(store, func(subscribers []managedSubscriber) ([]managedSubscriber, error) {
+		subscribers, err := change(subscribers)
+		if err != nil {
+			return nil, permanent(err)
+		}
+		return subscribers, nil
+	})
+}
+
+func writeSubscriberError(w http.ResponseWriter, err error) {
+	var refused subscriberError
+	if errors.As(err, &refused) {
+		writeJSON(w, refused.status, map[string]string{"error": refused.msg})
+		return
+	}
+	slog.Error("Error updating subscribers for the API", "err", err)
+	writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "subscribers are unavailable"})
+}
+
+// bearerToken returns the token in the request's Authorization header.
+func bearerToken(r *http.Request) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// tokenMatches compares tokens in constant time; an empty token never matches.
+func tokenMatches(got, want string) bool {
+	return got != "" && want != "" && subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
@@ -0,0 +1,90 @@
+package melanzana
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pashbylogan/melanzana/pkg/store"
+)
+
+func TestSubscriberAPI(t *testing.T) {
+	dir := t.TempDir()
+	store := &store.JSONFile{Path: filepath.Join(dir, "seen.json"), SubscribersPath: filepath.Join(dir, "subscribers.json")}
+	config := AppConfig{
+		SubscriberAPIToken: "group-secret",
+		Subscribers:        []Recipient{{Name: "me", Email: "me@example.com"}},
+	}
+	api := &apiServer{
+		latest:      &scrapeSnapshot{},
+		subscribers: &subscriberAPI{config: config, store: func() (Store, error) { return store, nil }},
+	}
+	server := httptest.NewServer(api.handler())
+	defer server.Close()
+
+	do := func(method, path, token, body string, out any) int {
+		t.Helper()
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s error = %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		if out != nil && resp.StatusCode < 300 {
+			if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+				t.Fatalf("%s %s body: %v", method, path, err)
+			}
+		}
+		return resp.StatusCode
+	}
+
+	grandma := `{"name": "grandma", "email": "grandma@example.com", "weekdays": ["Sat"]}`
+	if code := do("POST", "/api/subscribers", "", grandma, nil); code != http.StatusUnauthorized {
+		t.Errorf("POST without a token = %d, want 401", code)
+	}
+	if code := do("POST", "/api/subscribers", "group-secret", `{"name": "grandma"}`, nil); code != http.StatusBadRequest {
+		t.Errorf("POST without a channel = %d, want 400", code)
+	}
+	if code := do("POST", "/api/subscribers", "group-secret", `{"name": "me", "email": "other@example.com"}`, nil); code != http.StatusConflict {
+		t.Errorf("POST with a configured subscriber's name = %d, want 409", code)
+	}
+	var added managedSubscriber
+	if code := do("POST", "/api/subscribers", "group-secret", grandma, &added); code != http.StatusCreated || added.Token == "" {
+		t.Fatalf("POST = %d %+v, want 201 with a token", code, added)
+	}
+
+	var shown Recipient
+	if code := do("GET", "/api/subscribers/grandma", added.Token, "", &shown); code != http.StatusOK || shown.Email != "grandma@example.com" {
+		t.Errorf("GET with the subscriber's token = %d %+v, want 200 and the subscriber", code, shown)
+	}
+	if code := do("GET", "/api/subscribers/grandma", "wrong", "", nil); code != http.StatusUnauthorized {
+		t.Errorf("GET with a wrong token = %d, want 401", code)
+	}
+	if code := do("PUT", "/api/subscribers/grandma", added.Token, `{"email": "grandma@example.com", "weekdays": ["Sun"], "minSpaces": 2}`, nil); code != http.StatusOK {
+		t.Errorf("PUT = %d, want 200", code)
+	}
+
+	merged := withManagedSubscribers(config, store)
+	if len(merged.Subscribers) != 2 || merged.Subscribers[1].Name != "grandma" || merged.Subscribers[1].MinSpaces != 2 {
+		t.Errorf("withManagedSubscribers() = %+v, want the configured and updated subscribers", merged.Subscribers)
+	}
+	if len(config.Subscribers) != 1 {
+		t.Errorf("withManagedSubscribers() changed the configured subscribers: %+v", config.Subscribers)
+	}
+
+	if code := do("DELETE", "/api/subscribers/grandma", added.Token, "", nil); code != http.StatusNoContent {
+		t.Errorf("DELETE = %d, want 204", code)
+	}
+	if code := do("GET", "/api/subscribers/grandma", "group-secret", "", nil); code != http.StatusNotFound {
+		t.Errorf("GET after DELETE = %d, want 404", code)
+	}
+}
@@ -0,0 +1,96 @@
+package melanzana
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// Exit codes of a single check, so cron jobs and wrappers can tell what
+// kind of failure to react to.
+const (
+	exitOK          = 0
+	exitConfigError = 1 // The configuration is invalid
+	exitFetchError  = 2 // No availability could be fetched
+	exitNotifyError = 3 // At least one notification couldn't be sent
+	exitStoreError  = 4 // The state store couldn't be reached
+)
+
+// CycleSummary is the machine-readable outcome of one scraping cycle.
+type CycleSummary struct {
+	Started           time.Time    `json:"started"`
+	Finished          time.Time    `json:"finished"`
+	Status            string       `json:"status"` // "ok", "config error", "fetch error", "notify error" or "store error"
+	ExitCode          int          `json:"exitCode"`
+	MonthsChecked     int          `json:"monthsChecked"` // Months fetched from the booking calendar; 0 when served from the cache
+	FetchErrors       int          `json:"fetchErrors"`   // Months that couldn't be fetched
+	SlotsFound        int          `json:"slotsFound"`
+	NewSlots          int          `json:"newSlots"`
+	Changes           changeCounts `json:"changes"` // Changes found in the booking calendar, by kind
+	NotificationsSent int          `json:"notificationsSent"`
+	SendErrors        int          `json:"sendErrors"`
+	StoreErrors       int          `json:"storeErrors"`
+	Error             string       `json:"error,omitempty"`
+	Category          string       `json:"category,omitempty"` // Of the error: "transient", "config" or "permanent"
+}
+
+// newCycleSummary describes a cycle from the session statistics before and
+// after it.
+func newCycleSummary(before, after SessionStats, scraped, newAppointments []Appointment, err error, finished time.Time) CycleSummary {
+	s := CycleSummary{
+		Finished:      finished,
+		MonthsChecked: after.MonthsChecked - before.MonthsChecked,
+		FetchErrors:   after.FetchErrors - before.FetchErrors,
+		SlotsFound:    len(scraped),
+		NewSlots:      len(newAppointments),
+		Changes: changeCounts{
+			SlotsAdded:      after.Changes.SlotsAdded - before.Changes.SlotsAdded,
+			SlotsRemoved:    after.Changes.SlotsRemoved - before.Changes.SlotsRemoved,
+			SpacesChanged:   after.Changes.SpacesChanged - before.Changes.SpacesChanged,
+			WindowsExtended: after.Changes.WindowsExtended - before.Changes.WindowsExtended,
+		},
+		NotificationsSent: after.NotificationsSent - before.NotificationsSent,
+		SendErrors:        after.SendErrors - before.SendErrors,
+		StoreErrors:       after.StoreErrors - before.StoreErrors,
+	}
+	switch {
+	case categorize(err) == categoryConfig:
+		s.Status, s.ExitCode = "config error", exitConfigError
+	case errors.Is(err, errStore):
+		s.Status, s.ExitCode = "store error", exitStoreError
+	case err != nil:
+		s.Status, s.ExitCode = "fetch error", exitFetchError
+	case s.SendErrors > 0:
+		s.Status, s.ExitCode = "notify error", exitNotifyError
+	default:
+		s.Status, s.ExitCode = "ok", exitOK
+	}
+	if err != nil {
+		s.Error, s.Category = err.Error(), string(categorize(err))
+	}
+	return s
+}
+
+// writeCycleSummary writes the summary as one line of JSON to summaryFile,
+// "-" for stdout, replacing a file's previous contents.
+func writeCycleSummary(config AppConfig, s CycleSummary) {
+	if config.SummaryFile == "" {
+		return
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		slog.Error("Error encoding cycle summary", "err", err)
+		return
+	}
+	data = append(data, '\n')
+	if config.SummaryFile == "-" {
+		fmt.Print(string(data))
+		return
+	}
+	if err := os.WriteFile(config.SummaryFile, data, 0644); err != nil {
+		slog.Error("Error writing cycle summary", "file", config.SummaryFile, "err", err)
+	}
+}
@@ -0,0 +1,58 @@
+package melanzana
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pashbylogan/melanzana/pkg/cowlendar"
+)
+
+func TestNewCycleSummary(t *testing.T) {
+	before := SessionStats{NotificationsSent: 4, MonthsChecked: 6}
+	scraped := []Appointment{{Date: "2024-06-15"}, {Date: "2024-06-16"}}
+
+	tests := []struct {
+		name       string
+		after      SessionStats
+		err        error
+		wantStatus string
+		wantCode   int
+	}{
+		{"OK", SessionStats{NotificationsSent: 6, MonthsChecked: 9}, nil, "ok", exitOK},
+		{"SendFailed", SessionStats{NotificationsSent: 5, SendErrors: 1, MonthsChecked: 9}, nil, "notify error", exitNotifyError},
+		{"FetchFailed", SessionStats{NotificationsSent: 4, MonthsChecked: 6, FetchErrors: 3}, errors.New("no month could be fetched"), "fetch error", exitFetchError},
+		{"BadStore", SessionStats{NotificationsSent: 4, MonthsChecked: 9}, fmt.Errorf("%w: %w", errInvalidConfig, errors.New("unknown state store")), "config error", exitConfigError},
+		{"StoreUnreachable", SessionStats{NotificationsSent: 4, MonthsChecked: 9}, fmt.Errorf("%w: %w", errStore, errors.New("connection refused")), "store error", exitStoreError},
+		{"UnknownCalendar", SessionStats{NotificationsSent: 4, MonthsChecked: 6, FetchErrors: 3}, fmt.Errorf("%w: %w", errFetch, &cowlendar.StatusError{StatusCode: 404}), "config error", exitConfigError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newCycleSummary(before, tt.after, scraped, scraped[:1], tt.err, time.Now())
+			if s.Status != tt.wantStatus || s.ExitCode != tt.wantCode {
+				t.Errorf("summary = %q exit %d, want %q exit %d", s.Status, s.ExitCode, tt.wantStatus, tt.wantCode)
+			}
+			if s.MonthsChecked != tt.after.MonthsChecked-6 || s.NotificationsSent != tt.after.NotificationsSent-4 || s.SlotsFound != 2 || s.NewSlots != 1 {
+				t.Errorf("summary = %+v, want counts for this cycle only", s)
+			}
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), "summary.json")
+	writeCycleSummary(AppConfig{SummaryFile: path}, newCycleSummary(before, before, scraped, nil, nil, time.Now()))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	var written map[string]any
+	if err := json.Unmarshal(data, &written); err != nil {
+		t.Fatalf("summary file is not JSON: %v", err)
+	}
+	if written["status"] != "ok" || written["slotsFound"] != float64(2) {
+		t.Errorf("summary file = %s, want status ok and 2 slots", data)
+	}
+}
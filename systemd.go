@@ -0,0 +1,106 @@
+package melanzana
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// sdNotify sends state to the service manager over $NOTIFY_SOCKET, as
+// sd_notify(3) does. Without the variable, outside systemd or with a unit
+// Type other than notify, it does nothing.
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:] // Abstract namespace
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("failed to connect to systemd notify socket: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("failed to notify systemd: %w", err)
+	}
+	return nil
+}
+
+// watchdogInterval returns how often systemd expects to hear WATCHDOG=1,
+// or 0 if the unit has no WatchdogSec or it is meant for another process.
+func watchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// cycleTracker records when the running cycle started, so the watchdog can
+// tell a stuck cycle from the wait between cycles.
+type cycleTracker struct {
+	started atomic.Int64 // Unix nanoseconds; 0 between cycles
+}
+
+// runningCycle tracks the daemon's cycles.
+var runningCycle = &cycleTracker{}
+
+func (c *cycleTracker) begin(now time.Time) { c.started.Store(now.UnixNano()) }
+
+func (c *cycleTracker) end() { c.started.Store(0) }
+
+// stuck reports whether a cycle has been running for longer than limit; a
+// zero limit never considers one stuck.
+func (c *cycleTracker) stuck(now time.Time, limit time.Duration) bool {
+	started := c.started.Load()
+	return limit > 0 && started != 0 && now.Sub(time.Unix(0, started)) > limit
+}
+
+// superviseWatchdog pets the systemd watchdog twice per interval until stop
+// is called. While a cycle has been running for longer than maxCycle it
+// stops petting, so systemd kills and restarts the stuck process.
+func superviseWatchdog(interval, maxCycle time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval / 2)
+	done := make(chan struct{})
+	go func() {
+		defer ticker.Stop()
+		warned := false
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			if runningCycle.stuck(clock.Now(), maxCycle) {
+				if !warned {
+					slog.Error("Cycle is stuck, no longer petting the systemd watchdog", "maxCycle", maxCycle)
+					warned = true
+				}
+				continue
+			}
+			warned = false
+			if err := sdNotify("WATCHDOG=1"); err != nil {
+				slog.Warn("Error petting the systemd watchdog", "err", err)
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// cycleStatus describes a cycle for systemctl status.
+func cycleStatus(s CycleSummary) string {
+	at := s.Finished.In(sourceLocation()).Format("Jan 2 15:04")
+	if s.Status != "ok" {
+		return fmt.Sprintf("Last check %s: %s: %s", at, s.Status, s.Error)
+	}
+	return fmt.Sprintf("Last check %s: %d slots, %d new, %d notifications sent", at, s.SlotsFound, s.NewSlots, s.NotificationsSent)
+}
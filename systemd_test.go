@@ -0,0 +1,81 @@
+package melanzana
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSdNotify(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if err := sdNotify("READY=1"); err != nil {
+		t.Errorf("sdNotify() without a socket error = %v, want nil", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("unix datagram sockets unavailable: %v", err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", path)
+
+	if err := sdNotify("READY=1\nSTATUS=Running the first check"); err != nil {
+		t.Fatalf("sdNotify() error = %v", err)
+	}
+	buf := make([]byte, 256)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil || string(buf[:n]) != "READY=1\nSTATUS=Running the first check" {
+		t.Errorf("socket received %q, %v", buf[:n], err)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	tests := []struct {
+		name string
+		usec string
+		pid  string
+		want time.Duration
+	}{
+		{"Off", "", "", 0},
+		{"On", "120000000", "", 2 * time.Minute},
+		{"ThisProcess", "120000000", strconv.Itoa(os.Getpid()), 2 * time.Minute},
+		{"OtherProcess", "120000000", "1", 0},
+		{"Invalid", "soon", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WATCHDOG_USEC", tt.usec)
+			t.Setenv("WATCHDOG_PID", tt.pid)
+			if got := watchdogInterval(); got != tt.want {
+				t.Errorf("watchdogInterval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCycleTrackerStuck(t *testing.T) {
+	now := time.Date(2099, 7, 1, 12, 0, 0, 0, time.UTC)
+	var c cycleTracker
+	if c.stuck(now, time.Minute) {
+		t.Error("stuck() between cycles = true, want false")
+	}
+	c.begin(now)
+	if c.stuck(now.Add(30*time.Second), time.Minute) {
+		t.Error("stuck() 30s into a cycle = true, want false")
+	}
+	if !c.stuck(now.Add(2*time.Minute), time.Minute) {
+		t.Error("stuck() 2m into a cycle = false, want true")
+	}
+	if c.stuck(now.Add(2*time.Minute), 0) {
+		t.Error("stuck() with no limit = true, want false")
+	}
+	c.end()
+	if c.stuck(now.Add(2*time.Minute), time.Minute) {
+		t.Error("stuck() after the cycle ended = true, want false")
+	}
+}
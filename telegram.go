@@ -0,0 +1,316 @@
+package melanzana
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"context"
+	"github.com/pashbylogan/melanzana/pkg/notify"
+)
+
+// telegramChatPattern matches Telegram chat IDs; groups have negative ones.
+var telegramChatPattern = regexp.MustCompile(`^-?[0-9]+$`)
+
+// telegramPollSeconds is how long each getUpdates request waits for a message.
+const telegramPollSeconds = 50
+
+// telegramListMax is how many slots /list shows before summarising the rest.
+const telegramListMax = 15
+
+// sendTelegramMessage sends text to a Telegram chat through the bot.
+func sendTelegramMessage(config AppConfig, chatID, text string) error {
+	return sendTelegramButtons(config, chatID, text, nil)
+}
+
+// sendTelegramButtons sends text with rows of buttons below it; with no
+// buttons it is sendTelegramMessage.
+func sendTelegramButtons(config AppConfig, chatID, text string, buttons [][]notify.TelegramButton) error {
+	if config.TelegramBotToken == "" {
+		return fmt.Errorf("%w: %w", errNotify, errors.New("telegramBotToken is required to send Telegram messages"))
+	}
+	return sendWithRetry(config, "Sending Telegram message to "+chatID, func() error {
+		return telegramSender(config).Send(chatID, text, buttons)
+	})
+}
+
+// telegramUpdate is the part of a Bot API update the bot reads.
+type telegramUpdate struct {
+	UpdateID int              `json:"update_id"`
+	Message  *telegramMessage `json:"message"`
+	// A button under one of the bot's messages was pressed.
+	CallbackQuery *struct {
+		ID      string           `json:"id"`
+		Data    string           `json:"data"`
+		Message *telegramMessage `json:"message"`
+	} `json:"callback_query"`
+}
+
+type telegramMessage struct {
+	Chat struct {
+		ID int64 `json:"id"`
+	} `json:"chat"`
+	Text string `json:"text"`
+}
+
+// telegramBot answers commands sent to the bot:
+//
+//	/status          when slots were last checked, and the sender's subscription
+//	/list            open slots, filtered by the sender's preferences
+//	/pause 3d        no notifications for that long; /resume ends a pause
+//	/filter weekends only slots on those days; also weekdays, sat sun, or any
+//	/stop            unsubscribe
+//
+// Senders are recognised by their chat ID, the telegram of a recipient or
+// subscriber; other chats are only told their ID. Like emailed commands, changes apply to recipientsFile
+// entries and subscribers added through the API.
+//
+// The bot also handles the Book buttons sent to autoBooking.telegram; see
+// bookButtons.
+type telegramBot struct {
+	config AppConfig
+	client *http.Client
+	offset int
+}
+
+// startTelegramBot answers the bot's commands in the background until ctx
+// is done.
+func startTelegramBot(ctx context.Context, config AppConfig) {
+	bot := &telegramBot{config: config, client: &http.Client{Transport: outboundTransport, Timeout: (telegramPollSeconds + 10) * time.Second}}
+	go func() {
+		slog.Info("Answering Telegram bot commands")
+		for ctx.Err() == nil {
+			if err := bot.poll(); err != nil {
+				slog.Warn("Error reading Telegram bot commands", "err", err)
+				clock.Sleep(30 * time.Second)
+			}
+		}
+	}()
+}
+
+// poll waits for new messages and answers each.
+func (b *telegramBot) poll() error {
+	query := url.Values{"offset": {fmt.Sprint(b.offset)}, "timeout": {fmt.Sprint(telegramPollSeconds)}, "allowed_updates": {`["message","callback_query"]`}}
+	resp, err := b.client.Get(telegramSender(b.config).MethodURL("getUpdates") + "?" + query.Encode())
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = telegramSender(b.config).Redact(urlErr)
+		}
+		return fmt.Errorf("Telegram getUpdates failed: %w", err)
+	}
+	defer resp.Body.Close()
+	var updates struct {
+		OK          bool             `json:"ok"`
+		Description string           `json:"description"`
+		Result      []telegramUpdate `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&updates); err != nil {
+		return fmt.Errorf("failed to parse Telegram updates: %w", err)
+	}
+	if !updates.OK {
+		return fmt.Errorf("Telegram getUpdates returned status %d: %s", resp.StatusCode, updates.Description)
+	}
+	for _, u := range updates.Result {
+		b.offset = max(b.offset, u.UpdateID+1)
+		if q := u.CallbackQuery; q != nil && q.Message != nil {
+			b.pressed(q.ID, fmt.Sprint(q.Message.Chat.ID), q.Data)
+			continue
+		}
+		if u.Message == nil || !strings.HasPrefix(u.Message.Text, "/") {
+			continue
+		}
+		chatID := fmt.Sprint(u.Message.Chat.ID)
+		if err := sendTelegramMessage(b.config, chatID, b.answer(chatID, u.Message.Text)); err != nil {
+			slog.Warn("Error answering Telegram command", "chat", chatID, "err", err)
+		}
+	}
+	return nil
+}
+
+// answer runs the command in text for chatID and returns the reply.
+func (b *telegramBot) answer(chatID, text string) string {
+	name, args, _ := strings.Cut(strings.TrimSpace(text), " ")
+	name, _, _ = strings.Cut(name, "@") // "/list@melanzana_bot" in groups
+	args = strings.TrimSpace(args)
+	r, subscribed := b.recipient(chatID)
+	if !subscribed {
+		// Only subscribers can query the watcher.
+		return fmt.Sprintf("You aren't subscribed. Your chat ID is %s; ask whoever runs the watcher to add it as your telegram.", chatID)
+	}
+
+	switch strings.ToLower(name) {
+	case "/status":
+		return b.status(r)
+	case "/list":
+		return b.list(r)
+	case "/pause", "/resume", "/filter", "/stop":
+	default:
+		return fmt.Sprintf("Commands: /status, /list, /pause 3d, /resume, /filter weekends, /filter any, /stop. Your chat ID is %s.", chatID)
+	}
+
+	var command string
+	switch strings.ToLower(name) {
+	case "/pause":
+		command = "pause " + args
+	case "/resume":
+		command = "resume"
+	case "/stop":
+		command = "unsubscribe"
+	default:
+		command = "only " + args
+		if a := strings.ToLower(args); a == "any" || a == "all" || a == "off" {
+			command = "any day"
+		}
+	}
+	cmd, ok := parseEmailCommand(command)
+	if !ok {
+		return fmt.Sprintf("Sorry, I didn't understand %q.", text)
+	}
+	if b.config.ReadOnly {
+		return "Subscriptions can't be changed while the watcher is read-only."
+	}
+	found, confirmation, err := changeSubscription(b.config, func(r Recipient) bool { return r.Telegram == chatID }, cmd)
+	switch {
+	case err != nil:
+		slog.Error("Error applying Telegram command", "chat", chatID, "command", cmd.kind, "err", err)
+		return "Sorry, your subscription couldn't be changed. Try again later."
+	case !found:
+		return "Your subscription is in the config file and can't be changed from here."
+	}
+	slog.Info("Applied Telegram command", "chat", chatID, "command", cmd.kind)
+	return confirmation
+}
+
+// recipient returns the recipient or subscriber notified at chatID.
+func (b *telegramBot) recipient(chatID string) (Recipient, bool) {
+	config := b.config
+	if store, err := newStore(config); err == nil {
+		config = withManagedSubscribers(config, store)
+	}
+	recipients, err := resolveRecipients(config)
+	if err != nil {
+		slog.Warn("Error loading recipients for the Telegram bot", "err", err)
+	}
+	for _, r := range recipients {
+		if r.Telegram == chatID {
+			return r, true
+		}
+	}
+	return Recipient{}, false
+}
+
+func (b *telegramBot) status(r Recipient) string {
+	var lines []string
+	slots, at := latestScrape.get()
+	if at.IsZero() {
+		lines = append(lines, "Slots haven't been checked yet.")
+	} else {
+		lines = append(lines, fmt.Sprintf("Last checked %s: %d open slots.", at.In(sourceLocation()).Format("Mon Jan 2 3:04 pm"), len(slots)))
+	}
+	if err := health.failing(); err != "" {
+		lines = append(lines, "The last check failed: "+err)
+	}
+
+	switch {
+	case r.PausedUntil != nil && clock.Now().Before(*r.PausedUntil):
+		lines = append(lines, "Your notifications are paused until "+r.PausedUntil.In(sourceLocation()).Format("Mon Jan 2 3:04 pm")+".")
+	case len(r.Weekdays) > 0:
+		lines = append(lines, "You're notified about slots on "+strings.Join(r.Weekdays, ", ")+".")
+	default:
+		lines = append(lines, "You're notified about slots on every day.")
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (b *telegramBot) list(r Recipient) string {
+	slots, at := latestScrape.get()
+	if at.IsZero() {
+		return "Slots haven't been checked yet."
+	}
+	var wanted []Appointment
+	for _, appt := range slots {
+		if r.matches(appt) {
+			wanted = append(wanted, appt)
+		}
+	}
+	if len(wanted) == 0 {
+		return "No open slots you'd be notified about."
+	}
+	sortSlots(wanted)
+	var s strings.Builder
+	fmt.Fprintf(&s, "%d open slots:", len(wanted))
+	for i, appt := range wanted {
+		if i == telegramListMax {
+			fmt.Fprintf(&s, "\n+%d more", len(wanted)-telegramListMax)
+			break
+		}
+		fmt.Fprintf(&s, "\n%s %s%s", appt.Date, appt.Time, calendarSuffix(appt))
+	}
+	s.WriteString("\nBook: " + bookingURL)
+	return s.String()
+}
+
+// pressed handles a Book button pressed in chatID. The first press only
+// asks for confirmation; the slot is booked when that is confirmed.
+func (b *telegramBot) pressed(queryID, chatID, data string) {
+	// Stop the button's progress indicator; the answer is a new message.
+	body, _ := json.Marshal(map[string]string{"callback_query_id": queryID})
+	if err := telegramSender(b.config).Call("answerCallbackQuery", body); err != nil {
+		slog.Debug("Error answering Telegram button", "err", err)
+	}
+
+	reply, buttons := b.book(chatID, data)
+	if reply == "" {
+		return
+	}
+	if err := sendTelegramButtons(b.config, chatID, reply, buttons); err != nil {
+		slog.Warn("Error answering Telegram button", "chat", chatID, "err", err)
+	}
+}
+
+// book runs the booking step a button's data names and returns the reply.
+func (b *telegramBot) book(chatID, data string) (string, [][]notify.TelegramButton) {
+	config := b.config
+	if chatID != bookingChat(config) {
+		return "Only the person in autoBooking can book slots from here.", nil
+	}
+	action, token, _ := strings.Cut(data, ":")
+	if action == "cancel" {
+		return "Not booked.", nil
+	}
+	appt, ok := bookOffers.get(token)
+	if !ok {
+		return "That slot is no longer on offer. Use /list to see open slots.", nil
+	}
+	slot := fmt.Sprintf("%s at %s%s", appt.Date, appt.Time, calendarSuffix(appt))
+	switch action {
+	case "book":
+		return fmt.Sprintf("Book %s for %s? The shop will be sent your contact details.", slot, config.AutoBooking.Name),
+			[][]notify.TelegramButton{{{Text: "Yes, book it", CallbackData: "confirm:" + token}, {Text: "Cancel", CallbackData: "cancel"}}}
+	case "confirm":
+	default:
+		return "Sorry, I didn't understand that button.", nil
+	}
+	if config.ReadOnly || config.DryRun {
+		return "Slots can't be booked while the watcher is read-only.", nil
+	}
+
+	attempt, err := bookConfirmed(config, appt)
+	switch {
+	case err != nil:
+		slog.Error("Error booking slot from Telegram", "date", appt.Date, "time", appt.Time, "err", err)
+		return "Sorry, the booking couldn't be recorded. Nothing was sent to the shop.", nil
+	case attempt == nil:
+		return "You have already booked " + slot + ".", nil
+	}
+	// The outcome is reported to the booker's channels, this chat included.
+	reportBooking(config, *attempt)
+	return "", nil
+}
@@ -0,0 +1,202 @@
+package melanzana
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pashbylogan/melanzana/pkg/notify"
+)
+
+func TestTelegramBot(t *testing.T) {
+	now := time.Date(2099, 7, 1, 12, 0, 0, 0, time.UTC)
+	fixClock(t, now)
+	defer func(s *scrapeSnapshot) { latestScrape = s }(latestScrape)
+	latestScrape = &scrapeSnapshot{}
+	latestScrape.update([]Appointment{
+		{Date: "2099-07-04", Time: "10:00 am – 10:30 am", Spaces: 1}, // Saturday
+		{Date: "2099-07-06", Time: "10:00 am – 10:30 am", Spaces: 1}, // Monday
+	}, now)
+
+	updates := []string{
+		`{"update_id": 7, "message": {"chat": {"id": 42}, "text": "/list"}}`,
+		`{"update_id": 8, "message": {"chat": {"id": 42}, "text": "/pause@melanzana_bot 3d"}}`,
+		`{"update_id": 9, "message": {"chat": {"id": 99}, "text": "/status"}}`,
+		`{"update_id": 10, "message": {"chat": {"id": 42}, "text": "thanks"}}`,
+	}
+	replies := map[string][]string{}
+	var offsets []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/botsecret/getUpdates":
+			offsets = append(offsets, r.URL.Query().Get("offset"))
+			fmt.Fprintf(w, `{"ok": true, "result": [%s]}`, strings.Join(updates, ","))
+			updates = nil
+		case "/botsecret/sendMessage":
+			var msg struct {
+				ChatID string `json:"chat_id"`
+				Text   string `json:"text"`
+			}
+			json.NewDecoder(r.Body).Decode(&msg)
+			replies[msg.ChatID] = append(replies[msg.ChatID], msg.Text)
+			fmt.Fprint(w, `{"ok": true}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	defer func(url string) { telegramAPIURL = url }(telegramAPIURL)
+	telegramAPIURL = server.URL + "/bot%s/%s"
+
+	config := AppConfig{
+		TelegramBotToken: "secret",
+		RecipientsFile:   filepath.Join(t.TempDir(), "recipients.json"),
+	}
+	if err := saveRecipients([]Recipient{{Name: "grandma", Telegram: "42", Weekdays: []string{"Sat"}}}, config.RecipientsFile); err != nil {
+		t.Fatal(err)
+	}
+	bot := &telegramBot{config: config, client: server.Client()}
+	for range 2 {
+		if err := bot.poll(); err != nil {
+			t.Fatalf("poll() error = %v", err)
+		}
+	}
+
+	if strings.Join(offsets, ",") != "0,11" {
+		t.Errorf("getUpdates offsets = %v, want 0 then past the last update", offsets)
+	}
+	if got := replies["42"]; len(got) != 2 || !strings.Contains(got[0], "2099-07-04") || strings.Contains(got[0], "2099-07-06") || !strings.Contains(got[1], "paused until") {
+		t.Errorf("replies to the subscriber = %q, want their Saturday slot, then the pause confirmed", got)
+	}
+	if got := replies["99"]; len(got) != 1 || !strings.Contains(got[0], "Your chat ID is 99") {
+		t.Errorf("replies to a stranger = %q, want only their chat ID", got)
+	}
+	recipients, err := readRecipients(config.RecipientsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if until := recipients[0].PausedUntil; until == nil || !until.Equal(now.Add(3*24*time.Hour)) {
+		t.Errorf("pausedUntil = %v, want 3 days from now", until)
+	}
+}
+
+func TestTelegramErrorsHideToken(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	unreachable := server.URL
+	server.Close()
+	defer func(url string) { telegramAPIURL = url }(telegramAPIURL)
+	telegramAPIURL = unreachable + "/bot%s/%s"
+
+	config := AppConfig{TelegramBotToken: "123456:secret-token", Retry: RetryConfig{RetryPolicy: RetryPolicy{MaxAttempts: 1}}}
+	err := sendTelegramMessage(config, "42", "hello")
+	if err == nil || strings.Contains(err.Error(), "secret-token") || !strings.Contains(err.Error(), "<token>") {
+		t.Errorf("sendTelegramMessage() to an unreachable server error = %v, want it without the token", err)
+	}
+	bot := &telegramBot{config: config, client: &http.Client{}}
+	if err := bot.poll(); err == nil || strings.Contains(err.Error(), "secret-token") {
+		t.Errorf("poll() of an unreachable server error = %v, want it without the token", err)
+	}
+}
+
+func TestTelegramBookButtons(t *testing.T) {
+	fixClock(t, time.Date(2099, 7, 1, 12, 0, 0, 0, time.UTC))
+	type sent struct {
+		Text    string
+		Buttons [][]notify.TelegramButton
+	}
+	messages := map[string][]sent{}
+	var updates []string
+	bookings := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/botsecret/getUpdates":
+			fmt.Fprintf(w, `{"ok": true, "result": [%s]}`, strings.Join(updates, ","))
+			updates = nil
+		case "/botsecret/sendMessage":
+			var msg struct {
+				ChatID      string `json:"chat_id"`
+				Text        string `json:"text"`
+				ReplyMarkup struct {
+					InlineKeyboard [][]notify.TelegramButton `json:"inline_keyboard"`
+				} `json:"reply_markup"`
+			}
+			json.NewDecoder(r.Body).Decode(&msg)
+			messages[msg.ChatID] = append(messages[msg.ChatID], sent{msg.Text, msg.ReplyMarkup.InlineKeyboard})
+			fmt.Fprint(w, `{"ok": true}`)
+		case "/cart/add.js":
+			bookings++
+		case "/botsecret/answerCallbackQuery", "/email":
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	defer func(url string) { telegramAPIURL = url }(telegramAPIURL)
+	telegramAPIURL = server.URL + "/bot%s/%s"
+	defer func(url string) { sendGridURL = url }(sendGridURL)
+	sendGridURL = server.URL + "/email"
+
+	config := AppConfig{
+		TelegramBotToken:    "secret",
+		TelegramBot:         true,
+		PollIntervalMinutes: 5,
+		EmailProvider:       "sendgrid",
+		EmailAPIKey:         "key",
+		FromEmail:           "from@example.com",
+		AutoBooking: AutoBookConfig{
+			Name:      "Ada",
+			Email:     "ada@example.com",
+			Telegram:  "42",
+			URL:       server.URL + "/cart/add.js",
+			StateFile: filepath.Join(t.TempDir(), "autobook_state.json"),
+		},
+		Retry: RetryConfig{RetryPolicy: RetryPolicy{MaxAttempts: 1}},
+	}
+	n := Notification{Subject: "New slots", Appointments: []Appointment{{Date: "2099-07-04", Time: "10:00 am – 10:30 am", Spaces: 1}}}
+	sendToRecipient(config, Recipient{Name: "ada", Telegram: "42"}, n, "", "")
+	sendToRecipient(config, Recipient{Name: "grandma", Telegram: "7"}, n, "", "")
+	if got := messages["7"]; len(got) != 1 || len(got[0].Buttons) != 0 {
+		t.Errorf("messages to another recipient = %+v, want the notification without buttons", got)
+	}
+	got := messages["42"]
+	if len(got) != 1 || len(got[0].Buttons) != 1 || !strings.HasPrefix(got[0].Buttons[0][0].CallbackData, "book:") {
+		t.Fatalf("messages to the booker = %+v, want the notification with a Book button", got)
+	}
+	book := got[0].Buttons[0][0].CallbackData
+
+	press := func(chat int, data string) {
+		t.Helper()
+		updates = append(updates, fmt.Sprintf(`{"update_id": %d, "callback_query": {"id": "q", "data": %q, "message": {"chat": {"id": %d}}}}`, len(updates)+1, data, chat))
+		bot := &telegramBot{config: config, client: server.Client()}
+		if err := bot.poll(); err != nil {
+			t.Fatalf("poll() error = %v", err)
+		}
+	}
+
+	press(7, book)
+	press(42, book)
+	if bookings != 0 {
+		t.Fatalf("pressing Book sent %d booking requests, want none before confirmation", bookings)
+	}
+	if got := messages["7"]; len(got) != 2 || !strings.Contains(got[1].Text, "Only the person") {
+		t.Errorf("replies to another chat = %+v, want the press refused", got)
+	}
+	got = messages["42"]
+	if len(got) != 2 || !strings.Contains(got[1].Text, "Book 2099-07-04") || len(got[1].Buttons) != 1 || len(got[1].Buttons[0]) != 2 {
+		t.Fatalf("reply to Book = %+v, want a confirmation with yes and cancel buttons", got)
+	}
+	confirm := got[1].Buttons[0][0].CallbackData
+
+	press(42, "cancel")
+	press(42, confirm)
+	press(42, confirm)
+	got = messages["42"]
+	if bookings != 1 || len(got) != 5 || got[2].Text != "Not booked." || !strings.Contains(got[3].Text, "Booked Melanzana slot 2099-07-04") || !strings.Contains(got[4].Text, "already booked") {
+		t.Errorf("after cancel and confirming twice: %d booking requests, replies %+v; want one booking, reported once", bookings, got)
+	}
+}
@@ -0,0 +1,179 @@
+package melanzana
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"strings"
+	"time"
+)
+
+// EmailTemplateData is the data passed to the HTML email template.
+type EmailTemplateData struct {
+	Intro      string
+	Days       []AppointmentDay
+	Removed    []SlotView
+	Count      int
+	BookingURL string
+	Footer     []string
+}
+
+// AppointmentDay groups the appointments that fall on a single date.
+type AppointmentDay struct {
+	Date  string
+	Slots []SlotView
+	Trend string // Spaces and change since the previous cycle, set for digests
+}
+
+// SlotView is an appointment along with its rendered display fields. When
+// slots are collapsed, a view covers a run of back-to-back slots; its Time
+// spans the run and Spaces is the most spaces in any one of them.
+type SlotView struct {
+	Appointment
+	DisplayTime string
+	SlotCount   int    // Number of slots the view covers; 1 unless collapsed
+	BookingURL  string // Link to book the slot, or the first slot of a collapsed run
+}
+
+// groupAppointmentsByDate groups appointments by date, preserving the order
+// in which dates first appear.
+func groupAppointmentsByDate(appointments []Appointment, opts RenderOptions) []AppointmentDay {
+	var days []AppointmentDay
+	index := make(map[string]int)
+
+	for _, view := range slotViews(appointments, opts) {
+		i, ok := index[view.Date]
+		if !ok {
+			i = len(days)
+			index[view.Date] = i
+			days = append(days, AppointmentDay{Date: view.Date})
+		}
+		days[i].Slots = append(days[i].Slots, view)
+	}
+
+	return days
+}
+
+// appointmentDates lists the distinct dates of appointments in the order
+// they first appear.
+func appointmentDates(appointments []Appointment) []string {
+	var dates []string
+	seen := make(map[string]bool)
+	for _, appt := range appointments {
+		if !seen[appt.Date] {
+			seen[appt.Date] = true
+			dates = append(dates, appt.Date)
+		}
+	}
+	return dates
+}
+
+// slotViews renders display fields for a flat list of appointments,
+// collapsing back-to-back slots if opts asks for it.
+func slotViews(appointments []Appointment, opts RenderOptions) []SlotView {
+	if opts.CollapseSlots {
+		appointments, counts := collapseSlots(appointments)
+		views := make([]SlotView, len(appointments))
+		for i, appt := range appointments {
+			views[i] = SlotView{Appointment: appt, DisplayTime: displayTime(appt, opts), SlotCount: counts[i], BookingURL: slotBookingLink(appt)}
+		}
+		return views
+	}
+
+	var views []SlotView
+	for _, appt := range appointments {
+		views = append(views, SlotView{Appointment: appt, DisplayTime: displayTime(appt, opts), SlotCount: 1, BookingURL: slotBookingLink(appt)})
+	}
+	return views
+}
+
+// calendarSuffix names the slot's calendar in text listings, if it has one.
+func calendarSuffix(appt Appointment) string {
+	if appt.Calendar == "" {
+		return ""
+	}
+	return ", " + appt.Calendar
+}
+
+// collapseSlots merges each run of slots on the same day where one ends as
+// the next starts into a single appointment spanning the run, with the most
+// spaces offered by any slot in it. counts holds how many slots each merged
+// appointment covers. Slots whose times can't be parsed are left alone.
+func collapseSlots(appointments []Appointment) (merged []Appointment, counts []int) {
+	var lastEnd time.Time
+	for _, appt := range appointments {
+		start, end, err := parseSlotTimes(appt)
+		if err != nil {
+			merged = append(merged, appt)
+			counts = append(counts, 1)
+			lastEnd = time.Time{}
+			continue
+		}
+
+		if n := len(merged); n > 0 && merged[n-1].Date == appt.Date && merged[n-1].Calendar == appt.Calendar && lastEnd.Equal(start) {
+			run := &merged[n-1]
+			runStart, _, _ := strings.Cut(run.Time, " – ")
+			run.Time = runStart + " – " + end.Format("3:04 pm")
+			run.Spaces = max(run.Spaces, appt.Spaces)
+			counts[n-1]++
+		} else {
+			merged = append(merged, appt)
+			counts = append(counts, 1)
+		}
+		lastEnd = end
+	}
+	return merged, counts
+}
+
+// loadHTMLTemplate parses the template at templatePath, or the default
+// email.html.tmpl asset (which assetsDir may override) if templatePath is empty.
+func loadHTMLTemplate(templatePath, assetsDir string) (*template.Template, error) {
+	if templatePath == "" {
+		data, err := readAsset(assetsDir, "templates/email.html.tmpl")
+		if err != nil {
+			return nil, err
+		}
+		return template.New("email").Parse(string(data))
+	}
+
+	data, err := os.ReadFile(templatePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read email template %s: %w", templatePath, err)
+	}
+
+	tmpl, err := template.New("email").Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse email template %s: %w", templatePath, err)
+	}
+	return tmpl, nil
+}
+
+// buildHTMLEmailBody renders the HTML version of the notification email.
+func buildHTMLEmailBody(n Notification, opts RenderOptions) (string, error) {
+	tmpl, err := loadHTMLTemplate(opts.HTMLTemplate, opts.AssetsDir)
+	if err != nil {
+		return "", err
+	}
+
+	days := groupAppointmentsByDate(n.Appointments, opts)
+	for i := range days {
+		if trend, ok := n.Trends[days[i].Date]; ok {
+			days[i].Trend = formatTrend(trend)
+		}
+	}
+
+	data := EmailTemplateData{
+		Intro:      n.Intro,
+		Days:       days,
+		Removed:    slotViews(n.Removed, opts),
+		Count:      len(n.Appointments),
+		BookingURL: bookingURL,
+		Footer:     n.Footer,
+	}
+
+	var body strings.Builder
+	if err := tmpl.Execute(&body, data); err != nil {
+		return "", fmt.Errorf("failed to render email template: %w", err)
+	}
+	return body.String(), nil
+}
@@ -0,0 +1,235 @@
+package melanzana
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGroupAppointmentsByDate(t *testing.T) {
+	appointments := []Appointment{
+		{Date: "2024-05-16", Time: "10:00 am – 10:30 am", Spaces: 1, IsAvailable: true},
+		{Date: "2024-05-15", Time: "10:00 am – 10:30 am", Spaces: 2, IsAvailable: true},
+		{Date: "2024-05-16", Time: "11:00 am – 11:30 am", Spaces: 3, IsAvailable: true},
+	}
+
+	days := groupAppointmentsByDate(appointments, RenderOptions{})
+
+	if len(days) != 2 {
+		t.Fatalf("groupAppointmentsByDate() length = %d, want 2", len(days))
+	}
+	if days[0].Date != "2024-05-16" || len(days[0].Slots) != 2 {
+		t.Errorf("days[0] = %+v, want 2024-05-16 with 2 slots", days[0])
+	}
+	if days[1].Date != "2024-05-15" || len(days[1].Slots) != 1 {
+		t.Errorf("days[1] = %+v, want 2024-05-15 with 1 slot", days[1])
+	}
+}
+
+func TestBuildHTMLEmailBody(t *testing.T) {
+	appointments := []Appointment{
+		{Date: "2024-05-15", Time: "10:00 am – 10:30 am", Spaces: 2, IsAvailable: true},
+	}
+
+	t.Run("DefaultTemplate", func(t *testing.T) {
+		result, err := buildHTMLEmailBody(Notification{Appointments: appointments}, RenderOptions{})
+		if err != nil {
+			t.Fatalf("buildHTMLEmailBody() error = %v", err)
+		}
+		for _, substring := range []string{"<h3>2024-05-15</h3>", "<td>10:00 am – 10:30 am</td>", bookingURL} {
+			if !strings.Contains(result, substring) {
+				t.Errorf("buildHTMLEmailBody() missing %q\nFull result: %s", substring, result)
+			}
+		}
+	})
+
+	t.Run("CustomTemplate", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "email.html")
+		if err := os.WriteFile(path, []byte("{{.Count}} slots{{range .Days}} on {{.Date}}{{end}}"), 0644); err != nil {
+			t.Fatalf("Failed to write template: %v", err)
+		}
+
+		result, err := buildHTMLEmailBody(Notification{Appointments: appointments}, RenderOptions{HTMLTemplate: path})
+		if err != nil {
+			t.Fatalf("buildHTMLEmailBody() error = %v", err)
+		}
+		if result != "1 slots on 2024-05-15" {
+			t.Errorf("buildHTMLEmailBody() = %q, want %q", result, "1 slots on 2024-05-15")
+		}
+	})
+
+	t.Run("MissingTemplate", func(t *testing.T) {
+		_, err := buildHTMLEmailBody(Notification{Appointments: appointments}, RenderOptions{HTMLTemplate: filepath.Join(t.TempDir(), "missing.html")})
+		if err == nil {
+			t.Errorf("buildHTMLEmailBody() with missing template error = nil, want error")
+		}
+	})
+}
+
+func TestRemovedAppointmentsRendering(t *testing.T) {
+	n := Notification{
+		Subject:      "Update",
+		Intro:        "Re-checked 45 seconds after the first alert: 1 of 2 slots are still available.",
+		Appointments: []Appointment{{Date: "2024-05-15", Time: "10:00 am – 10:30 am", Spaces: 1}},
+		Removed:      []Appointment{{Date: "2024-05-16", Time: "11:00 am – 11:30 am", Spaces: 1}},
+	}
+
+	text := buildNotificationText(n, RenderOptions{})
+	if !strings.Contains(text, "No longer available:\n- 2024-05-16 at 11:00 am – 11:30 am") {
+		t.Errorf("buildNotificationText() missing removed slot:\n%s", text)
+	}
+
+	html, err := buildHTMLEmailBody(n, RenderOptions{})
+	if err != nil {
+		t.Fatalf("buildHTMLEmailBody() error = %v", err)
+	}
+	if !strings.Contains(html, "<s>2024-05-16 11:00 am – 11:30 am</s>") {
+		t.Errorf("buildHTMLEmailBody() missing removed slot:\n%s", html)
+	}
+}
+
+func TestCollapseSlots(t *testing.T) {
+	appointments := []Appointment{
+		{Date: "2024-06-14", Time: "10:00 am – 10:30 am", Spaces: 1},
+		{Date: "2024-06-14", Time: "10:30 am – 11:00 am", Spaces: 2},
+		{Date: "2024-06-14", Time: "11:00 am – 11:30 am", Spaces: 1},
+		{Date: "2024-06-14", Time: "2:00 pm – 2:30 pm", Spaces: 3},
+		{Date: "2024-06-15", Time: "2:30 pm – 3:00 pm", Spaces: 1},
+		{Date: "2024-06-15", Time: "unparseable", Spaces: 1},
+	}
+
+	merged, counts := collapseSlots(appointments)
+
+	want := []struct {
+		date, time string
+		spaces     int
+		count      int
+	}{
+		{"2024-06-14", "10:00 am – 11:30 am", 2, 3},
+		{"2024-06-14", "2:00 pm – 2:30 pm", 3, 1},
+		{"2024-06-15", "2:30 pm – 3:00 pm", 1, 1},
+		{"2024-06-15", "unparseable", 1, 1},
+	}
+	if len(merged) != len(want) {
+		t.Fatalf("collapseSlots() = %+v, want %d slots", merged, len(want))
+	}
+	for i, w := range want {
+		if merged[i].Date != w.date || merged[i].Time != w.time || merged[i].Spaces != w.spaces || counts[i] != w.count {
+			t.Errorf("slot %d = %+v covering %d, want %s %s with %d spaces covering %d",
+				i, merged[i], counts[i], w.date, w.time, w.spaces, w.count)
+		}
+	}
+	if appointments[0].Time != "10:00 am – 10:30 am" {
+		t.Errorf("collapseSlots() modified its input: %+v", appointments[0])
+	}
+}
+
+func TestCollapsedRendering(t *testing.T) {
+	n := Notification{Appointments: []Appointment{
+		{Date: "2024-06-14", Time: "10:00 am – 10:30 am", Spaces: 1},
+		{Date: "2024-06-14", Time: "10:30 am – 11:00 am", Spaces: 2},
+	}}
+	opts := RenderOptions{CollapseSlots: true}
+
+	text := buildNotificationText(n, opts)
+	if want := "- 2024-06-14 at 10:00 am – 11:00 am available (2 back-to-back slots, up to 2 spaces)"; !strings.Contains(text, want) {
+		t.Errorf("buildNotificationText() missing %q:\n%s", want, text)
+	}
+
+	html, err := buildHTMLEmailBody(n, opts)
+	if err != nil {
+		t.Fatalf("buildHTMLEmailBody() error = %v", err)
+	}
+	if want := "<td>10:00 am – 11:00 am</td><td>up to 2</td>"; !strings.Contains(html, want) {
+		t.Errorf("buildHTMLEmailBody() missing %q:\n%s", want, html)
+	}
+}
+
+func TestTrendRendering(t *testing.T) {
+	n := Notification{
+		Intro:  "Digest",
+		Digest: true,
+		Appointments: []Appointment{
+			{Date: "2024-06-14", Time: "10:00 am – 10:30 am", Spaces: 2},
+			{Date: "2024-06-15", Time: "10:00 am – 10:30 am", Spaces: 4},
+		},
+		Trends: map[string]DayTrend{"2024-06-14": {Spaces: 3, Delta: -4}, "2024-06-15": {Spaces: 4, Delta: 1}},
+	}
+
+	text := buildNotificationText(n, RenderOptions{})
+	if want := "Spaces by day since the last check:\n- 2024-06-14: 3 spaces ▼4\n- 2024-06-15: 4 spaces ▲1\n"; !strings.Contains(text, want) {
+		t.Errorf("buildNotificationText() missing %q:\n%s", want, text)
+	}
+
+	html, err := buildHTMLEmailBody(n, RenderOptions{})
+	if err != nil {
+		t.Fatalf("buildHTMLEmailBody() error = %v", err)
+	}
+	if want := "<h3>2024-06-14 <small>3 spaces ▼4</small></h3>"; !strings.Contains(html, want) {
+		t.Errorf("buildHTMLEmailBody() missing %q:\n%s", want, html)
+	}
+}
+
+// TestNotificationGolden renders each kind of notification for a fixed set
+// of appointments and compares the subject and text body, and the HTML
+// body, with testdata/notify/<case>.txt and .html, so that template changes
+// are reviewed as diffs of what recipients see. Run with -update to rewrite
+// the golden files after an intended change.
+func TestNotificationGolden(t *testing.T) {
+	defer func(tz, booking, slot string, cals []Calendar) {
+		sourceTimezone, bookingURL, slotBookingURL, calendars = tz, booking, slot, cals
+	}(sourceTimezone, bookingURL, slotBookingURL, calendars)
+	sourceTimezone = "America/Denver"
+	bookingURL = "https://melanzana.com/book-an-appointment"
+	calendars = []Calendar{{Name: "Fitting", CalendarID: "cal-1"}, {Name: "Tailoring", CalendarID: "cal-2", VariantID: "v-2"}}
+
+	appointments := []Appointment{
+		{Date: "2025-03-12", Time: "10:00 am – 10:30 am", Spaces: 2, MaxSpaces: 4, IsAvailable: true},
+		{Date: "2025-03-12", Time: "10:30 am – 11:00 am", Spaces: 1, MaxSpaces: 4, IsAvailable: true},
+		{Date: "2025-03-12", Time: "2:00 pm – 2:30 pm", Spaces: 1, IsAvailable: true, Calendar: "Tailoring"},
+		{Date: "2025-03-14", Time: "9:00 am – 9:30 am", Spaces: 3, MaxSpaces: 4, IsAvailable: true, Calendar: "Fitting"},
+	}
+	eastern, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		notification Notification
+		opts         RenderOptions
+		slotBooking  string
+	}{
+		{"new_appointments", newAppointmentsNotification(appointments), RenderOptions{}, ""},
+		{"custom_subject_collapsed", newAppointmentsNotification(appointments),
+			RenderOptions{Subject: "{{count}} slots from {{earliestDate}}", CollapseSlots: true, Timezones: []*time.Location{eastern}},
+			"https://melanzana.com/book?date={date}&time={start}&variant={variantId}"},
+		{"digest", Notification{
+			Subject:      "Melanzana appointment digest (4 new slots)",
+			Intro:        "Many appointments are opening at once, so notifications are being collapsed into a rolling digest.",
+			Appointments: appointments,
+			Digest:       true,
+			Trends:       map[string]DayTrend{"2025-03-12": {Spaces: 4, Delta: 3}, "2025-03-14": {Spaces: 3, Delta: -1}},
+			Footer:       []string{"Found 5 minutes ago", "Unsubscribe: https://example.com/unsubscribe"},
+		}, RenderOptions{}, ""},
+		{"gone", goneNotification(appointments[1:3]), RenderOptions{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slotBookingURL = tt.slotBooking
+			subject, err := renderSubject(tt.opts.Subject, tt.notification)
+			if err != nil {
+				t.Fatalf("renderSubject() error = %v", err)
+			}
+			html, err := buildHTMLEmailBody(tt.notification, tt.opts)
+			if err != nil {
+				t.Fatalf("buildHTMLEmailBody() error = %v", err)
+			}
+			text := "Subject: " + subject + "\n\n" + buildNotificationText(tt.notification, tt.opts) + "\n"
+			checkGolden(t, filepath.Join("testdata", "notify", tt.name+".txt"), text)
+			checkGolden(t, filepath.Join("testdata", "notify", tt.name+".html"), html)
+		})
+	}
+}
@@ -0,0 +1,134 @@
+// Command release cross-compiles melanzana for the supported platforms,
+// stamping the version into each binary and writing SHA256 checksums.
+//
+// Run from the repository root:
+//
+//	go run ./tools/release -version v1.2.0
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// target is a single GOOS/GOARCH combination to build.
+type target struct {
+	goos, goarch, goarm string
+}
+
+var targets = []target{
+	{goos: "linux", goarch: "amd64"},
+	{goos: "linux", goarch: "arm64"},
+	{goos: "linux", goarch: "arm", goarm: "7"}, // Raspberry Pi 2 and later on 32-bit OS
+	{goos: "linux", goarch: "arm", goarm: "6"}, // Raspberry Pi Zero / 1
+	{goos: "darwin", goarch: "amd64"},
+	{goos: "darwin", goarch: "arm64"},
+	{goos: "windows", goarch: "amd64"},
+}
+
+func (t target) name() string {
+	if t.goarm != "" {
+		return fmt.Sprintf("%s_%sv%s", t.goos, t.goarch, t.goarm)
+	}
+	return t.goos + "_" + t.goarch
+}
+
+func main() {
+	version := flag.String("version", "", "Version to stamp into binaries (default: git describe)")
+	outDir := flag.String("out", "dist", "Output directory for binaries and checksums")
+	flag.Parse()
+
+	if *version == "" {
+		*version = gitVersion()
+	}
+
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		log.Fatalf("Failed to create output directory: %v", err)
+	}
+
+	var artifacts []string
+	for _, t := range targets {
+		artifact, err := build(t, *version, *outDir)
+		if err != nil {
+			log.Fatalf("Build for %s failed: %v", t.name(), err)
+		}
+		log.Printf("Built %s", artifact)
+		artifacts = append(artifacts, artifact)
+	}
+
+	sumsPath := filepath.Join(*outDir, "SHA256SUMS")
+	if err := writeChecksums(sumsPath, artifacts); err != nil {
+		log.Fatalf("Failed to write checksums: %v", err)
+	}
+	log.Printf("Wrote %s for %d artifacts (version %s)", sumsPath, len(artifacts), *version)
+}
+
+// gitVersion describes the current commit, falling back to "dev" outside git.
+func gitVersion() string {
+	out, err := exec.Command("git", "describe", "--tags", "--always", "--dirty").Output()
+	if err != nil {
+		return "dev"
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// build compiles one target and returns the artifact path.
+func build(t target, version, outDir string) (string, error) {
+	name := fmt.Sprintf("melanzana_%s_%s", version, t.name())
+	if t.goos == "windows" {
+		name += ".exe"
+	}
+	artifact := filepath.Join(outDir, name)
+
+	cmd := exec.Command("go", "build",
+		"-trimpath",
+		"-ldflags", "-s -w -X github.com/pashbylogan/melanzana.version="+version,
+		"-o", artifact,
+		"./cmd/melanzana")
+	cmd.Env = append(os.Environ(), "CGO_ENABLED=0", "GOOS="+t.goos, "GOARCH="+t.goarch)
+	if t.goarm != "" {
+		cmd.Env = append(cmd.Env, "GOARM="+t.goarm)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+	return artifact, nil
+}
+
+// writeChecksums writes a sha256sum-compatible file for the artifacts.
+func writeChecksums(path string, artifacts []string) error {
+	var sums strings.Builder
+	for _, artifact := range artifacts {
+		sum, err := fileSHA256(artifact)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&sums, "%s  %s\n", sum, filepath.Base(artifact))
+	}
+	return os.WriteFile(path, []byte(sums.String()), 0644)
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,58 @@
+// Package melanzana is the Melanzana appointment watcher: it checks the
+// booking calendar, notifies recipients of new slots and records what it
+// found. The melanzana command in cmd/melanzana runs it through Main;
+// programs that embed the watcher run a Watcher instead.
+//
+//	config, err := melanzana.LoadConfig("config.json")
+//	if err != nil {
+//		return err
+//	}
+//	w := &melanzana.Watcher{Config: config}
+//	return w.Run(ctx)
+//
+// The building blocks are packages of their own: pkg/cowlendar fetches
+// availability, pkg/filter selects slots, pkg/store keeps state and
+// pkg/notify sends messages.
+package melanzana
+
+import (
+	"context"
+	"flag"
+	"io"
+)
+
+// LoadConfig reads the configuration file at path over the defaults and
+// validates it, as the command's -configFile flag does.
+func LoadConfig(path string) (AppConfig, error) {
+	fs := flag.NewFlagSet("melanzana", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	config, _, err := parseConfig(fs, []string{"-configFile", path})
+	return config, err
+}
+
+// Watcher checks the booking calendar every Config.PollIntervalMinutes and
+// notifies about new slots, as "melanzana watch" does.
+//
+// The watcher keeps its scraping state, such as the API client, rate
+// limiter and latest availability, in the package, as the command does, so
+// a process runs one Watcher at a time.
+type Watcher struct {
+	Config AppConfig // From LoadConfig; a PollIntervalMinutes of 0 checks every 15 minutes
+}
+
+// Run checks and notifies until ctx is done, serving the health endpoints
+// and answering the Telegram bot if configured. A cancellation during a
+// check takes effect once the check finishes; Run then logs the session
+// summary, emails it if configured, and returns nil. Run returns an error
+// without checking if the configuration can't be used.
+func (w *Watcher) Run(ctx context.Context) error {
+	config := w.Config
+	if config.PollIntervalMinutes <= 0 {
+		config.PollIntervalMinutes = defaultWatchInterval
+	}
+	if err := startScraper(&config); err != nil {
+		return err
+	}
+	watch(ctx, config)
+	return nil
+}
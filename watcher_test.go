@@ -0,0 +1,56 @@
+package melanzana
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcherRun(t *testing.T) {
+	defer func(client *http.Client, transport http.RoundTripper, tz string, cals []Calendar) {
+		apiClient, apiTransport, sourceTimezone, calendars = client, transport, tz, cals
+	}(apiClient, apiTransport, sourceTimezone, calendars)
+	fixClock(t, time.Date(2099, 7, 1, 12, 0, 0, 0, time.UTC))
+	// Read-only, so the check writes no state but the data file's lock.
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(path, []byte(`{"configVersion": 2, "monthsLookahead": 1, "readOnly": true}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	config.DataFile = filepath.Join(dir, "seen.json")
+	apiTransport = replayTransport{&replaySnapshot{Dir: t.TempDir()}}
+
+	bad := config
+	bad.Timezone = "Mars/Olympus_Mons"
+	if err := (&Watcher{Config: bad}).Run(context.Background()); err == nil {
+		t.Errorf("Run() with an invalid timezone error = nil, want error")
+	}
+
+	// A watcher cancelled before it starts finishes its first check, then stops.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cycles := session.Cycles
+	if err := (&Watcher{Config: config}).Run(ctx); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got := session.Cycles - cycles; got != 1 {
+		t.Errorf("Run() ran %d cycles, want 1", got)
+	}
+}
+
+func TestLoadConfigRejectsInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"configVersion": 2, "minSpaces": -1}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(path); err == nil {
+		t.Errorf("LoadConfig() with a negative minSpaces error = nil, want error")
+	}
+}
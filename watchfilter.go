@@ -0,0 +1,31 @@
+package melanzana
+
+import (
+	"time"
+
+	"github.com/pashbylogan/melanzana/pkg/filter"
+)
+
+// newWatchFilter compiles the top-level filters in config.
+func newWatchFilter(config AppConfig) (filter.Watch, error) {
+	return filter.NewWatch(filter.WatchOptions{
+		Weekdays:      config.AllowedWeekdays,
+		MinSpaces:     config.MinSpaces,
+		EarliestTime:  config.EarliestTime,
+		LatestTime:    config.LatestTime,
+		NotBefore:     config.NotBefore,
+		NotAfter:      config.NotAfter,
+		BlackoutDates: config.BlackoutDates,
+	})
+}
+
+// monthsThrough returns how many months the scraper must fetch, counting
+// the current month, to reach notAfter; 0 if it is unset or already past.
+func monthsThrough(notAfter string, now time.Time) int {
+	date, err := time.Parse("2006-01-02", notAfter)
+	if err != nil {
+		return 0
+	}
+	now = now.In(sourceLocation())
+	return max(0, (date.Year()-now.Year())*12+int(date.Month())-int(now.Month())+1)
+}
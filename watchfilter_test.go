@@ -0,0 +1,15 @@
+package melanzana
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMonthsThrough(t *testing.T) {
+	now := time.Date(2025, 5, 20, 12, 0, 0, 0, sourceLocation())
+	for notAfter, want := range map[string]int{"": 0, "2025-05-31": 1, "2025-07-20": 3, "2026-01-01": 9, "2025-04-30": 0} {
+		if got := monthsThrough(notAfter, now); got != want {
+			t.Errorf("monthsThrough(%q) = %d, want %d", notAfter, got, want)
+		}
+	}
+}